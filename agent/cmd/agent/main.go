@@ -17,7 +17,9 @@ func main() {
 		agentID        = flag.String("agent-id", "", "Agent ID (required)")
 		agentToken     = flag.String("agent-token", "dev-token", "Agent token (dev mode)")
 		maxConcurrency = flag.Int("max-concurrency", 1, "Maximum concurrent jobs")
-		inputCacheTTL  = flag.Duration("input-cache-ttl", 10*time.Minute, "Input cache TTL for forward jobs (0 to disable)")
+		inputCacheTTL  = flag.Duration("input-cache-ttl", 24*time.Hour, "Drop cached inputs unused for this long (0 to disable the input cache)")
+		inputCacheMB   = flag.Int64("input-cache-size-mb", 10240, "Disk quota of the input cache in MB, least recently used inputs are evicted (0 to disable)")
+		configFile     = flag.String("config", "", "Config file declaring job templates, the command policy, forward targets and gRPC descriptor sets (JSON; default: run any command, forward to loopback only)")
 	)
 	flag.Parse()
 
@@ -28,6 +30,15 @@ func main() {
 	// Create client
 	cli := client.New(*serverURL, *agentID, *agentToken, *maxConcurrency)
 	cli.SetInputCacheTTL(*inputCacheTTL)
+	cli.SetInputCacheSize(*inputCacheMB << 20)
+	if *configFile != "" {
+		policy, err := client.LoadPolicy(*configFile)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		cli.SetPolicy(policy)
+		log.Printf("Command policy %q, templates: %v", policy.Mode, policy.TemplateNames())
+	}
 
 	// Connect
 	if err := cli.Connect(); err != nil {
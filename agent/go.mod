@@ -5,9 +5,16 @@ go 1.21
 require (
 	github.com/gorilla/websocket v1.5.1
 	github.com/xiresource/proto v0.0.0
+	google.golang.org/grpc v1.58.3
 	google.golang.org/protobuf v1.31.0
 )
 
-require golang.org/x/net v0.17.0 // indirect
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230711160842-782d3b101e98 // indirect
+)
 
 replace github.com/xiresource/proto => ../proto
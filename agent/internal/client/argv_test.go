@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExecuteCommand_Argv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses printf and pwd")
+	}
+	client := New("ws://test", "test-agent", "test-token", 1)
+
+	// Shell metacharacters in a file name reach the program as one argument
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "a b; echo injected $(id) {output}")
+	if err := os.WriteFile(inputFile, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outputFile := filepath.Join(dir, "out")
+	spec := commandSpec{Argv: []string{"printf", "[%s]\n", "{input}", "--out={output}"}}
+	result, err := client.executeCommand(context.Background(), spec, dir, inputFile, nil, outputFile, dir, "", nil, nil)
+	if err != nil {
+		t.Fatalf("executeCommand: %v", err)
+	}
+	want := "[" + inputFile + "]\n[--out=" + outputFile + "]\n"
+	if result.Stdout != want {
+		t.Errorf("stdout %q, want %q", result.Stdout, want)
+	}
+
+	// Job environment and a relative working directory
+	spec = commandSpec{
+		Argv:       []string{"sh", "-c", `printf '%s|%s|%s' "$GREETING" "$OUT" "$(pwd)"`},
+		Env:        map[string]string{"GREETING": "hello world", "OUT": "{output}"},
+		WorkingDir: "work/sub",
+	}
+	result, err = client.executeCommand(context.Background(), spec, dir, "", nil, outputFile, dir, "", nil, nil)
+	if err != nil {
+		t.Fatalf("executeCommand with env: %v", err)
+	}
+	parts := strings.Split(result.Stdout, "|")
+	if len(parts) != 3 || parts[0] != "hello world" || parts[1] != outputFile {
+		t.Fatalf("stdout %q", result.Stdout)
+	}
+	if resolved, _ := filepath.EvalSymlinks(filepath.Join(dir, "work", "sub")); parts[2] != resolved && parts[2] != filepath.Join(dir, "work", "sub") {
+		t.Errorf("working directory %q, want %s", parts[2], filepath.Join(dir, "work", "sub"))
+	}
+
+	// Working directories leading out of the work directory are refused, also through placeholders
+	for _, wd := range []string{"../escaped", "{output_dir}/..", filepath.Dir(dir)} {
+		spec = commandSpec{Argv: []string{"true"}, WorkingDir: wd}
+		if result, err := client.executeCommand(context.Background(), spec, dir, "", nil, outputFile, dir, "", nil, nil); err == nil || result != nil {
+			t.Errorf("working directory %q outside the work directory: got %v, %v", wd, result, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escaped")); err == nil {
+		t.Error("working directory outside the work directory was created")
+	}
+
+	// A missing absolute working directory fails before the command starts
+	spec = commandSpec{Argv: []string{"true"}, WorkingDir: filepath.Join(dir, "missing")}
+	if result, err := client.executeCommand(context.Background(), spec, dir, "", nil, outputFile, dir, "", nil, nil); err == nil || result != nil {
+		t.Errorf("missing working directory: got %v, %v", result, err)
+	}
+
+	// An unknown program is a command failure
+	spec = commandSpec{Argv: []string{"no-such-program-xyz"}}
+	if _, err := client.executeCommand(context.Background(), spec, dir, "", nil, outputFile, dir, "", nil, nil); err == nil {
+		t.Error("unknown program: expected an error")
+	}
+}
+
+func TestCommandPlaceholders_SinglePass(t *testing.T) {
+	// A substituted path containing placeholder text is not expanded again
+	replacer := commandPlaceholders("/in/{output}", map[string]string{"a": "/in/a"}, "/out/file", "/out", "/progress", map[string]string{"size": "{input}"})
+	got := replacer.Replace("{input} {input:a} {output_dir} {output} {progress_file} {input:b} {param:size}")
+	want := "/in/{output} /in/a /out /out/file /progress {input:b} {input}"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
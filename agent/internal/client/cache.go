@@ -0,0 +1,420 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Input cache: downloaded inputs are kept in inputCacheDir, keyed by bucket + key and validated
+// against the object's ETag with a conditional GET (If-None-Match). A freshly presigned URL for
+// unchanged content is therefore answered with 304 and served from disk, for command and forward
+// jobs alike. Each entry is <id>.data plus <id>.json (bucket, key, ETag, size, last use), so the
+// cache survives agent restarts. Entries unused for inputCacheTTL are dropped, and the least
+// recently used entries are evicted to keep the cache within inputCacheSize bytes.
+
+// cacheEntry is one cached object (the JSON metadata next to its data file)
+type cacheEntry struct {
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	ETag     string    `json:"etag"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+
+	id      string
+	path    string // Data file
+	refs    int    // Callers currently reading the data file
+	removed bool   // Evicted or replaced while in use: the data file is removed on release
+}
+
+// SetInputCacheSize sets the disk quota of the input cache in bytes (0 disables caching).
+func (c *Client) SetInputCacheSize(size int64) {
+	c.inputCacheMu.Lock()
+	defer c.inputCacheMu.Unlock()
+	c.inputCacheSize = size
+}
+
+// inputCacheEnabled reports whether inputs are cached
+func (c *Client) inputCacheEnabled() bool {
+	c.inputCacheMu.Lock()
+	defer c.inputCacheMu.Unlock()
+	return c.inputCacheTTL > 0 && c.inputCacheSize > 0
+}
+
+// cacheID returns the file name (without extension) of the cache entry for bucket/key
+func cacheID(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "\x00" + key))
+	return fmt.Sprintf("%x", sum)
+}
+
+// acquireCachedInput returns a cached copy of the input, downloading it if it is not cached or changed.
+// The file stays valid until release is called. hit reports whether the cached copy was current.
+// Objects without an ETag or larger than the quota are downloaded to a temporary file instead.
+func (c *Client) acquireCachedInput(in namedInput) (path string, hit bool, release func(), err error) {
+	id := cacheID(in.Bucket, in.Key)
+	c.inputCacheMu.Lock()
+	if err := c.loadInputCacheLocked(); err != nil {
+		c.inputCacheMu.Unlock()
+		return "", false, nil, err
+	}
+	c.expireInputCacheLocked(time.Now())
+	var etag string
+	if entry := c.inputCache[id]; entry != nil {
+		etag = entry.ETag
+	}
+	c.inputCacheMu.Unlock()
+
+	tmp, err := os.CreateTemp(c.inputCacheDir, id+".*.part")
+	if err != nil {
+		return "", false, nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	newETag, err := c.download(in.URL, tmp, etag)
+	tmp.Close()
+	if errors.Is(err, errNotModified) {
+		os.Remove(tmp.Name())
+		c.inputCacheMu.Lock()
+		if entry := c.inputCache[id]; entry != nil && entry.ETag == etag {
+			entry.refs++
+			entry.LastUsed = time.Now()
+			c.saveCacheEntry(entry)
+			c.inputCacheMu.Unlock()
+			return entry.path, true, c.releaseCacheEntry(entry), nil
+		}
+		c.inputCacheMu.Unlock()
+		// Evicted or replaced meanwhile: download a private copy
+		path, release, err = c.downloadUncached(in)
+		return path, false, release, err
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", false, nil, err
+	}
+	path, release, err = c.storeCachedInput(in, id, newETag, tmp.Name())
+	return path, false, release, err
+}
+
+// acquireVerifiedInput is acquireCachedInput followed by the input's checksum check. A copy that
+// does not match is dropped from the cache; a cached copy is then downloaded once more, since the
+// object may have been replaced with the same ETag or the cache file damaged.
+func (c *Client) acquireVerifiedInput(in namedInput) (path string, hit bool, release func(), err error) {
+	for {
+		path, hit, release, err = c.acquireCachedInput(in)
+		if err != nil {
+			return "", false, nil, err
+		}
+		err = in.verify(path)
+		if err == nil {
+			return path, hit, release, nil
+		}
+		release()
+		c.dropCachedInput(in, path)
+		if !hit {
+			return "", false, nil, err
+		}
+		log.Printf("Cached copy of %s failed verification, downloading it again: %v", in.Key, err)
+	}
+}
+
+// dropCachedInput removes the cache entry of in if its data file is path
+func (c *Client) dropCachedInput(in namedInput, path string) {
+	c.inputCacheMu.Lock()
+	defer c.inputCacheMu.Unlock()
+	if entry := c.inputCache[cacheID(in.Bucket, in.Key)]; entry != nil && entry.path == path {
+		c.removeCacheEntryLocked(entry)
+	}
+}
+
+// downloadUncached downloads an input to a temporary file of the cache directory
+func (c *Client) downloadUncached(in namedInput) (string, func(), error) {
+	tmp, err := os.CreateTemp(c.inputCacheDir, "input.*.part")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	_, err = c.download(in.URL, tmp, "")
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
+
+// storeCachedInput adds a downloaded file to the cache (replacing an older version of the object)
+// and returns it acquired
+func (c *Client) storeCachedInput(in namedInput, id, etag, tmpPath string) (string, func(), error) {
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", nil, fmt.Errorf("failed to stat cache file: %w", err)
+	}
+
+	c.inputCacheMu.Lock()
+	defer c.inputCacheMu.Unlock()
+	if etag == "" || info.Size() > c.inputCacheSize {
+		return tmpPath, func() { os.Remove(tmpPath) }, nil
+	}
+	if old := c.inputCache[id]; old != nil {
+		c.removeCacheEntryLocked(old)
+	}
+	// Each version gets its own data file, so that readers of a replaced version are not affected
+	entry := &cacheEntry{
+		Bucket:   in.Bucket,
+		Key:      in.Key,
+		ETag:     etag,
+		Size:     info.Size(),
+		LastUsed: time.Now(),
+		id:       id,
+		path:     strings.TrimSuffix(tmpPath, ".part") + ".data",
+		refs:     1,
+	}
+	if err := os.Rename(tmpPath, entry.path); err != nil {
+		os.Remove(tmpPath)
+		return "", nil, fmt.Errorf("failed to store cache file: %w", err)
+	}
+	c.inputCache[id] = entry
+	c.inputCacheBytes += entry.Size
+	c.saveCacheEntry(entry)
+	c.evictInputCacheLocked()
+	return entry.path, c.releaseCacheEntry(entry), nil
+}
+
+// releaseCacheEntry returns the release function of an acquired entry
+func (c *Client) releaseCacheEntry(entry *cacheEntry) func() {
+	return func() {
+		c.inputCacheMu.Lock()
+		defer c.inputCacheMu.Unlock()
+		entry.refs--
+		if entry.removed && entry.refs == 0 {
+			os.Remove(entry.path)
+		}
+	}
+}
+
+// removeCacheEntryLocked drops an entry; its data file is removed once no caller reads it
+func (c *Client) removeCacheEntryLocked(entry *cacheEntry) {
+	if c.inputCache[entry.id] == entry {
+		delete(c.inputCache, entry.id)
+	}
+	c.inputCacheBytes -= entry.Size
+	entry.removed = true
+	os.Remove(filepath.Join(c.inputCacheDir, entry.id+".json"))
+	if entry.refs == 0 {
+		os.Remove(entry.path)
+	}
+}
+
+// expireInputCacheLocked drops entries unused for longer than inputCacheTTL
+func (c *Client) expireInputCacheLocked(now time.Time) {
+	for _, entry := range c.inputCache {
+		if entry.refs == 0 && now.Sub(entry.LastUsed) > c.inputCacheTTL {
+			c.removeCacheEntryLocked(entry)
+		}
+	}
+}
+
+// evictInputCacheLocked evicts the least recently used entries not in use until the cache fits its quota
+func (c *Client) evictInputCacheLocked() {
+	if c.inputCacheBytes <= c.inputCacheSize {
+		return
+	}
+	entries := make([]*cacheEntry, 0, len(c.inputCache))
+	for _, entry := range c.inputCache {
+		if entry.refs == 0 {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.Before(entries[j].LastUsed) })
+	for _, entry := range entries {
+		if c.inputCacheBytes <= c.inputCacheSize {
+			return
+		}
+		log.Printf("Evicting cached input %s/%s (%d bytes)", entry.Bucket, entry.Key, entry.Size)
+		c.removeCacheEntryLocked(entry)
+	}
+}
+
+// loadInputCacheLocked builds the index from the metadata files on first use. Files that do not
+// belong to a valid entry (partial downloads, files of an older cache layout) are removed.
+func (c *Client) loadInputCacheLocked() error {
+	if c.inputCache != nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.inputCacheDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	names, err := os.ReadDir(c.inputCacheDir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache dir: %w", err)
+	}
+
+	c.inputCache = make(map[string]*cacheEntry)
+	c.inputCacheBytes = 0
+	keep := make(map[string]bool)
+	for _, name := range names {
+		id, ok := strings.CutSuffix(name.Name(), ".json")
+		if !ok {
+			continue
+		}
+		entry := c.readCacheEntry(id)
+		if entry == nil {
+			continue
+		}
+		c.inputCache[id] = entry
+		c.inputCacheBytes += entry.Size
+		keep[id+".json"] = true
+		keep[filepath.Base(entry.path)] = true
+	}
+	for _, name := range names {
+		if !keep[name.Name()] {
+			os.RemoveAll(filepath.Join(c.inputCacheDir, name.Name()))
+		}
+	}
+	if len(c.inputCache) > 0 {
+		log.Printf("Input cache: %d cached input(s), %d bytes", len(c.inputCache), c.inputCacheBytes)
+	}
+	c.evictInputCacheLocked()
+	return nil
+}
+
+// readCacheEntry reads the metadata of entry id; nil if it is invalid or its data file does not match
+func (c *Client) readCacheEntry(id string) *cacheEntry {
+	data, err := os.ReadFile(filepath.Join(c.inputCacheDir, id+".json"))
+	if err != nil {
+		return nil
+	}
+	var meta struct {
+		cacheEntry
+		File string `json:"file"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil || meta.ETag == "" || cacheID(meta.Bucket, meta.Key) != id ||
+		filepath.Base(meta.File) != meta.File || !strings.HasPrefix(meta.File, id+".") {
+		return nil
+	}
+	entry := meta.cacheEntry
+	entry.id = id
+	entry.path = filepath.Join(c.inputCacheDir, meta.File)
+	if info, err := os.Stat(entry.path); err != nil || info.Size() != entry.Size {
+		return nil
+	}
+	return &entry
+}
+
+// saveCacheEntry writes the metadata of an entry (failures only cost the entry after a restart)
+func (c *Client) saveCacheEntry(entry *cacheEntry) {
+	data, err := json.Marshal(struct {
+		*cacheEntry
+		File string `json:"file"`
+	}{entry, filepath.Base(entry.path)})
+	if err == nil {
+		path := filepath.Join(c.inputCacheDir, entry.id+".json")
+		if err = os.WriteFile(path+".tmp", data, 0o644); err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to write cache metadata for %s/%s: %v", entry.Bucket, entry.Key, err)
+	}
+}
+
+// fetchInput makes an input available at dest: copied from the cache when possible, otherwise downloaded.
+// Inputs without a bucket (older clouds) are not cached. The input is recorded as a cache hit of the job.
+func (c *Client) fetchInput(jobID string, in namedInput, dest string) error {
+	if in.Bucket == "" || !c.inputCacheEnabled() {
+		if err := c.downloadToFile(in.URL, dest); err != nil {
+			return err
+		}
+		if err := in.verify(dest); err != nil {
+			os.Remove(dest)
+			return err
+		}
+		return nil
+	}
+	path, hit, release, err := c.acquireVerifiedInput(in)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := copyFile(path, dest); err != nil {
+		return err
+	}
+	if hit {
+		c.recordCacheHit(jobID, in.label())
+	}
+	return nil
+}
+
+// openInput returns a local file with the input's content for reading (forward LOCAL_FILE mode)
+// and a function to call when done with it
+func (c *Client) openInput(jobID string, in namedInput) (string, func(), error) {
+	if in.Bucket == "" || !c.inputCacheEnabled() {
+		tmp, err := os.CreateTemp("", "forward_input_*"+filepath.Ext(in.Key))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		tmp.Close()
+		if err := c.downloadToFile(in.URL, tmp.Name()); err != nil {
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		if err := in.verify(tmp.Name()); err != nil {
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		return tmp.Name(), func() { _ = os.Remove(tmp.Name()) }, nil
+	}
+	path, hit, release, err := c.acquireVerifiedInput(in)
+	if err != nil {
+		return "", nil, err
+	}
+	if hit {
+		c.recordCacheHit(jobID, in.label())
+	}
+	return path, release, nil
+}
+
+// copyFile copies src to dest (commands get their own copy, so they cannot modify the cache)
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open cached input: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create input file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return fmt.Errorf("failed to copy cached input: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to copy cached input: %w", err)
+	}
+	return nil
+}
+
+// recordCacheHit notes an input served from the cache; the hits are reported with the job's final JobStatus
+func (c *Client) recordCacheHit(jobID, label string) {
+	c.cacheHitsMu.Lock()
+	defer c.cacheHitsMu.Unlock()
+	c.cacheHits[jobID] = append(c.cacheHits[jobID], label)
+}
+
+// takeCacheHits returns and forgets the cache hits of a job
+func (c *Client) takeCacheHits(jobID string) []string {
+	c.cacheHitsMu.Lock()
+	defer c.cacheHitsMu.Unlock()
+	hits := c.cacheHits[jobID]
+	delete(c.cacheHits, jobID)
+	return hits
+}
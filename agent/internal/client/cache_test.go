@@ -0,0 +1,259 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+// etagServer serves objects by path with ETags and answers If-None-Match with 304.
+// Query strings (presigned signatures) are ignored, as by a real object store.
+type etagServer struct {
+	mu        sync.Mutex
+	objects   map[string]string
+	etags     map[string]string
+	transfers map[string]int // Full downloads per path
+	server    *httptest.Server
+}
+
+func newETagServer(t *testing.T) *etagServer {
+	t.Helper()
+	s := &etagServer{objects: map[string]string{}, etags: map[string]string{}, transfers: map[string]int{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", s.etags[r.URL.Path])
+		if r.Header.Get("If-None-Match") == s.etags[r.URL.Path] {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.transfers[r.URL.Path]++
+		w.Write([]byte(data))
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *etagServer) put(path, data, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[path] = data
+	s.etags[path] = etag
+}
+
+// input returns a namedInput with a freshly "signed" URL, like every assignment gets
+func (s *etagServer) input(key string) namedInput {
+	return namedInput{Bucket: "lab-main", Key: key, URL: s.server.URL + "/" + key + "?signature=" + randomHex(4)}
+}
+
+func newCacheClient(t *testing.T, dir string) *Client {
+	t.Helper()
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.httpClient = &http.Client{Timeout: 5 * time.Second}
+	client.inputCacheDir = dir
+	return client
+}
+
+func TestInputCache_ContentAddressed(t *testing.T) {
+	store := newETagServer(t)
+	store.put("/models/a.bin", "model-a", `"a1"`)
+	dir := t.TempDir()
+	client := newCacheClient(t, dir)
+	dest := filepath.Join(t.TempDir(), "a.bin")
+
+	// A new URL for the same object is served from the cache after one transfer
+	for i := 0; i < 3; i++ {
+		if err := client.fetchInput("job-1", store.input("models/a.bin"), dest); err != nil {
+			t.Fatalf("fetchInput failed: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "model-a" || store.transfers["/models/a.bin"] != 1 {
+		t.Errorf("Got %q after %d transfers, want 1", data, store.transfers["/models/a.bin"])
+	}
+	if hits := client.takeCacheHits("job-1"); len(hits) != 2 || hits[0] != "input" {
+		t.Errorf("Unexpected cache hits: %v", hits)
+	}
+
+	// A changed object (new ETag) is downloaded again
+	store.put("/models/a.bin", "model-a-v2", `"a2"`)
+	client.fetchInput("job-2", store.input("models/a.bin"), dest)
+	if data, _ := os.ReadFile(dest); string(data) != "model-a-v2" || store.transfers["/models/a.bin"] != 2 {
+		t.Errorf("Got %q after %d transfers, want 2", data, store.transfers["/models/a.bin"])
+	}
+	if hits := client.takeCacheHits("job-2"); len(hits) != 0 {
+		t.Errorf("Changed object reported as cache hit: %v", hits)
+	}
+
+	// The cache survives a restart: a new client on the same directory gets a hit
+	restarted := newCacheClient(t, dir)
+	restarted.fetchInput("job-3", store.input("models/a.bin"), dest)
+	if store.transfers["/models/a.bin"] != 2 || len(restarted.takeCacheHits("job-3")) != 1 {
+		t.Errorf("Expected a cache hit after restart, transfers=%d", store.transfers["/models/a.bin"])
+	}
+
+	// Inputs without a bucket (older clouds) are not cached
+	in := store.input("models/a.bin")
+	in.Bucket = ""
+	restarted.fetchInput("job-4", in, dest)
+	if store.transfers["/models/a.bin"] != 3 {
+		t.Errorf("Input without bucket should be downloaded, transfers=%d", store.transfers["/models/a.bin"])
+	}
+}
+
+func TestInputCache_Eviction(t *testing.T) {
+	store := newETagServer(t)
+	for _, name := range []string{"a", "b", "c"} {
+		store.put("/data/"+name, strings.Repeat(name, 10), `"`+name+`"`)
+	}
+	dir := t.TempDir()
+	client := newCacheClient(t, dir)
+	client.SetInputCacheSize(25)
+	dest := filepath.Join(t.TempDir(), "input")
+
+	client.fetchInput("job", store.input("data/a"), dest)
+	client.fetchInput("job", store.input("data/b"), dest)
+	client.fetchInput("job", store.input("data/a"), dest) // a is now more recently used than b
+	client.fetchInput("job", store.input("data/c"), dest) // over quota: b is evicted
+
+	client.inputCacheMu.Lock()
+	_, hasA := client.inputCache[cacheID("lab-main", "data/a")]
+	_, hasB := client.inputCache[cacheID("lab-main", "data/b")]
+	size := client.inputCacheBytes
+	client.inputCacheMu.Unlock()
+	if !hasA || hasB || size != 20 {
+		t.Errorf("Expected a and c cached (20 bytes), got a=%v b=%v size=%d", hasA, hasB, size)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 4 {
+		t.Errorf("Expected data and metadata of 2 entries, got %d files", len(files))
+	}
+
+	// An object larger than the quota is served without being cached
+	store.put("/data/big", strings.Repeat("x", 30), `"big"`)
+	path, release, err := client.openInput("job", store.input("data/big"))
+	if err != nil {
+		t.Fatalf("openInput failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 30 {
+		t.Errorf("Unexpected content of %s: %q", path, data)
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Uncached download should be removed on release: %v", err)
+	}
+}
+
+func TestInputCache_VerifiesChecksum(t *testing.T) {
+	store := newETagServer(t)
+	store.put("/data/a", "good", `"a1"`)
+	client := newCacheClient(t, t.TempDir())
+	dest := filepath.Join(t.TempDir(), "input")
+	sum := sha256.Sum256([]byte("good"))
+
+	in := store.input("data/a")
+	in.SHA256 = hex.EncodeToString(sum[:])
+	if err := client.fetchInput("job-1", in, dest); err != nil {
+		t.Fatalf("fetchInput with matching checksum failed: %v", err)
+	}
+
+	// A damaged cache file fails verification and the input is downloaded again
+	client.inputCacheMu.Lock()
+	os.WriteFile(client.inputCache[cacheID("lab-main", "data/a")].path, []byte("bad!"), 0o644)
+	client.inputCacheMu.Unlock()
+	in = store.input("data/a")
+	in.SHA256 = hex.EncodeToString(sum[:])
+	if err := client.fetchInput("job-2", in, dest); err != nil {
+		t.Fatalf("fetchInput after cache damage failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "good" || store.transfers["/data/a"] != 2 {
+		t.Errorf("Got %q after %d transfers, want a fresh download", data, store.transfers["/data/a"])
+	}
+
+	// Content that does not match is rejected and not kept in the cache
+	wrong := sha256.Sum256([]byte("other"))
+	in = store.input("data/a")
+	in.SHA256 = hex.EncodeToString(wrong[:])
+	if err := client.fetchInput("job-3", in, dest); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected checksum mismatch, got %v", err)
+	}
+	client.inputCacheMu.Lock()
+	_, cached := client.inputCache[cacheID("lab-main", "data/a")]
+	client.inputCacheMu.Unlock()
+	if cached {
+		t.Error("Input failing verification should not stay cached")
+	}
+
+	// Inputs outside the cache are verified too
+	in.Bucket = ""
+	if err := client.fetchInput("job-4", in, dest); err == nil {
+		t.Error("Expected checksum mismatch for an uncached input")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Input failing verification should be removed: %v", err)
+	}
+}
+
+func TestClient_ProcessJob_ReportsCachedInputs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	store := newETagServer(t)
+	store.put("/configs/run.yaml", "lr: 0.1\n", `"c1"`)
+	client := newCacheClient(t, t.TempDir())
+
+	var uploaded []byte
+	outputServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+	}))
+	defer outputServer.Close()
+
+	assign := func(jobID string) *control.JobAssigned {
+		in := store.input("configs/run.yaml")
+		return &control.JobAssigned{
+			JobId:         jobID,
+			AttemptId:     1,
+			InputDownload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: in.URL}},
+			InputBucket:   "lab-main",
+			InputKey:      "configs/run.yaml",
+			Inputs: []*control.JobInput{{
+				Name:     "config",
+				Bucket:   "lab-main",
+				Key:      "configs/run.yaml",
+				Download: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: store.input("configs/run.yaml").URL}},
+			}},
+			OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: outputServer.URL}},
+			OutputKey:    "jobs/" + jobID + "/1/output.txt",
+			Command:      "cat {input} {input:config} > {output}",
+			Shell:        true,
+		}
+	}
+	client.processJob(assign("job-1"))
+	client.processJob(assign("job-2"))
+	if string(uploaded) != "lr: 0.1\nlr: 0.1\n" || store.transfers["/configs/run.yaml"] != 1 {
+		t.Errorf("Uploaded %q after %d transfers", uploaded, store.transfers["/configs/run.yaml"])
+	}
+
+	// Hits are attached to the final JobStatus and then forgotten
+	client.recordCacheHit("job-3", "input")
+	status := &control.JobStatus{JobId: "job-3", AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED}
+	client.sendJobStatus(status)
+	if len(status.CachedInputs) != 1 || status.CachedInputs[0] != "input" || len(client.takeCacheHits("job-3")) != 0 {
+		t.Errorf("Unexpected cached_inputs: %v", status.CachedInputs)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,8 +13,10 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -41,12 +44,51 @@ type Client struct {
 	stopChan          chan struct{}
 	requestJobChan    chan struct{} // Channel to trigger immediate job request
 	httpClient        *http.Client
-	inputCacheTTL     time.Duration
+	inputCacheTTL     time.Duration // Cached inputs unused for this long are dropped
+	inputCacheSize    int64         // Disk quota of the input cache in bytes
 	inputCacheDir     string
 	inputCacheMu      sync.Mutex
-	inputCache        map[string]cachedInput
+	inputCache        map[string]*cacheEntry // cacheID -> entry; nil until loaded from inputCacheDir
+	inputCacheBytes   int64
+	cacheHitsMu       sync.Mutex
+	cacheHits         map[string][]string // job_id -> inputs served from the cache (JobStatus.cached_inputs)
+	logStreamsMu      sync.Mutex
+	logStreams        map[string]*logStreamer // job_id -> output streamed as LogChunk messages
+	progressMu        sync.Mutex
+	progressAddr      string                       // Address of the local progress callback server ("" until started)
+	progressCallbacks map[string]*progressReporter // callback token -> reporter of a running forward job
+	taskCallbacks     map[string]*forwardTask      // callback token -> task of a running async forward job
+	jobCancelsMu      sync.Mutex
+	jobCancels        map[string]context.CancelFunc // job_id -> stops the running job (CancelJob)
+	policy            *Policy                       // Templates and accepted commands (nil: any command)
+
+	// terminateGrace: a command past its timeout gets SIGTERM, then SIGKILL after this long
+	terminateGrace time.Duration
+
+	// accessRefreshAfter: presigned URLs from JobAssigned older than this are refreshed
+	// from the cloud before use (they expire after the cloud's presign TTL, default 15 minutes)
+	accessRefreshAfter time.Duration
+	pendingRefreshMu   sync.Mutex
+	pendingRefresh     map[string]chan *control.RefreshAccessAck // request_id -> waiting caller
+
+	// Output files of at least multipartThreshold bytes are uploaded in parts of multipartPartSize;
+	// the progress of each presigned multipart upload is journaled in uploadJournalDir.
+	// Failed parts and interrupted downloads are retried after transferRetryDelay (growing per attempt).
+	multipartThreshold int64
+	multipartPartSize  int64
+	uploadJournalDir   string
+	transferRetryDelay time.Duration
 }
 
+// refreshAccessTimeout bounds the wait for a RefreshAccessAck
+const refreshAccessTimeout = 10 * time.Second
+
+// defaultCommandTimeout bounds commands of assignments without timeout_sec (older clouds)
+const defaultCommandTimeout = 30 * time.Minute
+
+// reasonTimedOut is the JobStatus reason of a job that exceeded its timeout
+const reasonTimedOut = "TIMED_OUT"
+
 // New creates a new agent client
 func New(serverURL, agentID, agentToken string, maxConcurrency int) *Client {
 	hostname, _ := os.Hostname()
@@ -63,9 +105,24 @@ func New(serverURL, agentID, agentToken string, maxConcurrency int) *Client {
 		stopChan:       make(chan struct{}),
 		requestJobChan: make(chan struct{}, 1), // Buffered channel for immediate triggers
 		httpClient:     &http.Client{Timeout: 5 * time.Minute},
-		inputCacheTTL:  10 * time.Minute,
+		inputCacheTTL:  24 * time.Hour,
+		inputCacheSize: 10 << 30,
 		inputCacheDir:  filepath.Join(os.TempDir(), "xiresource-input-cache"),
-		inputCache:     make(map[string]cachedInput),
+		cacheHits:      make(map[string][]string),
+		logStreams:     make(map[string]*logStreamer),
+
+		progressCallbacks: make(map[string]*progressReporter),
+		taskCallbacks:     make(map[string]*forwardTask),
+		jobCancels:        make(map[string]context.CancelFunc),
+		terminateGrace:    10 * time.Second,
+
+		accessRefreshAfter: 5 * time.Minute,
+		pendingRefresh:     make(map[string]chan *control.RefreshAccessAck),
+
+		multipartThreshold: 64 << 20,
+		multipartPartSize:  16 << 20,
+		uploadJournalDir:   filepath.Join(os.TempDir(), "xiresource-upload-journal"),
+		transferRetryDelay: time.Second,
 	}
 }
 
@@ -116,6 +173,8 @@ func (c *Client) sendRegister() error {
 				AgentToken:     c.agentToken,
 				Hostname:       c.hostname,
 				MaxConcurrency: int32(c.maxConcurrency),
+				Templates:      c.policy.TemplateNames(),
+				ForwardTargets: c.policy.Forward(),
 			},
 		},
 	}
@@ -182,6 +241,12 @@ func (c *Client) handleMessage(envelope *control.Envelope) {
 		log.Printf("Heartbeat acknowledged")
 	case *control.Envelope_JobAssigned:
 		c.handleJobAssigned(payload.JobAssigned)
+	case *control.Envelope_RefreshAccessAck:
+		c.handleRefreshAccessAck(envelope.RequestId, payload.RefreshAccessAck)
+	case *control.Envelope_LogChunkAck:
+		c.handleLogChunkAck(payload.LogChunkAck)
+	case *control.Envelope_CancelJob:
+		c.handleCancelJob(payload.CancelJob)
 	default:
 		log.Printf("Unknown message type")
 	}
@@ -234,7 +299,13 @@ func (c *Client) SetRunningJobs(count int) {
 	c.runningJobs = count
 }
 
-// SetInputCacheTTL sets the TTL for cached input files (0 disables caching).
+// SetPolicy sets the job templates the agent runs and which other commands it accepts (nil: any command).
+// Call before Connect: the templates are advertised at Register.
+func (c *Client) SetPolicy(policy *Policy) {
+	c.policy = policy
+}
+
+// SetInputCacheTTL sets how long an unused cached input is kept (0 disables caching).
 func (c *Client) SetInputCacheTTL(ttl time.Duration) {
 	c.inputCacheMu.Lock()
 	defer c.inputCacheMu.Unlock()
@@ -411,18 +482,36 @@ func (c *Client) processJob(assigned *control.JobAssigned) {
 	jobID := assigned.JobId
 	attemptID := int(assigned.AttemptId)
 	outputKey := assigned.OutputKey
+	assignedAt := time.Now()
+
+	// The cloud may stop the job (CancelJob) while it runs
+	jobCtx, done := c.startJob(jobID)
+	defer done()
 
 	// Report RUNNING status
 	c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_RUNNING, "Processing job", "")
 
 	// Handle forward HTTP jobs
 	if assigned.JobType == control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP {
-		c.processForwardJob(assigned)
+		c.processForwardJob(jobCtx, assigned, assignedAt)
+		return
+	}
+
+	// Handle forward gRPC jobs
+	if assigned.JobType == control.JobTypeEnum_JOB_TYPE_FORWARD_GRPC {
+		c.processForwardGRPCJob(jobCtx, assigned, assignedAt)
+		return
+	}
+
+	// Resolve templates and apply the agent's command policy
+	spec, err := c.policy.commandSpec(assigned)
+	if err != nil {
+		c.reportPolicyDenied(jobID, attemptID, err)
 		return
 	}
 
 	// Check if command is provided
-	if assigned.Command == "" {
+	if spec.Command == "" && len(spec.Argv) == 0 {
 		log.Printf("JobAssigned missing command for job %s", jobID)
 		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "Command is required", "")
 		return
@@ -433,25 +522,16 @@ func (c *Client) processJob(assigned *control.JobAssigned) {
 	var inputFile string
 	inputAccess := assigned.InputDownload
 	if inputAccess != nil && assigned.InputKey != "" {
-		// Get presigned URL from OSSAccess
-		var inputURL string
-		switch auth := inputAccess.Auth.(type) {
-		case *control.OSSAccess_PresignedUrl:
-			inputURL = auth.PresignedUrl
-		case *control.OSSAccess_Sts:
-			// STS not implemented in M1
-			log.Printf("STS not supported in M1 for job %s", jobID)
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "STS not supported", "")
-			return
-		default:
-			log.Printf("Invalid input_download auth type for job %s", jobID)
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "Invalid input_download", "")
+		// Get presigned URL from OSSAccess (refreshed if the assignment is old)
+		inputURL, err := c.currentAccessURL(assigned, assignedAt, false)
+		if err != nil {
+			log.Printf("Invalid input_download for job %s: %v", jobID, err)
+			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
 			return
 		}
 
-		// Download input to temporary file (preserve extension from input_key)
-		var err error
-		inputFile, err = c.downloadInputToFile(inputURL, jobID, assigned.InputKey)
+		// Download input to temporary file (preserve extension from input_key), or copy it from the cache
+		inputFile, err = c.downloadInputToFile(namedInput{Bucket: assigned.InputBucket, Key: assigned.InputKey, URL: inputURL, SHA256: assigned.InputSha256}, jobID)
 		if err != nil {
 			log.Printf("Failed to download input for job %s: %v", jobID, err)
 			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Download failed: %v", err), "")
@@ -470,24 +550,90 @@ func (c *Client) processJob(assigned *control.JobAssigned) {
 		inputFile = ""
 	}
 
-	// Create output file path
-	outputFile := filepath.Join(os.TempDir(), fmt.Sprintf("job_%s_output", jobID))
+	// Each job gets its own work directory: named inputs are downloaded to inputs/ and everything in
+	// output/ ({output_dir}) is uploaded under output_prefix. {output} is the primary output file in
+	// that directory (named like output_key).
+	workDir, err := os.MkdirTemp("", fmt.Sprintf("job_%s_", jobID))
+	if err != nil {
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+			fmt.Sprintf("Failed to create work directory: %v", err), "")
+		return
+	}
 	defer func() {
-		if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
-			log.Printf("Warning: Failed to cleanup output file %s: %v", outputFile, err)
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("Warning: Failed to cleanup work directory %s: %v", workDir, err)
 		}
 	}()
+	outputDir := filepath.Join(workDir, "output")
+	if err := os.Mkdir(outputDir, 0o755); err != nil {
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+			fmt.Sprintf("Failed to create output directory: %v", err), "")
+		return
+	}
 
-	log.Printf("Executing command for job %s: %s", jobID, assigned.Command)
-
-	// Execute command
-	cmdResult, err := c.executeCommand(assigned.Command, inputFile, outputFile)
+	// Named inputs ({input:name})
+	var inputFiles map[string]string
+	if len(assigned.Inputs) > 0 {
+		inputs, err := c.currentInputURLs(assigned, assignedAt)
+		if err != nil {
+			log.Printf("Invalid inputs for job %s: %v", jobID, err)
+			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
+			return
+		}
+		inputFiles, err = c.downloadNamedInputs(jobID, inputs, filepath.Join(workDir, "inputs"))
+		if err != nil {
+			log.Printf("Failed to download inputs for job %s: %v", jobID, err)
+			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Download failed: %v", err), "")
+			return
+		}
+		log.Printf("Downloaded %d named input(s) for job %s", len(inputFiles), jobID)
+	}
+	outputName := "output.bin"
+	if outputKey != "" {
+		outputName = path.Base(outputKey)
+	}
+	outputFile := filepath.Join(outputDir, outputName)
+
+	log.Printf("Executing command for job %s: %s", jobID, spec)
+
+	// Execute command, streaming its output and progress to the cloud while it runs
+	logs := c.startLogStream(jobID, attemptID)
+	progress := c.startProgress(jobID, attemptID)
+	progressFile := filepath.Join(workDir, progressFileName)
+	if spec.uses("{progress_file}") {
+		progress.watchFile(progressFile)
+	}
+	timeout := jobTimeout(assigned)
+	cmdCtx, cancelCmd := context.WithTimeout(jobCtx, timeout)
+	cmdResult, err := c.executeCommand(cmdCtx, spec, workDir, inputFile, inputFiles, outputFile, outputDir, progressFile, logs, progress)
+	cancelCmd()
+	logs.close()
+	progress.close()
+	if jobCtx.Err() != nil {
+		// Ended by the cloud, which ignores any further status for this attempt
+		log.Printf("Job %s (attempt %d) was canceled by the cloud", jobID, attemptID)
+		return
+	}
+	if cmdResult != nil && cmdResult.TimedOut {
+		log.Printf("Command for job %s timed out after %v", jobID, timeout)
+		c.sendJobStatus(&control.JobStatus{
+			JobId:     jobID,
+			AttemptId: int32(attemptID),
+			Status:    control.JobStatusEnum_JOB_STATUS_FAILED,
+			Message:   fmt.Sprintf("Command timed out after %v", timeout),
+			Reason:    reasonTimedOut,
+			Stdout:    sanitizeUTF8(cmdResult.Stdout),
+			Stderr:    sanitizeUTF8(cmdResult.Stderr),
+			Usage:     cmdResult.Usage,
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to execute command for job %s: %v", jobID, err)
 		// Report FAILED with stderr (cmdResult may still contain stdout/stderr even on error)
 		if cmdResult != nil {
-			c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
-				fmt.Sprintf("Command execution failed: %v", err), "", cmdResult.Stdout, cmdResult.Stderr)
+			c.reportCommandStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+				fmt.Sprintf("Command execution failed: %v", err), cmdResult)
 		} else {
 			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
 				fmt.Sprintf("Command execution failed: %v", err), "")
@@ -495,52 +641,68 @@ func (c *Client) processJob(assigned *control.JobAssigned) {
 		return
 	}
 
-	// Upload output if output file exists and has data
-	outputKeyToReport := ""
-	if cmdResult.HasOutputFile && len(cmdResult.OutputData) > 0 {
-		outputAccess := assigned.OutputUpload
-		if outputAccess == nil {
-			log.Printf("JobAssigned missing output_upload for job %s", jobID)
-			c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
-				"Missing output_upload", "", cmdResult.Stdout, cmdResult.Stderr)
-			return
-		}
+	// The gateway always sends output_prefix; older assignments only carry output_key
+	outputPrefix := assigned.OutputPrefix
+	if outputPrefix == "" {
+		outputPrefix = outputKey[:strings.LastIndex(outputKey, "/")+1]
+	}
+	files, err := collectOutputFiles(outputDir, outputPrefix)
+	if err != nil {
+		log.Printf("Failed to collect output files for job %s: %v", jobID, err)
+		c.reportCommandStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+			fmt.Sprintf("Invalid output directory: %v", err), cmdResult)
+		return
+	}
+	if len(files) == 0 {
+		log.Printf("Job %s completed without output files (stdout only or no output)", jobID)
+		c.reportCommandStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_SUCCEEDED, "", cmdResult)
+		return
+	}
+	if assigned.OutputUpload == nil || outputPrefix == "" {
+		log.Printf("JobAssigned missing output_upload or output_prefix for job %s", jobID)
+		c.reportCommandStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+			"Missing output_upload", cmdResult)
+		return
+	}
 
-		// Get presigned URL from OSSAccess
-		var outputURL string
-		switch auth := outputAccess.Auth.(type) {
-		case *control.OSSAccess_PresignedUrl:
-			outputURL = auth.PresignedUrl
-		case *control.OSSAccess_Sts:
-			// STS not implemented in M1
-			log.Printf("STS not supported in M1 for job %s", jobID)
-			c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
-				"STS not supported", "", cmdResult.Stdout, cmdResult.Stderr)
-			return
-		default:
-			log.Printf("Invalid output_upload auth type for job %s", jobID)
-			c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
-				"Invalid output_upload", "", cmdResult.Stdout, cmdResult.Stderr)
-			return
-		}
+	// Upload the output directory and its manifest (access is refreshed if the command outlived it)
+	manifestKey, err := c.uploadOutputFiles(assigned, assignedAt, outputPrefix, files)
+	if err != nil {
+		log.Printf("Failed to upload output for job %s: %v", jobID, err)
+		c.reportCommandStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
+			fmt.Sprintf("Upload failed: %v", err), cmdResult)
+		return
+	}
+	log.Printf("Uploaded %d output file(s) for job %s under %s", len(files), jobID, outputPrefix)
 
-		// Upload output
-		if err := c.uploadOutput(outputURL, cmdResult.OutputData); err != nil {
-			log.Printf("Failed to upload output for job %s: %v", jobID, err)
-			c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED,
-				fmt.Sprintf("Upload failed: %v", err), "", cmdResult.Stdout, cmdResult.Stderr)
-			return
+	// output_key is reported with its size and SHA-256 if the primary output file was among the uploads
+	var primary *control.OutputFile
+	for _, file := range files {
+		if file.Key == outputKey {
+			primary = outputFileToProto(file)
 		}
-
-		log.Printf("Uploaded output for job %s to %s", jobID, outputKey)
+	}
+	outputKeyToReport := ""
+	if primary != nil {
 		outputKeyToReport = outputKey
-	} else {
-		log.Printf("Job %s completed without output file (stdout only or no output)", jobID)
 	}
 
-	// Report SUCCEEDED with output_key (may be empty if no output file) and stdout/stderr
-	c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_SUCCEEDED, "",
-		outputKeyToReport, cmdResult.Stdout, cmdResult.Stderr)
+	// Report SUCCEEDED with the output manifest (if uploaded) and stdout/stderr
+	jobStatus := &control.JobStatus{
+		JobId:     jobID,
+		AttemptId: int32(attemptID),
+		Status:    control.JobStatusEnum_JOB_STATUS_SUCCEEDED,
+		OutputKey: outputKeyToReport,
+		Stdout:    sanitizeUTF8(cmdResult.Stdout),
+		Stderr:    sanitizeUTF8(cmdResult.Stderr),
+		Output:    primary,
+		Usage:     cmdResult.Usage,
+	}
+	if manifestKey != "" {
+		jobStatus.OutputFiles = outputFilesToProto(files)
+		jobStatus.ManifestKey = manifestKey
+	}
+	c.sendJobStatus(jobStatus)
 }
 
 // downloadInput downloads input from presigned URL
@@ -596,176 +758,330 @@ func (c *Client) stubCompute(jobID string, attemptID int, inputSize int64, input
 	return data, nil
 }
 
-// downloadInputToFile downloads input from presigned URL to a temporary file
+// downloadInputToFile makes the input available as a temporary file
 // It preserves the file extension from input_key if available
-func (c *Client) downloadInputToFile(url, jobID, inputKey string) (string, error) {
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("HTTP GET failed: %w", err)
+func (c *Client) downloadInputToFile(in namedInput, jobID string) (string, error) {
+	// Create temporary file with extension preserved
+	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("job_%s_input%s", jobID, filepath.Ext(in.Key)))
+	if err := c.fetchInput(jobID, in, tmpFile); err != nil {
+		return "", err
 	}
-	defer resp.Body.Close()
+	return tmpFile, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP GET returned status %d", resp.StatusCode)
+// downloadToFile downloads a presigned URL to dest. The body is written to dest+".part" and renamed
+// to dest when complete; nothing is left behind on failure.
+func (c *Client) downloadToFile(url, dest string) error {
+	partial := dest + ".part"
+	f, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
 	}
+	if _, err := c.download(url, f, ""); err != nil {
+		f.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to move downloaded file: %w", err)
+	}
+	return nil
+}
 
-	// Extract extension from input_key if available
-	extension := ""
-	if inputKey != "" {
-		ext := filepath.Ext(inputKey)
-		if ext != "" {
-			extension = ext
+// errNotModified: a conditional download found the object unchanged (304)
+var errNotModified = errors.New("not modified")
+
+// download writes the object at url into the empty file f and returns its ETag. An interrupted
+// transfer resumes where it stopped with a Range request (If-Range the ETag), up to maxTransferAttempts.
+// With ifNoneMatch set, an unchanged object is not transferred and errNotModified is returned.
+func (c *Client) download(url string, f *os.File, ifNoneMatch string) (string, error) {
+	var etag string
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		var err error
+		etag, retry, err = c.resumeDownload(url, f, etag, ifNoneMatch)
+		if err == nil {
+			return etag, nil
+		}
+		if !retry || attempt == maxTransferAttempts {
+			return "", err
 		}
+		log.Printf("Download interrupted (attempt %d/%d), resuming: %v", attempt, maxTransferAttempts, err)
+		time.Sleep(time.Duration(attempt) * c.transferRetryDelay)
 	}
+}
 
-	// Create temporary file with extension preserved
-	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("job_%s_input%s", jobID, extension))
-	f, err := os.Create(tmpFile)
+// resumeDownload continues a download into f from its current size. It returns the object's ETag
+// (the If-Range validator of the next attempt) and whether a failure is worth retrying.
+// Without a strong ETag, or if the server ignores the range, the download starts over.
+func (c *Client) resumeDownload(url string, f *os.File, etag, ifNoneMatch string) (string, bool, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return etag, false, fmt.Errorf("failed to seek temp file: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return etag, false, fmt.Errorf("failed to create GET request: %w", err)
+	}
+	ranged := offset > 0 && etag != "" && !strings.HasPrefix(etag, "W/")
+	if ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+	} else if offset == 0 && ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
 	}
-	defer f.Close()
 
-	// Write to file
-	_, err = io.Copy(f, resp.Body)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		os.Remove(tmpFile)
-		return "", fmt.Errorf("failed to write to file: %w", err)
+		return etag, true, fmt.Errorf("HTTP GET failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return tmpFile, nil
-}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "":
+		return etag, false, errNotModified
+	case resp.StatusCode == http.StatusPartialContent && ranged:
+		if contentRange := resp.Header.Get("Content-Range"); !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+			return etag, false, fmt.Errorf("unexpected Content-Range %q", contentRange)
+		}
+	case resp.StatusCode == http.StatusOK:
+		// Full body: first attempt, or the object changed since the last one
+		if err := f.Truncate(0); err != nil {
+			return etag, false, fmt.Errorf("failed to truncate temp file: %w", err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return etag, false, fmt.Errorf("failed to seek temp file: %w", err)
+		}
+		etag = resp.Header.Get("ETag")
+	default:
+		return etag, resp.StatusCode >= 500, fmt.Errorf("HTTP GET returned status %d", resp.StatusCode)
+	}
 
-type cachedInput struct {
-	path      string
-	expiresAt time.Time
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return etag, true, fmt.Errorf("failed to write to file: %w", err)
+	}
+	return etag, false, nil
 }
 
-func (c *Client) getCachedInputFile(url, inputKey string) (string, func(), error) {
-	c.inputCacheMu.Lock()
-	ttl := c.inputCacheTTL
-	c.inputCacheMu.Unlock()
+// CommandResult contains the result of command execution
+type CommandResult struct {
+	Stdout        string // Command stdout (its last commandOutputTail bytes)
+	Stderr        string // Command stderr (its last commandOutputTail bytes)
+	HasOutputFile bool   // Whether output file exists
+	TimedOut      bool   // Whether the command was stopped because ctx reached its deadline
+	// Usage is how the process ended and what it used (nil if it did not start)
+	Usage *control.ProcessUsage
+}
 
-	if ttl <= 0 {
-		// Caching disabled: download to a temp file and clean up after use
-		tmpFile, err := c.downloadInputToFile(url, "forward", inputKey)
-		if err != nil {
-			return "", func() {}, err
-		}
-		return tmpFile, func() { _ = os.Remove(tmpFile) }, nil
+// jobTimeout returns how long the command of an assignment may run
+func jobTimeout(assigned *control.JobAssigned) time.Duration {
+	if assigned.TimeoutSec <= 0 {
+		return defaultCommandTimeout
 	}
+	return time.Duration(assigned.TimeoutSec) * time.Second
+}
 
-	now := time.Now()
-	c.inputCacheMu.Lock()
-	entry, ok := c.inputCache[url]
-	if ok && now.Before(entry.expiresAt) {
-		path := entry.path
-		c.inputCacheMu.Unlock()
-		return path, func() {}, nil
+// startJob registers a running job so that a CancelJob from the cloud can stop it.
+// done must be called when the job ends.
+func (c *Client) startJob(jobID string) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.jobCancelsMu.Lock()
+	c.jobCancels[jobID] = cancel
+	c.jobCancelsMu.Unlock()
+	return ctx, func() {
+		c.jobCancelsMu.Lock()
+		delete(c.jobCancels, jobID)
+		c.jobCancelsMu.Unlock()
+		cancel()
 	}
-	if ok {
-		delete(c.inputCache, url)
-		_ = os.Remove(entry.path)
-	}
-	c.inputCacheMu.Unlock()
+}
 
-	cachePath, err := c.downloadInputToCacheFile(url, inputKey)
-	if err != nil {
-		return "", func() {}, err
+// handleCancelJob stops a running job the cloud ended on its own (e.g. it overran its timeout)
+func (c *Client) handleCancelJob(cancelJob *control.CancelJob) {
+	c.jobCancelsMu.Lock()
+	cancel, ok := c.jobCancels[cancelJob.JobId]
+	c.jobCancelsMu.Unlock()
+	if !ok {
+		log.Printf("CancelJob for job %s: not running on this agent", cancelJob.JobId)
+		return
 	}
+	log.Printf("Canceling job %s (attempt %d): %s %s", cancelJob.JobId, cancelJob.AttemptId, cancelJob.Reason, cancelJob.Message)
+	cancel()
+}
 
-	c.inputCacheMu.Lock()
-	c.inputCache[url] = cachedInput{
-		path:      cachePath,
-		expiresAt: now.Add(ttl),
-	}
-	c.inputCacheMu.Unlock()
+// commandSpec is what a command job runs
+type commandSpec struct {
+	// Command is run through the shell (sh -c, or cmd.exe /C on Windows)
+	Command string
 
-	return cachePath, func() {}, nil
-}
+	// Argv is run directly, without a shell; placeholders are expanded per argument.
+	// When set, Command is ignored.
+	Argv []string
 
-func (c *Client) downloadInputToCacheFile(url, inputKey string) (string, error) {
-	if err := os.MkdirAll(c.inputCacheDir, 0o755); err != nil {
-		return "", fmt.Errorf("failed to create cache dir: %w", err)
-	}
+	// Env is added to the agent's environment
+	Env map[string]string
 
-	extension := ""
-	if inputKey != "" {
-		if ext := filepath.Ext(inputKey); ext != "" {
-			extension = ext
-		}
-	}
+	// WorkingDir is the command's working directory; a relative path is created under the job's work directory
+	WorkingDir string
 
-	hash := sha256.Sum256([]byte(url))
-	cacheFile := filepath.Join(c.inputCacheDir, fmt.Sprintf("input_%x%s", hash, extension))
+	// AnyWorkingDir lets WorkingDir lead out of the job's work directory (templates, or allowed by the policy)
+	AnyWorkingDir bool
 
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("HTTP GET failed: %w", err)
-	}
-	defer resp.Body.Close()
+	// Params are the checked parameters of a template ({param:name})
+	Params map[string]string
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP GET returned status %d", resp.StatusCode)
+// jobCommandSpec returns the command a job runs
+func jobCommandSpec(assigned *control.JobAssigned) commandSpec {
+	return commandSpec{
+		Command:    assigned.Command,
+		Argv:       assigned.Argv,
+		Env:        assigned.Env,
+		WorkingDir: assigned.WorkingDir,
 	}
+}
 
-	f, err := os.Create(cacheFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cache file: %w", err)
+// String describes the command for logs
+func (s commandSpec) String() string {
+	if len(s.Argv) > 0 {
+		return fmt.Sprintf("%q", s.Argv)
 	}
-	defer f.Close()
+	return s.Command
+}
 
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		_ = os.Remove(cacheFile)
-		return "", fmt.Errorf("failed to write cache file: %w", err)
+// uses reports whether a placeholder appears anywhere in the command
+func (s commandSpec) uses(placeholder string) bool {
+	if strings.Contains(s.Command, placeholder) || strings.Contains(s.WorkingDir, placeholder) {
+		return true
 	}
-
-	return cacheFile, nil
+	for _, arg := range s.Argv {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	for _, value := range s.Env {
+		if strings.Contains(value, placeholder) {
+			return true
+		}
+	}
+	return false
 }
 
-// CommandResult contains the result of command execution
-type CommandResult struct {
-	OutputData    []byte // Output file content (if exists)
-	Stdout        string // Command stdout
-	Stderr        string // Command stderr
-	HasOutputFile bool   // Whether output file exists
+// commandPlaceholders returns the replacer for {input}, {input:name}, {output_dir}, {output}, {progress_file} and {param:name}.
+// All placeholders are replaced in a single pass, so text inside a substituted path or parameter is never expanded again.
+func commandPlaceholders(inputFile string, inputFiles map[string]string, outputFile, outputDir, progressFile string, params map[string]string) *strings.Replacer {
+	pairs := []string{
+		"{input}", inputFile,
+		"{output_dir}", outputDir,
+		"{output}", outputFile,
+		"{progress_file}", progressFile,
+	}
+	for name, path := range inputFiles {
+		pairs = append(pairs, "{input:"+name+"}", path)
+	}
+	for name, value := range params {
+		pairs = append(pairs, "{param:"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...)
 }
 
-// executeCommand executes the given command with input/output file placeholders
-func (c *Client) executeCommand(command string, inputFile, outputFile string) (*CommandResult, error) {
-	if command == "" {
+// executeCommand executes the given command with input/output file placeholders.
+// inputFiles maps named inputs to their local paths ({input:name}); a relative working directory is created under workDir.
+// stdout and stderr are also written to logs (nil: not streamed); "##progress" lines of stdout are reported to progress.
+// When ctx is done the command is terminated gracefully (see terminateGracefully).
+func (c *Client) executeCommand(ctx context.Context, spec commandSpec, workDir, inputFile string, inputFiles map[string]string, outputFile, outputDir, progressFile string, logs *logStreamer, progress *progressReporter) (*CommandResult, error) {
+	if spec.Command == "" && len(spec.Argv) == 0 {
 		return nil, fmt.Errorf("command is required")
 	}
+	placeholders := commandPlaceholders(inputFile, inputFiles, outputFile, outputDir, progressFile, spec.Params)
 
-	// Replace placeholders
-	cmdStr := strings.ReplaceAll(command, "{input}", inputFile)
-	cmdStr = strings.ReplaceAll(cmdStr, "{output}", outputFile)
-
-	log.Printf("Executing command: %s", cmdStr)
-
-	// Parse command (Windows: use cmd.exe /C, Linux: use sh -c)
 	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd.exe", "/C", cmdStr)
+	if len(spec.Argv) > 0 {
+		// No shell: each argument reaches the program exactly as expanded
+		argv := make([]string, len(spec.Argv))
+		for i, arg := range spec.Argv {
+			argv[i] = placeholders.Replace(arg)
+		}
+		if argv[0] == "" {
+			return nil, fmt.Errorf("argv[0] is required")
+		}
+		log.Printf("Executing argv: %q", argv)
+		cmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
 	} else {
-		cmd = exec.Command("sh", "-c", cmdStr)
+		cmdStr := placeholders.Replace(spec.Command)
+		log.Printf("Executing command: %s", cmdStr)
+
+		// Parse command (Windows: use cmd.exe /C, Linux: use sh -c)
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd.exe", "/C", cmdStr)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", cmdStr)
+		}
 	}
+	terminateGracefully(cmd, c.terminateGrace)
 
-	// Set timeout (30 minutes)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, cmd.Args[0], cmd.Args[1:]...)
+	if len(spec.Env) > 0 {
+		// Later entries win, so job variables override the agent's
+		names := make([]string, 0, len(spec.Env))
+		for name := range spec.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cmd.Env = os.Environ()
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, name+"="+placeholders.Replace(spec.Env[name]))
+		}
+	}
 
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if spec.WorkingDir != "" {
+		dir := placeholders.Replace(spec.WorkingDir)
+		relative := !filepath.IsAbs(dir)
+		if relative {
+			dir = filepath.Join(workDir, dir)
+		}
+		// Checked after expansion, as placeholders are absolute paths
+		if !spec.AnyWorkingDir && !withinDir(workDir, dir) {
+			return nil, fmt.Errorf("working directory %s is outside the job's work directory", dir)
+		}
+		if relative {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create working directory: %w", err)
+			}
+		} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("working directory %s does not exist", dir)
+		}
+		cmd.Dir = dir
+	}
+
+	// Capture output: only the tail of each stream is kept for the final status;
+	// stdout is spooled to disk as well, as it becomes the output if there is no output file
+	spool, err := os.CreateTemp(workDir, "stdout_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	stdout, stderr := newTailBuffer(commandOutputTail), newTailBuffer(commandOutputTail)
+	cmd.Stdout = io.MultiWriter(stdout, spool, logs.writer(logStdout), progress.writer())
+	cmd.Stderr = io.MultiWriter(stderr, logs.writer(logStderr))
 
 	// Execute
 	startTime := time.Now()
-	err := cmd.Run()
+	err = cmd.Run()
 	executionTime := time.Since(startTime)
+	spool.Close()
+	if errors.Is(err, exec.ErrWaitDelay) && cmd.ProcessState.Success() {
+		// The command succeeded; a background process it started kept stdout/stderr open
+		log.Printf("Command exited but its output was still open after %v, ignoring the rest", c.terminateGrace)
+		err = nil
+	}
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
 
+	usage := processUsage(cmd.ProcessState, executionTime)
 	stdoutStr := stdout.String()
 	stderrStr := stderr.String()
 
@@ -776,43 +1092,51 @@ func (c *Client) executeCommand(command string, inputFile, outputFile string) (*
 	if err != nil {
 		log.Printf("Command execution failed after %v: %v, stderr: %s", executionTime, err, stderrStr)
 		return &CommandResult{
-			OutputData:    nil,
-			Stdout:        truncateString(stdoutStr, 10000), // Limit to 10KB
-			Stderr:        truncateString(stderrStr, 10000), // Limit to 10KB
+			Stdout:        stdoutStr,
+			Stderr:        stderrStr,
 			HasOutputFile: false,
+			TimedOut:      timedOut,
+			Usage:         usage,
 		}, fmt.Errorf("command execution failed: %v", err)
 	}
 
 	log.Printf("Command executed successfully in %v, stdout: %s", executionTime, stdoutStr)
 
-	// Try to read output file
-	outputData, err := os.ReadFile(outputFile)
+	// The output file is uploaded from disk later; only check that it exists
+	_, err = os.Stat(outputFile)
 	hasOutputFile := err == nil
 
 	result := &CommandResult{
-		OutputData:    outputData,
-		Stdout:        truncateString(stdoutStr, 10000), // Limit to 10KB
-		Stderr:        truncateString(stderrStr, 10000), // Limit to 10KB
+		Stdout:        stdoutStr,
+		Stderr:        stderrStr,
 		HasOutputFile: hasOutputFile,
+		Usage:         usage,
 	}
 
-	// If output file doesn't exist, use stdout as output data
-	if !hasOutputFile {
-		if stdout.Len() > 0 {
-			log.Printf("Output file not found, using stdout as output")
-			result.OutputData = stdout.Bytes()
-		} else {
-			// No output file and no stdout - this is OK for commands that don't produce output
-			result.OutputData = nil
+	// If output file doesn't exist, use stdout as output (as before output directories)
+	if !hasOutputFile && stdout.Written() > 0 {
+		log.Printf("Output file not found, using stdout as output")
+		if err := os.Rename(spool.Name(), outputFile); err != nil {
+			if err := copyFile(spool.Name(), outputFile); err != nil {
+				log.Printf("Failed to write stdout as output: %v", err)
+			}
 		}
 	}
 
 	return result, nil
 }
 
-const maxForwardResponseSize = 10 * 1024 * 1024 // 10MB
+// withinDir reports whether path is dir or inside it (compared lexically)
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-func (c *Client) processForwardJob(assigned *control.JobAssigned) {
+// processForwardJob sends a forward job's request to the local service and uploads the response.
+// The request is bounded by forward_http.timeout_sec, or else the job's timeout_sec, and stops when ctx is done.
+// In async mode (forward_http.async) the request submits a task that is followed until it ends and its
+// result is uploaded; timeout_sec bounds the whole task and forward_http.timeout_sec each request.
+func (c *Client) processForwardJob(ctx context.Context, assigned *control.JobAssigned, assignedAt time.Time) {
 	jobID := assigned.JobId
 	attemptID := int(assigned.AttemptId)
 
@@ -822,13 +1146,17 @@ func (c *Client) processForwardJob(assigned *control.JobAssigned) {
 		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "forward_http.url is required", "")
 		return
 	}
+	if err := c.policy.checkForward(forward.Url); err != nil {
+		c.reportPolicyDenied(jobID, attemptID, err)
+		return
+	}
 
 	method := strings.ToUpper(strings.TrimSpace(forward.Method))
 	if method == "" {
 		method = http.MethodPost
 	}
 
-	inputURL, err := c.getPresignedURL(assigned.InputDownload, "input_download")
+	inputURL, err := c.currentAccessURL(assigned, assignedAt, false)
 	if err != nil {
 		log.Printf("Failed to resolve input URL for job %s: %v", jobID, err)
 		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
@@ -837,6 +1165,12 @@ func (c *Client) processForwardJob(assigned *control.JobAssigned) {
 	if assigned.InputKey == "" {
 		inputURL = ""
 	}
+	namedInputs, err := c.currentInputURLs(assigned, assignedAt)
+	if err != nil {
+		log.Printf("Failed to resolve input URLs for job %s: %v", jobID, err)
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
+		return
+	}
 
 	inputMode := assigned.InputForwardMode
 	if inputMode == control.InputForwardMode_INPUT_FORWARD_MODE_UNSPECIFIED {
@@ -853,61 +1187,83 @@ func (c *Client) processForwardJob(assigned *control.JobAssigned) {
 	headers.Set("X-Job-Id", jobID)
 	headers.Set("X-Attempt-Id", strconv.Itoa(attemptID))
 
-	var body io.Reader
-	if inputMode == control.InputForwardMode_INPUT_FORWARD_MODE_LOCAL_FILE && inputURL != "" {
-		filePath, cleanup, err := c.getCachedInputFile(inputURL, assigned.InputKey)
-		if err != nil {
-			log.Printf("Failed to get cached input for job %s: %v", jobID, err)
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Download failed: %v", err), "")
-			return
-		}
-		defer cleanup()
-
-		var buffer bytes.Buffer
-		writer := multipart.NewWriter(&buffer)
+	// The service may POST progress reports to X-Progress-URL while it handles the request
+	progress := c.startProgress(jobID, attemptID)
+	defer progress.close()
+	if callbackURL := progress.callbackURL(); callbackURL != "" {
+		headers.Set("X-Progress-URL", callbackURL)
+	}
 
-		file, err := os.Open(filePath)
-		if err != nil {
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Open input failed: %v", err), "")
-			return
+	// An async service may POST task statuses to X-Callback-URL instead of being polled
+	var task *forwardTask
+	if forward.Async != nil {
+		task = c.startForwardTask(jobID, forward)
+		defer task.close()
+		if callbackURL := task.callbackURL(); callbackURL != "" {
+			headers.Set("X-Callback-URL", callbackURL)
 		}
-		defer file.Close()
+	}
 
-		fileName := filepath.Base(filePath)
-		if assigned.InputKey != "" {
-			fileName = filepath.Base(assigned.InputKey)
-		}
-		part, err := writer.CreateFormFile("file", fileName)
-		if err != nil {
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Create form file failed: %v", err), "")
-			return
+	var body io.Reader
+	var contentLength int64 // known length of a streamed body
+	if inputMode == control.InputForwardMode_INPUT_FORWARD_MODE_LOCAL_FILE && (inputURL != "" || len(namedInputs) > 0) {
+		// Inputs are downloaded (or taken from the cache) up front, then streamed from disk as the body
+		form := &forwardForm{boundary: multipart.NewWriter(io.Discard).Boundary()}
+		defer form.release()
+
+		// The input is sent as "file", named inputs as "input:<name>"
+		if inputURL != "" {
+			in := namedInput{Bucket: assigned.InputBucket, Key: assigned.InputKey, URL: inputURL, SHA256: assigned.InputSha256}
+			if err := c.addFormInput(form, jobID, "file", in); err != nil {
+				log.Printf("Failed to attach input for job %s: %v", jobID, err)
+				c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
+				return
+			}
 		}
-		if _, err := io.Copy(part, file); err != nil {
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Write form file failed: %v", err), "")
-			return
+		for _, in := range namedInputs {
+			if err := c.addFormInput(form, jobID, "input:"+in.Name, in); err != nil {
+				log.Printf("Failed to attach input %s for job %s: %v", in.Name, jobID, err)
+				c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("input %s: %v", in.Name, err), "")
+				return
+			}
 		}
 		if len(forward.Body) > 0 {
-			_ = writer.WriteField("payload", string(forward.Body))
+			form.fields = append(form.fields, [2]string{"payload", string(forward.Body)})
 		}
 		if assigned.InputKey != "" {
-			_ = writer.WriteField("input_key", assigned.InputKey)
+			form.fields = append(form.fields, [2]string{"input_key", assigned.InputKey})
 		}
 		if inputURL != "" {
-			_ = writer.WriteField("input_url", inputURL)
+			form.fields = append(form.fields, [2]string{"input_url", inputURL})
 		}
-		if err := writer.Close(); err != nil {
+		length, err := form.size()
+		if err != nil {
 			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Finalize multipart failed: %v", err), "")
 			return
 		}
 
-		headers.Set("Content-Type", writer.FormDataContentType())
-		body = &buffer
+		reader, writer := io.Pipe()
+		defer reader.Close() // unblocks the writer if the request ends before reading the whole body
+		go func() {
+			writer.CloseWithError(form.writeTo(writer, true))
+		}()
+		headers.Set("Content-Type", "multipart/form-data; boundary="+form.boundary)
+		body = reader
+		contentLength = length
 	} else {
 		bodyBytes := forward.Body
-		if len(bodyBytes) == 0 && inputURL != "" {
-			payload := map[string]string{
-				"input_url": inputURL,
-				"input_key": assigned.InputKey,
+		if len(bodyBytes) == 0 && (inputURL != "" || len(namedInputs) > 0) {
+			payload := map[string]interface{}{}
+			if inputURL != "" {
+				payload["input_url"] = inputURL
+				payload["input_key"] = assigned.InputKey
+			}
+			if len(namedInputs) > 0 {
+				inputs := make(map[string]map[string]string, len(namedInputs))
+				for _, in := range namedInputs {
+					inputs[in.Name] = map[string]string{"url": in.URL, "key": in.Key}
+				}
+				payload["inputs"] = inputs
 			}
 			data, err := json.Marshal(payload)
 			if err != nil {
@@ -925,13 +1281,25 @@ func (c *Client) processForwardJob(assigned *control.JobAssigned) {
 				headers.Set("X-Input-Key", assigned.InputKey)
 			}
 		}
+		for _, in := range namedInputs {
+			headers.Set("X-Input-"+in.Name+"-URL", in.URL)
+			headers.Set("X-Input-"+in.Name+"-Key", in.Key)
+		}
 		body = bytes.NewReader(bodyBytes)
 	}
 
-	ctx := context.Background()
-	if forward.TimeoutSec > 0 {
+	timeout := time.Duration(forward.TimeoutSec) * time.Second
+	var requestTimeout time.Duration
+	if task != nil {
+		requestTimeout, timeout = timeout, 0
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(assigned.TimeoutSec) * time.Second
+	}
+	jobCtx := ctx
+	if timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(forward.TimeoutSec)*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
@@ -940,58 +1308,281 @@ func (c *Client) processForwardJob(assigned *control.JobAssigned) {
 		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Create request failed: %v", err), "")
 		return
 	}
+	if contentLength > 0 {
+		req.ContentLength = contentLength
+	}
 	for key, values := range headers {
 		for _, value := range values {
 			req.Header.Add(key, value)
 		}
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Forward request failed: %v", err), "")
+	// Redirects must stay within the permitted targets too
+	forwardClient := *c.httpClient
+	if requestTimeout > 0 {
+		forwardClient.Timeout = requestTimeout
+	} else if timeout > 0 {
+		// ctx bounds the request; a large response may take longer than the client's default timeout to stream
+		forwardClient.Timeout = 0
+	}
+	forwardClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if err := c.policy.checkForward(req.URL.String()); err != nil {
+			return &policyError{err}
+		}
+		return nil
+	}
+	resp, err := forwardClient.Do(req)
+	var denied *policyError
+	if errors.As(err, &denied) {
+		c.reportPolicyDenied(jobID, attemptID, denied.err)
 		return
 	}
-	defer resp.Body.Close()
-
-	respData, err := io.ReadAll(io.LimitReader(resp.Body, maxForwardResponseSize+1))
 	if err != nil {
-		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Read response failed: %v", err), "")
+		c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, fmt.Sprintf("Forward request failed: %v", err))
 		return
 	}
-	if len(respData) > maxForwardResponseSize {
-		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "Response body too large", "")
-		return
+	if task != nil {
+		result, err := task.await(ctx, &forwardClient, resp)
+		if errors.As(err, &denied) {
+			c.reportPolicyDenied(jobID, attemptID, denied.err)
+			return
+		}
+		if err != nil {
+			log.Printf("Async forward job %s failed: %v", jobID, err)
+			c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, err.Error())
+			return
+		}
+		resp = result
 	}
+	defer resp.Body.Close()
+	c.completeForwardJob(jobCtx, ctx, assigned, assignedAt, resp, timeout, progress)
+}
+
+// completeForwardJob uploads the local service's response to a forward job (or the result of its task)
+// as it is read, and reports the job's final status with the response's status code and headers
+func (c *Client) completeForwardJob(jobCtx, ctx context.Context, assigned *control.JobAssigned, assignedAt time.Time, resp *http.Response, timeout time.Duration, progress *progressReporter) {
+	jobID := assigned.JobId
+	attemptID := int(assigned.AttemptId)
+	response := forwardResponseToProto(resp)
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respData, _ := io.ReadAll(io.LimitReader(resp.Body, forwardErrorBodySize))
+		progress.close()
 		message := fmt.Sprintf("Forward HTTP returned status %d", resp.StatusCode)
 		if len(respData) > 0 {
-			message = fmt.Sprintf("%s: %s", message, truncateString(sanitizeUTF8(string(respData)), 2000))
+			message = fmt.Sprintf("%s: %s", message, sanitizeUTF8(string(respData)))
 		}
 		log.Printf("Forward HTTP failed for job %s: %s", jobID, message)
-		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, message, "")
+		c.sendJobStatus(&control.JobStatus{
+			JobId:           jobID,
+			AttemptId:       int32(attemptID),
+			Status:          control.JobStatusEnum_JOB_STATUS_FAILED,
+			Message:         message,
+			ForwardResponse: response,
+		})
 		return
 	}
 
-	outputKeyToReport := ""
-	if len(respData) > 0 && assigned.OutputUpload != nil {
-		outputURL, err := c.getPresignedURL(assigned.OutputUpload, "output_upload")
+	// The response is stored with its own content type
+	contentType := resp.Header.Get("Content-Type")
+	var output *control.OutputFile
+	var preview []byte
+	var err error
+	if assigned.OutputUpload != nil {
+		output, preview, err = c.uploadForwardResponse(assigned, assignedAt, contentType, resp.Body, resp.ContentLength)
+		if output != nil {
+			contentType = output.ContentType
+		}
+	} else if preview, err = io.ReadAll(io.LimitReader(resp.Body, forwardPreviewSize)); err != nil {
+		err = fmt.Errorf("Read response failed: %w", err)
+	}
+	// The last progress report is sent before the final status
+	progress.close()
+	if err != nil {
+		c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, err.Error())
+		return
+	}
+
+	// Only text is quoted in stdout when the response is uploaded
+	stdout := ""
+	if len(preview) > 0 && (output == nil || isTextContentType(contentType)) {
+		stdout = truncateString(sanitizeUTF8(string(preview)), forwardPreviewSize)
+	}
+	c.sendJobStatus(&control.JobStatus{
+		JobId:           jobID,
+		AttemptId:       int32(attemptID),
+		Status:          control.JobStatusEnum_JOB_STATUS_SUCCEEDED,
+		OutputKey:       output.GetKey(),
+		Stdout:          stdout,
+		Output:          output,
+		ForwardResponse: response,
+	})
+}
+
+// reportForwardFailure reports a failed forward request: FAILED with reason TIMED_OUT if the request
+// ran out of time (ctx past its deadline), nothing if the cloud canceled the job (jobCtx done)
+func (c *Client) reportForwardFailure(jobCtx, ctx context.Context, jobID string, attemptID int, timeout time.Duration, message string) {
+	switch {
+	case jobCtx.Err() != nil:
+		log.Printf("Job %s (attempt %d) was canceled by the cloud", jobID, attemptID)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("Forward request for job %s timed out after %v", jobID, timeout)
+		c.sendJobStatus(&control.JobStatus{
+			JobId:     jobID,
+			AttemptId: int32(attemptID),
+			Status:    control.JobStatusEnum_JOB_STATUS_FAILED,
+			Message:   fmt.Sprintf("Forward request timed out after %v", timeout),
+			Reason:    reasonTimedOut,
+		})
+	default:
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, message, "")
+	}
+}
+
+// forwardForm is the multipart body of a LOCAL_FILE forward request. Input files are streamed from disk
+// rather than buffered, so large inputs do not have to fit in memory
+type forwardForm struct {
+	boundary string
+	files    []formFile
+	fields   [][2]string
+	releases []func()
+}
+
+// formFile is an input attached to a forwardForm as a file field
+type formFile struct {
+	field, name, path string
+	size              int64
+}
+
+// addFormInput downloads (or takes from the cache) an input and attaches it to the form as a file field
+func (c *Client) addFormInput(form *forwardForm, jobID, field string, in namedInput) error {
+	filePath, release, err := c.openInput(jobID, in)
+	if err != nil {
+		return fmt.Errorf("Download failed: %w", err)
+	}
+	form.releases = append(form.releases, release)
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("Open input failed: %w", err)
+	}
+	fileName := filepath.Base(filePath)
+	if in.Key != "" {
+		fileName = filepath.Base(in.Key)
+	}
+	form.files = append(form.files, formFile{field: field, name: fileName, path: filePath, size: info.Size()})
+	return nil
+}
+
+// release releases the form's inputs once the request is done with them
+func (f *forwardForm) release() {
+	for _, release := range f.releases {
+		release()
+	}
+}
+
+// size is the length of the encoded form, so the request carries a Content-Length instead of being chunked
+func (f *forwardForm) size() (int64, error) {
+	var counter countingWriter
+	if err := f.writeTo(&counter, false); err != nil {
+		return 0, err
+	}
+	length := counter.n
+	for _, file := range f.files {
+		length += file.size
+	}
+	return length, nil
+}
+
+// writeTo encodes the form to w; without contents the file parts are left empty (see size)
+func (f *forwardForm) writeTo(w io.Writer, contents bool) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(f.boundary); err != nil {
+		return err
+	}
+	for _, file := range f.files {
+		part, err := writer.CreateFormFile(file.field, file.name)
 		if err != nil {
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
-			return
+			return fmt.Errorf("Create form file failed: %w", err)
 		}
-		if err := c.uploadOutput(outputURL, respData); err != nil {
-			c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Upload failed: %v", err), "")
-			return
+		if contents {
+			if err := copyFormFile(part, file); err != nil {
+				return err
+			}
+		}
+	}
+	for _, field := range f.fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return err
 		}
-		outputKeyToReport = assigned.OutputKey
 	}
+	return writer.Close()
+}
 
-	stdout := ""
-	if len(respData) > 0 {
-		stdout = truncateString(sanitizeUTF8(string(respData)), 10000)
+// copyFormFile writes exactly the stat'ed size of a file, so the body matches the announced Content-Length
+func copyFormFile(w io.Writer, file formFile) error {
+	in, err := os.Open(file.path)
+	if err != nil {
+		return fmt.Errorf("Open input failed: %w", err)
+	}
+	defer in.Close()
+	if _, err := io.CopyN(w, in, file.size); err != nil {
+		return fmt.Errorf("Write form file failed: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// commandOutputTail is how much of a command's stdout and stderr is kept for its final status
+const commandOutputTail = 10000
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max     int
+	buf     []byte
+	written int64
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.written += int64(len(p))
+	if len(p) >= b.max {
+		b.buf = append(b.buf[:0], p[len(p)-b.max:]...)
+		return len(p), nil
+	}
+	if drop := len(b.buf) + len(p) - b.max; drop > 0 {
+		b.buf = append(b.buf[:0], b.buf[drop:]...)
 	}
-	c.reportJobStatusWithOutput(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_SUCCEEDED, "", outputKeyToReport, stdout, "")
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// Written is how many bytes were written in total
+func (b *tailBuffer) Written() int64 {
+	return b.written
+}
+
+// String returns the kept tail, marked if earlier bytes were dropped
+func (b *tailBuffer) String() string {
+	if b.written > int64(len(b.buf)) {
+		return "(truncated) ..." + string(b.buf)
+	}
+	return string(b.buf)
 }
 
 // truncateString truncates a string to maxLen, appending "..." if truncated
@@ -1028,19 +1619,11 @@ func sanitizeUTF8(s string) string {
 	return b.String()
 }
 
-// uploadOutput uploads output to presigned URL
-func (c *Client) uploadOutput(url string, data []byte) error {
-	req, err := http.NewRequest("PUT", url, bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("failed to create PUT request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.ContentLength = int64(len(data))
-
-	resp, err := c.httpClient.Do(req)
+// uploadOutput uploads size bytes of body to a presigned URL
+func (c *Client) uploadOutput(url, contentType string, body io.ReaderAt, size int64) error {
+	resp, err := c.putObject(url, contentType, body, 0, size)
 	if err != nil {
-		return fmt.Errorf("HTTP PUT failed: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -1051,6 +1634,45 @@ func (c *Client) uploadOutput(url string, data []byte) error {
 	return nil
 }
 
+// putObject PUTs length bytes of body at offset to url, streaming them from body.
+// The caller checks the status and closes the response body.
+func (c *Client) putObject(url, contentType string, body io.ReaderAt, offset, length int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPut, url, io.NewSectionReader(body, offset, length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PUT request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = length
+	if length == 0 {
+		// An empty body must not be sent chunked
+		req.Body = http.NoBody
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP PUT failed: %w", err)
+	}
+	return resp, nil
+}
+
+// uploadJobOutput uploads size bytes of body to key with the job's output_upload access.
+// Presigned URLs only allow the assigned output_key; STS credentials allow any key under output_prefix.
+func (c *Client) uploadJobOutput(assigned *control.JobAssigned, assignedAt time.Time, key, contentType string, body io.ReaderAt, size int64) error {
+	if assigned.GetOutputUpload().GetSts() != nil {
+		return c.newSTSUploader(assigned).Upload(key, contentType, body, size)
+	}
+	if key != assigned.OutputKey {
+		return fmt.Errorf("presigned output_upload only allows key %s", assigned.OutputKey)
+	}
+	outputURL, err := c.currentAccessURL(assigned, assignedAt, true)
+	if err != nil {
+		return err
+	}
+	return c.uploadOutput(outputURL, contentType, body, size)
+}
+
 func (c *Client) getPresignedURL(access *control.OSSAccess, label string) (string, error) {
 	if access == nil {
 		return "", nil
@@ -1065,6 +1687,107 @@ func (c *Client) getPresignedURL(access *control.OSSAccess, label string) (strin
 	}
 }
 
+// currentAccessURL returns the presigned URL for a job's input (output=false) or output (output=true).
+// If the assignment is older than accessRefreshAfter, a fresh URL is requested from the cloud first.
+// When the cloud cannot be reached (or does not support RefreshAccess), the assigned URL is used;
+// when the cloud rejects the refresh (lease lost or job finished), an error is returned.
+func (c *Client) currentAccessURL(assigned *control.JobAssigned, assignedAt time.Time, output bool) (string, error) {
+	access, label := assigned.InputDownload, "input_download"
+	if output {
+		access, label = assigned.OutputUpload, "output_upload"
+	}
+	assignedURL, err := c.getPresignedURL(access, label)
+	if err != nil || assignedURL == "" || time.Since(assignedAt) < c.accessRefreshAfter {
+		return assignedURL, err
+	}
+
+	ack, err := c.refreshAccess(assigned, &control.RefreshAccess{Input: !output, Output: output})
+	if err != nil {
+		log.Printf("Failed to refresh %s for job %s, using assigned URL: %v", label, assigned.JobId, err)
+		return assignedURL, nil
+	}
+	if !ack.Success {
+		return "", fmt.Errorf("%s refresh rejected: %s", label, ack.Message)
+	}
+
+	refreshed := ack.InputDownload
+	if output {
+		refreshed = ack.OutputUpload
+		if ack.OutputKey != assigned.OutputKey {
+			return "", fmt.Errorf("%s refresh returned output_key %s, expected %s", label, ack.OutputKey, assigned.OutputKey)
+		}
+	}
+	refreshedURL, err := c.getPresignedURL(refreshed, label)
+	if err != nil {
+		return "", err
+	}
+	if refreshedURL == "" {
+		return assignedURL, nil
+	}
+	log.Printf("Refreshed %s for job %s", label, assigned.JobId)
+	return refreshedURL, nil
+}
+
+// refreshAccess sends RefreshAccess for a leased job and waits for the matching RefreshAccessAck.
+// req selects what to refresh (input, output, output_files, inputs); the job and lease fields are filled in here.
+func (c *Client) refreshAccess(assigned *control.JobAssigned, req *control.RefreshAccess) (*control.RefreshAccessAck, error) {
+	requestID := generateRequestID()
+	ackChan := make(chan *control.RefreshAccessAck, 1)
+	c.pendingRefreshMu.Lock()
+	c.pendingRefresh[requestID] = ackChan
+	c.pendingRefreshMu.Unlock()
+	defer func() {
+		c.pendingRefreshMu.Lock()
+		delete(c.pendingRefresh, requestID)
+		c.pendingRefreshMu.Unlock()
+	}()
+
+	req.AgentId = c.agentID
+	req.JobId = assigned.JobId
+	req.AttemptId = assigned.AttemptId
+	req.LeaseId = assigned.LeaseId
+	envelope := &control.Envelope{
+		AgentId:   c.agentID,
+		RequestId: requestID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   &control.Envelope_RefreshAccess{RefreshAccess: req},
+	}
+
+	data, err := proto.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal RefreshAccess: %w", err)
+	}
+	if err := c.writeMessage(data); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(refreshAccessTimeout)
+	defer timer.Stop()
+	select {
+	case ack := <-ackChan:
+		return ack, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out waiting for RefreshAccessAck")
+	case <-c.stopChan:
+		return nil, fmt.Errorf("client stopped")
+	}
+}
+
+// handleRefreshAccessAck delivers a RefreshAccessAck to the caller waiting on its request_id
+func (c *Client) handleRefreshAccessAck(requestID string, ack *control.RefreshAccessAck) {
+	c.pendingRefreshMu.Lock()
+	ackChan, ok := c.pendingRefresh[requestID]
+	c.pendingRefreshMu.Unlock()
+	if !ok {
+		log.Printf("Ignoring RefreshAccessAck for unknown request %s", requestID)
+		return
+	}
+	select {
+	case ackChan <- ack:
+	default:
+	}
+}
+
 // reportJobStatus reports job status to the server (backward compatible)
 func (c *Client) reportJobStatus(jobID string, attemptID int, status control.JobStatusEnum, message, outputKey string) {
 	c.reportJobStatusWithOutput(jobID, attemptID, status, message, outputKey, "", "")
@@ -1077,7 +1800,7 @@ func (c *Client) reportJobStatusWithOutput(jobID string, attemptID int, status c
 	stderr = sanitizeUTF8(stderr)
 	message = sanitizeUTF8(message)
 
-	jobStatus := &control.JobStatus{
+	c.sendJobStatus(&control.JobStatus{
 		JobId:     jobID,
 		AttemptId: int32(attemptID),
 		Status:    status,
@@ -1085,8 +1808,49 @@ func (c *Client) reportJobStatusWithOutput(jobID string, attemptID int, status c
 		OutputKey: outputKey,
 		Stdout:    stdout,
 		Stderr:    stderr,
-	}
+	})
+}
+
+// policyError is a refusal by the agent's policy found while a job runs (e.g. a redirect to a blocked target)
+type policyError struct {
+	err error
+}
+
+func (e *policyError) Error() string {
+	return e.err.Error()
+}
+
+// reportPolicyDenied reports a job the agent's policy refuses to run
+func (c *Client) reportPolicyDenied(jobID string, attemptID int, err error) {
+	log.Printf("Job %s refused by policy: %v", jobID, err)
+	c.sendJobStatus(&control.JobStatus{
+		JobId:     jobID,
+		AttemptId: int32(attemptID),
+		Status:    control.JobStatusEnum_JOB_STATUS_FAILED,
+		Message:   sanitizeUTF8(fmt.Sprintf("Refused by agent policy: %v", err)),
+		Reason:    reasonPolicyDenied,
+	})
+}
 
+// reportCommandStatus reports the final status of a command job with its stdout/stderr and process usage
+func (c *Client) reportCommandStatus(jobID string, attemptID int, status control.JobStatusEnum, message string, result *CommandResult) {
+	c.sendJobStatus(&control.JobStatus{
+		JobId:     jobID,
+		AttemptId: int32(attemptID),
+		Status:    status,
+		Message:   sanitizeUTF8(message),
+		Stdout:    sanitizeUTF8(result.Stdout),
+		Stderr:    sanitizeUTF8(result.Stderr),
+		Usage:     result.Usage,
+	})
+}
+
+// sendJobStatus sends a JobStatus message to the server
+func (c *Client) sendJobStatus(jobStatus *control.JobStatus) {
+	jobID, attemptID, status := jobStatus.JobId, jobStatus.AttemptId, jobStatus.Status
+	if status != control.JobStatusEnum_JOB_STATUS_RUNNING {
+		jobStatus.CachedInputs = c.takeCacheHits(jobID)
+	}
 	envelope := &control.Envelope{
 		AgentId:   c.agentID,
 		RequestId: generateRequestID(),
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestClient_DownloadInput(t *testing.T) {
@@ -99,7 +101,7 @@ func TestClient_UploadOutput(t *testing.T) {
 	client.httpClient = &http.Client{Timeout: 5 * time.Second}
 
 	outputData := []byte("test output data")
-	if err := client.uploadOutput(server.URL, outputData); err != nil {
+	if err := client.uploadOutput(server.URL, "application/json", bytes.NewReader(outputData), int64(len(outputData))); err != nil {
 		t.Fatalf("Failed to upload output: %v", err)
 	}
 
@@ -160,6 +162,7 @@ func TestClient_ProcessJob_FullFlow(t *testing.T) {
 		},
 		OutputKey: expectedOutputKey,
 		Command:   command,
+		Shell:     true,
 	}
 
 	// Process job (will report status, but conn is nil so it will just log)
@@ -220,6 +223,7 @@ func TestClient_HandleJobAssigned_Concurrency(t *testing.T) {
 		},
 		OutputKey: "jobs/job-1/1/output.bin",
 		Command:   command1,
+		Shell:     true,
 	}
 
 	// Start first job (processJob increments runningJobs and starts goroutine)
@@ -254,6 +258,7 @@ func TestClient_HandleJobAssigned_Concurrency(t *testing.T) {
 		},
 		OutputKey: "jobs/job-2/1/output.bin",
 		Command:   command2,
+		Shell:     true,
 	}
 
 	// Try to start second job (should be rejected immediately)
@@ -301,6 +306,7 @@ func TestClient_ProcessJob_DownloadFailure(t *testing.T) {
 		},
 		OutputKey: "jobs/test-job-fail/1/output.bin",
 		Command:   command,
+		Shell:     true,
 	}
 
 	// Process job - should fail during download
@@ -333,7 +339,7 @@ func TestClient_DownloadInputToFile(t *testing.T) {
 	client.httpClient = &http.Client{Timeout: 5 * time.Second}
 
 	// Create a temporary file path (with extension from input_key)
-	filePath, err := client.downloadInputToFile(server.URL, "test-job", "test-input.txt")
+	filePath, err := client.downloadInputToFile(namedInput{Key: "test-input.txt", URL: server.URL}, "test-job")
 	if err != nil {
 		t.Fatalf("Failed to download input to file: %v", err)
 	}
@@ -417,7 +423,7 @@ func TestClient_DownloadInputToFile_ExtensionPreservation(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			filePath, err := client.downloadInputToFile(server.URL, tc.jobID, tc.inputKey)
+			filePath, err := client.downloadInputToFile(namedInput{Key: tc.inputKey, URL: server.URL}, tc.jobID)
 			if err != nil {
 				t.Fatalf("Failed to download input to file: %v", err)
 			}
@@ -510,7 +516,7 @@ func TestClient_ExecuteCommand_EmptyCommand(t *testing.T) {
 	inputFile := filepath.Join(tmpDir, "input.txt")
 	outputFile := filepath.Join(tmpDir, "output.txt")
 
-	_, err := client.executeCommand("", inputFile, outputFile)
+	_, err := client.executeCommand(context.Background(), commandSpec{}, tmpDir, inputFile, nil, outputFile, tmpDir, "", nil, nil)
 	if err == nil {
 		t.Error("Expected error for empty command, got nil")
 	}
@@ -519,6 +525,35 @@ func TestClient_ExecuteCommand_EmptyCommand(t *testing.T) {
 	}
 }
 
+func TestClient_ExecuteCommand_OutputTail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+	client := New("ws://test", "test-agent", "test-token", 1)
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "output", "output.txt")
+	os.MkdirAll(filepath.Dir(outputFile), 0o755)
+
+	// Only the tail of each stream is kept for the status, but all of stdout becomes the output
+	command := "head -c 50000 /dev/zero | tr '\\0' a; echo END; head -c 50000 /dev/zero | tr '\\0' b >&2; echo ERR >&2"
+	result, err := client.executeCommand(context.Background(), commandSpec{Command: command}, dir, "", nil, outputFile, filepath.Dir(outputFile), "", nil, nil)
+	if err != nil {
+		t.Fatalf("executeCommand failed: %v", err)
+	}
+	if !strings.HasSuffix(result.Stdout, "aaaEND\n") || !strings.HasPrefix(result.Stdout, "(truncated) ...") || len(result.Stdout) > commandOutputTail+20 {
+		t.Errorf("Stdout tail: %d bytes ending %q", len(result.Stdout), result.Stdout[len(result.Stdout)-10:])
+	}
+	if !strings.HasSuffix(result.Stderr, "bbbERR\n") || len(result.Stderr) > commandOutputTail+20 {
+		t.Errorf("Stderr tail: %d bytes", len(result.Stderr))
+	}
+	if data, err := os.ReadFile(outputFile); err != nil || len(data) != 50004 {
+		t.Errorf("Stdout output: %d bytes, %v", len(data), err)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(dir, "stdout_*")); len(leftover) > 0 {
+		t.Errorf("Stdout spool left behind: %v", leftover)
+	}
+}
+
 // TestClient_ProcessJob_NoInput tests that jobs without input files are handled correctly
 func TestClient_ProcessJob_NoInput(t *testing.T) {
 	// Setup HTTP test server for output upload only
@@ -555,6 +590,7 @@ func TestClient_ProcessJob_NoInput(t *testing.T) {
 		},
 		OutputKey: "jobs/test-job-no-input/1/output.bin",
 		Command:   command,
+		Shell:     true,
 	}
 
 	// Process job (should succeed without trying to download input)
@@ -621,6 +657,7 @@ func TestClient_ProcessJob_NoInput_WithInputDownloadButEmptyKey(t *testing.T) {
 		},
 		OutputKey: "jobs/test-job-no-input-key/1/output.bin",
 		Command:   command,
+		Shell:     true,
 	}
 
 	// Process job (should skip download and succeed)
@@ -681,6 +718,7 @@ func TestClient_ProcessJob_NoInput_404Error(t *testing.T) {
 		},
 		OutputKey: "jobs/test-job-404/1/output.bin",
 		Command:   command,
+		Shell:     true,
 	}
 
 	// Process job (should fail with 404 error)
@@ -750,6 +788,11 @@ func TestClient_ProcessForwardJob_LocalFile_Cache(t *testing.T) {
 	var inputDownloadCalls int
 	inputData := []byte("cached input data")
 	inputServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 		inputDownloadCalls++
 		w.WriteHeader(http.StatusOK)
 		w.Write(inputData)
@@ -774,6 +817,7 @@ func TestClient_ProcessForwardJob_LocalFile_Cache(t *testing.T) {
 	client := New("ws://test", "test-agent", "test-token", 1)
 	client.httpClient = &http.Client{Timeout: 5 * time.Second}
 	client.SetInputCacheTTL(5 * time.Minute)
+	client.inputCacheDir = t.TempDir()
 
 	jobAssigned := &control.JobAssigned{
 		JobId:     "forward-job-file",
@@ -781,6 +825,7 @@ func TestClient_ProcessForwardJob_LocalFile_Cache(t *testing.T) {
 		InputDownload: &control.OSSAccess{
 			Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: inputServer.URL},
 		},
+		InputBucket:      "lab-main",
 		InputKey:         "inputs/forward/input.txt",
 		JobType:          control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
 		InputForwardMode: control.InputForwardMode_INPUT_FORWARD_MODE_LOCAL_FILE,
@@ -858,3 +903,122 @@ func TestClient_WebSocketConcurrentWrites_NoPanic(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestClient_CurrentAccessURL_Refresh(t *testing.T) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	// Fake cloud: answers RefreshAccess, rejecting lease "lost"
+	var refreshes []*control.RefreshAccess
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope control.Envelope
+			if err := proto.Unmarshal(data, &envelope); err != nil {
+				t.Errorf("Failed to unmarshal: %v", err)
+				return
+			}
+			req := envelope.GetRefreshAccess()
+			if req == nil {
+				continue
+			}
+			mu.Lock()
+			refreshes = append(refreshes, req)
+			mu.Unlock()
+
+			ack := &control.RefreshAccessAck{JobId: req.JobId, AttemptId: req.AttemptId, Success: true, OutputKey: "jobs/job-1/1/output.bin"}
+			if req.LeaseId == "lost" {
+				ack = &control.RefreshAccessAck{JobId: req.JobId, AttemptId: req.AttemptId, Message: "lease is no longer held"}
+			} else {
+				if req.Input {
+					ack.InputDownload = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: "https://oss/fresh-input"}}
+				}
+				if req.Output {
+					ack.OutputUpload = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: "https://oss/fresh-output"}}
+				}
+			}
+			reply, _ := proto.Marshal(&control.Envelope{
+				RequestId: envelope.RequestId,
+				Payload:   &control.Envelope_RefreshAccessAck{RefreshAccessAck: ack},
+			})
+			if err := conn.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.conn = conn
+	go client.readLoop()
+
+	assigned := &control.JobAssigned{
+		JobId:         "job-1",
+		AttemptId:     1,
+		LeaseId:       "lease-1",
+		InputDownload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: "https://oss/old-input"}},
+		OutputUpload:  &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: "https://oss/old-output"}},
+		OutputKey:     "jobs/job-1/1/output.bin",
+	}
+
+	// Recent assignment: assigned URL is used without a round trip
+	url, err := client.currentAccessURL(assigned, time.Now(), true)
+	if err != nil || url != "https://oss/old-output" {
+		t.Errorf("Recent assignment: got %q, %v; want old output URL", url, err)
+	}
+
+	// Old assignment: fresh URLs are requested for the leased job
+	old := time.Now().Add(-time.Hour)
+	url, err = client.currentAccessURL(assigned, old, false)
+	if err != nil || url != "https://oss/fresh-input" {
+		t.Errorf("Input refresh: got %q, %v; want fresh input URL", url, err)
+	}
+	url, err = client.currentAccessURL(assigned, old, true)
+	if err != nil || url != "https://oss/fresh-output" {
+		t.Errorf("Output refresh: got %q, %v; want fresh output URL", url, err)
+	}
+	mu.Lock()
+	if len(refreshes) != 2 || refreshes[1].LeaseId != "lease-1" || !refreshes[1].Output || refreshes[1].Input {
+		t.Errorf("Unexpected RefreshAccess requests: %v", refreshes)
+	}
+	mu.Unlock()
+
+	// Rejected refresh (lease lost) fails instead of uploading with the stale URL
+	lost := proto.Clone(assigned).(*control.JobAssigned)
+	lost.LeaseId = "lost"
+	if _, err := client.currentAccessURL(lost, old, true); err == nil || !strings.Contains(err.Error(), "lease is no longer held") {
+		t.Errorf("Rejected refresh: expected error, got %v", err)
+	}
+
+	// Output key mismatch is refused
+	moved := proto.Clone(assigned).(*control.JobAssigned)
+	moved.OutputKey = "jobs/job-1/2/output.bin"
+	if _, err := client.currentAccessURL(moved, old, true); err == nil {
+		t.Error("Output key mismatch: expected error")
+	}
+
+	// Not connected: fall back to the assigned URL
+	offline := New("ws://test", "test-agent", "test-token", 1)
+	url, err = offline.currentAccessURL(assigned, old, true)
+	if err != nil || url != "https://oss/old-output" {
+		t.Errorf("Offline: got %q, %v; want old output URL", url, err)
+	}
+}
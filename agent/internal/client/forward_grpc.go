@@ -0,0 +1,367 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Well-known types that descriptor sets and reflected files may import without including them
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Content types of an uploaded gRPC response (binary if the request was, otherwise protobuf JSON)
+const (
+	grpcContentTypeJSON  = "application/json"
+	grpcContentTypeProto = "application/x-protobuf"
+)
+
+// processForwardGRPCJob calls a unary method of a local gRPC service and uploads the response message.
+// The method is resolved from the descriptor sets of the agent config, or else through the service's
+// server reflection. The call is bounded by forward_grpc.timeout_sec, or else the job's timeout_sec.
+func (c *Client) processForwardGRPCJob(ctx context.Context, assigned *control.JobAssigned, assignedAt time.Time) {
+	jobID := assigned.JobId
+	attemptID := int(assigned.AttemptId)
+
+	call := assigned.ForwardGrpc
+	if call == nil || strings.TrimSpace(call.Target) == "" || strings.TrimSpace(call.Method) == "" {
+		log.Printf("JobAssigned missing forward_grpc target or method for job %s", jobID)
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, "forward_grpc.target and forward_grpc.method are required", "")
+		return
+	}
+	method := strings.TrimPrefix(call.Method, "/")
+	if err := c.policy.checkForward(control.GRPCTargetURL(call.Target, method)); err != nil {
+		c.reportPolicyDenied(jobID, attemptID, err)
+		return
+	}
+
+	md := metadata.MD{}
+	for _, h := range call.Metadata {
+		if h.GetKey() != "" {
+			md.Append(h.GetKey(), h.GetValue())
+		}
+	}
+	md.Set("x-job-id", jobID)
+	md.Set("x-attempt-id", strconv.Itoa(attemptID))
+
+	// Inputs are passed as presigned URLs, like FORWARD_HTTP headers
+	inputURL, err := c.currentAccessURL(assigned, assignedAt, false)
+	if err != nil {
+		log.Printf("Failed to resolve input URL for job %s: %v", jobID, err)
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
+		return
+	}
+	if inputURL != "" && assigned.InputKey != "" {
+		md.Set("x-input-url", inputURL)
+		md.Set("x-input-key", assigned.InputKey)
+	}
+	namedInputs, err := c.currentInputURLs(assigned, assignedAt)
+	if err != nil {
+		log.Printf("Failed to resolve input URLs for job %s: %v", jobID, err)
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, err.Error(), "")
+		return
+	}
+	for _, in := range namedInputs {
+		md.Set("x-input-"+strings.ToLower(in.Name)+"-url", in.URL)
+		md.Set("x-input-"+strings.ToLower(in.Name)+"-key", in.Key)
+	}
+
+	// The service may POST progress reports to x-progress-url while it handles the call
+	progress := c.startProgress(jobID, attemptID)
+	defer progress.close()
+	if callbackURL := progress.callbackURL(); callbackURL != "" {
+		md.Set("x-progress-url", callbackURL)
+	}
+
+	timeout := time.Duration(call.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(assigned.TimeoutSec) * time.Second
+	}
+	jobCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn, err := grpc.DialContext(ctx, call.Target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Dial %s failed: %v", call.Target, err), "")
+		return
+	}
+	defer conn.Close()
+
+	desc, types, err := c.resolveGRPCMethod(ctx, conn, method)
+	if err != nil {
+		log.Printf("Failed to resolve gRPC method %s for job %s: %v", method, jobID, err)
+		c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, fmt.Sprintf("Resolve gRPC method %s failed: %v", method, err))
+		return
+	}
+	if desc.IsStreamingClient() || desc.IsStreamingServer() {
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("gRPC method %s is streaming; only unary methods are supported", method), "")
+		return
+	}
+
+	binary := len(call.RequestProto) > 0
+	request := dynamicpb.NewMessage(desc.Input())
+	if binary {
+		err = proto.Unmarshal(call.RequestProto, request)
+	} else if call.RequestJson != "" {
+		err = protojson.UnmarshalOptions{Resolver: types}.Unmarshal([]byte(call.RequestJson), request)
+	}
+	if err != nil {
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Invalid request message for %s: %v", desc.Input().FullName(), err), "")
+		return
+	}
+
+	response := dynamicpb.NewMessage(desc.Output())
+	if err := conn.Invoke(metadata.NewOutgoingContext(ctx, md), "/"+method, request, response); err != nil {
+		st := status.Convert(err)
+		message := fmt.Sprintf("gRPC call returned %s: %s", st.Code(), sanitizeUTF8(st.Message()))
+		log.Printf("Forward gRPC failed for job %s: %s", jobID, message)
+		progress.close()
+		c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, message)
+		return
+	}
+
+	var data []byte
+	contentType := grpcContentTypeJSON
+	if binary {
+		data, err = proto.Marshal(response)
+		contentType = grpcContentTypeProto
+	} else {
+		data, err = protojson.MarshalOptions{Resolver: types}.Marshal(response)
+	}
+	if err != nil {
+		progress.close()
+		c.reportJobStatus(jobID, attemptID, control.JobStatusEnum_JOB_STATUS_FAILED, fmt.Sprintf("Encode response failed: %v", err), "")
+		return
+	}
+
+	var output *control.OutputFile
+	preview := data[:previewLength(len(data))]
+	if assigned.OutputUpload != nil {
+		output, _, err = c.uploadForwardResponse(assigned, assignedAt, contentType, bytes.NewReader(data), int64(len(data)))
+	}
+	// The last progress report is sent before the final status
+	progress.close()
+	if err != nil {
+		c.reportForwardFailure(jobCtx, ctx, jobID, attemptID, timeout, err.Error())
+		return
+	}
+
+	// Binary responses are only uploaded
+	stdout := ""
+	if !binary {
+		stdout = truncateString(sanitizeUTF8(string(preview)), forwardPreviewSize)
+	}
+	c.sendJobStatus(&control.JobStatus{
+		JobId:     jobID,
+		AttemptId: int32(attemptID),
+		Status:    control.JobStatusEnum_JOB_STATUS_SUCCEEDED,
+		OutputKey: output.GetKey(),
+		Stdout:    stdout,
+		Output:    output,
+	})
+}
+
+// resolveGRPCMethod finds method ("package.Service/Method") in the agent's descriptor sets, or else
+// through the server reflection of conn. Also returns the types protobuf JSON may name (in Any fields).
+func (c *Client) resolveGRPCMethod(ctx context.Context, conn grpc.ClientConnInterface, method string) (protoreflect.MethodDescriptor, *dynamicpb.Types, error) {
+	service, name, _ := strings.Cut(method, "/")
+	if files := c.policy.grpcDescriptors(); files != nil {
+		if desc, err := findGRPCMethod(files, service, name); err == nil {
+			return desc, dynamicpb.NewTypes(files), nil
+		}
+	}
+
+	files, err := reflectGRPCService(ctx, conn, service)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not in the agent's descriptor sets, and server reflection failed: %w", err)
+	}
+	desc, err := findGRPCMethod(files, service, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return desc, dynamicpb.NewTypes(files), nil
+}
+
+// findGRPCMethod looks up method name of service in files
+func findGRPCMethod(files *protoregistry.Files, service, name string) (protoreflect.MethodDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	desc := sd.Methods().ByName(protoreflect.Name(name))
+	if desc == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, name)
+	}
+	return desc, nil
+}
+
+// reflectGRPCService fetches the file declaring service, and the files it imports, through the server
+// reflection service of conn (grpc.reflection.v1alpha, which servers commonly register)
+func reflectGRPCService(ctx context.Context, conn grpc.ClientConnInterface, service string) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	// fetch returns the files of a reflection response; an error response (e.g. an unknown file) is errNotReflected
+	errNotReflected := errors.New("not found")
+	fetch := func(req *reflectionpb.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("%w: %s", errNotReflected, e.ErrorMessage)
+		}
+		var fds []*descriptorpb.FileDescriptorProto
+		for _, data := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, fd); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor: %w", err)
+			}
+			fds = append(fds, fd)
+		}
+		return fds, nil
+	}
+
+	fds, err := fetch(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	var queue []*descriptorpb.FileDescriptorProto
+	add := func(fds []*descriptorpb.FileDescriptorProto) {
+		for _, fd := range fds {
+			if files[fd.GetName()] == nil {
+				files[fd.GetName()] = fd
+				queue = append(queue, fd)
+			}
+		}
+	}
+	add(fds)
+
+	// Servers usually send the imports along; others are asked for by name (or are well-known types)
+	for i := 0; i < len(queue); i++ {
+		for _, dep := range queue[i].GetDependency() {
+			if files[dep] != nil {
+				continue
+			}
+			fds, err := fetch(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil && !errors.Is(err, errNotReflected) {
+				return nil, err
+			}
+			add(fds)
+		}
+	}
+	return newGRPCFiles(files)
+}
+
+// newGRPCFiles builds a registry from file descriptors; imports missing from files are taken from the
+// well-known types linked into the agent (google/protobuf/*.proto)
+func newGRPCFiles(files map[string]*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range files {
+		set.File = append(set.File, fd)
+	}
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if files[dep] != nil {
+				continue
+			}
+			global, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				return nil, fmt.Errorf("%s imports %s, which is not available", set.File[i].GetName(), dep)
+			}
+			files[dep] = protodesc.ToFileDescriptorProto(global)
+			set.File = append(set.File, files[dep])
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+// loadDescriptorSets reads the policy's gRPC descriptor sets (FileDescriptorSet files; relative paths are
+// resolved against dir, the directory of the config file)
+func (p *Policy) loadDescriptorSets(dir string) error {
+	if len(p.GRPCDescriptorSets) == 0 {
+		return nil
+	}
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, name := range p.GRPCDescriptorSets {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("grpc_descriptor_sets: %w", err)
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return fmt.Errorf("grpc_descriptor_sets: %s is not a FileDescriptorSet: %w", name, err)
+		}
+		// A file shared by several sets is taken from the first
+		for _, fd := range set.File {
+			if files[fd.GetName()] == nil {
+				files[fd.GetName()] = fd
+			}
+		}
+	}
+	registry, err := newGRPCFiles(files)
+	if err != nil {
+		return fmt.Errorf("grpc_descriptor_sets: %w", err)
+	}
+	p.grpcFiles = registry
+	return nil
+}
+
+// grpcDescriptors returns the files of the configured descriptor sets (nil: none, use server reflection)
+func (p *Policy) grpcDescriptors() *protoregistry.Files {
+	if p == nil {
+		return nil
+	}
+	return p.grpcFiles
+}
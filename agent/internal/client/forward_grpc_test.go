@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// startHealthServer serves the gRPC health service on a loopback port, recording the metadata of unary calls
+func startHealthServer(t *testing.T, withReflection bool) (string, func() metadata.MD) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	var mu sync.Mutex
+	var last metadata.MD
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		last = md
+		mu.Unlock()
+		return handler(ctx, req)
+	}))
+	hs := health.NewServer()
+	hs.SetServingStatus("model", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, hs)
+	if withReflection {
+		reflection.Register(server)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), func() metadata.MD {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestProcessForwardGRPCJob_Reflection(t *testing.T) {
+	target, lastMetadata := startHealthServer(t, true)
+	var uploaded []byte
+	outputServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+	}))
+	defer outputServer.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	assign := func(jobID, method, request string) *control.JobAssigned {
+		return &control.JobAssigned{
+			JobId: jobID, AttemptId: 1,
+			JobType: control.JobTypeEnum_JOB_TYPE_FORWARD_GRPC,
+			ForwardGrpc: &control.ForwardGrpcRequest{
+				Target:      target,
+				Method:      method,
+				RequestJson: request,
+				Metadata:    []*control.Header{{Key: "x-tenant", Value: "lab"}},
+			},
+			OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: outputServer.URL}},
+			OutputKey:    "jobs/" + jobID + "/1/output.json",
+		}
+	}
+
+	client.processJob(assign("job-grpc", "grpc.health.v1.Health/Check", `{"service": "model"}`))
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_SUCCEEDED || final.Stdout != `{"status":"SERVING"}` || string(uploaded) != final.Stdout {
+		t.Fatalf("Final status %s (%q), stdout %q, uploaded %q", final.Status, final.Message, final.Stdout, uploaded)
+	}
+	if final.Output.GetContentType() != "application/json" || final.OutputKey != "jobs/job-grpc/1/output.json" {
+		t.Errorf("Output %+v", final.Output)
+	}
+	if md := lastMetadata(); strings.Join(md.Get("x-tenant"), ",") != "lab" || strings.Join(md.Get("x-job-id"), ",") != "job-grpc" {
+		t.Errorf("Call metadata: %v", md)
+	}
+
+	// A gRPC error status fails the job
+	client.processJob(assign("job-missing", "/grpc.health.v1.Health/Check", `{"service": "missing"}`))
+	if final := lastStatus(t, lc); final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || !strings.Contains(final.Message, "NotFound") {
+		t.Errorf("Unknown service: %s, message %q", final.Status, final.Message)
+	}
+
+	// Streaming methods and unknown fields are refused
+	for _, job := range []*control.JobAssigned{
+		assign("job-stream", "grpc.health.v1.Health/Watch", ""),
+		assign("job-unknown", "grpc.health.v1.Health/Check", `{"name": "model"}`),
+		assign("job-no-method", "grpc.health.v1.Health/Ping", ""),
+	} {
+		client.processJob(job)
+		if final := lastStatus(t, lc); final.JobId != job.JobId || final.Status != control.JobStatusEnum_JOB_STATUS_FAILED {
+			t.Errorf("%s: %s, message %q", job.JobId, final.Status, final.Message)
+		}
+	}
+
+	// Targets are checked against the forward targets (loopback only by default)
+	denied := assign("job-denied", "grpc.health.v1.Health/Check", "")
+	denied.ForwardGrpc.Target = "10.0.0.1:50051"
+	client.processJob(denied)
+	if final := lastStatus(t, lc); final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonPolicyDenied {
+		t.Errorf("Denied target: %s, reason %q", final.Status, final.Reason)
+	}
+}
+
+func TestProcessForwardGRPCJob_DescriptorSet(t *testing.T) {
+	target, _ := startHealthServer(t, false)
+	var uploaded []byte
+	outputServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+	}))
+	defer outputServer.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	request, _ := proto.Marshal(&healthpb.HealthCheckRequest{Service: "model"})
+	assigned := &control.JobAssigned{
+		JobId: "job-grpc", AttemptId: 1,
+		JobType: control.JobTypeEnum_JOB_TYPE_FORWARD_GRPC,
+		ForwardGrpc: &control.ForwardGrpcRequest{
+			Target:       target,
+			Method:       "grpc.health.v1.Health/Check",
+			RequestProto: request,
+		},
+		OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: outputServer.URL}},
+		OutputKey:    "jobs/job-grpc/1/output.bin",
+	}
+
+	// Without reflection the method cannot be resolved
+	client.processJob(assigned)
+	if final := lastStatus(t, lc); final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || !strings.Contains(final.Message, "server reflection failed") {
+		t.Fatalf("Without reflection: %s, message %q", final.Status, final.Message)
+	}
+
+	// With a registered descriptor set it can
+	dir := t.TempDir()
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}})
+	os.WriteFile(filepath.Join(dir, "health.pb"), set, 0o644)
+	os.WriteFile(filepath.Join(dir, "agent.json"), []byte(`{"mode": "any", "grpc_descriptor_sets": ["health.pb"]}`), 0o644)
+	policy, err := LoadPolicy(filepath.Join(dir, "agent.json"))
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	client.SetPolicy(policy)
+
+	client.processJob(assigned)
+	final := lastStatus(t, lc)
+	var response healthpb.HealthCheckResponse
+	if err := proto.Unmarshal(uploaded, &response); err != nil || response.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Uploaded response %q: %v", uploaded, err)
+	}
+	// Binary responses are uploaded but not quoted in stdout
+	if final.Status != control.JobStatusEnum_JOB_STATUS_SUCCEEDED || final.Stdout != "" || final.Output.GetContentType() != "application/x-protobuf" {
+		t.Errorf("Final status %s (%q), stdout %q, output %+v", final.Status, final.Message, final.Stdout, final.Output)
+	}
+
+	// Descriptor sets must exist and parse
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"grpc_descriptor_sets": ["agent.json"]}`), 0o644)
+	if _, err := LoadPolicy(filepath.Join(dir, "bad.json")); err == nil || !strings.Contains(err.Error(), "grpc_descriptor_sets") {
+		t.Errorf("Invalid descriptor set: %v", err)
+	}
+}
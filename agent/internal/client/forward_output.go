@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+const (
+	// forwardPreviewSize bounds the start of a forward response copied into JobStatus.stdout
+	forwardPreviewSize = 10000
+	// forwardErrorBodySize bounds the body of a non-2xx forward response quoted in the job message
+	forwardErrorBodySize = 2000
+)
+
+// uploadForwardResponse streams a forward response to the job's output_key without holding it in memory.
+// A response that fits in one multipart part is uploaded with a single PUT; a larger one is uploaded in
+// parts as it arrives (presigned access), or else spooled to a temporary file and uploaded from there.
+// Returns the uploaded output (nil for an empty response) and the start of the response.
+func (c *Client) uploadForwardResponse(assigned *control.JobAssigned, assignedAt time.Time, contentType string, body io.Reader, contentLength int64) (*control.OutputFile, []byte, error) {
+	hash := sha256.New()
+	reader := io.TeeReader(body, hash)
+	partSize := c.multipartPartSize
+	if contentLength > 0 {
+		partSize = c.multipartPartSizeFor(contentLength)
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, reader, partSize)
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("Read response failed: %w", err)
+	}
+	preview := append([]byte(nil), buf.Bytes()[:previewLength(buf.Len())]...)
+	if n == 0 {
+		return nil, preview, nil
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(buf.Bytes())
+	}
+
+	key := assigned.OutputKey
+	size := n
+	switch {
+	case n < partSize:
+		if err := c.uploadJobOutput(assigned, assignedAt, key, contentType, bytes.NewReader(buf.Bytes()), n); err != nil {
+			return nil, preview, fmt.Errorf("Upload failed: %w", err)
+		}
+	case assigned.GetOutputUpload().GetSts() == nil:
+		size, err = c.streamMultipart(assigned, key, contentType, &buf, reader, partSize)
+		if !errors.Is(err, errMultipartUnavailable) {
+			if err != nil {
+				return nil, preview, err
+			}
+			break
+		}
+		log.Printf("Uploading forward response of job %s through a temporary file: %v", assigned.JobId, err)
+		fallthrough
+	default:
+		if size, err = c.spoolAndUpload(assigned, assignedAt, key, contentType, buf.Bytes(), reader); err != nil {
+			return nil, preview, err
+		}
+	}
+
+	return &control.OutputFile{
+		Key:         key,
+		Size:        size,
+		Sha256:      hex.EncodeToString(hash.Sum(nil)),
+		ContentType: contentType,
+	}, preview, nil
+}
+
+// streamMultipart uploads buf and then the rest of the response in parts of partSize as it is read,
+// holding one part in memory. Returns errMultipartUnavailable if the cloud cannot start the upload
+// (nothing has been read from rest then); any other failure aborts the upload.
+func (c *Client) streamMultipart(assigned *control.JobAssigned, key, contentType string, buf *bytes.Buffer, rest io.Reader, partSize int64) (int64, error) {
+	ack, err := c.multipartRequest(assigned, &control.MultipartUpload{Key: key, ContentType: contentType})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errMultipartUnavailable, err)
+	}
+	journal := &uploadJournal{Key: key, UploadID: ack.UploadId}
+
+	var size int64
+	var complete []*control.UploadedPart
+	for n := int32(1); buf.Len() > 0; n++ {
+		if n > maxMultipartParts {
+			c.abortMultipart(assigned, journal)
+			return 0, fmt.Errorf("Upload failed: response exceeds %d parts of %d bytes", maxMultipartParts, partSize)
+		}
+		etag, err := c.uploadStreamPart(assigned, journal, n, buf.Bytes())
+		if err != nil {
+			c.abortMultipart(assigned, journal)
+			return 0, fmt.Errorf("Upload failed: part %d: %w", n, err)
+		}
+		complete = append(complete, &control.UploadedPart{PartNumber: n, Etag: etag})
+		size += int64(buf.Len())
+
+		buf.Reset()
+		if _, err := io.CopyN(buf, rest, partSize); err != nil && err != io.EOF {
+			c.abortMultipart(assigned, journal)
+			return 0, fmt.Errorf("Read response failed: %w", err)
+		}
+	}
+
+	ack, err = c.multipartRequest(assigned, &control.MultipartUpload{Key: key, UploadId: journal.UploadID, Complete: complete})
+	if err != nil {
+		c.abortMultipart(assigned, journal)
+		return 0, fmt.Errorf("Upload failed: %w", err)
+	}
+	if !ack.Completed {
+		return 0, fmt.Errorf("Upload failed: multipart upload was not completed")
+	}
+	log.Printf("Uploaded %s in %d part(s) while reading the forward response", key, len(complete))
+	return size, nil
+}
+
+// uploadStreamPart requests the URL of part n and PUTs data to it (with retries)
+func (c *Client) uploadStreamPart(assigned *control.JobAssigned, journal *uploadJournal, n int32, data []byte) (string, error) {
+	ack, err := c.multipartRequest(assigned, &control.MultipartUpload{Key: journal.Key, UploadId: journal.UploadID, PartNumbers: []int32{n}})
+	if err != nil {
+		return "", err
+	}
+	partURL, err := c.getPresignedURL(ack.PartUploads[n], "part upload")
+	if err != nil {
+		return "", err
+	}
+	if partURL == "" {
+		return "", fmt.Errorf("no upload URL returned")
+	}
+	return c.uploadPart(partURL, bytes.NewReader(data), 0, int64(len(data)))
+}
+
+// spoolAndUpload writes head and the rest of the response to a temporary file, then uploads the file
+func (c *Client) spoolAndUpload(assigned *control.JobAssigned, assignedAt time.Time, key, contentType string, head []byte, rest io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp("", "forward_response_*")
+	if err != nil {
+		return 0, fmt.Errorf("Upload failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(head); err != nil {
+		return 0, fmt.Errorf("Upload failed: %w", err)
+	}
+	n, err := io.Copy(tmp, rest)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return 0, fmt.Errorf("Upload failed: %w", err)
+		}
+		return 0, fmt.Errorf("Read response failed: %w", err)
+	}
+	size := int64(len(head)) + n
+	if err := c.uploadJobOutput(assigned, assignedAt, key, contentType, tmp, size); err != nil {
+		return 0, fmt.Errorf("Upload failed: %w", err)
+	}
+	return size, nil
+}
+
+// forwardResponseToProto records the status code and headers of a forward response for JobStatus.
+// Set-Cookie is left out; repeated headers are joined with ", ".
+func forwardResponseToProto(resp *http.Response) *control.ForwardResponse {
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		if !strings.EqualFold(name, "Set-Cookie") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	response := &control.ForwardResponse{StatusCode: int32(resp.StatusCode)}
+	for _, name := range names {
+		response.Headers = append(response.Headers, &control.Header{
+			Key:   name,
+			Value: sanitizeUTF8(strings.Join(resp.Header.Values(name), ", ")),
+		})
+	}
+	return response
+}
+
+// isTextContentType reports whether a forward response is text worth quoting in stdout
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+func previewLength(n int) int {
+	if n > forwardPreviewSize {
+		return forwardPreviewSize
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+func TestUploadForwardResponse_Streamed(t *testing.T) {
+	fake := newMultipartFake(t)
+	client := fake.connect(t)
+	key := "jobs/job-1/1/output.png"
+	assigned := &control.JobAssigned{
+		JobId: "job-1", AttemptId: 1, LeaseId: "lease-1", OutputPrefix: "jobs/job-1/1/", OutputKey: key,
+		OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: fake.store.URL + "/" + key}},
+	}
+	content := "0123456789"
+	sum := sha256.Sum256([]byte(content))
+
+	// Larger than one part: uploaded in parts while it is read (length unknown)
+	output, preview, err := client.uploadForwardResponse(assigned, time.Now(), "image/png", strings.NewReader(content), -1)
+	if err != nil {
+		t.Fatalf("uploadForwardResponse failed: %v", err)
+	}
+	if got := fake.objects[key]; got != content {
+		t.Errorf("Assembled object = %q", got)
+	}
+	if len(fake.partPuts) != 3 || output.Size != 10 || output.Sha256 != hex.EncodeToString(sum[:]) || output.ContentType != "image/png" {
+		t.Errorf("Parts %v, output %+v", fake.partPuts, output)
+	}
+	// The preview comes from the first part (4 bytes here)
+	if string(preview) != "0123" {
+		t.Errorf("Preview %q", preview)
+	}
+
+	// Without multipart support the response is spooled and uploaded with a single PUT
+	fake.supported = false
+	delete(fake.objects, key)
+	output, _, err = client.uploadForwardResponse(assigned, time.Now(), "", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("uploadForwardResponse without multipart failed: %v", err)
+	}
+	if got := fake.objects[key]; got != content || output.Size != 10 || output.ContentType == "" {
+		t.Errorf("Spooled upload: object %q, output %+v", got, output)
+	}
+
+	// A response that fits in one part is uploaded with a single PUT
+	delete(fake.objects, key)
+	if output, _, err = client.uploadForwardResponse(assigned, time.Now(), "text/plain", strings.NewReader("abc"), -1); err != nil || fake.objects[key] != "abc" || output.Size != 3 {
+		t.Errorf("Single PUT: object %q, output %+v, err %v", fake.objects[key], output, err)
+	}
+
+	// An empty response is not uploaded
+	if output, _, err = client.uploadForwardResponse(assigned, time.Now(), "", strings.NewReader(""), 0); output != nil || err != nil {
+		t.Errorf("Empty response: output %+v, err %v", output, err)
+	}
+}
+
+func TestProcessForwardJob_ForwardResponse(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Add("X-Model", "sdxl")
+		w.Header().Add("X-Model", "v2")
+		if r.URL.Path == "/busy" {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "queue full", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer service.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	client.processJob(&control.JobAssigned{
+		JobId: "job-ok", AttemptId: 1,
+		JobType:     control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{Url: service.URL + "/run"},
+	})
+	final := lastStatus(t, lc)
+	headers := map[string]string{}
+	for _, h := range final.GetForwardResponse().GetHeaders() {
+		headers[h.Key] = h.Value
+	}
+	if final.Status != control.JobStatusEnum_JOB_STATUS_SUCCEEDED || final.ForwardResponse.GetStatusCode() != http.StatusOK || final.Stdout != `{"ok":true}` {
+		t.Errorf("Final status %s, response %+v, stdout %q", final.Status, final.ForwardResponse, final.Stdout)
+	}
+	if headers["X-Model"] != "sdxl, v2" || headers["Content-Type"] != "application/json" || headers["Set-Cookie"] != "" {
+		t.Errorf("Recorded headers: %v", headers)
+	}
+
+	client.processJob(&control.JobAssigned{
+		JobId: "job-busy", AttemptId: 1,
+		JobType:     control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{Url: service.URL + "/busy"},
+	})
+	final = lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.ForwardResponse.GetStatusCode() != http.StatusServiceUnavailable || !strings.Contains(final.Message, "queue full") {
+		t.Errorf("Final status %s, response %+v, message %q", final.Status, final.ForwardResponse, final.Message)
+	}
+}
+
+func TestIsTextContentType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/plain; charset=utf-8": true,
+		"application/json":          true,
+		"application/problem+json":  true,
+		"image/png":                 false,
+		"application/octet-stream":  false,
+		"":                          false,
+	} {
+		if got := isTextContentType(contentType); got != want {
+			t.Errorf("isTextContentType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+// Defaults of the asynchronous forward mode (control.ForwardAsync)
+const (
+	defaultTaskIDField  = "task_id"
+	defaultStateField   = "status"
+	defaultMessageField = "error"
+	defaultPollInterval = 5 * time.Second
+	// maxTaskStatusSize bounds a submit response, a status response and a task callback body
+	maxTaskStatusSize = 1 << 20
+	// maxStatusFailures: the task is given up after this many status requests failed in a row
+	maxStatusFailures = 5
+	// taskCallbackQueue bounds the task callbacks waiting to be handled
+	taskCallbackQueue = 8
+)
+
+var (
+	defaultSucceededStates = []string{"succeeded", "success", "completed", "done"}
+	defaultFailedStates    = []string{"failed", "error", "canceled", "cancelled"}
+)
+
+// taskState is what a state of the local task means for the job
+type taskState int
+
+const (
+	taskRunning taskState = iota
+	taskSucceeded
+	taskFailed
+)
+
+// taskStatus is a status document of the local task (submit response, status response or callback body)
+type taskStatus struct {
+	raw   []byte
+	doc   interface{}
+	state string // "" if the document has no state field
+}
+
+// forwardTask follows a task submitted to the local service by an async forward job: it polls the
+// status URL and accepts status callbacks until the task succeeds or fails
+type forwardTask struct {
+	c       *Client
+	jobID   string
+	config  *control.ForwardAsync
+	baseURL string // The forward URL; a relative result URL is resolved against it
+	id      string // Task ID ("" until the submit response is read)
+	token   string // Path of the local task callback ("" until callbackURL is called)
+
+	callbacks chan *taskStatus
+}
+
+// startForwardTask prepares following the task of an async forward job
+func (c *Client) startForwardTask(jobID string, forward *control.ForwardHttpRequest) *forwardTask {
+	return &forwardTask{
+		c:         c,
+		jobID:     jobID,
+		config:    forward.Async,
+		baseURL:   forward.Url,
+		callbacks: make(chan *taskStatus, taskCallbackQueue),
+	}
+}
+
+// callbackURL returns the local URL the service may POST task statuses to
+// (http://127.0.0.1:{port}/task/{token}). Returns "" if the callback server cannot be started.
+func (t *forwardTask) callbackURL() string {
+	c := t.c
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	addr := c.callbackServerAddr()
+	if addr == "" {
+		return ""
+	}
+	if t.token == "" {
+		t.token = randomHex(16)
+		c.taskCallbacks[t.token] = t
+	}
+	return "http://" + addr + "/task/" + t.token
+}
+
+// close stops accepting callbacks for the task. Nil-safe.
+func (t *forwardTask) close() {
+	if t == nil || t.token == "" {
+		return
+	}
+	t.c.progressMu.Lock()
+	delete(t.c.taskCallbacks, t.token)
+	t.c.progressMu.Unlock()
+}
+
+// await reads the task ID from the submit response and follows the task until it ends.
+// Returns the response to upload: the result URL's response, or else the final status.
+// A failed task, failing status requests or a refused URL (*policyError) are errors.
+func (t *forwardTask) await(ctx context.Context, client *http.Client, submit *http.Response) (*http.Response, error) {
+	data, err := readTaskBody(submit)
+	if err != nil {
+		return nil, fmt.Errorf("Submit failed: %w", err)
+	}
+	status, err := parseTaskStatus(data, t.field(t.config.StateField, defaultStateField))
+	if err != nil {
+		return nil, fmt.Errorf("Submit response: %w", err)
+	}
+	id, ok := jsonField(status.doc, t.field(t.config.TaskIdField, defaultTaskIDField))
+	if !ok || id == "" {
+		return nil, fmt.Errorf("Submit response has no task ID field %q", t.field(t.config.TaskIdField, defaultTaskIDField))
+	}
+	t.id = id
+	log.Printf("Job %s: local task %s submitted", t.jobID, id)
+
+	// The submit response may already carry the state of the task
+	if status.state == "" || t.classify(status.state) == taskRunning {
+		if status, err = t.wait(ctx, client, status.state); err != nil {
+			return nil, err
+		}
+	}
+	if t.classify(status.state) == taskFailed {
+		message, _ := jsonField(status.doc, t.field(t.config.MessageField, defaultMessageField))
+		if message == "" {
+			message = "state " + status.state
+		}
+		return nil, fmt.Errorf("Local task %s failed: %s", id, truncateString(sanitizeUTF8(message), 2000))
+	}
+	log.Printf("Job %s: local task %s succeeded (%s)", t.jobID, id, status.state)
+
+	resultURL := t.expand(t.config.ResultUrl)
+	if resultURL == "" && t.config.ResultUrlField != "" {
+		ref, ok := jsonField(status.doc, t.config.ResultUrlField)
+		if !ok || ref == "" {
+			return nil, fmt.Errorf("Final status of task %s has no result URL field %q", id, t.config.ResultUrlField)
+		}
+		if resultURL, err = resolveURL(t.baseURL, ref); err != nil {
+			return nil, fmt.Errorf("Invalid result URL: %w", err)
+		}
+	}
+	if resultURL == "" {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(status.raw)),
+		}, nil
+	}
+	resp, err := t.get(ctx, client, resultURL)
+	if err != nil {
+		return nil, fmt.Errorf("Fetch result failed: %w", err)
+	}
+	return resp, nil
+}
+
+// wait polls the status URL and reads callbacks until the task is no longer running
+func (t *forwardTask) wait(ctx context.Context, client *http.Client, lastState string) (*taskStatus, error) {
+	statusURL := t.expand(t.config.StatusUrl)
+	var poll <-chan time.Time
+	if statusURL != "" {
+		interval := time.Duration(t.config.PollIntervalSec) * time.Second
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	failures := 0
+	for {
+		var status *taskStatus
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case status = <-t.callbacks:
+		case <-poll:
+			var err error
+			status, err = t.poll(ctx, client, statusURL)
+			var denied *policyError
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.As(err, &denied) {
+				return nil, err
+			}
+			if err != nil {
+				failures++
+				log.Printf("Job %s: status of task %s: %v", t.jobID, t.id, err)
+				if failures >= maxStatusFailures {
+					return nil, fmt.Errorf("Status of task %s failed %d times in a row: %w", t.id, failures, err)
+				}
+				continue
+			}
+			failures = 0
+		}
+		if status.state != lastState {
+			log.Printf("Job %s: local task %s is %s", t.jobID, t.id, status.state)
+			lastState = status.state
+		}
+		if t.classify(status.state) != taskRunning {
+			return status, nil
+		}
+	}
+}
+
+// poll requests the task status once
+func (t *forwardTask) poll(ctx context.Context, client *http.Client, statusURL string) (*taskStatus, error) {
+	resp, err := t.get(ctx, client, statusURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readTaskBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return t.parseStatus(data)
+}
+
+// get sends a GET request to the local service; the URL must be a permitted forward target
+func (t *forwardTask) get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	if err := t.c.policy.checkForward(rawURL); err != nil {
+		return nil, &policyError{err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Job-Id", t.jobID)
+	return client.Do(req)
+}
+
+// parseStatus parses a status response or callback body, which must carry the task state
+func (t *forwardTask) parseStatus(data []byte) (*taskStatus, error) {
+	stateField := t.field(t.config.StateField, defaultStateField)
+	status, err := parseTaskStatus(data, stateField)
+	if err != nil {
+		return nil, err
+	}
+	if status.state == "" {
+		return nil, fmt.Errorf("status has no state field %q", stateField)
+	}
+	return status, nil
+}
+
+// classify maps a local task state onto the job status (case-insensitive; unknown states are running)
+func (t *forwardTask) classify(state string) taskState {
+	succeeded, failed := t.config.SucceededStates, t.config.FailedStates
+	if len(succeeded) == 0 {
+		succeeded = defaultSucceededStates
+	}
+	if len(failed) == 0 {
+		failed = defaultFailedStates
+	}
+	for _, s := range succeeded {
+		if strings.EqualFold(state, s) {
+			return taskSucceeded
+		}
+	}
+	for _, s := range failed {
+		if strings.EqualFold(state, s) {
+			return taskFailed
+		}
+	}
+	return taskRunning
+}
+
+// expand substitutes the (path-escaped) task ID for {task_id} in a URL template
+func (t *forwardTask) expand(tmpl string) string {
+	return strings.ReplaceAll(tmpl, "{task_id}", url.PathEscape(t.id))
+}
+
+func (t *forwardTask) field(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+// handleTaskCallback handles POST /task/{token} from an async forward job's service.
+// The body is a task status in the same form as the status URL returns.
+func (c *Client) handleTaskCallback(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/task/")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.progressMu.Lock()
+	t := c.taskCallbacks[token]
+	c.progressMu.Unlock()
+	if t == nil {
+		http.Error(w, "Unknown or finished job", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTaskStatusSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxTaskStatusSize {
+		http.Error(w, "Task status too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	status, err := t.parseStatus(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case t.callbacks <- status:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Too many pending task statuses", http.StatusServiceUnavailable)
+	}
+}
+
+// readTaskBody reads a (bounded) response of the local service; non-2xx statuses are errors
+func readTaskBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTaskStatusSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTaskStatusSize {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxTaskStatusSize)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message := fmt.Sprintf("HTTP status %d", resp.StatusCode)
+		if len(data) > 0 {
+			message = fmt.Sprintf("%s: %s", message, truncateString(sanitizeUTF8(string(data)), 2000))
+		}
+		return nil, errors.New(message)
+	}
+	return data, nil
+}
+
+// parseTaskStatus parses a JSON task status and reads its state field (if present)
+func parseTaskStatus(data []byte, stateField string) (*taskStatus, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	state, _ := jsonField(doc, stateField)
+	return &taskStatus{raw: data, doc: doc, state: state}, nil
+}
+
+// jsonField returns a string, number or boolean field of a JSON document; dots in path select nested fields
+func jsonField(doc interface{}, path string) (string, bool) {
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if doc, ok = obj[name]; !ok {
+			return "", false
+		}
+	}
+	switch v := doc.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// resolveURL resolves a possibly relative URL against base
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	control "github.com/xiresource/proto/control"
+)
+
+func TestProcessForwardJob_AsyncPoll(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks":
+			fmt.Fprint(w, `{"task_id": 7, "status": "queued"}`)
+		case r.URL.Path == "/tasks/7":
+			polls++
+			if polls == 1 {
+				fmt.Fprint(w, `{"status": "running"}`)
+				return
+			}
+			fmt.Fprint(w, `{"status": "DONE", "result": "/tasks/7/result"}`)
+		case r.URL.Path == "/tasks/7/result":
+			fmt.Fprint(w, "RESULT")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer service.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	client.processJob(&control.JobAssigned{
+		JobId: "job-async", AttemptId: 1,
+		JobType: control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{
+			Url: service.URL + "/tasks",
+			Async: &control.ForwardAsync{
+				StatusUrl:       service.URL + "/tasks/{task_id}",
+				PollIntervalSec: 1,
+				ResultUrlField:  "result",
+			},
+		},
+	})
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_SUCCEEDED || final.Stdout != "RESULT" {
+		t.Errorf("Final status %s (%q), stdout %q", final.Status, final.Message, final.Stdout)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if polls != 2 {
+		t.Errorf("Status polled %d times, want 2", polls)
+	}
+}
+
+func TestProcessForwardJob_AsyncCallback(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackURL := r.Header.Get("X-Callback-URL")
+		if callbackURL == "" {
+			t.Error("Submit request has no X-Callback-URL")
+		}
+		fmt.Fprint(w, `{"id": "abc"}`)
+		go func() {
+			// Statuses without the state field are refused
+			resp, err := http.Post(callbackURL, "application/json", strings.NewReader(`{"progress": 10}`))
+			if err != nil || resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Callback without state: %v, %v", resp, err)
+			}
+			for _, body := range []string{`{"state": "working"}`, `{"state": "crashed", "detail": {"msg": "out of memory"}}`} {
+				resp, err := http.Post(callbackURL, "application/json", strings.NewReader(body))
+				if err != nil {
+					t.Errorf("Callback: %v", err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}))
+	defer service.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	client.processJob(&control.JobAssigned{
+		JobId: "job-callback", AttemptId: 1,
+		JobType: control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{
+			Url: service.URL + "/submit",
+			Async: &control.ForwardAsync{
+				TaskIdField:  "id",
+				StateField:   "state",
+				FailedStates: []string{"crashed"},
+				MessageField: "detail.msg",
+			},
+		},
+	})
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || !strings.Contains(final.Message, "out of memory") {
+		t.Errorf("Final status %s, message %q", final.Status, final.Message)
+	}
+
+	// A task that never ends is stopped by the job timeout
+	client.processJob(&control.JobAssigned{
+		JobId: "job-stuck", AttemptId: 1, TimeoutSec: 1,
+		JobType: control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{
+			Url:   service.URL + "/submit",
+			Async: &control.ForwardAsync{TaskIdField: "id", StateField: "state", SucceededStates: []string{"finished"}},
+		},
+	})
+	final = lastStatus(t, lc)
+	if final.JobId != "job-stuck" || final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonTimedOut {
+		t.Errorf("Stuck task: %s %s, reason %q, message %q", final.JobId, final.Status, final.Reason, final.Message)
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	status, err := parseTaskStatus([]byte(`{"id": 12345678901234567890, "task": {"state": "done", "ok": true}, "list": [1]}`), "task.state")
+	if err != nil {
+		t.Fatalf("parseTaskStatus: %v", err)
+	}
+	if status.state != "done" {
+		t.Errorf("state %q", status.state)
+	}
+	for path, want := range map[string]string{"id": "12345678901234567890", "task.ok": "true"} {
+		if got, ok := jsonField(status.doc, path); !ok || got != want {
+			t.Errorf("%s: %q, %v", path, got, ok)
+		}
+	}
+	for _, path := range []string{"list", "task", "missing", "id.x"} {
+		if got, ok := jsonField(status.doc, path); ok {
+			t.Errorf("%s: got %q", path, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+// namedInput is a named input (JobAssigned.inputs) with its current download URL.
+// The single input of a job (input_key) is a namedInput without a name.
+type namedInput struct {
+	Name   string
+	Bucket string // Empty if the cloud did not send it (such inputs are not cached)
+	Key    string
+	URL    string
+	SHA256 string // Expected hex SHA-256 of the content; empty if not given
+}
+
+// label names the input in JobStatus.cached_inputs: "input" for the single input, otherwise the name
+func (in namedInput) label() string {
+	if in.Name == "" {
+		return "input"
+	}
+	return in.Name
+}
+
+// verify checks a local copy of the input against the expected SHA-256, if one was given
+func (in namedInput) verify(path string) error {
+	if in.SHA256 == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open input for verification: %w", err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("failed to read input for verification: %w", err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, in.SHA256) {
+		return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", in.SHA256, sum)
+	}
+	return nil
+}
+
+// currentInputURLs returns the named inputs of a job with their presigned URLs.
+// As with currentAccessURL, the URLs are refreshed if the assignment is older than accessRefreshAfter;
+// the assigned URLs are used if the cloud cannot be reached, and a rejected refresh is an error.
+func (c *Client) currentInputURLs(assigned *control.JobAssigned, assignedAt time.Time) ([]namedInput, error) {
+	inputs := make([]namedInput, 0, len(assigned.Inputs))
+	names := make([]string, 0, len(assigned.Inputs))
+	for _, in := range assigned.Inputs {
+		url, err := c.getPresignedURL(in.Download, "inputs."+in.Name)
+		if err != nil {
+			return nil, err
+		}
+		if url == "" {
+			return nil, fmt.Errorf("no download URL for input %s", in.Name)
+		}
+		inputs = append(inputs, namedInput{Name: in.Name, Bucket: in.Bucket, Key: in.Key, URL: url, SHA256: in.Sha256})
+		names = append(names, in.Name)
+	}
+	if len(inputs) == 0 || time.Since(assignedAt) < c.accessRefreshAfter {
+		return inputs, nil
+	}
+
+	ack, err := c.refreshAccess(assigned, &control.RefreshAccess{Inputs: names})
+	if err != nil {
+		log.Printf("Failed to refresh input URLs for job %s, using assigned URLs: %v", assigned.JobId, err)
+		return inputs, nil
+	}
+	if !ack.Success {
+		return nil, fmt.Errorf("inputs refresh rejected: %s", ack.Message)
+	}
+	refreshed := make(map[string]string, len(ack.Inputs))
+	for _, in := range ack.Inputs {
+		url, err := c.getPresignedURL(in.Download, "inputs."+in.Name)
+		if err != nil {
+			return nil, err
+		}
+		refreshed[in.Name] = url
+	}
+	for i := range inputs {
+		if url := refreshed[inputs[i].Name]; url != "" {
+			inputs[i].URL = url
+		}
+	}
+	log.Printf("Refreshed %d input URL(s) for job %s", len(refreshed), assigned.JobId)
+	return inputs, nil
+}
+
+// downloadNamedInputs downloads the named inputs (or copies them from the cache) into dir as
+// <name><ext> (extension from the key) and returns the local path of each, for {input:name}
+func (c *Client) downloadNamedInputs(jobID string, inputs []namedInput, dir string) (map[string]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create inputs directory: %w", err)
+	}
+	paths := make(map[string]string, len(inputs))
+	for _, in := range inputs {
+		dest := filepath.Join(dir, in.Name+filepath.Ext(in.Key))
+		if err := c.fetchInput(jobID, in, dest); err != nil {
+			return nil, fmt.Errorf("input %s: %w", in.Name, err)
+		}
+		paths[in.Name] = dest
+	}
+	return paths, nil
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+// newInputServer serves fixed content per path, like presigned input URLs
+func newInputServer(t *testing.T, objects map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func namedInputsFor(server *httptest.Server, keys map[string]string) []*control.JobInput {
+	var inputs []*control.JobInput
+	for _, name := range []string{"config", "model"} {
+		inputs = append(inputs, &control.JobInput{
+			Name:     name,
+			Key:      keys[name],
+			Download: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: server.URL + "/" + name}},
+		})
+	}
+	return inputs
+}
+
+func TestClient_ProcessJob_NamedInputs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	inputServer := newInputServer(t, map[string]string{"/config": "lr: 0.1\n", "/model": "weights"})
+
+	var uploaded []byte
+	outputServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer outputServer.Close()
+
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.httpClient = &http.Client{Timeout: 5 * time.Second}
+
+	client.processJob(&control.JobAssigned{
+		JobId:        "job-named",
+		AttemptId:    1,
+		OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: outputServer.URL}},
+		OutputKey:    "jobs/job-named/1/output.txt",
+		Inputs:       namedInputsFor(inputServer, map[string]string{"config": "configs/run.yaml", "model": "models/resnet.pt"}),
+		Command:      `{ basename {input:config}; basename {input:model}; cat {input:config} {input:model}; } > {output}`,
+		Shell:        true,
+	})
+
+	if want := "config.yaml\nmodel.pt\nlr: 0.1\nweights"; string(uploaded) != want {
+		t.Errorf("Uploaded output = %q, want %q", uploaded, want)
+	}
+}
+
+func TestClient_ProcessForwardJob_NamedInputs(t *testing.T) {
+	inputServer := newInputServer(t, map[string]string{"/config": "lr: 0.1\n", "/model": "weights"})
+	keys := map[string]string{"config": "configs/run.yaml", "model": "models/resnet.pt"}
+
+	var received *http.Request
+	var receivedBody []byte
+	files := map[string]string{}
+	localService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(2 << 20); err != nil {
+				t.Errorf("Failed to parse multipart: %v", err)
+			}
+			for field, headers := range r.MultipartForm.File {
+				f, _ := headers[0].Open()
+				data, _ := io.ReadAll(f)
+				f.Close()
+				files[field] = headers[0].Filename + ":" + string(data)
+			}
+		} else {
+			receivedBody, _ = io.ReadAll(r.Body)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer localService.Close()
+
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.httpClient = &http.Client{Timeout: 5 * time.Second}
+	client.inputCacheDir = filepath.Join(t.TempDir(), "cache")
+
+	// URL mode: URLs and keys in the JSON payload and X-Input-<name>-* headers, nothing downloaded
+	client.processJob(&control.JobAssigned{
+		JobId:            "forward-named-url",
+		AttemptId:        1,
+		Inputs:           namedInputsFor(inputServer, keys),
+		JobType:          control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		InputForwardMode: control.InputForwardMode_INPUT_FORWARD_MODE_URL,
+		ForwardHttp:      &control.ForwardHttpRequest{Url: localService.URL},
+	})
+	if received == nil {
+		t.Fatal("Forward request not received")
+	}
+	var payload struct {
+		Inputs map[string]struct{ URL, Key string } `json:"inputs"`
+	}
+	if err := json.Unmarshal(receivedBody, &payload); err != nil {
+		t.Fatalf("Invalid payload %s: %v", receivedBody, err)
+	}
+	if payload.Inputs["model"].URL != inputServer.URL+"/model" || payload.Inputs["config"].Key != "configs/run.yaml" {
+		t.Errorf("Unexpected payload inputs: %+v", payload.Inputs)
+	}
+	if received.Header.Get("X-Input-Model-URL") != inputServer.URL+"/model" || received.Header.Get("X-Input-Config-Key") != "configs/run.yaml" {
+		t.Errorf("Unexpected input headers: %v", received.Header)
+	}
+
+	// LOCAL_FILE mode: one multipart file per named input
+	client.processJob(&control.JobAssigned{
+		JobId:            "forward-named-file",
+		AttemptId:        1,
+		Inputs:           namedInputsFor(inputServer, keys),
+		JobType:          control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		InputForwardMode: control.InputForwardMode_INPUT_FORWARD_MODE_LOCAL_FILE,
+		ForwardHttp:      &control.ForwardHttpRequest{Url: localService.URL},
+	})
+	if files["input:config"] != "run.yaml:lr: 0.1\n" || files["input:model"] != "resnet.pt:weights" {
+		t.Errorf("Unexpected multipart files: %v", files)
+	}
+	// The body is streamed from disk, but with a Content-Length rather than chunked
+	if received.ContentLength <= 0 || len(received.TransferEncoding) > 0 {
+		t.Errorf("Content-Length %d, Transfer-Encoding %v", received.ContentLength, received.TransferEncoding)
+	}
+}
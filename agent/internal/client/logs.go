@@ -0,0 +1,278 @@
+package client
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// logChunkSize bounds the data of one LogChunk
+	logChunkSize = 64 << 10
+	// logFlushInterval: buffered output is sent at least this often
+	logFlushInterval = time.Second
+	// logWindow bounds the LogChunks sent but not yet acknowledged by the cloud
+	logWindow = 8
+	// logBufferLimit bounds the buffered output per stream; beyond it the oldest bytes are dropped
+	logBufferLimit = 4 << 20
+	// logAckTimeout bounds the wait for an acknowledgement while flushing the last output of a job
+	logAckTimeout = 5 * time.Second
+)
+
+// Stream indexes of logStreamer buffers
+const (
+	logStdout = iota
+	logStderr
+)
+
+var logStreams = [2]control.LogStream{control.LogStream_LOG_STREAM_STDOUT, control.LogStream_LOG_STREAM_STDERR}
+
+// logStreamer sends the output of a running command to the cloud as LogChunk messages.
+// Writes never block the command: output is buffered per stream and sent every logFlushInterval
+// (or as soon as logChunkSize bytes are buffered) while fewer than logWindow chunks are unacknowledged.
+// When the cloud falls behind, the oldest buffered bytes beyond logBufferLimit are dropped and
+// reported in the next chunk's dropped_bytes.
+type logStreamer struct {
+	c         *Client
+	jobID     string
+	attemptID int32
+
+	mu       sync.Mutex
+	buf      [2][]byte
+	dropped  [2]int64
+	nextSeq  int64 // Seq of the next chunk (starts at 1)
+	ackedSeq int64
+	stopped  bool // The cloud asked to stop, or sending failed
+
+	wake     chan struct{} // Output reached logChunkSize or an ack arrived
+	done     chan struct{} // Closed by close(): the command exited
+	finished chan struct{} // Closed when the eof chunk is sent
+}
+
+// startLogStream starts streaming the output of a job attempt.
+// Returns nil (a no-op streamer) if the agent is not connected.
+func (c *Client) startLogStream(jobID string, attemptID int) *logStreamer {
+	if c.conn == nil {
+		return nil
+	}
+	s := &logStreamer{
+		c:         c,
+		jobID:     jobID,
+		attemptID: int32(attemptID),
+		nextSeq:   1,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	c.logStreamsMu.Lock()
+	c.logStreams[jobID] = s
+	c.logStreamsMu.Unlock()
+	go s.run()
+	return s
+}
+
+// handleLogChunkAck passes an acknowledgement to the job's streamer
+func (c *Client) handleLogChunkAck(ack *control.LogChunkAck) {
+	c.logStreamsMu.Lock()
+	s := c.logStreams[ack.JobId]
+	c.logStreamsMu.Unlock()
+	if s == nil || s.attemptID != ack.AttemptId {
+		return
+	}
+
+	s.mu.Lock()
+	if ack.AckedSeq > s.ackedSeq {
+		s.ackedSeq = ack.AckedSeq
+	}
+	if ack.Stop && !s.stopped {
+		log.Printf("Cloud stopped log streaming for job %s (attempt %d)", s.jobID, s.attemptID)
+		s.stopped = true
+		s.buf = [2][]byte{}
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// writer returns the io.Writer of a stream (logStdout or logStderr); nil-safe
+func (s *logStreamer) writer(stream int) io.Writer {
+	if s == nil {
+		return io.Discard
+	}
+	return logWriter{s: s, stream: stream}
+}
+
+type logWriter struct {
+	s      *logStreamer
+	stream int
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	s := w.s
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return len(p), nil
+	}
+	s.buf[w.stream] = append(s.buf[w.stream], p...)
+	if over := len(s.buf[w.stream]) - logBufferLimit; over > 0 {
+		s.buf[w.stream] = append([]byte(nil), s.buf[w.stream][over:]...)
+		s.dropped[w.stream] += int64(over)
+	}
+	full := len(s.buf[w.stream]) >= logChunkSize
+	s.mu.Unlock()
+	if full {
+		s.signal()
+	}
+	return len(p), nil
+}
+
+func (s *logStreamer) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close flushes the remaining output and sends the eof chunk; it returns once the chunk is sent.
+// Must be called before the job's final JobStatus. Nil-safe.
+func (s *logStreamer) close() {
+	if s == nil {
+		return
+	}
+	close(s.done)
+	<-s.finished
+
+	s.c.logStreamsMu.Lock()
+	delete(s.c.logStreams, s.jobID)
+	s.c.logStreamsMu.Unlock()
+}
+
+func (s *logStreamer) run() {
+	defer close(s.finished)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.wake:
+			s.flush()
+		case <-s.done:
+			s.drain()
+			return
+		}
+	}
+}
+
+// flush sends buffered output while the window allows; reports whether the buffers are empty
+func (s *logStreamer) flush() bool {
+	for {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return true
+		}
+		stream := -1
+		for i := range s.buf {
+			if len(s.buf[i]) > 0 || s.dropped[i] > 0 {
+				stream = i
+				break
+			}
+		}
+		if stream < 0 {
+			s.mu.Unlock()
+			return true
+		}
+		if s.nextSeq-1-s.ackedSeq >= logWindow {
+			s.mu.Unlock()
+			return false
+		}
+		n := len(s.buf[stream])
+		if n > logChunkSize {
+			n = logChunkSize
+		}
+		chunk := &control.LogChunk{
+			AgentId:      s.c.agentID,
+			JobId:        s.jobID,
+			AttemptId:    s.attemptID,
+			Seq:          s.nextSeq,
+			Stream:       logStreams[stream],
+			Data:         s.buf[stream][:n:n],
+			DroppedBytes: s.dropped[stream],
+		}
+		s.buf[stream] = s.buf[stream][n:]
+		s.dropped[stream] = 0
+		s.nextSeq++
+		s.mu.Unlock()
+
+		if !s.send(chunk) {
+			return true
+		}
+	}
+}
+
+// drain flushes the remaining output, waiting up to logAckTimeout for each acknowledgement
+// that frees the window, then sends the eof chunk
+func (s *logStreamer) drain() {
+	timer := time.NewTimer(logAckTimeout)
+	defer timer.Stop()
+	for !s.flush() {
+		select {
+		case <-s.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(logAckTimeout)
+		case <-timer.C:
+			s.mu.Lock()
+			lost := len(s.buf[logStdout]) + len(s.buf[logStderr])
+			s.buf = [2][]byte{}
+			s.dropped = [2]int64{}
+			s.mu.Unlock()
+			log.Printf("Warning: log chunks of job %s are not acknowledged, dropping %d bytes of output", s.jobID, lost)
+		}
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	chunk := &control.LogChunk{
+		AgentId:   s.c.agentID,
+		JobId:     s.jobID,
+		AttemptId: s.attemptID,
+		Seq:       s.nextSeq,
+		Stream:    control.LogStream_LOG_STREAM_STDOUT,
+		Eof:       true,
+	}
+	s.nextSeq++
+	s.mu.Unlock()
+	s.send(chunk)
+}
+
+// send writes one chunk; a failed write stops the stream
+func (s *logStreamer) send(chunk *control.LogChunk) bool {
+	data, err := proto.Marshal(&control.Envelope{
+		AgentId:   s.c.agentID,
+		RequestId: generateRequestID(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   &control.Envelope_LogChunk{LogChunk: chunk},
+	})
+	if err == nil {
+		err = s.c.writeMessage(data)
+	}
+	if err != nil {
+		log.Printf("Failed to send log chunk %d of job %s, stopping log streaming: %v", chunk.Seq, s.jobID, err)
+		s.mu.Lock()
+		s.stopped = true
+		s.buf = [2][]byte{}
+		s.mu.Unlock()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+// logCloud is a fake cloud that records LogChunks (and JobProgress, JobStatus) and acknowledges the chunks while acking is set
+type logCloud struct {
+	mu       sync.Mutex
+	chunks   []*control.LogChunk
+	progress []*control.JobProgress
+	statuses []*control.JobStatus
+	acking   bool
+	conn     *websocket.Conn
+}
+
+func (lc *logCloud) received() []*control.LogChunk {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return append([]*control.LogChunk(nil), lc.chunks...)
+}
+
+// ack enables acknowledgements and acknowledges everything received so far
+func (lc *logCloud) ack() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.acking = true
+	if n := len(lc.chunks); n > 0 {
+		lc.sendAck(lc.chunks[n-1])
+	}
+}
+
+func (lc *logCloud) sendAck(chunk *control.LogChunk) {
+	reply, _ := proto.Marshal(&control.Envelope{
+		Payload: &control.Envelope_LogChunkAck{LogChunkAck: &control.LogChunkAck{
+			JobId: chunk.JobId, AttemptId: chunk.AttemptId, AckedSeq: chunk.Seq,
+		}},
+	})
+	lc.conn.WriteMessage(websocket.BinaryMessage, reply)
+}
+
+func newLogCloudClient(t *testing.T, acking bool) (*Client, *logCloud) {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	lc := &logCloud{acking: acking}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		lc.mu.Lock()
+		lc.conn = conn
+		lc.mu.Unlock()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope control.Envelope
+			if err := proto.Unmarshal(data, &envelope); err != nil {
+				t.Errorf("Failed to unmarshal: %v", err)
+				return
+			}
+			if progress := envelope.GetJobProgress(); progress != nil {
+				lc.mu.Lock()
+				lc.progress = append(lc.progress, progress)
+				lc.mu.Unlock()
+				continue
+			}
+			if status := envelope.GetJobStatus(); status != nil {
+				lc.mu.Lock()
+				lc.statuses = append(lc.statuses, status)
+				lc.mu.Unlock()
+				continue
+			}
+			chunk := envelope.GetLogChunk()
+			if chunk == nil {
+				continue
+			}
+			lc.mu.Lock()
+			lc.chunks = append(lc.chunks, chunk)
+			if lc.acking {
+				lc.sendAck(chunk)
+			}
+			lc.mu.Unlock()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.conn = conn
+	go client.readLoop()
+	return client, lc
+}
+
+func TestLogStreamer_StreamsOutput(t *testing.T) {
+	client, lc := newLogCloudClient(t, true)
+
+	logs := client.startLogStream("job-1", 2)
+	result, err := client.executeCommand(context.Background(), commandSpec{Command: "echo out1; echo err1 >&2; sleep 1.5; echo out2"}, t.TempDir(), "", nil, t.TempDir()+"/out", t.TempDir(), "", logs, nil)
+	if err != nil {
+		t.Fatalf("executeCommand failed: %v", err)
+	}
+	logs.close()
+	if result.Stdout != "out1\nout2\n" {
+		t.Errorf("Stdout = %q, want both lines (JobStatus keeps the full short output)", result.Stdout)
+	}
+
+	// close returns after sending eof; give the fake cloud a moment to read it
+	var chunks []*control.LogChunk
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		chunks = lc.received()
+		if len(chunks) > 0 && chunks[len(chunks)-1].Eof {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Got %d chunks, want output chunks and eof", len(chunks))
+	}
+
+	var stdout, stderr bytes.Buffer
+	for i, chunk := range chunks {
+		if chunk.Seq != int64(i+1) {
+			t.Errorf("Chunk %d has seq %d, want %d", i, chunk.Seq, i+1)
+		}
+		if chunk.JobId != "job-1" || chunk.AttemptId != 2 || chunk.AgentId != "test-agent" {
+			t.Errorf("Chunk %d identifies %s/%d/%s", i, chunk.JobId, chunk.AttemptId, chunk.AgentId)
+		}
+		if chunk.Eof != (i == len(chunks)-1) {
+			t.Errorf("Chunk %d eof = %v", i, chunk.Eof)
+		}
+		if chunk.Stream == control.LogStream_LOG_STREAM_STDERR {
+			stderr.Write(chunk.Data)
+		} else {
+			stdout.Write(chunk.Data)
+		}
+	}
+	if stdout.String() != "out1\nout2\n" || stderr.String() != "err1\n" {
+		t.Errorf("Streamed stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+	// out1 is sent before the command exits (after logFlushInterval), not at the end
+	if string(chunks[0].Data) != "out1\n" && string(chunks[0].Data) != "err1\n" {
+		t.Errorf("First chunk = %q, want the output before the sleep", chunks[0].Data)
+	}
+
+	client.logStreamsMu.Lock()
+	defer client.logStreamsMu.Unlock()
+	if len(client.logStreams) != 0 {
+		t.Errorf("Streamer not removed after close")
+	}
+}
+
+func TestLogStreamer_Backpressure(t *testing.T) {
+	client, lc := newLogCloudClient(t, false)
+
+	logs := client.startLogStream("job-1", 1)
+	w := logs.writer(logStdout)
+	written := 0
+	block := bytes.Repeat([]byte("x"), 32<<10)
+	for written < logWindow*logChunkSize+logBufferLimit+(1<<20) {
+		w.Write(block)
+		written += len(block)
+	}
+
+	// Without acks at most logWindow chunks are in flight
+	time.Sleep(2 * logFlushInterval)
+	if n := len(lc.received()); n != logWindow {
+		t.Fatalf("Got %d unacknowledged chunks, want %d", n, logWindow)
+	}
+
+	lc.ack()
+	logs.close()
+	deadline := time.Now().Add(5 * time.Second)
+	var chunks []*control.LogChunk
+	for time.Now().Before(deadline) {
+		chunks = lc.received()
+		if len(chunks) > 0 && chunks[len(chunks)-1].Eof {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(chunks) == 0 || !chunks[len(chunks)-1].Eof {
+		t.Fatalf("No eof chunk after acks resumed")
+	}
+
+	var data, dropped int64
+	for _, chunk := range chunks {
+		data += int64(len(chunk.Data))
+		dropped += chunk.DroppedBytes
+	}
+	if dropped == 0 {
+		t.Errorf("Expected dropped bytes beyond the %d byte buffer", logBufferLimit)
+	}
+	if data+dropped != int64(written) {
+		t.Errorf("Streamed %d + dropped %d bytes, want %d written", data, dropped, written)
+	}
+}
+
+func TestLogStreamer_Stop(t *testing.T) {
+	client, lc := newLogCloudClient(t, false)
+
+	logs := client.startLogStream("job-1", 1)
+	logs.writer(logStderr).Write([]byte("before stop\n"))
+	client.handleLogChunkAck(&control.LogChunkAck{JobId: "job-1", AttemptId: 1, Stop: true})
+	logs.writer(logStderr).Write([]byte("after stop\n"))
+	logs.close()
+
+	time.Sleep(100 * time.Millisecond)
+	for _, chunk := range lc.received() {
+		if chunk.Eof || bytes.Contains(chunk.Data, []byte("after stop")) {
+			t.Errorf("Chunk sent after the cloud stopped the stream: %+v", chunk)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+const (
+	// maxMultipartParts is the largest part number S3 and COS accept
+	maxMultipartParts = 10000
+	// multipartURLBatch bounds the part URLs requested in one RefreshAccess, so that a batch is
+	// uploaded well before its URLs expire (the cloud accepts up to maxRefreshOutputFiles)
+	multipartURLBatch = 10
+	// maxTransferAttempts bounds the attempts for one part upload or one download
+	maxTransferAttempts = 4
+)
+
+// errMultipartUnavailable: the cloud could not start a multipart upload (older cloud, provider
+// without multipart support, or the cloud is unreachable); the file is uploaded with a single PUT instead
+var errMultipartUnavailable = errors.New("multipart upload unavailable")
+
+// uploadJournal records the progress of a multipart upload in uploadJournalDir. It is written after
+// every part, so an upload of the same key and content interrupted by a failure or an agent restart
+// resumes with the parts that are still missing.
+type uploadJournal struct {
+	Key      string         `json:"key"`
+	UploadID string         `json:"upload_id"`
+	Size     int64          `json:"size"`
+	SHA256   string         `json:"sha256"`
+	PartSize int64          `json:"part_size"`
+	Parts    map[int]string `json:"parts"` // Part number -> ETag
+}
+
+// multipartPartSizeFor returns the part size for a file of size bytes: the configured part size,
+// raised if needed so that the file fits in maxMultipartParts parts
+func (c *Client) multipartPartSizeFor(size int64) int64 {
+	partSize := c.multipartPartSize
+	if minSize := (size + maxMultipartParts - 1) / maxMultipartParts; partSize < minSize {
+		partSize = minSize
+	}
+	return partSize
+}
+
+// uploadMultipart uploads a local output file in parts through RefreshAccess.multipart: the cloud
+// starts the upload and presigns part URLs in batches, the parts are PUT with retries, and the cloud
+// completes the upload from the part ETags. A journaled upload of the same file is resumed; if it
+// cannot be resumed (e.g. the upload expired), a new upload is started.
+func (c *Client) uploadMultipart(assigned *control.JobAssigned, file outputFile, body io.ReaderAt) error {
+	partSize := c.multipartPartSizeFor(file.Size)
+	journal := c.loadUploadJournal(file, partSize)
+	if journal != nil {
+		log.Printf("Resuming multipart upload of %s (%d part(s) already uploaded)", file.Key, len(journal.Parts))
+		err := c.uploadParts(assigned, journal, body)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to resume multipart upload of %s, starting over: %v", file.Key, err)
+		c.abortMultipart(assigned, journal)
+	}
+
+	ack, err := c.multipartRequest(assigned, &control.MultipartUpload{Key: file.Key, ContentType: file.ContentType})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMultipartUnavailable, err)
+	}
+	journal = &uploadJournal{
+		Key:      file.Key,
+		UploadID: ack.UploadId,
+		Size:     file.Size,
+		SHA256:   file.SHA256,
+		PartSize: partSize,
+		Parts:    make(map[int]string),
+	}
+	c.saveUploadJournal(journal)
+	// On failure the journal is kept, so that a retry of the same file resumes
+	return c.uploadParts(assigned, journal, body)
+}
+
+// uploadParts uploads the parts missing from the journal and completes the upload
+func (c *Client) uploadParts(assigned *control.JobAssigned, journal *uploadJournal, body io.ReaderAt) error {
+	partCount := int((journal.Size + journal.PartSize - 1) / journal.PartSize)
+	var pending []int32
+	for n := 1; n <= partCount; n++ {
+		if journal.Parts[n] == "" {
+			pending = append(pending, int32(n))
+		}
+	}
+
+	for start := 0; start < len(pending); start += multipartURLBatch {
+		end := start + multipartURLBatch
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		ack, err := c.multipartRequest(assigned, &control.MultipartUpload{
+			Key:         journal.Key,
+			UploadId:    journal.UploadID,
+			PartNumbers: batch,
+		})
+		if err != nil {
+			return err
+		}
+		for _, n := range batch {
+			partURL, err := c.getPresignedURL(ack.PartUploads[n], "part upload")
+			if err != nil {
+				return err
+			}
+			if partURL == "" {
+				return fmt.Errorf("no upload URL returned for part %d", n)
+			}
+			offset := int64(n-1) * journal.PartSize
+			length := journal.PartSize
+			if offset+length > journal.Size {
+				length = journal.Size - offset
+			}
+			etag, err := c.uploadPart(partURL, body, offset, length)
+			if err != nil {
+				return fmt.Errorf("part %d: %w", n, err)
+			}
+			journal.Parts[int(n)] = etag
+			c.saveUploadJournal(journal)
+		}
+	}
+
+	complete := make([]*control.UploadedPart, 0, len(journal.Parts))
+	for n := 1; n <= partCount; n++ {
+		complete = append(complete, &control.UploadedPart{PartNumber: int32(n), Etag: journal.Parts[n]})
+	}
+	ack, err := c.multipartRequest(assigned, &control.MultipartUpload{
+		Key:      journal.Key,
+		UploadId: journal.UploadID,
+		Complete: complete,
+	})
+	if err != nil {
+		return err
+	}
+	if !ack.Completed {
+		return fmt.Errorf("multipart upload was not completed")
+	}
+	c.removeUploadJournal(journal.Key)
+	log.Printf("Uploaded %s in %d part(s)", journal.Key, partCount)
+	return nil
+}
+
+// uploadPart PUTs one part (length bytes at offset) and returns its ETag.
+// Network errors and 5xx responses are retried with a growing delay.
+func (c *Client) uploadPart(partURL string, body io.ReaderAt, offset, length int64) (string, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxTransferAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * c.transferRetryDelay)
+		}
+		resp, err := c.putObject(partURL, "", body, offset, length)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("HTTP PUT returned status %d", resp.StatusCode)
+			if resp.StatusCode < 500 {
+				return "", lastErr
+			}
+			continue
+		}
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			return "", fmt.Errorf("part upload returned no ETag")
+		}
+		return etag, nil
+	}
+	return "", fmt.Errorf("%w (after %d attempts)", lastErr, maxTransferAttempts)
+}
+
+// abortMultipart asks the cloud to discard an upload that is given up on, and forgets its journal
+func (c *Client) abortMultipart(assigned *control.JobAssigned, journal *uploadJournal) {
+	c.removeUploadJournal(journal.Key)
+	if _, err := c.multipartRequest(assigned, &control.MultipartUpload{
+		Key:      journal.Key,
+		UploadId: journal.UploadID,
+		Abort:    true,
+	}); err != nil {
+		log.Printf("Failed to abort multipart upload of %s: %v", journal.Key, err)
+	}
+}
+
+// multipartRequest sends one multipart step in RefreshAccess.multipart and returns the cloud's answer
+func (c *Client) multipartRequest(assigned *control.JobAssigned, req *control.MultipartUpload) (*control.MultipartUploadAck, error) {
+	ack, err := c.refreshAccess(assigned, &control.RefreshAccess{Multipart: req})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send multipart request: %w", err)
+	}
+	if !ack.Success {
+		return nil, fmt.Errorf("multipart request rejected: %s", ack.Message)
+	}
+	if ack.Multipart == nil || ack.Multipart.UploadId == "" {
+		return nil, fmt.Errorf("cloud did not answer the multipart request")
+	}
+	return ack.Multipart, nil
+}
+
+// uploadJournalPath returns the journal file of key
+func (c *Client) uploadJournalPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.uploadJournalDir, fmt.Sprintf("%x.json", sum))
+}
+
+// loadUploadJournal returns the journal of an earlier upload of the same file, or nil
+func (c *Client) loadUploadJournal(file outputFile, partSize int64) *uploadJournal {
+	data, err := os.ReadFile(c.uploadJournalPath(file.Key))
+	if err != nil {
+		return nil
+	}
+	var journal uploadJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil
+	}
+	if journal.Key != file.Key || journal.UploadID == "" || journal.Size != file.Size ||
+		journal.SHA256 != file.SHA256 || journal.PartSize != partSize {
+		return nil
+	}
+	if journal.Parts == nil {
+		journal.Parts = make(map[int]string)
+	}
+	return &journal
+}
+
+// saveUploadJournal writes the journal (failures only cost the ability to resume)
+func (c *Client) saveUploadJournal(journal *uploadJournal) {
+	data, err := json.Marshal(journal)
+	if err == nil {
+		err = os.MkdirAll(c.uploadJournalDir, 0o700)
+	}
+	if err == nil {
+		path := c.uploadJournalPath(journal.Key)
+		if err = os.WriteFile(path+".tmp", data, 0o600); err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to write upload journal for %s: %v", journal.Key, err)
+	}
+}
+
+func (c *Client) removeUploadJournal(key string) {
+	if err := os.Remove(c.uploadJournalPath(key)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to remove upload journal for %s: %v", key, err)
+	}
+}
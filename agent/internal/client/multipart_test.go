@@ -0,0 +1,291 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+// multipartFake is an object store with multipart parts plus a cloud that answers RefreshAccess.multipart
+type multipartFake struct {
+	mu          sync.Mutex
+	parts       map[int]string // Part number -> content of the current upload
+	partPuts    map[int]int    // PUTs per part number
+	failPart    int            // This part fails once with 503
+	uploads     int
+	objects     map[string]string
+	supported   bool
+	store       *httptest.Server
+	cloud       *httptest.Server
+	lastRequest *control.MultipartUpload
+}
+
+func newMultipartFake(t *testing.T) *multipartFake {
+	t.Helper()
+	f := &multipartFake{parts: map[int]string{}, partPuts: map[int]int{}, objects: map[string]string{}, supported: true}
+	f.store = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		part, _ := strconv.Atoi(r.URL.Query().Get("part"))
+		if part == 0 {
+			f.objects[strings.TrimPrefix(r.URL.Path, "/")] = string(data)
+			return
+		}
+		f.partPuts[part]++
+		if part == f.failPart && f.partPuts[part] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f.parts[part] = string(data)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, part))
+	}))
+	t.Cleanup(f.store.Close)
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	f.cloud = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope control.Envelope
+			if proto.Unmarshal(data, &envelope) != nil || envelope.GetRefreshAccess().GetMultipart() == nil {
+				continue
+			}
+			req := envelope.GetRefreshAccess()
+			reply, _ := proto.Marshal(&control.Envelope{
+				RequestId: envelope.RequestId,
+				Payload:   &control.Envelope_RefreshAccessAck{RefreshAccessAck: f.answer(req)},
+			})
+			conn.WriteMessage(websocket.BinaryMessage, reply)
+		}
+	}))
+	t.Cleanup(f.cloud.Close)
+	return f
+}
+
+func (f *multipartFake) answer(req *control.RefreshAccess) *control.RefreshAccessAck {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mp := req.Multipart
+	f.lastRequest = mp
+	ack := &control.RefreshAccessAck{JobId: req.JobId, AttemptId: req.AttemptId}
+	if !f.supported {
+		ack.Message = "multipart upload is not supported by the OSS provider"
+		return ack
+	}
+	result := &control.MultipartUploadAck{Key: mp.Key, UploadId: mp.UploadId}
+	if result.UploadId == "" {
+		f.uploads++
+		f.parts = map[int]string{}
+		result.UploadId = fmt.Sprintf("upload-%d", f.uploads)
+	}
+	if len(mp.PartNumbers) > 0 {
+		result.PartUploads = map[int32]*control.OSSAccess{}
+		for _, n := range mp.PartNumbers {
+			result.PartUploads[n] = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{
+				PresignedUrl: fmt.Sprintf("%s/%s?uploadId=%s&part=%d", f.store.URL, mp.Key, result.UploadId, n),
+			}}
+		}
+	}
+	if len(mp.Complete) > 0 {
+		var object strings.Builder
+		for _, part := range mp.Complete {
+			if part.Etag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+				ack.Message = "ETag mismatch"
+				return ack
+			}
+			object.WriteString(f.parts[int(part.PartNumber)])
+		}
+		f.objects[mp.Key] = object.String()
+		result.Completed = true
+	}
+	ack.Success = true
+	ack.Multipart = result
+	return ack
+}
+
+// connect returns a client connected to the fake cloud with tiny multipart settings (4-byte parts from 10 bytes)
+func (f *multipartFake) connect(t *testing.T) *Client {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(f.cloud.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.conn = conn
+	client.httpClient = &http.Client{Timeout: 5 * time.Second}
+	client.multipartThreshold = 10
+	client.multipartPartSize = 4
+	client.uploadJournalDir = t.TempDir()
+	client.transferRetryDelay = time.Millisecond
+	go client.readLoop()
+	return client
+}
+
+func writeOutputFile(t *testing.T, content string) outputFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.bin")
+	os.WriteFile(path, []byte(content), 0o644)
+	file, err := describeOutputFile(path)
+	if err != nil {
+		t.Fatalf("describeOutputFile failed: %v", err)
+	}
+	file.Key = "jobs/job-1/1/model.bin"
+	return file
+}
+
+func TestClient_UploadOutputFile_Multipart(t *testing.T) {
+	fake := newMultipartFake(t)
+	fake.failPart = 2
+	client := fake.connect(t)
+	assigned := &control.JobAssigned{JobId: "job-1", AttemptId: 1, LeaseId: "lease-1", OutputPrefix: "jobs/job-1/1/"}
+	file := writeOutputFile(t, "0123456789")
+
+	put := func(body io.ReaderAt, size int64) error {
+		t.Error("Single PUT used for a multipart upload")
+		return nil
+	}
+	if err := client.uploadOutputFile(assigned, file, true, put); err != nil {
+		t.Fatalf("uploadOutputFile failed: %v", err)
+	}
+	if got := fake.objects[file.Key]; got != "0123456789" {
+		t.Errorf("Assembled object = %q", got)
+	}
+	// Part 2 failed once and was retried; the others were uploaded once
+	if fake.partPuts[1] != 1 || fake.partPuts[2] != 2 || fake.partPuts[3] != 1 {
+		t.Errorf("Unexpected part PUTs: %v", fake.partPuts)
+	}
+	if _, err := os.Stat(client.uploadJournalPath(file.Key)); !os.IsNotExist(err) {
+		t.Errorf("Journal should be removed after completion: %v", err)
+	}
+
+	// Below the threshold, or with STS access, the file is streamed in a single PUT
+	var single []byte
+	small := writeOutputFile(t, "012345678")
+	for _, tc := range []struct {
+		file      outputFile
+		multipart bool
+	}{{small, true}, {file, false}} {
+		single = nil
+		client.uploadOutputFile(assigned, tc.file, tc.multipart, func(body io.ReaderAt, size int64) error {
+			single, _ = io.ReadAll(io.NewSectionReader(body, 0, size))
+			return nil
+		})
+		if string(single) == "" {
+			t.Errorf("Expected a single PUT of %d bytes (multipart=%v)", tc.file.Size, tc.multipart)
+		}
+	}
+}
+
+func TestClient_UploadOutputFile_MultipartResume(t *testing.T) {
+	fake := newMultipartFake(t)
+	client := fake.connect(t)
+	assigned := &control.JobAssigned{JobId: "job-1", AttemptId: 1, LeaseId: "lease-1", OutputPrefix: "jobs/job-1/1/"}
+	file := writeOutputFile(t, "0123456789")
+
+	// An earlier run uploaded parts 1 and 2 of upload-7 before the agent stopped
+	fake.uploads = 7
+	fake.parts = map[int]string{1: "0123", 2: "4567"}
+	client.saveUploadJournal(&uploadJournal{
+		Key:      file.Key,
+		UploadID: "upload-7",
+		Size:     file.Size,
+		SHA256:   file.SHA256,
+		PartSize: 4,
+		Parts:    map[int]string{1: `"etag-1"`, 2: `"etag-2"`},
+	})
+
+	if err := client.uploadOutputFile(assigned, file, true, nil); err != nil {
+		t.Fatalf("uploadOutputFile failed: %v", err)
+	}
+	if fake.objects[file.Key] != "0123456789" || fake.uploads != 7 {
+		t.Errorf("Unexpected object %q after %d upload(s)", fake.objects[file.Key], fake.uploads)
+	}
+	if fake.partPuts[1] != 0 || fake.partPuts[2] != 0 || fake.partPuts[3] != 1 {
+		t.Errorf("Only part 3 should be uploaded, got %v", fake.partPuts)
+	}
+
+	// A journal of different content is not resumed
+	client.saveUploadJournal(&uploadJournal{Key: file.Key, UploadID: "upload-7", Size: file.Size, SHA256: "other", PartSize: 4})
+	if journal := client.loadUploadJournal(file, 4); journal != nil {
+		t.Errorf("Journal of other content resumed: %+v", journal)
+	}
+}
+
+func TestClient_UploadOutputFile_MultipartFallback(t *testing.T) {
+	fake := newMultipartFake(t)
+	fake.supported = false
+	client := fake.connect(t)
+	assigned := &control.JobAssigned{JobId: "job-1", AttemptId: 1, LeaseId: "lease-1", OutputPrefix: "jobs/job-1/1/"}
+	file := writeOutputFile(t, "0123456789")
+
+	var uploaded bytes.Buffer
+	if err := client.uploadOutputFile(assigned, file, true, func(body io.ReaderAt, size int64) error {
+		_, err := io.Copy(&uploaded, io.NewSectionReader(body, 0, size))
+		return err
+	}); err != nil {
+		t.Fatalf("uploadOutputFile failed: %v", err)
+	}
+	if uploaded.String() != "0123456789" || fake.lastRequest == nil {
+		t.Errorf("Expected a multipart attempt and a single PUT fallback, got %q", uploaded.String())
+	}
+}
+
+func TestClient_DownloadToFile_Resume(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if first {
+			// Announce the full body but stop after 300 bytes
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:300]))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.transferRetryDelay = time.Millisecond
+	dest := filepath.Join(t.TempDir(), "input.bin")
+	if err := client.downloadToFile(server.URL, dest); err != nil {
+		t.Fatalf("downloadToFile failed: %v", err)
+	}
+	data, _ := os.ReadFile(dest)
+	if string(data) != content {
+		t.Errorf("Downloaded %d bytes, want %d", len(data), len(content))
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=300-" {
+		t.Errorf("Expected a resumed request from byte 300, got ranges %q", ranges)
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Partial file left behind: %v", err)
+	}
+}
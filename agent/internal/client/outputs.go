@@ -0,0 +1,274 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+const (
+	// manifestFileName is uploaded next to the output files as {output_prefix}manifest.json
+	manifestFileName = "manifest.json"
+	// The cloud archives the streamed stdout/stderr of the attempt as {output_prefix}stdout.log and stderr.log
+	stdoutLogFileName = "stdout.log"
+	stderrLogFileName = "stderr.log"
+	// maxOutputFiles bounds the files uploaded from one output directory (the cloud rejects larger manifests)
+	maxOutputFiles = 1000
+	// maxRefreshOutputFiles bounds the presigned URLs requested in one RefreshAccess
+	maxRefreshOutputFiles = 100
+)
+
+// outputFile is one regular file of a job's output directory
+type outputFile struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+	path        string // Local path
+}
+
+// outputManifest is the content of manifest.json
+type outputManifest struct {
+	JobID     string       `json:"job_id"`
+	AttemptID int          `json:"attempt_id"`
+	Files     []outputFile `json:"files"`
+}
+
+// collectOutputFiles lists the regular files under dir (recursively, sorted by path) with their
+// OSS keys under prefix, sizes, SHA-256 and content types. Symlinks and other special files are skipped.
+func collectOutputFiles(dir, prefix string) ([]outputFile, error) {
+	var files []outputFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			log.Printf("Skipping non-regular output file %s", path)
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == manifestFileName {
+			return fmt.Errorf("%s is reserved for the output manifest", manifestFileName)
+		}
+		if rel == stdoutLogFileName || rel == stderrLogFileName {
+			return fmt.Errorf("%s is reserved for the archived command output", rel)
+		}
+		if len(files) == maxOutputFiles {
+			return fmt.Errorf("output directory has more than %d files", maxOutputFiles)
+		}
+
+		file, err := describeOutputFile(path)
+		if err != nil {
+			return err
+		}
+		file.Key = prefix + rel
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// describeOutputFile computes the size, SHA-256 and content type of a local file
+func describeOutputFile(path string) (outputFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return outputFile{}, fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	// Sniff the content type from the first 512 bytes if the extension is unknown
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return outputFile{}, fmt.Errorf("failed to read output file: %w", err)
+	}
+	head = head[:n]
+
+	hash := sha256.New()
+	hash.Write(head)
+	rest, err := io.Copy(hash, f)
+	if err != nil {
+		return outputFile{}, fmt.Errorf("failed to read output file: %w", err)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
+	}
+	return outputFile{
+		Size:        int64(n) + rest,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		ContentType: contentType,
+		path:        path,
+	}, nil
+}
+
+// uploadOutputFiles uploads the files of a job's output directory followed by manifest.json
+// and returns the manifest key. With STS credentials every key is signed locally; with presigned
+// access the assigned output_key keeps its URL and the other keys are presigned by the cloud in
+// batches (RefreshAccess.output_files). The manifest key is "" if only output_key was uploaded
+// and the cloud could not presign the manifest.
+func (c *Client) uploadOutputFiles(assigned *control.JobAssigned, assignedAt time.Time, prefix string, files []outputFile) (string, error) {
+	manifestKey := prefix + manifestFileName
+	manifest, err := json.MarshalIndent(outputManifest{
+		JobID:     assigned.JobId,
+		AttemptID: int(assigned.AttemptId),
+		Files:     files,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if assigned.GetOutputUpload().GetSts() != nil {
+		uploader := c.newSTSUploader(assigned)
+		for _, file := range files {
+			if err := c.uploadOutputFile(assigned, file, false, func(body io.ReaderAt, size int64) error {
+				return uploader.Upload(file.Key, file.ContentType, body, size)
+			}); err != nil {
+				return "", err
+			}
+		}
+		if err := uploader.Upload(manifestKey, "application/json", bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+			return "", fmt.Errorf("%s: %w", manifestKey, err)
+		}
+		return manifestKey, nil
+	}
+
+	// Presigned mode: the assigned output_key keeps its URL and is uploaded first
+	var keys []string
+	for _, file := range files {
+		if file.Key == assigned.OutputKey {
+			if err := c.uploadOutputFile(assigned, file, true, func(body io.ReaderAt, size int64) error {
+				return c.uploadJobOutput(assigned, assignedAt, file.Key, file.ContentType, body, size)
+			}); err != nil {
+				return "", err
+			}
+			continue
+		}
+		keys = append(keys, file.Key)
+	}
+
+	urls, err := c.outputFileURLs(assigned, append(keys, manifestKey))
+	if err != nil {
+		if len(keys) == 0 {
+			// Single-file output: the file is uploaded; a cloud without output manifests only gets output_key
+			log.Printf("Skipping manifest for job %s: %v", assigned.JobId, err)
+			return "", nil
+		}
+		return "", err
+	}
+	for _, file := range files {
+		if file.Key == assigned.OutputKey {
+			continue
+		}
+		url := urls[file.Key]
+		if err := c.uploadOutputFile(assigned, file, true, func(body io.ReaderAt, size int64) error {
+			return c.uploadOutput(url, file.ContentType, body, size)
+		}); err != nil {
+			return "", err
+		}
+	}
+	if err := c.uploadOutput(urls[manifestKey], "application/json", bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return "", fmt.Errorf("%s: %w", manifestKey, err)
+	}
+	return manifestKey, nil
+}
+
+// uploadOutputFile streams a local output file to put. With multipart (presigned mode), files of at
+// least multipartThreshold bytes are uploaded in parts instead; put is the fallback if the cloud
+// cannot start a multipart upload.
+func (c *Client) uploadOutputFile(assigned *control.JobAssigned, file outputFile, multipart bool, put func(body io.ReaderAt, size int64) error) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	if multipart && file.Size >= c.multipartThreshold {
+		err := c.uploadMultipart(assigned, file, f)
+		if !errors.Is(err, errMultipartUnavailable) {
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.Key, err)
+			}
+			return nil
+		}
+		log.Printf("Uploading %s with a single PUT: %v", file.Key, err)
+	}
+	if err := put(f, file.Size); err != nil {
+		return fmt.Errorf("%s: %w", file.Key, err)
+	}
+	return nil
+}
+
+// outputFileURLs asks the cloud for presigned PUT URLs for keys under the job's output_prefix,
+// at most maxRefreshOutputFiles per RefreshAccess
+func (c *Client) outputFileURLs(assigned *control.JobAssigned, keys []string) (map[string]string, error) {
+	urls := make(map[string]string, len(keys))
+	for start := 0; start < len(keys); start += maxRefreshOutputFiles {
+		end := start + maxRefreshOutputFiles
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+		ack, err := c.refreshAccess(assigned, &control.RefreshAccess{OutputFiles: batch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to request output file URLs: %w", err)
+		}
+		if !ack.Success {
+			return nil, fmt.Errorf("output file URLs rejected: %s", ack.Message)
+		}
+		for _, key := range batch {
+			url, err := c.getPresignedURL(ack.OutputFileUploads[key], "output file upload")
+			if err != nil {
+				return nil, err
+			}
+			if url == "" {
+				return nil, fmt.Errorf("no upload URL returned for %s", key)
+			}
+			urls[key] = url
+		}
+	}
+	return urls, nil
+}
+
+// outputFilesToProto converts the uploaded files for JobStatus.output_files
+func outputFilesToProto(files []outputFile) []*control.OutputFile {
+	result := make([]*control.OutputFile, 0, len(files))
+	for _, file := range files {
+		result = append(result, outputFileToProto(file))
+	}
+	return result
+}
+
+// outputFileToProto converts an uploaded file for JobStatus (output_files or output)
+func outputFileToProto(file outputFile) *control.OutputFile {
+	return &control.OutputFile{
+		Key:         file.Key,
+		Size:        file.Size,
+		Sha256:      file.SHA256,
+		ContentType: file.ContentType,
+	}
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCollectOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "plots"), 0o755)
+	os.WriteFile(filepath.Join(dir, "output.json"), []byte(`{"ok":true}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "plots", "loss"), []byte("\x89PNG\r\n\x1a\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "empty.txt"), nil, 0o644)
+
+	files, err := collectOutputFiles(dir, "jobs/job-1/1/")
+	if err != nil {
+		t.Fatalf("collectOutputFiles failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %+v", files)
+	}
+	sum := sha256.Sum256([]byte(`{"ok":true}`))
+	want := map[string]outputFile{
+		"jobs/job-1/1/empty.txt":   {Size: 0, ContentType: "text/plain; charset=utf-8"},
+		"jobs/job-1/1/output.json": {Size: 11, SHA256: hex.EncodeToString(sum[:]), ContentType: "application/json"},
+		"jobs/job-1/1/plots/loss":  {Size: 8, ContentType: "image/png"},
+	}
+	for _, f := range files {
+		w, ok := want[f.Key]
+		if !ok || f.Size != w.Size || f.ContentType != w.ContentType || len(f.SHA256) != 64 || (w.SHA256 != "" && f.SHA256 != w.SHA256) {
+			t.Errorf("Unexpected file %+v", f)
+		}
+	}
+
+	// manifest.json is written by the agent and cannot come from the command
+	os.WriteFile(filepath.Join(dir, manifestFileName), []byte("{}"), 0o644)
+	if _, err := collectOutputFiles(dir, "jobs/job-1/1/"); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Expected reserved manifest error, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, manifestFileName))
+
+	// So are the logs archived by the cloud
+	os.WriteFile(filepath.Join(dir, stderrLogFileName), []byte("x"), 0o644)
+	if _, err := collectOutputFiles(dir, "jobs/job-1/1/"); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Expected reserved log error, got %v", err)
+	}
+}
+
+func TestClient_ProcessJob_OutputDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	// Object store: records PUTs by key
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	contentTypes := map[string]string{}
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		mu.Lock()
+		objects[key] = data
+		contentTypes[key] = r.Header.Get("Content-Type")
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer store.Close()
+
+	// Fake cloud: presigns requested output_files and records JobStatus
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	var requested [][]string
+	statuses := make(chan *control.JobStatus, 10)
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope control.Envelope
+			if proto.Unmarshal(data, &envelope) != nil {
+				continue
+			}
+			if status := envelope.GetJobStatus(); status != nil {
+				statuses <- status
+				continue
+			}
+			req := envelope.GetRefreshAccess()
+			if req == nil {
+				continue
+			}
+			mu.Lock()
+			requested = append(requested, req.OutputFiles)
+			mu.Unlock()
+			ack := &control.RefreshAccessAck{JobId: req.JobId, AttemptId: req.AttemptId, Success: true,
+				OutputFileUploads: map[string]*control.OSSAccess{}}
+			for _, key := range req.OutputFiles {
+				ack.OutputFileUploads[key] = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: store.URL + "/" + key}}
+			}
+			reply, _ := proto.Marshal(&control.Envelope{
+				RequestId: envelope.RequestId,
+				Payload:   &control.Envelope_RefreshAccessAck{RefreshAccessAck: ack},
+			})
+			conn.WriteMessage(websocket.BinaryMessage, reply)
+		}
+	}))
+	defer cloud.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(cloud.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.conn = conn
+	client.httpClient = &http.Client{Timeout: 5 * time.Second}
+	go client.readLoop()
+
+	client.processJob(&control.JobAssigned{
+		JobId:        "job-1",
+		AttemptId:    1,
+		LeaseId:      "lease-1",
+		OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: store.URL + "/jobs/job-1/1/output.json"}},
+		OutputPrefix: "jobs/job-1/1/",
+		OutputKey:    "jobs/job-1/1/output.json",
+		Command:      `printf '{"ok":true}' > {output} && mkdir {output_dir}/plots && printf 'a,b\n1,2\n' > {output_dir}/plots/data.csv`,
+		Shell:        true,
+	})
+
+	var final *control.JobStatus
+	for final == nil {
+		select {
+		case status := <-statuses:
+			if status.Status != control.JobStatusEnum_JOB_STATUS_RUNNING {
+				final = status
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for final JobStatus")
+		}
+	}
+	if final.Status != control.JobStatusEnum_JOB_STATUS_SUCCEEDED || final.ManifestKey != "jobs/job-1/1/manifest.json" ||
+		final.OutputKey != "jobs/job-1/1/output.json" || len(final.OutputFiles) != 2 {
+		t.Fatalf("Unexpected final status: %v", final)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Only the keys without an assigned URL were presigned, in one batch
+	if len(requested) != 1 || strings.Join(requested[0], ",") != "jobs/job-1/1/plots/data.csv,jobs/job-1/1/manifest.json" {
+		t.Errorf("Unexpected output_files requests: %v", requested)
+	}
+	if string(objects["jobs/job-1/1/plots/data.csv"]) != "a,b\n1,2\n" || !strings.HasPrefix(contentTypes["jobs/job-1/1/plots/data.csv"], "text/csv") {
+		t.Errorf("Unexpected data.csv upload: %q (%s)", objects["jobs/job-1/1/plots/data.csv"], contentTypes["jobs/job-1/1/plots/data.csv"])
+	}
+
+	var manifest outputManifest
+	if err := json.Unmarshal(objects["jobs/job-1/1/manifest.json"], &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if manifest.JobID != "job-1" || len(manifest.Files) != 2 || manifest.Files[0].Key != "jobs/job-1/1/output.json" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256(objects[f.Key])
+		if f.SHA256 != hex.EncodeToString(sum[:]) || f.Size != int64(len(objects[f.Key])) {
+			t.Errorf("Manifest entry %+v does not match uploaded object", f)
+		}
+	}
+
+	// The primary output is reported with its size and checksum for the cloud to confirm
+	sum := sha256.Sum256([]byte(`{"ok":true}`))
+	if final.Output.GetKey() != "jobs/job-1/1/output.json" || final.Output.GetSize() != 11 || final.Output.GetSha256() != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected output: %v", final.Output)
+	}
+}
@@ -0,0 +1,386 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Command modes of a policy (Policy.Mode)
+const (
+	// PolicyAny runs shell commands, argv commands and templates (the default without a config file)
+	PolicyAny = "any"
+	// PolicyAllowlist runs templates and argv commands whose program is in AllowedPrograms; no shell commands
+	PolicyAllowlist = "allowlist"
+	// PolicyTemplates runs only templates (the default of a config file)
+	PolicyTemplates = "templates"
+)
+
+// reasonPolicyDenied is the JobStatus reason of a job refused by the agent's policy
+const reasonPolicyDenied = "POLICY_DENIED"
+
+// Policy is the agent config file: the job templates the agent runs, which other commands it accepts
+// and where forward jobs may send requests (and the gRPC descriptors they may use)
+type Policy struct {
+	// Mode is PolicyAny, PolicyAllowlist or PolicyTemplates (default: PolicyTemplates)
+	Mode string `json:"mode"`
+
+	// AllowedPrograms lists the programs argv commands may run under PolicyAllowlist (argv[0], compared exactly).
+	// Allowing an interpreter (python, powershell) allows any code it can be given.
+	AllowedPrograms []string `json:"allowed_programs"`
+
+	// AllowedEnv lists the environment variables argv commands may set under PolicyAllowlist (other names are
+	// refused). Variables that change how programs are loaded (PATH, LD_*, DYLD_*, PYTHON*) are never allowed.
+	AllowedEnv []string `json:"allowed_env"`
+
+	// AllowAbsoluteWorkingDir lets jobs set a working_dir outside their work directory (an absolute path) under
+	// PolicyAny. Without it, and without a config file, working_dir must stay under the job's work directory;
+	// under PolicyAllowlist jobs cannot set a working_dir.
+	AllowAbsoluteWorkingDir bool `json:"allow_absolute_working_dir"`
+
+	// Templates maps template names to what they run
+	Templates map[string]*Template `json:"templates"`
+
+	// ForwardTargets lists where forward jobs may send requests (absent: loopback only; empty: nowhere)
+	ForwardTargets []ForwardTarget `json:"forward_targets"`
+
+	// GRPCDescriptorSets lists descriptor set files (protoc --descriptor_set_out) that FORWARD_GRPC methods
+	// are resolved from before trying server reflection; relative paths are relative to the config file
+	GRPCDescriptorSets []string `json:"grpc_descriptor_sets"`
+
+	forwardTargets []*control.ForwardTarget
+	grpcFiles      *protoregistry.Files
+}
+
+// ForwardTarget is a permitted target of forward requests; a URL matches when every set field matches
+type ForwardTarget struct {
+	Scheme     string `json:"scheme"`      // "http" or "https" (empty: both)
+	Host       string `json:"host"`        // Host name or IP; "loopback" for localhost, 127.0.0.0/8 and ::1
+	Port       int    `json:"port"`        // 0: any port
+	PathPrefix string `json:"path_prefix"` // Path prefix on segment boundaries (empty: any path)
+}
+
+// Template is a fixed program and arguments a job can run by name, with parameters checked against a schema
+type Template struct {
+	Description string `json:"description"`
+
+	// Program and Args are run without a shell. Args, Env values and WorkingDir may contain {param:name}
+	// besides the usual placeholders ({input}, {output}, ...); Program may not.
+	Program    string            `json:"program"`
+	Args       []string          `json:"args"`
+	Env        map[string]string `json:"env"`
+	WorkingDir string            `json:"working_dir"`
+
+	// Params declares the parameters a job may pass; any other parameter is refused
+	Params map[string]*TemplateParam `json:"params"`
+}
+
+// TemplateParam is the schema of a template parameter
+type TemplateParam struct {
+	Required bool     `json:"required"` // The job must pass the parameter
+	Default  string   `json:"default"`  // Value when the job does not pass it
+	Pattern  string   `json:"pattern"`  // Regular expression the whole value must match (empty: any value)
+	Values   []string `json:"values"`   // Allowed values (empty: any value)
+
+	pattern *regexp.Regexp
+}
+
+var (
+	templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	paramRefPattern     = regexp.MustCompile(`\{param:([^{}]*)\}`)
+)
+
+// LoadPolicy reads and checks an agent config file (JSON)
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := p.init(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := p.loadDescriptorSets(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// init applies defaults, compiles parameter patterns and checks the templates
+func (p *Policy) init() error {
+	if p.Mode == "" {
+		p.Mode = PolicyTemplates
+	}
+	if p.Mode != PolicyAny && p.Mode != PolicyAllowlist && p.Mode != PolicyTemplates {
+		return fmt.Errorf("mode must be %q, %q or %q", PolicyAny, PolicyAllowlist, PolicyTemplates)
+	}
+	for _, name := range p.AllowedEnv {
+		if loaderEnvName(name) {
+			return fmt.Errorf("allowed_env: %s changes how programs are loaded and cannot be allowed", name)
+		}
+	}
+	for name, t := range p.Templates {
+		if !templateNamePattern.MatchString(name) {
+			return fmt.Errorf("template name %q must match [A-Za-z0-9_.-]{1,64}", name)
+		}
+		if t == nil || t.Program == "" {
+			return fmt.Errorf("template %s: program is required", name)
+		}
+		if paramRefPattern.MatchString(t.Program) {
+			return fmt.Errorf("template %s: program cannot contain {param:name}", name)
+		}
+		for paramName, param := range t.Params {
+			if param == nil {
+				param = &TemplateParam{}
+				t.Params[paramName] = param
+			}
+			if param.Pattern != "" {
+				re, err := regexp.Compile(`^(?:` + param.Pattern + `)$`)
+				if err != nil {
+					return fmt.Errorf("template %s: param %s: invalid pattern: %w", name, paramName, err)
+				}
+				param.pattern = re
+			}
+			if !param.Required {
+				if err := param.check(param.Default); err != nil {
+					return fmt.Errorf("template %s: param %s: default %q %v", name, paramName, param.Default, err)
+				}
+			}
+		}
+		for _, text := range t.texts() {
+			for _, ref := range paramRefPattern.FindAllStringSubmatch(text, -1) {
+				if _, ok := t.Params[ref[1]]; !ok {
+					return fmt.Errorf("template %s: {param:%s} is not declared in params", name, ref[1])
+				}
+			}
+		}
+	}
+
+	if p.ForwardTargets == nil {
+		p.forwardTargets = control.DefaultForwardTargets()
+	} else {
+		p.forwardTargets = make([]*control.ForwardTarget, 0, len(p.ForwardTargets))
+	}
+	for i, target := range p.ForwardTargets {
+		scheme := strings.ToLower(target.Scheme)
+		if scheme != "" && scheme != "http" && scheme != "https" {
+			return fmt.Errorf("forward_targets[%d]: scheme must be http or https", i)
+		}
+		if target.Host == "" || strings.ContainsAny(target.Host, "/*") {
+			return fmt.Errorf("forward_targets[%d]: host is required (a host name, IP or %q)", i, control.LoopbackHost)
+		}
+		if target.Port < 0 || target.Port > 65535 {
+			return fmt.Errorf("forward_targets[%d]: port must be 0-65535", i)
+		}
+		if target.PathPrefix != "" && !strings.HasPrefix(target.PathPrefix, "/") {
+			return fmt.Errorf("forward_targets[%d]: path_prefix must start with /", i)
+		}
+		p.forwardTargets = append(p.forwardTargets, &control.ForwardTarget{
+			Scheme:     scheme,
+			Host:       target.Host,
+			Port:       int32(target.Port),
+			PathPrefix: target.PathPrefix,
+		})
+	}
+	return nil
+}
+
+// Forward returns the targets forward jobs may send requests to (advertised at Register).
+// Without a config file only loopback services are permitted.
+func (p *Policy) Forward() []*control.ForwardTarget {
+	if p == nil {
+		return control.DefaultForwardTargets()
+	}
+	return p.forwardTargets
+}
+
+// checkForward returns why the policy refuses a forward request to rawURL, if it does
+func (p *Policy) checkForward(rawURL string) error {
+	if !control.PermitsForward(p.Forward(), rawURL) {
+		return fmt.Errorf("forward target %s is not permitted on this agent", redactURL(rawURL))
+	}
+	return nil
+}
+
+// texts returns the parts of the template that placeholders are expanded in
+func (t *Template) texts() []string {
+	texts := append([]string{t.WorkingDir}, t.Args...)
+	for _, value := range t.Env {
+		texts = append(texts, value)
+	}
+	return texts
+}
+
+// check reports why a parameter value does not fit the schema
+func (tp *TemplateParam) check(value string) error {
+	if tp.pattern != nil && !tp.pattern.MatchString(value) {
+		return fmt.Errorf("does not match %s", tp.Pattern)
+	}
+	if len(tp.Values) > 0 {
+		for _, allowed := range tp.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("is not one of %q", tp.Values)
+	}
+	return nil
+}
+
+// TemplateNames returns the names of the configured templates, sorted (advertised at Register)
+func (p *Policy) TemplateNames() []string {
+	if p == nil {
+		return nil
+	}
+	names := make([]string, 0, len(p.Templates))
+	for name := range p.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandSpec returns what a command job runs under the policy, or why the policy refuses it.
+// A nil policy accepts any command (PolicyAny without templates).
+func (p *Policy) commandSpec(assigned *control.JobAssigned) (commandSpec, error) {
+	if assigned.Template != "" {
+		if p == nil || p.Templates[assigned.Template] == nil {
+			return commandSpec{}, fmt.Errorf("template %q is not configured on this agent", assigned.Template)
+		}
+		// The template fixes what runs; settings of the job are refused rather than ignored
+		if assigned.Command != "" || len(assigned.Argv) > 0 || len(assigned.Env) > 0 || assigned.WorkingDir != "" {
+			return commandSpec{}, fmt.Errorf("template jobs cannot set command, argv, env or working_dir")
+		}
+		return p.Templates[assigned.Template].spec(assigned.Params)
+	}
+
+	spec := jobCommandSpec(assigned)
+	mode := PolicyAny
+	if p != nil {
+		mode = p.Mode
+	}
+	switch mode {
+	case PolicyTemplates:
+		return commandSpec{}, fmt.Errorf("only job templates are allowed on this agent")
+	case PolicyAllowlist:
+		if len(spec.Argv) == 0 {
+			return commandSpec{}, fmt.Errorf("shell commands are not allowed on this agent (use argv with an allowed program, or a template)")
+		}
+		if !p.allowsProgram(spec.Argv[0]) {
+			return commandSpec{}, fmt.Errorf("program %q is not in the allowlist of this agent", spec.Argv[0])
+		}
+		// Environment and working directory can change what an allowed program runs, so they are limited too
+		for name := range spec.Env {
+			if loaderEnvName(name) || !p.allowsEnv(name) {
+				return commandSpec{}, fmt.Errorf("environment variable %s is not in the allowed_env of this agent", name)
+			}
+		}
+		if spec.WorkingDir != "" {
+			return commandSpec{}, fmt.Errorf("working_dir is not allowed on this agent (use a template)")
+		}
+	}
+	// A command string is interpreted by the shell, which the submitter has to ask for
+	if spec.Command != "" && !assigned.Shell {
+		return commandSpec{}, fmt.Errorf("command runs through a shell, but the job does not set shell (use argv to run a program without a shell)")
+	}
+	if spec.WorkingDir != "" && !relativeWorkingDir(spec.WorkingDir) {
+		if p == nil || !p.AllowAbsoluteWorkingDir {
+			return commandSpec{}, fmt.Errorf("working_dir %q is outside the job's work directory, which is not allowed on this agent", spec.WorkingDir)
+		}
+		spec.AnyWorkingDir = true
+	}
+	return spec, nil
+}
+
+// relativeWorkingDir reports whether a job's working_dir, as sent, stays under the job's work directory.
+// Placeholders are checked again after expansion (see executeCommand).
+func relativeWorkingDir(dir string) bool {
+	if filepath.IsAbs(dir) || filepath.VolumeName(dir) != "" || strings.HasPrefix(dir, "/") || strings.HasPrefix(dir, `\`) {
+		return false
+	}
+	clean := filepath.ToSlash(filepath.Clean(strings.ReplaceAll(dir, `\`, "/")))
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// allowsProgram reports whether an argv command may run program under PolicyAllowlist
+func (p *Policy) allowsProgram(program string) bool {
+	for _, allowed := range p.AllowedPrograms {
+		if program == allowed || runtime.GOOS == "windows" && strings.EqualFold(filepath.Clean(program), filepath.Clean(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsEnv reports whether an argv command may set the environment variable name under PolicyAllowlist
+func (p *Policy) allowsEnv(name string) bool {
+	for _, allowed := range p.AllowedEnv {
+		if name == allowed || runtime.GOOS == "windows" && strings.EqualFold(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// loaderEnvName reports whether an environment variable selects the programs, libraries or modules a
+// process loads (PATH, LD_*, DYLD_*, PYTHON*), compared case-insensitively as on Windows
+func loaderEnvName(name string) bool {
+	upper := strings.ToUpper(name)
+	return upper == "PATH" || strings.HasPrefix(upper, "LD_") || strings.HasPrefix(upper, "DYLD_") || strings.HasPrefix(upper, "PYTHON")
+}
+
+// spec checks a job's parameters against the template and returns the command to run
+func (t *Template) spec(params map[string]string) (commandSpec, error) {
+	for name := range params {
+		if _, ok := t.Params[name]; !ok {
+			return commandSpec{}, fmt.Errorf("unknown template parameter %q", name)
+		}
+	}
+	values := make(map[string]string, len(t.Params))
+	for name, param := range t.Params {
+		value, ok := params[name]
+		if !ok {
+			if param.Required {
+				return commandSpec{}, fmt.Errorf("missing required template parameter %q", name)
+			}
+			value = param.Default
+		} else if err := param.check(value); err != nil {
+			return commandSpec{}, fmt.Errorf("template parameter %s %v", name, err)
+		}
+		values[name] = value
+	}
+	return commandSpec{
+		Argv:          append([]string{t.Program}, t.Args...),
+		Env:           t.Env,
+		WorkingDir:    t.WorkingDir,
+		AnyWorkingDir: true, // Set by the agent's administrator
+		Params:        values,
+	}, nil
+}
+
+// redactURL drops credentials, query and fragment of a URL for messages
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,315 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	control "github.com/xiresource/proto/control"
+)
+
+const testPolicyConfig = `{
+  "mode": "allowlist",
+  "allowed_programs": ["/usr/bin/convert"],
+  "allowed_env": ["MAGICK_THREAD_LIMIT"],
+  "templates": {
+    "resize": {
+      "description": "Resize an image",
+      "program": "/usr/bin/convert",
+      "args": ["{input}", "-resize", "{param:size}", "-quality", "{param:quality}", "{output}"],
+      "params": {
+        "size": {"required": true, "pattern": "[0-9]{1,5}x[0-9]{1,5}"},
+        "quality": {"default": "90", "values": ["75", "90", "100"]}
+      }
+    },
+    "echo": {
+      "program": "printf",
+      "args": ["%s|%s", "{param:text}", "{output}"],
+      "env": {"TEXT": "{param:text}"},
+      "params": {"text": {}}
+    }
+  }
+}`
+
+func writePolicy(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	policy, err := LoadPolicy(writePolicy(t, testPolicyConfig))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if policy.Mode != PolicyAllowlist || !reflect.DeepEqual(policy.TemplateNames(), []string{"echo", "resize"}) {
+		t.Errorf("Policy: mode %q, templates %v", policy.Mode, policy.TemplateNames())
+	}
+	if policy, err := LoadPolicy(writePolicy(t, `{"templates": {}}`)); err != nil || policy.Mode != PolicyTemplates {
+		t.Errorf("Default mode: %v, %v", policy, err)
+	}
+
+	invalid := map[string]string{
+		"unknown field":     `{"mode": "templates", "allow": []}`,
+		"unknown mode":      `{"mode": "open"}`,
+		"template name":     `{"templates": {"a b": {"program": "x"}}}`,
+		"no program":        `{"templates": {"t": {"args": ["x"]}}}`,
+		"param in program":  `{"templates": {"t": {"program": "{param:p}", "params": {"p": {}}}}}`,
+		"undeclared param":  `{"templates": {"t": {"program": "x", "args": ["{param:p}"]}}}`,
+		"invalid pattern":   `{"templates": {"t": {"program": "x", "params": {"p": {"pattern": "("}}}}}`,
+		"default not valid": `{"templates": {"t": {"program": "x", "params": {"p": {"values": ["a"], "default": "b"}}}}}`,
+		"loader env":        `{"mode": "allowlist", "allowed_env": ["OMP_NUM_THREADS", "LD_PRELOAD"]}`,
+		"python env":        `{"mode": "allowlist", "allowed_env": ["PythonPath"]}`,
+	}
+	for name, config := range invalid {
+		if _, err := LoadPolicy(writePolicy(t, config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
+
+func TestPolicy_CommandSpec(t *testing.T) {
+	policy, err := LoadPolicy(writePolicy(t, testPolicyConfig))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	spec, err := policy.commandSpec(&control.JobAssigned{Template: "resize", Params: map[string]string{"size": "640x480"}})
+	if err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	if spec.Argv[0] != "/usr/bin/convert" || len(spec.Argv) != 7 || !reflect.DeepEqual(spec.Params, map[string]string{"size": "640x480", "quality": "90"}) {
+		t.Errorf("resize: argv %q, params %v", spec.Argv, spec.Params)
+	}
+
+	refused := map[string]*control.JobAssigned{
+		"unknown template":  {Template: "train"},
+		"missing param":     {Template: "resize"},
+		"unknown param":     {Template: "resize", Params: map[string]string{"size": "1x1", "extra": "x"}},
+		"pattern mismatch":  {Template: "resize", Params: map[string]string{"size": "1x1; rm -rf /"}},
+		"value not allowed": {Template: "resize", Params: map[string]string{"size": "1x1", "quality": "10"}},
+		"shell command":     {Command: "/usr/bin/convert a b", Shell: true},
+		"other program":     {Argv: []string{"/bin/sh", "-c", "id"}},
+		"env not allowed":   {Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"MAGICK_CONFIGURE_PATH": "/tmp"}},
+		"LD_PRELOAD":        {Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"LD_PRELOAD": "{input}"}},
+		"DYLD_":             {Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"DYLD_INSERT_LIBRARIES": "/tmp/x.dylib"}},
+		"PATH":              {Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"Path": "{output_dir}"}},
+		"PYTHON":            {Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"PYTHONSTARTUP": "{input}"}},
+		"working_dir":       {Argv: []string{"/usr/bin/convert"}, WorkingDir: "work"},
+		"template with env": {Template: "resize", Params: map[string]string{"size": "1x1"}, Env: map[string]string{"MAGICK_THREAD_LIMIT": "1"}},
+		"template with dir": {Template: "resize", Params: map[string]string{"size": "1x1"}, WorkingDir: "{output_dir}"},
+	}
+	for name, assigned := range refused {
+		if _, err := policy.commandSpec(assigned); err == nil {
+			t.Errorf("%s: expected the policy to refuse the job", name)
+		}
+	}
+	if _, err := policy.commandSpec(&control.JobAssigned{Argv: []string{"/usr/bin/convert", "{input}", "{output}"}}); err != nil {
+		t.Errorf("allowlisted program: %v", err)
+	}
+	if spec, err := policy.commandSpec(&control.JobAssigned{Argv: []string{"/usr/bin/convert"}, Env: map[string]string{"MAGICK_THREAD_LIMIT": "4"}}); err != nil || spec.Env["MAGICK_THREAD_LIMIT"] != "4" {
+		t.Errorf("allowed env: %v, %v", spec, err)
+	}
+
+	policy.Mode = PolicyTemplates
+	if _, err := policy.commandSpec(&control.JobAssigned{Argv: []string{"/usr/bin/convert"}}); err == nil {
+		t.Error("templates mode: expected argv commands to be refused")
+	}
+
+	// Without a config file any command runs, but there are no templates
+	var none *Policy
+	if spec, err := none.commandSpec(&control.JobAssigned{Command: "echo hi", Shell: true}); err != nil || spec.Command != "echo hi" {
+		t.Errorf("no policy: %v, %v", spec, err)
+	}
+	if _, err := none.commandSpec(&control.JobAssigned{Template: "resize"}); err == nil {
+		t.Error("no policy: expected templates to be refused")
+	}
+	// ... as long as the job asked for a shell
+	if _, err := none.commandSpec(&control.JobAssigned{Command: "echo hi"}); err == nil {
+		t.Error("no policy: expected a command without shell to be refused")
+	}
+
+	// working_dir stays under the job's work directory unless the policy allows absolute paths
+	absolute := filepath.Join(t.TempDir(), "data")
+	for _, dir := range []string{absolute, "..", "work/../../etc", `..\shared`} {
+		if _, err := none.commandSpec(&control.JobAssigned{Command: "pwd", Shell: true, WorkingDir: dir}); err == nil {
+			t.Errorf("no policy: expected working_dir %q to be refused", dir)
+		}
+	}
+	if spec, err := none.commandSpec(&control.JobAssigned{Command: "pwd", Shell: true, WorkingDir: "work/../src"}); err != nil || spec.AnyWorkingDir {
+		t.Errorf("no policy, relative working_dir: %+v, %v", spec, err)
+	}
+	policy.Mode = PolicyAny
+	policy.AllowAbsoluteWorkingDir = true
+	if spec, err := policy.commandSpec(&control.JobAssigned{Command: "pwd", Shell: true, WorkingDir: absolute}); err != nil || !spec.AnyWorkingDir {
+		t.Errorf("allow_absolute_working_dir: %+v, %v", spec, err)
+	}
+}
+
+func TestExecuteCommand_Template(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses printf")
+	}
+	policy, err := LoadPolicy(writePolicy(t, testPolicyConfig))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	client := New("ws://test", "test-agent", "test-token", 1)
+
+	// Parameter values are single arguments, and placeholders inside them are not expanded
+	spec, err := policy.commandSpec(&control.JobAssigned{Template: "echo", Params: map[string]string{"text": "a b; {output} $(id)"}})
+	if err != nil {
+		t.Fatalf("commandSpec: %v", err)
+	}
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "out")
+	result, err := client.executeCommand(context.Background(), spec, dir, "", nil, outputFile, dir, "", nil, nil)
+	if err != nil {
+		t.Fatalf("executeCommand: %v", err)
+	}
+	if want := "a b; {output} $(id)|" + outputFile; result.Stdout != want {
+		t.Errorf("stdout %q, want %q", result.Stdout, want)
+	}
+}
+
+func TestProcessJob_PolicyDenied(t *testing.T) {
+	policy, err := LoadPolicy(writePolicy(t, `{"mode": "templates"}`))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	client, lc := newLogCloudClient(t, true)
+	client.SetPolicy(policy)
+
+	client.processJob(&control.JobAssigned{JobId: "job-shell", AttemptId: 1, Command: "echo hi", Shell: true})
+
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonPolicyDenied || !strings.Contains(final.Message, "only job templates") {
+		t.Errorf("Final status: %s, reason %q, message %q", final.Status, final.Reason, final.Message)
+	}
+}
+
+func TestPolicy_Forward(t *testing.T) {
+	// Without a config file, or without forward_targets, only loopback services are permitted
+	var none *Policy
+	templatesOnly, err := LoadPolicy(writePolicy(t, `{"mode": "templates"}`))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	for _, policy := range []*Policy{none, templatesOnly} {
+		for _, target := range []string{"http://127.0.0.1:8080/api", "https://localhost/x", "http://[::1]:9000/"} {
+			if err := policy.checkForward(target); err != nil {
+				t.Errorf("%s: %v", target, err)
+			}
+		}
+		for _, target := range []string{"http://10.0.0.5:8080/api", "http://metadata.internal/", "file:///etc/passwd", "http://127.0.0.1.example.com/"} {
+			if err := policy.checkForward(target); err == nil {
+				t.Errorf("%s: expected the target to be refused", target)
+			}
+		}
+	}
+
+	policy, err := LoadPolicy(writePolicy(t, `{"forward_targets": [
+		{"scheme": "http", "host": "127.0.0.1", "port": 8188, "path_prefix": "/prompt"},
+		{"host": "gpu-box.lab"}
+	]}`))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	permitted := []string{"http://127.0.0.1:8188/prompt", "http://127.0.0.1:8188/prompt/run?x=1", "https://GPU-BOX.lab:9443/any"}
+	for _, target := range permitted {
+		if err := policy.checkForward(target); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+	refused := []string{
+		"https://127.0.0.1:8188/prompt",       // scheme
+		"http://127.0.0.1:8080/prompt",        // port
+		"http://127.0.0.1/prompt",             // default port 80
+		"http://127.0.0.1:8188/prompts",       // not on a segment boundary
+		"http://127.0.0.1:8188/prompt/../api", // escapes the prefix
+		"http://localhost:8188/prompt",        // host is compared literally
+	}
+	for _, target := range refused {
+		if err := policy.checkForward(target); err == nil {
+			t.Errorf("%s: expected the target to be refused", target)
+		}
+	}
+	if !reflect.DeepEqual(policy.Forward()[0], &control.ForwardTarget{Scheme: "http", Host: "127.0.0.1", Port: 8188, PathPrefix: "/prompt"}) {
+		t.Errorf("Advertised targets: %v", policy.Forward())
+	}
+
+	// An empty list permits no forward jobs
+	policy, err = LoadPolicy(writePolicy(t, `{"forward_targets": []}`))
+	if err != nil || len(policy.Forward()) != 0 || policy.checkForward("http://127.0.0.1/") == nil {
+		t.Errorf("Empty forward_targets: %v, %v", policy, err)
+	}
+
+	for name, config := range map[string]string{
+		"scheme":      `{"forward_targets": [{"scheme": "ftp", "host": "a"}]}`,
+		"no host":     `{"forward_targets": [{"port": 80}]}`,
+		"port":        `{"forward_targets": [{"host": "a", "port": 70000}]}`,
+		"path prefix": `{"forward_targets": [{"host": "a", "path_prefix": "api"}]}`,
+	} {
+		if _, err := LoadPolicy(writePolicy(t, config)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestProcessForwardJob_PolicyDenied(t *testing.T) {
+	var requests []string
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		http.Redirect(w, r, "/admin", http.StatusFound)
+	}))
+	defer service.Close()
+	port := service.Listener.Addr().(*net.TCPAddr).Port
+	policy, err := LoadPolicy(writePolicy(t, fmt.Sprintf(`{"forward_targets": [{"host": "127.0.0.1", "port": %d, "path_prefix": "/api"}]}`, port)))
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	client, lc := newLogCloudClient(t, true)
+	client.SetPolicy(policy)
+
+	// A blocked target is never contacted
+	client.processJob(&control.JobAssigned{
+		JobId: "job-blocked", AttemptId: 1,
+		JobType:     control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{Url: service.URL + "/admin?token=secret"},
+	})
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonPolicyDenied || strings.Contains(final.Message, "secret") {
+		t.Errorf("Blocked target: %s, reason %q, message %q", final.Status, final.Reason, final.Message)
+	}
+	if len(requests) != 0 {
+		t.Errorf("Blocked target was requested: %v", requests)
+	}
+
+	// A redirect out of the permitted targets is not followed
+	client.processJob(&control.JobAssigned{
+		JobId: "job-redirect", AttemptId: 1,
+		JobType:     control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{Url: service.URL + "/api/run"},
+	})
+	final = lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonPolicyDenied {
+		t.Errorf("Redirected request: %s, reason %q, message %q", final.Status, final.Reason, final.Message)
+	}
+	if !reflect.DeepEqual(requests, []string{"/api/run"}) {
+		t.Errorf("Requests: %v", requests)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package client
+
+import (
+	"os/exec"
+	"time"
+)
+
+// terminateGracefully: there is no graceful terminate on this platform, canceling cmd's context
+// kills the process right away
+func terminateGracefully(cmd *exec.Cmd, grace time.Duration) {
+	cmd.WaitDelay = grace
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+func TestExecuteCommand_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and signals")
+	}
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.terminateGrace = 300 * time.Millisecond
+
+	run := func(command string) (*CommandResult, time.Duration) {
+		t.Helper()
+		dir := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		result, err := client.executeCommand(ctx, commandSpec{Command: command}, dir, "", nil, filepath.Join(dir, "out"), dir, "", nil, nil)
+		if err == nil || result == nil {
+			t.Fatalf("%q: expected a failed result, got %v, %v", command, result, err)
+		}
+		return result, time.Since(start)
+	}
+
+	// SIGTERM ends a well-behaved command
+	result, elapsed := run("echo started; sleep 30")
+	if !result.TimedOut || result.Usage.Signal != "SIGTERM" || result.Stdout != "started\n" || elapsed > 5*time.Second {
+		t.Errorf("Terminated command: timed out %v, signal %q, stdout %q, after %v", result.TimedOut, result.Usage.Signal, result.Stdout, elapsed)
+	}
+
+	// A command ignoring SIGTERM is killed after the grace period, children included
+	result, elapsed = run("trap '' TERM; sleep 30; sleep 30")
+	if !result.TimedOut || result.Usage.Signal != "SIGKILL" || elapsed > 5*time.Second {
+		t.Errorf("Killed command: timed out %v, signal %q, after %v", result.TimedOut, result.Usage.Signal, elapsed)
+	}
+
+	// A failure before the deadline is not a timeout
+	result, _ = run("exit 3")
+	if result.TimedOut {
+		t.Error("Failed command reported as timed out")
+	}
+}
+
+func TestProcessJob_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and signals")
+	}
+	client, lc := newLogCloudClient(t, true)
+	client.terminateGrace = 300 * time.Millisecond
+
+	client.processJob(&control.JobAssigned{JobId: "job-timeout", AttemptId: 1, Command: "sleep 30", Shell: true, TimeoutSec: 1})
+
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonTimedOut || final.Message != "Command timed out after 1s" {
+		t.Errorf("Final status: %s, reason %q, message %q", final.Status, final.Reason, final.Message)
+	}
+	if final.Usage == nil || final.Usage.Signal != "SIGTERM" {
+		t.Errorf("Final status usage: %v", final.Usage)
+	}
+}
+
+func TestProcessForwardJob_Timeout(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer service.Close()
+	client, lc := newLogCloudClient(t, true)
+
+	// Without forward_http.timeout_sec the job's timeout_sec bounds the request
+	client.processJob(&control.JobAssigned{
+		JobId: "job-forward", AttemptId: 1, TimeoutSec: 1,
+		JobType:     control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP,
+		ForwardHttp: &control.ForwardHttpRequest{Url: service.URL},
+	})
+
+	final := lastStatus(t, lc)
+	if final.Status != control.JobStatusEnum_JOB_STATUS_FAILED || final.Reason != reasonTimedOut {
+		t.Errorf("Final status: %s, reason %q, message %q", final.Status, final.Reason, final.Message)
+	}
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and signals")
+	}
+	client, lc := newLogCloudClient(t, true)
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		client.processJob(&control.JobAssigned{JobId: "job-cancel", AttemptId: 1, Command: "sleep 30", Shell: true})
+		close(done)
+	}()
+
+	// Wait for the job to run, then cancel it as the cloud does for an overrunning job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.jobCancelsMu.Lock()
+		_, running := client.jobCancels["job-cancel"]
+		client.jobCancelsMu.Unlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Job did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	client.handleCancelJob(&control.CancelJob{JobId: "job-cancel", AttemptId: 1, Reason: reasonTimedOut})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Canceled job did not stop")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Canceled job took %v", elapsed)
+	}
+	// Only RUNNING was reported: the cloud already ended the job
+	if final := lastStatus(t, lc); final.Status != control.JobStatusEnum_JOB_STATUS_RUNNING {
+		t.Errorf("Status reported after cancel: %s", final.Status)
+	}
+
+	// Unknown jobs are ignored
+	client.handleCancelJob(&control.CancelJob{JobId: "job-unknown"})
+}
+
+// lastStatus waits briefly for the fake cloud to receive the JobStatus messages sent so far and returns the last one
+func lastStatus(t *testing.T, lc *logCloud) *control.JobStatus {
+	t.Helper()
+	time.Sleep(100 * time.Millisecond)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if len(lc.statuses) == 0 {
+		t.Fatal("No JobStatus received")
+	}
+	return lc.statuses[len(lc.statuses)-1]
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package client
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// terminateGracefully makes canceling cmd's context send SIGTERM to the command's process group
+// (the shell and everything it started), then SIGKILL to the group after grace so that children
+// ignoring SIGTERM do not outlive the job.
+func terminateGracefully(cmd *exec.Cmd, grace time.Duration) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Wait returns at the latest a moment after the kill, even if escaped children hold stdout/stderr open
+	cmd.WaitDelay = grace + time.Second
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		time.AfterFunc(grace, func() {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+		return syscall.Kill(-pgid, syscall.SIGTERM)
+	}
+}
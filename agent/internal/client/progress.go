@@ -0,0 +1,431 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// progressInterval: at most one JobProgress per job is sent per interval; the progress file is read as often
+	progressInterval = time.Second
+	// progressPrefix marks stdout lines that report progress ("##progress 40%")
+	progressPrefix = "##progress"
+	// maxProgressLine bounds a progress line, a progress callback body and the tail of the progress file that is read
+	maxProgressLine = 16 << 10
+	// maxProgressMetricsSize bounds the metrics object of one report (the cloud drops larger ones)
+	maxProgressMetricsSize = 4 << 10
+	// progressFileName is the file in the job's work directory that {progress_file} expands to
+	progressFileName = "progress"
+)
+
+// progressReport is the JSON form of a progress report (a ##progress line, the progress file, or a callback body)
+type progressReport struct {
+	Percent     *float64        `json:"percent"`
+	CurrentStep int             `json:"current_step"`
+	TotalSteps  int             `json:"total_steps"`
+	Message     string          `json:"message"`
+	Metrics     json.RawMessage `json:"metrics"`
+}
+
+// parseProgress parses a progress report. Accepted forms:
+//   - a JSON object: {"percent": 40, "current_step": 2, "total_steps": 5, "message": "...", "metrics": {...}}
+//   - a percentage, optionally followed by a message: "40", "40% loading data"
+//   - steps, optionally followed by a message: "2/5 epoch 2"
+//
+// Without a percentage, the percentage is derived from the steps.
+func parseProgress(payload string) (*control.JobProgress, error) {
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return nil, fmt.Errorf("empty progress")
+	}
+
+	var report progressReport
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &report); err != nil {
+			return nil, fmt.Errorf("invalid progress JSON: %w", err)
+		}
+	} else {
+		value, message, _ := strings.Cut(payload, " ")
+		report.Message = strings.TrimSpace(message)
+		if cur, total, ok := strings.Cut(value, "/"); ok {
+			var err error
+			if report.CurrentStep, err = strconv.Atoi(cur); err != nil {
+				return nil, fmt.Errorf("invalid current step %q", cur)
+			}
+			if report.TotalSteps, err = strconv.Atoi(total); err != nil {
+				return nil, fmt.Errorf("invalid total steps %q", total)
+			}
+		} else {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid percent %q", value)
+			}
+			report.Percent = &percent
+		}
+	}
+
+	if report.CurrentStep < 0 || report.TotalSteps < 0 || (report.TotalSteps > 0 && report.CurrentStep > report.TotalSteps) {
+		return nil, fmt.Errorf("invalid steps %d/%d", report.CurrentStep, report.TotalSteps)
+	}
+	var percent float64
+	switch {
+	case report.Percent != nil:
+		percent = *report.Percent
+	case report.TotalSteps > 0:
+		percent = float64(report.CurrentStep) * 100 / float64(report.TotalSteps)
+	default:
+		return nil, fmt.Errorf("progress needs a percent or steps")
+	}
+	if math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("percent %v out of range 0-100", percent)
+	}
+
+	progress := &control.JobProgress{
+		Percent:     percent,
+		CurrentStep: int32(report.CurrentStep),
+		TotalSteps:  int32(report.TotalSteps),
+		Message:     sanitizeUTF8(truncateString(report.Message, 1000)),
+	}
+	if metrics := bytes.TrimSpace(report.Metrics); len(metrics) > 0 && !bytes.Equal(metrics, []byte("null")) {
+		if metrics[0] != '{' {
+			return nil, fmt.Errorf("metrics must be a JSON object")
+		}
+		if len(metrics) > maxProgressMetricsSize {
+			return nil, fmt.Errorf("metrics exceed %d bytes", maxProgressMetricsSize)
+		}
+		progress.MetricsJson = string(metrics)
+	}
+	return progress, nil
+}
+
+// progressReporter sends the progress of a running job attempt to the cloud as JobProgress messages,
+// at most one per progressInterval: a report within the interval replaces the pending one and is sent
+// when the interval has passed. close sends the last pending report.
+type progressReporter struct {
+	c         *Client
+	jobID     string
+	attemptID int32
+	token     string // Path of the local progress callback ("" until callbackURL is called)
+
+	mu       sync.Mutex
+	pending  *control.JobProgress
+	lastSent time.Time
+	timer    *time.Timer
+	closed   bool
+
+	stopWatch chan struct{} // Closed by close(): stops the progress file watcher
+	watchDone chan struct{} // Closed when the watcher exits (nil without a watcher)
+}
+
+// startProgress starts reporting the progress of a job attempt.
+// Returns nil (a no-op reporter) if the agent is not connected.
+func (c *Client) startProgress(jobID string, attemptID int) *progressReporter {
+	if c.conn == nil {
+		return nil
+	}
+	return &progressReporter{
+		c:         c,
+		jobID:     jobID,
+		attemptID: int32(attemptID),
+		stopWatch: make(chan struct{}),
+	}
+}
+
+// report queues a progress report (sent immediately if none was sent within progressInterval). Nil-safe.
+func (p *progressReporter) report(progress *control.JobProgress) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	progress.AgentId = p.c.agentID
+	progress.JobId = p.jobID
+	progress.AttemptId = p.attemptID
+	p.pending = progress
+
+	wait := progressInterval - time.Since(p.lastSent)
+	if wait <= 0 {
+		p.sendPending()
+		return
+	}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(wait, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.timer = nil
+			if !p.closed {
+				p.sendPending()
+			}
+		})
+	}
+}
+
+// sendPending sends the pending report (p.mu must be held)
+func (p *progressReporter) sendPending() {
+	progress := p.pending
+	if progress == nil {
+		return
+	}
+	p.pending = nil
+	p.lastSent = time.Now()
+
+	data, err := proto.Marshal(&control.Envelope{
+		AgentId:   p.c.agentID,
+		RequestId: generateRequestID(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   &control.Envelope_JobProgress{JobProgress: progress},
+	})
+	if err == nil {
+		err = p.c.writeMessage(data)
+	}
+	if err != nil {
+		log.Printf("Failed to send progress of job %s: %v", p.jobID, err)
+	}
+}
+
+// close stops the progress file watcher and the local callback, then sends the last pending report.
+// Must be called before the job's final JobStatus. Nil-safe; later calls do nothing.
+func (p *progressReporter) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	// The watcher reads the file once more before it exits
+	close(p.stopWatch)
+	if p.watchDone != nil {
+		<-p.watchDone
+	}
+	if p.token != "" {
+		p.c.progressMu.Lock()
+		delete(p.c.progressCallbacks, p.token)
+		p.c.progressMu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.sendPending()
+}
+
+// reportLine parses one progress report and queues it; invalid reports are logged and ignored
+func (p *progressReporter) reportLine(source, payload string) {
+	progress, err := parseProgress(payload)
+	if err != nil {
+		log.Printf("Ignoring progress of job %s from %s: %v", p.jobID, source, err)
+		return
+	}
+	p.report(progress)
+}
+
+// writer returns an io.Writer that reports the command's "##progress" stdout lines; nil-safe
+func (p *progressReporter) writer() io.Writer {
+	if p == nil {
+		return io.Discard
+	}
+	return &progressLineWriter{p: p}
+}
+
+// progressLineWriter splits stdout into lines and reports those with progressPrefix.
+// Lines longer than maxProgressLine are skipped.
+type progressLineWriter struct {
+	p    *progressReporter
+	line []byte
+	skip bool // The current line exceeded maxProgressLine
+}
+
+func (w *progressLineWriter) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		part := data
+		if i >= 0 {
+			part = data[:i]
+		}
+		if !w.skip {
+			if len(w.line)+len(part) > maxProgressLine {
+				w.line, w.skip = w.line[:0], true
+			} else {
+				w.line = append(w.line, part...)
+			}
+		}
+		if i < 0 {
+			break
+		}
+		if !w.skip {
+			line := strings.TrimRight(string(w.line), "\r")
+			if payload, ok := strings.CutPrefix(line, progressPrefix); ok && (payload == "" || payload[0] == ' ' || payload[0] == '\t') {
+				w.p.reportLine("stdout", payload)
+			}
+		}
+		w.line, w.skip = w.line[:0], false
+		data = data[i+1:]
+	}
+	return n, nil
+}
+
+// watchFile reports the last non-empty line of path every progressInterval while it changes,
+// and once more when the reporter is closed. Nil-safe; call at most once.
+func (p *progressReporter) watchFile(path string) {
+	if p == nil {
+		return
+	}
+	p.watchDone = make(chan struct{})
+	go func() {
+		defer close(p.watchDone)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		var last string
+		read := func() {
+			line, err := lastProgressLine(path)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("Failed to read progress file of job %s: %v", p.jobID, err)
+				}
+				return
+			}
+			if line != "" && line != last {
+				last = line
+				p.reportLine("progress file", line)
+			}
+		}
+		for {
+			select {
+			case <-ticker.C:
+				read()
+			case <-p.stopWatch:
+				read()
+				return
+			}
+		}
+	}()
+}
+
+// lastProgressLine returns the last non-empty line within the final maxProgressLine bytes of a file
+func lastProgressLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - maxProgressLine
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n\t "), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
+// callbackURL returns the local URL the job's service POSTs progress reports to
+// (http://127.0.0.1:{port}/progress/{token}); the callback server is started on first use.
+// Returns "" for a nil reporter or if the server cannot be started.
+func (p *progressReporter) callbackURL() string {
+	if p == nil {
+		return ""
+	}
+	c := p.c
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	addr := c.callbackServerAddr()
+	if addr == "" {
+		return ""
+	}
+	if p.token == "" {
+		p.token = randomHex(16)
+		c.progressCallbacks[p.token] = p
+	}
+	return "http://" + addr + "/progress/" + p.token
+}
+
+// callbackServerAddr returns the address of the local callback server of forward jobs (progress
+// reports and task statuses), starting it on first use; "" if it cannot be started.
+// The caller holds c.progressMu.
+func (c *Client) callbackServerAddr() string {
+	if c.progressAddr == "" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Printf("Failed to start callback server: %v", err)
+			return ""
+		}
+		c.progressAddr = listener.Addr().String()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/progress/", c.handleProgressCallback)
+		mux.HandleFunc("/task/", c.handleTaskCallback)
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go server.Serve(listener)
+		log.Printf("Callback server listening on %s", c.progressAddr)
+	}
+	return c.progressAddr
+}
+
+// handleProgressCallback handles POST /progress/{token} from a forward job's service.
+// The body is a progress report in any form accepted by parseProgress.
+func (c *Client) handleProgressCallback(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, "/progress/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.progressMu.Lock()
+	p := c.progressCallbacks[token]
+	c.progressMu.Unlock()
+	if p == nil {
+		http.Error(w, "Unknown or finished job", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxProgressLine+1))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxProgressLine {
+		http.Error(w, "Progress report too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	progress, err := parseProgress(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.report(progress)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+func (lc *logCloud) receivedProgress() []*control.JobProgress {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return append([]*control.JobProgress(nil), lc.progress...)
+}
+
+// waitForProgress waits until the fake cloud received n JobProgress messages
+func waitForProgress(t *testing.T, lc *logCloud, n int) []*control.JobProgress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if progress := lc.receivedProgress(); len(progress) >= n {
+			return progress
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Got %d progress reports, want %d", len(lc.receivedProgress()), n)
+	return nil
+}
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    *control.JobProgress
+	}{
+		{"40", &control.JobProgress{Percent: 40}},
+		{" 12.5% loading data ", &control.JobProgress{Percent: 12.5, Message: "loading data"}},
+		{"2/5 epoch 2", &control.JobProgress{Percent: 40, CurrentStep: 2, TotalSteps: 5, Message: "epoch 2"}},
+		{`{"current_step": 1, "total_steps": 4, "metrics": {"loss": 0.31}}`,
+			&control.JobProgress{Percent: 25, CurrentStep: 1, TotalSteps: 4, MetricsJson: `{"loss": 0.31}`}},
+		{`{"percent": 90, "current_step": 1, "total_steps": 4, "message": "eval"}`,
+			&control.JobProgress{Percent: 90, CurrentStep: 1, TotalSteps: 4, Message: "eval"}},
+	}
+	for _, tt := range tests {
+		got, err := parseProgress(tt.payload)
+		if err != nil {
+			t.Errorf("parseProgress(%q) failed: %v", tt.payload, err)
+			continue
+		}
+		if got.Percent != tt.want.Percent || got.CurrentStep != tt.want.CurrentStep || got.TotalSteps != tt.want.TotalSteps ||
+			got.Message != tt.want.Message || got.MetricsJson != tt.want.MetricsJson {
+			t.Errorf("parseProgress(%q) = %+v, want %+v", tt.payload, got, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"", "abc", "101", "-1%", "NaN", "5/4", "x/4", "1/y",
+		`{"message": "no percent or steps"}`,
+		`{"percent": 10, "metrics": [1, 2]}`,
+		`{"percent": 10, "metrics": {"x": "` + strings.Repeat("a", maxProgressMetricsSize) + `"}}`,
+		`{"percent": 10`,
+	}
+	for _, payload := range invalid {
+		if got, err := parseProgress(payload); err == nil {
+			t.Errorf("parseProgress(%q) = %+v, want error", payload, got)
+		}
+	}
+}
+
+func TestProgressReporter_Throttles(t *testing.T) {
+	client, lc := newLogCloudClient(t, true)
+
+	progress := client.startProgress("job-1", 2)
+	progress.report(&control.JobProgress{Percent: 10})
+	progress.report(&control.JobProgress{Percent: 20})
+	progress.report(&control.JobProgress{Percent: 30})
+
+	// The first report is sent at once, the latest one after progressInterval
+	got := waitForProgress(t, lc, 1)
+	if got[0].Percent != 10 || got[0].JobId != "job-1" || got[0].AttemptId != 2 || got[0].AgentId != "test-agent" {
+		t.Errorf("First report = %+v", got[0])
+	}
+	time.Sleep(progressInterval / 2)
+	if n := len(lc.receivedProgress()); n != 1 {
+		t.Errorf("Got %d reports within progressInterval, want 1", n)
+	}
+	got = waitForProgress(t, lc, 2)
+	if got[1].Percent != 30 {
+		t.Errorf("Second report = %+v, want the latest (30%%)", got[1])
+	}
+
+	// close sends the pending report without waiting
+	progress.report(&control.JobProgress{Percent: 40})
+	progress.close()
+	got = waitForProgress(t, lc, 3)
+	if got[2].Percent != 40 {
+		t.Errorf("Final report = %+v", got[2])
+	}
+	progress.report(&control.JobProgress{Percent: 50})
+	time.Sleep(100 * time.Millisecond)
+	if n := len(lc.receivedProgress()); n != 3 {
+		t.Errorf("Report sent after close")
+	}
+}
+
+func TestExecuteCommand_Progress(t *testing.T) {
+	client, lc := newLogCloudClient(t, true)
+	workDir := t.TempDir()
+	progressFile := filepath.Join(workDir, progressFileName)
+
+	progress := client.startProgress("job-1", 1)
+	progress.watchFile(progressFile)
+	command := `echo "##progress 1/4 loading"; echo "##progressive output"; sleep 1.5; ` +
+		`echo '{"percent": 75, "metrics": {"loss": 0.5}}' >> {progress_file}`
+	result, err := client.executeCommand(context.Background(), commandSpec{Command: command}, workDir, "", nil, filepath.Join(workDir, "out"), workDir, progressFile, nil, progress)
+	if err != nil {
+		t.Fatalf("executeCommand failed: %v", err)
+	}
+	progress.close()
+	if !strings.Contains(result.Stdout, "##progress 1/4 loading") {
+		t.Errorf("Stdout = %q, want progress lines kept", result.Stdout)
+	}
+
+	got := waitForProgress(t, lc, 2)
+	if got[0].Percent != 25 || got[0].CurrentStep != 1 || got[0].TotalSteps != 4 || got[0].Message != "loading" {
+		t.Errorf("Report from stdout = %+v", got[0])
+	}
+	if got[1].Percent != 75 || got[1].MetricsJson != `{"loss": 0.5}` {
+		t.Errorf("Report from progress file = %+v", got[1])
+	}
+	if len(got) != 2 {
+		t.Errorf("Got %d reports, want 2", len(got))
+	}
+}
+
+func TestProgressCallback(t *testing.T) {
+	client, lc := newLogCloudClient(t, true)
+
+	progress := client.startProgress("job-1", 1)
+	callbackURL := progress.callbackURL()
+	if !strings.HasPrefix(callbackURL, "http://127.0.0.1:") {
+		t.Fatalf("callbackURL = %q, want a loopback URL", callbackURL)
+	}
+
+	post := func(url, body string) int {
+		t.Helper()
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post(callbackURL, `{"current_step": 3, "total_steps": 4, "message": "step 3"}`); status != http.StatusNoContent {
+		t.Errorf("POST status = %d, want 204", status)
+	}
+	if got := waitForProgress(t, lc, 1); got[0].Percent != 75 || got[0].Message != "step 3" {
+		t.Errorf("Report from callback = %+v", got[0])
+	}
+	if status := post(callbackURL, "150%"); status != http.StatusBadRequest {
+		t.Errorf("Invalid report: status %d, want 400", status)
+	}
+	if status := post(callbackURL[:strings.LastIndex(callbackURL, "/")+1]+"unknown", "50"); status != http.StatusNotFound {
+		t.Errorf("Unknown token: status %d, want 404", status)
+	}
+	resp, err := http.Get(callbackURL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", resp.StatusCode)
+	}
+
+	// The callback ends with the job
+	progress.close()
+	if status := post(callbackURL, "50"); status != http.StatusNotFound {
+		t.Errorf("After close: status %d, want 404", status)
+	}
+}
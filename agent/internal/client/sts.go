@@ -0,0 +1,346 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+const (
+	// stsRefreshMargin: STS credentials expiring sooner than this are refreshed before an upload
+	stsRefreshMargin = 2 * time.Minute
+	// cosSignatureTTL bounds how long a signed COS request stays valid
+	cosSignatureTTL = 10 * time.Minute
+)
+
+// stsUploader uploads job outputs with STS credentials scoped to the job's output_prefix.
+// It can upload any number of objects under the prefix and refreshes the credentials
+// through RefreshAccess shortly before expires_at_ms.
+type stsUploader struct {
+	client   *Client
+	assigned *control.JobAssigned
+	creds    *control.STSCreds
+}
+
+func (c *Client) newSTSUploader(assigned *control.JobAssigned) *stsUploader {
+	return &stsUploader{
+		client:   c,
+		assigned: assigned,
+		creds:    assigned.GetOutputUpload().GetSts(),
+	}
+}
+
+// credentials returns credentials valid for at least stsRefreshMargin, refreshing them if needed
+func (u *stsUploader) credentials() (*control.STSCreds, error) {
+	expiresAt := time.UnixMilli(u.creds.ExpiresAtMs)
+	if time.Until(expiresAt) > stsRefreshMargin {
+		return u.creds, nil
+	}
+
+	ack, err := u.client.refreshAccess(u.assigned, &control.RefreshAccess{Output: true})
+	if err != nil {
+		if time.Now().Before(expiresAt) {
+			log.Printf("Failed to refresh STS credentials for job %s, using current ones: %v", u.assigned.JobId, err)
+			return u.creds, nil
+		}
+		return nil, fmt.Errorf("STS credentials expired and refresh failed: %w", err)
+	}
+	if !ack.Success {
+		return nil, fmt.Errorf("output_upload refresh rejected: %s", ack.Message)
+	}
+	fresh := ack.GetOutputUpload().GetSts()
+	if fresh == nil {
+		return nil, fmt.Errorf("output_upload refresh did not return STS credentials")
+	}
+	log.Printf("Refreshed STS credentials for job %s", u.assigned.JobId)
+	u.creds = fresh
+	return fresh, nil
+}
+
+// Upload uploads size bytes of body to key, which must be under the job's output_prefix.
+// Files of at least multipartThreshold bytes are uploaded with a COS multipart upload
+// (a single PUT is limited to 5GB); smaller ones are streamed in a single PUT.
+func (u *stsUploader) Upload(key, contentType string, body io.ReaderAt, size int64) error {
+	prefix := u.assigned.OutputPrefix
+	if prefix == "" {
+		return fmt.Errorf("STS output_upload requires output_prefix")
+	}
+	if !strings.HasPrefix(key, prefix) || strings.Contains(key, "..") {
+		return fmt.Errorf("key %s is outside output_prefix %s", key, prefix)
+	}
+	if size >= u.client.multipartThreshold {
+		return u.uploadMultipart(key, contentType, body, size)
+	}
+
+	resp, err := u.do(http.MethodPut, key, nil, contentType, io.NewSectionReader(body, 0, size), size)
+	if err != nil {
+		return fmt.Errorf("HTTP PUT failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("HTTP PUT returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// uploadMultipart uploads a file in parts of multipartPartSizeFor(size) with the COS XML API:
+// initiate the upload, PUT the parts with retries and complete it from the part ETags.
+// An upload that fails is aborted, so that its parts are not kept (and billed) by COS.
+func (u *stsUploader) uploadMultipart(key, contentType string, body io.ReaderAt, size int64) error {
+	resp, err := u.do(http.MethodPost, key, url.Values{"uploads": {""}}, contentType, nil, 0)
+	if err != nil {
+		return fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeCOSResponse(resp, &initiated)
+	if err == nil && initiated.UploadID == "" {
+		err = fmt.Errorf("no UploadId returned")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+
+	if err := u.uploadParts(key, initiated.UploadID, body, size); err != nil {
+		u.abortMultipart(key, initiated.UploadID)
+		return err
+	}
+	return nil
+}
+
+// abortMultipart discards an upload that is given up on
+func (u *stsUploader) abortMultipart(key, uploadID string) {
+	resp, err := u.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, "", nil, 0)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("HTTP DELETE returned status %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to abort multipart upload of %s: %v", key, err)
+	}
+}
+
+// cosCompletedPart is a part of a CompleteMultipartUpload request
+type cosCompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadParts uploads all parts of an initiated upload and completes it
+func (u *stsUploader) uploadParts(key, uploadID string, body io.ReaderAt, size int64) error {
+	partSize := u.client.multipartPartSizeFor(size)
+	partCount := int((size + partSize - 1) / partSize)
+	parts := make([]cosCompletedPart, 0, partCount)
+	for n := 1; n <= partCount; n++ {
+		offset := int64(n-1) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		etag, err := u.uploadPart(key, uploadID, n, body, offset, length)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", n, err)
+		}
+		parts = append(parts, cosCompletedPart{PartNumber: n, ETag: etag})
+	}
+
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name           `xml:"CompleteMultipartUpload"`
+		Parts   []cosCompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("failed to encode part list: %w", err)
+	}
+	resp, err := u.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, "application/xml", bytes.NewReader(complete), int64(len(complete)))
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	if err := decodeCOSResponse(resp, nil); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	log.Printf("Uploaded %s in %d part(s)", key, partCount)
+	return nil
+}
+
+// uploadPart PUTs one part (length bytes at offset) and returns its ETag.
+// Network errors and 5xx responses are retried with a growing delay, each attempt signed anew.
+func (u *stsUploader) uploadPart(key, uploadID string, n int, body io.ReaderAt, offset, length int64) (string, error) {
+	params := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	var lastErr error
+	for attempt := 1; attempt <= maxTransferAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * u.client.transferRetryDelay)
+		}
+		resp, err := u.do(http.MethodPut, key, params, "", io.NewSectionReader(body, offset, length), length)
+		if err != nil {
+			lastErr = fmt.Errorf("HTTP PUT failed: %w", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("HTTP PUT returned status %d", resp.StatusCode)
+			if resp.StatusCode < 500 {
+				return "", lastErr
+			}
+			continue
+		}
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			return "", fmt.Errorf("part upload returned no ETag")
+		}
+		return etag, nil
+	}
+	return "", fmt.Errorf("%w (after %d attempts)", lastErr, maxTransferAttempts)
+}
+
+// do sends a COS request for key signed with current credentials (refreshed if needed)
+func (u *stsUploader) do(method, key string, params url.Values, contentType string, body io.Reader, length int64) (*http.Response, error) {
+	creds, err := u.credentials()
+	if err != nil {
+		return nil, err
+	}
+	objectURL, err := cosObjectURL(creds, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) > 0 {
+		objectURL += "?" + params.Encode()
+	}
+
+	if length == 0 {
+		// An empty body must not be sent chunked
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, objectURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = length
+	signCOSRequest(req, creds, time.Now())
+	return u.client.httpClient.Do(req)
+}
+
+// decodeCOSResponse checks a COS XML API response and decodes its body into v (if not nil)
+func decodeCOSResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncateString(string(data), 500))
+	}
+	// COS may answer a CompleteMultipartUpload with 200 and an <Error> body
+	var cosErr struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &cosErr) == nil && cosErr.XMLName.Local == "Error" {
+		return fmt.Errorf("%s: %s", cosErr.Code, cosErr.Message)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// cosObjectURL builds the object URL from STS credentials.
+// endpoint is normally a host such as "cos.ap-beijing.myqcloud.com" (URL: https://{bucket}.{endpoint}/{key});
+// an endpoint with a scheme is used as the bucket's base URL as-is (e.g., a local test server).
+func cosObjectURL(creds *control.STSCreds, key string) (string, error) {
+	if creds.Endpoint == "" {
+		return "", fmt.Errorf("STS credentials have no endpoint")
+	}
+	base := creds.Endpoint
+	if !strings.Contains(base, "://") {
+		if creds.Bucket == "" {
+			return "", fmt.Errorf("STS credentials have no bucket")
+		}
+		base = "https://" + creds.Bucket + "." + base
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid STS endpoint: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	return u.String(), nil
+}
+
+// signCOSRequest adds a COS (XML API) Authorization header and the STS security token to req.
+// The signature covers the method, path, query parameters, Host and Content-Length
+// (unless no Content-Length is sent: a bodiless DELETE).
+func signCOSRequest(req *http.Request, creds *control.STSCreds, now time.Time) {
+	keyTime := fmt.Sprintf("%d;%d", now.Add(-time.Minute).Unix(), now.Add(cosSignatureTTL).Unix())
+	params := make(map[string]string)
+	for name, values := range req.URL.Query() {
+		params[strings.ToLower(name)] = values[0]
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	if req.ContentLength > 0 || req.Method == http.MethodPut || req.Method == http.MethodPost {
+		headers["content-length"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	signature := cosSignature(creds.AccessKeySecret, keyTime, req.Method, req.URL.Path, params, headers)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"q-sign-algorithm=sha1&q-ak=%s&q-sign-time=%s&q-key-time=%s&q-header-list=%s&q-url-param-list=%s&q-signature=%s",
+		creds.AccessKeyId, keyTime, keyTime, strings.Join(sortedKeys(headers), ";"), strings.Join(sortedKeys(params), ";"), signature))
+	req.Header.Set("x-cos-security-token", creds.SecurityToken)
+}
+
+// cosSignature computes the COS request signature for the given lowercase query parameters and headers
+func cosSignature(secretKey, keyTime, method, path string, params, headers map[string]string) string {
+	signKey := hex.EncodeToString(hmacSHA1([]byte(secretKey), keyTime))
+	httpString := strings.ToLower(method) + "\n" + path + "\n" + cosSignedPairs(params) + "\n" + cosSignedPairs(headers) + "\n"
+	httpStringHash := sha1.Sum([]byte(httpString))
+	stringToSign := "sha1\n" + keyTime + "\n" + hex.EncodeToString(httpStringHash[:]) + "\n"
+	return hex.EncodeToString(hmacSHA1([]byte(signKey), stringToSign))
+}
+
+// cosSignedPairs formats signed parameters or headers as "name=value" pairs sorted by name
+func cosSignedPairs(values map[string]string) string {
+	names := sortedKeys(values)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+url.QueryEscape(values[name]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hmacSHA1(key []byte, data string) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
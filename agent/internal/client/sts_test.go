@@ -0,0 +1,245 @@
+package client
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	control "github.com/xiresource/proto/control"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCOS verifies COS signatures made with the STS credentials it knows and stores uploaded objects.
+// It supports single PUTs and multipart uploads (initiate, part, complete, abort).
+type fakeCOS struct {
+	mu       sync.Mutex
+	secrets  map[string]string // access key ID -> secret
+	tokens   map[string]string // access key ID -> security token
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte // upload ID -> part number -> data
+	aborted  int
+	failPart int // if set, uploads of this part number fail with 403
+}
+
+func (f *fakeCOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Authorization values contain ';', which url.ParseQuery rejects
+	params := url.Values{}
+	for _, pair := range strings.Split(r.Header.Get("Authorization"), "&") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			params.Set(k, v)
+		}
+	}
+	// Content-Length is signed whenever it is sent
+	headerList := "host"
+	if r.Header.Get("Content-Length") != "" {
+		headerList = "content-length;host"
+	}
+	if params.Get("q-sign-algorithm") != "sha1" || params.Get("q-header-list") != headerList {
+		http.Error(w, "bad authorization", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ak := params.Get("q-ak")
+	secret, ok := f.secrets[ak]
+	if !ok || f.tokens[ak] != r.Header.Get("x-cos-security-token") {
+		http.Error(w, "unknown credentials", http.StatusForbidden)
+		return
+	}
+	query := map[string]string{}
+	for name, values := range r.URL.Query() {
+		query[strings.ToLower(name)] = values[0]
+	}
+	headers := map[string]string{"host": r.Host}
+	if length := r.Header.Get("Content-Length"); length != "" {
+		headers["content-length"] = length
+	}
+	want := cosSignature(secret, params.Get("q-key-time"), r.Method, r.URL.Path, query, headers)
+	if params.Get("q-signature") != want || params.Get("q-url-param-list") != strings.Join(sortedKeys(query), ";") {
+		http.Error(w, "signature mismatch", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	data, _ := io.ReadAll(r.Body)
+	uploadID := r.URL.Query().Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+		uploadID = fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, uploadID)
+	case r.Method == http.MethodPut && uploadID != "":
+		n, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if f.uploads[uploadID] == nil || n == f.failPart {
+			http.Error(w, "part rejected", http.StatusForbidden)
+			return
+		}
+		f.uploads[uploadID][n] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(data, &complete)
+		var object []byte
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>bad part list</Message></Error>")
+				return
+			}
+			object = append(object, f.uploads[uploadID][part.PartNumber]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, uploadID)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>", key)
+	case r.Method == http.MethodDelete && uploadID != "":
+		f.aborted++
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.objects[key] = data
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestClient_UploadJobOutput_STS(t *testing.T) {
+	cos := &fakeCOS{
+		secrets: map[string]string{"ak-old": "secret-old", "ak-new": "secret-new"},
+		tokens:  map[string]string{"ak-old": "token-old", "ak-new": "token-new"},
+		objects: map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+	cosServer := httptest.NewServer(cos)
+	defer cosServer.Close()
+
+	// Fake cloud answers RefreshAccess with new credentials
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	var refreshes int
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope control.Envelope
+			if proto.Unmarshal(data, &envelope) != nil || envelope.GetRefreshAccess() == nil {
+				continue
+			}
+			refreshes++
+			reply, _ := proto.Marshal(&control.Envelope{
+				RequestId: envelope.RequestId,
+				Payload: &control.Envelope_RefreshAccessAck{RefreshAccessAck: &control.RefreshAccessAck{
+					Success:   true,
+					OutputKey: "jobs/job-1/1/output.bin",
+					OutputUpload: &control.OSSAccess{Auth: &control.OSSAccess_Sts{Sts: &control.STSCreds{
+						AccessKeyId: "ak-new", AccessKeySecret: "secret-new", SecurityToken: "token-new",
+						Endpoint: cosServer.URL, Bucket: "bucket", ExpiresAtMs: time.Now().Add(time.Hour).UnixMilli(),
+					}}},
+				}},
+			})
+			conn.WriteMessage(websocket.BinaryMessage, reply)
+		}
+	}))
+	defer cloud.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(cloud.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	client := New("ws://test", "test-agent", "test-token", 1)
+	client.conn = conn
+	go client.readLoop()
+
+	stsAccess := func(expiresAt time.Time) *control.OSSAccess {
+		return &control.OSSAccess{Auth: &control.OSSAccess_Sts{Sts: &control.STSCreds{
+			AccessKeyId: "ak-old", AccessKeySecret: "secret-old", SecurityToken: "token-old",
+			Endpoint: cosServer.URL, Bucket: "bucket", ExpiresAtMs: expiresAt.UnixMilli(),
+		}}}
+	}
+	assigned := &control.JobAssigned{
+		JobId:        "job-1",
+		AttemptId:    1,
+		LeaseId:      "lease-1",
+		OutputUpload: stsAccess(time.Now().Add(time.Hour)),
+		OutputPrefix: "jobs/job-1/1/",
+		OutputKey:    "jobs/job-1/1/output.bin",
+	}
+
+	// Any number of keys under the prefix, with the assigned credentials
+	uploader := client.newSTSUploader(assigned)
+	for _, key := range []string{"jobs/job-1/1/output.bin", "jobs/job-1/1/plots/a.png"} {
+		if err := uploader.Upload(key, "text/plain", strings.NewReader("data:"+key), int64(len("data:"+key))); err != nil {
+			t.Fatalf("Upload %s failed: %v", key, err)
+		}
+	}
+	if string(cos.objects["jobs/job-1/1/plots/a.png"]) != "data:jobs/job-1/1/plots/a.png" || refreshes != 0 {
+		t.Errorf("Unexpected objects %v or refreshes %d", cos.objects, refreshes)
+	}
+
+	// Keys outside the prefix are refused before any request
+	for _, key := range []string{"jobs/job-2/1/output.bin", "jobs/job-1/1/../../x"} {
+		if err := uploader.Upload(key, "text/plain", strings.NewReader("x"), 1); err == nil {
+			t.Errorf("Upload %s: expected error", key)
+		}
+	}
+
+	// Credentials about to expire are refreshed before the upload
+	assigned.OutputUpload = stsAccess(time.Now().Add(30 * time.Second))
+	if err := client.uploadJobOutput(assigned, time.Now(), assigned.OutputKey, "text/plain", strings.NewReader("fresh"), 5); err != nil {
+		t.Fatalf("Upload with expiring credentials failed: %v", err)
+	}
+	if refreshes != 1 || string(cos.objects[assigned.OutputKey]) != "fresh" {
+		t.Errorf("Expected one refresh and uploaded object, got %d refreshes", refreshes)
+	}
+
+	// Large files are uploaded in parts (a single COS PUT is limited to 5GB)
+	client.multipartThreshold = 10
+	client.multipartPartSize = 4
+	large := "0123456789abcdefghij-"
+	if err := uploader.Upload("jobs/job-1/1/large.bin", "application/octet-stream", strings.NewReader(large), int64(len(large))); err != nil {
+		t.Fatalf("Multipart upload failed: %v", err)
+	}
+	if string(cos.objects["jobs/job-1/1/large.bin"]) != large || len(cos.uploads) != 0 {
+		t.Errorf("Multipart object %q, open uploads %d", cos.objects["jobs/job-1/1/large.bin"], len(cos.uploads))
+	}
+
+	// A failed part aborts the upload
+	cos.failPart = 2
+	if err := uploader.Upload("jobs/job-1/1/failed.bin", "application/octet-stream", strings.NewReader(large), int64(len(large))); err == nil || !strings.Contains(err.Error(), "part 2") {
+		t.Errorf("Failed part: %v", err)
+	}
+	if cos.aborted != 1 || len(cos.uploads) != 0 || cos.objects["jobs/job-1/1/failed.bin"] != nil {
+		t.Errorf("Aborted %d, open uploads %d", cos.aborted, len(cos.uploads))
+	}
+}
+
+func TestCOSObjectURL(t *testing.T) {
+	creds := &control.STSCreds{Endpoint: "cos.ap-beijing.myqcloud.com", Bucket: "examplebucket-1250000000"}
+	got, err := cosObjectURL(creds, "jobs/j/1/output.bin")
+	if err != nil || got != "https://examplebucket-1250000000.cos.ap-beijing.myqcloud.com/jobs/j/1/output.bin" {
+		t.Errorf("cosObjectURL = %q, %v", got, err)
+	}
+
+	creds.Endpoint = "http://127.0.0.1:9000/"
+	got, err = cosObjectURL(creds, "jobs/j/1/output.bin")
+	if err != nil || got != "http://127.0.0.1:9000/jobs/j/1/output.bin" {
+		t.Errorf("cosObjectURL with scheme = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"os"
+	"time"
+
+	control "github.com/xiresource/proto/control"
+)
+
+// processUsage reports how a command's process ended and the resources it used (nil if it never started).
+// wall is the time from start to exit as measured by the agent.
+func processUsage(state *os.ProcessState, wall time.Duration) *control.ProcessUsage {
+	if state == nil {
+		return nil
+	}
+	usage := &control.ProcessUsage{
+		WallTimeMs:  wall.Milliseconds(),
+		UserCpuMs:   state.UserTime().Milliseconds(),
+		SystemCpuMs: state.SystemTime().Milliseconds(),
+		MaxRssBytes: maxRSS(state),
+	}
+	if state.Exited() {
+		usage.Exited = true
+		usage.ExitCode = int32(state.ExitCode())
+	} else {
+		usage.Signal = terminatingSignal(state)
+	}
+	return usage
+}
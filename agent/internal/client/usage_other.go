@@ -0,0 +1,15 @@
+//go:build !unix
+
+package client
+
+import "os"
+
+// maxRSS is not reported on this platform
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
+
+// terminatingSignal: processes are not killed by signals on this platform
+func terminatingSignal(state *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExecuteCommand_ProcessUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	client := New("ws://test", "test-agent", "test-token", 1)
+	run := func(command string) *CommandResult {
+		t.Helper()
+		dir := t.TempDir()
+		result, _ := client.executeCommand(context.Background(), commandSpec{Command: command}, dir, "", nil, filepath.Join(dir, "out"), dir, "", nil, nil)
+		if result == nil || result.Usage == nil {
+			t.Fatalf("%q: no process usage", command)
+		}
+		return result
+	}
+
+	usage := run("sleep 0.2").Usage
+	if !usage.Exited || usage.ExitCode != 0 || usage.Signal != "" {
+		t.Errorf("sleep: exited %v, exit code %d, signal %q", usage.Exited, usage.ExitCode, usage.Signal)
+	}
+	if usage.WallTimeMs < 200 {
+		t.Errorf("sleep: wall time %dms, want at least 200ms", usage.WallTimeMs)
+	}
+	if runtime.GOOS == "linux" && usage.MaxRssBytes <= 0 {
+		t.Errorf("sleep: max RSS %d, want a positive size", usage.MaxRssBytes)
+	}
+
+	if usage = run("exit 3").Usage; !usage.Exited || usage.ExitCode != 3 {
+		t.Errorf("exit 3: exited %v, exit code %d", usage.Exited, usage.ExitCode)
+	}
+
+	// A killed process has a signal and no exit code
+	if usage = run("kill -9 $$").Usage; usage.Exited || usage.Signal != "SIGKILL" {
+		t.Errorf("kill -9: exited %v, signal %q", usage.Exited, usage.Signal)
+	}
+
+	// A command that cannot start reports no usage
+	if result, err := client.executeCommand(context.Background(), commandSpec{}, "", "", nil, "", "", "", nil, nil); err == nil || result != nil {
+		t.Errorf("Empty command: result %+v, err %v", result, err)
+	}
+}
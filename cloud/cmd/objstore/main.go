@@ -0,0 +1,79 @@
+// objstore serves a directory as an object store for OSS_PROVIDER=local.
+// It accepts the signed GET/HEAD/PUT URLs generated by the cloud server's local provider,
+// so agents download inputs and upload outputs exactly as they would with COS or S3.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/xiresource/cloud/internal/oss"
+)
+
+func main() {
+	var (
+		addr      = flag.String("addr", ":9100", "HTTP server address")
+		dir       = flag.String("dir", "", "Object directory (default: LOCAL_OSS_DIR)")
+		maxSizeMB = flag.Int64("max-size-mb", 1024, "Maximum object size in MB for PUT (0: unlimited)")
+		envFile   = flag.String("env", "", "Path to .env file (optional)")
+	)
+	flag.Parse()
+
+	if *envFile != "" {
+		if err := godotenv.Load(*envFile); err != nil {
+			log.Printf("Warning: Failed to load .env file from %s: %v", *envFile, err)
+		}
+	}
+	if *dir == "" {
+		*dir = os.Getenv("LOCAL_OSS_DIR")
+	}
+	// The secret is only read from the environment so it does not show up in process listings
+	secret := os.Getenv("LOCAL_OSS_SECRET")
+	if *dir == "" || secret == "" {
+		log.Fatalf("LOCAL_OSS_DIR (or -dir) and LOCAL_OSS_SECRET are required and must match the cloud server's settings")
+	}
+
+	store, err := oss.NewLocalStore(*dir)
+	if err != nil {
+		log.Fatalf("Failed to open object directory: %v", err)
+	}
+	handler, err := oss.NewLocalStoreHandler(store, secret, *maxSizeMB*1024*1024)
+	if err != nil {
+		log.Fatalf("Failed to create object store handler: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.Handle("/", handler)
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: mux,
+	}
+
+	go func() {
+		log.Printf("Starting object store on %s (directory: %s)", *addr, *dir)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Object store failed: %v", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("Shutting down object store...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
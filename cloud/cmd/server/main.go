@@ -1,20 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/joho/godotenv"
 	"github.com/xiresource/cloud/internal/api"
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/events"
 	"github.com/xiresource/cloud/internal/gateway"
 	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
 	"github.com/xiresource/cloud/internal/oss"
 	"github.com/xiresource/cloud/internal/queue"
 	"github.com/xiresource/cloud/internal/registry"
+	"github.com/xiresource/cloud/internal/upload"
+	"github.com/xiresource/cloud/internal/webhook"
 )
 
 func main() {
@@ -82,6 +89,28 @@ func main() {
 		}
 	}()
 
+	// Create webhook store in the same database as jobs
+	webhookStore, err := webhook.NewStore(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to create webhook store: %v", err)
+	}
+	defer func() {
+		if err := webhookStore.Close(); err != nil {
+			log.Printf("Failed to close webhook store: %v", err)
+		}
+	}()
+
+	// Create upload reservation store in the same database as jobs
+	uploadStore, err := upload.NewStore(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to create upload store: %v", err)
+	}
+	defer func() {
+		if err := uploadStore.Close(); err != nil {
+			log.Printf("Failed to close upload store: %v", err)
+		}
+	}()
+
 	// Initialize Redis queue (optional - queue can be nil if Redis is not configured)
 	var jobQueue queue.Queue
 	redisConfig := queue.LoadConfig()
@@ -110,30 +139,96 @@ func main() {
 	ossConfig, err := oss.LoadConfigFromEnv()
 	if err != nil {
 		log.Printf("Warning: Failed to load OSS config: %v. Job assignment will fail without OSS provider.", err)
-		log.Printf("Set COS_SECRET_ID, COS_SECRET_KEY, COS_BUCKET, COS_REGION environment variables.")
+		log.Printf("Set COS_SECRET_ID, COS_SECRET_KEY, COS_BUCKET, COS_REGION environment variables (or OSS_PROVIDER=s3 with S3_*, OSS_PROVIDER=local with LOCAL_OSS_*).")
 	} else {
-		ossProvider, err = oss.NewCOSProvider(ossConfig)
+		// Additional buckets (OSS_BUCKETS_CONFIG); jobs may only use configured buckets
+		bucketConfigs, err := oss.LoadBucketConfigsFromEnv()
+		if err != nil {
+			log.Fatalf("Failed to load OSS bucket config: %v", err)
+		}
+		buckets, err := oss.NewRegistry(ossConfig, bucketConfigs)
 		if err != nil {
 			log.Printf("Warning: Failed to create OSS provider: %v. Job assignment will fail without OSS provider.", err)
 		} else {
-			log.Printf("OSS provider initialized (bucket: %s, region: %s)", ossConfig.Bucket, ossConfig.Region)
+			ossProvider = buckets
+			log.Printf("OSS provider initialized (provider: %s, bucket: %s, region: %s, allowed buckets: %s)",
+				ossConfig.Provider, ossConfig.Bucket, ossConfig.Region, strings.Join(buckets.Buckets(), ", "))
 		}
 	}
 
+	// Load API keys (empty API_KEYS disables authentication)
+	authenticator, err := auth.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	if !authenticator.Enabled() {
+		log.Printf("Warning: API_KEYS not set, /api/* endpoints are unauthenticated")
+	}
+
 	// Create registry
 	reg := registry.New()
 
+	// Create job event broker (feeds long-poll waits and SSE streams)
+	jobEvents := events.NewBroker()
+
 	// Create gateway with dependencies
 	gw := gateway.New(reg, jobStore, jobQueue, ossProvider, *devMode)
+	gw.SetEvents(jobEvents)
+
+	// Live command output streamed by agents (LOG_* settings); archived to OSS when attempts end
+	logStore := logs.NewStore(logs.LoadConfig())
+	gw.SetLogs(logStore)
+
+	// Optional: hand agents prefix-scoped STS credentials for outputs (COS_STS_ENABLED=true)
+	stsConfig, stsEnabled, err := oss.LoadSTSConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load STS config: %v", err)
+	}
+	if stsEnabled {
+		stsProvider, err := oss.NewTencentSTSProvider(stsConfig)
+		if err != nil {
+			log.Fatalf("Failed to create STS provider: %v", err)
+		}
+		gw.SetSTSProvider(stsProvider)
+		log.Printf("STS output credentials enabled (duration: %s)", stsConfig.Duration)
+	}
 
 	// Create API handler with queue
 	apiHandler := api.New(reg, jobStore, jobQueue)
+	apiHandler.SetEvents(jobEvents)
+	apiHandler.SetWebhookStore(webhookStore)
+	apiHandler.SetOSSProvider(ossProvider)
+	apiHandler.SetLogs(logStore)
+	// Job run time limits (JOB_*_TIMEOUT_SEC); overrunning jobs are failed as TIMED_OUT
+	timeoutConfig := job.LoadTimeoutConfig()
+	apiHandler.SetTimeouts(timeoutConfig)
+	uploadConfig := upload.LoadConfig()
+	uploadConfig.Bucket = ossConfig.Bucket
+	if ossConfig.PresignTTL > 0 {
+		uploadConfig.PresignTTL = ossConfig.PresignTTL
+	}
+	apiHandler.SetUploadStore(uploadStore, uploadConfig)
+
+	// Deliver webhooks for jobs reaching a terminal state
+	webhookConfig := webhook.LoadConfig()
+	if webhookConfig.Secret == "" {
+		log.Printf("Warning: WEBHOOK_SECRET not set, jobs with a callback_url are rejected")
+	}
+	apiHandler.SetCallbacksEnabled(webhookConfig.Secret != "")
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	defer stopDispatcher()
+	dispatcher := webhook.NewDispatcher(webhookStore, jobStore, webhookConfig)
+	gw.SetNotifier(dispatcher)
+	go dispatcher.Run(dispatcherCtx)
+	go gw.RunTimeouts(dispatcherCtx, timeoutConfig)
 
 	// Setup routes
 	mux := http.NewServeMux()
 	mux.HandleFunc(*wssPath, gw.HandleWebSocket)
-	mux.HandleFunc("/api/agents/online", apiHandler.HandleAgentsOnline)
-	mux.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
+	// API routes require an API key when API_KEYS is set (/health and the agent WebSocket do not)
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/api/agents/online", apiHandler.HandleAgentsOnline)
+	apiMux.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
 			apiHandler.HandleCreateJob(w, r)
@@ -143,14 +238,27 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	mux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+	apiMux.HandleFunc("/api/jobs/events", apiHandler.HandleJobEvents)
+	apiMux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
+			if strings.HasSuffix(r.URL.Path, "/output") {
+				apiHandler.HandleGetJobOutput(w, r)
+				return
+			}
+			if strings.HasSuffix(r.URL.Path, "/logs") {
+				apiHandler.HandleGetJobLogs(w, r)
+				return
+			}
 			apiHandler.HandleGetJob(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	apiMux.HandleFunc("/api/uploads", apiHandler.HandleCreateUpload)
+	apiMux.HandleFunc("/api/webhooks", apiHandler.HandleWebhooks)
+	apiMux.HandleFunc("/api/webhooks/", apiHandler.HandleWebhook)
+	mux.Handle("/api/", authenticator.Middleware(apiMux))
 	mux.HandleFunc("/health", apiHandler.HandleHealth)
 
 	// Start server
@@ -177,4 +285,8 @@ func main() {
 	<-sigChan
 
 	log.Println("Shutting down server...")
+
+	// Abort pending webhook retries (recorded as dead letters) before the stores close
+	stopDispatcher()
+	dispatcher.Wait()
 }
@@ -15,13 +15,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v\n\nPlease set the following environment variables:\n"+
 			"  COS_SECRET_ID\n  COS_SECRET_KEY\n  COS_BUCKET\n  COS_REGION\n"+
-			"Optional: COS_PRESIGN_TTL_MINUTES (default: 15)", err)
+			"Optional: COS_PRESIGN_TTL_MINUTES (default: 15)\n"+
+			"For S3-compatible storage: OSS_PROVIDER=s3 with S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_BUCKET, S3_ENDPOINT", err)
 	}
 
 	// Create provider
-	provider, err := oss.NewCOSProvider(config)
+	provider, err := oss.NewProvider(config)
 	if err != nil {
-		log.Fatalf("Failed to create COS provider: %v", err)
+		log.Fatalf("Failed to create %s provider: %v", config.Provider, err)
 	}
 
 	ctx := context.Background()
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/job"
+)
+
+func TestAccessControl_SubmitterScoping(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	lab := &auth.Principal{Name: "lab"}
+	other := &auth.Principal{Name: "other"}
+	admin := &auth.Principal{Name: "ops", Admin: true}
+
+	serve := func(h http.HandlerFunc, method, target, body string, p *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	// Non-admin keys cannot create jobs for someone else
+	rec := serve(handler.HandleCreateJob, http.MethodPost, "/api/jobs", `{"command":"echo","shell":true,"submitter":"other"}`, lab)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Foreign submitter: status %d, want 403", rec.Code)
+	}
+
+	rec = serve(handler.HandleCreateJob, http.MethodPost, "/api/jobs", `{"command":"echo","shell":true}`, lab)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Create: status %d, want 201", rec.Code)
+	}
+	var created CreateJobResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	j, err := handler.jobStore.Get(created.JobID)
+	if err != nil || j.Submitter != "lab" {
+		t.Fatalf("Expected submitter forced to key name, got %+v (err %v)", j, err)
+	}
+	createTestJob(t, server.URL, `{"command":"echo","shell":true,"submitter":"other"}`)
+
+	// Owner and admin can read the job; other keys get 404
+	for _, tc := range []struct {
+		principal *auth.Principal
+		want      int
+	}{{lab, http.StatusOK}, {admin, http.StatusOK}, {other, http.StatusNotFound}} {
+		rec := serve(handler.HandleGetJob, http.MethodGet, "/api/jobs/"+created.JobID, "", tc.principal)
+		if rec.Code != tc.want {
+			t.Errorf("GET job as %s: status %d, want %d", tc.principal.Name, rec.Code, tc.want)
+		}
+	}
+
+	// Listing is scoped for non-admin keys
+	rec = serve(handler.HandleListJobs, http.MethodGet, "/api/jobs", "", lab)
+	var jobs []*job.Job
+	json.NewDecoder(rec.Body).Decode(&jobs)
+	if len(jobs) != 1 || jobs[0].JobID != created.JobID {
+		t.Errorf("Non-admin list returned %d jobs, want only its own", len(jobs))
+	}
+	rec = serve(handler.HandleListJobs, http.MethodGet, "/api/jobs", "", admin)
+	jobs = nil
+	json.NewDecoder(rec.Body).Decode(&jobs)
+	if len(jobs) != 2 {
+		t.Errorf("Admin list returned %d jobs, want 2", len(jobs))
+	}
+
+	// Webhook management is admin-only
+	setupWebhookStore(t, handler)
+	rec = serve(handler.HandleWebhooks, http.MethodGet, "/api/webhooks", "", lab)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Webhooks as non-admin: status %d, want 403", rec.Code)
+	}
+	rec = serve(handler.HandleWebhooks, http.MethodGet, "/api/webhooks", "", admin)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Webhooks as admin: status %d, want 200", rec.Code)
+	}
+
+	// Jobs may reference only webhooks owned by their key
+	rec = serve(handler.HandleWebhooks, http.MethodPost, "/api/webhooks", `{"url":"https://lab.example.com/hooks","owner":"lab"}`, admin)
+	var webhookCreated CreateWebhookResponse
+	json.NewDecoder(rec.Body).Decode(&webhookCreated)
+	if rec.Code != http.StatusCreated || webhookCreated.Owner != "lab" {
+		t.Fatalf("Create webhook: status %d, owner %q, want 201 owned by lab", rec.Code, webhookCreated.Owner)
+	}
+	body := `{"command":"echo","shell":true,"webhook_id":"` + webhookCreated.ID + `"}`
+	for _, tc := range []struct {
+		principal *auth.Principal
+		want      int
+	}{{lab, http.StatusCreated}, {admin, http.StatusCreated}, {other, http.StatusBadRequest}} {
+		rec := serve(handler.HandleCreateJob, http.MethodPost, "/api/jobs", body, tc.principal)
+		if rec.Code != tc.want {
+			t.Errorf("Job with webhook_id as %s: status %d, want %d", tc.principal.Name, rec.Code, tc.want)
+		}
+	}
+}
@@ -2,19 +2,28 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/events"
 	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
+	"github.com/xiresource/cloud/internal/oss"
 	"github.com/xiresource/cloud/internal/queue"
 	"github.com/xiresource/cloud/internal/registry"
+	"github.com/xiresource/cloud/internal/upload"
+	"github.com/xiresource/cloud/internal/webhook"
 )
 
 // AgentInfo represents an online agent (API response format)
@@ -33,6 +42,16 @@ type Handler struct {
 	registry *registry.Registry
 	jobStore job.Store
 	queue    queue.Queue
+	events   *events.Broker
+	webhooks webhook.Store
+	oss      oss.Provider
+	logs     *logs.Store
+	timeouts *job.TimeoutConfig
+
+	callbacksEnabled bool // callback_url is accepted (deliveries can be signed with WEBHOOK_SECRET)
+
+	uploads      upload.Store
+	uploadConfig *upload.Config
 }
 
 // New creates a new API handler
@@ -41,12 +60,61 @@ func New(reg *registry.Registry, jobStore job.Store, jobQueue queue.Queue) *Hand
 		registry: reg,
 		jobStore: jobStore,
 		queue:    jobQueue,
+		timeouts: job.DefaultTimeoutConfig(),
+	}
+}
+
+// SetTimeouts sets the default and maximum timeout_sec of created jobs
+func (h *Handler) SetTimeouts(cfg *job.TimeoutConfig) {
+	h.timeouts = cfg
+}
+
+// SetWebhookStore sets the webhook store (enables /api/webhooks and the webhook_id job field)
+func (h *Handler) SetWebhookStore(store webhook.Store) {
+	h.webhooks = store
+}
+
+// SetCallbacksEnabled enables the callback_url job field. It should only be enabled when
+// WEBHOOK_SECRET is configured, since callback deliveries are signed with it.
+func (h *Handler) SetCallbacksEnabled(enabled bool) {
+	h.callbacksEnabled = enabled
+}
+
+// SetOSSProvider sets the OSS provider used to presign output downloads (enables GET /api/jobs/{job_id}/output)
+func (h *Handler) SetOSSProvider(provider oss.Provider) {
+	h.oss = provider
+}
+
+// SetUploadStore sets the upload store and limits (enables POST /api/uploads and the upload_id job field).
+// Uploads also require an OSS provider.
+func (h *Handler) SetUploadStore(store upload.Store, cfg *upload.Config) {
+	if cfg == nil {
+		cfg = upload.DefaultConfig()
 	}
+	h.uploads = store
+	h.uploadConfig = cfg
+}
+
+// SetLogs sets the store of streamed job output (enables GET /api/jobs/{job_id}/logs)
+func (h *Handler) SetLogs(store *logs.Store) {
+	h.logs = store
+}
+
+// SetEvents sets the job event broker used for long-poll waits and SSE streams.
+// Without a broker, waits fall back to polling the job store.
+func (h *Handler) SetEvents(broker *events.Broker) {
+	h.events = broker
 }
 
 const (
 	// MaxRequestBodySize is the maximum allowed body size for POST /jobs (1MB)
 	MaxRequestBodySize = 1 * 1024 * 1024 // 1MB
+
+	// IdempotencyKeyHeader is the request header carrying the client idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// maxIdempotencyKeyLength matches the idempotency_key column size
+	maxIdempotencyKeyLength = 255
 )
 
 // HandleAgentsOnline returns the list of online agents
@@ -88,21 +156,37 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 
 // CreateJobRequest represents the request body for creating a job
 type CreateJobRequest struct {
-	InputBucket       string            `json:"input_bucket"`
-	InputKey          string            `json:"input_key"`
-	OutputBucket      string            `json:"output_bucket"`
-	OutputKey         string            `json:"output_key,omitempty"`          // Optional: specific output key
-	OutputPrefix      string            `json:"output_prefix,omitempty"`       // Optional: output prefix (defaults to jobs/{job_id}/{attempt_id}/)
-	OutputExtension   string            `json:"output_extension,omitempty"`    // Optional: output file extension (e.g., "json", "txt", "bin", default: "bin")
-	AttemptID         int               `json:"attempt_id,omitempty"`          // Optional: defaults to 1
-	Command           string            `json:"command,omitempty"`             // Optional: command to execute (e.g., "python C:/scripts/analyze.py {input} {output}")
-	JobType           string            `json:"job_type,omitempty"`            // Optional: COMMAND or FORWARD_HTTP
-	ForwardURL        string            `json:"forward_url,omitempty"`         // Optional: local service URL for forward jobs
-	ForwardMethod     string            `json:"forward_method,omitempty"`      // Optional: HTTP method for forward jobs
-	ForwardHeaders    map[string]string `json:"forward_headers,omitempty"`     // Optional: headers for forward jobs
-	ForwardBody       string            `json:"forward_body,omitempty"`        // Optional: raw body for forward jobs
-	ForwardTimeoutSec int               `json:"forward_timeout_sec,omitempty"` // Optional: timeout for forward jobs (seconds)
-	InputForwardMode  string            `json:"input_forward_mode,omitempty"`  // Optional: URL or LOCAL_FILE
+	InputBucket       string               `json:"input_bucket"`
+	InputKey          string               `json:"input_key"`
+	OutputBucket      string               `json:"output_bucket"`
+	OutputKey         string               `json:"output_key,omitempty"`          // Optional: specific output key
+	OutputPrefix      string               `json:"output_prefix,omitempty"`       // Optional: output prefix (defaults to jobs/{job_id}/{attempt_id}/)
+	OutputExtension   string               `json:"output_extension,omitempty"`    // Optional: output file extension (e.g., "json", "txt", "bin", default: "bin")
+	AttemptID         int                  `json:"attempt_id,omitempty"`          // Optional: defaults to 1
+	Command           string               `json:"command,omitempty"`             // Optional: shell command to execute (e.g., "python C:/scripts/analyze.py {input} {output}")
+	Shell             bool                 `json:"shell,omitempty"`               // Required with command: confirms that it runs through the agent's shell
+	Argv              []string             `json:"argv,omitempty"`                // Optional: command to execute without a shell (alternative to command)
+	Env               map[string]string    `json:"env,omitempty"`                 // Optional: environment variables for the command
+	WorkingDir        string               `json:"working_dir,omitempty"`         // Optional: working directory of the command (relative: under the job work directory)
+	Template          string               `json:"template,omitempty"`            // Optional: job template declared in the agents' config (alternative to command/argv)
+	Params            map[string]string    `json:"params,omitempty"`              // Optional: parameters of the template
+	JobType           string               `json:"job_type,omitempty"`            // Optional: COMMAND, FORWARD_HTTP or FORWARD_GRPC
+	ForwardURL        string               `json:"forward_url,omitempty"`         // Optional: local service URL for forward jobs
+	ForwardMethod     string               `json:"forward_method,omitempty"`      // Optional: HTTP method for forward jobs
+	ForwardHeaders    map[string]string    `json:"forward_headers,omitempty"`     // Optional: headers for forward jobs
+	ForwardBody       string               `json:"forward_body,omitempty"`        // Optional: raw body for forward jobs
+	ForwardTimeoutSec int                  `json:"forward_timeout_sec,omitempty"` // Optional: timeout for forward jobs (seconds)
+	ForwardAsync      *job.ForwardAsync    `json:"forward_async,omitempty"`       // Optional: submit a task to the local service and poll it until it finishes
+	ForwardGRPC       *job.ForwardGRPC     `json:"forward_grpc,omitempty"`        // Required for FORWARD_GRPC: unary call to a local gRPC service
+	TimeoutSec        int                  `json:"timeout_sec,omitempty"`         // Optional: maximum run time of the job (seconds, default from server config)
+	InputForwardMode  string               `json:"input_forward_mode,omitempty"`  // Optional: URL or LOCAL_FILE
+	ClientRequestID   string               `json:"client_request_id,omitempty"`   // Optional: idempotency key (alternative to the Idempotency-Key header)
+	Submitter         string               `json:"submitter,omitempty"`           // Optional: submitter identifier (for filtering job events)
+	CallbackURL       string               `json:"callback_url,omitempty"`        // Optional: URL POSTed to when the job reaches a terminal state
+	WebhookID         string               `json:"webhook_id,omitempty"`          // Optional: registered webhook subscription to notify on completion
+	UploadID          string               `json:"upload_id,omitempty"`           // Optional: input uploaded via POST /api/uploads (instead of input_bucket/input_key)
+	Inputs            map[string]job.Input `json:"inputs,omitempty"`              // Optional: named inputs, referenced as {input:name} in command
+	InputSHA256       string               `json:"input_sha256,omitempty"`        // Optional: expected hex SHA-256 of the input, verified by the agent after download
 }
 
 // CreateJobResponse represents the response for creating a job
@@ -164,6 +248,15 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Jobs created with a non-admin API key always belong to that key
+	if principal := auth.FromContext(r.Context()); principal != nil && !principal.Admin {
+		if submitter := strings.TrimSpace(req.Submitter); submitter != "" && submitter != principal.Name {
+			http.Error(w, "submitter must match the API key name", http.StatusForbidden)
+			return
+		}
+		req.Submitter = principal.Name
+	}
+
 	// Validate that we have OSS keys (not file content)
 	// Input is optional - jobs can run without input files (e.g., scheduled tasks, pure computation)
 	// If input_bucket is provided, input_key must also be provided (and vice versa)
@@ -171,9 +264,49 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "input_bucket and input_key must both be provided or both be empty (OSS keys only, not file content)", http.StatusBadRequest)
 		return
 	}
+	if req.UploadID != "" && req.InputKey != "" {
+		http.Error(w, "upload_id cannot be combined with input_bucket/input_key", http.StatusBadRequest)
+		return
+	}
 	// Output bucket is optional - if not provided, gateway will use OSS provider's default bucket
 	// This allows jobs that only produce stdout/stderr without output files
 
+	// Resolve idempotency key: header takes precedence, body field is an alternative for clients
+	// that cannot set custom headers. If both are given they must agree.
+	idempotencyKey := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	clientRequestID := strings.TrimSpace(req.ClientRequestID)
+	if idempotencyKey != "" && clientRequestID != "" && idempotencyKey != clientRequestID {
+		http.Error(w, "Idempotency-Key header and client_request_id must match when both are provided", http.StatusBadRequest)
+		return
+	}
+	if idempotencyKey == "" {
+		idempotencyKey = clientRequestID
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, fmt.Sprintf("idempotency key exceeds maximum length of %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+		return
+	}
+
+	// Fingerprint the request so a retry with the same key can be told apart from a
+	// different request reusing the key
+	requestHash := ""
+	if idempotencyKey != "" {
+		requestHash = req.fingerprint()
+
+		// Replay: return the original job instead of creating a duplicate.
+		// Keys are scoped to the submitter, so another submitter's key is never matched (or disclosed).
+		existing, err := h.jobStore.GetByIdempotencyKey(strings.TrimSpace(req.Submitter), idempotencyKey)
+		if err == nil {
+			h.writeIdempotentReplay(w, existing, requestHash)
+			return
+		}
+		if err != job.ErrJobNotFound {
+			log.Printf("Failed to look up idempotency key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Generate job ID
 	jobID := uuid.New().String()
 
@@ -189,14 +322,43 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("command exceeds maximum length of %d characters", maxCommandLength), http.StatusBadRequest)
 		return
 	}
+	// A command is interpreted by the agent's shell (sh -c, cmd.exe /c), so the submitter has to ask for that
+	if req.Command != "" && !req.Shell {
+		http.Error(w, "command runs through a shell and requires shell: true (use argv to run a program without a shell)", http.StatusBadRequest)
+		return
+	}
+	if req.Shell && req.Command == "" {
+		http.Error(w, "shell requires a command", http.StatusBadRequest)
+		return
+	}
+
+	// Run time limit: server default if omitted, bounded by the server maximum
+	timeoutSec := req.TimeoutSec
+	if timeoutSec < 0 {
+		http.Error(w, "timeout_sec must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if maxSec := int(h.timeouts.Max / time.Second); timeoutSec > maxSec {
+		http.Error(w, fmt.Sprintf("timeout_sec exceeds maximum of %d seconds", maxSec), http.StatusBadRequest)
+		return
+	}
+	if timeoutSec == 0 {
+		timeoutSec = int(h.timeouts.Default / time.Second)
+	}
 
 	// Normalize and validate job type
 	jobType := strings.ToUpper(strings.TrimSpace(req.JobType))
 	if jobType == "" {
 		jobType = string(job.JobTypeCommand)
 	}
-	if jobType != string(job.JobTypeCommand) && jobType != string(job.JobTypeForwardHTTP) {
-		http.Error(w, "job_type must be COMMAND or FORWARD_HTTP", http.StatusBadRequest)
+	if jobType != string(job.JobTypeCommand) && jobType != string(job.JobTypeForwardHTTP) && jobType != string(job.JobTypeForwardGRPC) {
+		http.Error(w, "job_type must be COMMAND, FORWARD_HTTP or FORWARD_GRPC", http.StatusBadRequest)
+		return
+	}
+
+	// Forward jobs run no command, so command settings are refused rather than ignored
+	if jobType != string(job.JobTypeCommand) && req.hasCommandFields() {
+		http.Error(w, "argv, env, working_dir, template and params are only supported for COMMAND job_type", http.StatusBadRequest)
 		return
 	}
 
@@ -211,6 +373,216 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "forward_url is required for FORWARD_HTTP job_type", http.StatusBadRequest)
 			return
 		}
+		if req.ForwardAsync != nil {
+			if err := req.ForwardAsync.Check(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid forward_async: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if req.ForwardAsync != nil {
+		http.Error(w, "forward_async is only supported for FORWARD_HTTP job_type", http.StatusBadRequest)
+		return
+	}
+	if jobType == string(job.JobTypeForwardGRPC) {
+		if req.ForwardGRPC == nil {
+			http.Error(w, "forward_grpc is required for FORWARD_GRPC job_type", http.StatusBadRequest)
+			return
+		}
+		if err := req.ForwardGRPC.Check(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid forward_grpc: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.ForwardURL != "" || req.ForwardMethod != "" || len(req.ForwardHeaders) > 0 || req.ForwardBody != "" {
+			http.Error(w, "forward_url, forward_method, forward_headers and forward_body are only supported for FORWARD_HTTP job_type", http.StatusBadRequest)
+			return
+		}
+	} else if req.ForwardGRPC != nil {
+		http.Error(w, "forward_grpc is only supported for FORWARD_GRPC job_type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate argv commands, environment and working directory
+	if len(req.Argv) > 0 {
+		if req.Command != "" {
+			http.Error(w, "command and argv are mutually exclusive (command runs through a shell, argv does not)", http.StatusBadRequest)
+			return
+		}
+		if req.Argv[0] == "" {
+			http.Error(w, "argv[0] (the program) must not be empty", http.StatusBadRequest)
+			return
+		}
+		argvLength := 0
+		for _, arg := range req.Argv {
+			argvLength += len(arg)
+		}
+		if len(req.Argv) > job.MaxArgs || argvLength > maxCommandLength {
+			http.Error(w, fmt.Sprintf("argv exceeds maximum of %d arguments or %d characters", job.MaxArgs, maxCommandLength), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(req.Env) > job.MaxEnvVars {
+		http.Error(w, fmt.Sprintf("env exceeds maximum of %d variables", job.MaxEnvVars), http.StatusBadRequest)
+		return
+	}
+	envLength := 0
+	for name, value := range req.Env {
+		if !job.ValidEnvName(name) {
+			http.Error(w, fmt.Sprintf("Invalid env name %q: must match [A-Za-z_][A-Za-z0-9_]* (at most 128 characters)", name), http.StatusBadRequest)
+			return
+		}
+		if strings.ContainsRune(value, 0) {
+			http.Error(w, fmt.Sprintf("env.%s must not contain NUL characters", name), http.StatusBadRequest)
+			return
+		}
+		envLength += len(name) + len(value)
+	}
+	if envLength > maxCommandLength {
+		http.Error(w, fmt.Sprintf("env exceeds maximum size of %d characters", maxCommandLength), http.StatusBadRequest)
+		return
+	}
+	if len(req.WorkingDir) > job.MaxWorkingDirLength || strings.ContainsRune(req.WorkingDir, 0) {
+		http.Error(w, fmt.Sprintf("working_dir must be at most %d characters without NUL characters", job.MaxWorkingDirLength), http.StatusBadRequest)
+		return
+	}
+	if job.WorkingDirEscapes(req.WorkingDir) {
+		http.Error(w, "working_dir must not lead out of the job work directory (relative paths are under it)", http.StatusBadRequest)
+		return
+	}
+
+	// Validate template jobs: the agent holds the command, the job only names it and passes parameters
+	if req.Template != "" {
+		if !job.ValidTemplateName(req.Template) {
+			http.Error(w, fmt.Sprintf("Invalid template %q: must match [A-Za-z0-9_.-]{1,64}", req.Template), http.StatusBadRequest)
+			return
+		}
+		if req.Command != "" || len(req.Argv) > 0 || len(req.Env) > 0 || req.WorkingDir != "" {
+			http.Error(w, "template cannot be combined with command, argv, env or working_dir (they are defined by the template)", http.StatusBadRequest)
+			return
+		}
+	} else if len(req.Params) > 0 {
+		http.Error(w, "params require a template", http.StatusBadRequest)
+		return
+	}
+	if len(req.Params) > job.MaxParams {
+		http.Error(w, fmt.Sprintf("params exceeds maximum of %d parameters", job.MaxParams), http.StatusBadRequest)
+		return
+	}
+	paramsLength := 0
+	for name, value := range req.Params {
+		if !job.ValidInputName(name) {
+			http.Error(w, fmt.Sprintf("Invalid param name %q: must match [A-Za-z0-9_-]{1,64}", name), http.StatusBadRequest)
+			return
+		}
+		if strings.ContainsRune(value, 0) {
+			http.Error(w, fmt.Sprintf("params.%s must not contain NUL characters", name), http.StatusBadRequest)
+			return
+		}
+		paramsLength += len(name) + len(value)
+	}
+	if paramsLength > maxCommandLength {
+		http.Error(w, fmt.Sprintf("params exceeds maximum size of %d characters", maxCommandLength), http.StatusBadRequest)
+		return
+	}
+
+	// Validate completion notification targets
+	callbackURL := strings.TrimSpace(req.CallbackURL)
+	if callbackURL != "" {
+		if !h.callbacksEnabled {
+			http.Error(w, "callback_url is not supported: WEBHOOK_SECRET is not configured", http.StatusBadRequest)
+			return
+		}
+		if err := webhook.ValidateURL(callbackURL); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid callback_url: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	webhookID := strings.TrimSpace(req.WebhookID)
+	if webhookID != "" {
+		if h.webhooks == nil {
+			http.Error(w, "webhook_id is not supported: webhooks are not enabled", http.StatusBadRequest)
+			return
+		}
+		sub, err := h.webhooks.GetSubscription(webhookID)
+		if err != nil && err != webhook.ErrSubscriptionNotFound {
+			log.Printf("Failed to get webhook subscription: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// Another key's subscription is reported as not found, so its existence is not disclosed
+		if err == webhook.ErrSubscriptionNotFound || !auth.FromContext(r.Context()).CanAccess(sub.Owner) {
+			http.Error(w, fmt.Sprintf("webhook_id %s not found", webhookID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Resolve an uploaded input to its OSS location
+	inputBucket, inputKey := req.InputBucket, req.InputKey
+	if req.UploadID != "" {
+		u, ok := h.resolveUpload(w, r, req.UploadID)
+		if !ok {
+			return
+		}
+		inputBucket, inputKey = u.Bucket, u.Key
+	}
+
+	// Only buckets the OSS provider is configured for can be used
+	if inputBucket != "" {
+		if _, err := oss.ForBucket(h.oss, inputBucket); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid input_bucket: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.OutputBucket != "" {
+		if _, err := oss.ForBucket(h.oss, req.OutputBucket); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid output_bucket: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Named inputs: valid names, configured buckets, and every {input:name} in the command must be defined
+	if len(req.Inputs) > job.MaxInputs {
+		http.Error(w, fmt.Sprintf("inputs exceeds maximum of %d entries", job.MaxInputs), http.StatusBadRequest)
+		return
+	}
+	for _, name := range sortedInputNames(req.Inputs) {
+		input := req.Inputs[name]
+		if !job.ValidInputName(name) {
+			http.Error(w, fmt.Sprintf("Invalid input name %q: must be 1-64 characters of [A-Za-z0-9_-]", name), http.StatusBadRequest)
+			return
+		}
+		if input.Bucket == "" || input.Key == "" {
+			http.Error(w, fmt.Sprintf("inputs.%s: bucket and key are required", name), http.StatusBadRequest)
+			return
+		}
+		if _, err := oss.ForBucket(h.oss, input.Bucket); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid inputs.%s bucket: %v", name, err), http.StatusBadRequest)
+			return
+		}
+		if input.SHA256 != "" && !job.ValidSHA256(input.SHA256) {
+			http.Error(w, fmt.Sprintf("inputs.%s: sha256 must be 64 hex characters", name), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.InputSHA256 != "" {
+		if inputKey == "" {
+			http.Error(w, "input_sha256 requires an input (input_bucket/input_key or upload_id)", http.StatusBadRequest)
+			return
+		}
+		if !job.ValidSHA256(req.InputSHA256) {
+			http.Error(w, "input_sha256 must be 64 hex characters", http.StatusBadRequest)
+			return
+		}
+	}
+	if jobType == string(job.JobTypeCommand) {
+		command := &job.Job{Command: req.Command, Argv: req.Argv, Env: req.Env, WorkingDir: req.WorkingDir}
+		for _, text := range command.CommandText() {
+			for _, name := range job.InputRefs(text) {
+				if _, ok := req.Inputs[name]; !ok {
+					http.Error(w, fmt.Sprintf("command references {input:%s} but inputs has no entry %q", name, name), http.StatusBadRequest)
+					return
+				}
+			}
+		}
 	}
 
 	// Set default output extension if not provided
@@ -238,8 +610,8 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		JobID:           jobID,
 		CreatedAt:       time.Now(),
 		Status:          job.StatusPending,
-		InputBucket:     req.InputBucket,
-		InputKey:        req.InputKey,
+		InputBucket:     inputBucket,
+		InputKey:        inputKey,
 		OutputBucket:    req.OutputBucket,
 		OutputKey:       req.OutputKey,
 		OutputPrefix:    req.OutputPrefix,
@@ -249,6 +621,12 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		LeaseID:         "",
 		LeaseDeadline:   nil,
 		Command:         req.Command,
+		Shell:           req.Shell,
+		Argv:            req.Argv,
+		Env:             req.Env,
+		WorkingDir:      req.WorkingDir,
+		Template:        req.Template,
+		Params:          req.Params,
 		Stdout:          "",
 		Stderr:          "",
 		JobType:         job.JobType(jobType),
@@ -257,7 +635,17 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 		ForwardHeaders:  forwardHeadersJSON,
 		ForwardBody:     req.ForwardBody,
 		ForwardTimeout:  req.ForwardTimeoutSec,
+		ForwardAsync:    req.ForwardAsync,
+		ForwardGRPC:     req.ForwardGRPC,
+		TimeoutSec:      timeoutSec,
 		InputForward:    job.InputForwardMode(inputForwardMode),
+		IdempotencyKey:  idempotencyKey,
+		RequestHash:     requestHash,
+		Submitter:       strings.TrimSpace(req.Submitter),
+		CallbackURL:     callbackURL,
+		WebhookID:       webhookID,
+		Inputs:          req.Inputs,
+		InputSHA256:     strings.ToLower(req.InputSHA256),
 	}
 
 	// Ensure output prefix follows pattern
@@ -271,10 +659,20 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 
 	// Persist job to database
 	if err := h.jobStore.Create(newJob); err != nil {
+		if err == job.ErrDuplicateIdempotencyKey {
+			// Lost a race with a concurrent request using the same key - replay the winner
+			existing, getErr := h.jobStore.GetByIdempotencyKey(newJob.Submitter, idempotencyKey)
+			if getErr == nil {
+				h.writeIdempotentReplay(w, existing, requestHash)
+				return
+			}
+			log.Printf("Failed to look up idempotency key after duplicate insert: %v", getErr)
+		}
 		log.Printf("Failed to create job: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to create job: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.events.Publish(events.NewJobEvent(newJob))
 
 	// Enqueue job to Redis for scheduler
 	if h.queue != nil {
@@ -306,6 +704,88 @@ func (h *Handler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// hasCommandFields reports whether the request sets fields that only COMMAND jobs support
+func (req *CreateJobRequest) hasCommandFields() bool {
+	return len(req.Argv) > 0 || len(req.Env) > 0 || req.WorkingDir != "" || req.Template != "" || len(req.Params) > 0
+}
+
+// fingerprint hashes the fields that define the job, so that a retry reusing an idempotency key can be
+// told apart from a different request. The fields are listed explicitly and compared by value: JSON
+// formatting, field order and omitted (zero) fields do not matter, so adding a field to CreateJobRequest
+// does not change the fingerprint of existing requests. Fields that change what the job does belong here.
+func (req *CreateJobRequest) fingerprint() string {
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"input_bucket", req.InputBucket},
+		{"input_key", req.InputKey},
+		{"output_bucket", req.OutputBucket},
+		{"output_key", req.OutputKey},
+		{"output_prefix", req.OutputPrefix},
+		{"output_extension", req.OutputExtension},
+		{"attempt_id", req.AttemptID},
+		{"command", req.Command},
+		{"shell", req.Shell},
+		{"job_type", strings.ToUpper(strings.TrimSpace(req.JobType))},
+		{"forward_url", req.ForwardURL},
+		{"forward_method", strings.ToUpper(strings.TrimSpace(req.ForwardMethod))},
+		{"forward_headers", req.ForwardHeaders},
+		{"forward_body", req.ForwardBody},
+		{"forward_timeout_sec", req.ForwardTimeoutSec},
+		{"input_forward_mode", strings.ToUpper(strings.TrimSpace(req.InputForwardMode))},
+		{"forward_async", req.ForwardAsync},
+		{"forward_grpc", req.ForwardGRPC},
+		{"argv", req.Argv},
+		{"env", req.Env},
+		{"working_dir", req.WorkingDir},
+		{"template", req.Template},
+		{"params", req.Params},
+		{"timeout_sec", req.TimeoutSec},
+		{"callback_url", req.CallbackURL},
+		{"webhook_id", req.WebhookID},
+		{"upload_id", req.UploadID},
+		{"inputs", req.Inputs},
+		{"input_sha256", strings.ToLower(strings.TrimSpace(req.InputSHA256))},
+	}
+	hash := sha256.New()
+	for _, field := range fields {
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			continue // only JSON-decoded values are hashed, which always encode
+		}
+		switch string(value) {
+		case `""`, `0`, `false`, `null`, `{}`, `[]`:
+			continue
+		}
+		fmt.Fprintf(hash, "%s=%s\n", field.name, value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeIdempotentReplay answers a repeated create request that reused an idempotency key.
+// Same request body: 200 OK with the original job. Different body: 409 Conflict.
+func (h *Handler) writeIdempotentReplay(w http.ResponseWriter, existing *job.Job, requestHash string) {
+	if existing.RequestHash != requestHash {
+		http.Error(w, "Idempotency key was already used with a different request body", http.StatusConflict)
+		return
+	}
+
+	log.Printf("Idempotent replay for job %s", existing.JobID)
+	response := CreateJobResponse{
+		JobID:     existing.JobID,
+		Status:    string(existing.Status),
+		CreatedAt: existing.CreatedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
 // HandleGetJob handles GET /api/jobs/{job_id}
 func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -326,16 +806,25 @@ func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	j, err := h.jobStore.Get(jobID)
-	if err == job.ErrJobNotFound {
-		http.Error(w, "Job not found", http.StatusNotFound)
+	// Optional long-poll: ?wait=30s (or ?wait=30) blocks until the job is terminal or the wait expires
+	wait, err := parseWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err != nil {
-		log.Printf("Failed to get job: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+
+	j, ok := h.getAccessibleJob(w, r, jobID)
+	if !ok {
 		return
 	}
+	if wait > 0 {
+		j, err = h.waitForJob(r.Context(), jobID, wait)
+		if err != nil {
+			log.Printf("Failed to get job: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(j); err != nil {
@@ -373,7 +862,13 @@ func (h *Handler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jobs, err := h.jobStore.List(limit, offset, statusFilter)
+	// Non-admin API keys only see their own jobs
+	submitter := ""
+	if principal := auth.FromContext(r.Context()); !principal.IsAdmin() {
+		submitter = principal.Name
+	}
+
+	jobs, err := h.jobStore.ListBySubmitter(submitter, limit, offset, statusFilter)
 	if err != nil {
 		log.Printf("Failed to list jobs: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -385,3 +880,39 @@ func (h *Handler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to encode response: %v", err)
 	}
 }
+
+// getAccessibleJob loads a job and checks that the caller may see it.
+// Jobs owned by another API key are reported as not found so their IDs are not disclosed.
+// On failure the error response has been written and ok is false.
+func (h *Handler) getAccessibleJob(w http.ResponseWriter, r *http.Request, jobID string) (*job.Job, bool) {
+	j, err := h.jobStore.Get(jobID)
+	if err == job.ErrJobNotFound || (err == nil && !auth.FromContext(r.Context()).CanAccess(j.Submitter)) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get job: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return j, true
+}
+
+// requireAdmin rejects callers without an admin API key (always passes when authentication is disabled)
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !auth.FromContext(r.Context()).IsAdmin() {
+		http.Error(w, "Forbidden: admin API key required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// sortedInputNames returns the names of inputs in sorted order (for deterministic validation errors)
+func sortedInputNames(inputs map[string]job.Input) []string {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/oss"
 	"github.com/xiresource/cloud/internal/queue"
 	"github.com/xiresource/cloud/internal/registry"
 )
@@ -97,6 +98,21 @@ func setupTestServerWithQueue(t *testing.T, customQueue queue.Queue, useRedisIfA
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/jobs/events", handler.HandleJobEvents)
+	mux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/output") {
+			handler.HandleGetJobOutput(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/logs") {
+			handler.HandleGetJobLogs(w, r)
+			return
+		}
+		handler.HandleGetJob(w, r)
+	})
+	mux.HandleFunc("/api/uploads", handler.HandleCreateUpload)
+	mux.HandleFunc("/api/webhooks", handler.HandleWebhooks)
+	mux.HandleFunc("/api/webhooks/", handler.HandleWebhook)
 
 	server := httptest.NewServer(mux)
 
@@ -408,6 +424,7 @@ func TestHandleCreateJob_NoInputFile(t *testing.T) {
 	reqBody := CreateJobRequest{
 		OutputBucket: "test-bucket",
 		Command:      "echo Hello World",
+		Shell:        true,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -480,6 +497,7 @@ func TestHandleCreateJob_NoInputNoOutput(t *testing.T) {
 		"output_extension": "json",
 		"attempt_id":       1,
 		"command":          "echo Hello World",
+		"shell":            true,
 	}
 
 	jsonData, err := json.Marshal(reqBodyMap)
@@ -743,3 +761,425 @@ func TestRedisQueueIntegration(t *testing.T) {
 		t.Errorf("Expected queue size 0 after dequeue, got %d", size)
 	}
 }
+
+func TestHandleCreateJob_IdempotencyKey(t *testing.T) {
+	inMemoryQueue := queue.NewInMemoryQueue()
+	server, _, cleanup := setupTestServerWithQueue(t, inMemoryQueue, false)
+	defer cleanup()
+
+	post := func(body string, key string) (*http.Response, CreateJobResponse) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/jobs", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		var response CreateJobResponse
+		if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return resp, response
+	}
+
+	body := `{"output_bucket":"test-bucket","command":"echo hello","shell":true}`
+
+	// First request creates the job
+	resp1, created := post(body, "retry-key-1")
+	if resp1.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp1.StatusCode)
+	}
+
+	// Retry with the same key and an equivalent body (different formatting) returns the original job
+	resp2, replayed := post(`{ "command": "echo hello", "shell": true, "output_bucket": "test-bucket" }`, "retry-key-1")
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 on replay, got %d", resp2.StatusCode)
+	}
+	if replayed.JobID != created.JobID {
+		t.Errorf("Replayed job_id = %s, want %s", replayed.JobID, created.JobID)
+	}
+	if resp2.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected Idempotent-Replayed header on replay")
+	}
+
+	// Fields spelled out with their default (zero) values do not make a different request
+	if resp, replayed := post(`{"output_bucket":"test-bucket","command":"echo hello","shell":true,"attempt_id":0,"forward_headers":{},"job_type":""}`, "retry-key-1"); resp.StatusCode != http.StatusOK || replayed.JobID != created.JobID {
+		t.Errorf("Expected replay of the original job for explicit zero values, got %d (%s)", resp.StatusCode, replayed.JobID)
+	}
+
+	// Same key with a different body is a conflict
+	resp3, _ := post(`{"output_bucket":"test-bucket","command":"echo other","shell":true}`, "retry-key-1")
+	if resp3.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 for reused key with different body, got %d", resp3.StatusCode)
+	}
+	if resp, _ := post(`{"output_bucket":"test-bucket","command":"echo hello","shell":true,"timeout_sec":30}`, "retry-key-1"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 for reused key with a different timeout, got %d", resp.StatusCode)
+	}
+
+	// Keys are scoped to the submitter: another submitter's key creates a new job instead of a 409
+	resp7, createdByOther := post(`{"output_bucket":"test-bucket","command":"echo other","shell":true,"submitter":"other"}`, "retry-key-1")
+	if resp7.StatusCode != http.StatusCreated || createdByOther.JobID == created.JobID {
+		t.Errorf("Expected status 201 and a new job for another submitter, got %d (%s)", resp7.StatusCode, createdByOther.JobID)
+	}
+
+	// client_request_id in the body works the same way as the header
+	bodyWithID := `{"output_bucket":"test-bucket","command":"echo hello","shell":true,"client_request_id":"retry-key-2"}`
+	resp4, createdByField := post(bodyWithID, "")
+	if resp4.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp4.StatusCode)
+	}
+	resp5, replayedByField := post(bodyWithID, "")
+	if resp5.StatusCode != http.StatusOK || replayedByField.JobID != createdByField.JobID {
+		t.Errorf("Expected replay of %s with status 200, got %s with status %d", createdByField.JobID, replayedByField.JobID, resp5.StatusCode)
+	}
+
+	// Mismatched header and body key is rejected
+	resp6, _ := post(bodyWithID, "another-key")
+	if resp6.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for mismatched keys, got %d", resp6.StatusCode)
+	}
+
+	// Only the three distinct jobs were enqueued
+	size, err := inMemoryQueue.Size(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get queue size: %v", err)
+	}
+	if size != 3 {
+		t.Errorf("Expected queue size 3, got %d", size)
+	}
+}
+
+func TestHandleCreateJob_BucketAllowlist(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   "http://objstore.lab:9100",
+		LocalDir:  t.TempDir(),
+	}, []oss.BucketConfig{{Name: "lab-archive"}})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	handler.SetOSSProvider(buckets)
+
+	cases := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"input_bucket":"lab-archive","input_key":"in.bin","output_bucket":"lab-main"}`, http.StatusCreated},
+		{`{"input_bucket":"lab-main","input_key":"in.bin"}`, http.StatusCreated},
+		{`{"input_bucket":"someone-elses-bucket","input_key":"in.bin"}`, http.StatusBadRequest},
+		{`{"input_bucket":"lab-main","input_key":"in.bin","output_bucket":"someone-elses-bucket"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus {
+			t.Errorf("%s: status %d (%s), want %d", tc.body, resp.StatusCode, body, tc.wantStatus)
+		}
+		if tc.wantStatus == http.StatusBadRequest && !strings.Contains(string(body), "bucket someone-elses-bucket is not configured") {
+			t.Errorf("%s: unexpected error %s", tc.body, body)
+		}
+	}
+}
+
+func TestHandleCreateJob_NamedInputs(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   "http://objstore.lab:9100",
+		LocalDir:  t.TempDir(),
+	}, []oss.BucketConfig{{Name: "lab-models"}})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	handler.SetOSSProvider(buckets)
+
+	cases := []struct {
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{`{"command":"python run.py {input:model} {input:config}","shell":true,"inputs":{"model":{"bucket":"lab-models","key":"m.pt"},"config":{"bucket":"lab-main","key":"c.yaml"}}}`, http.StatusCreated, ""},
+		{`{"command":"python run.py {input:model}","shell":true,"inputs":{"config":{"bucket":"lab-main","key":"c.yaml"}}}`, http.StatusBadRequest, "{input:model}"},
+		{`{"command":"cat {input:a.b}","shell":true,"inputs":{"a.b":{"bucket":"lab-main","key":"c.yaml"}}}`, http.StatusBadRequest, "Invalid input name"},
+		{`{"inputs":{"model":{"bucket":"lab-main"}}}`, http.StatusBadRequest, "bucket and key are required"},
+		{`{"inputs":{"model":{"bucket":"someone-elses-bucket","key":"m.pt"}}}`, http.StatusBadRequest, "not configured"},
+		// Expected checksums are verified by the agent; they must be SHA-256 hex and name an input
+		{`{"inputs":{"model":{"bucket":"lab-main","key":"m.pt","sha256":"` + strings.Repeat("ab", 32) + `"}},"input_bucket":"lab-main","input_key":"d.csv","input_sha256":"` + strings.Repeat("CD", 32) + `"}`, http.StatusCreated, ""},
+		{`{"inputs":{"model":{"bucket":"lab-main","key":"m.pt","sha256":"abc"}}}`, http.StatusBadRequest, "sha256 must be 64 hex characters"},
+		{`{"input_sha256":"` + strings.Repeat("ab", 32) + `"}`, http.StatusBadRequest, "input_sha256 requires an input"},
+		{`{"input_bucket":"lab-main","input_key":"d.csv","input_sha256":"xyz"}`, http.StatusBadRequest, "input_sha256 must be 64 hex characters"},
+		// Forward jobs receive the inputs as a list; there is no command to check
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8080/run","inputs":{"data":{"bucket":"lab-main","key":"d.csv"}}}`, http.StatusCreated, ""},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantError) {
+			t.Errorf("%s: status %d (%s), want %d (%s)", tc.body, resp.StatusCode, body, tc.wantStatus, tc.wantError)
+			continue
+		}
+		if tc.wantStatus != http.StatusCreated {
+			continue
+		}
+		var created CreateJobResponse
+		json.Unmarshal(body, &created)
+		j, err := handler.jobStore.Get(created.JobID)
+		if err != nil || len(j.Inputs) == 0 {
+			t.Errorf("%s: inputs not stored: %v, %v", tc.body, j, err)
+		}
+	}
+}
+
+func TestHandleCreateJob_Timeout(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetTimeouts(&job.TimeoutConfig{Default: 10 * time.Minute, Max: time.Hour})
+
+	cases := []struct {
+		body        string
+		wantStatus  int
+		wantTimeout int
+	}{
+		{`{"command":"sleep 1","shell":true}`, http.StatusCreated, 600},
+		{`{"command":"sleep 1","shell":true,"timeout_sec":90}`, http.StatusCreated, 90},
+		{`{"command":"sleep 1","shell":true,"timeout_sec":3600}`, http.StatusCreated, 3600},
+		{`{"command":"sleep 1","shell":true,"timeout_sec":3601}`, http.StatusBadRequest, 0},
+		{`{"command":"sleep 1","shell":true,"timeout_sec":-5}`, http.StatusBadRequest, 0},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus {
+			t.Errorf("%s: status %d (%s), want %d", tc.body, resp.StatusCode, body, tc.wantStatus)
+			continue
+		}
+		if tc.wantStatus != http.StatusCreated {
+			continue
+		}
+		var created CreateJobResponse
+		json.Unmarshal(body, &created)
+		j, err := handler.jobStore.Get(created.JobID)
+		if err != nil || j.TimeoutSec != tc.wantTimeout {
+			t.Errorf("%s: timeout_sec = %v, want %d (%v)", tc.body, j, tc.wantTimeout, err)
+		}
+	}
+}
+
+func TestHandleCreateJob_Argv(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	cases := []struct {
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{`{"argv":["python","run.py","{input}","--out","{output}"],"env":{"OMP_NUM_THREADS":"4"},"working_dir":"src"}`, http.StatusCreated, ""},
+		{`{"command":"python run.py","shell":true,"argv":["python","run.py"]}`, http.StatusBadRequest, "mutually exclusive"},
+		{`{"argv":["","run.py"]}`, http.StatusBadRequest, "argv[0]"},
+		{`{"argv":["cat","{input:model}"]}`, http.StatusBadRequest, "{input:model}"},
+		{`{"argv":["env"],"env":{"OUT":"{input:data}"}}`, http.StatusBadRequest, "{input:data}"},
+		{`{"argv":["env"],"env":{"BAD-NAME":"x"}}`, http.StatusBadRequest, "Invalid env name"},
+		{`{"argv":["pwd"],"working_dir":"src/../.."}`, http.StatusBadRequest, "working_dir"},
+		{`{"argv":["pwd"],"working_dir":"..\\shared"}`, http.StatusBadRequest, "working_dir"},
+		// Absolute working directories are checked by the agent's policy
+		{`{"argv":["pwd"],"working_dir":"/srv/data"}`, http.StatusCreated, ""},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8080/run","env":{"A":"b"}}`, http.StatusBadRequest, "only supported for COMMAND"},
+		// The shell form stays available
+		{`{"command":"echo hi","shell":true,"env":{"GREETING":"hi"}}`, http.StatusCreated, ""},
+		// ... when the submitter asks for a shell
+		{`{"command":"echo hi"}`, http.StatusBadRequest, "requires shell: true"},
+		{`{"command":"echo hi","shell":false}`, http.StatusBadRequest, "requires shell: true"},
+		{`{"argv":["echo","hi"],"shell":true}`, http.StatusBadRequest, "shell requires a command"},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantError) {
+			t.Errorf("%s: status %d (%s), want %d (%s)", tc.body, resp.StatusCode, body, tc.wantStatus, tc.wantError)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(cases[0].body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var created CreateJobResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	j, err := handler.jobStore.Get(created.JobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if len(j.Argv) != 5 || j.Argv[2] != "{input}" || j.Command != "" || j.Env["OMP_NUM_THREADS"] != "4" || j.WorkingDir != "src" {
+		t.Errorf("Stored job: argv %q, command %q, env %v, working_dir %q", j.Argv, j.Command, j.Env, j.WorkingDir)
+	}
+}
+
+func TestHandleCreateJob_Template(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	cases := []struct {
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{`{"template":"resize","params":{"size":"640x480"}}`, http.StatusCreated, ""},
+		{`{"template":"resize","command":"convert {input} {output}","shell":true}`, http.StatusBadRequest, "cannot be combined"},
+		{`{"template":"resize","env":{"A":"b"}}`, http.StatusBadRequest, "cannot be combined"},
+		{`{"template":"re size"}`, http.StatusBadRequest, "Invalid template"},
+		{`{"command":"echo","shell":true,"params":{"size":"640x480"}}`, http.StatusBadRequest, "params require a template"},
+		{`{"template":"resize","params":{"a b":"1"}}`, http.StatusBadRequest, "Invalid param name"},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8080/run","template":"resize"}`, http.StatusBadRequest, "only supported for COMMAND"},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantError) {
+			t.Errorf("%s: status %d (%s), want %d (%s)", tc.body, resp.StatusCode, body, tc.wantStatus, tc.wantError)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(cases[0].body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var created CreateJobResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	j, err := handler.jobStore.Get(created.JobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if j.Template != "resize" || j.Params["size"] != "640x480" || j.Command != "" {
+		t.Errorf("Stored job: template %q, params %v, command %q", j.Template, j.Params, j.Command)
+	}
+}
+
+func TestHandleCreateJob_ForwardAsync(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	cases := []struct {
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8000/tasks","forward_async":{"status_url":"http://127.0.0.1:8000/tasks/{task_id}","result_url":"http://127.0.0.1:8000/tasks/{task_id}/result","succeeded_states":["done"]}}`, http.StatusCreated, ""},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8000/tasks","forward_async":{}}`, http.StatusCreated, ""},
+		{`{"command":"echo","shell":true,"forward_async":{}}`, http.StatusBadRequest, "only supported for FORWARD_HTTP"},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8000/tasks","forward_async":{"status_url":"file:///tmp/{task_id}"}}`, http.StatusBadRequest, "status_url must be an http or https URL"},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8000/tasks","forward_async":{"poll_interval_sec":-1}}`, http.StatusBadRequest, "poll_interval_sec"},
+		{`{"job_type":"FORWARD_HTTP","forward_url":"http://127.0.0.1:8000/tasks","forward_async":{"result_url":"http://127.0.0.1:8000/r","result_url_field":"url"}}`, http.StatusBadRequest, "mutually exclusive"},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantError) {
+			t.Errorf("%s: status %d (%s), want %d (%s)", tc.body, resp.StatusCode, body, tc.wantStatus, tc.wantError)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(cases[0].body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var created CreateJobResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	j, err := handler.jobStore.Get(created.JobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if j.ForwardAsync == nil || j.ForwardAsync.StatusURL != "http://127.0.0.1:8000/tasks/{task_id}" || len(j.ForwardAsync.SucceededStates) != 1 {
+		t.Errorf("Stored forward_async: %+v", j.ForwardAsync)
+	}
+}
+
+func TestHandleCreateJob_ForwardGRPC(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	cases := []struct {
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict","request":{"prompt":"cat"},"metadata":{"x-tenant":"lab"}},"forward_timeout_sec":30}`, http.StatusCreated, ""},
+		{`{"job_type":"forward_grpc","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict","request_proto":"CgNjYXQ="}}`, http.StatusCreated, ""},
+		{`{"job_type":"FORWARD_GRPC"}`, http.StatusBadRequest, "forward_grpc is required"},
+		{`{"command":"echo","shell":true,"forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict"}}`, http.StatusBadRequest, "only supported for FORWARD_GRPC"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1","method":"model.v1.Predictor/Predict"}}`, http.StatusBadRequest, "target must be host:port"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"Predict"}}`, http.StatusBadRequest, "fully qualified method"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict","request":"cat"}}`, http.StatusBadRequest, "request must be a JSON object"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict"},"forward_url":"http://127.0.0.1:8080/run"}`, http.StatusBadRequest, "only supported for FORWARD_HTTP"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict"},"forward_async":{}}`, http.StatusBadRequest, "only supported for FORWARD_HTTP"},
+		{`{"job_type":"FORWARD_GRPC","forward_grpc":{"target":"127.0.0.1:50051","method":"model.v1.Predictor/Predict"},"argv":["echo"]}`, http.StatusBadRequest, "only supported for COMMAND"},
+	}
+	for _, tc := range cases {
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantError) {
+			t.Errorf("%s: status %d (%s), want %d (%s)", tc.body, resp.StatusCode, body, tc.wantStatus, tc.wantError)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(cases[0].body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var created CreateJobResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	j, err := handler.jobStore.Get(created.JobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if j.JobType != job.JobTypeForwardGRPC || j.ForwardGRPC == nil || j.ForwardGRPC.Method != "model.v1.Predictor/Predict" || string(j.ForwardGRPC.Request) != `{"prompt":"cat"}` || j.ForwardTimeout != 30 {
+		t.Errorf("Stored job: type %s, forward_grpc %+v, forward_timeout %d", j.JobType, j.ForwardGRPC, j.ForwardTimeout)
+	}
+}
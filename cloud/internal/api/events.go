@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/events"
+	"github.com/xiresource/cloud/internal/job"
+)
+
+const (
+	// MaxJobWait caps the ?wait= long-poll duration on GET /api/jobs/{job_id}
+	MaxJobWait = 60 * time.Second
+
+	// jobWaitPollInterval re-reads the store while waiting, as a safety net for
+	// status changes that were not published to this instance's broker
+	jobWaitPollInterval = 2 * time.Second
+
+	// sseKeepaliveInterval keeps idle SSE connections open through proxies
+	sseKeepaliveInterval = 15 * time.Second
+)
+
+// parseWait parses the ?wait= query parameter.
+// Accepts a Go duration ("30s", "1m") or plain seconds ("30"). Values above MaxJobWait are capped.
+func parseWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid wait %q: use a duration like 30s", value)
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("invalid wait %q: must not be negative", value)
+	}
+	if wait > MaxJobWait {
+		wait = MaxJobWait
+	}
+	return wait, nil
+}
+
+// waitForJob returns the job as soon as it reaches a terminal state, or its latest state when the wait expires
+func (h *Handler) waitForJob(ctx context.Context, jobID string, wait time.Duration) (*job.Job, error) {
+	// Subscribe before reading so a change between the read and the subscription is not missed
+	var eventsC <-chan events.JobEvent
+	if h.events != nil {
+		sub := h.events.Subscribe(func(e events.JobEvent) bool { return e.JobID == jobID })
+		defer sub.Close()
+		eventsC = sub.C
+	}
+
+	j, err := h.jobStore.Get(jobID)
+	if err != nil || j.Status.IsTerminal() {
+		return j, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(jobWaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return j, nil
+		case <-timer.C:
+			return h.jobStore.Get(jobID)
+		case e := <-eventsC:
+			if e.Status.IsTerminal() {
+				return h.jobStore.Get(jobID)
+			}
+		case <-ticker.C:
+			j, err = h.jobStore.Get(jobID)
+			if err != nil || j.Status.IsTerminal() {
+				return j, err
+			}
+		}
+	}
+}
+
+// HandleJobEvents handles GET /api/jobs/events (Server-Sent Events stream of job status changes)
+// Query parameters (optional, combined with AND):
+// - job_id: job IDs to follow, comma-separated or repeated
+// - submitter: only jobs created with this submitter (forced to the key name for non-admin API keys)
+func (h *Handler) HandleJobEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.events == nil {
+		http.Error(w, "Job events are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var jobIDs []string
+	jobIDSet := make(map[string]bool)
+	for _, value := range r.URL.Query()["job_id"] {
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || jobIDSet[id] {
+				continue
+			}
+			if _, err := uuid.Parse(id); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid job_id format: %s", id), http.StatusBadRequest)
+				return
+			}
+			jobIDSet[id] = true
+			jobIDs = append(jobIDs, id)
+		}
+	}
+	submitter := strings.TrimSpace(r.URL.Query().Get("submitter"))
+	// Non-admin API keys only receive events for their own jobs
+	if principal := auth.FromContext(r.Context()); !principal.IsAdmin() {
+		if submitter != "" && submitter != principal.Name {
+			http.Error(w, "submitter must match the API key name", http.StatusForbidden)
+			return
+		}
+		submitter = principal.Name
+	}
+
+	sub := h.events.Subscribe(func(e events.JobEvent) bool {
+		if len(jobIDSet) > 0 && !jobIDSet[e.JobID] {
+			return false
+		}
+		return submitter == "" || e.Submitter == submitter
+	})
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+
+	// Send the current state of explicitly requested jobs first, so clients that
+	// subscribe after a change (or after the job finished) still see it
+	for _, id := range jobIDs {
+		j, err := h.jobStore.Get(id)
+		if err != nil {
+			continue
+		}
+		if submitter != "" && j.Submitter != submitter {
+			continue
+		}
+		if err := writeSSEEvent(w, events.NewJobEvent(j)); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-sub.C:
+			if err := writeSSEEvent(w, e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSEEvent writes one job event in text/event-stream format
+func writeSSEEvent(w http.ResponseWriter, e events.JobEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode job event: %v", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "event: job_status\ndata: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiresource/cloud/internal/events"
+	"github.com/xiresource/cloud/internal/job"
+)
+
+// createTestJob creates a job through the API and returns its ID
+func createTestJob(t *testing.T, serverURL string, body string) string {
+	t.Helper()
+	resp, err := http.Post(serverURL+"/api/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var created CreateJobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return created.JobID
+}
+
+// finishJob moves a job to SUCCEEDED in the store and publishes each change, as the gateway does
+func finishJob(t *testing.T, h *Handler, jobID string) {
+	t.Helper()
+	for _, status := range []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusSucceeded} {
+		if err := h.jobStore.UpdateStatus(jobID, status); err != nil {
+			t.Errorf("Failed to update job to %s: %v", status, err)
+			return
+		}
+		j, err := h.jobStore.Get(jobID)
+		if err != nil {
+			t.Errorf("Failed to get job: %v", err)
+			return
+		}
+		h.events.Publish(events.NewJobEvent(j))
+	}
+}
+
+func TestHandleGetJob_Wait(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetEvents(events.NewBroker())
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"echo hi","shell":true}`)
+
+	t.Run("ReturnsOnTerminalState", func(t *testing.T) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			finishJob(t, handler, jobID)
+		}()
+
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "?wait=10s")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var j job.Job
+		if err := json.NewDecoder(resp.Body).Decode(&j); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if j.Status != job.StatusSucceeded {
+			t.Errorf("Status = %s, want %s", j.Status, job.StatusSucceeded)
+		}
+		// Must be woken by the event, not the store poll or the wait timeout
+		if elapsed := time.Since(start); elapsed >= jobWaitPollInterval {
+			t.Errorf("Wait returned after %v, expected to return on the status event", elapsed)
+		}
+	})
+
+	t.Run("TimesOutWithCurrentState", func(t *testing.T) {
+		pendingID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"echo hi","shell":true}`)
+
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/api/jobs/" + pendingID + "?wait=200ms")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		var j job.Job
+		if err := json.NewDecoder(resp.Body).Decode(&j); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if j.Status != job.StatusPending {
+			t.Errorf("Status = %s, want %s", j.Status, job.StatusPending)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("Wait returned after %v, expected at least 200ms", elapsed)
+		}
+	})
+
+	t.Run("InvalidWait", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "?wait=soon")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestParseWait(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"15", 15 * time.Second, false},
+		{"10m", MaxJobWait, false},
+		{"-1s", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWait(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWait(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseWait(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHandleJobEvents(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetEvents(events.NewBroker())
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"echo hi","shell":true,"submitter":"alice"}`)
+	otherID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"echo hi","shell":true,"submitter":"bob"}`)
+
+	resp, err := http.Get(server.URL + "/api/jobs/events?submitter=alice")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+
+	received := make(chan events.JobEvent, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var e events.JobEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err == nil {
+				received <- e
+			}
+		}
+		close(received)
+	}()
+
+	// Wait until the stream is subscribed before publishing
+	deadline := time.Now().Add(2 * time.Second)
+	for handler.events.SubscriberCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	finishJob(t, handler, otherID) // filtered out (submitter bob)
+	finishJob(t, handler, jobID)
+
+	want := []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusSucceeded}
+	for _, status := range want {
+		select {
+		case e := <-received:
+			if e.JobID != jobID {
+				t.Fatalf("Received event for job %s, want only %s", e.JobID, jobID)
+			}
+			if e.Status != status {
+				t.Errorf("Status = %s, want %s", e.Status, status)
+			}
+			if e.Submitter != "alice" {
+				t.Errorf("Submitter = %s, want alice", e.Submitter)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", status)
+		}
+	}
+}
+
+func TestHandleJobEvents_JobIDSnapshot(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetEvents(events.NewBroker())
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"echo hi","shell":true}`)
+	finishJob(t, handler, jobID)
+
+	// A job that already finished is reported immediately
+	resp, err := http.Get(server.URL + "/api/jobs/events?job_id=" + jobID)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e events.JobEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		if e.JobID != jobID || e.Status != job.StatusSucceeded {
+			t.Errorf("Snapshot event = %s/%s, want %s/%s", e.JobID, e.Status, jobID, job.StatusSucceeded)
+		}
+		return
+	}
+	t.Fatal("Stream ended without a snapshot event")
+}
+
+func TestHandleJobEvents_InvalidJobID(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetEvents(events.NewBroker())
+
+	resp, err := http.Get(server.URL + "/api/jobs/events?job_id=not-a-uuid")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+}
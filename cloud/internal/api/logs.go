@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
+)
+
+// JobLogsResponse is returned by GET /api/jobs/{job_id}/logs
+type JobLogsResponse struct {
+	JobID     string       `json:"job_id"`
+	AttemptID int          `json:"attempt_id"`
+	Chunks    []logs.Chunk `json:"chunks"`
+	LastSeq   int64        `json:"last_seq"`  // Pass as ?after= to continue
+	Truncated bool         `json:"truncated"` // Earlier output is no longer in memory; see stdout.log/stderr.log
+	Done      bool         `json:"done"`      // The attempt's output is complete
+}
+
+// HandleGetJobLogs handles GET /api/jobs/{job_id}/logs
+// Returns the recent output of the job's current attempt as streamed by the agent.
+// The complete output is archived as stdout.log/stderr.log (GET /api/jobs/{job_id}/output?file=stdout.log)
+// when the attempt ends.
+// Query parameters:
+// - after: only chunks with a higher seq (default: 0, everything retained)
+// - stream: "stdout" or "stderr" (default: both)
+// - follow: "true" to stream chunks as Server-Sent Events until the output is complete
+func (h *Handler) HandleGetJobLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/logs")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		http.Error(w, "job_id is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := uuid.Parse(jobID); err != nil {
+		http.Error(w, "Invalid job_id format", http.StatusBadRequest)
+		return
+	}
+
+	if h.logs == nil {
+		http.Error(w, "Job logs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	var after int64
+	if afterStr := query.Get("after"); afterStr != "" {
+		a, err := strconv.ParseInt(afterStr, 10, 64)
+		if err != nil || a < 0 {
+			http.Error(w, "after must be a non-negative sequence number", http.StatusBadRequest)
+			return
+		}
+		after = a
+	}
+	stream := logs.Stream(query.Get("stream"))
+	if stream != "" && stream != logs.Stdout && stream != logs.Stderr {
+		http.Error(w, "stream must be stdout or stderr", http.StatusBadRequest)
+		return
+	}
+	follow, _ := strconv.ParseBool(query.Get("follow"))
+
+	j, ok := h.getAccessibleJob(w, r, jobID)
+	if !ok {
+		return
+	}
+
+	if follow {
+		// EventSource reconnects resume after the last received chunk
+		if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+			if a, err := strconv.ParseInt(lastID, 10, 64); err == nil && a > after {
+				after = a
+			}
+		}
+		h.followJobLogs(w, r, j, after, stream)
+		return
+	}
+
+	tail := h.jobLogTail(j, after)
+	writeJSON(w, http.StatusOK, JobLogsResponse{
+		JobID:     j.JobID,
+		AttemptID: j.AttemptID,
+		Chunks:    filterChunks(tail.Chunks, stream),
+		LastSeq:   max(tail.LastSeq, after),
+		Truncated: tail.Truncated,
+		Done:      tail.Done,
+	})
+}
+
+// jobLogTail returns the retained output of the job's current attempt after seq.
+// Without output of the current attempt the tail is empty, and done once the job is terminal.
+func (h *Handler) jobLogTail(j *job.Job, after int64) logs.Tail {
+	tail, ok := h.logs.Tail(j.JobID, after)
+	if !ok || tail.AttemptID != j.AttemptID {
+		tail = logs.Tail{AttemptID: j.AttemptID}
+	}
+	if j.Status.IsTerminal() {
+		tail.Done = true
+	}
+	if tail.Chunks == nil {
+		tail.Chunks = []logs.Chunk{}
+	}
+	return tail
+}
+
+// followJobLogs streams the job's output as Server-Sent Events: "log" events (id: seq) carry chunks,
+// a "truncated" event marks output that is no longer in memory, and "eof" ends the stream
+func (h *Handler) followJobLogs(w http.ResponseWriter, r *http.Request, j *job.Job, after int64, stream logs.Stream) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+	// Job status changes are not signalled by the log store (e.g. a job that ends without output)
+	poll := time.NewTicker(jobWaitPollInterval)
+	defer poll.Stop()
+
+	for {
+		var changed <-chan struct{}
+		tail, ok := h.logs.Tail(j.JobID, after)
+		if ok && tail.AttemptID == j.AttemptID {
+			changed = tail.Changed
+			if tail.Truncated {
+				if err := writeSSE(w, "truncated", "", map[string]int64{"after": after}); err != nil {
+					return
+				}
+			}
+			for _, chunk := range tail.Chunks {
+				after = chunk.Seq
+				if stream != "" && chunk.Stream != stream {
+					continue
+				}
+				if err := writeSSE(w, "log", strconv.FormatInt(chunk.Seq, 10), chunk); err != nil {
+					return
+				}
+			}
+			after = max(after, tail.LastSeq)
+		}
+		if (ok && tail.AttemptID == j.AttemptID && tail.Done) || j.Status.IsTerminal() {
+			writeSSE(w, "eof", "", map[string]interface{}{"attempt_id": j.AttemptID, "last_seq": after})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			latest, err := h.jobStore.Get(j.JobID)
+			if err != nil {
+				log.Printf("Failed to get job %s while following logs: %v", j.JobID, err)
+				continue
+			}
+			if latest.AttemptID != j.AttemptID {
+				// A retry started: its output is a new log
+				after = 0
+			}
+			j = latest
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Event with a JSON payload
+func writeSSE(w http.ResponseWriter, event, id string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event, err)
+		return nil
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", event, id, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	}
+	return err
+}
+
+// filterChunks keeps the chunks of one stream ("" keeps all)
+func filterChunks(chunks []logs.Chunk, stream logs.Stream) []logs.Chunk {
+	if stream == "" {
+		return chunks
+	}
+	filtered := []logs.Chunk{}
+	for _, chunk := range chunks {
+		if chunk.Stream == stream {
+			filtered = append(filtered, chunk)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
+)
+
+func newTestLogStore(t *testing.T) *logs.Store {
+	t.Helper()
+	cfg := logs.DefaultConfig()
+	cfg.SpoolDir = t.TempDir()
+	return logs.NewStore(cfg)
+}
+
+func getJobLogs(t *testing.T, url string) (int, JobLogsResponse) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	var body JobLogsResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode, body
+}
+
+func TestHandleGetJobLogs(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"python train.py","shell":true}`)
+	logsURL := server.URL + "/api/jobs/" + jobID + "/logs"
+
+	if status, _ := getJobLogs(t, logsURL); status != http.StatusServiceUnavailable {
+		t.Errorf("Without log store: status %d, want 503", status)
+	}
+
+	store := newTestLogStore(t)
+	handler.SetLogs(store)
+
+	// Nothing streamed yet
+	status, body := getJobLogs(t, logsURL)
+	if status != http.StatusOK || body.JobID != jobID || body.AttemptID != 1 || len(body.Chunks) != 0 || body.Done {
+		t.Errorf("Before output: status %d, body %+v", status, body)
+	}
+
+	store.Append(jobID, 1, 1, logs.Stdout, []byte("epoch 1\n"), 0, false)
+	store.Append(jobID, 1, 2, logs.Stderr, []byte("warning\n"), 0, false)
+	store.Append(jobID, 1, 3, logs.Stdout, []byte("epoch 2\n"), 0, false)
+
+	status, body = getJobLogs(t, logsURL)
+	if status != http.StatusOK || len(body.Chunks) != 3 || body.LastSeq != 3 || body.Done || body.Truncated {
+		t.Fatalf("Tail: status %d, body %+v", status, body)
+	}
+	if body.Chunks[1].Stream != logs.Stderr || body.Chunks[1].Data != "warning\n" {
+		t.Errorf("Chunk 2 = %+v", body.Chunks[1])
+	}
+
+	_, body = getJobLogs(t, logsURL+"?after=1&stream=stdout")
+	if len(body.Chunks) != 1 || body.Chunks[0].Data != "epoch 2\n" || body.LastSeq != 3 {
+		t.Errorf("after=1&stream=stdout: %+v", body)
+	}
+
+	for _, query := range []string{"?after=-1", "?after=x", "?stream=both"} {
+		if status, _ := getJobLogs(t, logsURL+query); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, status)
+		}
+	}
+	if status, _ := getJobLogs(t, server.URL+"/api/jobs/00000000-0000-0000-0000-000000000000/logs"); status != http.StatusNotFound {
+		t.Errorf("Unknown job: status %d, want 404", status)
+	}
+
+	// Logs of an earlier attempt are not shown for the current one
+	if err := handler.jobStore.UpdateAttemptID(jobID, 2); err != nil {
+		t.Fatalf("Failed to update attempt: %v", err)
+	}
+	if _, body = getJobLogs(t, logsURL); body.AttemptID != 2 || len(body.Chunks) != 0 {
+		t.Errorf("New attempt: %+v", body)
+	}
+
+	// A finished job is done even if the agent never sent eof
+	for _, s := range []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusFailed} {
+		if err := handler.jobStore.UpdateStatus(jobID, s); err != nil {
+			t.Fatalf("Failed to update job to %s: %v", s, err)
+		}
+	}
+	if _, body = getJobLogs(t, logsURL); !body.Done {
+		t.Errorf("Failed job: done = false")
+	}
+}
+
+func TestHandleGetJobLogs_Follow(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	store := newTestLogStore(t)
+	handler.SetLogs(store)
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"python train.py","shell":true}`)
+	store.Append(jobID, 1, 1, logs.Stdout, []byte("epoch 1\n"), 0, false)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/jobs/"+jobID+"/logs?follow=true", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+
+	type event struct{ name, id, data string }
+	received := make(chan event, 16)
+	go func() {
+		defer close(received)
+		var e event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && e.name != "":
+				received <- e
+				e = event{}
+			}
+		}
+	}()
+	next := func() event {
+		t.Helper()
+		select {
+		case e, ok := <-received:
+			if !ok {
+				t.Fatalf("Stream closed early")
+			}
+			return e
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for an event")
+		}
+		return event{}
+	}
+
+	// Retained output first, then live chunks, then eof
+	if e := next(); e.name != "log" || e.id != "1" || !strings.Contains(e.data, `"data":"epoch 1\n"`) {
+		t.Errorf("First event = %+v", e)
+	}
+	store.Append(jobID, 1, 2, logs.Stderr, []byte("warning\n"), 0, false)
+	if e := next(); e.name != "log" || e.id != "2" || !strings.Contains(e.data, `"stream":"stderr"`) {
+		t.Errorf("Second event = %+v", e)
+	}
+	store.Append(jobID, 1, 3, logs.Stdout, nil, 0, true)
+	if e := next(); e.name != "eof" || !strings.Contains(e.data, `"last_seq":3`) {
+		t.Errorf("Last event = %+v", e)
+	}
+	if _, ok := <-received; ok {
+		t.Errorf("Stream not closed after eof")
+	}
+}
+
+func TestHandleGetJobOutput_ArchivedLogs(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	provider := &mockOSSProvider{objects: map[string]bool{}}
+	handler.SetOSSProvider(provider)
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","command":"python train.py","shell":true}`)
+	prefix := "jobs/" + jobID + "/1/"
+	if err := handler.jobStore.UpdateOutput(jobID, "", prefix); err != nil {
+		t.Fatalf("Failed to update output: %v", err)
+	}
+	provider.objects[prefix+"stdout.log"] = true
+
+	get := func() (int, JobOutputResponse) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "/output?file=stdout.log")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		var body JobOutputResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, _ := get(); status != http.StatusConflict {
+		t.Errorf("Running job: status %d, want 409", status)
+	}
+
+	// Logs are archived whatever the outcome
+	for _, s := range []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusFailed} {
+		if err := handler.jobStore.UpdateStatus(jobID, s); err != nil {
+			t.Fatalf("Failed to update job to %s: %v", s, err)
+		}
+	}
+	status, body := get()
+	if status != http.StatusOK || body.OutputKey != prefix+"stdout.log" {
+		t.Errorf("Failed job: status %d, body %+v", status, body)
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
+	"github.com/xiresource/cloud/internal/oss"
+)
+
+// objectChecker is implemented by OSS providers that can HEAD an object (e.g. COSProvider).
+// When available, missing outputs are reported as 404 instead of handing out a dead URL.
+type objectChecker interface {
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
+
+// JobOutputResponse is returned by GET /api/jobs/{job_id}/output
+type JobOutputResponse struct {
+	JobID     string `json:"job_id"`
+	AttemptID int    `json:"attempt_id"`
+	OutputKey string `json:"output_key"`
+	URL       string `json:"url"` // Short-lived presigned GET URL; download directly from OSS
+}
+
+// HandleGetJobOutput handles GET /api/jobs/{job_id}/output
+// Returns a presigned download URL for a job's output file; the file itself never passes through this server.
+// Query parameters:
+// - attempt: attempt number (default: the job's current attempt)
+// - file: output file path relative to the output prefix (e.g. "plots/loss.png"); must be listed in output_files (or stdout.log/stderr.log once the job ended)
+// - redirect: "true" to answer with 302 to the presigned URL instead of JSON
+func (h *Handler) HandleGetJobOutput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/output")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		http.Error(w, "job_id is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := uuid.Parse(jobID); err != nil {
+		http.Error(w, "Invalid job_id format", http.StatusBadRequest)
+		return
+	}
+
+	if h.oss == nil {
+		http.Error(w, "Output downloads are not available: OSS provider not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	j, ok := h.getAccessibleJob(w, r, jobID)
+	if !ok {
+		return
+	}
+
+	attemptID := j.AttemptID
+	if attemptStr := r.URL.Query().Get("attempt"); attemptStr != "" {
+		a, err := strconv.Atoi(attemptStr)
+		if err != nil || a < 1 || a > j.AttemptID {
+			http.Error(w, fmt.Sprintf("attempt must be between 1 and %d", j.AttemptID), http.StatusBadRequest)
+			return
+		}
+		attemptID = a
+	}
+	file := r.URL.Query().Get("file")
+	if file != "" && !job.ValidOutputFilePath(file) {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	var outputKey string
+	if attemptID == j.AttemptID && isLogFile(file) {
+		if !j.Status.IsTerminal() {
+			http.Error(w, fmt.Sprintf("Job logs are archived when the job ends (status: %s); use /logs to follow them", j.Status), http.StatusConflict)
+			return
+		}
+		outputKey = j.OutputPrefix + file
+	} else if attemptID == j.AttemptID {
+		if j.Status != job.StatusSucceeded {
+			http.Error(w, fmt.Sprintf("Job output is not available (status: %s)", j.Status), http.StatusConflict)
+			return
+		}
+		outputKey = j.OutputKey
+		if file != "" {
+			outputKey = outputFileKey(j, file)
+		}
+	} else if file != "" {
+		outputKey = j.OutputPrefixForAttempt(attemptID) + file
+	} else {
+		// Earlier attempts are not tracked individually; their keys follow the gateway's layout
+		outputKey = j.OutputKeyForAttempt(attemptID)
+	}
+	if outputKey == "" {
+		if file != "" {
+			http.Error(w, fmt.Sprintf("Job has no output file %s", file), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Job has no output file", http.StatusNotFound)
+		return
+	}
+
+	provider, err := oss.ForBucket(h.oss, j.OutputBucket)
+	if err != nil {
+		log.Printf("Failed to get OSS provider for job %s output: %v", jobID, err)
+		http.Error(w, fmt.Sprintf("Job output is not available: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	if checker, ok := provider.(objectChecker); ok {
+		exists, err := checker.ObjectExists(r.Context(), outputKey)
+		if err != nil {
+			log.Printf("Failed to check output object for job %s: %v", jobID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Job output file not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	url, err := provider.GenerateDownloadURL(r.Context(), outputKey)
+	if err != nil {
+		log.Printf("Failed to generate output download URL for job %s: %v", jobID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Presigned URLs are bearer credentials: never cache them in shared caches
+	w.Header().Set("Cache-Control", "no-store")
+	if redirect, _ := strconv.ParseBool(r.URL.Query().Get("redirect")); redirect {
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JobOutputResponse{
+		JobID:     j.JobID,
+		AttemptID: attemptID,
+		OutputKey: outputKey,
+		URL:       url,
+	})
+}
+
+// isLogFile reports whether file names an archived log (stdout.log, stderr.log)
+func isLogFile(file string) bool {
+	for _, stream := range logs.Streams {
+		if file == stream.FileName() {
+			return true
+		}
+	}
+	return false
+}
+
+// outputFileKey returns the key of file in the current attempt's output manifest, or "" if it is not listed
+func outputFileKey(j *job.Job, file string) string {
+	key := j.OutputPrefix + file
+	if key == j.ManifestKey() {
+		return key
+	}
+	for _, f := range j.OutputFiles {
+		if f.Key == key {
+			return key
+		}
+	}
+	return ""
+}
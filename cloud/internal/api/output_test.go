@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/job"
+)
+
+// mockOSSProvider presigns fake URLs and reports which objects exist
+type mockOSSProvider struct {
+	objects map[string]bool
+}
+
+func (m *mockOSSProvider) GenerateDownloadURL(ctx context.Context, key string) (string, error) {
+	return "https://oss.example.com/" + key + "?sign=test", nil
+}
+
+func (m *mockOSSProvider) GenerateUploadURL(ctx context.Context, key string) (string, error) {
+	return "https://oss.example.com/" + key + "?sign=put", nil
+}
+
+func (m *mockOSSProvider) GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error) {
+	return m.GenerateUploadURL(ctx, prefix+filename)
+}
+
+func (m *mockOSSProvider) ObjectExists(ctx context.Context, key string) (bool, error) {
+	return m.objects[key], nil
+}
+
+// succeedWithOutput finishes a job the way the gateway does for the given attempt
+func succeedWithOutput(t *testing.T, h *Handler, jobID string, attemptID int) string {
+	t.Helper()
+	if err := h.jobStore.UpdateAttemptID(jobID, attemptID); err != nil {
+		t.Fatalf("Failed to update attempt: %v", err)
+	}
+	j, err := h.jobStore.Get(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	outputKey := j.OutputKeyForAttempt(attemptID)
+	if err := h.jobStore.UpdateOutput(jobID, outputKey, ""); err != nil {
+		t.Fatalf("Failed to update output: %v", err)
+	}
+	for _, status := range []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusSucceeded} {
+		if err := h.jobStore.UpdateStatus(jobID, status); err != nil {
+			t.Fatalf("Failed to update job to %s: %v", status, err)
+		}
+	}
+	return outputKey
+}
+
+func TestHandleGetJobOutput(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+
+	jobID := createTestJob(t, server.URL, `{"output_bucket":"test-bucket","output_extension":"json","command":"echo hi","shell":true}`)
+
+	// No provider configured
+	resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "/output")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Without OSS provider: status %d, want 503", resp.StatusCode)
+	}
+
+	provider := &mockOSSProvider{objects: map[string]bool{}}
+	handler.SetOSSProvider(provider)
+
+	// Not finished yet
+	resp, err = http.Get(server.URL + "/api/jobs/" + jobID + "/output")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Pending job: status %d, want 409", resp.StatusCode)
+	}
+
+	outputKey := succeedWithOutput(t, handler, jobID, 2)
+	if outputKey != "jobs/"+jobID+"/2/output.json" {
+		t.Fatalf("Unexpected output key %s", outputKey)
+	}
+
+	// Object missing in OSS
+	resp, err = http.Get(server.URL + "/api/jobs/" + jobID + "/output")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Missing object: status %d, want 404", resp.StatusCode)
+	}
+
+	provider.objects[outputKey] = true
+	provider.objects["jobs/"+jobID+"/1/output.json"] = true
+
+	t.Run("LatestAttempt", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "/output")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", resp.Header.Get("Cache-Control"))
+		}
+		var out JobOutputResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if out.JobID != jobID || out.AttemptID != 2 || out.OutputKey != outputKey || !strings.Contains(out.URL, outputKey) {
+			t.Errorf("Unexpected response: %+v", out)
+		}
+	})
+
+	t.Run("EarlierAttemptRedirect", func(t *testing.T) {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(server.URL + "/api/jobs/" + jobID + "/output?attempt=1&redirect=true")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("Expected status 302, got %d", resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); !strings.Contains(loc, "jobs/"+jobID+"/1/output.json") {
+			t.Errorf("Location = %s, want attempt 1 output", loc)
+		}
+	})
+
+	t.Run("InvalidAttempt", func(t *testing.T) {
+		for _, attempt := range []string{"0", "3", "x"} {
+			resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "/output?attempt=" + attempt)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("attempt=%s: status %d, want 400", attempt, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("OutputFiles", func(t *testing.T) {
+		prefix := "jobs/" + jobID + "/2/"
+		handler.jobStore.UpdateOutput(jobID, outputKey, prefix)
+		handler.jobStore.UpdateOutputFiles(jobID, []job.OutputFile{
+			{Key: outputKey, Size: 2, SHA256: strings.Repeat("0", 64), ContentType: "application/json"},
+			{Key: prefix + "plots/loss.png", Size: 10, SHA256: strings.Repeat("1", 64), ContentType: "image/png"},
+		})
+		provider.objects[prefix+"plots/loss.png"] = true
+		provider.objects[prefix+"manifest.json"] = true
+
+		resp, err := http.Get(server.URL + "/api/jobs/" + jobID)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		var j job.Job
+		json.NewDecoder(resp.Body).Decode(&j)
+		resp.Body.Close()
+		if len(j.OutputFiles) != 2 || j.OutputFiles[1].Key != prefix+"plots/loss.png" {
+			t.Errorf("GET job output_files = %+v", j.OutputFiles)
+		}
+
+		cases := map[string]int{
+			"plots/loss.png":    http.StatusOK,
+			"manifest.json":     http.StatusOK,
+			"plots/missing.png": http.StatusNotFound,
+			"../1/output.json":  http.StatusBadRequest,
+			"plots//loss.png":   http.StatusBadRequest,
+		}
+		for file, want := range cases {
+			resp, err := http.Get(server.URL + "/api/jobs/" + jobID + "/output?file=" + file)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			var out JobOutputResponse
+			json.NewDecoder(resp.Body).Decode(&out)
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("file=%s: status %d, want %d", file, resp.StatusCode, want)
+			}
+			if want == http.StatusOK && (out.OutputKey != prefix+file || !strings.Contains(out.URL, prefix+file)) {
+				t.Errorf("file=%s: unexpected response %+v", file, out)
+			}
+		}
+	})
+}
+
+func TestHandleGetJobOutput_OtherSubmitter(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	handler.SetOSSProvider(&mockOSSProvider{objects: map[string]bool{}})
+
+	jobID := createTestJob(t, server.URL, `{"command":"echo","shell":true,"submitter":"lab"}`)
+	outputKey := succeedWithOutput(t, handler, jobID, 1)
+	handler.oss.(*mockOSSProvider).objects[outputKey] = true
+
+	// Outputs of jobs owned by another API key are reported as not found
+	for _, tc := range []struct {
+		principal *auth.Principal
+		want      int
+	}{{&auth.Principal{Name: "lab"}, http.StatusOK}, {&auth.Principal{Name: "other"}, http.StatusNotFound}} {
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+jobID+"/output", nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), tc.principal))
+		rec := httptest.NewRecorder()
+		handler.HandleGetJobOutput(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("GET output as %s: status %d, want %d", tc.principal.Name, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/oss"
+	"github.com/xiresource/cloud/internal/upload"
+)
+
+// CreateUploadRequest represents the request body for reserving an input upload
+type CreateUploadRequest struct {
+	Filename    string `json:"filename,omitempty"`     // Optional: last key segment (default: "input")
+	ContentType string `json:"content_type,omitempty"` // Optional: default application/octet-stream
+	Size        int64  `json:"size"`                   // Required: exact size of the file in bytes
+}
+
+// CreateUploadResponse tells the client where and how to PUT the file
+type CreateUploadResponse struct {
+	UploadID  string            `json:"upload_id"`
+	Bucket    string            `json:"bucket"`
+	Key       string            `json:"key"`
+	URL       string            `json:"url"`     // Presigned PUT URL
+	Method    string            `json:"method"`  // Always PUT
+	Headers   map[string]string `json:"headers"` // Headers the PUT must send (signed into the URL when supported)
+	MaxSize   int64             `json:"max_size"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// HandleCreateUpload handles POST /api/uploads
+// Reserves a key under inputs/{upload_id}/ and returns a presigned PUT URL, so submitters
+// can place inputs in OSS without their own OSS credentials. The file goes straight to OSS.
+func (h *Handler) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.uploads == nil || h.oss == nil {
+		http.Error(w, "Uploads are not available: OSS provider not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req CreateUploadRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	filename, err := upload.ValidateFilename(req.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType, err := h.uploadConfig.ValidateContentType(req.ContentType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.uploadConfig.ValidateSize(req.Size); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	uploadID := uuid.New().String()
+	u := &upload.Upload{
+		ID:          uploadID,
+		Bucket:      h.uploadConfig.Bucket,
+		Key:         upload.Key(uploadID, filename),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        req.Size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(h.uploadConfig.PresignTTL),
+	}
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		u.Submitter = principal.Name
+	}
+
+	provider, err := oss.ForBucket(h.oss, u.Bucket)
+	if err != nil {
+		log.Printf("Failed to get OSS provider for uploads: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Bind content type and size into the signature so OSS rejects anything else
+	var url string
+	if uploader, ok := provider.(oss.ConstrainedUploader); ok {
+		url, err = uploader.GenerateConstrainedUploadURL(r.Context(), u.Key, oss.UploadConstraints{
+			ContentType:   contentType,
+			ContentLength: req.Size,
+		})
+	} else {
+		url, err = provider.GenerateUploadURL(r.Context(), u.Key)
+	}
+	if err != nil {
+		log.Printf("Failed to generate upload URL for upload %s: %v", uploadID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.uploads.Create(u); err != nil {
+		log.Printf("Failed to create upload: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, CreateUploadResponse{
+		UploadID: u.ID,
+		Bucket:   u.Bucket,
+		Key:      u.Key,
+		URL:      url,
+		Method:   http.MethodPut,
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(req.Size, 10),
+		},
+		MaxSize:   h.uploadConfig.MaxSize,
+		ExpiresAt: u.ExpiresAt,
+	})
+}
+
+// resolveUpload turns a job's upload_id into its input bucket and key.
+// The upload must belong to the caller and, when the provider can check, must already be in OSS.
+// On failure the error response has been written and ok is false.
+func (h *Handler) resolveUpload(w http.ResponseWriter, r *http.Request, uploadID string) (*upload.Upload, bool) {
+	if h.uploads == nil {
+		http.Error(w, "upload_id is not supported: uploads are not enabled", http.StatusBadRequest)
+		return nil, false
+	}
+
+	u, err := h.uploads.Get(strings.TrimSpace(uploadID))
+	if err == upload.ErrUploadNotFound || (err == nil && !auth.FromContext(r.Context()).CanAccess(u.Submitter)) {
+		http.Error(w, fmt.Sprintf("upload_id %s not found", uploadID), http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get upload: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	provider, err := oss.ForBucket(h.oss, u.Bucket)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("upload_id %s: %v", uploadID, err), http.StatusBadRequest)
+		return nil, false
+	}
+	if checker, ok := provider.(objectChecker); ok {
+		exists, err := checker.ObjectExists(r.Context(), u.Key)
+		if err != nil {
+			log.Printf("Failed to check upload object %s: %v", u.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+		if !exists {
+			http.Error(w, fmt.Sprintf("upload %s has not been completed: PUT the file to the upload URL first", u.ID), http.StatusConflict)
+			return nil, false
+		}
+	}
+	return u, true
+}
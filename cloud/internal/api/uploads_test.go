@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/oss"
+	"github.com/xiresource/cloud/internal/upload"
+)
+
+// constrainedOSSProvider records the constraints signed into upload URLs
+type constrainedOSSProvider struct {
+	mockOSSProvider
+	constraints oss.UploadConstraints
+}
+
+func (m *constrainedOSSProvider) GenerateConstrainedUploadURL(ctx context.Context, key string, c oss.UploadConstraints) (string, error) {
+	m.constraints = c
+	return m.GenerateUploadURL(ctx, key)
+}
+
+func setupUploads(t *testing.T, h *Handler, provider oss.Provider) {
+	store, err := upload.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create upload store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	cfg := upload.DefaultConfig()
+	cfg.Bucket = "input-bucket"
+	cfg.MaxSize = 1 << 20
+	h.SetUploadStore(store, cfg)
+	h.SetOSSProvider(provider)
+}
+
+func TestHandleCreateUpload(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	provider := &constrainedOSSProvider{mockOSSProvider: mockOSSProvider{objects: map[string]bool{}}}
+	setupUploads(t, handler, provider)
+
+	resp, err := http.Post(server.URL+"/api/uploads", "application/json",
+		strings.NewReader(`{"filename":"data.csv","content_type":"text/csv","size":2048}`))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var created CreateUploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Key != "inputs/"+created.UploadID+"/data.csv" || created.Bucket != "input-bucket" || created.Method != http.MethodPut {
+		t.Errorf("Unexpected upload: %+v", created)
+	}
+	if !strings.Contains(created.URL, created.Key) || created.Headers["Content-Length"] != "2048" {
+		t.Errorf("Unexpected URL/headers: %s %v", created.URL, created.Headers)
+	}
+	if provider.constraints.ContentType != "text/csv" || provider.constraints.ContentLength != 2048 {
+		t.Errorf("Constraints = %+v, want text/csv and 2048 bytes", provider.constraints)
+	}
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		for _, body := range []string{
+			`{"size":0}`,
+			`{"size":2097152}`,
+			`{"filename":"../x","size":10}`,
+			`{"content_type":"not a type","size":10}`,
+		} {
+			resp, err := http.Post(server.URL+"/api/uploads", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: status %d, want 400", body, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("JobReferencesUpload", func(t *testing.T) {
+		jobBody := `{"upload_id":"` + created.UploadID + `","command":"python analyze.py {input} {output}","shell":true}`
+
+		// Not uploaded yet
+		resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(jobBody))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Job before upload completed: status %d, want 409", resp.StatusCode)
+		}
+
+		provider.objects[created.Key] = true
+		jobID := createTestJob(t, server.URL, jobBody)
+		j, err := handler.jobStore.Get(jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if j.InputBucket != "input-bucket" || j.InputKey != created.Key {
+			t.Errorf("Job input = %s/%s, want input-bucket/%s", j.InputBucket, j.InputKey, created.Key)
+		}
+
+		for _, body := range []string{
+			`{"upload_id":"missing","command":"echo","shell":true}`,
+			`{"upload_id":"` + created.UploadID + `","input_bucket":"b","input_key":"k","command":"echo","shell":true}`,
+		} {
+			resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: status %d, want 400", body, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("OtherKeyCannotUseUpload", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/uploads", strings.NewReader(`{"size":10}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Name: "lab"}))
+		rec := httptest.NewRecorder()
+		handler.HandleCreateUpload(rec, req)
+		var owned CreateUploadResponse
+		json.NewDecoder(rec.Body).Decode(&owned)
+		provider.objects[owned.Key] = true
+
+		req = httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(`{"upload_id":"`+owned.UploadID+`","command":"echo","shell":true}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Name: "other"}))
+		rec = httptest.NewRecorder()
+		handler.HandleCreateJob(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Foreign upload_id: status %d, want 400", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/auth"
+	"github.com/xiresource/cloud/internal/webhook"
+)
+
+// minWebhookSecretLength is the minimum length of a client-supplied signing secret
+const minWebhookSecretLength = 16
+
+// CreateWebhookRequest represents the request body for registering a webhook
+type CreateWebhookRequest struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	Secret      string `json:"secret,omitempty"` // Optional: generated if omitted
+	Owner       string `json:"owner,omitempty"`  // Optional: API key name whose jobs may use the webhook (default: the caller's key)
+}
+
+// CreateWebhookResponse is returned once on registration; the secret is not retrievable later
+type CreateWebhookResponse struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Owner       string    `json:"owner"`
+	Secret      string    `json:"secret"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// HandleWebhooks handles POST /api/webhooks (register) and GET /api/webhooks (list)
+func (h *Handler) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if h.webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handleCreateWebhook(w, r)
+	case http.MethodGet:
+		subs, err := h.webhooks.ListSubscriptions()
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, subs)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if err := webhook.ValidateURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Printf("Failed to generate webhook secret: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	} else if len(secret) < minWebhookSecretLength {
+		http.Error(w, fmt.Sprintf("secret must be at least %d characters", minWebhookSecretLength), http.StatusBadRequest)
+		return
+	}
+
+	owner := strings.TrimSpace(req.Owner)
+	if principal := auth.FromContext(r.Context()); owner == "" && principal != nil {
+		owner = principal.Name
+	}
+
+	sub := &webhook.Subscription{
+		ID:          uuid.New().String(),
+		URL:         req.URL,
+		Secret:      secret,
+		Description: req.Description,
+		Owner:       owner,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := h.webhooks.CreateSubscription(sub); err != nil {
+		log.Printf("Failed to create webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, CreateWebhookResponse{
+		ID:          sub.ID,
+		URL:         sub.URL,
+		Description: sub.Description,
+		Owner:       sub.Owner,
+		Secret:      sub.Secret,
+		CreatedAt:   sub.CreatedAt,
+	})
+}
+
+// HandleWebhook handles GET/DELETE /api/webhooks/{id} and GET /api/webhooks/dead-letters
+func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if h.webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/webhooks/")
+	if id == "" || id == r.URL.Path || strings.Contains(id, "/") {
+		http.Error(w, "webhook id is required", http.StatusBadRequest)
+		return
+	}
+
+	if id == "dead-letters" {
+		h.handleListDeadLetters(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sub, err := h.webhooks.GetSubscription(id)
+		if err == webhook.ErrSubscriptionNotFound {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get webhook: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodDelete:
+		err := h.webhooks.DeleteSubscription(id)
+		if err == webhook.ErrSubscriptionNotFound {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to delete webhook: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleListDeadLetters handles GET /api/webhooks/dead-letters
+func (h *Handler) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+	}
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	deadLetters, err := h.webhooks.ListDeadLetters(limit, offset)
+	if err != nil {
+		log.Printf("Failed to list webhook dead letters: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, deadLetters)
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiresource/cloud/internal/webhook"
+)
+
+func setupWebhookStore(t *testing.T, h *Handler) webhook.Store {
+	store, err := webhook.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create webhook store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	h.SetWebhookStore(store)
+	return store
+}
+
+func TestHandleWebhooks_Lifecycle(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	store := setupWebhookStore(t, handler)
+
+	// Register
+	resp, err := http.Post(server.URL+"/api/webhooks", "application/json",
+		strings.NewReader(`{"url":"https://lab.example.com/hooks/jobs","description":"lab front-end"}`))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var created CreateWebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.ID == "" || len(created.Secret) < minWebhookSecretLength {
+		t.Errorf("Expected id and generated secret, got %+v", created)
+	}
+
+	// List must not expose the secret
+	listResp, err := http.Get(server.URL + "/api/webhooks")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer listResp.Body.Close()
+	var listed []map[string]interface{}
+	if err := json.NewDecoder(listResp.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listed) != 1 {
+		t.Fatalf("Expected 1 webhook, got %d", len(listed))
+	}
+	if _, ok := listed[0]["secret"]; ok {
+		t.Error("Webhook list must not include the secret")
+	}
+
+	// Jobs can reference the subscription
+	jobResp, err := http.Post(server.URL+"/api/jobs", "application/json",
+		strings.NewReader(`{"output_bucket":"test-bucket","command":"echo hi","shell":true,"webhook_id":"`+created.ID+`"}`))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	jobResp.Body.Close()
+	if jobResp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status 201 for job with webhook_id, got %d", jobResp.StatusCode)
+	}
+
+	// Dead letters are listed
+	if err := store.AddDeadLetter(&webhook.DeadLetter{JobID: "job-1", WebhookID: created.ID, URL: created.URL, Payload: "{}", Attempts: 5, LastError: "unexpected status 500", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddDeadLetter() error = %v", err)
+	}
+	dlResp, err := http.Get(server.URL + "/api/webhooks/dead-letters")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer dlResp.Body.Close()
+	var deadLetters []webhook.DeadLetter
+	if err := json.NewDecoder(dlResp.Body).Decode(&deadLetters); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].LastError != "unexpected status 500" {
+		t.Errorf("Unexpected dead letters: %+v", deadLetters)
+	}
+
+	// Delete
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/webhooks/"+created.ID, nil)
+	delResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	delResp.Body.Close()
+	if delResp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", delResp.StatusCode)
+	}
+	getResp, err := http.Get(server.URL + "/api/webhooks/" + created.ID)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	getResp.Body.Close()
+	if getResp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", getResp.StatusCode)
+	}
+}
+
+func TestHandleCreateJob_CallbackValidation(t *testing.T) {
+	server, handler, cleanup := setupTestServer(t, false)
+	defer cleanup()
+	setupWebhookStore(t, handler)
+
+	// Without WEBHOOK_SECRET callbacks could only be delivered unsigned, so they are refused
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(`{"output_bucket":"b","command":"echo","shell":true,"callback_url":"https://example.com/done"}`))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback_url without secret: expected status 400, got %d", resp.StatusCode)
+	}
+	handler.SetCallbacksEnabled(true)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid callback_url", `{"output_bucket":"b","command":"echo","shell":true,"callback_url":"https://example.com/done"}`, http.StatusCreated},
+		{"non-http callback_url", `{"output_bucket":"b","command":"echo","shell":true,"callback_url":"file:///etc/passwd"}`, http.StatusBadRequest},
+		{"relative callback_url", `{"output_bucket":"b","command":"echo","shell":true,"callback_url":"/done"}`, http.StatusBadRequest},
+		{"unknown webhook_id", `{"output_bucket":"b","command":"echo","shell":true,"webhook_id":"missing"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/api/jobs", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
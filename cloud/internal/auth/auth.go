@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKeyHeader is an alternative to "Authorization: Bearer <key>"
+const APIKeyHeader = "X-API-Key"
+
+// Principal identifies an authenticated API caller
+type Principal struct {
+	Name  string // Key name; used as the submitter of jobs created with this key
+	Admin bool   // Admin keys can access all jobs and manage webhooks
+}
+
+// CanAccess reports whether the caller may access a job created by submitter.
+// A nil principal means authentication is disabled, so everything is accessible.
+func (p *Principal) CanAccess(submitter string) bool {
+	if p == nil || p.Admin {
+		return true
+	}
+	return p.Name == submitter
+}
+
+// IsAdmin reports whether the caller has admin rights (true when authentication is disabled)
+func (p *Principal) IsAdmin() bool {
+	return p == nil || p.Admin
+}
+
+// Authenticator validates API keys. Keys are kept only as SHA-256 hashes.
+type Authenticator struct {
+	keys map[string]*Principal // hex(sha256(key)) -> principal
+}
+
+// NewAuthenticator creates an authenticator with no keys (authentication disabled)
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{keys: make(map[string]*Principal)}
+}
+
+// AddKey registers an API key for a principal
+func (a *Authenticator) AddKey(key string, principal Principal) {
+	a.keys[hashKey(key)] = &principal
+}
+
+// LoadFromEnv loads API keys from API_KEYS.
+// Format: comma-separated "name:key" entries; append ":admin" for admin keys,
+// e.g. API_KEYS=lab-frontend:3f9c...,ops:8a1d...:admin
+// An empty API_KEYS disables authentication (development mode).
+func LoadFromEnv() (*Authenticator, error) {
+	a := NewAuthenticator()
+	raw := strings.TrimSpace(os.Getenv("API_KEYS"))
+	if raw == "" {
+		return a, nil
+	}
+
+	for i, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			// Do not echo the entry: it contains the key
+			return nil, fmt.Errorf("invalid API_KEYS entry #%d: expected name:key or name:key:admin", i+1)
+		}
+		principal := Principal{Name: parts[0]}
+		if len(parts) == 3 {
+			if parts[2] != "admin" {
+				return nil, fmt.Errorf("invalid API_KEYS entry #%d (%s): unknown role %q", i+1, parts[0], parts[2])
+			}
+			principal.Admin = true
+		}
+		a.AddKey(parts[1], principal)
+	}
+	return a, nil
+}
+
+// Enabled reports whether any API keys are configured
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.keys) > 0
+}
+
+// Authenticate resolves the caller from "Authorization: Bearer <key>" or X-API-Key
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, bool) {
+	key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if key == "" {
+		authHeader := r.Header.Get("Authorization")
+		if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+			key = strings.TrimSpace(authHeader[7:])
+		}
+	}
+	if key == "" {
+		return nil, false
+	}
+	principal, ok := a.keys[hashKey(key)]
+	return principal, ok
+}
+
+// Middleware rejects unauthenticated requests with 401 and stores the caller in the request context.
+// When authentication is disabled, requests pass through unchanged.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, ok := a.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="xiresource"`)
+			http.Error(w, "Unauthorized: a valid API key is required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the authenticated caller, or nil when authentication is disabled
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
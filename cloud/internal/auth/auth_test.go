@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("API_KEYS", "lab:lab-key, ops:ops-key:admin")
+	a, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if !a.Enabled() {
+		t.Fatal("Expected authenticator to be enabled")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	req.Header.Set("Authorization", "Bearer lab-key")
+	p, ok := a.Authenticate(req)
+	if !ok || p.Name != "lab" || p.Admin {
+		t.Errorf("Authenticate(Bearer lab-key) = %+v, %v", p, ok)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	req.Header.Set(APIKeyHeader, "ops-key")
+	p, ok = a.Authenticate(req)
+	if !ok || p.Name != "ops" || !p.Admin {
+		t.Errorf("Authenticate(X-API-Key ops-key) = %+v, %v", p, ok)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, ok := a.Authenticate(req); ok {
+		t.Error("Expected unknown key to be rejected")
+	}
+
+	for _, bad := range []string{"nokey", "lab:key:root", ":key"} {
+		t.Setenv("API_KEYS", bad)
+		if _, err := LoadFromEnv(); err == nil {
+			t.Errorf("LoadFromEnv(%q) expected error", bad)
+		}
+	}
+
+	t.Setenv("API_KEYS", "")
+	a, err = LoadFromEnv()
+	if err != nil || a.Enabled() {
+		t.Errorf("Empty API_KEYS: enabled=%v err=%v, want disabled", a.Enabled(), err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a := NewAuthenticator()
+	var seen *Principal
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	// Disabled: pass through without a principal
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	if rec.Code != http.StatusOK || seen != nil {
+		t.Errorf("Disabled auth: code=%d principal=%v", rec.Code, seen)
+	}
+	if !seen.CanAccess("anyone") || !seen.IsAdmin() {
+		t.Error("Nil principal must have full access")
+	}
+
+	a.AddKey("lab-key", Principal{Name: "lab"})
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Missing key: code=%d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	req.Header.Set("Authorization", "Bearer lab-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || seen == nil || seen.Name != "lab" {
+		t.Fatalf("Valid key: code=%d principal=%v", rec.Code, seen)
+	}
+	if !seen.CanAccess("lab") || seen.CanAccess("other") || seen.IsAdmin() {
+		t.Error("Non-admin principal must only access its own jobs")
+	}
+}
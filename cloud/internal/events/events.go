@@ -0,0 +1,118 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+)
+
+// subscriberBufferSize is the per-subscriber channel capacity.
+// Slow subscribers drop events instead of blocking publishers (the gateway read loop).
+const subscriberBufferSize = 64
+
+// JobEvent describes a job status change
+type JobEvent struct {
+	JobID     string     `json:"job_id"`
+	Status    job.Status `json:"status"`
+	AttemptID int        `json:"attempt_id"`
+	Submitter string     `json:"submitter,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// NewJobEvent builds an event from the current state of a job
+func NewJobEvent(j *job.Job) JobEvent {
+	return JobEvent{
+		JobID:     j.JobID,
+		Status:    j.Status,
+		AttemptID: j.AttemptID,
+		Submitter: j.Submitter,
+		Message:   j.Message,
+		Reason:    j.Reason,
+		Timestamp: time.Now(),
+	}
+}
+
+// Filter decides whether a subscriber receives an event (nil matches everything)
+type Filter func(JobEvent) bool
+
+// Subscription receives events matching its filter until closed
+type Subscription struct {
+	C      <-chan JobEvent
+	ch     chan JobEvent
+	filter Filter
+	broker *Broker
+	once   sync.Once
+}
+
+// Close unsubscribes and releases the subscription
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.mu.Lock()
+		delete(s.broker.subs, s)
+		s.broker.mu.Unlock()
+	})
+}
+
+// Broker is an in-process pub/sub for job status changes.
+// It feeds long-poll waits and SSE streams; it is not persisted and not shared across server instances.
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBroker creates a new event broker
+func NewBroker() *Broker {
+	return &Broker{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber. Callers must Close the subscription when done.
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	ch := make(chan JobEvent, subscriberBufferSize)
+	sub := &Subscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+		broker: b,
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Publish delivers an event to all matching subscribers without blocking.
+// Safe to call on a nil broker (events disabled).
+func (b *Broker) Publish(event JobEvent) {
+	if b == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("Event subscriber buffer full, dropping event for job %s (%s)", event.JobID, event.Status)
+		}
+	}
+}
+
+// SubscriberCount returns the number of active subscribers
+func (b *Broker) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+)
+
+func TestBroker_PublishSubscribe(t *testing.T) {
+	broker := NewBroker()
+
+	all := broker.Subscribe(nil)
+	defer all.Close()
+	onlyA := broker.Subscribe(func(e JobEvent) bool { return e.JobID == "job-a" })
+	defer onlyA.Close()
+
+	broker.Publish(JobEvent{JobID: "job-a", Status: job.StatusRunning})
+	broker.Publish(JobEvent{JobID: "job-b", Status: job.StatusSucceeded})
+
+	for _, want := range []string{"job-a", "job-b"} {
+		select {
+		case e := <-all.C:
+			if e.JobID != want {
+				t.Errorf("JobID = %s, want %s", e.JobID, want)
+			}
+			if e.Timestamp.IsZero() {
+				t.Error("Expected Timestamp to be set")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %s", want)
+		}
+	}
+
+	select {
+	case e := <-onlyA.C:
+		if e.JobID != "job-a" {
+			t.Errorf("Filtered subscriber got job %s", e.JobID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for filtered event")
+	}
+	select {
+	case e := <-onlyA.C:
+		t.Errorf("Filtered subscriber received unexpected event for job %s", e.JobID)
+	default:
+	}
+}
+
+func TestBroker_CloseAndNil(t *testing.T) {
+	broker := NewBroker()
+	sub := broker.Subscribe(nil)
+	if broker.SubscriberCount() != 1 {
+		t.Fatalf("SubscriberCount() = %d, want 1", broker.SubscriberCount())
+	}
+	sub.Close()
+	sub.Close() // idempotent
+	if broker.SubscriberCount() != 0 {
+		t.Errorf("SubscriberCount() = %d after Close, want 0", broker.SubscriberCount())
+	}
+
+	// Publishing must never block, even when a subscriber stops reading
+	slow := broker.Subscribe(nil)
+	defer slow.Close()
+	for i := 0; i < subscriberBufferSize*2; i++ {
+		broker.Publish(JobEvent{JobID: "job-a", Status: job.StatusRunning})
+	}
+
+	var nilBroker *Broker
+	nilBroker.Publish(JobEvent{JobID: "job-a"}) // must not panic
+}
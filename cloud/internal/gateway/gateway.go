@@ -4,16 +4,22 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/xiresource/cloud/internal/events"
 	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
 	"github.com/xiresource/cloud/internal/oss"
 	"github.com/xiresource/cloud/internal/queue"
 	"github.com/xiresource/cloud/internal/registry"
@@ -21,6 +27,31 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// maxRefreshOutputFiles bounds the presigned URLs issued by one RefreshAccess
+	maxRefreshOutputFiles = 100
+	// maxOutputFiles bounds the output manifest accepted with SUCCEEDED
+	maxOutputFiles = 1000
+	// outputVerifyTimeout bounds each HEAD request that confirms a job's output before SUCCEEDED
+	outputVerifyTimeout = 10 * time.Second
+	// outputVerifyConcurrency bounds the concurrent HEAD requests that confirm an output manifest
+	outputVerifyConcurrency = 8
+	// outputVerifyAttempts is the number of HEAD requests made for an output before a failing store
+	// (other than a missing object) fails the job
+	outputVerifyAttempts = 3
+	// logArchiveTimeout bounds the upload of a finished attempt's stdout.log and stderr.log
+	logArchiveTimeout = 10 * time.Minute
+	// maxProgressMetricsSize bounds JobProgress.metrics_json
+	maxProgressMetricsSize = 4 << 10
+	// maxProgressMessageLength bounds JobProgress.message (longer messages are cut)
+	maxProgressMessageLength = 1024
+	// maxSignalNameLength bounds ProcessUsage.signal (term_signal column)
+	maxSignalNameLength = 32
+)
+
+// outputVerifyRetryDelay is the delay before the second HEAD request of an output (growing per attempt)
+var outputVerifyRetryDelay = 2 * time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins in dev mode
@@ -41,15 +72,27 @@ type Gateway struct {
 	jobStore    job.Store
 	jobQueue    queue.Queue
 	ossProvider oss.Provider
+	sts         oss.STSProvider // Optional: output access as prefix-scoped STS credentials
 	connections map[string]*AgentConnection
 	mu          sync.RWMutex
 	devMode     bool
 	agentTokens map[string]string // agent_id -> token_hash (MVP: plain for dev)
+	events      *events.Broker    // Optional: job status change notifications
+	notifier    Notifier          // Optional: completion webhooks for jobs reaching a terminal state
+	logs        *logs.Store       // Optional: live command output (LogChunk), archived to OSS when the attempt ends
+}
+
+// Notifier queues completion notifications (webhooks) for jobs that reached a terminal state.
+// Unlike job events it must not drop notifications.
+type Notifier interface {
+	Enqueue(jobID string)
 }
 
 // Registry interface for agent tracking
 type Registry interface {
 	Register(agentID, hostname string, maxConcurrency int)
+	SetTemplates(agentID string, templates []string)
+	SetForwardTargets(agentID string, targets []*control.ForwardTarget)
 	UpdateHeartbeat(agentID string, paused bool, runningJobs int)
 	Unregister(agentID string)
 	GetAgent(agentID string) (*registry.AgentInfo, bool) // Returns agent info if registered and online
@@ -68,6 +111,118 @@ func New(registry Registry, jobStore job.Store, jobQueue queue.Queue, ossProvide
 	}
 }
 
+// SetEvents sets the broker that job status changes are published to
+func (g *Gateway) SetEvents(broker *events.Broker) {
+	g.events = broker
+}
+
+// SetNotifier sets the notifier told about every job the gateway moves to a terminal state
+func (g *Gateway) SetNotifier(n Notifier) {
+	g.notifier = n
+}
+
+// SetLogs sets the store that LogChunk messages are appended to.
+// Without it agents are told to stop streaming logs.
+func (g *Gateway) SetLogs(store *logs.Store) {
+	g.logs = store
+}
+
+// SetSTSProvider makes the gateway hand out STS credentials scoped to jobs/{job_id}/{attempt_id}/
+// for outputs instead of a presigned URL for the single output key
+func (g *Gateway) SetSTSProvider(sts oss.STSProvider) {
+	g.sts = sts
+}
+
+// outputAccess issues upload access for a job attempt: STS credentials for outputPrefix if an
+// STS provider is configured (default bucket only), otherwise a presigned PUT URL for outputKey in bucket
+func (g *Gateway) outputAccess(ctx context.Context, bucket, outputKey, outputPrefix string) (*control.OSSAccess, error) {
+	if g.sts != nil && g.isDefaultBucket(bucket) {
+		creds, err := g.sts.IssueUploadCredentials(ctx, outputPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return &control.OSSAccess{Auth: &control.OSSAccess_Sts{Sts: &control.STSCreds{
+			AccessKeyId:     creds.AccessKeyID,
+			AccessKeySecret: creds.AccessKeySecret,
+			SecurityToken:   creds.SecurityToken,
+			Endpoint:        creds.Endpoint,
+			Bucket:          creds.Bucket,
+			ExpiresAtMs:     creds.ExpiresAt.UnixMilli(),
+		}}}, nil
+	}
+	provider, err := oss.ForBucket(g.ossProvider, bucket)
+	if err != nil {
+		return nil, err
+	}
+	url, err := provider.GenerateUploadURL(ctx, outputKey)
+	if err != nil {
+		return nil, err
+	}
+	return &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: url}}, nil
+}
+
+// inputAccess issues a presigned GET URL for a job's input object
+func (g *Gateway) inputAccess(ctx context.Context, bucket, key string) (string, error) {
+	provider, err := oss.ForBucket(g.ossProvider, bucket)
+	if err != nil {
+		return "", err
+	}
+	return provider.GenerateDownloadURL(ctx, key)
+}
+
+// namedInputAccess issues presigned GET URLs for the named inputs of a job, in the given order
+func (g *Gateway) namedInputAccess(ctx context.Context, j *job.Job, names []string) ([]*control.JobInput, error) {
+	inputs := make([]*control.JobInput, 0, len(names))
+	for _, name := range names {
+		input, ok := j.Inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("job has no input %s", name)
+		}
+		url, err := g.inputAccess(ctx, input.Bucket, input.Key)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", name, err)
+		}
+		inputs = append(inputs, &control.JobInput{
+			Name:     name,
+			Key:      input.Key,
+			Download: &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: url}},
+			Bucket:   input.Bucket,
+			Sha256:   input.SHA256,
+		})
+	}
+	return inputs, nil
+}
+
+// isDefaultBucket reports whether bucket is the OSS provider's default bucket (the one STS credentials cover)
+func (g *Gateway) isDefaultBucket(bucket string) bool {
+	bp, ok := g.ossProvider.(oss.BucketProvider)
+	return bucket == "" || !ok || bucket == bp.DefaultBucket()
+}
+
+// publishJobEvent publishes the current state of a job after a store update
+func (g *Gateway) publishJobEvent(jobID string) {
+	if g.events == nil {
+		return
+	}
+	j, err := g.jobStore.Get(jobID)
+	if err != nil {
+		log.Printf("Failed to load job %s for event publishing: %v", jobID, err)
+		return
+	}
+	g.events.Publish(events.NewJobEvent(j))
+}
+
+// finishJob moves a job to a terminal state and, if that succeeded, queues its completion notifications
+func (g *Gateway) finishJob(jobID string, status job.Status) error {
+	if err := g.jobStore.UpdateStatus(jobID, status); err != nil {
+		return err
+	}
+	if g.notifier != nil {
+		g.notifier.Enqueue(jobID)
+	}
+	return nil
+}
+
 // HandleWebSocket handles incoming WebSocket connections
 func (g *Gateway) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -144,7 +299,18 @@ func (g *Gateway) handleMessage(agentConn *AgentConnection, envelope *control.En
 	case *control.Envelope_RequestJob:
 		g.handleRequestJob(agentConn, envelope, payload.RequestJob)
 	case *control.Envelope_JobStatus:
-		g.handleJobStatus(agentConn, envelope, payload.JobStatus)
+		if payload.JobStatus.Status == control.JobStatusEnum_JOB_STATUS_SUCCEEDED {
+			// Confirming the outputs takes HEAD requests to OSS (with retries); keep them off the read loop
+			go g.handleJobStatus(agentConn, envelope, payload.JobStatus)
+		} else {
+			g.handleJobStatus(agentConn, envelope, payload.JobStatus)
+		}
+	case *control.Envelope_RefreshAccess:
+		g.handleRefreshAccess(agentConn, envelope, payload.RefreshAccess)
+	case *control.Envelope_LogChunk:
+		g.handleLogChunk(agentConn, envelope, payload.LogChunk)
+	case *control.Envelope_JobProgress:
+		g.handleJobProgress(agentConn, envelope, payload.JobProgress)
 	default:
 		log.Printf("Unknown message type from agent %s", envelope.AgentId)
 	}
@@ -170,7 +336,10 @@ func (g *Gateway) handleRegister(agentConn *AgentConnection, envelope *control.E
 	g.mu.Unlock()
 
 	g.registry.Register(agentID, reg.Hostname, int(reg.MaxConcurrency))
-	log.Printf("Agent %s registered (hostname: %s, max_concurrency: %d)", agentID, reg.Hostname, reg.MaxConcurrency)
+	g.registry.SetTemplates(agentID, reg.Templates)
+	g.registry.SetForwardTargets(agentID, reg.ForwardTargets)
+	log.Printf("Agent %s registered (hostname: %s, max_concurrency: %d, templates: %v, forward targets: %d)",
+		agentID, reg.Hostname, reg.MaxConcurrency, reg.Templates, len(reg.ForwardTargets))
 
 	// Send RegisterAck
 	ack := &control.Envelope{
@@ -298,6 +467,26 @@ func (g *Gateway) handleRequestJob(agentConn *AgentConnection, envelope *control
 			continue
 		}
 
+		// Template jobs only run on agents that declare the template
+		if j.Template != "" && !agentInfo.HasTemplate(j.Template) {
+			log.Printf("Agent %s does not have template %q of job %s, re-enqueuing and trying next job", agentID, j.Template, jobID)
+			if err := g.jobQueue.Enqueue(ctx, jobID); err != nil {
+				log.Printf("Failed to re-enqueue job %s: %v", jobID, err)
+			}
+			j = nil
+			continue
+		}
+
+		// Forward jobs only run on agents that permit their target (agents hosting that local service)
+		if target, ok := forwardTarget(j); ok && !agentInfo.PermitsForward(target) {
+			log.Printf("Agent %s does not forward to %s (job %s), re-enqueuing and trying next job", agentID, target, jobID)
+			if err := g.jobQueue.Enqueue(ctx, jobID); err != nil {
+				log.Printf("Failed to re-enqueue job %s: %v", jobID, err)
+			}
+			j = nil
+			continue
+		}
+
 		// Found a valid PENDING job, break out of loop
 		break
 	}
@@ -349,7 +538,7 @@ func (g *Gateway) handleRequestJob(agentConn *AgentConnection, envelope *control
 	hasInput := j.InputBucket != "" && j.InputKey != ""
 	if hasInput {
 		var err error
-		inputDownloadURL, err = g.ossProvider.GenerateDownloadURL(ctx, j.InputKey)
+		inputDownloadURL, err = g.inputAccess(ctx, j.InputBucket, j.InputKey)
 		if err != nil {
 			log.Printf("Failed to generate input download URL for job %s: %v, re-enqueuing", jobID, err)
 			// Re-enqueue job for retry
@@ -365,9 +554,17 @@ func (g *Gateway) handleRequestJob(agentConn *AgentConnection, envelope *control
 		// Don't generate URL - job has no input
 	}
 
-	outputUploadURL, err := g.ossProvider.GenerateUploadURL(ctx, outputKey)
+	namedInputs, err := g.namedInputAccess(ctx, j, j.InputNames())
 	if err != nil {
-		log.Printf("Failed to generate output upload URL for job %s: %v, re-enqueuing", jobID, err)
+		log.Printf("Failed to generate named input download URLs for job %s: %v, re-enqueuing", jobID, err)
+		// Re-enqueue job for retry
+		_ = g.jobQueue.Enqueue(ctx, jobID)
+		return
+	}
+
+	outputUpload, err := g.outputAccess(ctx, j.OutputBucket, outputKey, outputPrefix)
+	if err != nil {
+		log.Printf("Failed to generate output upload access for job %s: %v, re-enqueuing", jobID, err)
 		// Re-enqueue job for retry
 		_ = g.jobQueue.Enqueue(ctx, jobID)
 		return
@@ -413,30 +610,47 @@ func (g *Gateway) handleRequestJob(agentConn *AgentConnection, envelope *control
 		AttemptId:        int32(attemptID),
 		LeaseId:          leaseID,
 		LeaseTtlSec:      leaseTTLSec,
-		OutputUpload:     &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: outputUploadURL}},
+		OutputUpload:     outputUpload,
 		OutputPrefix:     outputPrefix,
 		OutputKey:        outputKey,
 		Command:          j.Command,
+		Shell:            j.Shell,
 		JobType:          mapJobTypeToProto(j.JobType),
 		InputForwardMode: mapInputForwardModeToProto(j.InputForward),
+		Inputs:           namedInputs,
+		TimeoutSec:       int32(j.Timeout() / time.Second),
+		Argv:             j.Argv,
+		Env:              j.Env,
+		WorkingDir:       j.WorkingDir,
+		Template:         j.Template,
+		Params:           j.Params,
 	}
 
 	if j.JobType == job.JobTypeForwardHTTP {
 		jobAssignedMsg.Command = ""
+		jobAssignedMsg.Shell = false
 		jobAssignedMsg.ForwardHttp = &control.ForwardHttpRequest{
 			Url:        j.ForwardURL,
 			Method:     j.ForwardMethod,
 			Headers:    parseForwardHeaders(j.ForwardHeaders),
 			Body:       []byte(j.ForwardBody),
 			TimeoutSec: int32(j.ForwardTimeout),
+			Async:      forwardAsyncToProto(j.ForwardAsync),
 		}
 	}
+	if j.JobType == job.JobTypeForwardGRPC {
+		jobAssignedMsg.Command = ""
+		jobAssignedMsg.Shell = false
+		jobAssignedMsg.ForwardGrpc = forwardGRPCToProto(j.ForwardGRPC, j.ForwardTimeout)
+	}
 
 	// Only include input fields if input is provided
 	// Double-check InputKey is not empty to prevent agent from trying to download empty input
 	if inputAccess != nil && j.InputKey != "" {
 		jobAssignedMsg.InputDownload = inputAccess
 		jobAssignedMsg.InputKey = j.InputKey
+		jobAssignedMsg.InputBucket = j.InputBucket
+		jobAssignedMsg.InputSha256 = j.InputSHA256
 	}
 
 	jobAssigned := &control.Envelope{
@@ -462,6 +676,7 @@ func (g *Gateway) handleRequestJob(agentConn *AgentConnection, envelope *control
 
 	log.Printf("Assigned job %s (attempt %d) to agent %s", jobID, attemptID, agentID)
 	agentConn.SendChan <- jobAssignedData
+	g.publishJobEvent(jobID)
 }
 
 func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.Envelope, status *control.JobStatus) {
@@ -520,6 +735,18 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 		return
 	}
 
+	// Archive the attempt's streamed output once it ends (whatever the store updates below decide)
+	if newStatus.IsTerminal() {
+		defer g.archiveLogs(j)
+	}
+
+	// Publish the resulting job state once the store updates below are done
+	defer g.publishJobEvent(jobID)
+
+	if len(status.CachedInputs) > 0 {
+		log.Printf("Job %s (attempt %d): agent %s served inputs %v from its input cache", jobID, attemptID, agentID, status.CachedInputs)
+	}
+
 	// Persist status message if provided
 	if status.Message != "" {
 		if err := g.jobStore.UpdateMessage(jobID, status.Message); err != nil {
@@ -527,6 +754,16 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 		}
 	}
 
+	// Record how a command's process ended
+	if status.Usage != nil && newStatus.IsTerminal() {
+		g.recordProcessUsage(jobID, status.Usage)
+	}
+
+	// Record the local service's response to a forward job
+	if status.ForwardResponse != nil && newStatus.IsTerminal() {
+		g.recordForwardResponse(jobID, status.ForwardResponse)
+	}
+
 	// Handle status-specific logic
 	switch newStatus {
 	case job.StatusRunning:
@@ -566,7 +803,7 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 			// Fix 4: Strict validation - output_key must exactly equal store.OutputKey (presigned mode)
 			if j.OutputKey == "" {
 				log.Printf("JobStatus: job %s has no OutputKey in store, cannot validate presigned output_key, marking as FAILED", jobID)
-				if err := g.jobStore.UpdateStatus(jobID, job.StatusFailed); err != nil {
+				if err := g.finishJob(jobID, job.StatusFailed); err != nil {
 					log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
 				} else {
 					// Fix 5: Decrement RunningJobs on terminal state
@@ -581,7 +818,7 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 			if outputKey != j.OutputKey {
 				log.Printf("JobStatus: output_key mismatch for job %s: reported=%s, expected=%s, marking as FAILED (presigned mode requires exact match)", jobID, outputKey, j.OutputKey)
 				// Mark as FAILED - do not update store.OutputKey to prevent pollution
-				if err := g.jobStore.UpdateStatus(jobID, job.StatusFailed); err != nil {
+				if err := g.finishJob(jobID, job.StatusFailed); err != nil {
 					log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
 				} else {
 					// Fix 5: Decrement RunningJobs on terminal state
@@ -594,8 +831,73 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 			}
 		}
 
+		// Confirm the primary output in OSS; a missing object or a size/ETag mismatch fails the job
+		if outputKey != "" {
+			output, err := g.verifyOutput(j, outputKey, status.Output)
+			if err != nil {
+				log.Printf("JobStatus: output verification failed for job %s: %v, marking as FAILED", jobID, err)
+				if err := g.jobStore.UpdateMessage(jobID, fmt.Sprintf("Output verification failed: %v", err)); err != nil {
+					log.Printf("Failed to update message for job %s: %v", jobID, err)
+				}
+				if err := g.finishJob(jobID, job.StatusFailed); err != nil {
+					log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
+				} else {
+					agentInfo, _ := g.registry.GetAgent(agentID)
+					if agentInfo != nil && agentInfo.RunningJobs > 0 {
+						g.registry.UpdateHeartbeat(agentID, agentInfo.Paused, agentInfo.RunningJobs-1)
+					}
+				}
+				return
+			}
+			if output != nil {
+				if err := g.jobStore.UpdateOutputFile(jobID, output); err != nil {
+					log.Printf("Failed to update output file for job %s: %v", jobID, err)
+				}
+			}
+		}
+
+		// Record the output manifest; a manifest naming keys outside the attempt's prefix, or files
+		// missing from OSS or differing in size, fails the job
+		if len(status.OutputFiles) > 0 {
+			files, err := outputFilesFromProto(j, status)
+			if err != nil {
+				log.Printf("JobStatus: invalid output manifest for job %s: %v, marking as FAILED", jobID, err)
+				if err := g.jobStore.UpdateMessage(jobID, fmt.Sprintf("Invalid output manifest: %v", err)); err != nil {
+					log.Printf("Failed to update message for job %s: %v", jobID, err)
+				}
+				if err := g.finishJob(jobID, job.StatusFailed); err != nil {
+					log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
+				} else {
+					agentInfo, _ := g.registry.GetAgent(agentID)
+					if agentInfo != nil && agentInfo.RunningJobs > 0 {
+						g.registry.UpdateHeartbeat(agentID, agentInfo.Paused, agentInfo.RunningJobs-1)
+					}
+				}
+				return
+			}
+			if err := g.verifyOutputFiles(j, files); err != nil {
+				log.Printf("JobStatus: output verification failed for job %s: %v, marking as FAILED", jobID, err)
+				if err := g.jobStore.UpdateMessage(jobID, fmt.Sprintf("Output verification failed: %v", err)); err != nil {
+					log.Printf("Failed to update message for job %s: %v", jobID, err)
+				}
+				if err := g.finishJob(jobID, job.StatusFailed); err != nil {
+					log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
+				} else {
+					agentInfo, _ := g.registry.GetAgent(agentID)
+					if agentInfo != nil && agentInfo.RunningJobs > 0 {
+						g.registry.UpdateHeartbeat(agentID, agentInfo.Paused, agentInfo.RunningJobs-1)
+					}
+				}
+				return
+			}
+			if err := g.jobStore.UpdateOutputFiles(jobID, files); err != nil {
+				log.Printf("Failed to update output files for job %s: %v", jobID, err)
+				// Continue anyway - the files are uploaded and listed in manifest.json
+			}
+		}
+
 		// Update status to SUCCEEDED
-		if err := g.jobStore.UpdateStatus(jobID, job.StatusSucceeded); err != nil {
+		if err := g.finishJob(jobID, job.StatusSucceeded); err != nil {
 			log.Printf("Failed to update job %s to SUCCEEDED: %v", jobID, err)
 			return
 		}
@@ -623,12 +925,23 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 			// Continue anyway - stdout/stderr update failure shouldn't fail the status update
 		}
 
+		// Only known reasons are stored; anything else is still a plain failure
+		switch status.Reason {
+		case "":
+		case job.ReasonTimedOut, job.ReasonPolicyDenied:
+			if err := g.jobStore.UpdateReason(jobID, status.Reason); err != nil {
+				log.Printf("Failed to update reason for job %s: %v", jobID, err)
+			}
+		default:
+			log.Printf("JobStatus: ignoring unknown reason %q for job %s from agent %s", status.Reason, jobID, agentID)
+		}
+
 		if message != "" {
 			log.Printf("Job %s (attempt %d) FAILED on agent %s: %s", jobID, attemptID, agentID, message)
 		} else {
 			log.Printf("Job %s (attempt %d) FAILED on agent %s", jobID, attemptID, agentID)
 		}
-		if err := g.jobStore.UpdateStatus(jobID, job.StatusFailed); err != nil {
+		if err := g.finishJob(jobID, job.StatusFailed); err != nil {
 			log.Printf("Failed to update job %s to FAILED: %v", jobID, err)
 			return
 		}
@@ -645,7 +958,7 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 				j.Status, newStatus, jobID, agentID)
 			return
 		}
-		if err := g.jobStore.UpdateStatus(jobID, newStatus); err != nil {
+		if err := g.finishJob(jobID, newStatus); err != nil {
 			log.Printf("Failed to update job %s to %s: %v", jobID, newStatus, err)
 			return
 		}
@@ -671,6 +984,713 @@ func (g *Gateway) handleJobStatus(agentConn *AgentConnection, envelope *control.
 	}
 }
 
+// handleLogChunk appends streamed command output to the job's log and acknowledges it.
+// Chunks are only accepted from the holder of the job's current attempt while the job runs;
+// otherwise (or without a log store) the agent is told to stop streaming.
+func (g *Gateway) handleLogChunk(agentConn *AgentConnection, envelope *control.Envelope, chunk *control.LogChunk) {
+	agentID := envelope.AgentId
+	if agentID == "" || agentConn.AgentID != agentID {
+		log.Printf("LogChunk agent_id mismatch: connection=%s, envelope=%s", agentConn.AgentID, agentID)
+		return
+	}
+	if chunk.AgentId != "" && chunk.AgentId != agentID {
+		log.Printf("LogChunk agent_id mismatch: envelope=%s, payload=%s", agentID, chunk.AgentId)
+		return
+	}
+
+	ack := &control.LogChunkAck{
+		JobId:     chunk.JobId,
+		AttemptId: chunk.AttemptId,
+	}
+	defer func() {
+		data, err := proto.Marshal(&control.Envelope{
+			RequestId: envelope.RequestId,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   &control.Envelope_LogChunkAck{LogChunkAck: ack},
+		})
+		if err != nil {
+			log.Printf("Failed to marshal LogChunkAck: %v", err)
+			return
+		}
+		agentConn.SendChan <- data
+	}()
+
+	if g.logs == nil {
+		ack.Stop = true
+		return
+	}
+	j, err := g.jobStore.Get(chunk.JobId)
+	if err != nil {
+		if err != job.ErrJobNotFound {
+			log.Printf("Failed to get job %s: %v", chunk.JobId, err)
+		}
+		ack.Stop = true
+		return
+	}
+	if j.AssignedAgentID != agentID || int(chunk.AttemptId) != j.AttemptID || j.Status.IsTerminal() {
+		log.Printf("LogChunk for job %s (attempt %d) from agent %s rejected: not the running attempt of this agent", chunk.JobId, chunk.AttemptId, agentID)
+		ack.Stop = true
+		return
+	}
+
+	stream := logs.Stdout
+	if chunk.Stream == control.LogStream_LOG_STREAM_STDERR {
+		stream = logs.Stderr
+	}
+	ack.AckedSeq = g.logs.Append(j.JobID, j.AttemptID, chunk.Seq, stream, chunk.Data, chunk.DroppedBytes, chunk.Eof)
+}
+
+// recordProcessUsage stores the exit status and resource usage reported with a final JobStatus.
+// Invalid reports (negative values, an overlong signal name) are logged and ignored.
+func (g *Gateway) recordProcessUsage(jobID string, u *control.ProcessUsage) {
+	if u.WallTimeMs < 0 || u.UserCpuMs < 0 || u.SystemCpuMs < 0 || u.MaxRssBytes < 0 || len(u.Signal) > maxSignalNameLength {
+		log.Printf("JobStatus: ignoring invalid process usage for job %s: %+v", jobID, u)
+		return
+	}
+	usage := job.ProcessUsage{
+		Signal:      u.Signal,
+		WallTimeMs:  u.WallTimeMs,
+		UserCPUMs:   u.UserCpuMs,
+		SystemCPUMs: u.SystemCpuMs,
+		MaxRSSBytes: u.MaxRssBytes,
+	}
+	if u.Exited {
+		exitCode := int(u.ExitCode)
+		usage.ExitCode = &exitCode
+	}
+	if err := g.jobStore.UpdateProcessUsage(jobID, usage); err != nil {
+		log.Printf("Failed to update process usage for job %s: %v", jobID, err)
+	}
+}
+
+// recordForwardResponse stores the status code and headers reported with a forward job's final JobStatus.
+// Headers beyond job.MaxForwardResponseHeaders are dropped and long values are cut; an invalid
+// status code is logged and ignored.
+func (g *Gateway) recordForwardResponse(jobID string, r *control.ForwardResponse) {
+	if r.StatusCode < 100 || r.StatusCode > 999 {
+		log.Printf("JobStatus: ignoring invalid forward response status %d for job %s", r.StatusCode, jobID)
+		return
+	}
+	response := &job.ForwardResponse{StatusCode: int(r.StatusCode)}
+	for _, h := range r.Headers {
+		if len(response.Headers) >= job.MaxForwardResponseHeaders {
+			log.Printf("JobStatus: forward response of job %s has more than %d headers, dropping the rest", jobID, job.MaxForwardResponseHeaders)
+			break
+		}
+		name := http.CanonicalHeaderKey(h.Key)
+		if name == "" || len(name) > job.MaxForwardResponseHeaderSize {
+			continue
+		}
+		if response.Headers == nil {
+			response.Headers = make(map[string]string)
+		}
+		value := h.Value
+		if len(value) > job.MaxForwardResponseHeaderSize {
+			value = value[:job.MaxForwardResponseHeaderSize]
+		}
+		response.Headers[name] = value
+	}
+	if err := g.jobStore.UpdateForwardResponse(jobID, response); err != nil {
+		log.Printf("Failed to update forward response for job %s: %v", jobID, err)
+	}
+}
+
+// RunTimeouts fails ASSIGNED and RUNNING jobs that overran their timeout by more than cfg.Grace, so jobs end even
+// when their agent never reports (hung, misbehaving or disconnected without a lease expiry). The job
+// is marked FAILED with reason TIMED_OUT and the agent, if connected, is told to cancel it.
+// Blocks until ctx is done.
+func (g *Gateway) RunTimeouts(ctx context.Context, cfg *job.TimeoutConfig) {
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.CheckTimeouts(cfg.Grace)
+		}
+	}
+}
+
+// CheckTimeouts times out every RUNNING job that started, and every ASSIGNED job that was assigned,
+// more than its timeout plus grace ago (an agent that never starts an assigned job must not hold it forever)
+func (g *Gateway) CheckTimeouts(grace time.Duration) {
+	const pageSize = 200
+	now := time.Now()
+
+	var overrun []*job.Job
+	for _, status := range []job.Status{job.StatusAssigned, job.StatusRunning} {
+		status := status
+		for offset := 0; ; offset += pageSize {
+			jobs, err := g.jobStore.List(pageSize, offset, &status)
+			if err != nil {
+				log.Printf("Timeout check: failed to list %s jobs: %v", status, err)
+				return
+			}
+			for _, j := range jobs {
+				since := j.StartedAt
+				if status == job.StatusAssigned {
+					since = j.AssignedAt
+				}
+				if since != nil && now.After(since.Add(j.Timeout()+grace)) {
+					overrun = append(overrun, j)
+				}
+			}
+			if len(jobs) < pageSize {
+				break
+			}
+		}
+	}
+
+	// Updated after listing so that jobs leaving ASSIGNED/RUNNING do not shift the pages
+	for _, j := range overrun {
+		g.timeOutJob(j)
+	}
+}
+
+// timeOutJob fails an overrunning job with reason TIMED_OUT and cancels it on its agent.
+// Nothing happens if the job finished or was reassigned since it was listed.
+func (g *Gateway) timeOutJob(j *job.Job) {
+	jobID := j.JobID
+	message := fmt.Sprintf("Job exceeded its timeout of %s (no final status from agent %s)", j.Timeout(), j.AssignedAgentID)
+	if j.Status == job.StatusAssigned {
+		message = fmt.Sprintf("Job exceeded its timeout of %s (agent %s never started it)", j.Timeout(), j.AssignedAgentID)
+	}
+
+	updated, err := g.jobStore.TimeOut(jobID, j.AttemptID, message)
+	if err != nil {
+		log.Printf("Failed to time out job %s: %v", jobID, err)
+		return
+	}
+	if !updated {
+		log.Printf("Job %s (attempt %d) left %s before it could be timed out", jobID, j.AttemptID, j.Status)
+		return
+	}
+	defer g.publishJobEvent(jobID)
+	if g.notifier != nil {
+		g.notifier.Enqueue(jobID)
+	}
+	log.Printf("Job %s (attempt %d) TIMED_OUT on agent %s after %s", jobID, j.AttemptID, j.AssignedAgentID, j.Timeout())
+	g.archiveLogs(j)
+
+	agentID := j.AssignedAgentID
+	if agentID == "" {
+		return
+	}
+	agentInfo, _ := g.registry.GetAgent(agentID)
+	if agentInfo != nil && agentInfo.RunningJobs > 0 {
+		g.registry.UpdateHeartbeat(agentID, agentInfo.Paused, agentInfo.RunningJobs-1)
+	}
+
+	// Best effort: a disconnected agent learns nothing, its late JobStatus is ignored (terminal state)
+	err = g.SendMessage(agentID, &control.Envelope{
+		RequestId: uuid.New().String(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload: &control.Envelope_CancelJob{
+			CancelJob: &control.CancelJob{
+				JobId:     jobID,
+				AttemptId: int32(j.AttemptID),
+				Reason:    job.ReasonTimedOut,
+				Message:   message,
+			},
+		},
+	})
+	if err != nil && err != ErrAgentNotFound {
+		log.Printf("Failed to send CancelJob for job %s to agent %s: %v", jobID, agentID, err)
+	}
+}
+
+// handleJobProgress stores the latest progress of a running attempt (no response)
+func (g *Gateway) handleJobProgress(agentConn *AgentConnection, envelope *control.Envelope, progress *control.JobProgress) {
+	agentID := envelope.AgentId
+	if agentID == "" || agentConn.AgentID != agentID {
+		log.Printf("JobProgress agent_id mismatch: connection=%s, envelope=%s", agentConn.AgentID, agentID)
+		return
+	}
+	if progress.AgentId != "" && progress.AgentId != agentID {
+		log.Printf("JobProgress agent_id mismatch: envelope=%s, payload=%s", agentID, progress.AgentId)
+		return
+	}
+
+	j, err := g.jobStore.Get(progress.JobId)
+	if err != nil {
+		if err != job.ErrJobNotFound {
+			log.Printf("Failed to get job %s: %v", progress.JobId, err)
+		}
+		return
+	}
+	if j.AssignedAgentID != agentID || int(progress.AttemptId) != j.AttemptID || j.Status.IsTerminal() {
+		log.Printf("JobProgress for job %s (attempt %d) from agent %s rejected: not the running attempt of this agent", progress.JobId, progress.AttemptId, agentID)
+		return
+	}
+
+	if math.IsNaN(progress.Percent) || progress.Percent < 0 || progress.Percent > 100 {
+		log.Printf("JobProgress for job %s rejected: percent %v out of range", j.JobID, progress.Percent)
+		return
+	}
+	if progress.CurrentStep < 0 || progress.TotalSteps < 0 {
+		log.Printf("JobProgress for job %s rejected: negative step", j.JobID)
+		return
+	}
+	var metrics json.RawMessage
+	if progress.MetricsJson != "" {
+		var obj map[string]json.RawMessage
+		if len(progress.MetricsJson) > maxProgressMetricsSize || json.Unmarshal([]byte(progress.MetricsJson), &obj) != nil || obj == nil {
+			log.Printf("JobProgress for job %s: ignoring metrics (not a JSON object of at most %d bytes)", j.JobID, maxProgressMetricsSize)
+		} else {
+			metrics = json.RawMessage(progress.MetricsJson)
+		}
+	}
+
+	message := progress.Message
+	if len(message) > maxProgressMessageLength {
+		message = strings.ToValidUTF8(message[:maxProgressMessageLength], "")
+	}
+	p := &job.Progress{
+		Percent:     progress.Percent,
+		CurrentStep: int(progress.CurrentStep),
+		TotalSteps:  int(progress.TotalSteps),
+		Message:     message,
+		Metrics:     metrics,
+		UpdatedAt:   time.Now(),
+	}
+	if err := g.jobStore.UpdateProgress(j.JobID, p); err != nil {
+		log.Printf("Failed to update progress of job %s: %v", j.JobID, err)
+	}
+}
+
+// archiveLogs uploads the complete streamed output of a finished attempt as {output_prefix}stdout.log
+// and {output_prefix}stderr.log (in the background; the job's status does not depend on it)
+func (g *Gateway) archiveLogs(j *job.Job) {
+	if g.logs == nil {
+		return
+	}
+	var archive logs.ArchiveFunc
+	if g.ossProvider != nil && j.OutputPrefix != "" {
+		archive = func(stream logs.Stream, r io.Reader, size int64) error {
+			provider, err := oss.ForBucket(g.ossProvider, j.OutputBucket)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), logArchiveTimeout)
+			defer cancel()
+			url, err := provider.GenerateUploadURL(ctx, j.OutputPrefix+stream.FileName())
+			if err != nil {
+				return fmt.Errorf("failed to presign upload: %w", err)
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, r)
+			if err != nil {
+				return err
+			}
+			req.ContentLength = size
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return fmt.Errorf("upload returned status %d", resp.StatusCode)
+			}
+			return nil
+		}
+	}
+	go func() {
+		if err := g.logs.Finish(j.JobID, j.AttemptID, archive); err != nil {
+			log.Printf("Job %s (attempt %d): %v", j.JobID, j.AttemptID, err)
+		}
+	}()
+}
+
+// handleRefreshAccess mints fresh presigned URLs for a job the agent still holds.
+// URLs are only issued for the job's own input key and stored output key, and only while
+// the agent's lease and attempt are current, so a stale or foreign agent cannot obtain access.
+func (g *Gateway) handleRefreshAccess(agentConn *AgentConnection, envelope *control.Envelope, req *control.RefreshAccess) {
+	agentID := envelope.AgentId
+	if agentID == "" || agentConn.AgentID != agentID {
+		log.Printf("RefreshAccess agent_id mismatch: connection=%s, envelope=%s", agentConn.AgentID, agentID)
+		return
+	}
+	if req.AgentId != "" && req.AgentId != agentID {
+		log.Printf("RefreshAccess agent_id mismatch: envelope=%s, payload=%s", agentID, req.AgentId)
+		return
+	}
+
+	ack := &control.RefreshAccessAck{
+		JobId:     req.JobId,
+		AttemptId: req.AttemptId,
+	}
+	reply := func(message string) {
+		if message != "" {
+			log.Printf("RefreshAccess for job %s from agent %s rejected: %s", req.JobId, agentID, message)
+			ack.Success = false
+			ack.Message = message
+			ack.InputDownload = nil
+			ack.OutputUpload = nil
+			ack.OutputKey = ""
+			ack.OutputFileUploads = nil
+			ack.Inputs = nil
+			ack.Multipart = nil
+		} else {
+			ack.Success = true
+		}
+		data, err := proto.Marshal(&control.Envelope{
+			RequestId: envelope.RequestId,
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   &control.Envelope_RefreshAccessAck{RefreshAccessAck: ack},
+		})
+		if err != nil {
+			log.Printf("Failed to marshal RefreshAccessAck: %v", err)
+			return
+		}
+		agentConn.SendChan <- data
+	}
+
+	if g.ossProvider == nil {
+		reply("OSS provider not configured")
+		return
+	}
+
+	j, err := g.jobStore.Get(req.JobId)
+	if err != nil {
+		if err != job.ErrJobNotFound {
+			log.Printf("Failed to get job %s: %v", req.JobId, err)
+		}
+		reply("job not found")
+		return
+	}
+
+	// The request must come from the current holder of the current attempt
+	if j.AssignedAgentID != agentID {
+		reply("job is not assigned to this agent")
+		return
+	}
+	if int(req.AttemptId) != j.AttemptID {
+		reply(fmt.Sprintf("attempt_id mismatch: expected %d", j.AttemptID))
+		return
+	}
+	if j.LeaseID == "" || req.LeaseId != j.LeaseID {
+		reply("lease_id mismatch")
+		return
+	}
+	if j.Status != job.StatusAssigned && j.Status != job.StatusRunning {
+		reply(fmt.Sprintf("job is %s", j.Status))
+		return
+	}
+
+	ctx := context.Background()
+	if req.Input && j.InputBucket != "" && j.InputKey != "" {
+		url, err := g.inputAccess(ctx, j.InputBucket, j.InputKey)
+		if err != nil {
+			log.Printf("Failed to refresh input download URL for job %s: %v", j.JobID, err)
+			reply("failed to generate input URL")
+			return
+		}
+		ack.InputDownload = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: url}}
+	}
+	if len(req.Inputs) > 0 {
+		if len(req.Inputs) > job.MaxInputs {
+			reply(fmt.Sprintf("too many inputs (max %d)", job.MaxInputs))
+			return
+		}
+		inputs, err := g.namedInputAccess(ctx, j, req.Inputs)
+		if err != nil {
+			log.Printf("Failed to refresh named input URLs for job %s: %v", j.JobID, err)
+			reply(fmt.Sprintf("failed to generate input URLs: %v", err))
+			return
+		}
+		ack.Inputs = inputs
+	}
+	if req.Output {
+		// Only the output key (or prefix, for STS) recorded at assignment is ever granted
+		if j.OutputKey == "" || (g.sts != nil && g.isDefaultBucket(j.OutputBucket) && j.OutputPrefix == "") {
+			reply("job has no output key")
+			return
+		}
+		access, err := g.outputAccess(ctx, j.OutputBucket, j.OutputKey, j.OutputPrefix)
+		if err != nil {
+			log.Printf("Failed to refresh output upload access for job %s: %v", j.JobID, err)
+			reply("failed to generate output access")
+			return
+		}
+		ack.OutputUpload = access
+		ack.OutputKey = j.OutputKey
+	}
+	if len(req.OutputFiles) > 0 {
+		// Multi-file outputs: one presigned PUT per file, only under the attempt's output prefix
+		if len(req.OutputFiles) > maxRefreshOutputFiles {
+			reply(fmt.Sprintf("too many output_files (max %d per request)", maxRefreshOutputFiles))
+			return
+		}
+		provider, err := oss.ForBucket(g.ossProvider, j.OutputBucket)
+		if err != nil {
+			log.Printf("Failed to get OSS provider for job %s: %v", j.JobID, err)
+			reply("failed to generate output access")
+			return
+		}
+		ack.OutputFileUploads = make(map[string]*control.OSSAccess, len(req.OutputFiles))
+		for _, key := range req.OutputFiles {
+			if !j.IsOutputFileKey(key) {
+				reply(fmt.Sprintf("output file %s is not under output_prefix %s", key, j.OutputPrefix))
+				return
+			}
+			url, err := provider.GenerateUploadURL(ctx, key)
+			if err != nil {
+				log.Printf("Failed to generate upload URL for %s (job %s): %v", key, j.JobID, err)
+				reply("failed to generate output access")
+				return
+			}
+			ack.OutputFileUploads[key] = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: url}}
+		}
+	}
+
+	if req.Multipart != nil {
+		multipart, message := g.multipartStep(ctx, j, req.Multipart)
+		if message != "" {
+			reply(message)
+			return
+		}
+		ack.Multipart = multipart
+	}
+
+	log.Printf("Refreshed OSS access for job %s (attempt %d) on agent %s (input=%v, inputs=%d, output=%v, output_files=%d, multipart=%v)",
+		j.JobID, j.AttemptID, agentID, ack.InputDownload != nil, len(ack.Inputs), ack.OutputUpload != nil, len(ack.OutputFileUploads), ack.Multipart != nil)
+	reply("")
+}
+
+// multipartStep performs one step of an agent-driven multipart upload of a key under the job's output prefix.
+// The upload is started and completed with the cloud's credentials; the agent only receives part URLs.
+// Returns a rejection message instead of an ack if the step is not allowed or fails.
+func (g *Gateway) multipartStep(ctx context.Context, j *job.Job, req *control.MultipartUpload) (*control.MultipartUploadAck, string) {
+	if !j.IsOutputFileKey(req.Key) {
+		return nil, fmt.Sprintf("multipart key %s is not under output_prefix %s", req.Key, j.OutputPrefix)
+	}
+	if len(req.PartNumbers) > maxRefreshOutputFiles {
+		return nil, fmt.Sprintf("too many part_numbers (max %d per request)", maxRefreshOutputFiles)
+	}
+	provider, err := oss.ForBucket(g.ossProvider, j.OutputBucket)
+	if err != nil {
+		log.Printf("Failed to get OSS provider for job %s: %v", j.JobID, err)
+		return nil, "failed to generate output access"
+	}
+	uploader, ok := provider.(oss.MultipartUploader)
+	if !ok {
+		return nil, "multipart upload is not supported by the OSS provider"
+	}
+
+	ack := &control.MultipartUploadAck{Key: req.Key, UploadId: req.UploadId}
+	if req.Abort {
+		if req.UploadId == "" {
+			return nil, "upload_id is required to abort"
+		}
+		if err := uploader.AbortMultipartUpload(ctx, req.Key, req.UploadId); err != nil {
+			log.Printf("Failed to abort multipart upload of %s (job %s): %v", req.Key, j.JobID, err)
+			return nil, "failed to abort multipart upload"
+		}
+		return ack, ""
+	}
+	if ack.UploadId == "" {
+		ack.UploadId, err = uploader.CreateMultipartUpload(ctx, req.Key, req.ContentType)
+		if err != nil {
+			log.Printf("Failed to start multipart upload of %s (job %s): %v", req.Key, j.JobID, err)
+			return nil, "failed to start multipart upload"
+		}
+	}
+	if len(req.PartNumbers) > 0 {
+		ack.PartUploads = make(map[int32]*control.OSSAccess, len(req.PartNumbers))
+		for _, n := range req.PartNumbers {
+			url, err := uploader.GeneratePartUploadURL(ctx, req.Key, ack.UploadId, int(n))
+			if err != nil {
+				return nil, fmt.Sprintf("failed to generate part URL: %v", err)
+			}
+			ack.PartUploads[n] = &control.OSSAccess{Auth: &control.OSSAccess_PresignedUrl{PresignedUrl: url}}
+		}
+	}
+	if len(req.Complete) > 0 {
+		parts := make([]oss.CompletedPart, 0, len(req.Complete))
+		for _, part := range req.Complete {
+			parts = append(parts, oss.CompletedPart{PartNumber: int(part.PartNumber), ETag: part.Etag})
+		}
+		if err := oss.ValidateParts(parts); err != nil {
+			return nil, fmt.Sprintf("invalid parts: %v", err)
+		}
+		if err := uploader.CompleteMultipartUpload(ctx, req.Key, ack.UploadId, parts); err != nil {
+			log.Printf("Failed to complete multipart upload of %s (job %s): %v", req.Key, j.JobID, err)
+			return nil, "failed to complete multipart upload"
+		}
+		ack.Completed = true
+	}
+	return ack, ""
+}
+
+// verifyOutput confirms the primary output reported with SUCCEEDED with a HEAD on the object.
+// The object must exist and match the reported size and ETag (if any). The result carries the stored
+// ETag; it is nil if the agent reported no size/checksum and the provider cannot stat objects.
+func (g *Gateway) verifyOutput(j *job.Job, outputKey string, reported *control.OutputFile) (*job.OutputFile, error) {
+	var output *job.OutputFile
+	if reported != nil {
+		if reported.Key != "" && reported.Key != outputKey {
+			return nil, fmt.Errorf("output reported for %q, expected %q", reported.Key, outputKey)
+		}
+		if reported.Size < 0 || !job.ValidSHA256(reported.Sha256) {
+			return nil, fmt.Errorf("output has invalid size or sha256")
+		}
+		output = &job.OutputFile{
+			Key:         outputKey,
+			Size:        reported.Size,
+			SHA256:      strings.ToLower(reported.Sha256),
+			ContentType: reported.ContentType,
+			ETag:        reported.Etag,
+		}
+	}
+
+	provider, err := oss.ForBucket(g.ossProvider, j.OutputBucket)
+	if err != nil {
+		return nil, err
+	}
+	statter, ok := provider.(oss.ObjectStatter)
+	if !ok {
+		return output, nil
+	}
+	info, err := statOutput(statter, j.JobID, outputKey)
+	if errors.Is(err, oss.ErrObjectNotFound) {
+		return nil, fmt.Errorf("output %s was not uploaded", outputKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not confirm output %s in OSS: %w", outputKey, err)
+	}
+	if output == nil {
+		return nil, nil
+	}
+	if info.Size != output.Size {
+		return nil, fmt.Errorf("output %s has %d bytes in OSS, agent reported %d", outputKey, info.Size, output.Size)
+	}
+	if output.ETag != "" && info.ETag != "" && !etagsEqual(output.ETag, info.ETag) {
+		return nil, fmt.Errorf("output %s has ETag %s in OSS, agent reported %s", outputKey, info.ETag, output.ETag)
+	}
+	output.ETag = info.ETag
+	return output, nil
+}
+
+// verifyOutputFiles confirms every file of an output manifest with a HEAD on the object, like verifyOutput
+// does for the primary output: each object must exist and have the reported size. The stored ETags are
+// recorded in files. Nothing is checked if the provider cannot stat objects.
+func (g *Gateway) verifyOutputFiles(j *job.Job, files []job.OutputFile) error {
+	provider, err := oss.ForBucket(g.ossProvider, j.OutputBucket)
+	if err != nil {
+		return err
+	}
+	statter, ok := provider.(oss.ObjectStatter)
+	if !ok {
+		return nil
+	}
+
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, outputVerifyConcurrency)
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(f *job.OutputFile, errp *error) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			info, err := statOutput(statter, j.JobID, f.Key)
+			switch {
+			case errors.Is(err, oss.ErrObjectNotFound):
+				*errp = fmt.Errorf("output file %s was not uploaded", f.Key)
+			case err != nil:
+				*errp = fmt.Errorf("could not confirm output file %s in OSS: %w", f.Key, err)
+			case info.Size != f.Size:
+				*errp = fmt.Errorf("output file %s has %d bytes in OSS, agent reported %d", f.Key, info.Size, f.Size)
+			default:
+				f.ETag = info.ETag
+			}
+		}(&files[i], &errs[i])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statOutput looks up an output object, retrying failed requests: a job only succeeds once its outputs
+// are confirmed, so a store that cannot be asked fails the job after outputVerifyAttempts requests.
+// A missing object is reported at once (errors.Is(err, oss.ErrObjectNotFound)).
+func statOutput(statter oss.ObjectStatter, jobID, key string) (oss.ObjectInfo, error) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), outputVerifyTimeout)
+		info, err := statter.StatObject(ctx, key)
+		cancel()
+		if err == nil || errors.Is(err, oss.ErrObjectNotFound) || attempt >= outputVerifyAttempts {
+			return info, err
+		}
+		log.Printf("Warning: failed to stat output %s of job %s (attempt %d/%d): %v", key, jobID, attempt, outputVerifyAttempts, err)
+		time.Sleep(outputVerifyRetryDelay * time.Duration(attempt))
+	}
+}
+
+// etagsEqual compares ETags ignoring quotes and weak validators
+func etagsEqual(a, b string) bool {
+	normalize := func(etag string) string {
+		return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+	}
+	return normalize(a) == normalize(b)
+}
+
+// outputFilesFromProto validates the output manifest reported with SUCCEEDED.
+// Every key must be a distinct file under the job's output prefix, and manifest_key must be
+// {output_prefix}manifest.json.
+func outputFilesFromProto(j *job.Job, status *control.JobStatus) ([]job.OutputFile, error) {
+	if len(status.OutputFiles) > maxOutputFiles {
+		return nil, fmt.Errorf("too many output files (%d, max %d)", len(status.OutputFiles), maxOutputFiles)
+	}
+	manifestKey := j.OutputPrefix + job.ManifestFileName
+	if j.OutputPrefix == "" || status.ManifestKey != manifestKey {
+		return nil, fmt.Errorf("manifest_key %q, expected %q", status.ManifestKey, manifestKey)
+	}
+	files := make([]job.OutputFile, 0, len(status.OutputFiles))
+	seen := make(map[string]bool, len(status.OutputFiles))
+	for _, f := range status.OutputFiles {
+		if !j.IsOutputFileKey(f.Key) || f.Key == manifestKey {
+			return nil, fmt.Errorf("output file %q is not under output_prefix %s", f.Key, j.OutputPrefix)
+		}
+		if isLogFileKey(j, f.Key) {
+			return nil, fmt.Errorf("output file %q is reserved for the archived command output", f.Key)
+		}
+		if seen[f.Key] {
+			return nil, fmt.Errorf("output file %q is listed twice", f.Key)
+		}
+		seen[f.Key] = true
+		if f.Size < 0 || !job.ValidSHA256(f.Sha256) {
+			return nil, fmt.Errorf("output file %q has invalid size or sha256", f.Key)
+		}
+		files = append(files, job.OutputFile{
+			Key:         f.Key,
+			Size:        f.Size,
+			SHA256:      strings.ToLower(f.Sha256),
+			ContentType: f.ContentType,
+		})
+	}
+	return files, nil
+}
+
+// isLogFileKey reports whether key is reserved for an archived log (stdout.log, stderr.log) of the attempt
+func isLogFileKey(j *job.Job, key string) bool {
+	for _, stream := range logs.Streams {
+		if key == j.OutputPrefix+stream.FileName() {
+			return true
+		}
+	}
+	return false
+}
+
 // jobStatusFromProto converts protobuf JobStatusEnum to job.Status
 func jobStatusFromProto(status control.JobStatusEnum) job.Status {
 	switch status {
@@ -698,6 +1718,8 @@ func mapJobTypeToProto(jobType job.JobType) control.JobTypeEnum {
 	switch jobType {
 	case job.JobTypeForwardHTTP:
 		return control.JobTypeEnum_JOB_TYPE_FORWARD_HTTP
+	case job.JobTypeForwardGRPC:
+		return control.JobTypeEnum_JOB_TYPE_FORWARD_GRPC
 	case job.JobTypeCommand:
 		fallthrough
 	default:
@@ -735,6 +1757,60 @@ func parseForwardHeaders(headersJSON string) []*control.Header {
 	return result
 }
 
+// forwardAsyncToProto maps the async forward config of a job (nil for synchronous forward jobs)
+func forwardAsyncToProto(async *job.ForwardAsync) *control.ForwardAsync {
+	if async == nil {
+		return nil
+	}
+	return &control.ForwardAsync{
+		TaskIdField:     async.TaskIDField,
+		StatusUrl:       async.StatusURL,
+		PollIntervalSec: int32(async.PollIntervalSec),
+		StateField:      async.StateField,
+		SucceededStates: async.SucceededStates,
+		FailedStates:    async.FailedStates,
+		ResultUrl:       async.ResultURL,
+		ResultUrlField:  async.ResultURLField,
+		MessageField:    async.MessageField,
+	}
+}
+
+// forwardGRPCToProto maps the gRPC call of a FORWARD_GRPC job, with its metadata sorted by name
+func forwardGRPCToProto(call *job.ForwardGRPC, timeoutSec int) *control.ForwardGrpcRequest {
+	if call == nil {
+		return nil
+	}
+	names := make([]string, 0, len(call.Metadata))
+	for name := range call.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metadata := make([]*control.Header, 0, len(names))
+	for _, name := range names {
+		metadata = append(metadata, &control.Header{Key: name, Value: call.Metadata[name]})
+	}
+	return &control.ForwardGrpcRequest{
+		Target:       call.Target,
+		Method:       strings.TrimPrefix(call.Method, "/"),
+		RequestJson:  string(call.Request),
+		RequestProto: call.RequestProto,
+		Metadata:     metadata,
+		TimeoutSec:   int32(timeoutSec),
+	}
+}
+
+// forwardTarget returns the URL a forward job is routed by: agents only run forward jobs whose target
+// they permit (false for command jobs)
+func forwardTarget(j *job.Job) (string, bool) {
+	switch {
+	case j.JobType == job.JobTypeForwardHTTP:
+		return j.ForwardURL, true
+	case j.JobType == job.JobTypeForwardGRPC && j.ForwardGRPC != nil:
+		return control.GRPCTargetURL(j.ForwardGRPC.Target, j.ForwardGRPC.Method), true
+	}
+	return "", false
+}
+
 // SendMessage sends a message to an agent
 func (g *Gateway) SendMessage(agentID string, envelope *control.Envelope) error {
 	g.mu.RLock()
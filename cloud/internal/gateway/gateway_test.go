@@ -2,13 +2,23 @@ package gateway
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/events"
 	"github.com/xiresource/cloud/internal/job"
+	"github.com/xiresource/cloud/internal/logs"
+	"github.com/xiresource/cloud/internal/oss"
 	"github.com/xiresource/cloud/internal/queue"
 	"github.com/xiresource/cloud/internal/registry"
 	control "github.com/xiresource/proto/control"
@@ -36,6 +46,18 @@ func (m *mockRegistry) Register(agentID, hostname string, maxConcurrency int) {
 	}
 }
 
+func (m *mockRegistry) SetTemplates(agentID string, templates []string) {
+	if agent, exists := m.agents[agentID]; exists {
+		agent.Templates = templates
+	}
+}
+
+func (m *mockRegistry) SetForwardTargets(agentID string, targets []*control.ForwardTarget) {
+	if agent, exists := m.agents[agentID]; exists {
+		agent.ForwardTargets = targets
+	}
+}
+
 func (m *mockRegistry) UpdateHeartbeat(agentID string, paused bool, runningJobs int) {
 	if agent, exists := m.agents[agentID]; exists {
 		agent.LastHeartbeat = time.Now()
@@ -77,6 +99,15 @@ func (m *mockJobStore) Get(jobID string) (*job.Job, error) {
 	return j, nil
 }
 
+func (m *mockJobStore) GetByIdempotencyKey(submitter, key string) (*job.Job, error) {
+	for _, j := range m.jobs {
+		if key != "" && j.Submitter == submitter && j.IdempotencyKey == key {
+			return j, nil
+		}
+	}
+	return nil, job.ErrJobNotFound
+}
+
 func (m *mockJobStore) UpdateStatus(jobID string, newStatus job.Status) error {
 	j, exists := m.jobs[jobID]
 	if !exists {
@@ -86,6 +117,10 @@ func (m *mockJobStore) UpdateStatus(jobID string, newStatus job.Status) error {
 		return errors.New("invalid transition")
 	}
 	j.Status = newStatus
+	if newStatus == job.StatusAssigned {
+		now := time.Now()
+		j.AssignedAt = &now
+	}
 	return nil
 }
 
@@ -129,6 +164,24 @@ func (m *mockJobStore) UpdateStdoutStderr(jobID string, stdout, stderr string) e
 	return nil
 }
 
+func (m *mockJobStore) UpdateOutputFiles(jobID string, files []job.OutputFile) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.OutputFiles = files
+	return nil
+}
+
+func (m *mockJobStore) UpdateOutputFile(jobID string, file *job.OutputFile) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.Output = file
+	return nil
+}
+
 func (m *mockJobStore) UpdateMessage(jobID string, message string) error {
 	j, exists := m.jobs[jobID]
 	if !exists {
@@ -138,7 +191,74 @@ func (m *mockJobStore) UpdateMessage(jobID string, message string) error {
 	return nil
 }
 
+func (m *mockJobStore) UpdateForwardResponse(jobID string, response *job.ForwardResponse) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.ForwardResponse = response
+	return nil
+}
+
+func (m *mockJobStore) UpdateProcessUsage(jobID string, usage job.ProcessUsage) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.ExitCode = usage.ExitCode
+	j.Signal = usage.Signal
+	j.WallTimeMs = &usage.WallTimeMs
+	j.UserCPUMs = &usage.UserCPUMs
+	j.SystemCPUMs = &usage.SystemCPUMs
+	j.MaxRSSBytes = &usage.MaxRSSBytes
+	return nil
+}
+
+func (m *mockJobStore) UpdateReason(jobID string, reason string) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.Reason = reason
+	return nil
+}
+
+func (m *mockJobStore) TimeOut(jobID string, attemptID int, message string) (bool, error) {
+	j, exists := m.jobs[jobID]
+	if !exists || j.AttemptID != attemptID || (j.Status != job.StatusAssigned && j.Status != job.StatusRunning) {
+		return false, nil
+	}
+	j.Status = job.StatusFailed
+	j.Reason = job.ReasonTimedOut
+	j.Message = message
+	return true, nil
+}
+
+func (m *mockJobStore) UpdateProgress(jobID string, progress *job.Progress) error {
+	j, exists := m.jobs[jobID]
+	if !exists {
+		return job.ErrJobNotFound
+	}
+	j.Progress = progress
+	return nil
+}
+
 func (m *mockJobStore) List(limit int, offset int, status *job.Status) ([]*job.Job, error) {
+	ids := make([]string, 0, len(m.jobs))
+	for id, j := range m.jobs {
+		if status == nil || j.Status == *status {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var result []*job.Job
+	for i := offset; i < len(ids) && len(result) < limit; i++ {
+		result = append(result, m.jobs[ids[i]])
+	}
+	return result, nil
+}
+
+func (m *mockJobStore) ListBySubmitter(submitter string, limit int, offset int, status *job.Status) ([]*job.Job, error) {
 	// Not needed for this test
 	return nil, nil
 }
@@ -335,6 +455,9 @@ func TestGateway_HandleRequestJob(t *testing.T) {
 		if jobAssigned.InputKey != testJob.InputKey {
 			t.Errorf("JobAssigned.InputKey = %v, want %v", jobAssigned.InputKey, testJob.InputKey)
 		}
+		if jobAssigned.InputBucket != testJob.InputBucket {
+			t.Errorf("JobAssigned.InputBucket = %v, want %v", jobAssigned.InputBucket, testJob.InputBucket)
+		}
 
 	case <-time.After(1 * time.Second):
 		t.Fatal("No JobAssigned message received")
@@ -365,6 +488,7 @@ func TestGateway_HandleRequestJob_NoInputFile(t *testing.T) {
 		OutputBucket: "output-bucket",
 		AttemptID:    1,
 		Command:      "echo Hello World",
+		Shell:        true,
 	}
 	mockStore.Create(testJob)
 	mockQueue.Enqueue(context.Background(), jobID)
@@ -438,8 +562,8 @@ func TestGateway_HandleRequestJob_NoInputFile(t *testing.T) {
 		}
 
 		// Verify command is included
-		if jobAssigned.Command != testJob.Command {
-			t.Errorf("JobAssigned.Command = %v, want %v", jobAssigned.Command, testJob.Command)
+		if jobAssigned.Command != testJob.Command || !jobAssigned.Shell {
+			t.Errorf("JobAssigned.Command = %v (shell %v), want %v", jobAssigned.Command, jobAssigned.Shell, testJob.Command)
 		}
 
 	case <-time.After(1 * time.Second):
@@ -470,6 +594,7 @@ func TestGateway_HandleRequestJob_NoInput_EdgeCases(t *testing.T) {
 			OutputBucket: "output-bucket",
 			AttemptID:    1,
 			Command:      "echo test",
+			Shell:        true,
 		}
 		mockStore.Create(testJob)
 		mockQueue.Enqueue(context.Background(), jobID)
@@ -540,6 +665,7 @@ func TestGateway_HandleRequestJob_NoInput_EdgeCases(t *testing.T) {
 			OutputBucket: "output-bucket",
 			AttemptID:    1,
 			Command:      "echo test",
+			Shell:        true,
 		}
 		mockStore.Create(testJob)
 		mockQueue.Enqueue(context.Background(), jobID)
@@ -1698,3 +1824,1450 @@ func TestGateway_RunningJobsCapacitySync(t *testing.T) {
 		t.Errorf("After second assignment, RunningJobs = %v, want 1", agentInfo.RunningJobs)
 	}
 }
+
+// recordingNotifier records the jobs queued for completion notifications
+type recordingNotifier struct {
+	jobIDs []string
+}
+
+func (n *recordingNotifier) Enqueue(jobID string) {
+	n.jobIDs = append(n.jobIDs, jobID)
+}
+
+func TestGateway_HandleJobStatus_PublishesEvents(t *testing.T) {
+	// Setup
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockOSS := newMockOSSProvider()
+	gw := New(mockReg, mockStore, mockQueue, mockOSS, true)
+	broker := events.NewBroker()
+	gw.SetEvents(broker)
+	notifier := &recordingNotifier{}
+	gw.SetNotifier(notifier)
+	sub := broker.Subscribe(nil)
+	defer sub.Close()
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 1)
+
+	jobID := uuid.New().String()
+	mockStore.Create(&job.Job{
+		JobID:        jobID,
+		CreatedAt:    time.Now(),
+		Status:       job.StatusPending,
+		OutputBucket: "output-bucket",
+		AttemptID:    1,
+		Submitter:    "alice",
+	})
+	mockQueue.Enqueue(context.Background(), jobID)
+
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+
+	// Assignment publishes ASSIGNED
+	requestEnvelope := &control.Envelope{
+		AgentId:   agentID,
+		RequestId: uuid.New().String(),
+		Timestamp: time.Now().UnixMilli(),
+		Payload: &control.Envelope_RequestJob{
+			RequestJob: &control.RequestJob{AgentId: agentID},
+		},
+	}
+	gw.handleRequestJob(agentConn, requestEnvelope, requestEnvelope.GetRequestJob())
+
+	// Each status report publishes the stored state (the repeated FAILED report is ignored)
+	for _, s := range []control.JobStatusEnum{control.JobStatusEnum_JOB_STATUS_RUNNING, control.JobStatusEnum_JOB_STATUS_FAILED, control.JobStatusEnum_JOB_STATUS_FAILED} {
+		statusEnvelope := &control.Envelope{
+			AgentId:   agentID,
+			RequestId: uuid.New().String(),
+			Timestamp: time.Now().UnixMilli(),
+			Payload: &control.Envelope_JobStatus{
+				JobStatus: &control.JobStatus{
+					JobId:     jobID,
+					AttemptId: 1,
+					Status:    s,
+					Message:   "exit status 1",
+				},
+			},
+		}
+		gw.handleJobStatus(agentConn, statusEnvelope, statusEnvelope.GetJobStatus())
+	}
+
+	for _, want := range []job.Status{job.StatusAssigned, job.StatusRunning, job.StatusFailed} {
+		select {
+		case e := <-sub.C:
+			if e.JobID != jobID || e.Status != want {
+				t.Errorf("Event = %s/%s, want %s/%s", e.JobID, e.Status, jobID, want)
+			}
+			if e.Submitter != "alice" {
+				t.Errorf("Submitter = %s, want alice", e.Submitter)
+			}
+		default:
+			t.Fatalf("Expected %s event to be published", want)
+		}
+	}
+
+	// Only the transition to FAILED queues completion notifications
+	if len(notifier.jobIDs) != 1 || notifier.jobIDs[0] != jobID {
+		t.Errorf("Notified jobs = %v, want [%s]", notifier.jobIDs, jobID)
+	}
+}
+
+func TestGateway_HandleRefreshAccess(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 1)
+
+	jobID := "job-refresh"
+	outputKey := "jobs/job-refresh/2/output.json"
+	mockStore.Create(&job.Job{
+		JobID:           jobID,
+		CreatedAt:       time.Now(),
+		Status:          job.StatusRunning,
+		InputBucket:     "input-bucket",
+		InputKey:        "inputs/job-refresh/input.bin",
+		OutputBucket:    "output-bucket",
+		OutputKey:       outputKey,
+		AttemptID:       2,
+		AssignedAgentID: agentID,
+		LeaseID:         "lease-1",
+	})
+
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+
+	refresh := func(req *control.RefreshAccess) *control.RefreshAccessAck {
+		t.Helper()
+		envelope := &control.Envelope{
+			AgentId:   agentID,
+			RequestId: uuid.New().String(),
+			Timestamp: time.Now().UnixMilli(),
+			Payload:   &control.Envelope_RefreshAccess{RefreshAccess: req},
+		}
+		gw.handleRefreshAccess(agentConn, envelope, req)
+
+		select {
+		case data := <-agentConn.SendChan:
+			var reply control.Envelope
+			if err := proto.Unmarshal(data, &reply); err != nil {
+				t.Fatalf("Failed to unmarshal reply: %v", err)
+			}
+			if reply.RequestId != envelope.RequestId {
+				t.Errorf("Reply request_id = %s, want %s", reply.RequestId, envelope.RequestId)
+			}
+			return reply.GetRefreshAccessAck()
+		default:
+			t.Fatal("Expected RefreshAccessAck")
+			return nil
+		}
+	}
+
+	ack := refresh(&control.RefreshAccess{JobId: jobID, AttemptId: 2, LeaseId: "lease-1", Input: true, Output: true})
+	if !ack.Success {
+		t.Fatalf("Expected success, got message %q", ack.Message)
+	}
+	if ack.OutputKey != outputKey || !strings.Contains(ack.OutputUpload.GetPresignedUrl(), outputKey) {
+		t.Errorf("Output access = %s (%s), want URL for %s", ack.OutputUpload.GetPresignedUrl(), ack.OutputKey, outputKey)
+	}
+	if !strings.Contains(ack.InputDownload.GetPresignedUrl(), "inputs/job-refresh/input.bin") {
+		t.Errorf("Input access = %s, want URL for input key", ack.InputDownload.GetPresignedUrl())
+	}
+
+	// Output only
+	ack = refresh(&control.RefreshAccess{JobId: jobID, AttemptId: 2, LeaseId: "lease-1", Output: true})
+	if !ack.Success || ack.InputDownload != nil || ack.OutputUpload == nil {
+		t.Errorf("Output-only refresh = %+v", ack)
+	}
+
+	// Stale lease, stale attempt and unknown job are rejected without URLs
+	for _, req := range []*control.RefreshAccess{
+		{JobId: jobID, AttemptId: 2, LeaseId: "old-lease", Output: true},
+		{JobId: jobID, AttemptId: 1, LeaseId: "lease-1", Output: true},
+		{JobId: "missing", AttemptId: 1, LeaseId: "lease-1", Output: true},
+	} {
+		ack := refresh(req)
+		if ack.Success || ack.OutputUpload != nil || ack.Message == "" {
+			t.Errorf("Refresh %+v: expected rejection, got %+v", req, ack)
+		}
+	}
+
+	// Another agent cannot refresh access for this job
+	mockStore.jobs[jobID].AssignedAgentID = "agent-other"
+	ack = refresh(&control.RefreshAccess{JobId: jobID, AttemptId: 2, LeaseId: "lease-1", Output: true})
+	if ack.Success {
+		t.Error("Expected rejection for job assigned to another agent")
+	}
+
+	// Terminal jobs get no new URLs
+	mockStore.jobs[jobID].AssignedAgentID = agentID
+	mockStore.jobs[jobID].Status = job.StatusSucceeded
+	ack = refresh(&control.RefreshAccess{JobId: jobID, AttemptId: 2, LeaseId: "lease-1", Output: true})
+	if ack.Success {
+		t.Error("Expected rejection for terminal job")
+	}
+}
+
+func TestGateway_STSOutputAccess(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+	sts := oss.NewFakeSTSProvider("cos.ap-beijing.myqcloud.com", "output-bucket", time.Hour)
+	gw.SetSTSProvider(sts)
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 1)
+	mockReg.UpdateHeartbeat(agentID, false, 0)
+
+	jobID := "job-sts"
+	mockStore.Create(&job.Job{
+		JobID:        jobID,
+		CreatedAt:    time.Now(),
+		Status:       job.StatusPending,
+		OutputBucket: "output-bucket",
+		AttemptID:    1,
+	})
+	mockQueue.Enqueue(context.Background(), jobID)
+
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+	envelope := &control.Envelope{
+		AgentId:   agentID,
+		RequestId: uuid.New().String(),
+		Payload:   &control.Envelope_RequestJob{RequestJob: &control.RequestJob{AgentId: agentID}},
+	}
+	gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+
+	var assigned control.Envelope
+	select {
+	case msg := <-agentConn.SendChan:
+		if err := proto.Unmarshal(msg, &assigned); err != nil {
+			t.Fatalf("Failed to unmarshal JobAssigned: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No JobAssigned message received")
+	}
+	ja := assigned.GetJobAssigned()
+	creds := ja.GetOutputUpload().GetSts()
+	if creds == nil {
+		t.Fatalf("Expected STS output_upload, got %+v", ja.GetOutputUpload())
+	}
+	if ja.OutputPrefix != "jobs/job-sts/1/" || ja.OutputKey != "jobs/job-sts/1/output.bin" {
+		t.Errorf("Unexpected output prefix/key: %s %s", ja.OutputPrefix, ja.OutputKey)
+	}
+	if creds.Bucket != "output-bucket" || creds.Endpoint != "cos.ap-beijing.myqcloud.com" || creds.ExpiresAtMs <= time.Now().UnixMilli() {
+		t.Errorf("Unexpected credentials: %+v", creds)
+	}
+	if err := sts.Authorize(creds.AccessKeyId, creds.SecurityToken, ja.OutputPrefix+"extra/plot.png"); err != nil {
+		t.Errorf("Credentials should allow keys under the prefix: %v", err)
+	}
+	if err := sts.Authorize(creds.AccessKeyId, creds.SecurityToken, "jobs/other-job/1/output.bin"); err == nil {
+		t.Error("Credentials should not allow keys outside the prefix")
+	}
+
+	// Refresh issues new credentials for the same prefix
+	refresh := &control.RefreshAccess{JobId: jobID, AttemptId: 1, LeaseId: ja.LeaseId, Output: true}
+	gw.handleRefreshAccess(agentConn, &control.Envelope{AgentId: agentID, RequestId: "r-1",
+		Payload: &control.Envelope_RefreshAccess{RefreshAccess: refresh}}, refresh)
+	var reply control.Envelope
+	if err := proto.Unmarshal(<-agentConn.SendChan, &reply); err != nil {
+		t.Fatalf("Failed to unmarshal reply: %v", err)
+	}
+	ack := reply.GetRefreshAccessAck()
+	fresh := ack.GetOutputUpload().GetSts()
+	if !ack.Success || fresh == nil || fresh.AccessKeyId == creds.AccessKeyId {
+		t.Fatalf("Expected new STS credentials, got %+v", ack)
+	}
+	if issued, _ := sts.Lookup(fresh.AccessKeyId); issued.Prefix != ja.OutputPrefix {
+		t.Errorf("Refreshed credentials prefix = %s, want %s", issued.Prefix, ja.OutputPrefix)
+	}
+}
+
+func TestGateway_PerJobBuckets(t *testing.T) {
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   "http://objstore.lab:9100",
+		LocalDir:  t.TempDir(),
+	}, []oss.BucketConfig{{Name: "lab-archive"}})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	gw := New(mockReg, mockStore, mockQueue, buckets, true)
+	// STS credentials only cover the default bucket
+	gw.SetSTSProvider(oss.NewFakeSTSProvider("cos.ap-beijing.myqcloud.com", "lab-main", time.Hour))
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 1)
+	mockReg.UpdateHeartbeat(agentID, false, 0)
+
+	jobID := "job-buckets"
+	mockStore.Create(&job.Job{
+		JobID:        jobID,
+		CreatedAt:    time.Now(),
+		Status:       job.StatusPending,
+		InputBucket:  "lab-archive",
+		InputKey:     "inputs/data.bin",
+		OutputBucket: "lab-archive",
+		AttemptID:    1,
+	})
+	mockQueue.Enqueue(context.Background(), jobID)
+
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+	envelope := &control.Envelope{
+		AgentId:   agentID,
+		RequestId: uuid.New().String(),
+		Payload:   &control.Envelope_RequestJob{RequestJob: &control.RequestJob{AgentId: agentID}},
+	}
+	gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+
+	var assigned control.Envelope
+	select {
+	case msg := <-agentConn.SendChan:
+		if err := proto.Unmarshal(msg, &assigned); err != nil {
+			t.Fatalf("Failed to unmarshal JobAssigned: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No JobAssigned message received")
+	}
+	ja := assigned.GetJobAssigned()
+	if url := ja.GetInputDownload().GetPresignedUrl(); !strings.HasPrefix(url, "http://objstore.lab:9100/lab-archive/inputs/data.bin?") {
+		t.Errorf("Input URL not signed for the job's input bucket: %s", url)
+	}
+	if url := ja.GetOutputUpload().GetPresignedUrl(); !strings.HasPrefix(url, "http://objstore.lab:9100/lab-archive/jobs/job-buckets/1/output.bin?") {
+		t.Errorf("Output access not a presigned URL for the job's output bucket: %+v", ja.GetOutputUpload())
+	}
+}
+
+func TestGateway_NamedInputs(t *testing.T) {
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   "http://objstore.lab:9100",
+		LocalDir:  t.TempDir(),
+	}, []oss.BucketConfig{{Name: "lab-models"}})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	gw := New(mockReg, mockStore, mockQueue, buckets, true)
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 1)
+	mockReg.UpdateHeartbeat(agentID, false, 0)
+
+	jobID := "job-inputs"
+	mockStore.Create(&job.Job{
+		JobID:     jobID,
+		CreatedAt: time.Now(),
+		Status:    job.StatusPending,
+		AttemptID: 1,
+		Command:   "python analyze.py --model {input:model} --config {input:config} {output}",
+		Shell:     true,
+		Inputs: map[string]job.Input{
+			"model":  {Bucket: "lab-models", Key: "resnet/v2.pt"},
+			"config": {Bucket: "lab-main", Key: "configs/run.yaml"},
+		},
+	})
+	mockQueue.Enqueue(context.Background(), jobID)
+
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+	send := func(envelope *control.Envelope) *control.Envelope {
+		t.Helper()
+		switch payload := envelope.Payload.(type) {
+		case *control.Envelope_RequestJob:
+			gw.handleRequestJob(agentConn, envelope, payload.RequestJob)
+		case *control.Envelope_RefreshAccess:
+			gw.handleRefreshAccess(agentConn, envelope, payload.RefreshAccess)
+		}
+		select {
+		case msg := <-agentConn.SendChan:
+			var reply control.Envelope
+			if err := proto.Unmarshal(msg, &reply); err != nil {
+				t.Fatalf("Failed to unmarshal reply: %v", err)
+			}
+			return &reply
+		case <-time.After(time.Second):
+			t.Fatal("No reply received")
+			return nil
+		}
+	}
+
+	ja := send(&control.Envelope{
+		AgentId:   agentID,
+		RequestId: uuid.New().String(),
+		Payload:   &control.Envelope_RequestJob{RequestJob: &control.RequestJob{AgentId: agentID}},
+	}).GetJobAssigned()
+	if ja == nil || len(ja.Inputs) != 2 {
+		t.Fatalf("Expected JobAssigned with 2 inputs, got %v", ja)
+	}
+	// Sorted by name, each signed for its own bucket
+	if ja.Inputs[0].Name != "config" || ja.Inputs[0].Key != "configs/run.yaml" ||
+		!strings.HasPrefix(ja.Inputs[0].GetDownload().GetPresignedUrl(), "http://objstore.lab:9100/lab-main/configs/run.yaml?") {
+		t.Errorf("Unexpected config input: %v", ja.Inputs[0])
+	}
+	if ja.Inputs[1].Name != "model" || ja.Inputs[1].Bucket != "lab-models" || !strings.HasPrefix(ja.Inputs[1].GetDownload().GetPresignedUrl(), "http://objstore.lab:9100/lab-models/resnet/v2.pt?") {
+		t.Errorf("Unexpected model input: %v", ja.Inputs[1])
+	}
+	if ja.InputDownload != nil || ja.InputKey != "" {
+		t.Errorf("Job without input_key should not carry input_download: %v", ja)
+	}
+
+	refresh := func(names ...string) *control.RefreshAccessAck {
+		return send(&control.Envelope{
+			AgentId:   agentID,
+			RequestId: uuid.New().String(),
+			Payload: &control.Envelope_RefreshAccess{RefreshAccess: &control.RefreshAccess{
+				JobId: jobID, AttemptId: 1, LeaseId: ja.LeaseId, Inputs: names,
+			}},
+		}).GetRefreshAccessAck()
+	}
+	ack := refresh("model")
+	if !ack.Success || len(ack.Inputs) != 1 || ack.Inputs[0].Name != "model" || ack.Inputs[0].GetDownload().GetPresignedUrl() == "" {
+		t.Errorf("Unexpected refresh ack: %v", ack)
+	}
+	ack = refresh("model", "weights")
+	if ack.Success || len(ack.Inputs) != 0 || !strings.Contains(ack.Message, "weights") {
+		t.Errorf("Unknown input name should be rejected: %v", ack)
+	}
+}
+
+func TestGateway_MultipartUpload(t *testing.T) {
+	dir := t.TempDir()
+	store, err := oss.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	handler, err := oss.NewLocalStoreHandler(store, "secret", 1<<20)
+	if err != nil {
+		t.Fatalf("NewLocalStoreHandler failed: %v", err)
+	}
+	objstore := httptest.NewServer(handler)
+	defer objstore.Close()
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   objstore.URL,
+		LocalDir:  dir,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 1)
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+	prefix := "jobs/job-mp/1/"
+	mockStore.Create(&job.Job{
+		JobID:           "job-mp",
+		CreatedAt:       time.Now(),
+		Status:          job.StatusRunning,
+		OutputKey:       prefix + "output.bin",
+		OutputPrefix:    prefix,
+		AttemptID:       1,
+		AssignedAgentID: agentID,
+		LeaseID:         "lease-1",
+	})
+	refresh := func(gw *Gateway, mp *control.MultipartUpload) *control.RefreshAccessAck {
+		t.Helper()
+		gw.handleRefreshAccess(agentConn, &control.Envelope{AgentId: agentID, RequestId: uuid.New().String()},
+			&control.RefreshAccess{JobId: "job-mp", AttemptId: 1, LeaseId: "lease-1", Multipart: mp})
+		var reply control.Envelope
+		if err := proto.Unmarshal(<-agentConn.SendChan, &reply); err != nil {
+			t.Fatalf("Failed to unmarshal reply: %v", err)
+		}
+		return reply.GetRefreshAccessAck()
+	}
+	gw := New(mockReg, mockStore, newMockQueue(), buckets, true)
+	key := prefix + "output.bin"
+
+	// Start the upload and presign both parts in one request
+	ack := refresh(gw, &control.MultipartUpload{Key: key, ContentType: "application/octet-stream", PartNumbers: []int32{1, 2}})
+	mp := ack.GetMultipart()
+	if !ack.Success || mp.GetUploadId() == "" || len(mp.PartUploads) != 2 {
+		t.Fatalf("Unexpected start ack: %v", ack)
+	}
+	var parts []*control.UploadedPart
+	for i, content := range []string{"first part,", "second part"} {
+		req, _ := http.NewRequest(http.MethodPut, mp.PartUploads[int32(i+1)].GetPresignedUrl(), strings.NewReader(content))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Part %d PUT failed: %v %v", i+1, err, resp)
+		}
+		resp.Body.Close()
+		parts = append(parts, &control.UploadedPart{PartNumber: int32(i + 1), Etag: resp.Header.Get("ETag")})
+	}
+
+	// Out-of-order parts are rejected without completing the upload
+	ack = refresh(gw, &control.MultipartUpload{Key: key, UploadId: mp.UploadId, Complete: []*control.UploadedPart{parts[1], parts[0]}})
+	if ack.Success || ack.Multipart != nil || !strings.Contains(ack.Message, "ascending") {
+		t.Errorf("Expected rejection of unordered parts, got %v", ack)
+	}
+	ack = refresh(gw, &control.MultipartUpload{Key: key, UploadId: mp.UploadId, Complete: parts})
+	if !ack.Success || !ack.GetMultipart().GetCompleted() {
+		t.Fatalf("Unexpected complete ack: %v", ack)
+	}
+	f, err := store.Open("lab-main", key)
+	if err != nil {
+		t.Fatalf("Assembled object missing: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "first part,second part" {
+		t.Errorf("Assembled object = %q", data)
+	}
+
+	// Keys outside the attempt's prefix and providers without multipart support are rejected
+	if ack := refresh(gw, &control.MultipartUpload{Key: "jobs/other/1/x.bin"}); ack.Success || ack.Multipart != nil {
+		t.Errorf("Expected rejection of foreign key, got %v", ack)
+	}
+	tooMany := make([]int32, maxRefreshOutputFiles+1)
+	if ack := refresh(gw, &control.MultipartUpload{Key: key, PartNumbers: tooMany}); ack.Success {
+		t.Errorf("Expected rejection of %d part numbers, got %v", len(tooMany), ack)
+	}
+	plain := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+	if ack := refresh(plain, &control.MultipartUpload{Key: key}); ack.Success || !strings.Contains(ack.Message, "not supported") {
+		t.Errorf("Expected unsupported provider rejection, got %v", ack)
+	}
+}
+
+func TestGateway_OutputManifest(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+
+	agentID := "agent-123"
+	mockReg.Register(agentID, "test-host", 2)
+	mockReg.UpdateHeartbeat(agentID, false, 2)
+	agentConn := &AgentConnection{
+		AgentID:   agentID,
+		SendChan:  make(chan []byte, 256),
+		CloseChan: make(chan struct{}),
+	}
+
+	newJob := func(jobID string) string {
+		prefix := "jobs/" + jobID + "/1/"
+		mockStore.Create(&job.Job{
+			JobID:           jobID,
+			CreatedAt:       time.Now(),
+			Status:          job.StatusRunning,
+			OutputKey:       prefix + "output.json",
+			OutputPrefix:    prefix,
+			AttemptID:       1,
+			AssignedAgentID: agentID,
+			LeaseID:         "lease-1",
+		})
+		return prefix
+	}
+	envelope := func() *control.Envelope {
+		return &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Timestamp: time.Now().UnixMilli()}
+	}
+	refresh := func(req *control.RefreshAccess) *control.RefreshAccessAck {
+		t.Helper()
+		gw.handleRefreshAccess(agentConn, envelope(), req)
+		var reply control.Envelope
+		if err := proto.Unmarshal(<-agentConn.SendChan, &reply); err != nil {
+			t.Fatalf("Failed to unmarshal reply: %v", err)
+		}
+		return reply.GetRefreshAccessAck()
+	}
+
+	// Presigned URLs for any file under the attempt's prefix
+	prefix := newJob("job-files")
+	keys := []string{prefix + "plots/loss.png", prefix + "manifest.json"}
+	ack := refresh(&control.RefreshAccess{JobId: "job-files", AttemptId: 1, LeaseId: "lease-1", OutputFiles: keys})
+	if !ack.Success || len(ack.OutputFileUploads) != 2 || !strings.Contains(ack.OutputFileUploads[keys[0]].GetPresignedUrl(), keys[0]) {
+		t.Fatalf("Unexpected ack: %+v", ack)
+	}
+	for _, bad := range []string{"jobs/other/1/x.bin", prefix + "../../x", prefix, prefix + "a//b"} {
+		ack := refresh(&control.RefreshAccess{JobId: "job-files", AttemptId: 1, LeaseId: "lease-1", OutputFiles: []string{prefix + "ok.txt", bad}})
+		if ack.Success || len(ack.OutputFileUploads) != 0 {
+			t.Errorf("Key %q: expected rejection, got %+v", bad, ack)
+		}
+	}
+	tooMany := make([]string, maxRefreshOutputFiles+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%sfile-%d.txt", prefix, i)
+	}
+	if ack := refresh(&control.RefreshAccess{JobId: "job-files", AttemptId: 1, LeaseId: "lease-1", OutputFiles: tooMany}); ack.Success {
+		t.Error("Expected rejection for too many output_files")
+	}
+
+	// SUCCEEDED with a manifest stores the output files
+	sha := strings.Repeat("ab", 32)
+	files := []*control.OutputFile{
+		{Key: prefix + "output.json", Size: 11, Sha256: sha, ContentType: "application/json"},
+		{Key: prefix + "plots/loss.png", Size: 2048, Sha256: sha, ContentType: "image/png"},
+	}
+	gw.handleJobStatus(agentConn, envelope(), &control.JobStatus{
+		JobId: "job-files", AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED,
+		OutputKey: prefix + "output.json", OutputFiles: files, ManifestKey: prefix + "manifest.json",
+	})
+	j, _ := mockStore.Get("job-files")
+	if j.Status != job.StatusSucceeded || len(j.OutputFiles) != 2 || j.OutputFiles[1].ContentType != "image/png" || j.ManifestKey() != prefix+"manifest.json" {
+		t.Errorf("Unexpected job after SUCCEEDED: %+v", j)
+	}
+
+	// A manifest with a wrong manifest_key, keys outside the prefix, duplicates or bad hashes fails the job
+	for i, bad := range []*control.JobStatus{
+		{OutputFiles: []*control.OutputFile{{Key: "x.bin", Sha256: sha}}, ManifestKey: "manifest.json"},
+		{OutputFiles: []*control.OutputFile{{Key: "jobs/other/1/x.bin", Sha256: sha}}},
+		{OutputFiles: []*control.OutputFile{{Key: "x.bin", Sha256: sha}, {Key: "x.bin", Sha256: sha}}},
+		{OutputFiles: []*control.OutputFile{{Key: "manifest.json", Sha256: sha}}},
+		{OutputFiles: []*control.OutputFile{{Key: "x.bin", Sha256: "short"}}},
+		{OutputFiles: []*control.OutputFile{{Key: "x.bin", Sha256: strings.Repeat("zz", 32)}}},
+	} {
+		jobID := fmt.Sprintf("job-bad-%d", i)
+		prefix := newJob(jobID)
+		for _, f := range bad.OutputFiles {
+			if !strings.HasPrefix(f.Key, "jobs/") {
+				f.Key = prefix + f.Key
+			}
+		}
+		if bad.ManifestKey == "" {
+			bad.ManifestKey = prefix + "manifest.json"
+		}
+		bad.JobId, bad.AttemptId, bad.Status = jobID, 1, control.JobStatusEnum_JOB_STATUS_SUCCEEDED
+		gw.handleJobStatus(agentConn, envelope(), bad)
+		if j, _ := mockStore.Get(jobID); j.Status != job.StatusFailed || len(j.OutputFiles) != 0 || !strings.Contains(j.Message, "Invalid output manifest") {
+			t.Errorf("Case %d: expected FAILED without output files, got %s (%q)", i, j.Status, j.Message)
+		}
+	}
+}
+
+func TestGateway_OutputVerification(t *testing.T) {
+	dir := t.TempDir()
+	store, err := oss.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   "http://objstore.test",
+		LocalDir:  dir,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 4)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+	gw := New(mockReg, mockStore, newMockQueue(), buckets, true)
+
+	sha := sha256.Sum256([]byte("result"))
+	succeed := func(jobID string, stored bool, output *control.OutputFile) *job.Job {
+		t.Helper()
+		key := "jobs/" + jobID + "/1/output.bin"
+		mockStore.Create(&job.Job{
+			JobID:           jobID,
+			CreatedAt:       time.Now(),
+			Status:          job.StatusRunning,
+			OutputBucket:    "lab-main",
+			OutputKey:       key,
+			OutputPrefix:    "jobs/" + jobID + "/1/",
+			AttemptID:       1,
+			AssignedAgentID: agentID,
+		})
+		if stored {
+			if _, err := store.Put("lab-main", key, strings.NewReader("result")); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		gw.handleJobStatus(agentConn, &control.Envelope{AgentId: agentID}, &control.JobStatus{
+			JobId: jobID, AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED, OutputKey: key, Output: output,
+		})
+		j, _ := mockStore.Get(jobID)
+		return j
+	}
+
+	// A reported output matching the stored object succeeds and records the stored ETag
+	j := succeed("job-ok", true, &control.OutputFile{Size: 6, Sha256: hex.EncodeToString(sha[:]), ContentType: "text/plain"})
+	if j.Status != job.StatusSucceeded || j.Output == nil || j.Output.Size != 6 || j.Output.ETag == "" {
+		t.Errorf("Expected SUCCEEDED with verified output, got %s (%+v)", j.Status, j.Output)
+	}
+
+	// Without a reported output (older agents), the object only has to exist
+	if j := succeed("job-legacy", true, nil); j.Status != job.StatusSucceeded || j.Output != nil {
+		t.Errorf("Expected SUCCEEDED without output details, got %s (%+v)", j.Status, j.Output)
+	}
+
+	for i, tc := range []struct {
+		stored bool
+		output *control.OutputFile
+	}{
+		{stored: false, output: nil},
+		{stored: true, output: &control.OutputFile{Size: 7, Sha256: hex.EncodeToString(sha[:])}},
+		{stored: true, output: &control.OutputFile{Size: 6, Sha256: hex.EncodeToString(sha[:]), Etag: `"other"`}},
+		{stored: true, output: &control.OutputFile{Size: 6, Sha256: "short"}},
+		{stored: true, output: &control.OutputFile{Key: "jobs/other/1/output.bin", Size: 6, Sha256: hex.EncodeToString(sha[:])}},
+	} {
+		j := succeed(fmt.Sprintf("job-bad-%d", i), tc.stored, tc.output)
+		if j.Status != job.StatusFailed || j.Output != nil || !strings.Contains(j.Message, "Output verification failed") {
+			t.Errorf("Case %d: expected FAILED, got %s (%q)", i, j.Status, j.Message)
+		}
+	}
+
+	// Every file of a manifest is checked against OSS, not only the primary output
+	manifest := func(jobID string, sizes map[string]int64) *job.Job {
+		t.Helper()
+		prefix := "jobs/" + jobID + "/1/"
+		mockStore.Create(&job.Job{
+			JobID:           jobID,
+			CreatedAt:       time.Now(),
+			Status:          job.StatusRunning,
+			OutputBucket:    "lab-main",
+			OutputPrefix:    prefix,
+			AttemptID:       1,
+			AssignedAgentID: agentID,
+		})
+		if _, err := store.Put("lab-main", prefix+"a.txt", strings.NewReader("result")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		var files []*control.OutputFile
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if size, ok := sizes[name]; ok {
+				files = append(files, &control.OutputFile{Key: prefix + name, Size: size, Sha256: strings.ToUpper(hex.EncodeToString(sha[:]))})
+			}
+		}
+		gw.handleJobStatus(agentConn, &control.Envelope{AgentId: agentID}, &control.JobStatus{
+			JobId: jobID, AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED, OutputFiles: files, ManifestKey: prefix + job.ManifestFileName,
+		})
+		j, _ := mockStore.Get(jobID)
+		return j
+	}
+	j = manifest("job-manifest-ok", map[string]int64{"a.txt": 6})
+	if j.Status != job.StatusSucceeded || len(j.OutputFiles) != 1 || j.OutputFiles[0].ETag == "" || j.OutputFiles[0].SHA256 != hex.EncodeToString(sha[:]) {
+		t.Errorf("Expected SUCCEEDED with verified, lowercased manifest, got %s (%+v)", j.Status, j.OutputFiles)
+	}
+	for _, tc := range []struct {
+		jobID string
+		sizes map[string]int64
+	}{
+		{"job-manifest-missing", map[string]int64{"a.txt": 6, "b.txt": 6}},
+		{"job-manifest-size", map[string]int64{"a.txt": 7}},
+	} {
+		if j := manifest(tc.jobID, tc.sizes); j.Status != job.StatusFailed || len(j.OutputFiles) != 0 || !strings.Contains(j.Message, "Output verification failed") {
+			t.Errorf("%s: expected FAILED, got %s (%q)", tc.jobID, j.Status, j.Message)
+		}
+	}
+}
+
+// flakyStatProvider is an OSS provider whose HEAD requests fail a number of times before they succeed
+type flakyStatProvider struct {
+	*mockOSSProvider
+	failures int
+	calls    int
+}
+
+func (p *flakyStatProvider) StatObject(ctx context.Context, key string) (oss.ObjectInfo, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return oss.ObjectInfo{}, errors.New("503 Service Unavailable")
+	}
+	return oss.ObjectInfo{Size: 6, ETag: `"etag"`}, nil
+}
+
+func TestGateway_OutputVerificationRetries(t *testing.T) {
+	defer func(delay time.Duration) { outputVerifyRetryDelay = delay }(outputVerifyRetryDelay)
+	outputVerifyRetryDelay = time.Millisecond
+
+	agentID := "agent-123"
+	sha := sha256.Sum256([]byte("result"))
+	for _, tc := range []struct {
+		failures   int
+		wantStatus job.Status
+	}{
+		{failures: outputVerifyAttempts - 1, wantStatus: job.StatusSucceeded},
+		{failures: outputVerifyAttempts, wantStatus: job.StatusFailed},
+	} {
+		mockReg := newMockRegistry()
+		mockStore := newMockJobStore()
+		mockReg.Register(agentID, "test-host", 4)
+		agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+		provider := &flakyStatProvider{mockOSSProvider: newMockOSSProvider(), failures: tc.failures}
+		gw := New(mockReg, mockStore, newMockQueue(), provider, true)
+
+		key := "jobs/job-flaky/1/output.bin"
+		mockStore.Create(&job.Job{
+			JobID:           "job-flaky",
+			CreatedAt:       time.Now(),
+			Status:          job.StatusRunning,
+			OutputBucket:    "lab-main",
+			OutputKey:       key,
+			OutputPrefix:    "jobs/job-flaky/1/",
+			AttemptID:       1,
+			AssignedAgentID: agentID,
+		})
+		gw.handleJobStatus(agentConn, &control.Envelope{AgentId: agentID}, &control.JobStatus{
+			JobId: "job-flaky", AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED, OutputKey: key,
+			Output: &control.OutputFile{Size: 6, Sha256: hex.EncodeToString(sha[:])},
+		})
+
+		// A store that keeps failing never lets the job succeed unconfirmed
+		j, _ := mockStore.Get("job-flaky")
+		if j.Status != tc.wantStatus {
+			t.Errorf("%d failed HEAD requests: status %s (%q), want %s", tc.failures, j.Status, j.Message, tc.wantStatus)
+		}
+		if tc.wantStatus == job.StatusFailed && !strings.Contains(j.Message, "could not confirm output") {
+			t.Errorf("%d failed HEAD requests: message %q, want the verification error", tc.failures, j.Message)
+		}
+		if provider.calls != outputVerifyAttempts {
+			t.Errorf("%d failed HEAD requests: %d requests made, want %d", tc.failures, provider.calls, outputVerifyAttempts)
+		}
+	}
+}
+
+func TestGateway_LogStreaming(t *testing.T) {
+	dir := t.TempDir()
+	store, err := oss.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	handler, err := oss.NewLocalStoreHandler(store, "secret", 1<<20)
+	if err != nil {
+		t.Fatalf("NewLocalStoreHandler failed: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	buckets, err := oss.NewRegistry(oss.Config{
+		Provider:  oss.ProviderLocal,
+		SecretKey: "secret",
+		Bucket:    "lab-main",
+		BaseURL:   server.URL,
+		LocalDir:  dir,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 4)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+	gw := New(mockReg, mockStore, newMockQueue(), buckets, true)
+	logCfg := logs.DefaultConfig()
+	logCfg.SpoolDir = t.TempDir()
+	logStore := logs.NewStore(logCfg)
+	gw.SetLogs(logStore)
+
+	mockStore.Create(&job.Job{
+		JobID:           "job-logs",
+		CreatedAt:       time.Now(),
+		Status:          job.StatusRunning,
+		OutputBucket:    "lab-main",
+		OutputPrefix:    "jobs/job-logs/2/",
+		AttemptID:       2,
+		AssignedAgentID: agentID,
+	})
+
+	send := func(agent string, chunk *control.LogChunk) *control.LogChunkAck {
+		t.Helper()
+		gw.handleLogChunk(&AgentConnection{AgentID: agent, SendChan: agentConn.SendChan}, &control.Envelope{AgentId: agent}, chunk)
+		select {
+		case data := <-agentConn.SendChan:
+			var envelope control.Envelope
+			if err := proto.Unmarshal(data, &envelope); err != nil {
+				t.Fatalf("Failed to unmarshal ack: %v", err)
+			}
+			return envelope.GetLogChunkAck()
+		default:
+			t.Fatalf("No LogChunkAck sent")
+			return nil
+		}
+	}
+
+	chunks := []*control.LogChunk{
+		{JobId: "job-logs", AttemptId: 2, Seq: 1, Stream: control.LogStream_LOG_STREAM_STDOUT, Data: []byte("epoch 1\n")},
+		{JobId: "job-logs", AttemptId: 2, Seq: 2, Stream: control.LogStream_LOG_STREAM_STDERR, Data: []byte("warning\n")},
+		{JobId: "job-logs", AttemptId: 2, Seq: 3, Stream: control.LogStream_LOG_STREAM_STDOUT, Data: []byte("epoch 2\n")},
+		{JobId: "job-logs", AttemptId: 2, Seq: 4, Eof: true},
+	}
+	for _, chunk := range chunks {
+		if ack := send(agentID, chunk); ack.AckedSeq != chunk.Seq || ack.Stop || ack.JobId != "job-logs" || ack.AttemptId != 2 {
+			t.Errorf("Ack for seq %d = %+v", chunk.Seq, ack)
+		}
+	}
+	// Duplicates are acknowledged without being appended twice
+	if ack := send(agentID, chunks[0]); ack.AckedSeq != 4 {
+		t.Errorf("Ack for duplicate = %+v, want acked_seq 4", ack)
+	}
+	tail, ok := logStore.Tail("job-logs", 0)
+	if !ok || len(tail.Chunks) != 3 || !tail.Done {
+		t.Fatalf("Tail = %+v, %v", tail, ok)
+	}
+
+	// Other agents and other attempts are told to stop
+	if ack := send("agent-other", &control.LogChunk{JobId: "job-logs", AttemptId: 2, Seq: 5}); !ack.Stop {
+		t.Errorf("Chunk from another agent not stopped: %+v", ack)
+	}
+	if ack := send(agentID, &control.LogChunk{JobId: "job-logs", AttemptId: 1, Seq: 5}); !ack.Stop {
+		t.Errorf("Chunk of an old attempt not stopped: %+v", ack)
+	}
+	if ack := send(agentID, &control.LogChunk{JobId: "job-missing", AttemptId: 1, Seq: 1}); !ack.Stop {
+		t.Errorf("Chunk of an unknown job not stopped: %+v", ack)
+	}
+
+	// The end of the attempt archives the complete output under the output prefix
+	gw.handleJobStatus(agentConn, &control.Envelope{AgentId: agentID}, &control.JobStatus{
+		JobId: "job-logs", AttemptId: 2, Status: control.JobStatusEnum_JOB_STATUS_FAILED, Message: "exit status 1",
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if exists, _ := store.Exists("lab-main", "jobs/job-logs/2/stderr.log"); exists {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for key, want := range map[string]string{
+		"jobs/job-logs/2/stdout.log": "epoch 1\nepoch 2\n",
+		"jobs/job-logs/2/stderr.log": "warning\n",
+	} {
+		f, err := store.Open("lab-main", key)
+		if err != nil {
+			t.Errorf("Archived log %s: %v", key, err)
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", key, data, want)
+		}
+	}
+
+	// A finished job accepts no more chunks
+	if ack := send(agentID, &control.LogChunk{JobId: "job-logs", AttemptId: 2, Seq: 5}); !ack.Stop {
+		t.Errorf("Chunk after FAILED not stopped: %+v", ack)
+	}
+
+	// Without a log store, agents are told to stop
+	gw.SetLogs(nil)
+	mockStore.Create(&job.Job{JobID: "job-nolog", Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID})
+	if ack := send(agentID, &control.LogChunk{JobId: "job-nolog", AttemptId: 1, Seq: 1}); !ack.Stop {
+		t.Errorf("Chunk without log store not stopped: %+v", ack)
+	}
+
+	// stdout.log and stderr.log cannot be claimed by the output manifest
+	j := &job.Job{JobID: "job-x", OutputPrefix: "jobs/job-x/1/"}
+	_, err = outputFilesFromProto(j, &control.JobStatus{
+		ManifestKey: "jobs/job-x/1/manifest.json",
+		OutputFiles: []*control.OutputFile{{Key: "jobs/job-x/1/stdout.log", Sha256: strings.Repeat("a", 64)}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Manifest with stdout.log: err = %v", err)
+	}
+}
+
+func TestGateway_JobProgress(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 4)
+	gw := New(mockReg, mockStore, newMockQueue(), nil, true)
+
+	mockStore.Create(&job.Job{
+		JobID:           "job-progress",
+		CreatedAt:       time.Now(),
+		Status:          job.StatusRunning,
+		AttemptID:       2,
+		AssignedAgentID: agentID,
+	})
+	send := func(agent string, progress *control.JobProgress) *job.Progress {
+		t.Helper()
+		gw.handleJobProgress(&AgentConnection{AgentID: agent}, &control.Envelope{AgentId: agent}, progress)
+		j, _ := mockStore.Get("job-progress")
+		return j.Progress
+	}
+
+	p := send(agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 40, CurrentStep: 2, TotalSteps: 5, Message: "training", MetricsJson: `{"loss":0.31}`})
+	if p == nil || p.Percent != 40 || p.CurrentStep != 2 || p.TotalSteps != 5 || p.Message != "training" || string(p.Metrics) != `{"loss":0.31}` || p.UpdatedAt.IsZero() {
+		t.Fatalf("Progress = %+v", p)
+	}
+
+	// Rejected: other agents, other attempts, invalid values
+	rejected := []struct {
+		agent    string
+		progress *control.JobProgress
+	}{
+		{"agent-999", &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 50}},
+		{agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 1, Percent: 50}},
+		{agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 150}},
+		{agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 50, CurrentStep: -1}},
+	}
+	for i, tc := range rejected {
+		if p := send(tc.agent, tc.progress); p.Percent != 40 {
+			t.Errorf("Case %d: progress updated to %+v", i, p)
+		}
+	}
+
+	// Invalid metrics are dropped, the rest is kept
+	p = send(agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 60, MetricsJson: `[1,2]`})
+	if p.Percent != 60 || p.Metrics != nil {
+		t.Errorf("Progress with invalid metrics = %+v", p)
+	}
+	p = send(agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 70, MetricsJson: `{"x":"` + strings.Repeat("a", maxProgressMetricsSize) + `"}`})
+	if p.Percent != 70 || p.Metrics != nil {
+		t.Errorf("Progress with oversized metrics = %+v", p)
+	}
+
+	// Progress of a finished job is not updated
+	mockStore.UpdateStatus("job-progress", job.StatusSucceeded)
+	if p = send(agentID, &control.JobProgress{JobId: "job-progress", AttemptId: 2, Percent: 100}); p.Percent != 70 {
+		t.Errorf("Finished job: progress updated to %+v", p)
+	}
+}
+
+func TestGateway_HandleJobStatus_ProcessUsage(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 2)
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+
+	report := func(jobID string, status control.JobStatusEnum, usage *control.ProcessUsage) *job.Job {
+		t.Helper()
+		mockStore.Create(&job.Job{JobID: jobID, CreatedAt: time.Now(), Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID})
+		envelope := &control.Envelope{AgentId: agentID, Payload: &control.Envelope_JobStatus{JobStatus: &control.JobStatus{
+			JobId: jobID, AttemptId: 1, Status: status, Message: "Command execution failed", Usage: usage,
+		}}}
+		gw.handleJobStatus(agentConn, envelope, envelope.GetJobStatus())
+		j, _ := mockStore.Get(jobID)
+		return j
+	}
+
+	// Killed by a signal (e.g. the OOM killer): no exit code
+	j := report("job-oom", control.JobStatusEnum_JOB_STATUS_FAILED, &control.ProcessUsage{
+		Signal: "SIGKILL", WallTimeMs: 5000, UserCpuMs: 4200, SystemCpuMs: 300, MaxRssBytes: 8 << 30,
+	})
+	if j.Status != job.StatusFailed || j.ExitCode != nil || j.Signal != "SIGKILL" {
+		t.Errorf("Killed job: status %s, exit code %v, signal %q", j.Status, j.ExitCode, j.Signal)
+	}
+	if j.WallTimeMs == nil || *j.WallTimeMs != 5000 || *j.UserCPUMs != 4200 || *j.SystemCPUMs != 300 || *j.MaxRSSBytes != 8<<30 {
+		t.Errorf("Killed job usage: wall %v, user %v, system %v, rss %v", j.WallTimeMs, j.UserCPUMs, j.SystemCPUMs, j.MaxRSSBytes)
+	}
+
+	// A script error exits with a code
+	j = report("job-exit", control.JobStatusEnum_JOB_STATUS_FAILED, &control.ProcessUsage{Exited: true, ExitCode: 2, WallTimeMs: 10})
+	if j.ExitCode == nil || *j.ExitCode != 2 || j.Signal != "" {
+		t.Errorf("Exited job: exit code %v, signal %q", j.ExitCode, j.Signal)
+	}
+
+	// Invalid usage is ignored, the status is still applied
+	j = report("job-invalid", control.JobStatusEnum_JOB_STATUS_FAILED, &control.ProcessUsage{Exited: true, WallTimeMs: -1})
+	if j.Status != job.StatusFailed || j.ExitCode != nil || j.WallTimeMs != nil {
+		t.Errorf("Invalid usage recorded: status %s, exit code %v, wall %v", j.Status, j.ExitCode, j.WallTimeMs)
+	}
+
+	// Usage is only recorded with final statuses
+	j = report("job-running", control.JobStatusEnum_JOB_STATUS_RUNNING, &control.ProcessUsage{Exited: true})
+	if j.ExitCode != nil {
+		t.Errorf("Usage recorded with RUNNING: exit code %v", *j.ExitCode)
+	}
+}
+
+func TestGateway_HandleJobStatus_ForwardResponse(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 2)
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+
+	report := func(jobID string, response *control.ForwardResponse) *job.Job {
+		t.Helper()
+		mockStore.Create(&job.Job{JobID: jobID, CreatedAt: time.Now(), Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID, JobType: job.JobTypeForwardHTTP})
+		envelope := &control.Envelope{AgentId: agentID, Payload: &control.Envelope_JobStatus{JobStatus: &control.JobStatus{
+			JobId: jobID, AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_FAILED, Message: "Forward HTTP returned status 503", ForwardResponse: response,
+		}}}
+		gw.handleJobStatus(agentConn, envelope, envelope.GetJobStatus())
+		j, _ := mockStore.Get(jobID)
+		return j
+	}
+
+	j := report("job-503", &control.ForwardResponse{StatusCode: 503, Headers: []*control.Header{
+		{Key: "retry-after", Value: "30"},
+		{Key: "X-Long", Value: strings.Repeat("x", job.MaxForwardResponseHeaderSize+10)},
+	}})
+	if j.ForwardResponse == nil || j.ForwardResponse.StatusCode != 503 || j.ForwardResponse.Headers["Retry-After"] != "30" {
+		t.Fatalf("Forward response: %+v", j.ForwardResponse)
+	}
+	if len(j.ForwardResponse.Headers["X-Long"]) != job.MaxForwardResponseHeaderSize {
+		t.Errorf("Long header kept %d bytes", len(j.ForwardResponse.Headers["X-Long"]))
+	}
+
+	// An invalid status code is ignored, the status is still applied
+	j = report("job-invalid", &control.ForwardResponse{StatusCode: 42})
+	if j.Status != job.StatusFailed || j.ForwardResponse != nil {
+		t.Errorf("Invalid response recorded: status %s, response %+v", j.Status, j.ForwardResponse)
+	}
+}
+
+func TestGateway_HandleJobStatus_TimedOut(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 2)
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+
+	report := func(jobID, reason string) *job.Job {
+		t.Helper()
+		mockStore.Create(&job.Job{JobID: jobID, CreatedAt: time.Now(), Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID})
+		envelope := &control.Envelope{AgentId: agentID, Payload: &control.Envelope_JobStatus{JobStatus: &control.JobStatus{
+			JobId: jobID, AttemptId: 1, Status: control.JobStatusEnum_JOB_STATUS_FAILED, Message: "Command timed out after 1m30s", Reason: reason,
+		}}}
+		gw.handleJobStatus(agentConn, envelope, envelope.GetJobStatus())
+		j, _ := mockStore.Get(jobID)
+		return j
+	}
+
+	if j := report("job-timeout", job.ReasonTimedOut); j.Status != job.StatusFailed || j.Reason != job.ReasonTimedOut {
+		t.Errorf("Timed out job: status %s, reason %q", j.Status, j.Reason)
+	}
+	if j := report("job-unknown", "EXPLODED"); j.Status != job.StatusFailed || j.Reason != "" {
+		t.Errorf("Unknown reason stored: status %s, reason %q", j.Status, j.Reason)
+	}
+}
+
+func TestGateway_CheckTimeouts(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockReg.Register(agentID, "test-host", 4)
+	mockReg.UpdateHeartbeat(agentID, false, 2)
+	gw := New(mockReg, mockStore, newMockQueue(), newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+	gw.connections[agentID] = agentConn
+
+	startedAt := func(ago time.Duration) *time.Time {
+		ts := time.Now().Add(-ago)
+		return &ts
+	}
+	// Overran timeout + grace; within timeout + grace (the agent may still report); legacy job on the default timeout
+	mockStore.Create(&job.Job{JobID: "job-overrun", Status: job.StatusRunning, AttemptID: 2, AssignedAgentID: agentID, TimeoutSec: 60, StartedAt: startedAt(2 * time.Minute)})
+	mockStore.Create(&job.Job{JobID: "job-grace", Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID, TimeoutSec: 60, StartedAt: startedAt(80 * time.Second)})
+	mockStore.Create(&job.Job{JobID: "job-default", Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID, StartedAt: startedAt(time.Hour)})
+	// Never started by the agent: ASSIGNED jobs time out from their assignment
+	mockStore.Create(&job.Job{JobID: "job-stuck", Status: job.StatusAssigned, AttemptID: 1, AssignedAgentID: agentID, TimeoutSec: 60, AssignedAt: startedAt(2 * time.Minute)})
+	mockStore.Create(&job.Job{JobID: "job-assigned", Status: job.StatusAssigned, AttemptID: 1, AssignedAgentID: agentID, TimeoutSec: 60, AssignedAt: startedAt(time.Second)})
+	notifier := &recordingNotifier{}
+	gw.SetNotifier(notifier)
+
+	gw.CheckTimeouts(30 * time.Second)
+
+	j, _ := mockStore.Get("job-overrun")
+	if j.Status != job.StatusFailed || j.Reason != job.ReasonTimedOut || !strings.Contains(j.Message, "timeout of 1m0s") {
+		t.Errorf("Overrunning job: status %s, reason %q, message %q", j.Status, j.Reason, j.Message)
+	}
+	if j, _ := mockStore.Get("job-grace"); j.Status != job.StatusRunning || j.Reason != "" {
+		t.Errorf("Job within grace: status %s, reason %q", j.Status, j.Reason)
+	}
+	if j, _ := mockStore.Get("job-default"); j.Status != job.StatusFailed || j.Reason != job.ReasonTimedOut {
+		t.Errorf("Job past the default timeout: status %s, reason %q", j.Status, j.Reason)
+	}
+	j, _ = mockStore.Get("job-stuck")
+	if j.Status != job.StatusFailed || j.Reason != job.ReasonTimedOut || !strings.Contains(j.Message, "never started") {
+		t.Errorf("Stuck ASSIGNED job: status %s, reason %q, message %q", j.Status, j.Reason, j.Message)
+	}
+	if j, _ := mockStore.Get("job-assigned"); j.Status != job.StatusAssigned {
+		t.Errorf("Recently assigned job: status %s", j.Status)
+	}
+	if agent, _ := mockReg.GetAgent(agentID); agent.RunningJobs != 0 {
+		t.Errorf("RunningJobs = %d, want 0", agent.RunningJobs)
+	}
+	if len(notifier.jobIDs) != 3 {
+		t.Errorf("Notified jobs = %v, want the 3 timed out jobs", notifier.jobIDs)
+	}
+
+	// The agent is told to stop the timed out jobs
+	canceled := map[string]int32{}
+	for len(agentConn.SendChan) > 0 {
+		var envelope control.Envelope
+		if err := proto.Unmarshal(<-agentConn.SendChan, &envelope); err != nil {
+			t.Fatalf("Failed to unmarshal message: %v", err)
+		}
+		if c := envelope.GetCancelJob(); c != nil {
+			if c.Reason != job.ReasonTimedOut || c.Message == "" {
+				t.Errorf("CancelJob for %s: reason %q, message %q", c.JobId, c.Reason, c.Message)
+			}
+			canceled[c.JobId] = c.AttemptId
+		}
+	}
+	if len(canceled) != 3 || canceled["job-overrun"] != 2 || canceled["job-default"] != 1 || canceled["job-stuck"] != 1 {
+		t.Errorf("CancelJob sent for %v, want job-overrun (attempt 2), job-default and job-stuck", canceled)
+	}
+
+	// A job that finished after it was listed keeps its outcome and is not published or notified again
+	finished := &job.Job{JobID: "job-finished", Status: job.StatusRunning, AttemptID: 1, AssignedAgentID: agentID, TimeoutSec: 60, StartedAt: startedAt(2 * time.Minute)}
+	mockStore.Create(&job.Job{JobID: "job-finished", Status: job.StatusSucceeded, AttemptID: 1, AssignedAgentID: agentID, Message: "done"})
+	broker := events.NewBroker()
+	gw.SetEvents(broker)
+	sub := broker.Subscribe(nil)
+	defer sub.Close()
+	gw.timeOutJob(finished)
+	if j, _ := mockStore.Get("job-finished"); j.Status != job.StatusSucceeded || j.Reason != "" || j.Message != "done" {
+		t.Errorf("Finished job changed: status %s, reason %q, message %q", j.Status, j.Reason, j.Message)
+	}
+	if len(sub.C) != 0 || len(notifier.jobIDs) != 3 || len(agentConn.SendChan) != 0 {
+		t.Errorf("Finished job published %d events, notified %v, sent %d messages", len(sub.C), notifier.jobIDs, len(agentConn.SendChan))
+	}
+
+	// The late final status from the agent is ignored
+	envelope := &control.Envelope{AgentId: agentID, Payload: &control.Envelope_JobStatus{JobStatus: &control.JobStatus{
+		JobId: "job-overrun", AttemptId: 2, Status: control.JobStatusEnum_JOB_STATUS_SUCCEEDED,
+	}}}
+	gw.handleJobStatus(agentConn, envelope, envelope.GetJobStatus())
+	if j, _ := mockStore.Get("job-overrun"); j.Status != job.StatusFailed {
+		t.Errorf("Late status applied: %s", j.Status)
+	}
+}
+
+func TestGateway_HandleRequestJob_Timeout(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockReg.Register(agentID, "test-host", 1)
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+
+	mockStore.Create(&job.Job{JobID: "job-timeout", CreatedAt: time.Now(), Status: job.StatusPending, AttemptID: 1, Command: "sleep 100", Shell: true, TimeoutSec: 90})
+	mockQueue.Enqueue(context.Background(), "job-timeout")
+
+	envelope := &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Payload: &control.Envelope_RequestJob{RequestJob: &control.RequestJob{}}}
+	gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+
+	var response control.Envelope
+	if err := proto.Unmarshal(<-agentConn.SendChan, &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if assigned := response.GetJobAssigned(); assigned == nil || assigned.TimeoutSec != 90 {
+		t.Errorf("JobAssigned timeout_sec = %v, want 90", assigned)
+	}
+}
+
+func TestGateway_HandleRequestJob_Argv(t *testing.T) {
+	agentID := "agent-123"
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockReg.Register(agentID, "test-host", 1)
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+	agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+
+	mockStore.Create(&job.Job{
+		JobID: "job-argv", CreatedAt: time.Now(), Status: job.StatusPending, AttemptID: 1,
+		Argv: []string{"python", "run.py", "{output}"}, Env: map[string]string{"SEED": "42"}, WorkingDir: "src",
+	})
+	mockQueue.Enqueue(context.Background(), "job-argv")
+
+	envelope := &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Payload: &control.Envelope_RequestJob{RequestJob: &control.RequestJob{}}}
+	gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+
+	var response control.Envelope
+	if err := proto.Unmarshal(<-agentConn.SendChan, &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	assigned := response.GetJobAssigned()
+	if assigned == nil {
+		t.Fatalf("Expected JobAssigned, got %v", &response)
+	}
+	if len(assigned.Argv) != 3 || assigned.Argv[2] != "{output}" || assigned.Command != "" || assigned.Env["SEED"] != "42" || assigned.WorkingDir != "src" {
+		t.Errorf("JobAssigned: argv %q, command %q, env %v, working_dir %q", assigned.Argv, assigned.Command, assigned.Env, assigned.WorkingDir)
+	}
+}
+
+func TestGateway_HandleRequestJob_Template(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockReg.Register("agent-plain", "test-host", 1)
+	mockReg.Register("agent-resize", "test-host", 1)
+	mockReg.SetTemplates("agent-resize", []string{"ocr", "resize"})
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+
+	mockStore.Create(&job.Job{
+		JobID: "job-template", CreatedAt: time.Now(), Status: job.StatusPending, AttemptID: 1,
+		Template: "resize", Params: map[string]string{"size": "640x480"},
+	})
+	mockQueue.Enqueue(context.Background(), "job-template")
+
+	requestJob := func(agentID string) *control.JobAssigned {
+		agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+		envelope := &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Payload: &control.Envelope_RequestJob{RequestJob: &control.RequestJob{}}}
+		gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+		select {
+		case data := <-agentConn.SendChan:
+			var response control.Envelope
+			if err := proto.Unmarshal(data, &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			return response.GetJobAssigned()
+		default:
+			return nil
+		}
+	}
+
+	// An agent without the template is skipped and the job stays queued
+	if assigned := requestJob("agent-plain"); assigned != nil {
+		t.Fatalf("Job assigned to an agent without its template: %v", assigned)
+	}
+	if j, _ := mockStore.Get("job-template"); j.Status != job.StatusPending {
+		t.Fatalf("Job status %s, want PENDING", j.Status)
+	}
+
+	assigned := requestJob("agent-resize")
+	if assigned == nil {
+		t.Fatal("Job not assigned to the agent with its template")
+	}
+	if assigned.Template != "resize" || assigned.Params["size"] != "640x480" || assigned.Command != "" {
+		t.Errorf("JobAssigned: template %q, params %v, command %q", assigned.Template, assigned.Params, assigned.Command)
+	}
+}
+
+func TestGateway_HandleRequestJob_ForwardTargets(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockReg.Register("agent-legacy", "test-host", 1)
+	mockReg.Register("agent-loopback", "test-host", 1)
+	mockReg.SetForwardTargets("agent-loopback", control.DefaultForwardTargets())
+	mockReg.Register("agent-comfy", "test-host", 1)
+	mockReg.SetForwardTargets("agent-comfy", []*control.ForwardTarget{{Scheme: "http", Host: "comfy.lab", Port: 8188, PathPrefix: "/prompt"}})
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+
+	requestJob := func(agentID string) *control.JobAssigned {
+		agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+		envelope := &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Payload: &control.Envelope_RequestJob{RequestJob: &control.RequestJob{}}}
+		gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+		select {
+		case data := <-agentConn.SendChan:
+			var response control.Envelope
+			if err := proto.Unmarshal(data, &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			return response.GetJobAssigned()
+		default:
+			return nil
+		}
+	}
+	enqueue := func(jobID, forwardURL string) {
+		mockStore.Create(&job.Job{
+			JobID: jobID, CreatedAt: time.Now(), Status: job.StatusPending, AttemptID: 1,
+			JobType: job.JobTypeForwardHTTP, ForwardURL: forwardURL,
+		})
+		mockQueue.Enqueue(context.Background(), jobID)
+	}
+
+	enqueue("job-comfy", "http://comfy.lab:8188/prompt/run")
+	for _, agentID := range []string{"agent-legacy", "agent-loopback"} {
+		if assigned := requestJob(agentID); assigned != nil {
+			t.Fatalf("Forward job assigned to %s, which does not permit its target", agentID)
+		}
+	}
+	if assigned := requestJob("agent-comfy"); assigned == nil || assigned.JobId != "job-comfy" {
+		t.Fatalf("Forward job not assigned to the agent hosting the service: %v", assigned)
+	}
+
+	enqueue("job-local", "http://127.0.0.1:8080/api")
+	if assigned := requestJob("agent-loopback"); assigned == nil || assigned.JobId != "job-local" {
+		t.Fatalf("Loopback forward job not assigned: %v", assigned)
+	}
+}
+
+func TestGateway_HandleRequestJob_ForwardGRPC(t *testing.T) {
+	mockReg := newMockRegistry()
+	mockStore := newMockJobStore()
+	mockQueue := newMockQueue()
+	mockReg.Register("agent-http", "test-host", 1)
+	mockReg.SetForwardTargets("agent-http", []*control.ForwardTarget{{Host: control.LoopbackHost, Port: 8080}})
+	mockReg.Register("agent-grpc", "test-host", 1)
+	mockReg.SetForwardTargets("agent-grpc", []*control.ForwardTarget{{Host: control.LoopbackHost, Port: 50051, PathPrefix: "/model.v1.Predictor"}})
+	gw := New(mockReg, mockStore, mockQueue, newMockOSSProvider(), true)
+
+	requestJob := func(agentID string) *control.JobAssigned {
+		agentConn := &AgentConnection{AgentID: agentID, SendChan: make(chan []byte, 256), CloseChan: make(chan struct{})}
+		envelope := &control.Envelope{AgentId: agentID, RequestId: uuid.New().String(), Payload: &control.Envelope_RequestJob{RequestJob: &control.RequestJob{}}}
+		gw.handleRequestJob(agentConn, envelope, envelope.GetRequestJob())
+		select {
+		case data := <-agentConn.SendChan:
+			var response control.Envelope
+			if err := proto.Unmarshal(data, &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			return response.GetJobAssigned()
+		default:
+			return nil
+		}
+	}
+
+	mockStore.Create(&job.Job{
+		JobID: "job-grpc", CreatedAt: time.Now(), Status: job.StatusPending, AttemptID: 1,
+		JobType: job.JobTypeForwardGRPC, ForwardTimeout: 30,
+		ForwardGRPC: &job.ForwardGRPC{
+			Target:   "127.0.0.1:50051",
+			Method:   "/model.v1.Predictor/Predict",
+			Request:  []byte(`{"prompt":"cat"}`),
+			Metadata: map[string]string{"x-tenant": "lab", "x-priority": "high"},
+		},
+	})
+	mockQueue.Enqueue(context.Background(), "job-grpc")
+
+	// Routed by http://127.0.0.1:50051/model.v1.Predictor/Predict
+	if assigned := requestJob("agent-http"); assigned != nil {
+		t.Fatalf("gRPC job assigned to an agent that does not permit its target")
+	}
+	assigned := requestJob("agent-grpc")
+	if assigned == nil || assigned.JobId != "job-grpc" {
+		t.Fatalf("gRPC job not assigned: %v", assigned)
+	}
+	call := assigned.ForwardGrpc
+	if assigned.JobType != control.JobTypeEnum_JOB_TYPE_FORWARD_GRPC || call.GetTarget() != "127.0.0.1:50051" || call.GetMethod() != "model.v1.Predictor/Predict" ||
+		call.GetRequestJson() != `{"prompt":"cat"}` || call.GetTimeoutSec() != 30 {
+		t.Errorf("JobAssigned: type %s, forward_grpc %+v", assigned.JobType, call)
+	}
+	if len(call.GetMetadata()) != 2 || call.Metadata[0].Key != "x-priority" || call.Metadata[1].Value != "lab" {
+		t.Errorf("Metadata: %v", call.GetMetadata())
+	}
+}
@@ -6,12 +6,24 @@ var (
 	ErrInvalidJobID            = errors.New("invalid job_id")
 	ErrInvalidStatus           = errors.New("invalid status")
 	ErrInvalidInput            = errors.New("invalid input (bucket and key required)")
+	ErrInvalidInputs           = errors.New("invalid inputs (names must match [A-Za-z0-9_-]{1,64}; bucket and key required)")
+	ErrInvalidChecksum         = errors.New("invalid checksum (sha256 must be 64 hex characters and requires an input)")
 	ErrInvalidOutput           = errors.New("invalid output (bucket required, key or prefix required)")
 	ErrInvalidAttemptID        = errors.New("invalid attempt_id (must be >= 1)")
+	ErrInvalidTimeout          = errors.New("invalid timeout_sec (must be >= 0)")
+	ErrInvalidArgv             = errors.New("invalid argv (must not be combined with command; argv[0] required; at most 1024 arguments)")
+	ErrInvalidShell            = errors.New("invalid shell (command requires shell: true, shell requires a command)")
+	ErrInvalidEnv              = errors.New("invalid env (at most 64 variables; names must match [A-Za-z_][A-Za-z0-9_]*)")
+	ErrInvalidWorkingDir       = errors.New("invalid working_dir (at most 1024 characters, not leading out of the job work directory)")
+	ErrInvalidTemplate         = errors.New("invalid template (names must match [A-Za-z0-9_.-]{1,64}; not combined with command, argv, env or working_dir)")
+	ErrInvalidParams           = errors.New("invalid params (require a template; at most 64; names must match [A-Za-z0-9_-]{1,64})")
 	ErrInvalidJobType          = errors.New("invalid job type")
 	ErrInvalidForwardURL       = errors.New("invalid forward_url")
 	ErrInvalidInputForwardMode = errors.New("invalid input_forward_mode")
+	ErrInvalidForwardAsync     = errors.New("invalid forward_async (forward jobs only; http(s) status_url and result_url; poll_interval_sec 0-3600; at most 16 states each; not both result_url and result_url_field)")
+	ErrInvalidForwardGRPC      = errors.New("invalid forward_grpc (FORWARD_GRPC jobs only and required there; target host:port; method package.Service/Method; request a JSON object, not with request_proto)")
 	ErrInvalidTransition       = errors.New("invalid status transition")
 	ErrJobNotFound             = errors.New("job not found")
 	ErrJobAlreadyExists        = errors.New("job already exists")
+	ErrDuplicateIdempotencyKey = errors.New("idempotency key already used")
 )
@@ -0,0 +1,16 @@
+-- Migration script to add argv commands, per-job environment variables and working directories
+-- Stores the argument vector of commands run without a shell, their environment and working directory
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_argv.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN argv TEXT NULL 
+COMMENT 'Argument vector of a command run without a shell (JSON array; NULL for shell commands)',
+ADD COLUMN env TEXT NULL 
+COMMENT 'Per-job environment variables of the command (JSON object of name -> value)',
+ADD COLUMN working_dir VARCHAR(1024) NULL 
+COMMENT 'Working directory of the command (relative paths are under the job work directory)';
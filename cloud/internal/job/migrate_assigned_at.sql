@@ -0,0 +1,12 @@
+-- Migration script to record when a job attempt was assigned to an agent
+-- ASSIGNED jobs that their agent never starts are timed out from this time
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_assigned_at.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN assigned_at DATETIME NULL 
+COMMENT 'When the current attempt was assigned to an agent';
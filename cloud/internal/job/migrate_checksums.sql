@@ -0,0 +1,16 @@
+-- Migration script to add end-to-end integrity checks
+-- Stores the expected SHA-256 of the input and the primary output as confirmed in OSS at SUCCEEDED
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_checksums.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN input_sha256 VARCHAR(64) NULL 
+COMMENT 'Optional expected SHA-256 of the input (verified by the agent)';
+
+ALTER TABLE jobs 
+ADD COLUMN output_file TEXT NULL 
+COMMENT 'Primary output as confirmed in OSS (JSON object of key, size, sha256, content_type, etag)';
@@ -0,0 +1,12 @@
+-- Migration script to add the asynchronous forward mode
+-- Stores how the agent polls a forward job's local task and fetches its result
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_forward_async.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN forward_async TEXT NULL 
+COMMENT 'Asynchronous forward mode (JSON object; NULL for synchronous forward jobs)';
@@ -0,0 +1,12 @@
+-- Migration script to add gRPC forward jobs
+-- Stores the target, method, request and metadata of FORWARD_GRPC jobs
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_forward_grpc.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN forward_grpc TEXT NULL 
+COMMENT 'gRPC call of a FORWARD_GRPC job (JSON object: target, method, request, metadata)';
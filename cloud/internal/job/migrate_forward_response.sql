@@ -0,0 +1,12 @@
+-- Migration script to record forward responses
+-- Stores the status code and headers of the local service's response to a forward job
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_forward_response.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN forward_response TEXT NULL 
+COMMENT 'Status code and headers of the local service response (JSON object; forward jobs)';
@@ -0,0 +1,23 @@
+-- Migration script to add idempotency key support for job submission
+-- Retried POST /api/jobs requests carrying the same Idempotency-Key return the original job
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_idempotency_key.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies these changes automatically on startup (MySQLStore.initSchema)
+
+ALTER TABLE jobs 
+ADD COLUMN idempotency_key VARCHAR(255) NULL 
+COMMENT 'Optional client-supplied key for deduplicating retried submissions';
+
+ALTER TABLE jobs 
+ADD COLUMN request_hash VARCHAR(64) NULL 
+COMMENT 'SHA-256 of the normalized create request';
+
+ALTER TABLE jobs 
+ADD COLUMN submitter VARCHAR(255) NOT NULL DEFAULT '' 
+COMMENT 'Submitter identifier (scopes idempotency keys)';
+
+-- Unique index enforces at most one job per submitter and idempotency key (NULL keys do not collide)
+CREATE UNIQUE INDEX idx_jobs_submitter_idempotency_key ON jobs(submitter, idempotency_key);
@@ -0,0 +1,12 @@
+-- Migration script to add named inputs
+-- Stores the job's named inputs referenced as {input:name} (JSON object of name -> bucket, key)
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_inputs.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN inputs TEXT NULL 
+COMMENT 'Named inputs (JSON object of name -> bucket, key)';
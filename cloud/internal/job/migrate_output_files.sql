@@ -0,0 +1,12 @@
+-- Migration script to add output manifests
+-- Stores the files a job uploaded from its output directory (JSON array of key, size, sha256, content_type)
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_output_files.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN output_files TEXT NULL 
+COMMENT 'Output manifest (JSON array of key, size, sha256, content_type)';
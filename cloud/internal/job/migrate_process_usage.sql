@@ -0,0 +1,22 @@
+-- Migration script to add process exit status and resource usage
+-- Stores the exit code, terminating signal, wall/CPU time and peak RSS reported for command jobs
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_process_usage.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN exit_code INT NULL 
+COMMENT 'Exit code of the command process (NULL if not reported or killed by a signal)',
+ADD COLUMN term_signal VARCHAR(32) NULL 
+COMMENT 'Signal that terminated the command process (e.g. SIGKILL)',
+ADD COLUMN wall_time_ms BIGINT NULL 
+COMMENT 'Wall time of the command process in milliseconds',
+ADD COLUMN user_cpu_ms BIGINT NULL 
+COMMENT 'User CPU time of the command process in milliseconds',
+ADD COLUMN system_cpu_ms BIGINT NULL 
+COMMENT 'System CPU time of the command process in milliseconds',
+ADD COLUMN max_rss_bytes BIGINT NULL 
+COMMENT 'Peak resident set size of the command process in bytes';
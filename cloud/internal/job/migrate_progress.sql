@@ -0,0 +1,12 @@
+-- Migration script to add structured job progress
+-- Stores the latest JobProgress reported by the agent while the job runs
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_progress.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN progress TEXT NULL 
+COMMENT 'Latest progress reported by the agent (JSON object of percent, current_step, total_steps, message, metrics)';
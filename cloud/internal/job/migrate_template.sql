@@ -0,0 +1,14 @@
+-- Migration script to add job templates
+-- Stores the agent-side template a job runs and its parameters
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_template.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN template VARCHAR(64) NULL 
+COMMENT 'Job template declared in the agent config (NULL for command and argv jobs)',
+ADD COLUMN params TEXT NULL 
+COMMENT 'Template parameters (JSON object of name -> value)';
@@ -0,0 +1,14 @@
+-- Migration script to add per-job timeouts
+-- Stores the maximum run time of a job and why it ended (e.g. TIMED_OUT)
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_timeout.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies this change automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN timeout_sec INT NULL 
+COMMENT 'Maximum run time of the job in seconds (NULL/0: server default)',
+ADD COLUMN reason VARCHAR(32) NULL 
+COMMENT 'Why the job ended, if not a plain failure (e.g. TIMED_OUT)';
@@ -0,0 +1,19 @@
+-- Migration script to add input upload reservations (POST /api/uploads)
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_uploads.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also creates this table automatically on startup
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id VARCHAR(255) PRIMARY KEY COMMENT 'Upload UUID',
+    bucket VARCHAR(255) NOT NULL COMMENT 'OSS bucket',
+    object_key VARCHAR(1024) NOT NULL COMMENT 'Reserved key: inputs/{upload_id}/{filename}',
+    filename VARCHAR(255) NOT NULL COMMENT 'File name (last key segment)',
+    content_type VARCHAR(255) NOT NULL COMMENT 'Content-Type signed into the PUT URL',
+    size BIGINT NOT NULL COMMENT 'Declared size in bytes (signed into the PUT URL)',
+    submitter VARCHAR(255) COMMENT 'API key name that reserved the upload',
+    created_at DATETIME NOT NULL COMMENT 'Reservation timestamp',
+    expires_at DATETIME NOT NULL COMMENT 'When the presigned PUT URL expires'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Input upload reservations';
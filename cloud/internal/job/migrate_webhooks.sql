@@ -0,0 +1,50 @@
+-- Migration script to add job completion webhooks
+-- Adds callback/webhook references and timing columns to jobs, plus the webhook tables
+-- 
+-- Usage:
+--   mysql -u root -p <database_name> < migrate_webhooks.sql
+--   Or copy and paste into MySQL client
+--
+-- Note: The server also applies these changes automatically on startup
+
+ALTER TABLE jobs 
+ADD COLUMN submitter VARCHAR(255) NULL 
+COMMENT 'Optional submitter identifier (for event filtering)';
+
+ALTER TABLE jobs 
+ADD COLUMN callback_url VARCHAR(2048) NULL 
+COMMENT 'URL notified when the job reaches a terminal state';
+
+ALTER TABLE jobs 
+ADD COLUMN webhook_id VARCHAR(255) NULL 
+COMMENT 'Registered webhook subscription notified on completion';
+
+ALTER TABLE jobs 
+ADD COLUMN started_at DATETIME NULL 
+COMMENT 'When the job first entered RUNNING';
+
+ALTER TABLE jobs 
+ADD COLUMN finished_at DATETIME NULL 
+COMMENT 'When the job reached a terminal state';
+
+-- Registered webhook subscriptions
+CREATE TABLE IF NOT EXISTS webhooks (
+    id VARCHAR(255) PRIMARY KEY COMMENT 'Webhook UUID',
+    url VARCHAR(2048) NOT NULL COMMENT 'Delivery URL',
+    secret VARCHAR(255) NOT NULL COMMENT 'HMAC-SHA256 signing secret',
+    description VARCHAR(1024) COMMENT 'Optional description',
+    created_at DATETIME NOT NULL COMMENT 'Registration timestamp'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Webhook subscriptions';
+
+-- Deliveries that failed after all retries
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    job_id VARCHAR(255) NOT NULL COMMENT 'Job UUID',
+    webhook_id VARCHAR(255) COMMENT 'Webhook UUID (empty for callback_url deliveries)',
+    url VARCHAR(2048) NOT NULL COMMENT 'Delivery URL',
+    payload TEXT NOT NULL COMMENT 'JSON payload that failed to deliver',
+    attempts INT NOT NULL COMMENT 'Number of delivery attempts',
+    last_error TEXT COMMENT 'Error from the last attempt',
+    created_at DATETIME NOT NULL COMMENT 'When the delivery was dead-lettered',
+    INDEX idx_webhook_dead_letters_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Failed webhook deliveries';
@@ -1,7 +1,16 @@
 package job
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,6 +33,7 @@ type JobType string
 const (
 	JobTypeCommand     JobType = "COMMAND"
 	JobTypeForwardHTTP JobType = "FORWARD_HTTP"
+	JobTypeForwardGRPC JobType = "FORWARD_GRPC"
 )
 
 // InputForwardMode controls how input is forwarded to local service
@@ -34,6 +44,115 @@ const (
 	InputForwardModeLocalFile InputForwardMode = "LOCAL_FILE"
 )
 
+// ForwardAsync makes a forward job asynchronous: the forward request submits a task to the local service,
+// which the agent then polls at StatusURL (or waits for on a loopback callback) until it finishes.
+// Empty fields take the defaults noted below, applied by the agent.
+type ForwardAsync struct {
+	TaskIDField     string   `json:"task_id_field,omitempty"`     // JSON field of the submit response holding the task ID (default "task_id"; dots select nested fields)
+	StatusURL       string   `json:"status_url,omitempty"`        // Status URL template with {task_id}; empty: wait for the callback (X-Callback-URL)
+	PollIntervalSec int      `json:"poll_interval_sec,omitempty"` // Seconds between status requests (default 5)
+	StateField      string   `json:"state_field,omitempty"`       // JSON field of a status holding the task state (default "status")
+	SucceededStates []string `json:"succeeded_states,omitempty"`  // States meaning success (default succeeded, success, completed, done)
+	FailedStates    []string `json:"failed_states,omitempty"`     // States meaning failure (default failed, error, canceled, cancelled); any other state is running
+	ResultURL       string   `json:"result_url,omitempty"`        // Result URL template with {task_id}, fetched and uploaded on success
+	ResultURLField  string   `json:"result_url_field,omitempty"`  // JSON field of the final status holding the result URL (alternative to ResultURL)
+	MessageField    string   `json:"message_field,omitempty"`     // JSON field of a failed status holding the error message (default "error")
+}
+
+const (
+	// MaxPollIntervalSec bounds ForwardAsync.PollIntervalSec
+	MaxPollIntervalSec = 3600
+	// MaxAsyncStates bounds ForwardAsync.SucceededStates and FailedStates
+	MaxAsyncStates = 16
+	// MaxAsyncFieldLength bounds the JSON field names of ForwardAsync
+	MaxAsyncFieldLength = 128
+)
+
+// Check reports why the async config is unusable, if it is: URL templates must be http(s) URLs
+// and the fields stay within their bounds
+func (a *ForwardAsync) Check() error {
+	for name, tmpl := range map[string]string{"status_url": a.StatusURL, "result_url": a.ResultURL} {
+		if tmpl == "" {
+			continue
+		}
+		u, err := url.Parse(strings.ReplaceAll(tmpl, "{task_id}", "id"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", name)
+		}
+	}
+	if a.ResultURL != "" && a.ResultURLField != "" {
+		return errors.New("result_url and result_url_field are mutually exclusive")
+	}
+	if a.PollIntervalSec < 0 || a.PollIntervalSec > MaxPollIntervalSec {
+		return fmt.Errorf("poll_interval_sec must be 0-%d", MaxPollIntervalSec)
+	}
+	if len(a.SucceededStates) > MaxAsyncStates || len(a.FailedStates) > MaxAsyncStates {
+		return fmt.Errorf("succeeded_states and failed_states take at most %d states each", MaxAsyncStates)
+	}
+	for _, field := range []string{a.TaskIDField, a.StateField, a.ResultURLField, a.MessageField} {
+		if len(field) > MaxAsyncFieldLength {
+			return fmt.Errorf("field names must be at most %d characters", MaxAsyncFieldLength)
+		}
+	}
+	return nil
+}
+
+// ForwardGRPC is the unary gRPC call of a FORWARD_GRPC job. The agent resolves the method from its
+// registered descriptor sets or through the service's server reflection; the timeout is Job.ForwardTimeout.
+type ForwardGRPC struct {
+	Target       string            `json:"target"`                  // host:port of the local service (e.g. 127.0.0.1:50051)
+	Method       string            `json:"method"`                  // Fully qualified method: package.Service/Method
+	Request      json.RawMessage   `json:"request,omitempty"`       // Request message in protobuf JSON (a JSON object)
+	RequestProto []byte            `json:"request_proto,omitempty"` // Request message in binary protobuf (base64 in JSON; alternative to Request)
+	Metadata     map[string]string `json:"metadata,omitempty"`      // Request metadata
+}
+
+const (
+	// MaxGRPCMetadata bounds ForwardGRPC.Metadata
+	MaxGRPCMetadata = 64
+)
+
+var (
+	grpcMethodPattern       = regexp.MustCompile(`^/?[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*/[A-Za-z_][A-Za-z0-9_]*$`)
+	grpcMetadataNamePattern = regexp.MustCompile(`^[a-z0-9_.-]{1,128}$`)
+)
+
+// Check reports why the gRPC call is unusable, if it is: target is host:port, method is fully qualified,
+// at most one request encoding is given and metadata names are lowercase and not reserved (grpc-*)
+func (g *ForwardGRPC) Check() error {
+	host, port, err := net.SplitHostPort(g.Target)
+	if err != nil || host == "" {
+		return errors.New("target must be host:port")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return errors.New("target port must be 1-65535")
+	}
+	if !grpcMethodPattern.MatchString(g.Method) {
+		return errors.New("method must be a fully qualified method (package.Service/Method)")
+	}
+	if len(g.Request) > 0 {
+		if len(g.RequestProto) > 0 {
+			return errors.New("request and request_proto are mutually exclusive")
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(g.Request, &object); err != nil || object == nil {
+			return errors.New("request must be a JSON object")
+		}
+	}
+	if len(g.Metadata) > MaxGRPCMetadata {
+		return fmt.Errorf("metadata takes at most %d entries", MaxGRPCMetadata)
+	}
+	for name, value := range g.Metadata {
+		if !grpcMetadataNamePattern.MatchString(name) || strings.HasPrefix(name, "grpc-") || strings.HasSuffix(name, "-bin") {
+			return fmt.Errorf("invalid metadata name %q (lowercase [a-z0-9_.-], not grpc-* or *-bin)", name)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("metadata %s must not contain line breaks or NUL characters", name)
+		}
+	}
+	return nil
+}
+
 // IsValid checks if the status is valid
 func (s Status) IsValid() bool {
 	switch s {
@@ -68,30 +187,234 @@ func (s Status) IsTerminal() bool {
 
 // Job represents a compute job
 type Job struct {
-	JobID           string           `json:"job_id" db:"job_id"`
-	CreatedAt       time.Time        `json:"created_at" db:"created_at"`
-	Status          Status           `json:"status" db:"status"`
-	InputBucket     string           `json:"input_bucket" db:"input_bucket"`
-	InputKey        string           `json:"input_key" db:"input_key"`
-	OutputBucket    string           `json:"output_bucket" db:"output_bucket"`
-	OutputKey       string           `json:"output_key" db:"output_key"`             // Can be empty if using prefix
-	OutputPrefix    string           `json:"output_prefix" db:"output_prefix"`       // Prefix for output (e.g., "jobs/{job_id}/{attempt_id}/")
-	OutputExtension string           `json:"output_extension" db:"output_extension"` // Output file extension (e.g., "json", "txt", "bin")
-	AttemptID       int              `json:"attempt_id" db:"attempt_id"`
-	AssignedAgentID string           `json:"assigned_agent_id" db:"assigned_agent_id"`   // Optional, empty if not assigned
-	LeaseID         string           `json:"lease_id" db:"lease_id"`                     // Optional, for future lease mechanism
-	LeaseDeadline   *time.Time       `json:"lease_deadline" db:"lease_deadline"`         // Optional, for future lease mechanism
-	Command         string           `json:"command" db:"command"`                       // Command to execute on agent
-	Stdout          string           `json:"stdout" db:"stdout"`                         // Command stdout output (truncated if too long)
-	Stderr          string           `json:"stderr" db:"stderr"`                         // Command stderr output (truncated if too long)
-	JobType         JobType          `json:"job_type" db:"job_type"`                     // Job execution type
-	ForwardURL      string           `json:"forward_url" db:"forward_url"`               // Local service URL for forward job
-	ForwardMethod   string           `json:"forward_method" db:"forward_method"`         // HTTP method for forward job
-	ForwardHeaders  string           `json:"forward_headers" db:"forward_headers"`       // JSON object of headers
-	ForwardBody     string           `json:"forward_body" db:"forward_body"`             // Raw body for forward job
-	ForwardTimeout  int              `json:"forward_timeout" db:"forward_timeout"`       // Timeout in seconds
-	InputForward    InputForwardMode `json:"input_forward_mode" db:"input_forward_mode"` // Input forwarding mode
-	Message         string           `json:"message" db:"message"`                       // Status message or error details
+	JobID           string            `json:"job_id" db:"job_id"`
+	CreatedAt       time.Time         `json:"created_at" db:"created_at"`
+	Status          Status            `json:"status" db:"status"`
+	InputBucket     string            `json:"input_bucket" db:"input_bucket"`
+	InputKey        string            `json:"input_key" db:"input_key"`
+	OutputBucket    string            `json:"output_bucket" db:"output_bucket"`
+	OutputKey       string            `json:"output_key" db:"output_key"`             // Can be empty if using prefix
+	OutputPrefix    string            `json:"output_prefix" db:"output_prefix"`       // Prefix for output (e.g., "jobs/{job_id}/{attempt_id}/")
+	OutputExtension string            `json:"output_extension" db:"output_extension"` // Output file extension (e.g., "json", "txt", "bin")
+	AttemptID       int               `json:"attempt_id" db:"attempt_id"`
+	AssignedAgentID string            `json:"assigned_agent_id" db:"assigned_agent_id"`   // Optional, empty if not assigned
+	LeaseID         string            `json:"lease_id" db:"lease_id"`                     // Optional, for future lease mechanism
+	LeaseDeadline   *time.Time        `json:"lease_deadline" db:"lease_deadline"`         // Optional, for future lease mechanism
+	Command         string            `json:"command" db:"command"`                       // Command to execute on agent through the shell
+	Shell           bool              `json:"shell" db:"shell"`                           // Confirms that Command runs through a shell (required with Command)
+	Stdout          string            `json:"stdout" db:"stdout"`                         // Command stdout output (truncated if too long)
+	Stderr          string            `json:"stderr" db:"stderr"`                         // Command stderr output (truncated if too long)
+	JobType         JobType           `json:"job_type" db:"job_type"`                     // Job execution type
+	ForwardURL      string            `json:"forward_url" db:"forward_url"`               // Local service URL for forward job
+	ForwardMethod   string            `json:"forward_method" db:"forward_method"`         // HTTP method for forward job
+	ForwardHeaders  string            `json:"forward_headers" db:"forward_headers"`       // JSON object of headers
+	ForwardBody     string            `json:"forward_body" db:"forward_body"`             // Raw body for forward job
+	ForwardTimeout  int               `json:"forward_timeout" db:"forward_timeout"`       // Timeout in seconds
+	InputForward    InputForwardMode  `json:"input_forward_mode" db:"input_forward_mode"` // Input forwarding mode
+	Message         string            `json:"message" db:"message"`                       // Status message or error details
+	IdempotencyKey  string            `json:"idempotency_key" db:"idempotency_key"`       // Optional client-supplied key for deduplicating retried submissions
+	RequestHash     string            `json:"-" db:"request_hash"`                        // SHA-256 of the normalized create request (for idempotency conflict detection)
+	Submitter       string            `json:"submitter" db:"submitter"`                   // Optional: who submitted the job (used for event filtering)
+	CallbackURL     string            `json:"callback_url" db:"callback_url"`             // Optional: URL notified when the job reaches a terminal state
+	WebhookID       string            `json:"webhook_id" db:"webhook_id"`                 // Optional: registered webhook subscription notified on completion
+	AssignedAt      *time.Time        `json:"assigned_at" db:"assigned_at"`               // When the current attempt was assigned to an agent
+	StartedAt       *time.Time        `json:"started_at" db:"started_at"`                 // When the job first entered RUNNING
+	FinishedAt      *time.Time        `json:"finished_at" db:"finished_at"`               // When the job reached a terminal state
+	OutputFiles     []OutputFile      `json:"output_files" db:"output_files"`             // Output manifest: every file uploaded under OutputPrefix
+	Inputs          map[string]Input  `json:"inputs" db:"inputs"`                         // Optional named inputs, referenced as {input:name} in Command
+	InputSHA256     string            `json:"input_sha256" db:"input_sha256"`             // Optional expected hex SHA-256 of the input, verified by the agent
+	Output          *OutputFile       `json:"output" db:"output_file"`                    // Primary output (output_key) as confirmed in OSS at SUCCEEDED
+	Progress        *Progress         `json:"progress" db:"progress"`                     // Latest progress reported while the job ran
+	ExitCode        *int              `json:"exit_code" db:"exit_code"`                   // Exit code of a command job's process (nil if not reported or killed by a signal)
+	Signal          string            `json:"signal" db:"term_signal"`                    // Signal that terminated the process (e.g. "SIGKILL")
+	WallTimeMs      *int64            `json:"wall_time_ms" db:"wall_time_ms"`             // Process wall time
+	UserCPUMs       *int64            `json:"user_cpu_ms" db:"user_cpu_ms"`               // Process user CPU time
+	SystemCPUMs     *int64            `json:"system_cpu_ms" db:"system_cpu_ms"`           // Process system CPU time
+	MaxRSSBytes     *int64            `json:"max_rss_bytes" db:"max_rss_bytes"`           // Peak resident set size of the process (0 if not reported by the platform)
+	TimeoutSec      int               `json:"timeout_sec" db:"timeout_sec"`               // Maximum run time in seconds (0: DefaultTimeoutSec)
+	Reason          string            `json:"reason" db:"reason"`                         // Why the job ended, if not a plain failure (e.g. ReasonTimedOut)
+	Argv            []string          `json:"argv" db:"argv"`                             // Command run without a shell (alternative to Command); placeholders expand per argument
+	Env             map[string]string `json:"env" db:"env"`                               // Environment variables added to the command's environment
+	WorkingDir      string            `json:"working_dir" db:"working_dir"`               // Working directory of the command (relative: under the job work directory)
+	Template        string            `json:"template" db:"template"`                     // Job template declared in the agent's config (alternative to Command/Argv)
+	Params          map[string]string `json:"params" db:"params"`                         // Parameters of the template ({param:name})
+	ForwardAsync    *ForwardAsync     `json:"forward_async" db:"forward_async"`           // Asynchronous forward mode (nil: the forward response is the result)
+	ForwardGRPC     *ForwardGRPC      `json:"forward_grpc" db:"forward_grpc"`             // gRPC call of a FORWARD_GRPC job
+	ForwardResponse *ForwardResponse  `json:"forward_response" db:"forward_response"`     // Status code and headers of the local service's response (forward jobs)
+}
+
+// ReasonTimedOut is the reason of a job that was stopped for exceeding its timeout
+// (status FAILED: the status set stays unchanged so existing clients and databases keep working)
+const ReasonTimedOut = "TIMED_OUT"
+
+// ReasonPolicyDenied is the reason of a job the agent refused to run under its local policy
+// (e.g. a command that is not allowlisted, or unknown template parameters)
+const ReasonPolicyDenied = "POLICY_DENIED"
+
+// DefaultTimeoutSec is the run time limit of jobs created without timeout_sec
+const DefaultTimeoutSec = 1800
+
+// Timeout returns the maximum run time of the job
+func (j *Job) Timeout() time.Duration {
+	if j.TimeoutSec <= 0 {
+		return DefaultTimeoutSec * time.Second
+	}
+	return time.Duration(j.TimeoutSec) * time.Second
+}
+
+// Input is a named input of a job (CreateJobRequest.inputs)
+type Input struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256,omitempty"` // Optional expected hex SHA-256 of the content, verified by the agent
+}
+
+// MaxInputs bounds the named inputs of a job
+const MaxInputs = 32
+
+const (
+	// MaxArgs bounds the arguments of an argv command
+	MaxArgs = 1024
+	// MaxEnvVars bounds the environment variables of a job
+	MaxEnvVars = 64
+	// MaxWorkingDirLength bounds the working directory of a job
+	MaxWorkingDirLength = 1024
+	// MaxParams bounds the template parameters of a job
+	MaxParams = 64
+)
+
+var (
+	inputNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	inputRefPattern     = regexp.MustCompile(`\{input:([^{}]*)\}`)
+	sha256Pattern       = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	envNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+	templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// ValidInputName reports whether name can be used as a named input ({input:name})
+func ValidInputName(name string) bool {
+	return inputNamePattern.MatchString(name)
+}
+
+// ValidSHA256 reports whether s is a hex-encoded SHA-256 digest
+func ValidSHA256(s string) bool {
+	return sha256Pattern.MatchString(s)
+}
+
+// ValidEnvName reports whether name can be used as an environment variable name of a job
+func ValidEnvName(name string) bool {
+	return envNamePattern.MatchString(name)
+}
+
+// WorkingDirEscapes reports whether a relative working directory leads out of the job's work directory
+// ("..", "out/../.."), in either path style. Absolute working directories are left to the agent's policy.
+func WorkingDirEscapes(dir string) bool {
+	clean := path.Clean(strings.ReplaceAll(dir, `\`, "/"))
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+// ValidTemplateName reports whether name can be used as a job template name
+func ValidTemplateName(name string) bool {
+	return templateNamePattern.MatchString(name)
+}
+
+// CommandText returns every part of the job's command that placeholders are expanded in:
+// the shell command or the arguments of argv, the environment values and the working directory
+func (j *Job) CommandText() []string {
+	texts := make([]string, 0, 2+len(j.Argv)+len(j.Env))
+	if j.Command != "" {
+		texts = append(texts, j.Command)
+	}
+	texts = append(texts, j.Argv...)
+	for _, name := range sortedKeys(j.Env) {
+		texts = append(texts, j.Env[name])
+	}
+	if j.WorkingDir != "" {
+		texts = append(texts, j.WorkingDir)
+	}
+	return texts
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InputRefs returns the names referenced by {input:name} placeholders in command, in order of appearance
+func InputRefs(command string) []string {
+	var names []string
+	for _, m := range inputRefPattern.FindAllStringSubmatch(command, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// InputNames returns the names of the job's named inputs, sorted
+func (j *Job) InputNames() []string {
+	names := make([]string, 0, len(j.Inputs))
+	for name := range j.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputFile describes one file of a job's output directory (an entry of manifest.json, or the primary output)
+type OutputFile struct {
+	Key         string `json:"key"`            // OSS key under the job's output prefix
+	Size        int64  `json:"size"`           // Size in bytes
+	SHA256      string `json:"sha256"`         // Hex-encoded SHA-256 of the content
+	ContentType string `json:"content_type"`   // Content-Type the file was uploaded with
+	ETag        string `json:"etag,omitempty"` // ETag of the stored object, if known
+}
+
+// Progress is the latest progress reported by a running job
+type Progress struct {
+	Percent     float64         `json:"percent"`                // 0-100
+	CurrentStep int             `json:"current_step,omitempty"` // Current step (1-based), if the job reports steps
+	TotalSteps  int             `json:"total_steps,omitempty"`  // Number of steps, if known
+	Message     string          `json:"message,omitempty"`      // Short description of the current step
+	Metrics     json.RawMessage `json:"metrics,omitempty"`      // JSON object of job-defined metrics
+	UpdatedAt   time.Time       `json:"updated_at"`             // When the cloud received the progress
+}
+
+// ForwardResponse is the response of the local service to a forward job, as reported by the agent
+type ForwardResponse struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"` // Canonical header name -> value (repeated values joined with ", ")
+}
+
+const (
+	// MaxForwardResponseHeaders bounds the headers recorded for a forward response
+	MaxForwardResponseHeaders = 64
+	// MaxForwardResponseHeaderSize bounds a recorded header value (longer values are cut)
+	MaxForwardResponseHeaderSize = 1024
+)
+
+// ProcessUsage is how a command job's process ended and the resources it used, as reported by the agent
+type ProcessUsage struct {
+	ExitCode    *int   // nil if the process was killed by a signal
+	Signal      string // e.g. "SIGKILL"
+	WallTimeMs  int64
+	UserCPUMs   int64
+	SystemCPUMs int64
+	MaxRSSBytes int64
+}
+
+// ManifestFileName is the name of the manifest the agent uploads next to the output files
+const ManifestFileName = "manifest.json"
+
+// ManifestKey returns the key of the output manifest for the current attempt,
+// or "" if the job has no output files
+func (j *Job) ManifestKey() string {
+	if len(j.OutputFiles) == 0 || j.OutputPrefix == "" {
+		return ""
+	}
+	return j.OutputPrefix + ManifestFileName
 }
 
 // Validate validates the job fields
@@ -107,6 +430,21 @@ func (j *Job) Validate() error {
 	if (j.InputBucket == "" && j.InputKey != "") || (j.InputBucket != "" && j.InputKey == "") {
 		return ErrInvalidInput
 	}
+	if len(j.Inputs) > MaxInputs {
+		return ErrInvalidInputs
+	}
+	for name, input := range j.Inputs {
+		if !ValidInputName(name) || input.Bucket == "" || input.Key == "" {
+			return ErrInvalidInputs
+		}
+		if input.SHA256 != "" && !ValidSHA256(input.SHA256) {
+			return ErrInvalidChecksum
+		}
+	}
+	// An expected checksum needs an input to check
+	if j.InputSHA256 != "" && (j.InputKey == "" || !ValidSHA256(j.InputSHA256)) {
+		return ErrInvalidChecksum
+	}
 	// OutputBucket is optional - if empty, gateway will use OSS provider's default bucket
 	// This allows jobs that only produce stdout/stderr without output files
 	// Note: We still validate that if OutputBucket is provided, it should not be empty
@@ -116,21 +454,75 @@ func (j *Job) Validate() error {
 	if j.AttemptID < 1 {
 		return ErrInvalidAttemptID
 	}
+	if j.TimeoutSec < 0 {
+		return ErrInvalidTimeout
+	}
+	// A command is either a shell string or an argument vector
+	if len(j.Argv) > 0 && (j.Command != "" || j.Argv[0] == "" || len(j.Argv) > MaxArgs) {
+		return ErrInvalidArgv
+	}
+	// A shell command is run only when the submitter asked for a shell
+	if (j.Command != "") != j.Shell {
+		return ErrInvalidShell
+	}
+	if len(j.Env) > MaxEnvVars {
+		return ErrInvalidEnv
+	}
+	for name, value := range j.Env {
+		if !ValidEnvName(name) || strings.ContainsRune(value, 0) {
+			return ErrInvalidEnv
+		}
+	}
+	if len(j.WorkingDir) > MaxWorkingDirLength || strings.ContainsRune(j.WorkingDir, 0) || WorkingDirEscapes(j.WorkingDir) {
+		return ErrInvalidWorkingDir
+	}
+	// A template fixes the command, its environment and working directory on the agent
+	if j.Template != "" {
+		if !ValidTemplateName(j.Template) || j.Command != "" || len(j.Argv) > 0 || len(j.Env) > 0 || j.WorkingDir != "" {
+			return ErrInvalidTemplate
+		}
+	}
+	if len(j.Params) > 0 && j.Template == "" || len(j.Params) > MaxParams {
+		return ErrInvalidParams
+	}
+	for name, value := range j.Params {
+		if !ValidInputName(name) || strings.ContainsRune(value, 0) {
+			return ErrInvalidParams
+		}
+	}
 
 	// Default job type if empty
 	if j.JobType == "" {
 		j.JobType = JobTypeCommand
 	}
-	if j.JobType != JobTypeCommand && j.JobType != JobTypeForwardHTTP {
+	if j.JobType != JobTypeCommand && j.JobType != JobTypeForwardHTTP && j.JobType != JobTypeForwardGRPC {
 		return ErrInvalidJobType
 	}
+	if j.JobType == JobTypeForwardGRPC {
+		if j.Template != "" {
+			return ErrInvalidTemplate
+		}
+		if j.ForwardGRPC == nil || j.ForwardGRPC.Check() != nil {
+			return ErrInvalidForwardGRPC
+		}
+	} else if j.ForwardGRPC != nil {
+		return ErrInvalidForwardGRPC
+	}
 	if j.JobType == JobTypeForwardHTTP {
+		if j.Template != "" {
+			return ErrInvalidTemplate
+		}
 		if j.ForwardURL == "" {
 			return ErrInvalidForwardURL
 		}
 		if j.InputForward != "" && j.InputForward != InputForwardModeURL && j.InputForward != InputForwardModeLocalFile {
 			return ErrInvalidInputForwardMode
 		}
+		if j.ForwardAsync != nil && j.ForwardAsync.Check() != nil {
+			return ErrInvalidForwardAsync
+		}
+	} else if j.ForwardAsync != nil {
+		return ErrInvalidForwardAsync
 	}
 	return nil
 }
@@ -185,6 +577,41 @@ func (j *Job) generateDefaultOutputKey() string {
 	return j.generateDefaultOutputPrefix() + "output." + extension
 }
 
+// OutputKeyForAttempt returns the output key the gateway assigns to the given attempt:
+// jobs/{job_id}/{attempt_id}/output.{ext}
+func (j *Job) OutputKeyForAttempt(attemptID int) string {
+	extension := strings.TrimPrefix(j.OutputExtension, ".")
+	if extension == "" {
+		extension = "bin" // Default extension
+	}
+	return "jobs/" + j.JobID + "/" + intToString(attemptID) + "/output." + extension
+}
+
+// IsOutputFileKey reports whether key names a file under the job's output prefix
+func (j *Job) IsOutputFileKey(key string) bool {
+	return j.OutputPrefix != "" && strings.HasPrefix(key, j.OutputPrefix) && ValidOutputFilePath(key[len(j.OutputPrefix):])
+}
+
+// ValidOutputFilePath reports whether p is a clean path relative to an output prefix
+// ("a/b.txt", not "", "a//b", "../x" or a path with backslashes)
+func ValidOutputFilePath(p string) bool {
+	if p == "" || strings.Contains(p, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// OutputPrefixForAttempt returns the output prefix the gateway assigns to the given attempt:
+// jobs/{job_id}/{attempt_id}/
+func (j *Job) OutputPrefixForAttempt(attemptID int) string {
+	return "jobs/" + j.JobID + "/" + intToString(attemptID) + "/"
+}
+
 // Helper functions
 func startsWith(s, prefix string) bool {
 	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
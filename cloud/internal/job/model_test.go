@@ -245,6 +245,48 @@ func TestJob_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid forward grpc job",
+			job: &Job{
+				JobID:        "forward-grpc-job-1",
+				CreatedAt:    time.Now(),
+				Status:       StatusPending,
+				OutputBucket: "output-bucket",
+				OutputKey:    "output-key",
+				AttemptID:    1,
+				JobType:      JobTypeForwardGRPC,
+				ForwardGRPC:  &ForwardGRPC{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Request: []byte(`{"prompt": "cat"}`)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "forward grpc job missing forward_grpc",
+			job: &Job{
+				JobID:        "forward-grpc-job-2",
+				CreatedAt:    time.Now(),
+				Status:       StatusPending,
+				OutputBucket: "output-bucket",
+				OutputKey:    "output-key",
+				AttemptID:    1,
+				JobType:      JobTypeForwardGRPC,
+			},
+			wantErr: true,
+		},
+		{
+			name: "forward_grpc on a command job",
+			job: &Job{
+				JobID:        "forward-grpc-job-3",
+				CreatedAt:    time.Now(),
+				Status:       StatusPending,
+				OutputBucket: "output-bucket",
+				OutputKey:    "output-key",
+				AttemptID:    1,
+				Command:      "echo",
+				Shell:        true,
+				ForwardGRPC:  &ForwardGRPC{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid job type",
 			job: &Job{
@@ -271,6 +313,71 @@ func TestJob_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:    "argv",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Argv: []string{"python", "run.py", "{input}"}, Env: map[string]string{"OMP_NUM_THREADS": "4"}, WorkingDir: "src"},
+			wantErr: false,
+		},
+		{
+			name:    "argv and command",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Command: "python run.py", Shell: true, Argv: []string{"python", "run.py"}},
+			wantErr: true,
+		},
+		{
+			name:    "command",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Command: "python run.py {input}", Shell: true},
+			wantErr: false,
+		},
+		{
+			name:    "command without shell",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Command: "python run.py {input}"},
+			wantErr: true,
+		},
+		{
+			name:    "shell without command",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Argv: []string{"python", "run.py"}, Shell: true},
+			wantErr: true,
+		},
+		{
+			name:    "argv without program",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Argv: []string{"", "run.py"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid env name",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Argv: []string{"env"}, Env: map[string]string{"1ST": "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "template",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Template: "resize", Params: map[string]string{"size": "640x480"}},
+			wantErr: false,
+		},
+		{
+			name:    "template and command",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Template: "resize", Command: "convert {input} {output}", Shell: true},
+			wantErr: true,
+		},
+		{
+			name:    "params without template",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Command: "echo", Shell: true, Params: map[string]string{"size": "640x480"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid param name",
+			job:     &Job{JobID: "test-job-id", Status: StatusPending, AttemptID: 1, Template: "resize", Params: map[string]string{"a b": "1"}},
+			wantErr: true,
+		},
+		{
+			name: "negative timeout",
+			job: &Job{
+				JobID:      "test-job-id",
+				Status:     StatusPending,
+				AttemptID:  1,
+				TimeoutSec: -1,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -429,3 +536,33 @@ func TestJob_OutputPathConsistency(t *testing.T) {
 		})
 	}
 }
+
+func TestForwardGRPC_Check(t *testing.T) {
+	valid := []ForwardGRPC{
+		{Target: "127.0.0.1:50051", Method: "Predictor/Predict"},
+		{Target: "localhost:50051", Method: "/model.v1.Predictor/Predict", Request: []byte(`{}`), Metadata: map[string]string{"x-tenant": "lab"}},
+		{Target: "[::1]:50051", Method: "model.v1.Predictor/Predict", RequestProto: []byte{0x0a, 0x03, 'c', 'a', 't'}},
+	}
+	for _, call := range valid {
+		if err := call.Check(); err != nil {
+			t.Errorf("Check(%+v) = %v", call, err)
+		}
+	}
+	invalid := []ForwardGRPC{
+		{Target: "127.0.0.1", Method: "model.v1.Predictor/Predict"},
+		{Target: "127.0.0.1:0", Method: "model.v1.Predictor/Predict"},
+		{Target: ":50051", Method: "model.v1.Predictor/Predict"},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor"},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict/x"},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Request: []byte(`[1]`)},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Request: []byte(`{}`), RequestProto: []byte{0x08, 0x01}},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Metadata: map[string]string{"grpc-timeout": "1S"}},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Metadata: map[string]string{"X-Tenant": "lab"}},
+		{Target: "127.0.0.1:50051", Method: "model.v1.Predictor/Predict", Metadata: map[string]string{"x-tenant": "a\nb"}},
+	}
+	for _, call := range invalid {
+		if err := call.Check(); err == nil {
+			t.Errorf("Check(%+v) accepted an invalid call", call)
+		}
+	}
+}
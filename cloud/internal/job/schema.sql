@@ -26,6 +26,35 @@ CREATE TABLE IF NOT EXISTS jobs (
     lease_id VARCHAR(255) COMMENT 'Lease ID for job execution',
     lease_deadline DATETIME COMMENT 'Lease expiration time',
     command VARCHAR(8192) COMMENT 'Command to execute on agent',
+    idempotency_key VARCHAR(255) COMMENT 'Optional client-supplied key for deduplicating retried submissions',
+    request_hash VARCHAR(64) COMMENT 'SHA-256 of the normalized create request',
+    submitter VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Submitter identifier (scopes idempotency keys)',
+    callback_url VARCHAR(2048) COMMENT 'URL notified when the job reaches a terminal state',
+    webhook_id VARCHAR(255) COMMENT 'Registered webhook subscription notified on completion',
+    started_at DATETIME COMMENT 'When the job first entered RUNNING',
+    finished_at DATETIME COMMENT 'When the job reached a terminal state',
+    output_files TEXT COMMENT 'Output manifest (JSON array of key, size, sha256, content_type)',
+    inputs TEXT COMMENT 'Named inputs (JSON object of name -> bucket, key, sha256)',
+    input_sha256 VARCHAR(64) COMMENT 'Optional expected SHA-256 of the input (verified by the agent)',
+    output_file TEXT COMMENT 'Primary output as confirmed in OSS (JSON object of key, size, sha256, content_type, etag)',
+    progress TEXT COMMENT 'Latest progress reported by the agent (JSON object of percent, current_step, total_steps, message, metrics)',
+    exit_code INT COMMENT 'Exit code of the command process (NULL if not reported or killed by a signal)',
+    term_signal VARCHAR(32) COMMENT 'Signal that terminated the command process (e.g. SIGKILL)',
+    wall_time_ms BIGINT COMMENT 'Wall time of the command process in milliseconds',
+    user_cpu_ms BIGINT COMMENT 'User CPU time of the command process in milliseconds',
+    system_cpu_ms BIGINT COMMENT 'System CPU time of the command process in milliseconds',
+    max_rss_bytes BIGINT COMMENT 'Peak resident set size of the command process in bytes',
+    timeout_sec INT COMMENT 'Maximum run time of the job in seconds (NULL/0: server default)',
+    reason VARCHAR(32) COMMENT 'Why the job ended, if not a plain failure (e.g. TIMED_OUT)',
+    argv TEXT COMMENT 'Argument vector of a command run without a shell (JSON array; NULL for shell commands)',
+    env TEXT COMMENT 'Per-job environment variables of the command (JSON object of name -> value)',
+    working_dir VARCHAR(1024) COMMENT 'Working directory of the command (relative paths are under the job work directory)',
+    template VARCHAR(64) COMMENT 'Job template declared in the agent config (NULL for command and argv jobs)',
+    params TEXT COMMENT 'Template parameters (JSON object of name -> value)',
+    forward_async TEXT COMMENT 'Asynchronous forward mode (JSON object; NULL for synchronous forward jobs)',
+    forward_response TEXT COMMENT 'Status code and headers of the local service response (JSON object; forward jobs)',
+    forward_grpc TEXT COMMENT 'gRPC call of a FORWARD_GRPC job (JSON object: target, method, request, metadata)',
+    assigned_at DATETIME COMMENT 'When the current attempt was assigned to an agent',
     CONSTRAINT chk_attempt_id CHECK (attempt_id >= 1),
     CONSTRAINT chk_status CHECK (status IN ('PENDING', 'ASSIGNED', 'RUNNING', 'SUCCEEDED', 'FAILED', 'CANCELED', 'LOST'))
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Job management table';
@@ -45,3 +74,6 @@ CREATE INDEX idx_jobs_created_at ON jobs(created_at);
 
 -- Create index on assigned_agent_id (ignore error if already exists)
 CREATE INDEX idx_jobs_assigned_agent ON jobs(assigned_agent_id);
+
+-- Create unique index on (submitter, idempotency_key) (ignore error if already exists)
+CREATE UNIQUE INDEX idx_jobs_submitter_idempotency_key ON jobs(submitter, idempotency_key);
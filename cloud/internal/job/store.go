@@ -2,7 +2,9 @@ package job
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -18,6 +20,10 @@ type Store interface {
 	// Get retrieves a job by ID
 	Get(jobID string) (*Job, error)
 
+	// GetByIdempotencyKey retrieves the job the submitter created with the given idempotency key
+	// (keys are scoped to the submitter; an empty submitter is its own scope)
+	GetByIdempotencyKey(submitter, key string) (*Job, error)
+
 	// UpdateStatus updates the job status (with transition validation)
 	UpdateStatus(jobID string, newStatus Status) error
 
@@ -36,9 +42,35 @@ type Store interface {
 	// UpdateMessage updates the message for a job
 	UpdateMessage(jobID string, message string) error
 
+	// UpdateOutputFiles records the output manifest (every file uploaded under the output prefix)
+	UpdateOutputFiles(jobID string, files []OutputFile) error
+
+	// UpdateOutputFile records the verified size, SHA-256 and ETag of the primary output (output_key)
+	UpdateOutputFile(jobID string, file *OutputFile) error
+
+	// UpdateProgress records the latest progress reported for a job
+	UpdateProgress(jobID string, progress *Progress) error
+
+	// UpdateProcessUsage records the exit status and resource usage of a job's process
+	UpdateProcessUsage(jobID string, usage ProcessUsage) error
+
+	// UpdateReason records why a job ended (e.g. ReasonTimedOut)
+	UpdateReason(jobID string, reason string) error
+
+	// TimeOut fails attempt attemptID of an ASSIGNED or RUNNING job with reason TIMED_OUT and the given
+	// message in a single conditional update. It reports false, changing nothing, if the job has since
+	// moved to another state or attempt.
+	TimeOut(jobID string, attemptID int, message string) (bool, error)
+
+	// UpdateForwardResponse records the status code and headers of a forward job's response
+	UpdateForwardResponse(jobID string, response *ForwardResponse) error
+
 	// List returns a list of jobs (with optional filters)
 	List(limit int, offset int, status *Status) ([]*Job, error)
 
+	// ListBySubmitter returns a list of jobs created by the given submitter (with optional filters)
+	ListBySubmitter(submitter string, limit int, offset int, status *Status) ([]*Job, error)
+
 	// Close closes the database connection
 	Close() error
 }
@@ -94,6 +126,36 @@ func (s *SQLiteStore) initSchema() error {
 		message TEXT,
 		stdout TEXT,
 		stderr TEXT,
+		idempotency_key TEXT,
+		request_hash TEXT,
+		submitter TEXT NOT NULL DEFAULT '',
+		callback_url TEXT,
+		webhook_id TEXT,
+		started_at DATETIME,
+		finished_at DATETIME,
+		output_files TEXT,
+		inputs TEXT,
+		input_sha256 TEXT,
+		output_file TEXT,
+		progress TEXT,
+		exit_code INTEGER,
+		term_signal TEXT,
+		wall_time_ms INTEGER,
+		user_cpu_ms INTEGER,
+		system_cpu_ms INTEGER,
+		max_rss_bytes INTEGER,
+		timeout_sec INTEGER,
+		reason TEXT,
+		argv TEXT,
+		env TEXT,
+		working_dir TEXT,
+		template TEXT,
+		params TEXT,
+		forward_async TEXT,
+		forward_response TEXT,
+		forward_grpc TEXT,
+		assigned_at DATETIME,
+		shell INTEGER,
 		CHECK (attempt_id >= 1),
 		CHECK (status IN ('PENDING', 'ASSIGNED', 'RUNNING', 'SUCCEEDED', 'FAILED', 'CANCELED', 'LOST'))
 	);
@@ -123,6 +185,36 @@ func (s *SQLiteStore) initSchema() error {
 		"forward_timeout INTEGER",
 		"input_forward_mode TEXT",
 		"message TEXT",
+		"idempotency_key TEXT",
+		"request_hash TEXT",
+		"submitter TEXT NOT NULL DEFAULT ''",
+		"callback_url TEXT",
+		"webhook_id TEXT",
+		"started_at DATETIME",
+		"finished_at DATETIME",
+		"output_files TEXT",
+		"inputs TEXT",
+		"input_sha256 TEXT",
+		"output_file TEXT",
+		"progress TEXT",
+		"exit_code INTEGER",
+		"term_signal TEXT",
+		"wall_time_ms INTEGER",
+		"user_cpu_ms INTEGER",
+		"system_cpu_ms INTEGER",
+		"max_rss_bytes INTEGER",
+		"timeout_sec INTEGER",
+		"reason TEXT",
+		"argv TEXT",
+		"env TEXT",
+		"working_dir TEXT",
+		"template TEXT",
+		"params TEXT",
+		"forward_async TEXT",
+		"forward_response TEXT",
+		"forward_grpc TEXT",
+		"assigned_at DATETIME",
+		"shell INTEGER",
 	}
 	for _, col := range newColumns {
 		_, err = s.db.Exec(`ALTER TABLE jobs ADD COLUMN ` + col)
@@ -132,6 +224,14 @@ func (s *SQLiteStore) initSchema() error {
 		}
 	}
 
+	// Idempotency keys are unique per submitter, so one submitter's key never matches another's job.
+	// The unique index must be created after the columns exist (older databases get them via ALTER above).
+	// NULL keys are not considered duplicates, so jobs without an idempotency key are unaffected;
+	// submitter is never NULL, so jobs without a submitter still share one scope.
+	if _, err := s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_submitter_idempotency_key ON jobs(submitter, idempotency_key)`); err != nil {
+		return fmt.Errorf("failed to create idempotency key index: %w", err)
+	}
+
 	return nil
 }
 
@@ -150,8 +250,9 @@ func (s *SQLiteStore) Create(job *Job) error {
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
-	) VALUES (?, datetime(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
+	) VALUES (?, datetime(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	// Format time for SQLite
@@ -187,9 +288,42 @@ func (s *SQLiteStore) Create(job *Job) error {
 		job.Message,
 		job.Stdout,
 		job.Stderr,
+		nullableString(job.IdempotencyKey),
+		nullableString(job.RequestHash),
+		job.Submitter,
+		nullableString(job.CallbackURL),
+		nullableString(job.WebhookID),
+		job.StartedAt,
+		job.FinishedAt,
+		encodeOutputFiles(job.OutputFiles),
+		encodeInputs(job.Inputs),
+		nullableString(job.InputSHA256),
+		encodeOutputFile(job.Output),
+		encodeProgress(job.Progress),
+		job.ExitCode,
+		nullableString(job.Signal),
+		job.WallTimeMs,
+		job.UserCPUMs,
+		job.SystemCPUMs,
+		job.MaxRSSBytes,
+		job.TimeoutSec,
+		nullableString(job.Reason),
+		encodeArgv(job.Argv),
+		encodeStringMap(job.Env),
+		nullableString(job.WorkingDir),
+		nullableString(job.Template),
+		encodeStringMap(job.Params),
+		encodeForwardAsync(job.ForwardAsync),
+		encodeForwardResponse(job.ForwardResponse),
+		encodeForwardGRPC(job.ForwardGRPC),
+		job.AssignedAt,
+		job.Shell,
 	)
 
 	if err != nil {
+		if isDuplicateIdempotencyKey(err) {
+			return ErrDuplicateIdempotencyKey
+		}
 		return fmt.Errorf("failed to create job: %w", err)
 	}
 
@@ -204,7 +338,8 @@ func (s *SQLiteStore) Get(jobID string) (*Job, error) {
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
 	FROM jobs
 	WHERE job_id = ?
 	`
@@ -225,6 +360,36 @@ func (s *SQLiteStore) Get(jobID string) (*Job, error) {
 	var stdout sql.NullString
 	var stderr sql.NullString
 	var outputExtension sql.NullString
+	var idempotencyKey sql.NullString
+	var requestHash sql.NullString
+	var submitter sql.NullString
+	var callbackURL sql.NullString
+	var webhookID sql.NullString
+	var startedAt sql.NullTime
+	var finishedAt sql.NullTime
+	var outputFiles sql.NullString
+	var inputs sql.NullString
+	var inputSHA256 sql.NullString
+	var outputFile sql.NullString
+	var progress sql.NullString
+	var exitCode sql.NullInt64
+	var termSignal sql.NullString
+	var wallTimeMs sql.NullInt64
+	var userCPUMs sql.NullInt64
+	var systemCPUMs sql.NullInt64
+	var maxRSSBytes sql.NullInt64
+	var timeoutSec sql.NullInt64
+	var reason sql.NullString
+	var argv sql.NullString
+	var env sql.NullString
+	var workingDir sql.NullString
+	var template sql.NullString
+	var params sql.NullString
+	var forwardAsync sql.NullString
+	var forwardResponse sql.NullString
+	var forwardGRPC sql.NullString
+	var assignedAt sql.NullTime
+	var shell sql.NullBool
 
 	err := s.db.QueryRow(query, jobID).Scan(
 		&job.JobID,
@@ -251,6 +416,36 @@ func (s *SQLiteStore) Get(jobID string) (*Job, error) {
 		&message,
 		&stdout,
 		&stderr,
+		&idempotencyKey,
+		&requestHash,
+		&submitter,
+		&callbackURL,
+		&webhookID,
+		&startedAt,
+		&finishedAt,
+		&outputFiles,
+		&inputs,
+		&inputSHA256,
+		&outputFile,
+		&progress,
+		&exitCode,
+		&termSignal,
+		&wallTimeMs,
+		&userCPUMs,
+		&systemCPUMs,
+		&maxRSSBytes,
+		&timeoutSec,
+		&reason,
+		&argv,
+		&env,
+		&workingDir,
+		&template,
+		&params,
+		&forwardAsync,
+		&forwardResponse,
+		&forwardGRPC,
+		&assignedAt,
+		&shell,
 	)
 
 	if err == sql.ErrNoRows {
@@ -333,9 +528,121 @@ func (s *SQLiteStore) Get(jobID string) (*Job, error) {
 		job.Stderr = ""
 	}
 
+	if idempotencyKey.Valid {
+		job.IdempotencyKey = idempotencyKey.String
+	}
+	if requestHash.Valid {
+		job.RequestHash = requestHash.String
+	}
+	if submitter.Valid {
+		job.Submitter = submitter.String
+	}
+	if callbackURL.Valid {
+		job.CallbackURL = callbackURL.String
+	}
+	if webhookID.Valid {
+		job.WebhookID = webhookID.String
+	}
+	if startedAt.Valid {
+		t := startedAt.Time
+		job.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time
+		job.FinishedAt = &t
+	}
+	if outputFiles.Valid {
+		job.OutputFiles = decodeOutputFiles(outputFiles.String)
+	}
+	if inputs.Valid {
+		job.Inputs = decodeInputs(inputs.String)
+	}
+	if inputSHA256.Valid {
+		job.InputSHA256 = inputSHA256.String
+	}
+	if outputFile.Valid {
+		job.Output = decodeOutputFile(outputFile.String)
+	}
+	if progress.Valid {
+		job.Progress = decodeProgress(progress.String)
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		job.ExitCode = &code
+	}
+	if termSignal.Valid {
+		job.Signal = termSignal.String
+	}
+	if wallTimeMs.Valid {
+		job.WallTimeMs = &wallTimeMs.Int64
+	}
+	if userCPUMs.Valid {
+		job.UserCPUMs = &userCPUMs.Int64
+	}
+	if systemCPUMs.Valid {
+		job.SystemCPUMs = &systemCPUMs.Int64
+	}
+	if maxRSSBytes.Valid {
+		job.MaxRSSBytes = &maxRSSBytes.Int64
+	}
+	if timeoutSec.Valid {
+		job.TimeoutSec = int(timeoutSec.Int64)
+	}
+	if reason.Valid {
+		job.Reason = reason.String
+	}
+	if argv.Valid {
+		job.Argv = decodeArgv(argv.String)
+	}
+	if env.Valid {
+		job.Env = decodeStringMap(env.String, "env")
+	}
+	if workingDir.Valid {
+		job.WorkingDir = workingDir.String
+	}
+	if template.Valid {
+		job.Template = template.String
+	}
+	if params.Valid {
+		job.Params = decodeStringMap(params.String, "params")
+	}
+	if forwardAsync.Valid {
+		job.ForwardAsync = decodeForwardAsync(forwardAsync.String)
+	}
+	if forwardResponse.Valid {
+		job.ForwardResponse = decodeForwardResponse(forwardResponse.String)
+	}
+	if forwardGRPC.Valid {
+		job.ForwardGRPC = decodeForwardGRPC(forwardGRPC.String)
+	}
+	if assignedAt.Valid {
+		t := assignedAt.Time
+		job.AssignedAt = &t
+	}
+	// Command jobs stored before the shell column were all submitted to run through a shell
+	job.Shell = shell.Bool || (!shell.Valid && job.Command != "")
+
 	return &job, nil
 }
 
+// GetByIdempotencyKey retrieves the job the submitter created with the given idempotency key
+func (s *SQLiteStore) GetByIdempotencyKey(submitter, key string) (*Job, error) {
+	if key == "" {
+		return nil, ErrJobNotFound
+	}
+
+	var jobID string
+	err := s.db.QueryRow(`SELECT job_id FROM jobs WHERE submitter = ? AND idempotency_key = ?`, submitter, key).Scan(&jobID)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by idempotency key: %w", err)
+	}
+
+	return s.Get(jobID)
+}
+
 // UpdateStatus updates the job status (with transition validation)
 func (s *SQLiteStore) UpdateStatus(jobID string, newStatus Status) error {
 	if !newStatus.IsValid() {
@@ -352,8 +659,8 @@ func (s *SQLiteStore) UpdateStatus(jobID string, newStatus Status) error {
 		return fmt.Errorf("%w: cannot transition from %s to %s", ErrInvalidTransition, job.Status, newStatus)
 	}
 
-	query := `UPDATE jobs SET status = ? WHERE job_id = ?`
-	_, err = s.db.Exec(query, string(newStatus), jobID)
+	query, args := statusUpdateQuery(jobID, newStatus, time.Now().UTC())
+	_, err = s.db.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
 	}
@@ -414,23 +721,111 @@ func (s *SQLiteStore) UpdateMessage(jobID string, message string) error {
 	return nil
 }
 
+// UpdateOutputFiles records the output manifest for a job
+func (s *SQLiteStore) UpdateOutputFiles(jobID string, files []OutputFile) error {
+	query := `UPDATE jobs SET output_files = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeOutputFiles(files), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update output files: %w", err)
+	}
+	return nil
+}
+
+// UpdateOutputFile records the verified primary output for a job
+func (s *SQLiteStore) UpdateOutputFile(jobID string, file *OutputFile) error {
+	query := `UPDATE jobs SET output_file = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeOutputFile(file), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update output file: %w", err)
+	}
+	return nil
+}
+
+// UpdateProcessUsage records the exit status and resource usage of a job's process
+func (s *SQLiteStore) UpdateProcessUsage(jobID string, usage ProcessUsage) error {
+	query := `UPDATE jobs SET exit_code = ?, term_signal = ?, wall_time_ms = ?, user_cpu_ms = ?, system_cpu_ms = ?, max_rss_bytes = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, usage.ExitCode, nullableString(usage.Signal), usage.WallTimeMs, usage.UserCPUMs, usage.SystemCPUMs, usage.MaxRSSBytes, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update process usage: %w", err)
+	}
+	return nil
+}
+
+// UpdateForwardResponse records the status code and headers of a forward job's response
+func (s *SQLiteStore) UpdateForwardResponse(jobID string, response *ForwardResponse) error {
+	query := `UPDATE jobs SET forward_response = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeForwardResponse(response), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update forward response: %w", err)
+	}
+	return nil
+}
+
+// UpdateReason records why a job ended (e.g. ReasonTimedOut)
+func (s *SQLiteStore) UpdateReason(jobID string, reason string) error {
+	query := `UPDATE jobs SET reason = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, nullableString(reason), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update reason: %w", err)
+	}
+	return nil
+}
+
+// TimeOut fails an ASSIGNED or RUNNING attempt with reason TIMED_OUT; it reports whether the job was updated
+func (s *SQLiteStore) TimeOut(jobID string, attemptID int, message string) (bool, error) {
+	query, args := timeOutQuery(jobID, attemptID, message, time.Now().UTC())
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to time out job: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to time out job: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UpdateProgress records the latest progress for a job
+func (s *SQLiteStore) UpdateProgress(jobID string, progress *Progress) error {
+	query := `UPDATE jobs SET progress = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeProgress(progress), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update progress: %w", err)
+	}
+	return nil
+}
+
 // List returns a list of jobs (with optional filters)
 func (s *SQLiteStore) List(limit int, offset int, status *Status) ([]*Job, error) {
+	return s.ListBySubmitter("", limit, offset, status)
+}
+
+// ListBySubmitter returns a list of jobs created by the given submitter (empty submitter matches all jobs)
+func (s *SQLiteStore) ListBySubmitter(submitter string, limit int, offset int, status *Status) ([]*Job, error) {
 	query := `
 	SELECT 
 		job_id, created_at, status, input_bucket, input_key,
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
 	FROM jobs
 	`
 	args := []interface{}{}
 
+	var conditions []string
 	if status != nil {
-		query += " WHERE status = ?"
+		conditions = append(conditions, "status = ?")
 		args = append(args, string(*status))
 	}
+	if submitter != "" {
+		conditions = append(conditions, "submitter = ?")
+		args = append(args, submitter)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
@@ -459,6 +854,36 @@ func (s *SQLiteStore) List(limit int, offset int, status *Status) ([]*Job, error
 		var stdout sql.NullString
 		var stderr sql.NullString
 		var outputExtension sql.NullString
+		var idempotencyKey sql.NullString
+		var requestHash sql.NullString
+		var submitter sql.NullString
+		var callbackURL sql.NullString
+		var webhookID sql.NullString
+		var startedAt sql.NullTime
+		var finishedAt sql.NullTime
+		var outputFiles sql.NullString
+		var inputs sql.NullString
+		var inputSHA256 sql.NullString
+		var outputFile sql.NullString
+		var progress sql.NullString
+		var exitCode sql.NullInt64
+		var termSignal sql.NullString
+		var wallTimeMs sql.NullInt64
+		var userCPUMs sql.NullInt64
+		var systemCPUMs sql.NullInt64
+		var maxRSSBytes sql.NullInt64
+		var timeoutSec sql.NullInt64
+		var reason sql.NullString
+		var argv sql.NullString
+		var env sql.NullString
+		var workingDir sql.NullString
+		var template sql.NullString
+		var params sql.NullString
+		var forwardAsync sql.NullString
+		var forwardResponse sql.NullString
+		var forwardGRPC sql.NullString
+		var assignedAt sql.NullTime
+		var shell sql.NullBool
 
 		err := rows.Scan(
 			&job.JobID,
@@ -485,6 +910,36 @@ func (s *SQLiteStore) List(limit int, offset int, status *Status) ([]*Job, error
 			&message,
 			&stdout,
 			&stderr,
+			&idempotencyKey,
+			&requestHash,
+			&submitter,
+			&callbackURL,
+			&webhookID,
+			&startedAt,
+			&finishedAt,
+			&outputFiles,
+			&inputs,
+			&inputSHA256,
+			&outputFile,
+			&progress,
+			&exitCode,
+			&termSignal,
+			&wallTimeMs,
+			&userCPUMs,
+			&systemCPUMs,
+			&maxRSSBytes,
+			&timeoutSec,
+			&reason,
+			&argv,
+			&env,
+			&workingDir,
+			&template,
+			&params,
+			&forwardAsync,
+			&forwardResponse,
+			&forwardGRPC,
+			&assignedAt,
+			&shell,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -562,6 +1017,100 @@ func (s *SQLiteStore) List(limit int, offset int, status *Status) ([]*Job, error
 			job.Stderr = ""
 		}
 
+		if idempotencyKey.Valid {
+			job.IdempotencyKey = idempotencyKey.String
+		}
+		if requestHash.Valid {
+			job.RequestHash = requestHash.String
+		}
+		if submitter.Valid {
+			job.Submitter = submitter.String
+		}
+		if callbackURL.Valid {
+			job.CallbackURL = callbackURL.String
+		}
+		if webhookID.Valid {
+			job.WebhookID = webhookID.String
+		}
+		if startedAt.Valid {
+			t := startedAt.Time
+			job.StartedAt = &t
+		}
+		if finishedAt.Valid {
+			t := finishedAt.Time
+			job.FinishedAt = &t
+		}
+		if outputFiles.Valid {
+			job.OutputFiles = decodeOutputFiles(outputFiles.String)
+		}
+		if inputs.Valid {
+			job.Inputs = decodeInputs(inputs.String)
+		}
+		if inputSHA256.Valid {
+			job.InputSHA256 = inputSHA256.String
+		}
+		if outputFile.Valid {
+			job.Output = decodeOutputFile(outputFile.String)
+		}
+		if progress.Valid {
+			job.Progress = decodeProgress(progress.String)
+		}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			job.ExitCode = &code
+		}
+		if termSignal.Valid {
+			job.Signal = termSignal.String
+		}
+		if wallTimeMs.Valid {
+			job.WallTimeMs = &wallTimeMs.Int64
+		}
+		if userCPUMs.Valid {
+			job.UserCPUMs = &userCPUMs.Int64
+		}
+		if systemCPUMs.Valid {
+			job.SystemCPUMs = &systemCPUMs.Int64
+		}
+		if maxRSSBytes.Valid {
+			job.MaxRSSBytes = &maxRSSBytes.Int64
+		}
+		if timeoutSec.Valid {
+			job.TimeoutSec = int(timeoutSec.Int64)
+		}
+		if reason.Valid {
+			job.Reason = reason.String
+		}
+		if argv.Valid {
+			job.Argv = decodeArgv(argv.String)
+		}
+		if env.Valid {
+			job.Env = decodeStringMap(env.String, "env")
+		}
+		if workingDir.Valid {
+			job.WorkingDir = workingDir.String
+		}
+		if template.Valid {
+			job.Template = template.String
+		}
+		if params.Valid {
+			job.Params = decodeStringMap(params.String, "params")
+		}
+		if forwardAsync.Valid {
+			job.ForwardAsync = decodeForwardAsync(forwardAsync.String)
+		}
+		if forwardResponse.Valid {
+			job.ForwardResponse = decodeForwardResponse(forwardResponse.String)
+		}
+		if forwardGRPC.Valid {
+			job.ForwardGRPC = decodeForwardGRPC(forwardGRPC.String)
+		}
+		if assignedAt.Valid {
+			t := assignedAt.Time
+			job.AssignedAt = &t
+		}
+		// Command jobs stored before the shell column were all submitted to run through a shell
+		job.Shell = shell.Bool || (!shell.Valid && job.Command != "")
+
 		jobs = append(jobs, &job)
 	}
 
@@ -643,6 +1192,36 @@ func (s *MySQLStore) initSchema() error {
 		message TEXT,
 		stdout TEXT,
 		stderr TEXT,
+		idempotency_key VARCHAR(255),
+		request_hash VARCHAR(64),
+		submitter VARCHAR(255) NOT NULL DEFAULT '',
+		callback_url VARCHAR(2048),
+		webhook_id VARCHAR(255),
+		started_at DATETIME,
+		finished_at DATETIME,
+		output_files TEXT,
+		inputs TEXT,
+		input_sha256 VARCHAR(64),
+		output_file TEXT,
+		progress TEXT,
+		exit_code INT,
+		term_signal VARCHAR(32),
+		wall_time_ms BIGINT,
+		user_cpu_ms BIGINT,
+		system_cpu_ms BIGINT,
+		max_rss_bytes BIGINT,
+		timeout_sec INT,
+		reason VARCHAR(32),
+		argv TEXT,
+		env TEXT,
+		working_dir VARCHAR(1024),
+		template VARCHAR(64),
+		params TEXT,
+		forward_async TEXT,
+		forward_response TEXT,
+		forward_grpc TEXT,
+		assigned_at DATETIME,
+		shell BOOLEAN,
 		CHECK (attempt_id >= 1),
 		CHECK (status IN ('PENDING', 'ASSIGNED', 'RUNNING', 'SUCCEEDED', 'FAILED', 'CANCELED', 'LOST'))
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -670,6 +1249,36 @@ func (s *MySQLStore) initSchema() error {
 		{"forward_timeout", "INT"},
 		{"input_forward_mode", "VARCHAR(50)"},
 		{"message", "TEXT"},
+		{"idempotency_key", "VARCHAR(255)"},
+		{"request_hash", "VARCHAR(64)"},
+		{"submitter", "VARCHAR(255) NOT NULL DEFAULT ''"},
+		{"callback_url", "VARCHAR(2048)"},
+		{"webhook_id", "VARCHAR(255)"},
+		{"started_at", "DATETIME"},
+		{"finished_at", "DATETIME"},
+		{"output_files", "TEXT"},
+		{"inputs", "TEXT"},
+		{"input_sha256", "VARCHAR(64)"},
+		{"output_file", "TEXT"},
+		{"progress", "TEXT"},
+		{"exit_code", "INT"},
+		{"term_signal", "VARCHAR(32)"},
+		{"wall_time_ms", "BIGINT"},
+		{"user_cpu_ms", "BIGINT"},
+		{"system_cpu_ms", "BIGINT"},
+		{"max_rss_bytes", "BIGINT"},
+		{"timeout_sec", "INT"},
+		{"reason", "VARCHAR(32)"},
+		{"argv", "TEXT"},
+		{"env", "TEXT"},
+		{"working_dir", "VARCHAR(1024)"},
+		{"template", "VARCHAR(64)"},
+		{"params", "TEXT"},
+		{"forward_async", "TEXT"},
+		{"forward_response", "TEXT"},
+		{"forward_grpc", "TEXT"},
+		{"assigned_at", "DATETIME"},
+		{"shell", "BOOLEAN"},
 	}
 	for _, col := range newColumns {
 		_, err := s.db.Exec(fmt.Sprintf("ALTER TABLE jobs ADD COLUMN %s %s", col.name, col.typ))
@@ -696,6 +1305,7 @@ func (s *MySQLStore) initSchema() error {
 		{"idx_jobs_status", "CREATE INDEX idx_jobs_status ON jobs(status)"},
 		{"idx_jobs_created_at", "CREATE INDEX idx_jobs_created_at ON jobs(created_at)"},
 		{"idx_jobs_assigned_agent", "CREATE INDEX idx_jobs_assigned_agent ON jobs(assigned_agent_id)"},
+		{"idx_jobs_submitter_idempotency_key", "CREATE UNIQUE INDEX idx_jobs_submitter_idempotency_key ON jobs(submitter, idempotency_key)"},
 	}
 
 	for _, idx := range indexes {
@@ -737,8 +1347,9 @@ func (s *MySQLStore) Create(job *Job) error {
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := s.db.Exec(
@@ -767,9 +1378,42 @@ func (s *MySQLStore) Create(job *Job) error {
 		job.Message,
 		job.Stdout,
 		job.Stderr,
+		nullableString(job.IdempotencyKey),
+		nullableString(job.RequestHash),
+		job.Submitter,
+		nullableString(job.CallbackURL),
+		nullableString(job.WebhookID),
+		job.StartedAt,
+		job.FinishedAt,
+		encodeOutputFiles(job.OutputFiles),
+		encodeInputs(job.Inputs),
+		nullableString(job.InputSHA256),
+		encodeOutputFile(job.Output),
+		encodeProgress(job.Progress),
+		job.ExitCode,
+		nullableString(job.Signal),
+		job.WallTimeMs,
+		job.UserCPUMs,
+		job.SystemCPUMs,
+		job.MaxRSSBytes,
+		job.TimeoutSec,
+		nullableString(job.Reason),
+		encodeArgv(job.Argv),
+		encodeStringMap(job.Env),
+		nullableString(job.WorkingDir),
+		nullableString(job.Template),
+		encodeStringMap(job.Params),
+		encodeForwardAsync(job.ForwardAsync),
+		encodeForwardResponse(job.ForwardResponse),
+		encodeForwardGRPC(job.ForwardGRPC),
+		job.AssignedAt,
+		job.Shell,
 	)
 
 	if err != nil {
+		if isDuplicateIdempotencyKey(err) {
+			return ErrDuplicateIdempotencyKey
+		}
 		return fmt.Errorf("failed to create job: %w", err)
 	}
 
@@ -784,7 +1428,8 @@ func (s *MySQLStore) Get(jobID string) (*Job, error) {
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
 	FROM jobs
 	WHERE job_id = ?
 	`
@@ -804,6 +1449,36 @@ func (s *MySQLStore) Get(jobID string) (*Job, error) {
 	var stdout sql.NullString
 	var stderr sql.NullString
 	var outputExtension sql.NullString
+	var idempotencyKey sql.NullString
+	var requestHash sql.NullString
+	var submitter sql.NullString
+	var callbackURL sql.NullString
+	var webhookID sql.NullString
+	var startedAt sql.NullTime
+	var finishedAt sql.NullTime
+	var outputFiles sql.NullString
+	var inputs sql.NullString
+	var inputSHA256 sql.NullString
+	var outputFile sql.NullString
+	var progress sql.NullString
+	var exitCode sql.NullInt64
+	var termSignal sql.NullString
+	var wallTimeMs sql.NullInt64
+	var userCPUMs sql.NullInt64
+	var systemCPUMs sql.NullInt64
+	var maxRSSBytes sql.NullInt64
+	var timeoutSec sql.NullInt64
+	var reason sql.NullString
+	var argv sql.NullString
+	var env sql.NullString
+	var workingDir sql.NullString
+	var template sql.NullString
+	var params sql.NullString
+	var forwardAsync sql.NullString
+	var forwardResponse sql.NullString
+	var forwardGRPC sql.NullString
+	var assignedAt sql.NullTime
+	var shell sql.NullBool
 
 	err := s.db.QueryRow(query, jobID).Scan(
 		&job.JobID,
@@ -830,6 +1505,36 @@ func (s *MySQLStore) Get(jobID string) (*Job, error) {
 		&message,
 		&stdout,
 		&stderr,
+		&idempotencyKey,
+		&requestHash,
+		&submitter,
+		&callbackURL,
+		&webhookID,
+		&startedAt,
+		&finishedAt,
+		&outputFiles,
+		&inputs,
+		&inputSHA256,
+		&outputFile,
+		&progress,
+		&exitCode,
+		&termSignal,
+		&wallTimeMs,
+		&userCPUMs,
+		&systemCPUMs,
+		&maxRSSBytes,
+		&timeoutSec,
+		&reason,
+		&argv,
+		&env,
+		&workingDir,
+		&template,
+		&params,
+		&forwardAsync,
+		&forwardResponse,
+		&forwardGRPC,
+		&assignedAt,
+		&shell,
 	)
 
 	if err == sql.ErrNoRows {
@@ -901,9 +1606,121 @@ func (s *MySQLStore) Get(jobID string) (*Job, error) {
 		job.Stderr = ""
 	}
 
+	if idempotencyKey.Valid {
+		job.IdempotencyKey = idempotencyKey.String
+	}
+	if requestHash.Valid {
+		job.RequestHash = requestHash.String
+	}
+	if submitter.Valid {
+		job.Submitter = submitter.String
+	}
+	if callbackURL.Valid {
+		job.CallbackURL = callbackURL.String
+	}
+	if webhookID.Valid {
+		job.WebhookID = webhookID.String
+	}
+	if startedAt.Valid {
+		t := startedAt.Time
+		job.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time
+		job.FinishedAt = &t
+	}
+	if outputFiles.Valid {
+		job.OutputFiles = decodeOutputFiles(outputFiles.String)
+	}
+	if inputs.Valid {
+		job.Inputs = decodeInputs(inputs.String)
+	}
+	if inputSHA256.Valid {
+		job.InputSHA256 = inputSHA256.String
+	}
+	if outputFile.Valid {
+		job.Output = decodeOutputFile(outputFile.String)
+	}
+	if progress.Valid {
+		job.Progress = decodeProgress(progress.String)
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		job.ExitCode = &code
+	}
+	if termSignal.Valid {
+		job.Signal = termSignal.String
+	}
+	if wallTimeMs.Valid {
+		job.WallTimeMs = &wallTimeMs.Int64
+	}
+	if userCPUMs.Valid {
+		job.UserCPUMs = &userCPUMs.Int64
+	}
+	if systemCPUMs.Valid {
+		job.SystemCPUMs = &systemCPUMs.Int64
+	}
+	if maxRSSBytes.Valid {
+		job.MaxRSSBytes = &maxRSSBytes.Int64
+	}
+	if timeoutSec.Valid {
+		job.TimeoutSec = int(timeoutSec.Int64)
+	}
+	if reason.Valid {
+		job.Reason = reason.String
+	}
+	if argv.Valid {
+		job.Argv = decodeArgv(argv.String)
+	}
+	if env.Valid {
+		job.Env = decodeStringMap(env.String, "env")
+	}
+	if workingDir.Valid {
+		job.WorkingDir = workingDir.String
+	}
+	if template.Valid {
+		job.Template = template.String
+	}
+	if params.Valid {
+		job.Params = decodeStringMap(params.String, "params")
+	}
+	if forwardAsync.Valid {
+		job.ForwardAsync = decodeForwardAsync(forwardAsync.String)
+	}
+	if forwardResponse.Valid {
+		job.ForwardResponse = decodeForwardResponse(forwardResponse.String)
+	}
+	if forwardGRPC.Valid {
+		job.ForwardGRPC = decodeForwardGRPC(forwardGRPC.String)
+	}
+	if assignedAt.Valid {
+		t := assignedAt.Time
+		job.AssignedAt = &t
+	}
+	// Command jobs stored before the shell column were all submitted to run through a shell
+	job.Shell = shell.Bool || (!shell.Valid && job.Command != "")
+
 	return &job, nil
 }
 
+// GetByIdempotencyKey retrieves the job the submitter created with the given idempotency key
+func (s *MySQLStore) GetByIdempotencyKey(submitter, key string) (*Job, error) {
+	if key == "" {
+		return nil, ErrJobNotFound
+	}
+
+	var jobID string
+	err := s.db.QueryRow(`SELECT job_id FROM jobs WHERE submitter = ? AND idempotency_key = ?`, submitter, key).Scan(&jobID)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by idempotency key: %w", err)
+	}
+
+	return s.Get(jobID)
+}
+
 // UpdateStatus updates the job status (with transition validation)
 func (s *MySQLStore) UpdateStatus(jobID string, newStatus Status) error {
 	if !newStatus.IsValid() {
@@ -920,8 +1737,8 @@ func (s *MySQLStore) UpdateStatus(jobID string, newStatus Status) error {
 		return fmt.Errorf("%w: cannot transition from %s to %s", ErrInvalidTransition, job.Status, newStatus)
 	}
 
-	query := `UPDATE jobs SET status = ? WHERE job_id = ?`
-	_, err = s.db.Exec(query, string(newStatus), jobID)
+	query, args := statusUpdateQuery(jobID, newStatus, time.Now().UTC())
+	_, err = s.db.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
 	}
@@ -982,23 +1799,111 @@ func (s *MySQLStore) UpdateMessage(jobID string, message string) error {
 	return nil
 }
 
+// UpdateOutputFiles records the output manifest for a job
+func (s *MySQLStore) UpdateOutputFiles(jobID string, files []OutputFile) error {
+	query := `UPDATE jobs SET output_files = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeOutputFiles(files), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update output files: %w", err)
+	}
+	return nil
+}
+
+// UpdateOutputFile records the verified primary output for a job
+func (s *MySQLStore) UpdateOutputFile(jobID string, file *OutputFile) error {
+	query := `UPDATE jobs SET output_file = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeOutputFile(file), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update output file: %w", err)
+	}
+	return nil
+}
+
+// UpdateProcessUsage records the exit status and resource usage of a job's process
+func (s *MySQLStore) UpdateProcessUsage(jobID string, usage ProcessUsage) error {
+	query := `UPDATE jobs SET exit_code = ?, term_signal = ?, wall_time_ms = ?, user_cpu_ms = ?, system_cpu_ms = ?, max_rss_bytes = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, usage.ExitCode, nullableString(usage.Signal), usage.WallTimeMs, usage.UserCPUMs, usage.SystemCPUMs, usage.MaxRSSBytes, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update process usage: %w", err)
+	}
+	return nil
+}
+
+// UpdateForwardResponse records the status code and headers of a forward job's response
+func (s *MySQLStore) UpdateForwardResponse(jobID string, response *ForwardResponse) error {
+	query := `UPDATE jobs SET forward_response = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeForwardResponse(response), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update forward response: %w", err)
+	}
+	return nil
+}
+
+// UpdateReason records why a job ended (e.g. ReasonTimedOut)
+func (s *MySQLStore) UpdateReason(jobID string, reason string) error {
+	query := `UPDATE jobs SET reason = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, nullableString(reason), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update reason: %w", err)
+	}
+	return nil
+}
+
+// TimeOut fails an ASSIGNED or RUNNING attempt with reason TIMED_OUT; it reports whether the job was updated
+func (s *MySQLStore) TimeOut(jobID string, attemptID int, message string) (bool, error) {
+	query, args := timeOutQuery(jobID, attemptID, message, time.Now().UTC())
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to time out job: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to time out job: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UpdateProgress records the latest progress for a job
+func (s *MySQLStore) UpdateProgress(jobID string, progress *Progress) error {
+	query := `UPDATE jobs SET progress = ? WHERE job_id = ?`
+	_, err := s.db.Exec(query, encodeProgress(progress), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update progress: %w", err)
+	}
+	return nil
+}
+
 // List returns a list of jobs (with optional filters)
 func (s *MySQLStore) List(limit int, offset int, status *Status) ([]*Job, error) {
+	return s.ListBySubmitter("", limit, offset, status)
+}
+
+// ListBySubmitter returns a list of jobs created by the given submitter (empty submitter matches all jobs)
+func (s *MySQLStore) ListBySubmitter(submitter string, limit int, offset int, status *Status) ([]*Job, error) {
 	query := `
 	SELECT 
 		job_id, created_at, status, input_bucket, input_key,
 		output_bucket, output_key, output_prefix, output_extension, attempt_id,
 		assigned_agent_id, lease_id, lease_deadline, command, job_type,
 		forward_url, forward_method, forward_headers, forward_body, forward_timeout, input_forward_mode,
-		message, stdout, stderr
+		message, stdout, stderr, idempotency_key, request_hash, submitter, callback_url, webhook_id,
+		started_at, finished_at, output_files, inputs, input_sha256, output_file, progress, exit_code, term_signal, wall_time_ms, user_cpu_ms, system_cpu_ms, max_rss_bytes, timeout_sec, reason, argv, env, working_dir, template, params, forward_async, forward_response, forward_grpc, assigned_at, shell
 	FROM jobs
 	`
 	args := []interface{}{}
 
+	var conditions []string
 	if status != nil {
-		query += " WHERE status = ?"
+		conditions = append(conditions, "status = ?")
 		args = append(args, string(*status))
 	}
+	if submitter != "" {
+		conditions = append(conditions, "submitter = ?")
+		args = append(args, submitter)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
@@ -1026,6 +1931,36 @@ func (s *MySQLStore) List(limit int, offset int, status *Status) ([]*Job, error)
 		var stdout sql.NullString
 		var stderr sql.NullString
 		var outputExtension sql.NullString
+		var idempotencyKey sql.NullString
+		var requestHash sql.NullString
+		var submitter sql.NullString
+		var callbackURL sql.NullString
+		var webhookID sql.NullString
+		var startedAt sql.NullTime
+		var finishedAt sql.NullTime
+		var outputFiles sql.NullString
+		var inputs sql.NullString
+		var inputSHA256 sql.NullString
+		var outputFile sql.NullString
+		var progress sql.NullString
+		var exitCode sql.NullInt64
+		var termSignal sql.NullString
+		var wallTimeMs sql.NullInt64
+		var userCPUMs sql.NullInt64
+		var systemCPUMs sql.NullInt64
+		var maxRSSBytes sql.NullInt64
+		var timeoutSec sql.NullInt64
+		var reason sql.NullString
+		var argv sql.NullString
+		var env sql.NullString
+		var workingDir sql.NullString
+		var template sql.NullString
+		var params sql.NullString
+		var forwardAsync sql.NullString
+		var forwardResponse sql.NullString
+		var forwardGRPC sql.NullString
+		var assignedAt sql.NullTime
+		var shell sql.NullBool
 
 		err := rows.Scan(
 			&job.JobID,
@@ -1052,6 +1987,36 @@ func (s *MySQLStore) List(limit int, offset int, status *Status) ([]*Job, error)
 			&message,
 			&stdout,
 			&stderr,
+			&idempotencyKey,
+			&requestHash,
+			&submitter,
+			&callbackURL,
+			&webhookID,
+			&startedAt,
+			&finishedAt,
+			&outputFiles,
+			&inputs,
+			&inputSHA256,
+			&outputFile,
+			&progress,
+			&exitCode,
+			&termSignal,
+			&wallTimeMs,
+			&userCPUMs,
+			&systemCPUMs,
+			&maxRSSBytes,
+			&timeoutSec,
+			&reason,
+			&argv,
+			&env,
+			&workingDir,
+			&template,
+			&params,
+			&forwardAsync,
+			&forwardResponse,
+			&forwardGRPC,
+			&assignedAt,
+			&shell,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -1119,6 +2084,100 @@ func (s *MySQLStore) List(limit int, offset int, status *Status) ([]*Job, error)
 			job.Stderr = ""
 		}
 
+		if idempotencyKey.Valid {
+			job.IdempotencyKey = idempotencyKey.String
+		}
+		if requestHash.Valid {
+			job.RequestHash = requestHash.String
+		}
+		if submitter.Valid {
+			job.Submitter = submitter.String
+		}
+		if callbackURL.Valid {
+			job.CallbackURL = callbackURL.String
+		}
+		if webhookID.Valid {
+			job.WebhookID = webhookID.String
+		}
+		if startedAt.Valid {
+			t := startedAt.Time
+			job.StartedAt = &t
+		}
+		if finishedAt.Valid {
+			t := finishedAt.Time
+			job.FinishedAt = &t
+		}
+		if outputFiles.Valid {
+			job.OutputFiles = decodeOutputFiles(outputFiles.String)
+		}
+		if inputs.Valid {
+			job.Inputs = decodeInputs(inputs.String)
+		}
+		if inputSHA256.Valid {
+			job.InputSHA256 = inputSHA256.String
+		}
+		if outputFile.Valid {
+			job.Output = decodeOutputFile(outputFile.String)
+		}
+		if progress.Valid {
+			job.Progress = decodeProgress(progress.String)
+		}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			job.ExitCode = &code
+		}
+		if termSignal.Valid {
+			job.Signal = termSignal.String
+		}
+		if wallTimeMs.Valid {
+			job.WallTimeMs = &wallTimeMs.Int64
+		}
+		if userCPUMs.Valid {
+			job.UserCPUMs = &userCPUMs.Int64
+		}
+		if systemCPUMs.Valid {
+			job.SystemCPUMs = &systemCPUMs.Int64
+		}
+		if maxRSSBytes.Valid {
+			job.MaxRSSBytes = &maxRSSBytes.Int64
+		}
+		if timeoutSec.Valid {
+			job.TimeoutSec = int(timeoutSec.Int64)
+		}
+		if reason.Valid {
+			job.Reason = reason.String
+		}
+		if argv.Valid {
+			job.Argv = decodeArgv(argv.String)
+		}
+		if env.Valid {
+			job.Env = decodeStringMap(env.String, "env")
+		}
+		if workingDir.Valid {
+			job.WorkingDir = workingDir.String
+		}
+		if template.Valid {
+			job.Template = template.String
+		}
+		if params.Valid {
+			job.Params = decodeStringMap(params.String, "params")
+		}
+		if forwardAsync.Valid {
+			job.ForwardAsync = decodeForwardAsync(forwardAsync.String)
+		}
+		if forwardResponse.Valid {
+			job.ForwardResponse = decodeForwardResponse(forwardResponse.String)
+		}
+		if forwardGRPC.Valid {
+			job.ForwardGRPC = decodeForwardGRPC(forwardGRPC.String)
+		}
+		if assignedAt.Valid {
+			t := assignedAt.Time
+			job.AssignedAt = &t
+		}
+		// Command jobs stored before the shell column were all submitted to run through a shell
+		job.Shell = shell.Bool || (!shell.Valid && job.Command != "")
+
 		jobs = append(jobs, &job)
 	}
 
@@ -1134,6 +2193,279 @@ func (s *MySQLStore) Close() error {
 	return s.db.Close()
 }
 
+// nullableString maps empty strings to NULL so that optional unique columns
+// (e.g., idempotency_key) do not collide on empty values
+func nullableString(v string) interface{} {
+	if v == "" {
+		return nil
+	}
+	return v
+}
+
+// encodeOutputFiles stores the output manifest as a JSON array (NULL when there are no files)
+func encodeOutputFiles(files []OutputFile) interface{} {
+	if len(files) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(files)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeOutputFiles parses the output_files column; invalid JSON is logged and treated as no files
+func decodeOutputFiles(s string) []OutputFile {
+	if s == "" {
+		return nil
+	}
+	var files []OutputFile
+	if err := json.Unmarshal([]byte(s), &files); err != nil {
+		log.Printf("Warning: invalid output_files JSON: %v", err)
+		return nil
+	}
+	return files
+}
+
+// encodeOutputFile stores the primary output as a JSON object (NULL when there is none)
+func encodeOutputFile(file *OutputFile) interface{} {
+	if file == nil {
+		return nil
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeOutputFile parses the output_file column; invalid JSON is logged and treated as no output
+func decodeOutputFile(s string) *OutputFile {
+	if s == "" {
+		return nil
+	}
+	var file OutputFile
+	if err := json.Unmarshal([]byte(s), &file); err != nil {
+		log.Printf("Warning: invalid output_file JSON: %v", err)
+		return nil
+	}
+	return &file
+}
+
+// encodeProgress stores progress as a JSON object (NULL when there is none)
+func encodeProgress(progress *Progress) interface{} {
+	if progress == nil {
+		return nil
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeProgress parses the progress column; invalid JSON is logged and treated as no progress
+func decodeProgress(s string) *Progress {
+	if s == "" {
+		return nil
+	}
+	var progress Progress
+	if err := json.Unmarshal([]byte(s), &progress); err != nil {
+		log.Printf("Warning: invalid progress JSON: %v", err)
+		return nil
+	}
+	return &progress
+}
+
+// encodeInputs stores named inputs as a JSON object (NULL when there are none)
+func encodeInputs(inputs map[string]Input) interface{} {
+	if len(inputs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeInputs parses the inputs column; invalid JSON is logged and treated as no named inputs
+func decodeInputs(s string) map[string]Input {
+	if s == "" {
+		return nil
+	}
+	var inputs map[string]Input
+	if err := json.Unmarshal([]byte(s), &inputs); err != nil {
+		log.Printf("Warning: invalid inputs JSON: %v", err)
+		return nil
+	}
+	return inputs
+}
+
+// encodeArgv stores the argument vector of an argv command as a JSON array (NULL for shell commands)
+func encodeArgv(argv []string) interface{} {
+	if len(argv) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(argv)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeArgv parses the argv column; invalid JSON is logged and treated as no argv
+func decodeArgv(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var argv []string
+	if err := json.Unmarshal([]byte(s), &argv); err != nil {
+		log.Printf("Warning: invalid argv JSON: %v", err)
+		return nil
+	}
+	return argv
+}
+
+// encodeStringMap stores a string map (env, params) as a JSON object (NULL when it is empty)
+func encodeStringMap(m map[string]string) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeStringMap parses a string map column; invalid JSON is logged and treated as an empty map
+func decodeStringMap(s, column string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		log.Printf("Warning: invalid %s JSON: %v", column, err)
+		return nil
+	}
+	return m
+}
+
+// encodeForwardAsync stores the async forward config as a JSON object (NULL for synchronous forward jobs)
+func encodeForwardAsync(async *ForwardAsync) interface{} {
+	if async == nil {
+		return nil
+	}
+	data, err := json.Marshal(async)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeForwardAsync parses the forward_async column; invalid JSON is logged and treated as synchronous
+func decodeForwardAsync(s string) *ForwardAsync {
+	if s == "" {
+		return nil
+	}
+	var async ForwardAsync
+	if err := json.Unmarshal([]byte(s), &async); err != nil {
+		log.Printf("Warning: invalid forward_async JSON: %v", err)
+		return nil
+	}
+	return &async
+}
+
+// encodeForwardResponse stores a forward response as a JSON object (NULL when there is none)
+func encodeForwardResponse(response *ForwardResponse) interface{} {
+	if response == nil {
+		return nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeForwardResponse parses the forward_response column; invalid JSON is logged and treated as no response
+func decodeForwardResponse(s string) *ForwardResponse {
+	if s == "" {
+		return nil
+	}
+	var response ForwardResponse
+	if err := json.Unmarshal([]byte(s), &response); err != nil {
+		log.Printf("Warning: invalid forward_response JSON: %v", err)
+		return nil
+	}
+	return &response
+}
+
+// encodeForwardGRPC stores the gRPC call of a FORWARD_GRPC job as a JSON object (NULL for other jobs)
+func encodeForwardGRPC(call *ForwardGRPC) interface{} {
+	if call == nil {
+		return nil
+	}
+	data, err := json.Marshal(call)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// decodeForwardGRPC parses the forward_grpc column; invalid JSON is logged and treated as no call
+func decodeForwardGRPC(s string) *ForwardGRPC {
+	if s == "" {
+		return nil
+	}
+	var call ForwardGRPC
+	if err := json.Unmarshal([]byte(s), &call); err != nil {
+		log.Printf("Warning: invalid forward_grpc JSON: %v", err)
+		return nil
+	}
+	return &call
+}
+
+// isDuplicateIdempotencyKey reports whether err is a unique constraint violation on idempotency_key
+// SQLite: "UNIQUE constraint failed: jobs.submitter, jobs.idempotency_key"
+// MySQL: "Error 1062 (23000): Duplicate entry '...' for key 'idx_jobs_submitter_idempotency_key'"
+func isDuplicateIdempotencyKey(err error) bool {
+	errStr := strings.ToLower(err.Error())
+	if !strings.Contains(errStr, "idempotency_key") {
+		return false
+	}
+	return strings.Contains(errStr, "unique constraint") ||
+		strings.Contains(errStr, "duplicate entry") ||
+		strings.Contains(errStr, "1062")
+}
+
+// statusUpdateQuery builds the status UPDATE, recording assigned_at on each assignment,
+// started_at on the first transition to RUNNING and finished_at on the transition to a terminal state
+func statusUpdateQuery(jobID string, newStatus Status, now time.Time) (string, []interface{}) {
+	switch {
+	case newStatus == StatusAssigned:
+		return `UPDATE jobs SET status = ?, assigned_at = ? WHERE job_id = ?`,
+			[]interface{}{string(newStatus), now, jobID}
+	case newStatus == StatusRunning:
+		return `UPDATE jobs SET status = ?, started_at = COALESCE(started_at, ?) WHERE job_id = ?`,
+			[]interface{}{string(newStatus), now, jobID}
+	case newStatus.IsTerminal():
+		return `UPDATE jobs SET status = ?, finished_at = ? WHERE job_id = ?`,
+			[]interface{}{string(newStatus), now, jobID}
+	default:
+		return `UPDATE jobs SET status = ? WHERE job_id = ?`,
+			[]interface{}{string(newStatus), jobID}
+	}
+}
+
+// timeOutQuery builds the conditional UPDATE that fails an attempt still ASSIGNED or RUNNING as TIMED_OUT.
+// The conditions keep a job that just finished (or was reassigned) from having its message and reason overwritten.
+func timeOutQuery(jobID string, attemptID int, message string, now time.Time) (string, []interface{}) {
+	return `UPDATE jobs SET status = ?, reason = ?, message = ?, finished_at = ? WHERE job_id = ? AND attempt_id = ? AND status IN (?, ?)`,
+		[]interface{}{string(StatusFailed), ReasonTimedOut, message, now, jobID, attemptID, string(StatusAssigned), string(StatusRunning)}
+}
+
 // NewStore creates a new store based on the provided configuration
 // If MySQL is configured, it uses MySQL; otherwise, it falls back to SQLite
 func NewStore(cfg *DBConfig) (Store, error) {
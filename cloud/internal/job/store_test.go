@@ -1,9 +1,12 @@
 package job
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -181,6 +184,293 @@ func TestStore_UpdateAssignment(t *testing.T) {
 	}
 }
 
+func TestStore_UpdateOutputFiles(t *testing.T) {
+	store := setupTestStore(t)
+
+	if err := store.Create(&Job{JobID: "job-files", CreatedAt: time.Now(), Status: StatusRunning, AttemptID: 1}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	files := []OutputFile{
+		{Key: "jobs/job-files/1/output.json", Size: 11, SHA256: "aa", ContentType: "application/json"},
+		{Key: "jobs/job-files/1/plots/loss.png", Size: 2048, SHA256: "bb", ContentType: "image/png"},
+	}
+	if err := store.UpdateOutputFiles("job-files", files); err != nil {
+		t.Fatalf("Failed to update output files: %v", err)
+	}
+
+	retrieved, err := store.Get("job-files")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if len(retrieved.OutputFiles) != 2 || retrieved.OutputFiles[1] != files[1] {
+		t.Errorf("OutputFiles = %+v, want %+v", retrieved.OutputFiles, files)
+	}
+
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 || len(jobs[0].OutputFiles) != 2 {
+		t.Errorf("List did not return output files: %v", err)
+	}
+}
+
+func TestStore_Inputs(t *testing.T) {
+	store := setupTestStore(t)
+
+	inputs := map[string]Input{
+		"model":  {Bucket: "lab-models", Key: "resnet/v2.pt"},
+		"config": {Bucket: "lab-main", Key: "configs/run.yaml"},
+	}
+	if err := store.Create(&Job{JobID: "job-inputs", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, Inputs: inputs}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	retrieved, err := store.Get("job-inputs")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if len(retrieved.Inputs) != 2 || retrieved.Inputs["model"] != inputs["model"] || retrieved.Inputs["config"] != inputs["config"] {
+		t.Errorf("Inputs = %+v, want %+v", retrieved.Inputs, inputs)
+	}
+	if names := retrieved.InputNames(); len(names) != 2 || names[0] != "config" || names[1] != "model" {
+		t.Errorf("InputNames = %v", names)
+	}
+}
+
+func TestStore_Checksums(t *testing.T) {
+	store := setupTestStore(t)
+
+	sha := strings.Repeat("ab", 32)
+	inputs := map[string]Input{"model": {Bucket: "lab-models", Key: "resnet/v2.pt", SHA256: sha}}
+	if err := store.Create(&Job{JobID: "job-sums", CreatedAt: time.Now(), Status: StatusRunning, AttemptID: 1,
+		InputBucket: "lab-main", InputKey: "data.csv", InputSHA256: sha, Inputs: inputs}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	output := &OutputFile{Key: "jobs/job-sums/1/output.bin", Size: 6, SHA256: sha, ContentType: "text/plain", ETag: `"e1"`}
+	if err := store.UpdateOutputFile("job-sums", output); err != nil {
+		t.Fatalf("Failed to update output file: %v", err)
+	}
+
+	retrieved, err := store.Get("job-sums")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if retrieved.InputSHA256 != sha || retrieved.Inputs["model"].SHA256 != sha || retrieved.Output == nil || *retrieved.Output != *output {
+		t.Errorf("Unexpected checksums: input %q, inputs %+v, output %+v", retrieved.InputSHA256, retrieved.Inputs, retrieved.Output)
+	}
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 || jobs[0].Output == nil || jobs[0].InputSHA256 != sha {
+		t.Errorf("List did not return checksums: %v", err)
+	}
+}
+
+func TestStore_UpdateProgress(t *testing.T) {
+	store := setupTestStore(t)
+
+	if err := store.Create(&Job{JobID: "job-progress", CreatedAt: time.Now(), Status: StatusRunning, AttemptID: 1}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	retrieved, _ := store.Get("job-progress")
+	if retrieved.Progress != nil {
+		t.Errorf("New job has progress %+v", retrieved.Progress)
+	}
+
+	progress := &Progress{Percent: 40, CurrentStep: 2, TotalSteps: 5, Message: "training", Metrics: json.RawMessage(`{"loss":0.31}`), UpdatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := store.UpdateProgress("job-progress", progress); err != nil {
+		t.Fatalf("Failed to update progress: %v", err)
+	}
+	retrieved, err := store.Get("job-progress")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	p := retrieved.Progress
+	if p == nil || p.Percent != 40 || p.CurrentStep != 2 || p.TotalSteps != 5 || p.Message != "training" ||
+		string(p.Metrics) != `{"loss":0.31}` || !p.UpdatedAt.Equal(progress.UpdatedAt) {
+		t.Errorf("Unexpected progress: %+v", p)
+	}
+}
+
+func TestStore_UpdateProcessUsage(t *testing.T) {
+	store := setupTestStore(t)
+
+	if err := store.Create(&Job{JobID: "job-usage", CreatedAt: time.Now(), Status: StatusRunning, AttemptID: 1}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	retrieved, _ := store.Get("job-usage")
+	if retrieved.ExitCode != nil || retrieved.Signal != "" || retrieved.WallTimeMs != nil || retrieved.MaxRSSBytes != nil {
+		t.Errorf("New job has process usage: %+v", retrieved)
+	}
+
+	exitCode := 137
+	usage := ProcessUsage{ExitCode: &exitCode, WallTimeMs: 61000, UserCPUMs: 58000, SystemCPUMs: 1200, MaxRSSBytes: 3 << 30}
+	if err := store.UpdateProcessUsage("job-usage", usage); err != nil {
+		t.Fatalf("Failed to update process usage: %v", err)
+	}
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("List failed: %v", err)
+	}
+	j := jobs[0]
+	if j.ExitCode == nil || *j.ExitCode != 137 || j.Signal != "" || *j.WallTimeMs != 61000 || *j.UserCPUMs != 58000 ||
+		*j.SystemCPUMs != 1200 || *j.MaxRSSBytes != 3<<30 {
+		t.Errorf("Unexpected process usage: %+v", j)
+	}
+
+	// Killed by a signal: no exit code
+	if err := store.UpdateProcessUsage("job-usage", ProcessUsage{Signal: "SIGKILL", WallTimeMs: 5}); err != nil {
+		t.Fatalf("Failed to update process usage: %v", err)
+	}
+	retrieved, _ = store.Get("job-usage")
+	if retrieved.ExitCode != nil || retrieved.Signal != "SIGKILL" || *retrieved.WallTimeMs != 5 {
+		t.Errorf("Unexpected process usage after kill: exit code %v, signal %q", retrieved.ExitCode, retrieved.Signal)
+	}
+}
+
+func TestStore_TimeoutAndReason(t *testing.T) {
+	store := setupTestStore(t)
+
+	if err := store.Create(&Job{JobID: "job-timeout", CreatedAt: time.Now(), Status: StatusRunning, AttemptID: 1, TimeoutSec: 90}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	retrieved, err := store.Get("job-timeout")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if retrieved.TimeoutSec != 90 || retrieved.Timeout() != 90*time.Second || retrieved.Reason != "" {
+		t.Errorf("Unexpected timeout/reason: %d %q", retrieved.TimeoutSec, retrieved.Reason)
+	}
+
+	if err := store.UpdateReason("job-timeout", ReasonTimedOut); err != nil {
+		t.Fatalf("Failed to update reason: %v", err)
+	}
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("List failed: %v", err)
+	}
+	if jobs[0].Reason != ReasonTimedOut || jobs[0].TimeoutSec != 90 {
+		t.Errorf("Unexpected timeout/reason after update: %d %q", jobs[0].TimeoutSec, jobs[0].Reason)
+	}
+
+	// Jobs stored before timeouts existed fall back to the default
+	if (&Job{}).Timeout() != DefaultTimeoutSec*time.Second {
+		t.Errorf("Timeout() of a job without timeout_sec = %v", (&Job{}).Timeout())
+	}
+}
+
+func TestStore_Argv(t *testing.T) {
+	store := setupTestStore(t)
+
+	argv := []string{"python", "train.py", "--data", "{input:data}", "it's a file"}
+	env := map[string]string{"CUDA_VISIBLE_DEVICES": "0,1", "OUT": "{output_dir}"}
+	if err := store.Create(&Job{JobID: "job-argv", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, Argv: argv, Env: env, WorkingDir: "repo/src"}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if err := store.Create(&Job{JobID: "job-shell", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, Command: "echo hi", Shell: true}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	// Command jobs stored before the shell column read as shell jobs
+	if err := store.Create(&Job{JobID: "job-legacy", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, Command: "echo old", Shell: true}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if _, err := store.(*SQLiteStore).db.Exec(`UPDATE jobs SET shell = NULL WHERE job_id = 'job-legacy'`); err != nil {
+		t.Fatalf("Failed to clear shell: %v", err)
+	}
+	if legacy, err := store.Get("job-legacy"); err != nil || !legacy.Shell {
+		t.Errorf("Legacy command job: %+v, %v", legacy, err)
+	}
+
+	retrieved, err := store.Get("job-argv")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if !reflect.DeepEqual(retrieved.Argv, argv) || !reflect.DeepEqual(retrieved.Env, env) || retrieved.WorkingDir != "repo/src" || retrieved.Command != "" {
+		t.Errorf("Unexpected argv job: argv %q, env %v, working_dir %q, command %q", retrieved.Argv, retrieved.Env, retrieved.WorkingDir, retrieved.Command)
+	}
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 3 {
+		t.Fatalf("List failed: %v", err)
+	}
+	for _, j := range jobs {
+		if j.JobID == "job-shell" && (j.Argv != nil || j.Env != nil || j.WorkingDir != "" || !j.Shell) {
+			t.Errorf("Shell job has argv %q, env %v, working_dir %q, shell %v", j.Argv, j.Env, j.WorkingDir, j.Shell)
+		}
+		if j.JobID == "job-argv" && j.Shell {
+			t.Error("Argv job has shell set")
+		}
+	}
+}
+
+func TestStore_Template(t *testing.T) {
+	store := setupTestStore(t)
+
+	params := map[string]string{"size": "640x480", "quality": "90"}
+	if err := store.Create(&Job{JobID: "job-template", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, Template: "resize", Params: params}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("List failed: %v", err)
+	}
+	if jobs[0].Template != "resize" || !reflect.DeepEqual(jobs[0].Params, params) {
+		t.Errorf("Unexpected template job: template %q, params %v", jobs[0].Template, jobs[0].Params)
+	}
+}
+
+func TestStore_ForwardAsync(t *testing.T) {
+	store := setupTestStore(t)
+
+	async := &ForwardAsync{StatusURL: "http://127.0.0.1:8000/tasks/{task_id}", PollIntervalSec: 2, SucceededStates: []string{"done"}}
+	if err := store.Create(&Job{JobID: "job-async", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, JobType: JobTypeForwardHTTP, ForwardURL: "http://127.0.0.1:8000/tasks", ForwardAsync: async}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if err := store.Create(&Job{JobID: "job-sync", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	j, err := store.Get("job-async")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(j.ForwardAsync, async) {
+		t.Errorf("Unexpected forward_async: %+v", j.ForwardAsync)
+	}
+	if j, err := store.Get("job-sync"); err != nil || j.ForwardAsync != nil {
+		t.Errorf("Synchronous job: forward_async %+v, err %v", j.ForwardAsync, err)
+	}
+
+	response := &ForwardResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "image/png"}}
+	if err := store.UpdateForwardResponse("job-async", response); err != nil {
+		t.Fatalf("UpdateForwardResponse failed: %v", err)
+	}
+	if j, err := store.Get("job-async"); err != nil || !reflect.DeepEqual(j.ForwardResponse, response) {
+		t.Errorf("Forward response: %+v, err %v", j.ForwardResponse, err)
+	}
+}
+
+func TestStore_ForwardGRPC(t *testing.T) {
+	store := setupTestStore(t)
+
+	call := &ForwardGRPC{
+		Target:       "127.0.0.1:50051",
+		Method:       "model.v1.Predictor/Predict",
+		RequestProto: []byte{0x0a, 0x03, 'c', 'a', 't'},
+		Metadata:     map[string]string{"x-tenant": "lab"},
+	}
+	if err := store.Create(&Job{JobID: "job-grpc", CreatedAt: time.Now(), Status: StatusPending, AttemptID: 1, JobType: JobTypeForwardGRPC, ForwardGRPC: call}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	j, err := store.Get("job-grpc")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if j.JobType != JobTypeForwardGRPC || !reflect.DeepEqual(j.ForwardGRPC, call) {
+		t.Errorf("Unexpected job type %s, forward_grpc %+v", j.JobType, j.ForwardGRPC)
+	}
+	jobs, err := store.List(10, 0, nil)
+	if err != nil || len(jobs) != 1 || !reflect.DeepEqual(jobs[0].ForwardGRPC, call) {
+		t.Errorf("List: %v, err %v", jobs, err)
+	}
+}
+
 func TestStore_List(t *testing.T) {
 	store := setupTestStore(t)
 
@@ -298,3 +588,219 @@ func TestStore_GetNotFound(t *testing.T) {
 		t.Errorf("Get() error = %v, want ErrJobNotFound", err)
 	}
 }
+
+func TestStore_IdempotencyKey(t *testing.T) {
+	store := setupTestStore(t)
+
+	newJob := func(id, key string) *Job {
+		return &Job{
+			JobID:          id,
+			CreatedAt:      time.Now(),
+			Status:         StatusPending,
+			OutputBucket:   "output-bucket",
+			AttemptID:      1,
+			IdempotencyKey: key,
+			RequestHash:    "hash-" + id,
+		}
+	}
+
+	if err := store.Create(newJob("job-a", "key-1")); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Same key must be rejected by the uniqueness constraint
+	err := store.Create(newJob("job-b", "key-1"))
+	if !errors.Is(err, ErrDuplicateIdempotencyKey) {
+		t.Errorf("Create() with duplicate key error = %v, want ErrDuplicateIdempotencyKey", err)
+	}
+
+	// Jobs without a key must not collide with each other
+	if err := store.Create(newJob("job-c", "")); err != nil {
+		t.Fatalf("Failed to create job without key: %v", err)
+	}
+	if err := store.Create(newJob("job-d", "")); err != nil {
+		t.Fatalf("Failed to create second job without key: %v", err)
+	}
+
+	// Keys are scoped to the submitter: another submitter may reuse the key
+	other := newJob("job-e", "key-1")
+	other.Submitter = "other"
+	if err := store.Create(other); err != nil {
+		t.Fatalf("Failed to create job with another submitter's key: %v", err)
+	}
+	if err := store.Create(newJob("job-f", "key-2")); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	dup := newJob("job-g", "key-2")
+	if err := store.Create(dup); !errors.Is(err, ErrDuplicateIdempotencyKey) {
+		t.Errorf("Create() with duplicate key and no submitter error = %v, want ErrDuplicateIdempotencyKey", err)
+	}
+	if retrieved, err := store.GetByIdempotencyKey("other", "key-1"); err != nil || retrieved.JobID != "job-e" {
+		t.Errorf("GetByIdempotencyKey(other, key-1) = %v, %v, want job-e", retrieved, err)
+	}
+	if _, err := store.GetByIdempotencyKey("lab", "key-1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetByIdempotencyKey(lab, key-1) error = %v, want ErrJobNotFound", err)
+	}
+
+	retrieved, err := store.GetByIdempotencyKey("", "key-1")
+	if err != nil {
+		t.Fatalf("GetByIdempotencyKey() error = %v", err)
+	}
+	if retrieved.JobID != "job-a" {
+		t.Errorf("JobID = %v, want job-a", retrieved.JobID)
+	}
+	if retrieved.RequestHash != "hash-job-a" {
+		t.Errorf("RequestHash = %v, want hash-job-a", retrieved.RequestHash)
+	}
+
+	if _, err := store.GetByIdempotencyKey("", "missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetByIdempotencyKey(missing) error = %v, want ErrJobNotFound", err)
+	}
+	if _, err := store.GetByIdempotencyKey("", ""); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetByIdempotencyKey(\"\") error = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestStore_UpdateStatusTiming(t *testing.T) {
+	store := setupTestStore(t)
+
+	job := &Job{
+		JobID:        "test-job-timing",
+		CreatedAt:    time.Now(),
+		Status:       StatusPending,
+		OutputBucket: "output-bucket",
+		AttemptID:    1,
+		CallbackURL:  "https://example.com/hook",
+		WebhookID:    "wh-1",
+	}
+	if err := store.Create(job); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	if err := store.UpdateStatus(job.JobID, StatusAssigned); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	retrieved, _ := store.Get(job.JobID)
+	if retrieved.AssignedAt == nil {
+		t.Error("Expected AssignedAt to be set on ASSIGNED")
+	}
+	if retrieved.StartedAt != nil || retrieved.FinishedAt != nil {
+		t.Errorf("Expected no timing before RUNNING, got started=%v finished=%v", retrieved.StartedAt, retrieved.FinishedAt)
+	}
+	if retrieved.CallbackURL != job.CallbackURL || retrieved.WebhookID != job.WebhookID {
+		t.Errorf("Callback fields = %q/%q, want %q/%q", retrieved.CallbackURL, retrieved.WebhookID, job.CallbackURL, job.WebhookID)
+	}
+
+	if err := store.UpdateStatus(job.JobID, StatusRunning); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	retrieved, _ = store.Get(job.JobID)
+	if retrieved.StartedAt == nil {
+		t.Fatal("Expected StartedAt to be set on RUNNING")
+	}
+	if retrieved.FinishedAt != nil {
+		t.Errorf("Expected FinishedAt to be unset while RUNNING, got %v", retrieved.FinishedAt)
+	}
+
+	if err := store.UpdateStatus(job.JobID, StatusSucceeded); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	retrieved, _ = store.Get(job.JobID)
+	if retrieved.FinishedAt == nil {
+		t.Fatal("Expected FinishedAt to be set on SUCCEEDED")
+	}
+	if retrieved.FinishedAt.Before(*retrieved.StartedAt) {
+		t.Errorf("FinishedAt %v is before StartedAt %v", retrieved.FinishedAt, retrieved.StartedAt)
+	}
+}
+
+func TestStore_TimeOut(t *testing.T) {
+	store := setupTestStore(t)
+
+	create := func(id string, statuses ...Status) {
+		t.Helper()
+		if err := store.Create(&Job{JobID: id, CreatedAt: time.Now(), Status: StatusPending, OutputBucket: "output-bucket", AttemptID: 1}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		for _, status := range statuses {
+			if err := store.UpdateStatus(id, status); err != nil {
+				t.Fatalf("Failed to update status to %s: %v", status, err)
+			}
+		}
+	}
+	create("job-assigned", StatusAssigned)
+	create("job-running", StatusAssigned, StatusRunning)
+	create("job-succeeded", StatusAssigned, StatusRunning, StatusSucceeded)
+	if err := store.UpdateMessage("job-succeeded", "done"); err != nil {
+		t.Fatalf("Failed to update message: %v", err)
+	}
+
+	for _, id := range []string{"job-assigned", "job-running"} {
+		// Another attempt is left alone
+		if updated, err := store.TimeOut(id, 2, "timed out"); err != nil || updated {
+			t.Errorf("TimeOut(%s, attempt 2) = %v, %v, want false", id, updated, err)
+		}
+		if updated, err := store.TimeOut(id, 1, "timed out"); err != nil || !updated {
+			t.Fatalf("TimeOut(%s) = %v, %v, want true", id, updated, err)
+		}
+		j, _ := store.Get(id)
+		if j.Status != StatusFailed || j.Reason != ReasonTimedOut || j.Message != "timed out" || j.FinishedAt == nil {
+			t.Errorf("%s: status %s, reason %q, message %q, finished %v", id, j.Status, j.Reason, j.Message, j.FinishedAt)
+		}
+	}
+
+	// A job that already finished keeps its status, message and reason
+	if updated, err := store.TimeOut("job-succeeded", 1, "timed out"); err != nil || updated {
+		t.Errorf("TimeOut(job-succeeded) = %v, %v, want false", updated, err)
+	}
+	if j, _ := store.Get("job-succeeded"); j.Status != StatusSucceeded || j.Reason != "" || j.Message != "done" {
+		t.Errorf("Finished job changed: status %s, reason %q, message %q", j.Status, j.Reason, j.Message)
+	}
+}
+
+func TestStore_ListBySubmitter(t *testing.T) {
+	store := setupTestStore(t)
+
+	for i, submitter := range []string{"lab", "lab", "other"} {
+		status := StatusPending
+		if i == 1 {
+			status = StatusSucceeded
+		}
+		j := &Job{
+			JobID:        "job-sub-" + intToString(i),
+			CreatedAt:    time.Now().Add(time.Duration(i) * time.Second),
+			Status:       status,
+			OutputBucket: "bucket",
+			AttemptID:    1,
+			Submitter:    submitter,
+		}
+		if err := store.Create(j); err != nil {
+			t.Fatalf("Failed to create job %s: %v", j.JobID, err)
+		}
+	}
+
+	labJobs, err := store.ListBySubmitter("lab", 10, 0, nil)
+	if err != nil {
+		t.Fatalf("ListBySubmitter() error = %v", err)
+	}
+	if len(labJobs) != 2 {
+		t.Errorf("Expected 2 jobs for lab, got %d", len(labJobs))
+	}
+
+	succeeded := StatusSucceeded
+	labJobs, err = store.ListBySubmitter("lab", 10, 0, &succeeded)
+	if err != nil {
+		t.Fatalf("ListBySubmitter() error = %v", err)
+	}
+	if len(labJobs) != 1 || labJobs[0].JobID != "job-sub-1" {
+		t.Errorf("Expected only job-sub-1, got %d jobs", len(labJobs))
+	}
+
+	allJobs, err := store.ListBySubmitter("", 10, 0, nil)
+	if err != nil {
+		t.Fatalf("ListBySubmitter() error = %v", err)
+	}
+	if len(allJobs) != 3 {
+		t.Errorf("Expected 3 jobs with empty submitter filter, got %d", len(allJobs))
+	}
+}
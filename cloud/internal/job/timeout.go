@@ -0,0 +1,65 @@
+package job
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// TimeoutConfig holds the limits for job run time
+type TimeoutConfig struct {
+	// Default is the timeout of jobs created without timeout_sec (default: 30m)
+	Default time.Duration
+
+	// Max is the largest timeout_sec a job may request (default: 7d)
+	Max time.Duration
+
+	// Grace is how long the cloud waits past a job's timeout for the agent to report
+	// before it fails the job itself (default: 5m)
+	Grace time.Duration
+
+	// CheckInterval is how often running jobs are checked for overruns (default: 30s)
+	CheckInterval time.Duration
+}
+
+// DefaultTimeoutConfig returns the default job run time limits
+func DefaultTimeoutConfig() *TimeoutConfig {
+	return &TimeoutConfig{
+		Default:       DefaultTimeoutSec * time.Second,
+		Max:           7 * 24 * time.Hour,
+		Grace:         5 * time.Minute,
+		CheckInterval: 30 * time.Second,
+	}
+}
+
+// LoadTimeoutConfig loads job run time limits from environment variables
+//   - JOB_DEFAULT_TIMEOUT_SEC: timeout of jobs created without timeout_sec (default: 1800)
+//   - JOB_MAX_TIMEOUT_SEC: largest timeout_sec accepted on create (default: 604800)
+//   - JOB_TIMEOUT_GRACE_SEC: extra time given to the agent before the cloud fails an overrunning job (default: 300)
+func LoadTimeoutConfig() *TimeoutConfig {
+	cfg := DefaultTimeoutConfig()
+
+	if defaultStr := os.Getenv("JOB_DEFAULT_TIMEOUT_SEC"); defaultStr != "" {
+		if sec, err := strconv.Atoi(defaultStr); err == nil && sec > 0 {
+			cfg.Default = time.Duration(sec) * time.Second
+		}
+	}
+
+	if maxStr := os.Getenv("JOB_MAX_TIMEOUT_SEC"); maxStr != "" {
+		if sec, err := strconv.Atoi(maxStr); err == nil && sec > 0 {
+			cfg.Max = time.Duration(sec) * time.Second
+		}
+	}
+
+	if graceStr := os.Getenv("JOB_TIMEOUT_GRACE_SEC"); graceStr != "" {
+		if sec, err := strconv.Atoi(graceStr); err == nil && sec >= 0 {
+			cfg.Grace = time.Duration(sec) * time.Second
+		}
+	}
+
+	if cfg.Default > cfg.Max {
+		cfg.Default = cfg.Max
+	}
+
+	return cfg
+}
@@ -0,0 +1,70 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Config holds live log limits
+type Config struct {
+	// RingBytes bounds the recent output kept in memory per job for GET /api/jobs/{job_id}/logs (default: 1 MiB)
+	RingBytes int64
+
+	// MaxBytes bounds the archived stdout.log/stderr.log of one attempt; later output is only kept in the ring (default: 1 GiB)
+	MaxBytes int64
+
+	// SpoolDir holds the complete output of running attempts until it is archived to OSS
+	SpoolDir string
+
+	// Retention is how long the ring of a finished attempt stays available after archiving (default: 10m)
+	Retention time.Duration
+
+	// StaleAfter drops the log of an attempt that received no output and did not finish for this long (default: 24h)
+	StaleAfter time.Duration
+}
+
+// DefaultConfig returns the default live log limits
+func DefaultConfig() *Config {
+	return &Config{
+		RingBytes:  1 << 20,
+		MaxBytes:   1 << 30,
+		SpoolDir:   filepath.Join(os.TempDir(), "xiresource-logs"),
+		Retention:  10 * time.Minute,
+		StaleAfter: 24 * time.Hour,
+	}
+}
+
+// LoadConfig loads live log limits from environment variables
+//   - LOG_RING_KB: recent output kept in memory per job, in KiB (default: 1024)
+//   - LOG_MAX_SIZE_MB: maximum archived size per stream and attempt, in MiB (default: 1024)
+//   - LOG_SPOOL_DIR: spool directory (default: {tmp}/xiresource-logs)
+//   - LOG_RETENTION_SEC: how long finished logs stay in memory (default: 600)
+func LoadConfig() *Config {
+	cfg := DefaultConfig()
+
+	if ringStr := os.Getenv("LOG_RING_KB"); ringStr != "" {
+		if ring, err := strconv.ParseInt(ringStr, 10, 64); err == nil && ring > 0 {
+			cfg.RingBytes = ring << 10
+		}
+	}
+
+	if sizeStr := os.Getenv("LOG_MAX_SIZE_MB"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil && size > 0 {
+			cfg.MaxBytes = size << 20
+		}
+	}
+
+	if dir := os.Getenv("LOG_SPOOL_DIR"); dir != "" {
+		cfg.SpoolDir = dir
+	}
+
+	if retentionStr := os.Getenv("LOG_RETENTION_SEC"); retentionStr != "" {
+		if retention, err := strconv.Atoi(retentionStr); err == nil && retention > 0 {
+			cfg.Retention = time.Duration(retention) * time.Second
+		}
+	}
+
+	return cfg
+}
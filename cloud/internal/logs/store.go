@@ -0,0 +1,274 @@
+package logs
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream names an output stream of a command
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// Streams lists the streams in archive order
+var Streams = []Stream{Stdout, Stderr}
+
+// FileName returns the name the stream is archived as under the attempt's output prefix
+func (s Stream) FileName() string {
+	return string(s) + ".log"
+}
+
+func (s Stream) index() int {
+	if s == Stderr {
+		return 1
+	}
+	return 0
+}
+
+// Chunk is a piece of output received from the agent
+type Chunk struct {
+	Seq     int64     `json:"seq"`
+	Stream  Stream    `json:"stream"`
+	Data    string    `json:"data"`                    // Output (invalid UTF-8 replaced)
+	Dropped int64     `json:"dropped_bytes,omitempty"` // Bytes of the stream the agent dropped right before Data
+	Time    time.Time `json:"time"`                    // When the cloud received the chunk
+}
+
+// Tail is the retained output of a job's latest attempt
+type Tail struct {
+	AttemptID int
+	Chunks    []Chunk
+	LastSeq   int64 // Highest seq received
+	Truncated bool  // Output after the requested seq is no longer in memory (see the archived logs)
+	Done      bool  // The attempt's output is complete
+	// Changed is closed when chunks are appended or the attempt's output completes
+	Changed <-chan struct{}
+}
+
+// jobLog is the output of one attempt
+type jobLog struct {
+	attemptID int
+	chunks    []Chunk
+	size      int64 // Bytes of Data in chunks
+	lastSeq   int64
+	eof       bool // The agent sent its last chunk
+	finished  bool // Archived (or abandoned); no more chunks are accepted
+	spool     [2]*os.File
+	spooled   [2]int64 // Bytes written to spool
+	unspooled [2]bool  // Spooling stopped (MaxBytes reached or a write failed); later output is not archived
+	updated   time.Time
+	changed   chan struct{}
+}
+
+// Store keeps the recent output of running jobs in memory (a ring of at most Config.RingBytes per job)
+// and spools the complete output of each attempt to disk until it is archived.
+// It is not shared across server instances.
+type Store struct {
+	config *Config
+	mu     sync.Mutex
+	jobs   map[string]*jobLog
+}
+
+// NewStore creates a log store
+func NewStore(config *Config) *Store {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Store{
+		config: config,
+		jobs:   make(map[string]*jobLog),
+	}
+}
+
+// Append adds a chunk of a job attempt and returns the highest seq received for it.
+// Chunks with a seq already received are ignored. A chunk of a newer attempt discards the
+// output of the previous one; chunks of older or finished attempts are ignored.
+func (s *Store) Append(jobID string, attemptID int, seq int64, stream Stream, data []byte, dropped int64, eof bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.jobs[jobID]
+	if l != nil && l.attemptID < attemptID {
+		l.discard()
+		l = nil
+	}
+	if l == nil {
+		s.sweep()
+		l = &jobLog{attemptID: attemptID, changed: make(chan struct{})}
+		s.jobs[jobID] = l
+	}
+	if l.attemptID != attemptID || l.finished || seq <= l.lastSeq {
+		return l.lastSeq
+	}
+
+	l.lastSeq = seq
+	l.updated = time.Now()
+	if len(data) > 0 || dropped > 0 {
+		s.spool(jobID, l, stream, data)
+		chunk := Chunk{
+			Seq:     seq,
+			Stream:  stream,
+			Data:    strings.ToValidUTF8(string(data), "\uFFFD"),
+			Dropped: dropped,
+			Time:    l.updated,
+		}
+		l.chunks = append(l.chunks, chunk)
+		l.size += int64(len(chunk.Data))
+		for l.size > s.config.RingBytes && len(l.chunks) > 1 {
+			l.size -= int64(len(l.chunks[0].Data))
+			l.chunks = l.chunks[1:]
+		}
+	}
+	if eof {
+		l.eof = true
+	}
+	l.notify()
+	return l.lastSeq
+}
+
+// spool appends output to the attempt's spool file of the stream
+func (s *Store) spool(jobID string, l *jobLog, stream Stream, data []byte) {
+	i := stream.index()
+	if len(data) == 0 || l.unspooled[i] {
+		return
+	}
+	if l.spooled[i]+int64(len(data)) > s.config.MaxBytes {
+		log.Printf("Warning: %s of job %s (attempt %d) exceeds %d bytes, later output is not archived", stream, jobID, l.attemptID, s.config.MaxBytes)
+		l.unspooled[i] = true
+		return
+	}
+	if l.spool[i] == nil {
+		if err := os.MkdirAll(s.config.SpoolDir, 0o700); err != nil {
+			log.Printf("Failed to create log spool directory: %v", err)
+			l.unspooled[i] = true
+			return
+		}
+		f, err := os.CreateTemp(s.config.SpoolDir, fmt.Sprintf("%s-%d-%s-*.log", jobID, l.attemptID, stream))
+		if err != nil {
+			log.Printf("Failed to create log spool file for job %s: %v", jobID, err)
+			l.unspooled[i] = true
+			return
+		}
+		l.spool[i] = f
+	}
+	if _, err := l.spool[i].Write(data); err != nil {
+		log.Printf("Failed to spool %s of job %s: %v", stream, jobID, err)
+		l.unspooled[i] = true
+		return
+	}
+	l.spooled[i] += int64(len(data))
+}
+
+// Tail returns the retained chunks of the job's latest attempt with a seq above after.
+// ok is false if no output of the job is known.
+func (s *Store) Tail(jobID string, after int64) (tail Tail, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.jobs[jobID]
+	if l == nil {
+		return Tail{}, false
+	}
+	tail = Tail{
+		AttemptID: l.attemptID,
+		LastSeq:   l.lastSeq,
+		Done:      l.eof || l.finished,
+		Changed:   l.changed,
+	}
+	for i, chunk := range l.chunks {
+		if chunk.Seq > after {
+			tail.Chunks = append([]Chunk(nil), l.chunks[i:]...)
+			break
+		}
+	}
+	// Chunks before the oldest retained one were evicted from the ring (or never arrived)
+	if len(l.chunks) > 0 && l.chunks[0].Seq > after+1 {
+		tail.Truncated = true
+	}
+	return tail, true
+}
+
+// ArchiveFunc stores the complete output of a stream (size bytes read from r)
+type ArchiveFunc func(stream Stream, r io.Reader, size int64) error
+
+// Finish completes a job attempt's output: no more chunks are accepted, and archive is called with the
+// spooled output of each stream that has any (archive may be nil to discard it). The ring stays
+// available for Config.Retention. Finishing an unknown or older attempt does nothing.
+func (s *Store) Finish(jobID string, attemptID int, archive ArchiveFunc) error {
+	s.mu.Lock()
+	l := s.jobs[jobID]
+	if l == nil || l.attemptID != attemptID || l.finished {
+		s.mu.Unlock()
+		return nil
+	}
+	l.finished = true
+	l.updated = time.Now()
+	spool, spooled := l.spool, l.spooled
+	l.spool = [2]*os.File{}
+	l.notify()
+	s.mu.Unlock()
+
+	var errs []string
+	for _, stream := range Streams {
+		f := spool[stream.index()]
+		if f == nil {
+			continue
+		}
+		if archive != nil && spooled[stream.index()] > 0 {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", stream, err))
+			} else if err := archive(stream, f, spooled[stream.index()]); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", stream, err))
+			}
+		}
+		removeSpool(f)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to archive logs: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sweep drops finished logs past the retention and logs without output for StaleAfter (s.mu must be held)
+func (s *Store) sweep() {
+	now := time.Now()
+	for jobID, l := range s.jobs {
+		if (l.finished && now.Sub(l.updated) > s.config.Retention) || now.Sub(l.updated) > s.config.StaleAfter {
+			l.discard()
+			delete(s.jobs, jobID)
+		}
+	}
+}
+
+// notify wakes up followers of the log
+func (l *jobLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// discard stops accepting chunks and removes the spool files without archiving them
+func (l *jobLog) discard() {
+	l.finished = true
+	for i, f := range l.spool {
+		if f != nil {
+			removeSpool(f)
+			l.spool[i] = nil
+		}
+	}
+	l.notify()
+}
+
+func removeSpool(f *os.File) {
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		log.Printf("Warning: Failed to remove log spool file %s: %v", f.Name(), err)
+	}
+}
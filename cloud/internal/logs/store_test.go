@@ -0,0 +1,192 @@
+package logs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.SpoolDir = t.TempDir()
+	cfg.RingBytes = 10
+	return NewStore(cfg)
+}
+
+func TestStore_AppendAndTail(t *testing.T) {
+	s := newTestStore(t)
+
+	if _, ok := s.Tail("job-1", 0); ok {
+		t.Fatal("Tail of an unknown job should not be ok")
+	}
+
+	if acked := s.Append("job-1", 1, 1, Stdout, []byte("hello\n"), 0, false); acked != 1 {
+		t.Errorf("acked = %d, want 1", acked)
+	}
+	tail, ok := s.Tail("job-1", 0)
+	if !ok || tail.AttemptID != 1 || len(tail.Chunks) != 1 || tail.Chunks[0].Data != "hello\n" || tail.Done || tail.Truncated {
+		t.Fatalf("Tail = %+v, %v", tail, ok)
+	}
+
+	// The follower is woken up by the next chunk
+	changed := tail.Changed
+	s.Append("job-1", 1, 2, Stderr, []byte("oops\n"), 3, false)
+	select {
+	case <-changed:
+	default:
+		t.Error("Changed not closed after Append")
+	}
+
+	// Duplicates are ignored; a gap is accepted
+	if acked := s.Append("job-1", 1, 2, Stderr, []byte("oops\n"), 0, false); acked != 2 {
+		t.Errorf("acked after duplicate = %d, want 2", acked)
+	}
+	s.Append("job-1", 1, 4, Stdout, []byte("end\n"), 0, false)
+
+	// Ring of 10 bytes: "hello\n" (6) is evicted by "oops\n" (5) + "end\n" (4)
+	tail, _ = s.Tail("job-1", 0)
+	if len(tail.Chunks) != 2 || tail.Chunks[0].Seq != 2 || tail.Chunks[0].Dropped != 3 || tail.Chunks[1].Seq != 4 {
+		t.Fatalf("Chunks = %+v", tail.Chunks)
+	}
+	if !tail.Truncated || tail.LastSeq != 4 {
+		t.Errorf("Truncated = %v, LastSeq = %d; want true, 4", tail.Truncated, tail.LastSeq)
+	}
+	tail, _ = s.Tail("job-1", 2)
+	if len(tail.Chunks) != 1 || tail.Chunks[0].Seq != 4 || tail.Truncated {
+		t.Errorf("Tail after 2 = %+v", tail)
+	}
+
+	// eof completes the output
+	s.Append("job-1", 1, 5, Stdout, nil, 0, true)
+	if tail, _ = s.Tail("job-1", 4); !tail.Done || len(tail.Chunks) != 0 || tail.LastSeq != 5 {
+		t.Errorf("Tail after eof = %+v", tail)
+	}
+}
+
+func TestStore_InvalidUTF8(t *testing.T) {
+	s := newTestStore(t)
+	s.Append("job-1", 1, 1, Stdout, []byte("a\xffb"), 0, false)
+	tail, _ := s.Tail("job-1", 0)
+	if tail.Chunks[0].Data != "a�b" {
+		t.Errorf("Data = %q", tail.Chunks[0].Data)
+	}
+}
+
+func TestStore_FinishArchivesCompleteOutput(t *testing.T) {
+	s := newTestStore(t)
+	s.Append("job-1", 1, 1, Stdout, []byte("line 1\n"), 0, false)
+	s.Append("job-1", 1, 2, Stdout, []byte("line 2\n"), 0, false)
+	s.Append("job-1", 1, 3, Stderr, []byte("warning\n"), 0, false)
+
+	archived := make(map[Stream]string)
+	err := s.Finish("job-1", 1, func(stream Stream, r io.Reader, size int64) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != size {
+			t.Errorf("%s: read %d bytes, size %d", stream, len(data), size)
+		}
+		archived[stream] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	// The ring holds 10 bytes, the archive everything
+	if archived[Stdout] != "line 1\nline 2\n" || archived[Stderr] != "warning\n" {
+		t.Errorf("Archived %q", archived)
+	}
+	if entries, _ := os.ReadDir(s.config.SpoolDir); len(entries) != 0 {
+		t.Errorf("Spool files left after Finish: %d", len(entries))
+	}
+
+	// Finished: the ring stays readable, later chunks are ignored
+	if acked := s.Append("job-1", 1, 4, Stdout, []byte("late\n"), 0, false); acked != 3 {
+		t.Errorf("acked after Finish = %d, want 3", acked)
+	}
+	tail, ok := s.Tail("job-1", 0)
+	if !ok || !tail.Done || tail.LastSeq != 3 {
+		t.Errorf("Tail after Finish = %+v, %v", tail, ok)
+	}
+
+	// Finishing twice does nothing
+	if err := s.Finish("job-1", 1, func(Stream, io.Reader, int64) error { return errors.New("called twice") }); err != nil {
+		t.Errorf("Second Finish: %v", err)
+	}
+}
+
+func TestStore_FinishReportsArchiveErrors(t *testing.T) {
+	s := newTestStore(t)
+	s.Append("job-1", 1, 1, Stderr, []byte("x"), 0, false)
+	err := s.Finish("job-1", 1, func(Stream, io.Reader, int64) error { return errors.New("upload failed") })
+	if err == nil || !strings.Contains(err.Error(), "upload failed") {
+		t.Errorf("Finish error = %v", err)
+	}
+	if entries, _ := os.ReadDir(s.config.SpoolDir); len(entries) != 0 {
+		t.Errorf("Spool files left after failed archive: %d", len(entries))
+	}
+}
+
+func TestStore_MaxBytes(t *testing.T) {
+	s := newTestStore(t)
+	s.config.MaxBytes = 8
+	s.Append("job-1", 1, 1, Stdout, []byte("12345"), 0, false)
+	s.Append("job-1", 1, 2, Stdout, []byte("67890"), 0, false)
+	s.Append("job-1", 1, 3, Stdout, []byte("abc"), 0, false)
+
+	var archived string
+	s.Finish("job-1", 1, func(stream Stream, r io.Reader, size int64) error {
+		data, _ := io.ReadAll(r)
+		archived = string(data)
+		return nil
+	})
+	if archived != "12345" {
+		t.Errorf("Archived %q, want output up to MaxBytes", archived)
+	}
+}
+
+func TestStore_NewAttemptReplacesLog(t *testing.T) {
+	s := newTestStore(t)
+	s.Append("job-1", 1, 1, Stdout, []byte("first"), 0, false)
+	s.Append("job-1", 2, 1, Stdout, []byte("second"), 0, false)
+
+	tail, _ := s.Tail("job-1", 0)
+	if tail.AttemptID != 2 || len(tail.Chunks) != 1 || tail.Chunks[0].Data != "second" {
+		t.Errorf("Tail = %+v", tail)
+	}
+	// Chunks of the old attempt are ignored
+	s.Append("job-1", 1, 2, Stdout, []byte("stale"), 0, false)
+	if tail, _ = s.Tail("job-1", 0); len(tail.Chunks) != 1 {
+		t.Errorf("Stale attempt appended: %+v", tail.Chunks)
+	}
+	if entries, _ := os.ReadDir(s.config.SpoolDir); len(entries) != 1 {
+		t.Errorf("Spool files = %d, want only the new attempt's", len(entries))
+	}
+}
+
+func TestStore_Sweep(t *testing.T) {
+	s := newTestStore(t)
+	s.Append("job-1", 1, 1, Stdout, []byte("done"), 0, true)
+	s.Finish("job-1", 1, nil)
+	s.Append("job-2", 1, 1, Stdout, []byte("idle"), 0, false)
+
+	s.mu.Lock()
+	s.jobs["job-1"].updated = time.Now().Add(-s.config.Retention - time.Second)
+	s.jobs["job-2"].updated = time.Now().Add(-s.config.StaleAfter - time.Second)
+	s.mu.Unlock()
+
+	s.Append("job-3", 1, 1, Stdout, []byte("new"), 0, false)
+	for _, id := range []string{"job-1", "job-2"} {
+		if _, ok := s.Tail(id, 0); ok {
+			t.Errorf("%s not swept", id)
+		}
+	}
+	if entries, _ := os.ReadDir(s.config.SpoolDir); len(entries) != 1 {
+		t.Errorf("Spool files = %d, want only job-3's", len(entries))
+	}
+}
@@ -11,16 +11,61 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// Supported values for OSS_PROVIDER / Config.Provider
+const (
+	ProviderCOS   = "cos"   // Tencent Cloud COS (default)
+	ProviderS3    = "s3"    // S3-compatible storage with SigV4 (AWS S3, MinIO, Ceph RGW, Aliyun OSS S3 API)
+	ProviderLocal = "local" // Directory on disk served by cmd/objstore (development, air-gapped labs)
+)
+
+const (
+	defaultLocalBucket  = "local"
+	defaultLocalBaseURL = "http://localhost:9100"
+)
+
 // LoadConfigFromEnv loads OSS configuration from environment variables or .env file
 // It first tries to load from .env file (if exists), then reads from environment variables
-// Environment variables (can be set in .env file or system environment):
+// OSS_PROVIDER selects the provider: "cos" (default), "s3" or "local".
+// Environment variables for cos (can be set in .env file or system environment):
 //   - COS_SECRET_ID: Tencent Cloud SecretID (required)
 //   - COS_SECRET_KEY: Tencent Cloud SecretKey (required)
 //   - COS_BUCKET: COS bucket name (required)
 //   - COS_REGION: COS region (required, e.g., "ap-beijing")
 //   - COS_PRESIGN_TTL_MINUTES: Presigned URL expiration in minutes (optional, default: 15)
 //   - COS_BASE_URL: Custom base URL (optional, auto-generated if not set)
+//
+// Environment variables for s3:
+//   - S3_ACCESS_KEY_ID: Access key ID (required)
+//   - S3_SECRET_ACCESS_KEY: Secret access key (required)
+//   - S3_BUCKET: Bucket name (required)
+//   - S3_REGION: Signing region (optional, default: "us-east-1")
+//   - S3_ENDPOINT: Endpoint URL (optional, e.g., "http://minio.lab:9000"; default: AWS S3 for the region)
+//   - S3_FORCE_PATH_STYLE: "true" for {endpoint}/{bucket}/{key} URLs (optional, default: true if S3_ENDPOINT is set)
+//   - S3_PRESIGN_TTL_MINUTES: Presigned URL expiration in minutes (optional, default: 15, max: 7 days)
+//
+// Environment variables for local (objects served by cmd/objstore):
+//   - LOCAL_OSS_DIR: Directory holding the objects (required, shared with objstore)
+//   - LOCAL_OSS_SECRET: URL signing secret (required, shared with objstore)
+//   - LOCAL_OSS_BASE_URL: objstore URL reachable by agents (optional, default: "http://localhost:9100")
+//   - LOCAL_OSS_BUCKET: Bucket (subdirectory) name (optional, default: "local")
+//   - LOCAL_OSS_PRESIGN_TTL_MINUTES: Signed URL expiration in minutes (optional, default: 15)
 func LoadConfigFromEnv() (Config, error) {
+	loadDotEnv()
+
+	switch provider := strings.ToLower(strings.TrimSpace(os.Getenv("OSS_PROVIDER"))); provider {
+	case "", ProviderCOS:
+		return loadCOSConfigFromEnv()
+	case ProviderS3:
+		return loadS3ConfigFromEnv()
+	case ProviderLocal:
+		return loadLocalConfigFromEnv()
+	default:
+		return Config{}, fmt.Errorf("unsupported OSS_PROVIDER %q (supported: %s, %s, %s)", provider, ProviderCOS, ProviderS3, ProviderLocal)
+	}
+}
+
+// loadDotEnv loads the first .env file found in the current directory or up to 3 parent directories
+func loadDotEnv() {
 	// Try to load .env file (ignore error if file doesn't exist)
 	// First try current directory, then parent directories (up to 3 levels)
 	// This allows .env file to be in cloud/ or project root
@@ -37,6 +82,10 @@ func LoadConfigFromEnv() (Config, error) {
 			break // Successfully loaded .env file
 		}
 	}
+}
+
+// loadCOSConfigFromEnv reads the COS_* variables (see LoadConfigFromEnv)
+func loadCOSConfigFromEnv() (Config, error) {
 	secretID := os.Getenv("COS_SECRET_ID")
 	secretKey := os.Getenv("COS_SECRET_KEY")
 	bucket := os.Getenv("COS_BUCKET")
@@ -57,6 +106,7 @@ func LoadConfigFromEnv() (Config, error) {
 	}
 
 	config := Config{
+		Provider:  ProviderCOS,
 		SecretID:  secretID,
 		SecretKey: secretKey,
 		Bucket:    bucket,
@@ -64,20 +114,102 @@ func LoadConfigFromEnv() (Config, error) {
 		BaseURL:   baseURL,
 	}
 
-	// Parse TTL from environment
-	if ttlStr := os.Getenv("COS_PRESIGN_TTL_MINUTES"); ttlStr != "" {
-		ttlMinutes, err := strconv.Atoi(ttlStr)
+	ttl, err := presignTTLFromEnv("COS_PRESIGN_TTL_MINUTES")
+	if err != nil {
+		return Config{}, err
+	}
+	config.PresignTTL = ttl
+
+	return config, nil
+}
+
+// loadS3ConfigFromEnv reads the S3_* variables (see LoadConfigFromEnv)
+func loadS3ConfigFromEnv() (Config, error) {
+	config := Config{
+		Provider:  ProviderS3,
+		SecretID:  os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Region:    os.Getenv("S3_REGION"),
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+	}
+
+	if config.SecretID == "" {
+		return Config{}, fmt.Errorf("S3_ACCESS_KEY_ID environment variable is required")
+	}
+	if config.SecretKey == "" {
+		return Config{}, fmt.Errorf("S3_SECRET_ACCESS_KEY environment variable is required")
+	}
+	if config.Bucket == "" {
+		return Config{}, fmt.Errorf("S3_BUCKET environment variable is required")
+	}
+	if config.Region == "" {
+		config.Region = defaultS3Region
+	}
+
+	// Custom endpoints (MinIO, Ceph) usually only support path-style addressing
+	config.PathStyle = config.Endpoint != ""
+	if pathStyle := os.Getenv("S3_FORCE_PATH_STYLE"); pathStyle != "" {
+		v, err := strconv.ParseBool(pathStyle)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid COS_PRESIGN_TTL_MINUTES: %w", err)
-		}
-		if ttlMinutes <= 0 {
-			return Config{}, fmt.Errorf("COS_PRESIGN_TTL_MINUTES must be positive")
+			return Config{}, fmt.Errorf("invalid S3_FORCE_PATH_STYLE: %w", err)
 		}
-		config.PresignTTL = time.Duration(ttlMinutes) * time.Minute
-	} else {
-		// Default to 15 minutes
-		config.PresignTTL = 15 * time.Minute
+		config.PathStyle = v
+	}
+
+	ttl, err := presignTTLFromEnv("S3_PRESIGN_TTL_MINUTES")
+	if err != nil {
+		return Config{}, err
+	}
+	config.PresignTTL = ttl
+
+	return config, nil
+}
+
+// loadLocalConfigFromEnv reads the LOCAL_OSS_* variables (see LoadConfigFromEnv)
+func loadLocalConfigFromEnv() (Config, error) {
+	config := Config{
+		Provider:  ProviderLocal,
+		LocalDir:  os.Getenv("LOCAL_OSS_DIR"),
+		SecretKey: os.Getenv("LOCAL_OSS_SECRET"),
+		BaseURL:   os.Getenv("LOCAL_OSS_BASE_URL"),
+		Bucket:    os.Getenv("LOCAL_OSS_BUCKET"),
+	}
+
+	if config.LocalDir == "" {
+		return Config{}, fmt.Errorf("LOCAL_OSS_DIR environment variable is required")
+	}
+	if config.SecretKey == "" {
+		return Config{}, fmt.Errorf("LOCAL_OSS_SECRET environment variable is required")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = defaultLocalBaseURL
+	}
+	if config.Bucket == "" {
+		config.Bucket = defaultLocalBucket
+	}
+
+	ttl, err := presignTTLFromEnv("LOCAL_OSS_PRESIGN_TTL_MINUTES")
+	if err != nil {
+		return Config{}, err
 	}
+	config.PresignTTL = ttl
 
 	return config, nil
 }
+
+// presignTTLFromEnv parses a presigned URL TTL in minutes (default: 15 minutes)
+func presignTTLFromEnv(name string) (time.Duration, error) {
+	ttlStr := os.Getenv(name)
+	if ttlStr == "" {
+		return 15 * time.Minute, nil
+	}
+	ttlMinutes, err := strconv.Atoi(ttlStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if ttlMinutes <= 0 {
+		return 0, fmt.Errorf("%s must be positive", name)
+	}
+	return time.Duration(ttlMinutes) * time.Minute, nil
+}
@@ -0,0 +1,576 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of local object store URLs
+const (
+	localParamExpires       = "X-Expires"
+	localParamContentType   = "X-Content-Type"
+	localParamContentLength = "X-Content-Length"
+	localParamSignature     = "X-Signature"
+	localParamUploadID      = "X-Upload-Id"
+	localParamPartNumber    = "X-Part-Number"
+)
+
+// localMultipartDir holds in-progress multipart uploads (not a valid bucket name, so never served)
+const localMultipartDir = ".multipart"
+
+var localBucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,62}$`)
+
+// LocalStore keeps objects as files under {root}/{bucket}/{key}
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store rooted at dir (created if missing)
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// path maps bucket/key to a file path, rejecting anything that could escape the bucket directory
+func (s *LocalStore) path(bucket, key string) (string, error) {
+	if !localBucketPattern.MatchString(bucket) {
+		return "", fmt.Errorf("invalid bucket %q", bucket)
+	}
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(key)), nil
+}
+
+// Put writes an object atomically (readers never see a partial file)
+func (s *LocalStore) Put(bucket, key string, r io.Reader) (int64, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+// Open opens an object for reading; os.IsNotExist(err) reports a missing object
+func (s *LocalStore) Open(bucket, key string) (*os.File, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
+
+// Stat returns the size and ETag of an object; os.IsNotExist(err) reports a missing object
+func (s *LocalStore) Stat(bucket, key string) (ObjectInfo, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	return ObjectInfo{Size: info.Size(), ETag: localETag(info)}, nil
+}
+
+// localETag derives an object's ETag from its size and modification time. Objects are only ever
+// replaced by renaming a new file into place, so a changed object gets a new ETag.
+func localETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// Exists reports whether an object exists
+func (s *LocalStore) Exists(bucket, key string) (bool, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// Delete removes an object; deleting a missing object is not an error
+func (s *LocalStore) Delete(bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// multipartPath returns the directory of a multipart upload
+func (s *LocalStore) multipartPath(uploadID string) (string, error) {
+	if len(uploadID) != 32 || strings.Trim(uploadID, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	return filepath.Join(s.root, localMultipartDir, uploadID), nil
+}
+
+// openMultipart returns the directory of an upload of bucket/key; os.IsNotExist(err) reports an unknown upload
+func (s *LocalStore) openMultipart(bucket, key, uploadID string) (string, error) {
+	dir, err := s.multipartPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.ReadFile(filepath.Join(dir, "target"))
+	if err != nil {
+		return "", err
+	}
+	if string(target) != bucket+"/"+key {
+		return "", fmt.Errorf("upload %s is not for %s/%s", uploadID, bucket, key)
+	}
+	return dir, nil
+}
+
+// CreateMultipart starts a multipart upload of bucket/key and returns its upload ID
+func (s *LocalStore) CreateMultipart(bucket, key string) (string, error) {
+	if _, err := s.path(bucket, key); err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+	dir, _ := s.multipartPath(uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "target"), []byte(bucket+"/"+key), 0o644); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// PutPart stores one part of a multipart upload and returns its ETag (quoted MD5, as S3 does)
+func (s *LocalStore) PutPart(bucket, key, uploadID string, partNumber int, r io.Reader) (string, int64, error) {
+	dir, err := s.openMultipart(bucket, key, uploadID)
+	if err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", n, err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	partPath := filepath.Join(dir, fmt.Sprintf("%05d", partNumber))
+	if err := os.WriteFile(partPath+".etag", []byte(etag), 0o644); err != nil {
+		return "", n, err
+	}
+	return etag, n, os.Rename(tmp.Name(), partPath)
+}
+
+// CompleteMultipart writes bucket/key from the listed parts and removes the upload
+func (s *LocalStore) CompleteMultipart(bucket, key, uploadID string, parts []CompletedPart) error {
+	if err := ValidateParts(parts); err != nil {
+		return err
+	}
+	dir, err := s.openMultipart(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		partPath := filepath.Join(dir, fmt.Sprintf("%05d", part.PartNumber))
+		etag, err := os.ReadFile(partPath + ".etag")
+		if err != nil || string(etag) != part.ETag {
+			return fmt.Errorf("part %d was not uploaded with ETag %s", part.PartNumber, part.ETag)
+		}
+		f, err := os.Open(partPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if _, err := s.Put(bucket, key, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipart discards an upload and its parts
+func (s *LocalStore) AbortMultipart(bucket, key, uploadID string) error {
+	dir, err := s.openMultipart(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// localPart identifies a part of a multipart upload in a local object store URL (zero value: whole object)
+type localPart struct {
+	uploadID   string
+	partNumber int
+}
+
+// signLocal computes the HMAC-SHA256 signature of a local object store URL
+func signLocal(secret, method, bucket, key string, expires int64, c UploadConstraints, part localPart) string {
+	contentLength := ""
+	if c.ContentLength > 0 {
+		contentLength = strconv.FormatInt(c.ContentLength, 10)
+	}
+	fields := []string{method, bucket + "/" + key, strconv.FormatInt(expires, 10), c.ContentType, contentLength}
+	if part.uploadID != "" {
+		fields = append(fields, part.uploadID, strconv.Itoa(part.partNumber))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// LocalProvider implements Provider (and TestProvider) on a directory served by cmd/objstore.
+// URLs are {BaseURL}/{bucket}/{key}?X-Expires=...&X-Signature=..., signed with SecretKey.
+type LocalProvider struct {
+	config Config
+	store  *LocalStore
+	base   *url.URL
+	now    func() time.Time
+}
+
+// NewLocalProvider creates a provider that stores objects in config.LocalDir
+func NewLocalProvider(config Config) (Provider, error) {
+	if config.SecretKey == "" {
+		return nil, fmt.Errorf("SecretKey is required to sign URLs")
+	}
+	if config.Bucket == "" {
+		config.Bucket = defaultLocalBucket
+	}
+	if !localBucketPattern.MatchString(config.Bucket) {
+		return nil, fmt.Errorf("invalid Bucket %q", config.Bucket)
+	}
+	if config.PresignTTL == 0 {
+		config.PresignTTL = 15 * time.Minute
+	}
+	base, err := url.Parse(config.BaseURL)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid BaseURL %q: must be the http(s) URL of the object store", config.BaseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	store, err := NewLocalStore(config.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalProvider{config: config, store: store, base: base, now: time.Now}, nil
+}
+
+func (p *LocalProvider) presign(method, key string, c UploadConstraints, part localPart) (string, error) {
+	if _, err := p.store.path(p.config.Bucket, key); err != nil {
+		return "", err
+	}
+	expires := p.now().Add(p.config.PresignTTL).Unix()
+
+	u := *p.base
+	u.Path = u.Path + "/" + p.config.Bucket + "/" + key
+	query := url.Values{}
+	query.Set(localParamExpires, strconv.FormatInt(expires, 10))
+	if c.ContentType != "" {
+		query.Set(localParamContentType, c.ContentType)
+	}
+	if c.ContentLength > 0 {
+		query.Set(localParamContentLength, strconv.FormatInt(c.ContentLength, 10))
+	}
+	if part.uploadID != "" {
+		query.Set(localParamUploadID, part.uploadID)
+		query.Set(localParamPartNumber, strconv.Itoa(part.partNumber))
+	}
+	query.Set(localParamSignature, signLocal(p.config.SecretKey, method, p.config.Bucket, key, expires, c, part))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// GenerateDownloadURL generates a signed GET URL for downloading an object
+func (p *LocalProvider) GenerateDownloadURL(ctx context.Context, key string) (string, error) {
+	return p.presign(http.MethodGet, key, UploadConstraints{}, localPart{})
+}
+
+// GenerateUploadURL generates a signed PUT URL for uploading an object
+func (p *LocalProvider) GenerateUploadURL(ctx context.Context, key string) (string, error) {
+	return p.presign(http.MethodPut, key, UploadConstraints{}, localPart{})
+}
+
+// GenerateConstrainedUploadURL generates a signed PUT URL that only accepts the given Content-Type/Content-Length
+func (p *LocalProvider) GenerateConstrainedUploadURL(ctx context.Context, key string, constraints UploadConstraints) (string, error) {
+	return p.presign(http.MethodPut, key, constraints, localPart{})
+}
+
+// GenerateUploadURLWithPrefix generates a signed PUT URL for uploading to a prefix
+func (p *LocalProvider) GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error) {
+	if prefix == "" {
+		return "", fmt.Errorf("prefix cannot be empty")
+	}
+	if filename == "" {
+		return "", fmt.Errorf("filename cannot be empty")
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return p.GenerateUploadURL(ctx, prefix+filename)
+}
+
+// ObjectExists checks if an object exists in the directory
+func (p *LocalProvider) ObjectExists(ctx context.Context, key string) (bool, error) {
+	return p.store.Exists(p.config.Bucket, key)
+}
+
+// StatObject returns the size and ETag of an object
+func (p *LocalProvider) StatObject(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := p.store.Stat(p.config.Bucket, key)
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return info, err
+}
+
+// PutObject writes an object directly (for test setup)
+func (p *LocalProvider) PutObject(ctx context.Context, key string, data []byte) error {
+	_, err := p.store.Put(p.config.Bucket, key, bytes.NewReader(data))
+	return err
+}
+
+// DeleteObject deletes an object (for test cleanup)
+func (p *LocalProvider) DeleteObject(ctx context.Context, key string) error {
+	return p.store.Delete(p.config.Bucket, key)
+}
+
+// CreateMultipartUpload starts a multipart upload of key (objects are served as application/octet-stream)
+func (p *LocalProvider) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	return p.store.CreateMultipart(p.config.Bucket, key)
+}
+
+// GeneratePartUploadURL generates a signed PUT URL for one part of a multipart upload
+func (p *LocalProvider) GeneratePartUploadURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	if _, err := p.store.multipartPath(uploadID); err != nil {
+		return "", err
+	}
+	if !validPartNumber(partNumber) {
+		return "", fmt.Errorf("part number %d out of range", partNumber)
+	}
+	return p.presign(http.MethodPut, key, UploadConstraints{}, localPart{uploadID: uploadID, partNumber: partNumber})
+}
+
+// CompleteMultipartUpload assembles the object from the uploaded parts
+func (p *LocalProvider) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	return p.store.CompleteMultipart(p.config.Bucket, key, uploadID, parts)
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts
+func (p *LocalProvider) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	return p.store.AbortMultipart(p.config.Bucket, key, uploadID)
+}
+
+// LocalStoreHandler serves the signed URLs generated by LocalProvider: GET/HEAD with a GET signature, PUT with a PUT signature
+type LocalStoreHandler struct {
+	store   *LocalStore
+	secret  string
+	maxSize int64
+	now     func() time.Time
+}
+
+// NewLocalStoreHandler creates a handler for objects under store, verifying signatures with secret.
+// maxSize limits PUT bodies (0: unlimited).
+func NewLocalStoreHandler(store *LocalStore, secret string, maxSize int64) (*LocalStoreHandler, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("secret is required")
+	}
+	return &LocalStoreHandler{store: store, secret: secret, maxSize: maxSize, now: time.Now}, nil
+}
+
+func (h *LocalStoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	signedMethod := r.Method
+	if r.Method == http.MethodHead {
+		signedMethod = http.MethodGet
+	}
+	if signedMethod != http.MethodGet && signedMethod != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get(localParamExpires), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid "+localParamExpires, http.StatusForbidden)
+		return
+	}
+	var constraints UploadConstraints
+	constraints.ContentType = query.Get(localParamContentType)
+	if v := query.Get(localParamContentLength); v != "" {
+		if constraints.ContentLength, err = strconv.ParseInt(v, 10, 64); err != nil || constraints.ContentLength <= 0 {
+			http.Error(w, "Invalid "+localParamContentLength, http.StatusForbidden)
+			return
+		}
+	}
+	var part localPart
+	if part.uploadID = query.Get(localParamUploadID); part.uploadID != "" {
+		if signedMethod != http.MethodPut {
+			http.Error(w, "Parts can only be uploaded", http.StatusForbidden)
+			return
+		}
+		if part.partNumber, err = strconv.Atoi(query.Get(localParamPartNumber)); err != nil || !validPartNumber(part.partNumber) {
+			http.Error(w, "Invalid "+localParamPartNumber, http.StatusForbidden)
+			return
+		}
+	}
+	want := signLocal(h.secret, signedMethod, bucket, key, expires, constraints, part)
+	if !hmac.Equal([]byte(query.Get(localParamSignature)), []byte(want)) {
+		http.Error(w, "Signature does not match", http.StatusForbidden)
+		return
+	}
+	if h.now().Unix() > expires {
+		http.Error(w, "Request has expired", http.StatusForbidden)
+		return
+	}
+
+	if signedMethod == http.MethodPut {
+		h.put(w, r, bucket, key, constraints, part)
+		return
+	}
+
+	f, err := h.store.Open(bucket, key)
+	if os.IsNotExist(err) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("objstore: failed to open %s/%s: %v", bucket, key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// ServeContent also answers If-None-Match and If-Range with the ETag
+	w.Header().Set("ETag", localETag(info))
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+func (h *LocalStoreHandler) put(w http.ResponseWriter, r *http.Request, bucket, key string, c UploadConstraints, part localPart) {
+	if c.ContentType != "" && r.Header.Get("Content-Type") != c.ContentType {
+		http.Error(w, "Content-Type does not match the signed value", http.StatusForbidden)
+		return
+	}
+	if c.ContentLength > 0 && r.ContentLength != c.ContentLength {
+		http.Error(w, "Content-Length does not match the signed value", http.StatusForbidden)
+		return
+	}
+	body := io.Reader(r.Body)
+	if h.maxSize > 0 {
+		if r.ContentLength > h.maxSize {
+			http.Error(w, "Object too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, h.maxSize)
+	}
+
+	if part.uploadID != "" {
+		etag, n, err := h.store.PutPart(bucket, key, part.uploadID, part.partNumber, body)
+		if os.IsNotExist(err) {
+			http.Error(w, "No such upload", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("objstore: failed to write part %d of %s/%s: %v", part.partNumber, bucket, key, err)
+			http.Error(w, "Failed to store part", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("objstore: stored part %d of %s/%s (%d bytes)", part.partNumber, bucket, key, n)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	n, err := h.store.Put(bucket, key, body)
+	if err != nil {
+		log.Printf("objstore: failed to write %s/%s: %v", bucket, key, err)
+		http.Error(w, "Failed to store object", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("objstore: stored %s/%s (%d bytes)", bucket, key, n)
+	if info, err := h.store.Stat(bucket, key); err == nil {
+		w.Header().Set("ETag", info.ETag)
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,252 @@
+package oss
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalProvider(t *testing.T) (*LocalProvider, *LocalStoreHandler, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	handler, err := NewLocalStoreHandler(store, "test-secret", 1024)
+	if err != nil {
+		t.Fatalf("NewLocalStoreHandler failed: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider(Config{
+		Provider:  ProviderLocal,
+		SecretKey: "test-secret",
+		BaseURL:   server.URL,
+		LocalDir:  dir,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return provider.(*LocalProvider), handler, server
+}
+
+func doRequest(t *testing.T, method, rawURL, body string, header http.Header) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, rawURL, strings.NewReader(body))
+	for name := range header {
+		req.Header.Set(name, header.Get(name))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, rawURL, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestLocalProvider_RoundTrip(t *testing.T) {
+	provider, _, _ := newTestLocalProvider(t)
+	ctx := context.Background()
+
+	uploadURL, err := provider.GenerateUploadURL(ctx, "jobs/job-1/1/output.bin")
+	if err != nil {
+		t.Fatalf("GenerateUploadURL failed: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPut, uploadURL, strings.NewReader("result"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+	// The PUT answers with the ETag that StatObject and downloads report
+	info, err := provider.StatObject(ctx, "jobs/job-1/1/output.bin")
+	if err != nil || info.Size != 6 || info.ETag == "" || info.ETag != resp.Header.Get("ETag") {
+		t.Errorf("StatObject = %+v, %v; PUT ETag %q", info, err, resp.Header.Get("ETag"))
+	}
+	if _, err := provider.StatObject(ctx, "jobs/job-1/1/missing.bin"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("StatObject of missing object: %v, want ErrObjectNotFound", err)
+	}
+	data, err := os.ReadFile(filepath.Join(provider.config.LocalDir, "local", "jobs", "job-1", "1", "output.bin"))
+	if err != nil || string(data) != "result" {
+		t.Errorf("Stored object = %q, %v", data, err)
+	}
+
+	downloadURL, err := provider.GenerateDownloadURL(ctx, "jobs/job-1/1/output.bin")
+	if err != nil {
+		t.Fatalf("GenerateDownloadURL failed: %v", err)
+	}
+	if status, body := doRequest(t, http.MethodGet, downloadURL, "", nil); status != http.StatusOK || body != "result" {
+		t.Errorf("GET = %d %q", status, body)
+	}
+	if status, _ := doRequest(t, http.MethodHead, downloadURL, "", nil); status != http.StatusOK {
+		t.Errorf("HEAD status %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodGet, downloadURL, "", http.Header{"If-None-Match": {info.ETag}}); status != http.StatusNotModified {
+		t.Errorf("GET with matching If-None-Match: status %d, want 304", status)
+	}
+	// A download URL does not authorize uploads
+	if status, _ := doRequest(t, http.MethodPut, downloadURL, "x", nil); status != http.StatusForbidden {
+		t.Errorf("PUT with GET signature: status %d, want 403", status)
+	}
+	missing, _ := provider.GenerateDownloadURL(ctx, "jobs/job-1/1/missing.bin")
+	if status, _ := doRequest(t, http.MethodGet, missing, "", nil); status != http.StatusNotFound {
+		t.Errorf("GET missing object: status %d, want 404", status)
+	}
+
+	// Constrained upload: the signed Content-Type and Content-Length must be sent
+	constrained, err := provider.GenerateConstrainedUploadURL(ctx, "inputs/u/data.csv", UploadConstraints{ContentType: "text/csv", ContentLength: 3})
+	if err != nil {
+		t.Fatalf("GenerateConstrainedUploadURL failed: %v", err)
+	}
+	for contentType, want := range map[string]int{"text/csv": http.StatusOK, "text/plain": http.StatusForbidden} {
+		if status, _ := doRequest(t, http.MethodPut, constrained, "a,b", http.Header{"Content-Type": {contentType}}); status != want {
+			t.Errorf("Constrained PUT with %s: status %d, want %d", contentType, status, want)
+		}
+	}
+	if status, _ := doRequest(t, http.MethodPut, constrained, "a,b,c", http.Header{"Content-Type": {"text/csv"}}); status != http.StatusForbidden {
+		t.Errorf("Constrained PUT with wrong length: status %d, want 403", status)
+	}
+
+	// TestProvider operations work on the directory directly
+	var testProvider TestProvider = provider
+	if err := testProvider.PutObject(ctx, "e2e/input.txt", []byte("hello")); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if exists, err := testProvider.ObjectExists(ctx, "e2e/input.txt"); err != nil || !exists {
+		t.Errorf("ObjectExists = %v, %v; want true", exists, err)
+	}
+	if err := testProvider.DeleteObject(ctx, "e2e/input.txt"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if exists, err := testProvider.ObjectExists(ctx, "e2e/input.txt"); err != nil || exists {
+		t.Errorf("ObjectExists after delete = %v, %v; want false", exists, err)
+	}
+}
+
+func TestLocalProvider_Multipart(t *testing.T) {
+	provider, _, _ := newTestLocalProvider(t)
+	ctx := context.Background()
+	var uploader MultipartUploader = provider
+	key := "jobs/job-1/1/model.ckpt"
+
+	uploadID, err := uploader.CreateMultipartUpload(ctx, key, "application/octet-stream")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	// Each part is under the handler's 1024-byte PUT limit; the object is not
+	contents := []string{strings.Repeat("a", 1000), strings.Repeat("b", 500)}
+	var parts []CompletedPart
+	for i, content := range contents {
+		partURL, err := uploader.GeneratePartUploadURL(ctx, key, uploadID, i+1)
+		if err != nil {
+			t.Fatalf("GeneratePartUploadURL failed: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodPut, partURL, strings.NewReader(content))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+			t.Fatalf("Part %d PUT failed: %v %v", i+1, err, resp)
+		}
+		resp.Body.Close()
+		parts = append(parts, CompletedPart{PartNumber: i + 1, ETag: resp.Header.Get("ETag")})
+
+		// A part URL only authorizes its own part of its own upload
+		if status, _ := doRequest(t, http.MethodPut, strings.Replace(partURL, "X-Part-Number=", "X-Part-Number=9", 1), "x", nil); status != http.StatusForbidden {
+			t.Errorf("Tampered part number: status %d, want 403", status)
+		}
+	}
+
+	if err := uploader.CompleteMultipartUpload(ctx, key, uploadID, []CompletedPart{{PartNumber: 1, ETag: `"wrong"`}}); err == nil {
+		t.Error("Complete with a wrong ETag: expected error")
+	}
+	if err := uploader.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(provider.config.LocalDir, "local", "jobs", "job-1", "1", "model.ckpt"))
+	if err != nil || string(data) != contents[0]+contents[1] {
+		t.Errorf("Assembled object has %d bytes, %v", len(data), err)
+	}
+	// The upload is gone once completed
+	if err := uploader.CompleteMultipartUpload(ctx, key, uploadID, parts); err == nil {
+		t.Error("Second complete: expected error")
+	}
+
+	uploadID, _ = uploader.CreateMultipartUpload(ctx, key, "")
+	if err := uploader.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		t.Fatalf("AbortMultipartUpload failed: %v", err)
+	}
+	partURL, _ := uploader.GeneratePartUploadURL(ctx, key, uploadID, 1)
+	if status, _ := doRequest(t, http.MethodPut, partURL, "x", nil); status != http.StatusNotFound {
+		t.Errorf("Part of an aborted upload: status %d, want 404", status)
+	}
+}
+
+func TestLocalStoreHandler_Rejects(t *testing.T) {
+	provider, handler, server := newTestLocalProvider(t)
+	ctx := context.Background()
+	provider.PutObject(ctx, "data.txt", []byte("secret data"))
+
+	downloadURL, _ := provider.GenerateDownloadURL(ctx, "data.txt")
+	cases := map[string]string{
+		"unsigned":         server.URL + "/local/data.txt",
+		"tampered key":     strings.Replace(downloadURL, "/data.txt", "/other.txt", 1),
+		"tampered expires": strings.Replace(downloadURL, "X-Expires=", "X-Expires=9", 1),
+		"other bucket":     strings.Replace(downloadURL, "/local/", "/other/", 1),
+	}
+	for name, rawURL := range cases {
+		if status, _ := doRequest(t, http.MethodGet, rawURL, "", nil); status != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", name, status)
+		}
+	}
+
+	handler.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if status, _ := doRequest(t, http.MethodGet, downloadURL, "", nil); status != http.StatusForbidden {
+		t.Errorf("Expired URL: status %d, want 403", status)
+	}
+	handler.now = time.Now
+
+	uploadURL, _ := provider.GenerateUploadURL(ctx, "big.bin")
+	if status, _ := doRequest(t, http.MethodPut, uploadURL, strings.Repeat("x", 2048), nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized PUT: status %d, want 413", status)
+	}
+
+	for _, key := range []string{"", "../escape", "a/../../b", "/abs", "a//b", `a\b`, "dir/"} {
+		if _, err := provider.GenerateUploadURL(ctx, key); err == nil {
+			t.Errorf("Key %q: expected error", key)
+		}
+	}
+}
+
+func TestLoadConfigFromEnv_Local(t *testing.T) {
+	for _, name := range []string{"LOCAL_OSS_BASE_URL", "LOCAL_OSS_BUCKET", "LOCAL_OSS_PRESIGN_TTL_MINUTES"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("OSS_PROVIDER", "local")
+	t.Setenv("LOCAL_OSS_DIR", t.TempDir())
+	t.Setenv("LOCAL_OSS_SECRET", "")
+
+	if _, err := LoadConfigFromEnv(); err == nil {
+		t.Error("Missing LOCAL_OSS_SECRET: expected error")
+	}
+
+	t.Setenv("LOCAL_OSS_SECRET", "s")
+	config, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv failed: %v", err)
+	}
+	if config.Provider != ProviderLocal || config.Bucket != "local" || config.BaseURL != "http://localhost:9100" || config.PresignTTL != 15*time.Minute {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+	if _, err := NewProvider(config); err != nil {
+		t.Errorf("NewProvider failed: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// MaxMultipartParts is the largest part number S3 and COS accept
+	MaxMultipartParts = 10000
+)
+
+// CompletedPart is an uploaded part of a multipart upload, as reported by the uploader
+type CompletedPart struct {
+	PartNumber int
+	ETag       string // ETag header returned by the part upload
+}
+
+// MultipartUploader is implemented by providers that support multipart uploads with presigned part URLs.
+// The cloud starts and completes uploads with its own credentials; agents only PUT parts to presigned URLs.
+type MultipartUploader interface {
+	// CreateMultipartUpload starts a multipart upload of key and returns its upload ID
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	// GeneratePartUploadURL generates a presigned PUT URL for one part (1..MaxMultipartParts)
+	GeneratePartUploadURL(ctx context.Context, key, uploadID string, partNumber int) (string, error)
+	// CompleteMultipartUpload assembles the object from parts (ascending part numbers)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	// AbortMultipartUpload discards an upload and its parts
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// ValidateParts checks the part list of a CompleteMultipartUpload: non-empty, ascending, in range, with ETags
+func ValidateParts(parts []CompletedPart) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("no parts")
+	}
+	for i, part := range parts {
+		if part.PartNumber < 1 || part.PartNumber > MaxMultipartParts {
+			return fmt.Errorf("part number %d out of range", part.PartNumber)
+		}
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return fmt.Errorf("part numbers must be ascending")
+		}
+		if part.ETag == "" {
+			return fmt.Errorf("part %d has no ETag", part.PartNumber)
+		}
+	}
+	return nil
+}
+
+// validPartNumber reports whether n is a valid part number
+func validPartNumber(n int) bool {
+	return n >= 1 && n <= MaxMultipartParts
+}
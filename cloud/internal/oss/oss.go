@@ -3,9 +3,11 @@ package oss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/tencentyun/cos-go-sdk-v5"
@@ -13,12 +15,30 @@ import (
 
 // Config holds OSS provider configuration
 type Config struct {
-	SecretID   string        // Tencent Cloud SecretID
-	SecretKey  string        // Tencent Cloud SecretKey
+	Provider   string        // ProviderCOS (default), ProviderS3 or ProviderLocal
+	SecretID   string        // Tencent Cloud SecretID (s3: access key ID)
+	SecretKey  string        // Tencent Cloud SecretKey (s3: secret access key; local: URL signing secret)
 	Bucket     string        // COS bucket name
-	Region     string        // COS region (e.g., "ap-beijing")
+	Region     string        // COS region (e.g., "ap-beijing"; s3: signing region, e.g., "us-east-1")
 	PresignTTL time.Duration // Presigned URL expiration (default: 15 minutes)
-	BaseURL    string        // Optional: custom base URL (if empty, auto-generated from bucket+region)
+	BaseURL    string        // Optional: custom base URL (if empty, auto-generated from bucket+region; local: object store URL)
+	Endpoint   string        // s3 only: endpoint URL (e.g., "http://minio.lab:9000"; empty: AWS S3)
+	PathStyle  bool          // s3 only: {endpoint}/{bucket}/{key} instead of {bucket}.{endpoint host}/{key}
+	LocalDir   string        // local only: directory holding {bucket}/{key} files
+}
+
+// NewProvider creates the provider selected by config.Provider
+func NewProvider(config Config) (Provider, error) {
+	switch config.Provider {
+	case "", ProviderCOS:
+		return NewCOSProvider(config)
+	case ProviderS3:
+		return NewS3Provider(config)
+	case ProviderLocal:
+		return NewLocalProvider(config)
+	default:
+		return nil, fmt.Errorf("unsupported OSS provider %q", config.Provider)
+	}
 }
 
 // Provider defines the interface for OSS access operations
@@ -41,6 +61,35 @@ type Provider interface {
 	GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error)
 }
 
+// UploadConstraints are request headers bound into a presigned PUT URL's signature.
+// An upload that sends different values is rejected by OSS.
+type UploadConstraints struct {
+	ContentType   string // Required Content-Type header (empty: not constrained)
+	ContentLength int64  // Required Content-Length in bytes (0: not constrained)
+}
+
+// ConstrainedUploader is implemented by providers that can sign upload headers into a presigned PUT URL
+type ConstrainedUploader interface {
+	// GenerateConstrainedUploadURL generates a presigned PUT URL that only accepts uploads matching the constraints
+	GenerateConstrainedUploadURL(ctx context.Context, key string, constraints UploadConstraints) (string, error)
+}
+
+// ErrObjectNotFound is returned by StatObject for a missing object
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size int64
+	ETag string // ETag as returned by the store (quoted)
+}
+
+// ObjectStatter is implemented by providers that can look up an object's size and ETag (HEAD request).
+// The gateway uses it to confirm reported outputs before a job succeeds.
+type ObjectStatter interface {
+	// StatObject returns the object's size and ETag; errors.Is(err, ErrObjectNotFound) for a missing object
+	StatObject(ctx context.Context, key string) (ObjectInfo, error)
+}
+
 // TestProvider extends Provider with methods needed for e2e testing
 // These methods are only used in test code, not in production agent/cloud code
 type TestProvider interface {
@@ -149,6 +198,102 @@ func (p *COSProvider) GenerateUploadURL(ctx context.Context, key string) (string
 	return presignedURL.String(), nil
 }
 
+// GenerateConstrainedUploadURL generates a presigned PUT URL with Content-Type/Content-Length included in the signature
+func (p *COSProvider) GenerateConstrainedUploadURL(ctx context.Context, key string, constraints UploadConstraints) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("key cannot be empty")
+	}
+
+	header := http.Header{}
+	if constraints.ContentType != "" {
+		header.Set("Content-Type", constraints.ContentType)
+	}
+	if constraints.ContentLength > 0 {
+		header.Set("Content-Length", strconv.FormatInt(constraints.ContentLength, 10))
+	}
+
+	presignedURL, err := p.client.Object.GetPresignedURL(
+		ctx,
+		http.MethodPut,
+		key,
+		p.config.SecretID,
+		p.config.SecretKey,
+		p.config.PresignTTL,
+		&cos.PresignedURLOptions{Header: &header},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate upload URL: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+// CreateMultipartUpload starts a multipart upload of key
+func (p *COSProvider) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("key cannot be empty")
+	}
+	opt := &cos.InitiateMultipartUploadOptions{}
+	if contentType != "" {
+		opt.ObjectPutHeaderOptions = &cos.ObjectPutHeaderOptions{ContentType: contentType}
+	}
+	result, _, err := p.client.Object.InitiateMultipartUpload(ctx, key, opt)
+	if err != nil {
+		return "", fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	return result.UploadID, nil
+}
+
+// GeneratePartUploadURL generates a presigned PUT URL for one part of a multipart upload
+func (p *COSProvider) GeneratePartUploadURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	if key == "" || uploadID == "" {
+		return "", fmt.Errorf("key and upload ID are required")
+	}
+	if !validPartNumber(partNumber) {
+		return "", fmt.Errorf("part number %d out of range", partNumber)
+	}
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("uploadId", uploadID)
+
+	presignedURL, err := p.client.Object.GetPresignedURL(
+		ctx,
+		http.MethodPut,
+		key,
+		p.config.SecretID,
+		p.config.SecretKey,
+		p.config.PresignTTL,
+		&cos.PresignedURLOptions{Query: &query},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate part upload URL: %w", err)
+	}
+	return presignedURL.String(), nil
+}
+
+// CompleteMultipartUpload assembles the object from the uploaded parts
+func (p *COSProvider) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	if err := ValidateParts(parts); err != nil {
+		return err
+	}
+	opt := &cos.CompleteMultipartUploadOptions{Parts: make([]cos.Object, 0, len(parts))}
+	for _, part := range parts {
+		opt.Parts = append(opt.Parts, cos.Object{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	if _, _, err := p.client.Object.CompleteMultipartUpload(ctx, key, uploadID, opt); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts
+func (p *COSProvider) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if _, err := p.client.Object.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
 // GenerateUploadURLWithPrefix generates a presigned PUT URL for uploading to a prefix
 func (p *COSProvider) GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error) {
 	if prefix == "" {
@@ -180,6 +325,22 @@ func (p *COSProvider) ObjectExists(ctx context.Context, key string) (bool, error
 	return exists, nil
 }
 
+// StatObject returns the size and ETag of an object (HEAD request)
+func (p *COSProvider) StatObject(ctx context.Context, key string) (ObjectInfo, error) {
+	if key == "" {
+		return ObjectInfo{}, fmt.Errorf("key cannot be empty")
+	}
+
+	resp, err := p.client.Object.Head(ctx, key, nil)
+	if cos.IsNotFoundError(err) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to head object: %w", err)
+	}
+	return ObjectInfo{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}, nil
+}
+
 // PutObject uploads an object directly (for test setup)
 func (p *COSProvider) PutObject(ctx context.Context, key string, data []byte) error {
 	if key == "" {
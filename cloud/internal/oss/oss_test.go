@@ -2,7 +2,9 @@ package oss
 
 import (
 	"context"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -208,3 +210,38 @@ func TestCOSProvider_DefaultTTL(t *testing.T) {
 		t.Errorf("Expected default TTL of 15 minutes, got %v", cosProvider.config.PresignTTL)
 	}
 }
+
+func TestCOSProvider_GenerateConstrainedUploadURL(t *testing.T) {
+	// Presigning is local, so fake credentials are enough
+	provider, err := NewCOSProvider(Config{
+		SecretID:  "id",
+		SecretKey: "key",
+		Bucket:    "bucket-1250000000",
+		Region:    "ap-beijing",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create COS provider: %v", err)
+	}
+
+	uploader, ok := provider.(ConstrainedUploader)
+	if !ok {
+		t.Fatal("COSProvider should implement ConstrainedUploader")
+	}
+
+	rawURL, err := uploader.GenerateConstrainedUploadURL(context.Background(), "inputs/upload-1/data.csv", UploadConstraints{
+		ContentType:   "text/csv",
+		ContentLength: 1024,
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate constrained upload URL: %v", err)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Invalid URL: %v", err)
+	}
+	headerList := u.Query().Get("q-header-list")
+	if !strings.Contains(headerList, "content-length") || !strings.Contains(headerList, "content-type") {
+		t.Errorf("q-header-list = %q, want content-length and content-type signed", headerList)
+	}
+}
@@ -0,0 +1,194 @@
+package oss
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// BucketProvider is implemented by providers that serve more than one bucket (see Registry)
+type BucketProvider interface {
+	Provider
+	// DefaultBucket returns the bucket used when a job does not name one
+	DefaultBucket() string
+	// Bucket returns the provider for a configured bucket ("" selects the default bucket).
+	// Buckets that are not configured are rejected.
+	Bucket(name string) (Provider, error)
+}
+
+// ForBucket returns the provider that signs URLs for bucket.
+// A provider that is not a BucketProvider only knows its own bucket and is returned as-is.
+func ForBucket(p Provider, bucket string) (Provider, error) {
+	if bp, ok := p.(BucketProvider); ok {
+		return bp.Bucket(bucket)
+	}
+	return p, nil
+}
+
+// BucketConfig describes an additional bucket in OSS_BUCKETS_CONFIG.
+// Empty fields are inherited from the default bucket's Config when the provider is the same.
+type BucketConfig struct {
+	Name              string `json:"name"`
+	Provider          string `json:"provider,omitempty"`   // ProviderCOS, ProviderS3 or ProviderLocal
+	Region            string `json:"region,omitempty"`     // COS/S3 region
+	SecretID          string `json:"secret_id,omitempty"`  // COS SecretID / S3 access key ID
+	SecretKey         string `json:"secret_key,omitempty"` // COS SecretKey / S3 secret access key / local signing secret
+	BaseURL           string `json:"base_url,omitempty"`   // COS custom base URL / local object store URL
+	Endpoint          string `json:"endpoint,omitempty"`   // S3 endpoint URL
+	PathStyle         *bool  `json:"path_style,omitempty"` // S3 path-style addressing
+	PresignTTLMinutes int    `json:"presign_ttl_minutes,omitempty"`
+}
+
+// config resolves the bucket's Config, inheriting unset fields from base
+func (b BucketConfig) config(base Config) Config {
+	config := Config{
+		Provider:   b.Provider,
+		SecretID:   b.SecretID,
+		SecretKey:  b.SecretKey,
+		Bucket:     b.Name,
+		Region:     b.Region,
+		BaseURL:    b.BaseURL,
+		Endpoint:   b.Endpoint,
+		PresignTTL: time.Duration(b.PresignTTLMinutes) * time.Minute,
+	}
+	if config.Provider == "" {
+		config.Provider = base.Provider
+	}
+	if config.PresignTTL == 0 {
+		config.PresignTTL = base.PresignTTL
+	}
+	// As with S3_FORCE_PATH_STYLE: custom endpoints default to path-style addressing
+	config.PathStyle = config.Endpoint != ""
+
+	sameProvider := config.Provider == base.Provider || (config.Provider == ProviderCOS && base.Provider == "")
+	if sameProvider {
+		if config.SecretID == "" && config.SecretKey == "" {
+			config.SecretID, config.SecretKey = base.SecretID, base.SecretKey
+		}
+		if config.Region == "" {
+			config.Region = base.Region
+		}
+		if config.Endpoint == "" {
+			config.Endpoint, config.PathStyle = base.Endpoint, base.PathStyle
+		}
+		if config.Provider == ProviderLocal {
+			// Local buckets are subdirectories of the same object store
+			config.LocalDir = base.LocalDir
+			if config.BaseURL == "" {
+				config.BaseURL = base.BaseURL
+			}
+		}
+		// COS BaseURL names a single bucket and is never inherited
+	}
+	if b.PathStyle != nil {
+		config.PathStyle = *b.PathStyle
+	}
+	return config
+}
+
+// LoadBucketConfigsFromEnv reads the additional buckets listed in the JSON file named by OSS_BUCKETS_CONFIG.
+// Returns nil if OSS_BUCKETS_CONFIG is not set. ${VAR} references in the file are expanded from the
+// environment so credentials do not have to be stored in it. Format:
+//
+//	{"buckets": [{"name": "lab-archive-1250000000", "region": "ap-shanghai"},
+//	             {"name": "scratch", "provider": "s3", "endpoint": "http://minio.lab:9000",
+//	              "secret_id": "${MINIO_ACCESS_KEY}", "secret_key": "${MINIO_SECRET_KEY}"}]}
+func LoadBucketConfigsFromEnv() ([]BucketConfig, error) {
+	path := os.Getenv("OSS_BUCKETS_CONFIG")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OSS_BUCKETS_CONFIG: %w", err)
+	}
+	var file struct {
+		Buckets []BucketConfig `json:"buckets"`
+	}
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("invalid OSS_BUCKETS_CONFIG %s: %w", path, err)
+	}
+	return file.Buckets, nil
+}
+
+// Registry holds one provider per configured bucket; the set of buckets is the allowlist for jobs.
+// It implements Provider for the default bucket.
+type Registry struct {
+	defaultBucket string
+	providers     map[string]Provider
+}
+
+// NewRegistry creates providers for the default bucket (config) and every additional bucket
+func NewRegistry(config Config, buckets []BucketConfig) (*Registry, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("default bucket is required")
+	}
+	defaultProvider, err := NewProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		defaultBucket: config.Bucket,
+		providers:     map[string]Provider{config.Bucket: defaultProvider},
+	}
+
+	for _, b := range buckets {
+		if b.Name == "" {
+			return nil, fmt.Errorf("bucket name is required")
+		}
+		if _, ok := r.providers[b.Name]; ok {
+			return nil, fmt.Errorf("bucket %s is configured more than once", b.Name)
+		}
+		provider, err := NewProvider(b.config(config))
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %w", b.Name, err)
+		}
+		r.providers[b.Name] = provider
+	}
+	return r, nil
+}
+
+// Buckets returns the configured bucket names, sorted
+func (r *Registry) Buckets() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultBucket returns the bucket used when a job does not name one
+func (r *Registry) DefaultBucket() string {
+	return r.defaultBucket
+}
+
+// Bucket returns the provider for a configured bucket ("" selects the default bucket)
+func (r *Registry) Bucket(name string) (Provider, error) {
+	if name == "" {
+		name = r.defaultBucket
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s is not configured", name)
+	}
+	return provider, nil
+}
+
+// GenerateDownloadURL generates a presigned GET URL in the default bucket
+func (r *Registry) GenerateDownloadURL(ctx context.Context, key string) (string, error) {
+	return r.providers[r.defaultBucket].GenerateDownloadURL(ctx, key)
+}
+
+// GenerateUploadURL generates a presigned PUT URL in the default bucket
+func (r *Registry) GenerateUploadURL(ctx context.Context, key string) (string, error) {
+	return r.providers[r.defaultBucket].GenerateUploadURL(ctx, key)
+}
+
+// GenerateUploadURLWithPrefix generates a presigned PUT URL for a prefix in the default bucket
+func (r *Registry) GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error) {
+	return r.providers[r.defaultBucket].GenerateUploadURLWithPrefix(ctx, prefix, filename)
+}
@@ -0,0 +1,108 @@
+package oss
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Buckets(t *testing.T) {
+	primary := Config{
+		Provider:   ProviderLocal,
+		SecretKey:  "secret",
+		Bucket:     "lab-main",
+		BaseURL:    "http://objstore.lab:9100",
+		LocalDir:   t.TempDir(),
+		PresignTTL: 10 * time.Minute,
+	}
+	registry, err := NewRegistry(primary, []BucketConfig{
+		{Name: "lab-archive"},
+		{Name: "minio-data", Provider: ProviderS3, SecretID: "ak", SecretKey: "sk", Endpoint: "http://minio.lab:9000"},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	if got := strings.Join(registry.Buckets(), ","); got != "lab-archive,lab-main,minio-data" || registry.DefaultBucket() != "lab-main" {
+		t.Errorf("Buckets = %s, default = %s", got, registry.DefaultBucket())
+	}
+
+	ctx := context.Background()
+	cases := map[string]string{
+		"":            "http://objstore.lab:9100/lab-main/in.bin?",
+		"lab-main":    "http://objstore.lab:9100/lab-main/in.bin?",
+		"lab-archive": "http://objstore.lab:9100/lab-archive/in.bin?",
+		"minio-data":  "http://minio.lab:9000/minio-data/in.bin?",
+	}
+	for bucket, wantPrefix := range cases {
+		provider, err := ForBucket(registry, bucket)
+		if err != nil {
+			t.Fatalf("ForBucket(%q) failed: %v", bucket, err)
+		}
+		url, err := provider.GenerateDownloadURL(ctx, "in.bin")
+		if err != nil || !strings.HasPrefix(url, wantPrefix) {
+			t.Errorf("Bucket %q: URL = %s, %v; want prefix %s", bucket, url, err, wantPrefix)
+		}
+	}
+	if url, _ := registry.GenerateUploadURL(ctx, "out.bin"); !strings.HasPrefix(url, "http://objstore.lab:9100/lab-main/out.bin?") {
+		t.Errorf("Registry should sign for the default bucket, got %s", url)
+	}
+
+	if _, err := ForBucket(registry, "other-bucket"); err == nil {
+		t.Error("Unconfigured bucket: expected error")
+	}
+	// A single provider only knows its own bucket and is used as-is
+	local, _ := NewProvider(primary)
+	if p, err := ForBucket(local, "anything"); err != nil || p != local {
+		t.Errorf("ForBucket on a plain provider = %v, %v", p, err)
+	}
+
+	if _, err := NewRegistry(primary, []BucketConfig{{Name: "lab-main"}}); err == nil {
+		t.Error("Duplicate bucket: expected error")
+	}
+	if _, err := NewRegistry(primary, []BucketConfig{{Name: "s3-no-creds", Provider: ProviderS3}}); err == nil {
+		t.Error("Bucket of another provider without credentials: expected error")
+	}
+}
+
+func TestLoadBucketConfigsFromEnv(t *testing.T) {
+	t.Setenv("OSS_BUCKETS_CONFIG", "")
+	if buckets, err := LoadBucketConfigsFromEnv(); err != nil || buckets != nil {
+		t.Errorf("Unset OSS_BUCKETS_CONFIG = %v, %v; want nil", buckets, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "buckets.json")
+	os.WriteFile(path, []byte(`{"buckets": [
+		{"name": "lab-archive-1250000000", "region": "ap-shanghai"},
+		{"name": "scratch", "provider": "s3", "secret_id": "${TEST_MINIO_KEY}", "secret_key": "${TEST_MINIO_SECRET}", "path_style": false}
+	]}`), 0o600)
+	t.Setenv("OSS_BUCKETS_CONFIG", path)
+	t.Setenv("TEST_MINIO_KEY", "minio-ak")
+	t.Setenv("TEST_MINIO_SECRET", "minio-sk")
+
+	buckets, err := LoadBucketConfigsFromEnv()
+	if err != nil {
+		t.Fatalf("LoadBucketConfigsFromEnv failed: %v", err)
+	}
+	if len(buckets) != 2 || buckets[1].SecretID != "minio-ak" || buckets[1].SecretKey != "minio-sk" || buckets[1].PathStyle == nil {
+		t.Fatalf("Unexpected buckets: %+v", buckets)
+	}
+
+	// Buckets of the default provider inherit its credentials; other providers do not
+	primary := Config{Provider: ProviderCOS, SecretID: "id", SecretKey: "key", Bucket: "main-1250000000", Region: "ap-beijing", PresignTTL: 5 * time.Minute}
+	archive := buckets[0].config(primary)
+	if archive.SecretID != "id" || archive.Region != "ap-shanghai" || archive.PresignTTL != 5*time.Minute || archive.Provider != ProviderCOS {
+		t.Errorf("Unexpected inherited config: %+v", archive)
+	}
+	scratch := buckets[1].config(primary)
+	if scratch.SecretID != "minio-ak" || scratch.Region != "" || scratch.PathStyle {
+		t.Errorf("Unexpected S3 bucket config: %+v", scratch)
+	}
+
+	os.WriteFile(path, []byte(`{"buckets": [`), 0o600)
+	if _, err := LoadBucketConfigsFromEnv(); err == nil {
+		t.Error("Invalid JSON: expected error")
+	}
+}
@@ -0,0 +1,429 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// maxS3PresignTTL is the longest X-Amz-Expires SigV4 accepts
+	maxS3PresignTTL = 7 * 24 * time.Hour
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Provider implements Provider for S3-compatible storage using SigV4 presigned URLs.
+// It works with AWS S3, MinIO, Ceph RGW and Aliyun OSS (S3-compatible endpoint).
+type S3Provider struct {
+	config     Config
+	endpoint   *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewS3Provider creates a new S3-compatible provider instance
+func NewS3Provider(config Config) (Provider, error) {
+	return newS3Provider(config)
+}
+
+func newS3Provider(config Config) (*S3Provider, error) {
+	if config.SecretID == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key are required")
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("Bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = defaultS3Region
+	}
+	if config.PresignTTL == 0 {
+		config.PresignTTL = 15 * time.Minute
+	}
+	if config.PresignTTL < time.Second || config.PresignTTL > maxS3PresignTTL {
+		return nil, fmt.Errorf("PresignTTL must be between 1s and %s", maxS3PresignTTL)
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Endpoint %q: must be an http(s) URL", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return &S3Provider{
+		config:     config,
+		endpoint:   u,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of key: {endpoint}/{bucket}/{key} (path style) or {bucket}.{endpoint host}/{key}
+func (p *S3Provider) objectURL(key string) *url.URL {
+	u := *p.endpoint
+	path := u.Path + "/" + key
+	if p.config.PathStyle {
+		path = u.Path + "/" + p.config.Bucket + "/" + key
+	} else {
+		u.Host = p.config.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = s3URIEncode(path, false)
+	return &u
+}
+
+// presign builds a SigV4 query-signed URL. extraHeaders must be sent unchanged with the request;
+// extraQuery (e.g. partNumber/uploadId) is part of the signed URL.
+func (p *S3Provider) presign(method, key string, extraQuery url.Values, extraHeaders http.Header) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("key cannot be empty")
+	}
+
+	u := p.objectURL(key)
+	now := p.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := p.scope(now)
+
+	headers := map[string]string{"host": u.Host}
+	for name := range extraHeaders {
+		headers[strings.ToLower(name)] = extraHeaders.Get(name)
+	}
+	signedHeaders := s3SignedHeaders(headers)
+
+	query := url.Values{}
+	for name, values := range extraQuery {
+		query[name] = values
+	}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", p.config.SecretID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(p.config.PresignTTL.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	canonicalQuery := s3CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.RawPath,
+		canonicalQuery,
+		s3CanonicalHeaders(headers),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + p.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+// signRequest adds SigV4 Authorization headers to req (used for direct HEAD/PUT/DELETE calls)
+func (p *S3Provider) signRequest(req *http.Request, payload []byte) {
+	now := p.now().UTC()
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": req.Header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date":           req.Header.Get("X-Amz-Date"),
+	}
+	signedHeaders := s3SignedHeaders(headers)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		s3CanonicalQuery(req.URL.Query()),
+		s3CanonicalHeaders(headers),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, p.config.SecretID, p.scope(now), signedHeaders, p.signature(now, canonicalRequest)))
+}
+
+func (p *S3Provider) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + p.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with the SigV4 signing key for now's date
+func (p *S3Provider) signature(now time.Time, canonicalRequest string) string {
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + now.Format("20060102T150405Z") + "\n" + p.scope(now) + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+p.config.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, p.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// s3URIEncode percent-encodes s as SigV4 requires (RFC 3986 unreserved characters are kept)
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3SignedHeaders(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+func s3CanonicalHeaders(headers map[string]string) string {
+	var b strings.Builder
+	for _, name := range strings.Split(s3SignedHeaders(headers), ";") {
+		b.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	return b.String()
+}
+
+// GenerateDownloadURL generates a presigned GET URL for downloading an object
+func (p *S3Provider) GenerateDownloadURL(ctx context.Context, key string) (string, error) {
+	return p.presign(http.MethodGet, key, nil, nil)
+}
+
+// GenerateUploadURL generates a presigned PUT URL for uploading an object
+func (p *S3Provider) GenerateUploadURL(ctx context.Context, key string) (string, error) {
+	return p.presign(http.MethodPut, key, nil, nil)
+}
+
+// GenerateConstrainedUploadURL generates a presigned PUT URL with Content-Type/Content-Length included in the signature
+func (p *S3Provider) GenerateConstrainedUploadURL(ctx context.Context, key string, constraints UploadConstraints) (string, error) {
+	header := http.Header{}
+	if constraints.ContentType != "" {
+		header.Set("Content-Type", constraints.ContentType)
+	}
+	if constraints.ContentLength > 0 {
+		header.Set("Content-Length", strconv.FormatInt(constraints.ContentLength, 10))
+	}
+	return p.presign(http.MethodPut, key, nil, header)
+}
+
+// GenerateUploadURLWithPrefix generates a presigned PUT URL for uploading to a prefix
+func (p *S3Provider) GenerateUploadURLWithPrefix(ctx context.Context, prefix, filename string) (string, error) {
+	if prefix == "" {
+		return "", fmt.Errorf("prefix cannot be empty")
+	}
+	if filename == "" {
+		return "", fmt.Errorf("filename cannot be empty")
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return p.GenerateUploadURL(ctx, prefix+filename)
+}
+
+// do sends a header-signed request for key
+func (p *S3Provider) do(ctx context.Context, method, key string, payload []byte) (*http.Response, error) {
+	return p.doQuery(ctx, method, key, nil, payload, "")
+}
+
+// doQuery sends a header-signed request for key with query parameters (e.g. ?uploads)
+func (p *S3Provider) doQuery(ctx context.Context, method, key string, query url.Values, payload []byte, contentType string) (*http.Response, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key cannot be empty")
+	}
+	u := p.objectURL(key)
+	u.RawQuery = s3CanonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u // keep the SigV4 path encoding (RawPath)
+	req.ContentLength = int64(len(payload))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	p.signRequest(req, payload)
+	return p.httpClient.Do(req)
+}
+
+// ObjectExists checks if an object exists in the bucket (HEAD request)
+func (p *S3Provider) ObjectExists(ctx context.Context, key string) (bool, error) {
+	resp, err := p.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check object existence: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check object existence: HEAD returned status %d", resp.StatusCode)
+	}
+}
+
+// StatObject returns the size and ETag of an object (HEAD request)
+func (p *S3Provider) StatObject(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := p.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to head object: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ObjectInfo{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}, nil
+	case http.StatusNotFound:
+		return ObjectInfo{}, ErrObjectNotFound
+	default:
+		return ObjectInfo{}, fmt.Errorf("failed to head object: HEAD returned status %d", resp.StatusCode)
+	}
+}
+
+// PutObject uploads an object directly (for test setup)
+func (p *S3Provider) PutObject(ctx context.Context, key string, data []byte) error {
+	resp, err := p.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to put object: status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// DeleteObject deletes an object (for test cleanup)
+func (p *S3Provider) DeleteObject(ctx context.Context, key string) error {
+	resp, err := p.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete object: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// s3Response reads an S3 response; S3 can report errors with a 200 status, so an <Error> body is also a failure
+func s3Response(resp *http.Response, op string, result interface{}) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", op, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("failed to %s: status %d: %s", op, resp.StatusCode, bytes.TrimSpace(body[:min(len(body), 1024)]))
+	}
+	if result != nil {
+		if err := xml.Unmarshal(body, result); err != nil {
+			return fmt.Errorf("failed to %s: invalid response: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload of key (POST ?uploads)
+func (p *S3Provider) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	resp, err := p.doQuery(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, contentType)
+	if err != nil {
+		return "", fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s3Response(resp, "initiate multipart upload", &result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", fmt.Errorf("failed to initiate multipart upload: no UploadId in response")
+	}
+	return result.UploadID, nil
+}
+
+// GeneratePartUploadURL generates a presigned PUT URL for one part of a multipart upload
+func (p *S3Provider) GeneratePartUploadURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	if uploadID == "" {
+		return "", fmt.Errorf("upload ID is required")
+	}
+	if !validPartNumber(partNumber) {
+		return "", fmt.Errorf("part number %d out of range", partNumber)
+	}
+	return p.presign(http.MethodPut, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}, nil)
+}
+
+// CompleteMultipartUpload assembles the object from the uploaded parts (POST ?uploadId=...)
+func (p *S3Provider) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	if err := ValidateParts(parts); err != nil {
+		return err
+	}
+	type xmlPart struct {
+		PartNumber int
+		ETag       string
+	}
+	body := struct {
+		XMLName xml.Name  `xml:"CompleteMultipartUpload"`
+		Parts   []xmlPart `xml:"Part"`
+	}{}
+	for _, part := range parts {
+		body.Parts = append(body.Parts, xmlPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	payload, err := xml.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	resp, err := p.doQuery(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, payload, "application/xml")
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return s3Response(resp, "complete multipart upload", nil)
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts (DELETE ?uploadId=...)
+func (p *S3Provider) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := p.doQuery(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return s3Response(resp, "abort multipart upload", nil)
+}
@@ -0,0 +1,361 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// STSCredentials are temporary credentials that can only write objects under Prefix
+type STSCredentials struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+	Endpoint        string // OSS endpoint (e.g., "cos.ap-beijing.myqcloud.com")
+	Bucket          string
+	Prefix          string // Key prefix the credentials are limited to (e.g., "jobs/{job_id}/{attempt_id}/")
+	ExpiresAt       time.Time
+}
+
+// STSProvider issues temporary credentials scoped to a key prefix.
+// Agents use them to upload any number of objects under the prefix without further round trips.
+type STSProvider interface {
+	// IssueUploadCredentials returns credentials that allow uploads under prefix and nothing else
+	IssueUploadCredentials(ctx context.Context, prefix string) (*STSCredentials, error)
+}
+
+// STSConfig holds configuration for the Tencent Cloud STS backend
+type STSConfig struct {
+	SecretID  string        // Permanent SecretID used to call STS (same as COS_SECRET_ID)
+	SecretKey string        // Permanent SecretKey used to call STS
+	Bucket    string        // COS bucket name, including the APPID suffix (e.g., "examplebucket-1250000000")
+	Region    string        // COS region (e.g., "ap-beijing")
+	Duration  time.Duration // Credential lifetime (default: 30 minutes, max: 2 hours)
+	Endpoint  string        // STS API endpoint (default: https://sts.tencentcloudapi.com)
+}
+
+const (
+	defaultSTSDuration = 30 * time.Minute
+	maxSTSDuration     = 2 * time.Hour
+	defaultSTSEndpoint = "https://sts.tencentcloudapi.com"
+)
+
+// LoadSTSConfigFromEnv loads STS configuration from environment variables.
+// STS is opt-in: enabled is false unless COS_STS_ENABLED=true.
+// Environment variables:
+//   - COS_STS_ENABLED: "true" to hand agents STS credentials for outputs instead of presigned URLs
+//   - COS_STS_DURATION_MINUTES: Credential lifetime in minutes (optional, default: 30, max: 120)
+//   - COS_SECRET_ID, COS_SECRET_KEY, COS_BUCKET, COS_REGION: as for LoadConfigFromEnv
+func LoadSTSConfigFromEnv() (cfg STSConfig, enabled bool, err error) {
+	if enabled, _ = strconv.ParseBool(os.Getenv("COS_STS_ENABLED")); !enabled {
+		return STSConfig{}, false, nil
+	}
+
+	ossConfig, err := LoadConfigFromEnv()
+	if err != nil {
+		return STSConfig{}, true, err
+	}
+	if ossConfig.Provider != ProviderCOS {
+		return STSConfig{}, true, fmt.Errorf("COS_STS_ENABLED requires OSS_PROVIDER=%s", ProviderCOS)
+	}
+	cfg = STSConfig{
+		SecretID:  ossConfig.SecretID,
+		SecretKey: ossConfig.SecretKey,
+		Bucket:    ossConfig.Bucket,
+		Region:    ossConfig.Region,
+		Duration:  defaultSTSDuration,
+	}
+
+	if minutesStr := os.Getenv("COS_STS_DURATION_MINUTES"); minutesStr != "" {
+		minutes, err := strconv.Atoi(minutesStr)
+		if err != nil {
+			return STSConfig{}, true, fmt.Errorf("invalid COS_STS_DURATION_MINUTES: %w", err)
+		}
+		cfg.Duration = time.Duration(minutes) * time.Minute
+		if cfg.Duration <= 0 || cfg.Duration > maxSTSDuration {
+			return STSConfig{}, true, fmt.Errorf("COS_STS_DURATION_MINUTES must be between 1 and %d", int(maxSTSDuration.Minutes()))
+		}
+	}
+	return cfg, true, nil
+}
+
+// TencentSTSProvider issues COS credentials through Tencent Cloud STS GetFederationToken,
+// with a policy that only allows uploads under the requested prefix
+type TencentSTSProvider struct {
+	config     STSConfig
+	appID      string
+	httpClient *http.Client
+}
+
+// NewTencentSTSProvider creates a Tencent Cloud STS provider
+func NewTencentSTSProvider(config STSConfig) (*TencentSTSProvider, error) {
+	if config.SecretID == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("SecretID and SecretKey are required")
+	}
+	if config.Bucket == "" || config.Region == "" {
+		return nil, fmt.Errorf("Bucket and Region are required")
+	}
+	appID, err := bucketAppID(config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if config.Duration == 0 {
+		config.Duration = defaultSTSDuration
+	}
+	if config.Duration < 0 || config.Duration > maxSTSDuration {
+		return nil, fmt.Errorf("Duration must be between 0 and %s", maxSTSDuration)
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = defaultSTSEndpoint
+	}
+
+	return &TencentSTSProvider{
+		config:     config,
+		appID:      appID,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// bucketAppID extracts the APPID from a COS bucket name ("{name}-{appid}")
+func bucketAppID(bucket string) (string, error) {
+	i := strings.LastIndex(bucket, "-")
+	if i < 0 || i == len(bucket)-1 {
+		return "", fmt.Errorf("bucket %q must be in the form {name}-{appid}", bucket)
+	}
+	appID := bucket[i+1:]
+	if _, err := strconv.ParseUint(appID, 10, 64); err != nil {
+		return "", fmt.Errorf("bucket %q must be in the form {name}-{appid}", bucket)
+	}
+	return appID, nil
+}
+
+// validatePrefix rejects prefixes that would widen the policy beyond one job directory
+func validatePrefix(prefix string) error {
+	if prefix == "" || !strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("prefix must be non-empty and end with /")
+	}
+	if strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, "*?") || strings.Contains(prefix, "..") {
+		return fmt.Errorf("invalid prefix %q", prefix)
+	}
+	return nil
+}
+
+// uploadPolicy builds a CAM policy that only allows (multipart) uploads under prefix
+func (p *TencentSTSProvider) uploadPolicy(prefix string) string {
+	policy := map[string]interface{}{
+		"version": "2.0",
+		"statement": []map[string]interface{}{{
+			"effect": "allow",
+			"action": []string{
+				"name/cos:PutObject",
+				"name/cos:InitiateMultipartUpload",
+				"name/cos:UploadPart",
+				"name/cos:CompleteMultipartUpload",
+				"name/cos:AbortMultipartUpload",
+				"name/cos:ListParts",
+			},
+			"resource": []string{
+				fmt.Sprintf("qcs::cos:%s:uid/%s:%s/%s*", p.config.Region, p.appID, p.config.Bucket, prefix),
+			},
+		}},
+	}
+	data, _ := json.Marshal(policy)
+	return string(data)
+}
+
+// IssueUploadCredentials calls GetFederationToken with a policy limited to prefix
+func (p *TencentSTSProvider) IssueUploadCredentials(ctx context.Context, prefix string) (*STSCredentials, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"Name":            "xi-job-output",
+		"Policy":          url.QueryEscape(p.uploadPolicy(prefix)),
+		"DurationSeconds": int(p.config.Duration.Seconds()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal STS request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create STS request: %w", err)
+	}
+	p.signTC3(req, payload, time.Now())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("STS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read STS response: %w", err)
+	}
+
+	var result struct {
+		Response struct {
+			Credentials struct {
+				Token        string
+				TmpSecretId  string
+				TmpSecretKey string
+			}
+			ExpiredTime int64
+			Error       *struct {
+				Code    string
+				Message string
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid STS response (status %d): %w", resp.StatusCode, err)
+	}
+	if e := result.Response.Error; e != nil {
+		return nil, fmt.Errorf("STS GetFederationToken failed: %s: %s", e.Code, e.Message)
+	}
+	creds := result.Response.Credentials
+	if creds.TmpSecretId == "" || creds.TmpSecretKey == "" || creds.Token == "" {
+		return nil, fmt.Errorf("STS response has no credentials (status %d)", resp.StatusCode)
+	}
+
+	return &STSCredentials{
+		AccessKeyID:     creds.TmpSecretId,
+		AccessKeySecret: creds.TmpSecretKey,
+		SecurityToken:   creds.Token,
+		Endpoint:        fmt.Sprintf("cos.%s.myqcloud.com", p.config.Region),
+		Bucket:          p.config.Bucket,
+		Prefix:          prefix,
+		ExpiresAt:       time.Unix(result.Response.ExpiredTime, 0),
+	}, nil
+}
+
+// signTC3 signs a Tencent Cloud API 3.0 request (TC3-HMAC-SHA256)
+func (p *TencentSTSProvider) signTC3(req *http.Request, payload []byte, now time.Time) {
+	const service = "sts"
+	timestamp := now.Unix()
+	date := now.UTC().Format("2006-01-02")
+	contentType := "application/json; charset=utf-8"
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-TC-Action", "GetFederationToken")
+	req.Header.Set("X-TC-Version", "2018-08-13")
+	req.Header.Set("X-TC-Region", p.config.Region)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		"content-type:" + contentType + "\nhost:" + req.URL.Host + "\n",
+		"content-type;host",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	credentialScope := date + "/" + service + "/tc3_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(timestamp, 10) + "\n" + credentialScope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	secretDate := hmacSHA256([]byte("TC3"+p.config.SecretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host, Signature=%s",
+		p.config.SecretID, credentialScope, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// FakeSTSProvider issues random credentials without calling a cloud service.
+// It remembers what it issued so tests (and a local object store) can check that a key is allowed.
+type FakeSTSProvider struct {
+	Endpoint string
+	Bucket   string
+	TTL      time.Duration
+
+	mu     sync.Mutex
+	issued map[string]*STSCredentials // access key ID -> credentials
+}
+
+// NewFakeSTSProvider creates a fake STS provider for the given endpoint and bucket
+func NewFakeSTSProvider(endpoint, bucket string, ttl time.Duration) *FakeSTSProvider {
+	if ttl == 0 {
+		ttl = defaultSTSDuration
+	}
+	return &FakeSTSProvider{
+		Endpoint: endpoint,
+		Bucket:   bucket,
+		TTL:      ttl,
+		issued:   make(map[string]*STSCredentials),
+	}
+}
+
+// IssueUploadCredentials issues random credentials for prefix
+func (f *FakeSTSProvider) IssueUploadCredentials(ctx context.Context, prefix string) (*STSCredentials, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	creds := &STSCredentials{
+		AccessKeyID:     "fake-" + randomToken(8),
+		AccessKeySecret: randomToken(16),
+		SecurityToken:   randomToken(16),
+		Endpoint:        f.Endpoint,
+		Bucket:          f.Bucket,
+		Prefix:          prefix,
+		ExpiresAt:       time.Now().Add(f.TTL),
+	}
+	f.mu.Lock()
+	f.issued[creds.AccessKeyID] = creds
+	f.mu.Unlock()
+	return creds, nil
+}
+
+// Lookup returns the credentials issued for accessKeyID, if any
+func (f *FakeSTSProvider) Lookup(accessKeyID string) (*STSCredentials, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	creds, ok := f.issued[accessKeyID]
+	return creds, ok
+}
+
+// Authorize checks that the credentials identified by accessKeyID and securityToken may write key
+func (f *FakeSTSProvider) Authorize(accessKeyID, securityToken, key string) error {
+	creds, ok := f.Lookup(accessKeyID)
+	if !ok || creds.SecurityToken != securityToken {
+		return fmt.Errorf("unknown credentials")
+	}
+	if time.Now().After(creds.ExpiresAt) {
+		return fmt.Errorf("credentials expired")
+	}
+	if !strings.HasPrefix(key, creds.Prefix) {
+		return fmt.Errorf("key %s is outside prefix %s", key, creds.Prefix)
+	}
+	return nil
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,117 @@
+package oss
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTencentSTSProvider_IssueUploadCredentials(t *testing.T) {
+	var policy string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-TC-Action") != "GetFederationToken" {
+			t.Errorf("X-TC-Action = %q", r.Header.Get("X-TC-Action"))
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "TC3-HMAC-SHA256 Credential=test-id/") ||
+			!strings.Contains(auth, "/sts/tc3_request, SignedHeaders=content-type;host, Signature=") {
+			t.Errorf("Unexpected Authorization: %s", auth)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Policy          string
+			DurationSeconds int
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("Invalid request body: %v", err)
+		}
+		policy, _ = url.QueryUnescape(req.Policy)
+		if req.DurationSeconds != 600 {
+			t.Errorf("DurationSeconds = %d, want 600", req.DurationSeconds)
+		}
+		w.Write([]byte(`{"Response":{"Credentials":{"Token":"tok","TmpSecretId":"tmp-id","TmpSecretKey":"tmp-key"},"ExpiredTime":1700000000,"RequestId":"r"}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewTencentSTSProvider(STSConfig{
+		SecretID:  "test-id",
+		SecretKey: "test-key",
+		Bucket:    "examplebucket-1250000000",
+		Region:    "ap-beijing",
+		Duration:  10 * time.Minute,
+		Endpoint:  server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	creds, err := provider.IssueUploadCredentials(context.Background(), "jobs/job-1/2/")
+	if err != nil {
+		t.Fatalf("IssueUploadCredentials failed: %v", err)
+	}
+	if creds.AccessKeyID != "tmp-id" || creds.AccessKeySecret != "tmp-key" || creds.SecurityToken != "tok" {
+		t.Errorf("Unexpected credentials: %+v", creds)
+	}
+	if creds.Endpoint != "cos.ap-beijing.myqcloud.com" || creds.Bucket != "examplebucket-1250000000" || creds.ExpiresAt.Unix() != 1700000000 {
+		t.Errorf("Unexpected endpoint/bucket/expiry: %+v", creds)
+	}
+	if !strings.Contains(policy, `"qcs::cos:ap-beijing:uid/1250000000:examplebucket-1250000000/jobs/job-1/2/*"`) {
+		t.Errorf("Policy not scoped to prefix: %s", policy)
+	}
+	if strings.Contains(policy, "GetObject") || strings.Contains(policy, "DeleteObject") {
+		t.Errorf("Policy grants more than uploads: %s", policy)
+	}
+
+	for _, prefix := range []string{"", "jobs/job-1/2", "jobs/*/", "/jobs/job-1/", "jobs/../"} {
+		if _, err := provider.IssueUploadCredentials(context.Background(), prefix); err == nil {
+			t.Errorf("Prefix %q: expected error", prefix)
+		}
+	}
+}
+
+func TestTencentSTSProvider_ErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"bad signature"},"RequestId":"r"}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewTencentSTSProvider(STSConfig{
+		SecretID: "id", SecretKey: "key", Bucket: "b-1250000000", Region: "ap-beijing", Endpoint: server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if _, err := provider.IssueUploadCredentials(context.Background(), "jobs/j/1/"); err == nil || !strings.Contains(err.Error(), "AuthFailure.SignatureFailure") {
+		t.Errorf("Expected STS error, got %v", err)
+	}
+
+	if _, err := NewTencentSTSProvider(STSConfig{SecretID: "id", SecretKey: "key", Bucket: "no-appid", Region: "ap-beijing"}); err == nil {
+		t.Error("Bucket without APPID: expected error")
+	}
+}
+
+func TestFakeSTSProvider(t *testing.T) {
+	provider := NewFakeSTSProvider("http://127.0.0.1:9000", "test-bucket", time.Minute)
+	creds, err := provider.IssueUploadCredentials(context.Background(), "jobs/job-1/1/")
+	if err != nil {
+		t.Fatalf("IssueUploadCredentials failed: %v", err)
+	}
+	if creds.Bucket != "test-bucket" || creds.Prefix != "jobs/job-1/1/" || time.Until(creds.ExpiresAt) <= 0 {
+		t.Errorf("Unexpected credentials: %+v", creds)
+	}
+
+	if err := provider.Authorize(creds.AccessKeyID, creds.SecurityToken, "jobs/job-1/1/output.bin"); err != nil {
+		t.Errorf("Key under prefix: %v", err)
+	}
+	if err := provider.Authorize(creds.AccessKeyID, creds.SecurityToken, "jobs/job-2/1/output.bin"); err == nil {
+		t.Error("Key outside prefix: expected error")
+	}
+	if err := provider.Authorize(creds.AccessKeyID, "wrong", "jobs/job-1/1/output.bin"); err == nil {
+		t.Error("Wrong security token: expected error")
+	}
+}
@@ -3,6 +3,8 @@ package registry
 import (
 	"sync"
 	"time"
+
+	control "github.com/xiresource/proto/control"
 )
 
 // AgentInfo represents an online agent
@@ -14,6 +16,18 @@ type AgentInfo struct {
 	RunningJobs    int
 	LastHeartbeat  time.Time
 	ConnectedAt    time.Time
+	Templates      []string                 // Job templates the agent runs (Register.templates)
+	ForwardTargets []*control.ForwardTarget // Targets the agent forwards requests to (Register.forward_targets)
+}
+
+// HasTemplate reports whether the agent runs the named job template
+func (a *AgentInfo) HasTemplate(name string) bool {
+	for _, template := range a.Templates {
+		if template == name {
+			return true
+		}
+	}
+	return false
 }
 
 // Registry tracks online agents
@@ -50,6 +64,31 @@ func (r *Registry) Register(agentID, hostname string, maxConcurrency int) {
 	}
 }
 
+// PermitsForward reports whether the agent forwards requests to rawURL
+func (a *AgentInfo) PermitsForward(rawURL string) bool {
+	return control.PermitsForward(a.ForwardTargets, rawURL)
+}
+
+// SetForwardTargets records the targets an agent forwards requests to
+func (r *Registry) SetForwardTargets(agentID string, targets []*control.ForwardTarget) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if agent, exists := r.agents[agentID]; exists {
+		agent.ForwardTargets = targets
+	}
+}
+
+// SetTemplates records the job templates an agent runs
+func (r *Registry) SetTemplates(agentID string, templates []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if agent, exists := r.agents[agentID]; exists {
+		agent.Templates = templates
+	}
+}
+
 // UpdateHeartbeat updates agent heartbeat and status
 func (r *Registry) UpdateHeartbeat(agentID string, paused bool, runningJobs int) {
 	r.mu.Lock()
@@ -0,0 +1,119 @@
+package upload
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyPrefix is the OSS prefix under which upload keys are reserved
+const KeyPrefix = "inputs/"
+
+// DefaultContentType is used when the client does not declare a content type
+const DefaultContentType = "application/octet-stream"
+
+// maxFilenameLength bounds the last key segment
+const maxFilenameLength = 255
+
+// filenamePattern restricts upload filenames to characters that are safe in keys and on agent filesystems
+var filenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Config holds upload reservation limits
+type Config struct {
+	// Bucket is the OSS bucket uploads are written to (the provider's bucket)
+	Bucket string
+
+	// MaxSize is the largest upload accepted, in bytes (default: 1 GiB)
+	MaxSize int64
+
+	// AllowedContentTypes restricts declared media types (empty: any)
+	AllowedContentTypes []string
+
+	// PresignTTL is how long the presigned PUT URL stays valid (should match the OSS provider's TTL)
+	PresignTTL time.Duration
+}
+
+// DefaultConfig returns the default upload limits
+func DefaultConfig() *Config {
+	return &Config{
+		MaxSize:    1 << 30,
+		PresignTTL: 15 * time.Minute,
+	}
+}
+
+// LoadConfig loads upload limits from environment variables
+//   - UPLOAD_MAX_SIZE_MB: maximum upload size in MiB (default: 1024)
+//   - UPLOAD_ALLOWED_CONTENT_TYPES: comma-separated media types (default: any)
+func LoadConfig() *Config {
+	cfg := DefaultConfig()
+
+	if sizeStr := os.Getenv("UPLOAD_MAX_SIZE_MB"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil && size > 0 {
+			cfg.MaxSize = size << 20
+		}
+	}
+
+	if types := os.Getenv("UPLOAD_ALLOWED_CONTENT_TYPES"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				cfg.AllowedContentTypes = append(cfg.AllowedContentTypes, t)
+			}
+		}
+	}
+
+	return cfg
+}
+
+// ValidateContentType normalizes a declared content type and checks it against the allow list
+func (c *Config) ValidateContentType(contentType string) (string, error) {
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content_type %q", contentType)
+	}
+	if len(c.AllowedContentTypes) == 0 {
+		return contentType, nil
+	}
+	for _, allowed := range c.AllowedContentTypes {
+		if mediaType == allowed {
+			return contentType, nil
+		}
+	}
+	return "", fmt.Errorf("content_type %s is not allowed (allowed: %s)", mediaType, strings.Join(c.AllowedContentTypes, ", "))
+}
+
+// ValidateSize checks a declared size against the limit
+func (c *Config) ValidateSize(size int64) error {
+	if size <= 0 {
+		return fmt.Errorf("size must be a positive number of bytes")
+	}
+	if size > c.MaxSize {
+		return fmt.Errorf("size exceeds maximum upload size of %d bytes", c.MaxSize)
+	}
+	return nil
+}
+
+// ValidateFilename checks the last key segment of an upload (defaults to "input")
+func ValidateFilename(filename string) (string, error) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return "input", nil
+	}
+	if len(filename) > maxFilenameLength || path.Base(filename) != filename || !filenamePattern.MatchString(filename) {
+		return "", fmt.Errorf("filename must be a plain file name of letters, digits, '.', '_' or '-' (max %d characters)", maxFilenameLength)
+	}
+	return filename, nil
+}
+
+// Key returns the object key reserved for an upload
+func Key(uploadID, filename string) string {
+	return KeyPrefix + uploadID + "/" + filename
+}
@@ -0,0 +1,190 @@
+package upload
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var ErrUploadNotFound = errors.New("upload not found")
+
+// Upload is a reserved input object key that a submitter fills with a presigned PUT
+type Upload struct {
+	ID          string    `json:"upload_id"`
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"` // inputs/{upload_id}/{filename}
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`                // Declared size in bytes
+	Submitter   string    `json:"submitter,omitempty"` // API key name that reserved the upload
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"` // When the presigned PUT URL expires
+}
+
+// Store defines the interface for upload reservation persistence
+type Store interface {
+	// Create records a new upload reservation
+	Create(u *Upload) error
+
+	// Get retrieves an upload reservation by ID
+	Get(id string) (*Upload, error)
+
+	// Close closes the database connection
+	Close() error
+}
+
+// sqlStore holds the queries shared by the SQLite and MySQL stores
+type sqlStore struct {
+	db *sql.DB
+}
+
+// SQLiteStore implements Store using SQLite
+type SQLiteStore struct {
+	sqlStore
+}
+
+// MySQLStore implements Store using MySQL
+type MySQLStore struct {
+	sqlStore
+}
+
+// NewSQLiteStore creates a new SQLite upload store
+func NewSQLiteStore(dbPath string) (Store, error) {
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if dbPath == ":memory:" {
+		// Each connection to :memory: is a separate database
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLiteStore{sqlStore{db: db}}
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return store, nil
+}
+
+// initSchema creates the uploads table if it doesn't exist
+func (s *SQLiteStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS uploads (
+		id TEXT PRIMARY KEY,
+		bucket TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		submitter TEXT,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	`
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+// NewMySQLStore creates a new MySQL upload store
+func NewMySQLStore(host string, port int, user, password, database, params string) (Store, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", user, password, host, port, database)
+	if params != "" {
+		dsn += "?" + params
+	} else {
+		dsn += "?charset=utf8mb4&parseTime=True&loc=Local"
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	store := &MySQLStore{sqlStore{db: db}}
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return store, nil
+}
+
+// initSchema creates the uploads table if it doesn't exist
+func (s *MySQLStore) initSchema() error {
+	table := `CREATE TABLE IF NOT EXISTS uploads (
+		id VARCHAR(255) PRIMARY KEY,
+		bucket VARCHAR(255) NOT NULL,
+		object_key VARCHAR(1024) NOT NULL,
+		filename VARCHAR(255) NOT NULL,
+		content_type VARCHAR(255) NOT NULL,
+		size BIGINT NOT NULL,
+		submitter VARCHAR(255),
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`
+	if _, err := s.db.Exec(table); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	return nil
+}
+
+// NewStore creates an upload store in the same database as the job store
+func NewStore(cfg *job.DBConfig) (Store, error) {
+	if cfg.IsMySQLConfigured() {
+		return NewMySQLStore(
+			cfg.MySQLHost,
+			cfg.MySQLPort,
+			cfg.MySQLUser,
+			cfg.MySQLPassword,
+			cfg.MySQLDatabase,
+			cfg.MySQLParams,
+		)
+	}
+	return NewSQLiteStore(cfg.SQLitePath)
+}
+
+// Create records a new upload reservation
+func (s *sqlStore) Create(u *Upload) error {
+	query := `
+	INSERT INTO uploads (id, bucket, object_key, filename, content_type, size, submitter, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(query, u.ID, u.Bucket, u.Key, u.Filename, u.ContentType, u.Size, u.Submitter, u.CreatedAt.UTC(), u.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves an upload reservation by ID
+func (s *sqlStore) Get(id string) (*Upload, error) {
+	query := `
+	SELECT id, bucket, object_key, filename, content_type, size, submitter, created_at, expires_at
+	FROM uploads WHERE id = ?
+	`
+	var u Upload
+	var submitter sql.NullString
+	err := s.db.QueryRow(query, id).Scan(&u.ID, &u.Bucket, &u.Key, &u.Filename, &u.ContentType, &u.Size, &submitter, &u.CreatedAt, &u.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	u.Submitter = submitter.String
+	return &u, nil
+}
+
+// Close closes the database connection
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,73 @@
+package upload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore_CreateAndGet(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create upload store: %v", err)
+	}
+	defer store.Close()
+
+	u := &Upload{
+		ID:          "upload-1",
+		Bucket:      "bucket",
+		Key:         Key("upload-1", "data.csv"),
+		Filename:    "data.csv",
+		ContentType: "text/csv",
+		Size:        1024,
+		Submitter:   "lab",
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(15 * time.Minute),
+	}
+	if err := store.Create(u); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	got, err := store.Get("upload-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Key != "inputs/upload-1/data.csv" || got.Size != u.Size || got.ContentType != u.ContentType || got.Submitter != u.Submitter {
+		t.Errorf("Get() = %+v, want %+v", got, u)
+	}
+
+	if _, err := store.Get("missing"); err != ErrUploadNotFound {
+		t.Errorf("Get(missing) error = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestConfig_Validation(t *testing.T) {
+	cfg := &Config{MaxSize: 100, AllowedContentTypes: []string{"text/csv", "image/png"}}
+
+	if ct, err := cfg.ValidateContentType("text/csv; charset=utf-8"); err != nil || ct != "text/csv; charset=utf-8" {
+		t.Errorf("ValidateContentType(text/csv) = %q, %v", ct, err)
+	}
+	if _, err := cfg.ValidateContentType("application/zip"); err == nil {
+		t.Error("Expected disallowed content type to be rejected")
+	}
+	if ct, err := DefaultConfig().ValidateContentType(""); err != nil || ct != DefaultContentType {
+		t.Errorf("ValidateContentType(\"\") = %q, %v, want %s", ct, err, DefaultContentType)
+	}
+
+	for _, size := range []int64{0, -1, 101} {
+		if err := cfg.ValidateSize(size); err == nil {
+			t.Errorf("ValidateSize(%d) expected error", size)
+		}
+	}
+	if err := cfg.ValidateSize(100); err != nil {
+		t.Errorf("ValidateSize(100) error = %v", err)
+	}
+
+	for _, name := range []string{"../etc/passwd", "a/b.txt", ".hidden", "bad name.txt"} {
+		if _, err := ValidateFilename(name); err == nil {
+			t.Errorf("ValidateFilename(%q) expected error", name)
+		}
+	}
+	if name, err := ValidateFilename(""); err != nil || name != "input" {
+		t.Errorf("ValidateFilename(\"\") = %q, %v, want input", name, err)
+	}
+}
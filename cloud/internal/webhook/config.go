@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds webhook delivery configuration
+type Config struct {
+	// Secret signs deliveries to per-job callback_url targets (WEBHOOK_SECRET).
+	// Registered subscriptions are signed with their own secret.
+	Secret string
+
+	// MaxAttempts is the number of delivery attempts before dead-lettering (default: 5)
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry; it doubles on each retry (default: 2s)
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the retry delay (default: 5m)
+	MaxBackoff time.Duration
+
+	// Timeout is the per-request HTTP timeout (default: 10s)
+	Timeout time.Duration
+
+	// AllowInternalTargets disables the delivery address check, allowing deliveries to loopback and
+	// link-local addresses such as the cloud metadata service (default: false; for development only)
+	AllowInternalTargets bool
+}
+
+// DefaultConfig returns the default delivery configuration
+func DefaultConfig() *Config {
+	return &Config{
+		MaxAttempts:    5,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Timeout:        10 * time.Second,
+	}
+}
+
+// LoadConfig loads webhook configuration from environment variables
+//   - WEBHOOK_SECRET: HMAC secret for callback_url deliveries
+//   - WEBHOOK_MAX_ATTEMPTS: delivery attempts before dead-lettering (default: 5)
+//   - WEBHOOK_TIMEOUT_SEC: per-request timeout in seconds (default: 10)
+//   - WEBHOOK_ALLOW_INTERNAL_TARGETS: "true" allows deliveries to loopback and link-local addresses
+func LoadConfig() *Config {
+	cfg := DefaultConfig()
+
+	cfg.Secret = os.Getenv("WEBHOOK_SECRET")
+
+	if attemptsStr := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attemptsStr != "" {
+		if attempts, err := strconv.Atoi(attemptsStr); err == nil && attempts > 0 {
+			cfg.MaxAttempts = attempts
+		}
+	}
+
+	if timeoutStr := os.Getenv("WEBHOOK_TIMEOUT_SEC"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
+			cfg.Timeout = time.Duration(timeout) * time.Second
+		}
+	}
+
+	cfg.AllowInternalTargets = os.Getenv("WEBHOOK_ALLOW_INTERNAL_TARGETS") == "true"
+
+	return cfg
+}
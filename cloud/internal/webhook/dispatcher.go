@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xiresource/cloud/internal/job"
+)
+
+const (
+	// SignatureHeader carries "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix timestamp (seconds) included in the signature
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader carries the event type
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader carries the delivery ID (stable across retries, for receiver-side deduplication)
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	// EventJobCompleted is sent when a job reaches a terminal state
+	EventJobCompleted = "job.completed"
+)
+
+// Payload is the JSON body POSTed to webhook targets
+type Payload struct {
+	Event        string     `json:"event"`
+	DeliveryID   string     `json:"delivery_id"`
+	JobID        string     `json:"job_id"`
+	Status       job.Status `json:"status"`
+	AttemptID    int        `json:"attempt_id"`
+	OutputBucket string     `json:"output_bucket"`
+	OutputKey    string     `json:"output_key"`
+	OutputPrefix string     `json:"output_prefix"`
+	Message      string     `json:"message"`
+	Reason       string     `json:"reason,omitempty"` // e.g. "TIMED_OUT" for a job that exceeded its timeout
+	Submitter    string     `json:"submitter,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	DurationMs   int64      `json:"duration_ms"` // Run time (started_at to finished_at), 0 if the job never started
+}
+
+// NewPayload builds the completion payload for a job
+func NewPayload(j *job.Job) Payload {
+	payload := Payload{
+		Event:        EventJobCompleted,
+		DeliveryID:   uuid.New().String(),
+		JobID:        j.JobID,
+		Status:       j.Status,
+		AttemptID:    j.AttemptID,
+		OutputBucket: j.OutputBucket,
+		OutputKey:    j.OutputKey,
+		OutputPrefix: j.OutputPrefix,
+		Message:      j.Message,
+		Reason:       j.Reason,
+		Submitter:    j.Submitter,
+		CreatedAt:    j.CreatedAt,
+		StartedAt:    j.StartedAt,
+		FinishedAt:   j.FinishedAt,
+	}
+	if j.StartedAt != nil && j.FinishedAt != nil {
+		payload.DurationMs = j.FinishedAt.Sub(*j.StartedAt).Milliseconds()
+	}
+	return payload
+}
+
+// Sign computes the signature header value for a delivery
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// target is one destination for a job notification
+type target struct {
+	url       string
+	secret    string
+	webhookID string // Empty for callback_url targets
+}
+
+// queueSize is the number of finished jobs buffered for Run before Enqueue hands jobs off to goroutines
+const queueSize = 1024
+
+// Dispatcher delivers job completion notifications with retries and dead-lettering
+type Dispatcher struct {
+	store    Store
+	jobStore job.Store
+	config   *Config
+	client   *http.Client
+	queue    chan string   // Job IDs waiting for Run to start their deliveries
+	done     chan struct{} // Closed when Run returns
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(store Store, jobStore job.Store, cfg *Config) *Dispatcher {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return &Dispatcher{
+		store:    store,
+		jobStore: jobStore,
+		config:   cfg,
+		client:   newHTTPClient(cfg),
+		queue:    make(chan string, queueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Enqueue queues the completion notifications of a job that has just reached a terminal state.
+// It never blocks: callers include the agent connection read loops. Unlike job events, notifications
+// are not dropped when the queue is full; the job is handed to a goroutine that waits for room instead.
+// Once Run has returned (shutdown) the notification is logged and discarded.
+func (d *Dispatcher) Enqueue(jobID string) {
+	select {
+	case d.queue <- jobID:
+	case <-d.done:
+		log.Printf("Webhook: dispatcher stopped, not notifying completion of job %s", jobID)
+	default:
+		go d.enqueueWait(jobID)
+	}
+}
+
+// enqueueWait queues a job once Run has made room in the queue
+func (d *Dispatcher) enqueueWait(jobID string) {
+	select {
+	case d.queue <- jobID:
+	case <-d.done:
+		log.Printf("Webhook: dispatcher stopped, not notifying completion of job %s", jobID)
+	}
+}
+
+// Run starts deliveries for queued jobs until ctx is canceled. It must be called once.
+func (d *Dispatcher) Run(ctx context.Context) {
+	defer close(d.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case jobID := <-d.queue:
+			d.Notify(ctx, jobID)
+		}
+	}
+}
+
+// Notify starts deliveries for a terminal job's callback_url and webhook subscription.
+// Deliveries run in the background; use Wait to block until they finish.
+func (d *Dispatcher) Notify(ctx context.Context, jobID string) {
+	j, err := d.jobStore.Get(jobID)
+	if err != nil {
+		log.Printf("Webhook: failed to load job %s: %v", jobID, err)
+		return
+	}
+	if !j.Status.IsTerminal() {
+		return
+	}
+
+	targets := d.targets(j)
+	if len(targets) == 0 {
+		return
+	}
+
+	payload := NewPayload(j)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Webhook: failed to encode payload for job %s: %v", jobID, err)
+		return
+	}
+
+	for _, t := range targets {
+		d.wg.Add(1)
+		go func(t target) {
+			defer d.wg.Done()
+			d.deliver(ctx, j.JobID, payload.DeliveryID, t, body)
+		}(t)
+	}
+}
+
+// Wait blocks until all in-flight deliveries have finished
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// targets resolves where a job's completion should be delivered
+func (d *Dispatcher) targets(j *job.Job) []target {
+	var targets []target
+	if j.CallbackURL != "" {
+		if d.config.Secret == "" {
+			// Never POST unsigned: the receiver could not tell a delivery from a forged request
+			log.Printf("Webhook: WEBHOOK_SECRET not set, skipping callback for job %s", j.JobID)
+		} else {
+			targets = append(targets, target{url: j.CallbackURL, secret: d.config.Secret})
+		}
+	}
+	if j.WebhookID != "" {
+		sub, err := d.store.GetSubscription(j.WebhookID)
+		if err != nil {
+			log.Printf("Webhook: subscription %s for job %s unavailable: %v", j.WebhookID, j.JobID, err)
+		} else {
+			targets = append(targets, target{url: sub.URL, secret: sub.Secret, webhookID: sub.ID})
+		}
+	}
+	return targets
+}
+
+// deliver POSTs the payload, retrying with exponential backoff, and dead-letters it after the last attempt
+func (d *Dispatcher) deliver(ctx context.Context, jobID, deliveryID string, t target, body []byte) {
+	backoff := d.config.InitialBackoff
+	attempts := 0
+	var lastErr error
+
+retry:
+	for attempts < d.config.MaxAttempts {
+		attempts++
+		lastErr = d.send(ctx, deliveryID, t, body)
+		if lastErr == nil {
+			log.Printf("Webhook for job %s delivered to %s (attempt %d)", jobID, redactURL(t.url), attempts)
+			return
+		}
+		log.Printf("Webhook for job %s to %s failed (attempt %d/%d): %v", jobID, redactURL(t.url), attempts, d.config.MaxAttempts, lastErr)
+
+		if attempts >= d.config.MaxAttempts || errors.Is(lastErr, ErrBlockedTarget) {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			lastErr = fmt.Errorf("delivery aborted after %v: %w", lastErr, ctx.Err())
+			break retry
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+	}
+
+	deadLetter := &DeadLetter{
+		JobID:     jobID,
+		WebhookID: t.webhookID,
+		URL:       t.url,
+		Payload:   string(body),
+		Attempts:  attempts,
+		LastError: lastErr.Error(),
+	}
+	if err := d.store.AddDeadLetter(deadLetter); err != nil {
+		log.Printf("Webhook: failed to record dead letter for job %s: %v", jobID, err)
+		return
+	}
+	log.Printf("Webhook for job %s to %s moved to dead letters after %d attempts", jobID, redactURL(t.url), attempts)
+}
+
+// send performs a single delivery attempt; any non-2xx response is an error
+func (d *Dispatcher) send(ctx context.Context, deliveryID string, t target, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xiresource-webhook/1.0")
+	req.Header.Set(EventHeader, EventJobCompleted)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if t.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(t.secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newHTTPClient creates the delivery client. Unless cfg.AllowInternalTargets is set, every connection is
+// checked after name resolution (including redirects), so a target URL cannot reach the cloud's own
+// host or the metadata service through a hostname that resolves to them.
+func newHTTPClient(cfg *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowInternalTargets {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkDialAddress,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}
+}
+
+// checkDialAddress is a net.Dialer Control function rejecting blocked target addresses
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedTargetIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedTarget, host)
+	}
+	return nil
+}
+
+// blockedTargetIP reports whether deliveries to ip are refused: loopback, link-local (which includes
+// the 169.254.169.254 metadata service), unspecified and multicast addresses, and the IPv6 metadata address
+func blockedTargetIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || ip.Equal(metadataIPv6)
+}
+
+// metadataIPv6 is the IPv6 address of the EC2-style instance metadata service
+var metadataIPv6 = net.ParseIP("fd00:ec2::254")
+
+// redactURL drops query string and credentials from a URL before logging (they may carry tokens)
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrInvalidURL           = errors.New("webhook url must be an absolute http or https URL")
+	ErrBlockedTarget        = errors.New("webhook target address is not allowed (loopback, link-local or metadata)")
+)
+
+// Subscription is a registered webhook endpoint that jobs can reference by ID
+type Subscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"` // HMAC signing secret (only returned once, on creation)
+	Description string    `json:"description"`
+	Owner       string    `json:"owner"` // API key name allowed to reference the subscription from jobs (admins always can)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DeadLetter records a delivery that failed after all retry attempts
+type DeadLetter struct {
+	ID        int64     `json:"id"`
+	JobID     string    `json:"job_id"`
+	WebhookID string    `json:"webhook_id,omitempty"` // Empty for per-job callback_url deliveries
+	URL       string    `json:"url"`
+	Payload   string    `json:"payload"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store defines the interface for webhook persistence
+type Store interface {
+	// CreateSubscription creates a new webhook subscription
+	CreateSubscription(sub *Subscription) error
+
+	// GetSubscription retrieves a subscription by ID
+	GetSubscription(id string) (*Subscription, error)
+
+	// ListSubscriptions returns all subscriptions
+	ListSubscriptions() ([]*Subscription, error)
+
+	// DeleteSubscription deletes a subscription
+	DeleteSubscription(id string) error
+
+	// AddDeadLetter records a failed delivery
+	AddDeadLetter(dl *DeadLetter) error
+
+	// ListDeadLetters returns failed deliveries, newest first
+	ListDeadLetters(limit int, offset int) ([]*DeadLetter, error)
+
+	// Close closes the database connection
+	Close() error
+}
+
+// sqlStore holds the queries shared by the SQLite and MySQL stores
+type sqlStore struct {
+	db *sql.DB
+}
+
+// SQLiteStore implements Store using SQLite
+type SQLiteStore struct {
+	sqlStore
+}
+
+// MySQLStore implements Store using MySQL
+type MySQLStore struct {
+	sqlStore
+}
+
+// NewSQLiteStore creates a new SQLite webhook store
+func NewSQLiteStore(dbPath string) (Store, error) {
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if dbPath == ":memory:" {
+		// Each connection to :memory: is a separate database
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLiteStore{sqlStore{db: db}}
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return store, nil
+}
+
+// initSchema creates the webhook tables if they don't exist
+func (s *SQLiteStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		description TEXT,
+		owner TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		webhook_id TEXT,
+		url TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		last_error TEXT,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_created_at ON webhook_dead_letters(created_at);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Add columns introduced after the table was first created
+	if _, err := s.db.Exec(`ALTER TABLE webhooks ADD COLUMN owner TEXT NOT NULL DEFAULT ''`); err != nil &&
+		!strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+		return fmt.Errorf("failed to add owner column: %w", err)
+	}
+	return nil
+}
+
+// NewMySQLStore creates a new MySQL webhook store
+func NewMySQLStore(host string, port int, user, password, database, params string) (Store, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", user, password, host, port, database)
+	if params != "" {
+		dsn += "?" + params
+	} else {
+		dsn += "?charset=utf8mb4&parseTime=True&loc=Local"
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	store := &MySQLStore{sqlStore{db: db}}
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return store, nil
+}
+
+// initSchema creates the webhook tables if they don't exist
+func (s *MySQLStore) initSchema() error {
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id VARCHAR(255) PRIMARY KEY,
+			url VARCHAR(2048) NOT NULL,
+			secret VARCHAR(255) NOT NULL,
+			description VARCHAR(1024),
+			owner VARCHAR(255) NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			job_id VARCHAR(255) NOT NULL,
+			webhook_id VARCHAR(255),
+			url VARCHAR(2048) NOT NULL,
+			payload TEXT NOT NULL,
+			attempts INT NOT NULL,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			INDEX idx_webhook_dead_letters_created_at (created_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	}
+	for _, table := range tables {
+		if _, err := s.db.Exec(table); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	// Add columns introduced after the table was first created
+	if _, err := s.db.Exec(`ALTER TABLE webhooks ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT ''`); err != nil {
+		errStr := strings.ToLower(err.Error())
+		if !strings.Contains(errStr, "duplicate column") && !strings.Contains(errStr, "1060") {
+			return fmt.Errorf("failed to add owner column: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewStore creates a webhook store in the same database as the job store
+func NewStore(cfg *job.DBConfig) (Store, error) {
+	if cfg.IsMySQLConfigured() {
+		return NewMySQLStore(
+			cfg.MySQLHost,
+			cfg.MySQLPort,
+			cfg.MySQLUser,
+			cfg.MySQLPassword,
+			cfg.MySQLDatabase,
+			cfg.MySQLParams,
+		)
+	}
+	return NewSQLiteStore(cfg.SQLitePath)
+}
+
+// CreateSubscription creates a new webhook subscription
+func (s *sqlStore) CreateSubscription(sub *Subscription) error {
+	if err := ValidateURL(sub.URL); err != nil {
+		return err
+	}
+	query := `INSERT INTO webhooks (id, url, secret, description, owner, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, sub.ID, sub.URL, sub.Secret, sub.Description, sub.Owner, sub.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// GetSubscription retrieves a subscription by ID
+func (s *sqlStore) GetSubscription(id string) (*Subscription, error) {
+	query := `SELECT id, url, secret, description, owner, created_at FROM webhooks WHERE id = ?`
+	var sub Subscription
+	var description sql.NullString
+	err := s.db.QueryRow(query, id).Scan(&sub.ID, &sub.URL, &sub.Secret, &description, &sub.Owner, &sub.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	sub.Description = description.String
+	return &sub, nil
+}
+
+// ListSubscriptions returns all subscriptions
+func (s *sqlStore) ListSubscriptions() ([]*Subscription, error) {
+	query := `SELECT id, url, secret, description, owner, created_at FROM webhooks ORDER BY created_at DESC`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []*Subscription{}
+	for rows.Next() {
+		var sub Subscription
+		var description sql.NullString
+		if err := rows.Scan(&sub.ID, &sub.URL, &sub.Secret, &description, &sub.Owner, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		sub.Description = description.String
+		subs = append(subs, &sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteSubscription deletes a subscription
+func (s *sqlStore) DeleteSubscription(id string) error {
+	result, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// AddDeadLetter records a failed delivery
+func (s *sqlStore) AddDeadLetter(dl *DeadLetter) error {
+	if dl.CreatedAt.IsZero() {
+		dl.CreatedAt = time.Now()
+	}
+	query := `
+	INSERT INTO webhook_dead_letters (job_id, webhook_id, url, payload, attempts, last_error, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, dl.JobID, dl.WebhookID, dl.URL, dl.Payload, dl.Attempts, dl.LastError, dl.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to add dead letter: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		dl.ID = id
+	}
+	return nil
+}
+
+// ListDeadLetters returns failed deliveries, newest first
+func (s *sqlStore) ListDeadLetters(limit int, offset int) ([]*DeadLetter, error) {
+	query := `
+	SELECT id, job_id, webhook_id, url, payload, attempts, last_error, created_at
+	FROM webhook_dead_letters
+	ORDER BY created_at DESC, id DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	deadLetters := []*DeadLetter{}
+	for rows.Next() {
+		var dl DeadLetter
+		var webhookID, lastError sql.NullString
+		if err := rows.Scan(&dl.ID, &dl.JobID, &webhookID, &dl.URL, &dl.Payload, &dl.Attempts, &lastError, &dl.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+		dl.WebhookID = webhookID.String
+		dl.LastError = lastError.String
+		deadLetters = append(deadLetters, &dl)
+	}
+	return deadLetters, rows.Err()
+}
+
+// Close closes the database connection
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// ValidateURL checks that a webhook target is an absolute http(s) URL
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return ErrInvalidURL
+	}
+	if len(rawURL) > 2048 {
+		return fmt.Errorf("%w: exceeds 2048 characters", ErrInvalidURL)
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiresource/cloud/internal/job"
+)
+
+func setupTestStores(t *testing.T) (Store, job.Store) {
+	tmpFile, err := os.CreateTemp("", "test_webhooks_*.db")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	store, err := NewSQLiteStore(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to create webhook store: %v", err)
+	}
+	jobStore, err := job.NewSQLiteStore(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to create job store: %v", err)
+	}
+
+	t.Cleanup(func() {
+		store.Close()
+		jobStore.Close()
+		os.Remove(tmpFile.Name())
+	})
+	return store, jobStore
+}
+
+// createFinishedJob creates a job and drives it to the given terminal status
+func createFinishedJob(t *testing.T, jobStore job.Store, j *job.Job, final job.Status) {
+	t.Helper()
+	j.CreatedAt = time.Now()
+	j.Status = job.StatusPending
+	j.OutputBucket = "output-bucket"
+	j.AttemptID = 1
+	if err := jobStore.Create(j); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	for _, status := range []job.Status{job.StatusAssigned, job.StatusRunning, final} {
+		if err := jobStore.UpdateStatus(j.JobID, status); err != nil {
+			t.Fatalf("Failed to update status to %s: %v", status, err)
+		}
+	}
+}
+
+func testConfig(secret string) *Config {
+	return &Config{
+		Secret:         secret,
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Timeout:        time.Second,
+		// Test servers listen on loopback
+		AllowInternalTargets: true,
+	}
+}
+
+func TestStore_Subscriptions(t *testing.T) {
+	store, _ := setupTestStores(t)
+
+	sub := &Subscription{ID: "wh-1", URL: "https://example.com/hook", Secret: "s3cret", Description: "lab", Owner: "lab", CreatedAt: time.Now()}
+	if err := store.CreateSubscription(sub); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	if err := store.CreateSubscription(&Subscription{ID: "wh-2", URL: "ftp://example.com", CreatedAt: time.Now()}); err == nil {
+		t.Error("Expected error for non-http URL")
+	}
+
+	got, err := store.GetSubscription("wh-1")
+	if err != nil {
+		t.Fatalf("GetSubscription() error = %v", err)
+	}
+	if got.URL != sub.URL || got.Secret != sub.Secret || got.Description != sub.Description || got.Owner != sub.Owner {
+		t.Errorf("GetSubscription() = %+v, want %+v", got, sub)
+	}
+
+	subs, err := store.ListSubscriptions()
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("ListSubscriptions() = %d subs, err %v, want 1", len(subs), err)
+	}
+
+	if err := store.DeleteSubscription("wh-1"); err != nil {
+		t.Fatalf("DeleteSubscription() error = %v", err)
+	}
+	if _, err := store.GetSubscription("wh-1"); err != ErrSubscriptionNotFound {
+		t.Errorf("GetSubscription() after delete error = %v, want ErrSubscriptionNotFound", err)
+	}
+	if err := store.DeleteSubscription("wh-1"); err != ErrSubscriptionNotFound {
+		t.Errorf("DeleteSubscription() twice error = %v, want ErrSubscriptionNotFound", err)
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	var mu sync.Mutex
+	var received []Payload
+	var signatures []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			// First attempt fails to exercise the retry path
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), Sign("callback-secret", r.Header.Get(TimestampHeader), body); got != want {
+			t.Errorf("Signature = %s, want %s", got, want)
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if r.Header.Get(DeliveryHeader) != p.DeliveryID {
+			t.Errorf("Delivery header = %s, want %s", r.Header.Get(DeliveryHeader), p.DeliveryID)
+		}
+		received = append(received, p)
+		signatures = append(signatures, r.Header.Get(SignatureHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	j := &job.Job{JobID: "job-webhook-1", CallbackURL: server.URL + "/callback?token=abc", Message: "done"}
+	createFinishedJob(t, jobStore, j, job.StatusSucceeded)
+
+	d := NewDispatcher(store, jobStore, testConfig("callback-secret"))
+	d.Notify(context.Background(), j.JobID)
+	d.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	if len(received) != 1 {
+		t.Fatalf("received %d payloads, want 1", len(received))
+	}
+	p := received[0]
+	if p.Event != EventJobCompleted || p.JobID != j.JobID || p.Status != job.StatusSucceeded || p.Message != "done" {
+		t.Errorf("Unexpected payload: %+v", p)
+	}
+	if p.StartedAt == nil || p.FinishedAt == nil {
+		t.Errorf("Expected timing in payload, got started=%v finished=%v", p.StartedAt, p.FinishedAt)
+	}
+
+	deadLetters, _ := store.ListDeadLetters(10, 0)
+	if len(deadLetters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(deadLetters))
+	}
+}
+
+func TestDispatcher_DeadLetterAfterRetries(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		if r.Header.Get(SignatureHeader) != Sign("sub-secret", r.Header.Get(TimestampHeader), mustReadAll(r.Body)) {
+			t.Error("Subscription delivery not signed with the subscription secret")
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sub := &Subscription{ID: "wh-dead", URL: server.URL, Secret: "sub-secret", CreatedAt: time.Now()}
+	if err := store.CreateSubscription(sub); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	j := &job.Job{JobID: "job-webhook-2", WebhookID: sub.ID}
+	createFinishedJob(t, jobStore, j, job.StatusFailed)
+
+	d := NewDispatcher(store, jobStore, testConfig(""))
+	d.Notify(context.Background(), j.JobID)
+	d.Wait()
+
+	mu.Lock()
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+	mu.Unlock()
+
+	deadLetters, err := store.ListDeadLetters(10, 0)
+	if err != nil {
+		t.Fatalf("ListDeadLetters() error = %v", err)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(deadLetters))
+	}
+	dl := deadLetters[0]
+	if dl.JobID != j.JobID || dl.WebhookID != sub.ID || dl.Attempts != 3 || dl.LastError == "" {
+		t.Errorf("Unexpected dead letter: %+v", dl)
+	}
+	var p Payload
+	if err := json.Unmarshal([]byte(dl.Payload), &p); err != nil || p.Status != job.StatusFailed {
+		t.Errorf("Dead letter payload = %s (err %v), want FAILED payload", dl.Payload, err)
+	}
+}
+
+func TestDispatcher_RefusesInternalTargets(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	// The hostname resolves to loopback: the check applies to resolved addresses, not the URL
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	j := &job.Job{JobID: "job-webhook-internal", CallbackURL: "http://localhost" + port + "/callback"}
+	createFinishedJob(t, jobStore, j, job.StatusSucceeded)
+
+	cfg := testConfig("secret")
+	cfg.AllowInternalTargets = false
+	d := NewDispatcher(store, jobStore, cfg)
+	d.Notify(context.Background(), j.JobID)
+	d.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("Internal target received %d deliveries, want 0", n)
+	}
+	deadLetters, err := store.ListDeadLetters(10, 0)
+	if err != nil {
+		t.Fatalf("ListDeadLetters() error = %v", err)
+	}
+	// Blocked targets are not retried
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 1 || !strings.Contains(deadLetters[0].LastError, "not allowed") {
+		t.Fatalf("Dead letters = %+v, want one blocked delivery after 1 attempt", deadLetters)
+	}
+}
+
+func TestBlockedTargetIP(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":        true,
+		"::1":              true,
+		"169.254.169.254":  true,
+		"fe80::1":          true,
+		"fd00:ec2::254":    true,
+		"0.0.0.0":          true,
+		"224.0.0.1":        true,
+		"::ffff:127.0.0.1": true,
+		"10.1.2.3":         false,
+		"93.184.216.34":    false,
+		"2606:4700::1111":  false,
+	}
+	for addr, want := range cases {
+		if got := blockedTargetIP(net.ParseIP(addr)); got != want {
+			t.Errorf("blockedTargetIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestDispatcher_RunDeliversQueuedJobs(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	delivered := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		delivered <- p.JobID
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(store, jobStore, testConfig("secret"))
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx)
+
+	j := &job.Job{JobID: "job-webhook-3", CallbackURL: server.URL}
+	createFinishedJob(t, jobStore, j, job.StatusCanceled)
+	d.Enqueue(j.JobID)
+
+	select {
+	case id := <-delivered:
+		if id != j.JobID {
+			t.Errorf("Delivered job %s, want %s", id, j.JobID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook delivery")
+	}
+
+	// After shutdown Enqueue returns instead of blocking
+	cancel()
+	d.Wait()
+	<-d.done
+	d.Enqueue(j.JobID)
+	select {
+	case id := <-delivered:
+		t.Errorf("Unexpected delivery for %s after shutdown", id)
+	default:
+	}
+}
+
+func TestDispatcher_EnqueueDoesNotBlockWhenFull(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	delivered := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		delivered <- p.JobID
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(store, jobStore, testConfig("secret"))
+	d.queue = make(chan string, 1)
+
+	want := map[string]bool{}
+	for _, id := range []string{"job-webhook-full-1", "job-webhook-full-2", "job-webhook-full-3"} {
+		createFinishedJob(t, jobStore, &job.Job{JobID: id, CallbackURL: server.URL}, job.StatusSucceeded)
+		want[id] = true
+	}
+
+	// Run is not started yet, so the queue fills after the first job
+	enqueued := make(chan struct{})
+	go func() {
+		for id := range want {
+			d.Enqueue(id)
+		}
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	for n := len(want); n > 0; n-- {
+		select {
+		case id := <-delivered:
+			if !want[id] {
+				t.Errorf("Unexpected delivery for %s", id)
+			}
+			delete(want, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for webhook deliveries, missing %v", want)
+		}
+	}
+	d.Wait()
+}
+
+func TestDispatcher_SkipsUnsignedCallbacks(t *testing.T) {
+	store, jobStore := setupTestStores(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	j := &job.Job{JobID: "job-webhook-unsigned", CallbackURL: server.URL}
+	createFinishedJob(t, jobStore, j, job.StatusSucceeded)
+
+	d := NewDispatcher(store, jobStore, testConfig(""))
+	d.Notify(context.Background(), j.JobID)
+	d.Wait()
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("Callback without WEBHOOK_SECRET was delivered %d times, want 0", n)
+	}
+}
+
+func mustReadAll(r io.Reader) []byte {
+	data, _ := io.ReadAll(r)
+	return data
+}
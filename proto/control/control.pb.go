@@ -90,6 +90,7 @@ const (
 	JobTypeEnum_JOB_TYPE_UNKNOWN      JobTypeEnum = 0
 	JobTypeEnum_JOB_TYPE_COMMAND      JobTypeEnum = 1 // Execute command on agent
 	JobTypeEnum_JOB_TYPE_FORWARD_HTTP JobTypeEnum = 2 // Forward request to local HTTP service on agent
+	JobTypeEnum_JOB_TYPE_FORWARD_GRPC JobTypeEnum = 3 // Call a unary method of a local gRPC service on agent
 )
 
 // Enum value maps for JobTypeEnum.
@@ -98,11 +99,13 @@ var (
 		0: "JOB_TYPE_UNKNOWN",
 		1: "JOB_TYPE_COMMAND",
 		2: "JOB_TYPE_FORWARD_HTTP",
+		3: "JOB_TYPE_FORWARD_GRPC",
 	}
 	JobTypeEnum_value = map[string]int32{
 		"JOB_TYPE_UNKNOWN":      0,
 		"JOB_TYPE_COMMAND":      1,
 		"JOB_TYPE_FORWARD_HTTP": 2,
+		"JOB_TYPE_FORWARD_GRPC": 3,
 	}
 )
 
@@ -183,6 +186,56 @@ func (InputForwardMode) EnumDescriptor() ([]byte, []int) {
 	return file_control_proto_rawDescGZIP(), []int{2}
 }
 
+// LogStream: output stream of a command
+type LogStream int32
+
+const (
+	LogStream_LOG_STREAM_UNSPECIFIED LogStream = 0
+	LogStream_LOG_STREAM_STDOUT      LogStream = 1
+	LogStream_LOG_STREAM_STDERR      LogStream = 2
+)
+
+// Enum value maps for LogStream.
+var (
+	LogStream_name = map[int32]string{
+		0: "LOG_STREAM_UNSPECIFIED",
+		1: "LOG_STREAM_STDOUT",
+		2: "LOG_STREAM_STDERR",
+	}
+	LogStream_value = map[string]int32{
+		"LOG_STREAM_UNSPECIFIED": 0,
+		"LOG_STREAM_STDOUT":      1,
+		"LOG_STREAM_STDERR":      2,
+	}
+)
+
+func (x LogStream) Enum() *LogStream {
+	p := new(LogStream)
+	*p = x
+	return p
+}
+
+func (x LogStream) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (LogStream) Descriptor() protoreflect.EnumDescriptor {
+	return file_control_proto_enumTypes[3].Descriptor()
+}
+
+func (LogStream) Type() protoreflect.EnumType {
+	return &file_control_proto_enumTypes[3]
+}
+
+func (x LogStream) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use LogStream.Descriptor instead.
+func (LogStream) EnumDescriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
 // Envelope wraps all messages for forward compatibility
 type Envelope struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -201,6 +254,12 @@ type Envelope struct {
 	//	*Envelope_RequestJob
 	//	*Envelope_JobAssigned
 	//	*Envelope_JobStatus
+	//	*Envelope_RefreshAccess
+	//	*Envelope_RefreshAccessAck
+	//	*Envelope_LogChunk
+	//	*Envelope_LogChunkAck
+	//	*Envelope_JobProgress
+	//	*Envelope_CancelJob
 	Payload       isEnvelope_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -327,6 +386,60 @@ func (x *Envelope) GetJobStatus() *JobStatus {
 	return nil
 }
 
+func (x *Envelope) GetRefreshAccess() *RefreshAccess {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_RefreshAccess); ok {
+			return x.RefreshAccess
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetRefreshAccessAck() *RefreshAccessAck {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_RefreshAccessAck); ok {
+			return x.RefreshAccessAck
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetLogChunk() *LogChunk {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_LogChunk); ok {
+			return x.LogChunk
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetLogChunkAck() *LogChunkAck {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_LogChunkAck); ok {
+			return x.LogChunkAck
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetJobProgress() *JobProgress {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_JobProgress); ok {
+			return x.JobProgress
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetCancelJob() *CancelJob {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_CancelJob); ok {
+			return x.CancelJob
+		}
+	}
+	return nil
+}
+
 type isEnvelope_Payload interface {
 	isEnvelope_Payload()
 }
@@ -359,6 +472,30 @@ type Envelope_JobStatus struct {
 	JobStatus *JobStatus `protobuf:"bytes,16,opt,name=job_status,json=jobStatus,proto3,oneof"`
 }
 
+type Envelope_RefreshAccess struct {
+	RefreshAccess *RefreshAccess `protobuf:"bytes,17,opt,name=refresh_access,json=refreshAccess,proto3,oneof"`
+}
+
+type Envelope_RefreshAccessAck struct {
+	RefreshAccessAck *RefreshAccessAck `protobuf:"bytes,18,opt,name=refresh_access_ack,json=refreshAccessAck,proto3,oneof"`
+}
+
+type Envelope_LogChunk struct {
+	LogChunk *LogChunk `protobuf:"bytes,19,opt,name=log_chunk,json=logChunk,proto3,oneof"`
+}
+
+type Envelope_LogChunkAck struct {
+	LogChunkAck *LogChunkAck `protobuf:"bytes,20,opt,name=log_chunk_ack,json=logChunkAck,proto3,oneof"`
+}
+
+type Envelope_JobProgress struct {
+	JobProgress *JobProgress `protobuf:"bytes,21,opt,name=job_progress,json=jobProgress,proto3,oneof"`
+}
+
+type Envelope_CancelJob struct {
+	CancelJob *CancelJob `protobuf:"bytes,22,opt,name=cancel_job,json=cancelJob,proto3,oneof"`
+}
+
 func (*Envelope_Register) isEnvelope_Payload() {}
 
 func (*Envelope_Heartbeat) isEnvelope_Payload() {}
@@ -373,14 +510,30 @@ func (*Envelope_JobAssigned) isEnvelope_Payload() {}
 
 func (*Envelope_JobStatus) isEnvelope_Payload() {}
 
+func (*Envelope_RefreshAccess) isEnvelope_Payload() {}
+
+func (*Envelope_RefreshAccessAck) isEnvelope_Payload() {}
+
+func (*Envelope_LogChunk) isEnvelope_Payload() {}
+
+func (*Envelope_LogChunkAck) isEnvelope_Payload() {}
+
+func (*Envelope_JobProgress) isEnvelope_Payload() {}
+
+func (*Envelope_CancelJob) isEnvelope_Payload() {}
+
 // Register: Agent registers with cloud on connection
 type Register struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
-	AgentId        string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	AgentToken     string `protobuf:"bytes,2,opt,name=agent_token,json=agentToken,proto3" json:"agent_token,omitempty"` // Pre-shared secret (MVP)
-	Hostname       string `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	MaxConcurrency int32  `protobuf:"varint,4,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"` // Default 1
+	AgentId        string   `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	AgentToken     string   `protobuf:"bytes,2,opt,name=agent_token,json=agentToken,proto3" json:"agent_token,omitempty"` // Pre-shared secret (MVP)
+	Hostname       string   `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	MaxConcurrency int32    `protobuf:"varint,4,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"` // Default 1
+	Templates      []string `protobuf:"bytes,5,rep,name=templates,proto3" json:"templates,omitempty"`                                  // Job templates this agent runs (jobs naming a template are only assigned to agents that have it)
+	// Targets this agent forwards FORWARD_HTTP and FORWARD_GRPC requests to (forward jobs are only assigned to agents
+	// that permit their URL; a gRPC call is checked as http://{target}/{package.Service}/{Method})
+	ForwardTargets []*ForwardTarget `protobuf:"bytes,6,rep,name=forward_targets,json=forwardTargets,proto3" json:"forward_targets,omitempty"`
 	unknownFields  protoimpl.UnknownFields
 	sizeCache      protoimpl.SizeCache
 }
@@ -443,6 +596,89 @@ func (x *Register) GetMaxConcurrency() int32 {
 	return 0
 }
 
+func (x *Register) GetTemplates() []string {
+	if x != nil {
+		return x.Templates
+	}
+	return nil
+}
+
+func (x *Register) GetForwardTargets() []*ForwardTarget {
+	if x != nil {
+		return x.ForwardTargets
+	}
+	return nil
+}
+
+// ForwardTarget: a permitted target of forward requests. A URL matches when every set field matches.
+type ForwardTarget struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scheme        string                 `protobuf:"bytes,1,opt,name=scheme,proto3" json:"scheme,omitempty"`                           // "http" or "https"; empty: both
+	Host          string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`                               // Host name or IP (case-insensitive); "loopback": localhost, 127.0.0.0/8 and ::1
+	Port          int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`                              // 0: any port
+	PathPrefix    string                 `protobuf:"bytes,4,opt,name=path_prefix,json=pathPrefix,proto3" json:"path_prefix,omitempty"` // Path prefix on segment boundaries (e.g. "/api" matches /api and /api/run); empty: any path
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardTarget) Reset() {
+	*x = ForwardTarget{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardTarget) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardTarget) ProtoMessage() {}
+
+func (x *ForwardTarget) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardTarget.ProtoReflect.Descriptor instead.
+func (*ForwardTarget) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ForwardTarget) GetScheme() string {
+	if x != nil {
+		return x.Scheme
+	}
+	return ""
+}
+
+func (x *ForwardTarget) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *ForwardTarget) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *ForwardTarget) GetPathPrefix() string {
+	if x != nil {
+		return x.PathPrefix
+	}
+	return ""
+}
+
 // RegisterAck: Server acknowledges registration
 type RegisterAck struct {
 	state                protoimpl.MessageState `protogen:"open.v1"`
@@ -455,7 +691,7 @@ type RegisterAck struct {
 
 func (x *RegisterAck) Reset() {
 	*x = RegisterAck{}
-	mi := &file_control_proto_msgTypes[2]
+	mi := &file_control_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -467,7 +703,7 @@ func (x *RegisterAck) String() string {
 func (*RegisterAck) ProtoMessage() {}
 
 func (x *RegisterAck) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[2]
+	mi := &file_control_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -480,7 +716,7 @@ func (x *RegisterAck) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RegisterAck.ProtoReflect.Descriptor instead.
 func (*RegisterAck) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{2}
+	return file_control_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *RegisterAck) GetSuccess() bool {
@@ -517,7 +753,7 @@ type Heartbeat struct {
 
 func (x *Heartbeat) Reset() {
 	*x = Heartbeat{}
-	mi := &file_control_proto_msgTypes[3]
+	mi := &file_control_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -529,7 +765,7 @@ func (x *Heartbeat) String() string {
 func (*Heartbeat) ProtoMessage() {}
 
 func (x *Heartbeat) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[3]
+	mi := &file_control_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -542,7 +778,7 @@ func (x *Heartbeat) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
 func (*Heartbeat) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{3}
+	return file_control_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *Heartbeat) GetAgentId() string {
@@ -576,7 +812,7 @@ type HeartbeatAck struct {
 
 func (x *HeartbeatAck) Reset() {
 	*x = HeartbeatAck{}
-	mi := &file_control_proto_msgTypes[4]
+	mi := &file_control_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -588,7 +824,7 @@ func (x *HeartbeatAck) String() string {
 func (*HeartbeatAck) ProtoMessage() {}
 
 func (x *HeartbeatAck) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[4]
+	mi := &file_control_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -601,7 +837,7 @@ func (x *HeartbeatAck) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HeartbeatAck.ProtoReflect.Descriptor instead.
 func (*HeartbeatAck) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{4}
+	return file_control_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *HeartbeatAck) GetSuccess() bool {
@@ -622,7 +858,7 @@ type Header struct {
 
 func (x *Header) Reset() {
 	*x = Header{}
-	mi := &file_control_proto_msgTypes[5]
+	mi := &file_control_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -634,7 +870,7 @@ func (x *Header) String() string {
 func (*Header) ProtoMessage() {}
 
 func (x *Header) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[5]
+	mi := &file_control_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -647,7 +883,7 @@ func (x *Header) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Header.ProtoReflect.Descriptor instead.
 func (*Header) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{5}
+	return file_control_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Header) GetKey() string {
@@ -672,13 +908,14 @@ type ForwardHttpRequest struct {
 	Headers       []*Header              `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty"`                          // Optional headers to pass through
 	Body          []byte                 `protobuf:"bytes,4,opt,name=body,proto3" json:"body,omitempty"`                                // Optional raw body (UTF-8 or binary)
 	TimeoutSec    int32                  `protobuf:"varint,5,opt,name=timeout_sec,json=timeoutSec,proto3" json:"timeout_sec,omitempty"` // Optional request timeout (seconds)
+	Async         *ForwardAsync          `protobuf:"bytes,6,opt,name=async,proto3" json:"async,omitempty"`                              // Optional: the request submits a task that is polled until it finishes
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ForwardHttpRequest) Reset() {
 	*x = ForwardHttpRequest{}
-	mi := &file_control_proto_msgTypes[6]
+	mi := &file_control_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -690,7 +927,7 @@ func (x *ForwardHttpRequest) String() string {
 func (*ForwardHttpRequest) ProtoMessage() {}
 
 func (x *ForwardHttpRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[6]
+	mi := &file_control_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -703,7 +940,7 @@ func (x *ForwardHttpRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ForwardHttpRequest.ProtoReflect.Descriptor instead.
 func (*ForwardHttpRequest) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{6}
+	return file_control_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ForwardHttpRequest) GetUrl() string {
@@ -741,34 +978,46 @@ func (x *ForwardHttpRequest) GetTimeoutSec() int32 {
 	return 0
 }
 
-// STSCreds: STS temporary credentials for OSS access
-type STSCreds struct {
+func (x *ForwardHttpRequest) GetAsync() *ForwardAsync {
+	if x != nil {
+		return x.Async
+	}
+	return nil
+}
+
+// ForwardAsync: asynchronous forward mode. The forward request submits a task; the agent reads its ID
+// from the JSON response, then polls status_url (or waits for a POST to the X-Callback-URL it sent)
+// until the task state is succeeded or failed, and uploads the result. Empty fields use the defaults.
+type ForwardAsync struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
-	AccessKeyId     string                 `protobuf:"bytes,1,opt,name=access_key_id,json=accessKeyId,proto3" json:"access_key_id,omitempty"`
-	AccessKeySecret string                 `protobuf:"bytes,2,opt,name=access_key_secret,json=accessKeySecret,proto3" json:"access_key_secret,omitempty"`
-	SecurityToken   string                 `protobuf:"bytes,3,opt,name=security_token,json=securityToken,proto3" json:"security_token,omitempty"`
-	Endpoint        string                 `protobuf:"bytes,4,opt,name=endpoint,proto3" json:"endpoint,omitempty"`                             // OSS endpoint (e.g., oss-cn-hangzhou.aliyuncs.com)
-	Bucket          string                 `protobuf:"bytes,5,opt,name=bucket,proto3" json:"bucket,omitempty"`                                 // Bucket name
-	ExpiresAtMs     int64                  `protobuf:"varint,6,opt,name=expires_at_ms,json=expiresAtMs,proto3" json:"expires_at_ms,omitempty"` // Expiration timestamp (Unix milliseconds) - for agent to check validity
+	TaskIdField     string                 `protobuf:"bytes,1,opt,name=task_id_field,json=taskIdField,proto3" json:"task_id_field,omitempty"`              // JSON field of the submit response holding the task ID (default "task_id")
+	StatusUrl       string                 `protobuf:"bytes,2,opt,name=status_url,json=statusUrl,proto3" json:"status_url,omitempty"`                      // Status URL template with {task_id} (empty: callback only)
+	PollIntervalSec int32                  `protobuf:"varint,3,opt,name=poll_interval_sec,json=pollIntervalSec,proto3" json:"poll_interval_sec,omitempty"` // Seconds between status requests (default 5)
+	StateField      string                 `protobuf:"bytes,4,opt,name=state_field,json=stateField,proto3" json:"state_field,omitempty"`                   // JSON field of a status holding the state (default "status")
+	SucceededStates []string               `protobuf:"bytes,5,rep,name=succeeded_states,json=succeededStates,proto3" json:"succeeded_states,omitempty"`    // Default: succeeded, success, completed, done
+	FailedStates    []string               `protobuf:"bytes,6,rep,name=failed_states,json=failedStates,proto3" json:"failed_states,omitempty"`             // Default: failed, error, canceled, cancelled (other states: running)
+	ResultUrl       string                 `protobuf:"bytes,7,opt,name=result_url,json=resultUrl,proto3" json:"result_url,omitempty"`                      // Result URL template with {task_id}
+	ResultUrlField  string                 `protobuf:"bytes,8,opt,name=result_url_field,json=resultUrlField,proto3" json:"result_url_field,omitempty"`     // JSON field of the final status holding the result URL
+	MessageField    string                 `protobuf:"bytes,9,opt,name=message_field,json=messageField,proto3" json:"message_field,omitempty"`             // JSON field of a failed status holding the error (default "error")
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
 
-func (x *STSCreds) Reset() {
-	*x = STSCreds{}
-	mi := &file_control_proto_msgTypes[7]
+func (x *ForwardAsync) Reset() {
+	*x = ForwardAsync{}
+	mi := &file_control_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *STSCreds) String() string {
+func (x *ForwardAsync) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*STSCreds) ProtoMessage() {}
+func (*ForwardAsync) ProtoMessage() {}
 
-func (x *STSCreds) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[7]
+func (x *ForwardAsync) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -779,81 +1028,104 @@ func (x *STSCreds) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use STSCreds.ProtoReflect.Descriptor instead.
-func (*STSCreds) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{7}
+// Deprecated: Use ForwardAsync.ProtoReflect.Descriptor instead.
+func (*ForwardAsync) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
 }
 
-func (x *STSCreds) GetAccessKeyId() string {
+func (x *ForwardAsync) GetTaskIdField() string {
 	if x != nil {
-		return x.AccessKeyId
+		return x.TaskIdField
 	}
 	return ""
 }
 
-func (x *STSCreds) GetAccessKeySecret() string {
+func (x *ForwardAsync) GetStatusUrl() string {
 	if x != nil {
-		return x.AccessKeySecret
+		return x.StatusUrl
 	}
 	return ""
 }
 
-func (x *STSCreds) GetSecurityToken() string {
+func (x *ForwardAsync) GetPollIntervalSec() int32 {
 	if x != nil {
-		return x.SecurityToken
+		return x.PollIntervalSec
+	}
+	return 0
+}
+
+func (x *ForwardAsync) GetStateField() string {
+	if x != nil {
+		return x.StateField
 	}
 	return ""
 }
 
-func (x *STSCreds) GetEndpoint() string {
+func (x *ForwardAsync) GetSucceededStates() []string {
 	if x != nil {
-		return x.Endpoint
+		return x.SucceededStates
+	}
+	return nil
+}
+
+func (x *ForwardAsync) GetFailedStates() []string {
+	if x != nil {
+		return x.FailedStates
+	}
+	return nil
+}
+
+func (x *ForwardAsync) GetResultUrl() string {
+	if x != nil {
+		return x.ResultUrl
 	}
 	return ""
 }
 
-func (x *STSCreds) GetBucket() string {
+func (x *ForwardAsync) GetResultUrlField() string {
 	if x != nil {
-		return x.Bucket
+		return x.ResultUrlField
 	}
 	return ""
 }
 
-func (x *STSCreds) GetExpiresAtMs() int64 {
+func (x *ForwardAsync) GetMessageField() string {
 	if x != nil {
-		return x.ExpiresAtMs
+		return x.MessageField
 	}
-	return 0
+	return ""
 }
 
-// OSSAccess: OSS access credentials (presigned URL or STS)
-// Exactly one of presigned_url or sts must be set.
-type OSSAccess struct {
-	state protoimpl.MessageState `protogen:"open.v1"`
-	// Types that are valid to be assigned to Auth:
-	//
-	//	*OSSAccess_PresignedUrl
-	//	*OSSAccess_Sts
-	Auth          isOSSAccess_Auth `protobuf_oneof:"auth"`
+// ForwardGrpcRequest: unary call to a local gRPC service (plaintext HTTP/2). The agent resolves the method
+// from its registered descriptor sets, or else through the service's server reflection.
+type ForwardGrpcRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Target       string                 `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`                                 // host:port of the service (e.g., 127.0.0.1:50051)
+	Method       string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`                                 // Fully qualified method: "package.Service/Method"
+	RequestJson  string                 `protobuf:"bytes,3,opt,name=request_json,json=requestJson,proto3" json:"request_json,omitempty"`    // Request message in protobuf JSON (empty with no request_proto: the empty message)
+	RequestProto []byte                 `protobuf:"bytes,4,opt,name=request_proto,json=requestProto,proto3" json:"request_proto,omitempty"` // Request message in binary protobuf (alternative to request_json); the response
+	// is then uploaded in binary protobuf too, otherwise in protobuf JSON
+	Metadata      []*Header `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty"`                        // Optional request metadata
+	TimeoutSec    int32     `protobuf:"varint,6,opt,name=timeout_sec,json=timeoutSec,proto3" json:"timeout_sec,omitempty"` // Optional call timeout (seconds)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *OSSAccess) Reset() {
-	*x = OSSAccess{}
-	mi := &file_control_proto_msgTypes[8]
+func (x *ForwardGrpcRequest) Reset() {
+	*x = ForwardGrpcRequest{}
+	mi := &file_control_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *OSSAccess) String() string {
+func (x *ForwardGrpcRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*OSSAccess) ProtoMessage() {}
+func (*ForwardGrpcRequest) ProtoMessage() {}
 
-func (x *OSSAccess) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[8]
+func (x *ForwardGrpcRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -864,78 +1136,1452 @@ func (x *OSSAccess) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use OSSAccess.ProtoReflect.Descriptor instead.
-func (*OSSAccess) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use ForwardGrpcRequest.ProtoReflect.Descriptor instead.
+func (*ForwardGrpcRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *OSSAccess) GetAuth() isOSSAccess_Auth {
+func (x *ForwardGrpcRequest) GetTarget() string {
 	if x != nil {
-		return x.Auth
+		return x.Target
 	}
-	return nil
+	return ""
 }
 
-func (x *OSSAccess) GetPresignedUrl() string {
+func (x *ForwardGrpcRequest) GetMethod() string {
 	if x != nil {
-		if x, ok := x.Auth.(*OSSAccess_PresignedUrl); ok {
-			return x.PresignedUrl
-		}
+		return x.Method
 	}
 	return ""
 }
 
-func (x *OSSAccess) GetSts() *STSCreds {
+func (x *ForwardGrpcRequest) GetRequestJson() string {
 	if x != nil {
-		if x, ok := x.Auth.(*OSSAccess_Sts); ok {
+		return x.RequestJson
+	}
+	return ""
+}
+
+func (x *ForwardGrpcRequest) GetRequestProto() []byte {
+	if x != nil {
+		return x.RequestProto
+	}
+	return nil
+}
+
+func (x *ForwardGrpcRequest) GetMetadata() []*Header {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *ForwardGrpcRequest) GetTimeoutSec() int32 {
+	if x != nil {
+		return x.TimeoutSec
+	}
+	return 0
+}
+
+// STSCreds: STS temporary credentials for OSS access
+type STSCreds struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	AccessKeyId     string                 `protobuf:"bytes,1,opt,name=access_key_id,json=accessKeyId,proto3" json:"access_key_id,omitempty"`
+	AccessKeySecret string                 `protobuf:"bytes,2,opt,name=access_key_secret,json=accessKeySecret,proto3" json:"access_key_secret,omitempty"`
+	SecurityToken   string                 `protobuf:"bytes,3,opt,name=security_token,json=securityToken,proto3" json:"security_token,omitempty"`
+	Endpoint        string                 `protobuf:"bytes,4,opt,name=endpoint,proto3" json:"endpoint,omitempty"`                             // OSS endpoint host (e.g., cos.ap-beijing.myqcloud.com); with a scheme it is the bucket base URL as-is
+	Bucket          string                 `protobuf:"bytes,5,opt,name=bucket,proto3" json:"bucket,omitempty"`                                 // Bucket name
+	ExpiresAtMs     int64                  `protobuf:"varint,6,opt,name=expires_at_ms,json=expiresAtMs,proto3" json:"expires_at_ms,omitempty"` // Expiration timestamp (Unix milliseconds) - for agent to check validity
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *STSCreds) Reset() {
+	*x = STSCreds{}
+	mi := &file_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *STSCreds) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*STSCreds) ProtoMessage() {}
+
+func (x *STSCreds) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use STSCreds.ProtoReflect.Descriptor instead.
+func (*STSCreds) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *STSCreds) GetAccessKeyId() string {
+	if x != nil {
+		return x.AccessKeyId
+	}
+	return ""
+}
+
+func (x *STSCreds) GetAccessKeySecret() string {
+	if x != nil {
+		return x.AccessKeySecret
+	}
+	return ""
+}
+
+func (x *STSCreds) GetSecurityToken() string {
+	if x != nil {
+		return x.SecurityToken
+	}
+	return ""
+}
+
+func (x *STSCreds) GetEndpoint() string {
+	if x != nil {
+		return x.Endpoint
+	}
+	return ""
+}
+
+func (x *STSCreds) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *STSCreds) GetExpiresAtMs() int64 {
+	if x != nil {
+		return x.ExpiresAtMs
+	}
+	return 0
+}
+
+// OSSAccess: OSS access credentials (presigned URL or STS)
+// Exactly one of presigned_url or sts must be set.
+type OSSAccess struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Auth:
+	//
+	//	*OSSAccess_PresignedUrl
+	//	*OSSAccess_Sts
+	Auth          isOSSAccess_Auth `protobuf_oneof:"auth"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OSSAccess) Reset() {
+	*x = OSSAccess{}
+	mi := &file_control_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OSSAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OSSAccess) ProtoMessage() {}
+
+func (x *OSSAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OSSAccess.ProtoReflect.Descriptor instead.
+func (*OSSAccess) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *OSSAccess) GetAuth() isOSSAccess_Auth {
+	if x != nil {
+		return x.Auth
+	}
+	return nil
+}
+
+func (x *OSSAccess) GetPresignedUrl() string {
+	if x != nil {
+		if x, ok := x.Auth.(*OSSAccess_PresignedUrl); ok {
+			return x.PresignedUrl
+		}
+	}
+	return ""
+}
+
+func (x *OSSAccess) GetSts() *STSCreds {
+	if x != nil {
+		if x, ok := x.Auth.(*OSSAccess_Sts); ok {
 			return x.Sts
 		}
 	}
 	return nil
 }
 
-type isOSSAccess_Auth interface {
-	isOSSAccess_Auth()
+type isOSSAccess_Auth interface {
+	isOSSAccess_Auth()
+}
+
+type OSSAccess_PresignedUrl struct {
+	PresignedUrl string `protobuf:"bytes,1,opt,name=presigned_url,json=presignedUrl,proto3,oneof"` // Presigned URL for direct access (GET for input, PUT for output)
+}
+
+type OSSAccess_Sts struct {
+	Sts *STSCreds `protobuf:"bytes,2,opt,name=sts,proto3,oneof"` // STS temporary credentials
+}
+
+func (*OSSAccess_PresignedUrl) isOSSAccess_Auth() {}
+
+func (*OSSAccess_Sts) isOSSAccess_Auth() {}
+
+// RequestJob: Agent requests a job from cloud
+type RequestJob struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
+	AgentId        string   `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Capabilities   []string `protobuf:"bytes,2,rep,name=capabilities,proto3" json:"capabilities,omitempty"`                            // Optional: agent capabilities/tags
+	MaxConcurrency int32    `protobuf:"varint,3,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"` // Optional: max concurrent jobs (override from Register)
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RequestJob) Reset() {
+	*x = RequestJob{}
+	mi := &file_control_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestJob) ProtoMessage() {}
+
+func (x *RequestJob) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestJob.ProtoReflect.Descriptor instead.
+func (*RequestJob) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RequestJob) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RequestJob) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *RequestJob) GetMaxConcurrency() int32 {
+	if x != nil {
+		return x.MaxConcurrency
+	}
+	return 0
+}
+
+// JobAssigned: Cloud assigns a job to agent
+type JobAssigned struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	JobId       string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`                      // UUID of the job
+	AttemptId   int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`         // Attempt number (starts at 1) - required for idempotent output paths
+	LeaseId     string                 `protobuf:"bytes,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`                // Lease identifier (reserved for future lease renewal)
+	LeaseTtlSec int32                  `protobuf:"varint,4,opt,name=lease_ttl_sec,json=leaseTtlSec,proto3" json:"lease_ttl_sec,omitempty"` // Lease TTL in seconds (reserved for future)
+	// Input download access
+	InputDownload *OSSAccess `protobuf:"bytes,5,opt,name=input_download,json=inputDownload,proto3" json:"input_download,omitempty"` // Presigned GET URL or STS for downloading input
+	InputKey      string     `protobuf:"bytes,10,opt,name=input_key,json=inputKey,proto3" json:"input_key,omitempty"`               // Input OSS key (for extracting file extension)
+	// Output upload access
+	OutputUpload *OSSAccess `protobuf:"bytes,6,opt,name=output_upload,json=outputUpload,proto3" json:"output_upload,omitempty"` // Presigned PUT URL or STS for uploading output
+	// Output path information
+	// VALIDATION RULES (server MUST enforce before assigning job):
+	// - If output_upload uses presigned_url: output_key MUST be set, and presigned_url must target that exact key.
+	// - If output_upload uses STS: output_prefix MUST be set, agent may write any key under this prefix.
+	// Server must reject job assignment if these rules are violated.
+	OutputPrefix     string              `protobuf:"bytes,7,opt,name=output_prefix,json=outputPrefix,proto3" json:"output_prefix,omitempty"`                                               // Output key prefix (e.g., "jobs/{job_id}/{attempt_id}/") - required if using STS
+	OutputKey        string              `protobuf:"bytes,8,opt,name=output_key,json=outputKey,proto3" json:"output_key,omitempty"`                                                        // Specific output key - required if using presigned_url
+	Command          string              `protobuf:"bytes,9,opt,name=command,proto3" json:"command,omitempty"`                                                                             // Command to execute (e.g., "python C:/scripts/analyze.py {input} {output}")
+	JobType          JobTypeEnum         `protobuf:"varint,11,opt,name=job_type,json=jobType,proto3,enum=control.JobTypeEnum" json:"job_type,omitempty"`                                   // Job type (default: COMMAND)
+	ForwardHttp      *ForwardHttpRequest `protobuf:"bytes,12,opt,name=forward_http,json=forwardHttp,proto3" json:"forward_http,omitempty"`                                                 // Forward HTTP request configuration
+	InputForwardMode InputForwardMode    `protobuf:"varint,13,opt,name=input_forward_mode,json=inputForwardMode,proto3,enum=control.InputForwardMode" json:"input_forward_mode,omitempty"` // Input forwarding mode for forward jobs
+	// Named inputs (CreateJobRequest.inputs), sorted by name. Commands reference them as {input:name};
+	// forward jobs receive them alongside the single input.
+	Inputs      []*JobInput `protobuf:"bytes,14,rep,name=inputs,proto3" json:"inputs,omitempty"`
+	InputBucket string      `protobuf:"bytes,15,opt,name=input_bucket,json=inputBucket,proto3" json:"input_bucket,omitempty"` // Bucket of input_key (agents cache inputs by bucket + key + ETag)
+	InputSha256 string      `protobuf:"bytes,16,opt,name=input_sha256,json=inputSha256,proto3" json:"input_sha256,omitempty"` // Optional: expected hex SHA-256 of the input; the agent fails the job on a mismatch
+	// Execution timeout in seconds (0: the agent's default). A command that runs longer is sent a graceful
+	// terminate, then killed, and the job is reported FAILED with reason "TIMED_OUT". For forward jobs it bounds
+	// the request unless forward_http.timeout_sec (forward_grpc.timeout_sec) is set. The cloud times the job out
+	// itself after timeout_sec plus a grace period.
+	TimeoutSec int32 `protobuf:"varint,17,opt,name=timeout_sec,json=timeoutSec,proto3" json:"timeout_sec,omitempty"`
+	// COMMAND jobs: run argv[0] with the remaining arguments directly, without a shell (command is then
+	// empty). Placeholders ({input}, {output}, ...) expand within each argument, never splitting it.
+	Argv []string `protobuf:"bytes,18,rep,name=argv,proto3" json:"argv,omitempty"`
+	// Environment variables added to the command's environment (values may contain placeholders)
+	Env map[string]string `protobuf:"bytes,19,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Working directory of the command (may contain placeholders); a relative path is resolved against
+	// the job's work directory. Empty: the agent's working directory.
+	WorkingDir string `protobuf:"bytes,20,opt,name=working_dir,json=workingDir,proto3" json:"working_dir,omitempty"`
+	// Job template declared in the agent's config (COMMAND jobs without command/argv). The agent runs
+	// the template's fixed program and arguments, with {param:name} expanded from params.
+	Template string `protobuf:"bytes,21,opt,name=template,proto3" json:"template,omitempty"`
+	// Parameters of the template, checked against the template's schema by the agent
+	Params      map[string]string   `protobuf:"bytes,22,rep,name=params,proto3" json:"params,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	ForwardGrpc *ForwardGrpcRequest `protobuf:"bytes,23,opt,name=forward_grpc,json=forwardGrpc,proto3" json:"forward_grpc,omitempty"` // Forward gRPC call configuration (FORWARD_GRPC jobs)
+	// Set with command: the submitter asked for command to run through the agent's shell (sh -c, cmd.exe /c).
+	// Agents refuse a command without it.
+	Shell         bool `protobuf:"varint,24,opt,name=shell,proto3" json:"shell,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobAssigned) Reset() {
+	*x = JobAssigned{}
+	mi := &file_control_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobAssigned) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobAssigned) ProtoMessage() {}
+
+func (x *JobAssigned) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobAssigned.ProtoReflect.Descriptor instead.
+func (*JobAssigned) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *JobAssigned) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *JobAssigned) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetLeaseTtlSec() int32 {
+	if x != nil {
+		return x.LeaseTtlSec
+	}
+	return 0
+}
+
+func (x *JobAssigned) GetInputDownload() *OSSAccess {
+	if x != nil {
+		return x.InputDownload
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetInputKey() string {
+	if x != nil {
+		return x.InputKey
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetOutputUpload() *OSSAccess {
+	if x != nil {
+		return x.OutputUpload
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetOutputPrefix() string {
+	if x != nil {
+		return x.OutputPrefix
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetOutputKey() string {
+	if x != nil {
+		return x.OutputKey
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetJobType() JobTypeEnum {
+	if x != nil {
+		return x.JobType
+	}
+	return JobTypeEnum_JOB_TYPE_UNKNOWN
+}
+
+func (x *JobAssigned) GetForwardHttp() *ForwardHttpRequest {
+	if x != nil {
+		return x.ForwardHttp
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetInputForwardMode() InputForwardMode {
+	if x != nil {
+		return x.InputForwardMode
+	}
+	return InputForwardMode_INPUT_FORWARD_MODE_UNSPECIFIED
+}
+
+func (x *JobAssigned) GetInputs() []*JobInput {
+	if x != nil {
+		return x.Inputs
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetInputBucket() string {
+	if x != nil {
+		return x.InputBucket
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetInputSha256() string {
+	if x != nil {
+		return x.InputSha256
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetTimeoutSec() int32 {
+	if x != nil {
+		return x.TimeoutSec
+	}
+	return 0
+}
+
+func (x *JobAssigned) GetArgv() []string {
+	if x != nil {
+		return x.Argv
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetWorkingDir() string {
+	if x != nil {
+		return x.WorkingDir
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetTemplate() string {
+	if x != nil {
+		return x.Template
+	}
+	return ""
+}
+
+func (x *JobAssigned) GetParams() map[string]string {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetForwardGrpc() *ForwardGrpcRequest {
+	if x != nil {
+		return x.ForwardGrpc
+	}
+	return nil
+}
+
+func (x *JobAssigned) GetShell() bool {
+	if x != nil {
+		return x.Shell
+	}
+	return false
+}
+
+// JobInput: a named input of a job
+type JobInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`         // Input name ([A-Za-z0-9_-], unique per job)
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`           // OSS key (for extracting file extension)
+	Download      *OSSAccess             `protobuf:"bytes,3,opt,name=download,proto3" json:"download,omitempty"` // Presigned GET URL
+	Bucket        string                 `protobuf:"bytes,4,opt,name=bucket,proto3" json:"bucket,omitempty"`     // Bucket of key (agents cache inputs by bucket + key + ETag)
+	Sha256        string                 `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`     // Optional: expected hex SHA-256 of the input; the agent fails the job on a mismatch
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobInput) Reset() {
+	*x = JobInput{}
+	mi := &file_control_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobInput) ProtoMessage() {}
+
+func (x *JobInput) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobInput.ProtoReflect.Descriptor instead.
+func (*JobInput) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *JobInput) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *JobInput) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *JobInput) GetDownload() *OSSAccess {
+	if x != nil {
+		return x.Download
+	}
+	return nil
+}
+
+func (x *JobInput) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *JobInput) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+// JobStatus: Agent reports job execution status
+type JobStatus struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	JobId     string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`                  // Job identifier
+	AttemptId int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`     // Attempt number
+	Status    JobStatusEnum          `protobuf:"varint,3,opt,name=status,proto3,enum=control.JobStatusEnum" json:"status,omitempty"` // Current status: RUNNING/SUCCEEDED/FAILED/ASSIGNED/CANCELED/LOST
+	Message   string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`                           // Optional: status message or error description
+	OutputKey string                 `protobuf:"bytes,5,opt,name=output_key,json=outputKey,proto3" json:"output_key,omitempty"`      // Output key for consistency check (required on SUCCEEDED if output file exists)
+	Stdout    string                 `protobuf:"bytes,6,opt,name=stdout,proto3" json:"stdout,omitempty"`                             // Optional: command stdout output (truncated if too long)
+	Stderr    string                 `protobuf:"bytes,7,opt,name=stderr,proto3" json:"stderr,omitempty"`                             // Optional: command stderr output (truncated if too long, typically for FAILED status)
+	// Optional on SUCCEEDED: every file uploaded from the job's output directory.
+	// All keys must be under the job's output_prefix; the server stores them as the job's output manifest.
+	OutputFiles []*OutputFile `protobuf:"bytes,8,rep,name=output_files,json=outputFiles,proto3" json:"output_files,omitempty"`
+	ManifestKey string        `protobuf:"bytes,9,opt,name=manifest_key,json=manifestKey,proto3" json:"manifest_key,omitempty"` // Key of the uploaded manifest.json ({output_prefix}manifest.json); set with output_files
+	// Optional on final statuses: inputs served from the agent's input cache without a transfer
+	// ("input" for input_key, otherwise the input name)
+	CachedInputs []string `protobuf:"bytes,10,rep,name=cached_inputs,json=cachedInputs,proto3" json:"cached_inputs,omitempty"`
+	// Optional: size, SHA-256 and ETag of the object uploaded to output_key. The cloud confirms them
+	// (HEAD on the object) before accepting SUCCEEDED.
+	Output *OutputFile `protobuf:"bytes,11,opt,name=output,proto3" json:"output,omitempty"`
+	// Optional on final statuses of command jobs: how the command's process ended and what it used
+	Usage *ProcessUsage `protobuf:"bytes,12,opt,name=usage,proto3" json:"usage,omitempty"`
+	// Optional on FAILED: machine-readable failure reason. "TIMED_OUT": the job exceeded JobAssigned.timeout_sec.
+	Reason string `protobuf:"bytes,13,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Optional on final statuses of forward jobs: status code and headers of the local service's response
+	ForwardResponse *ForwardResponse `protobuf:"bytes,14,opt,name=forward_response,json=forwardResponse,proto3" json:"forward_response,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *JobStatus) Reset() {
+	*x = JobStatus{}
+	mi := &file_control_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobStatus) ProtoMessage() {}
+
+func (x *JobStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobStatus.ProtoReflect.Descriptor instead.
+func (*JobStatus) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *JobStatus) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *JobStatus) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *JobStatus) GetStatus() JobStatusEnum {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatusEnum_JOB_STATUS_UNKNOWN
+}
+
+func (x *JobStatus) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *JobStatus) GetOutputKey() string {
+	if x != nil {
+		return x.OutputKey
+	}
+	return ""
+}
+
+func (x *JobStatus) GetStdout() string {
+	if x != nil {
+		return x.Stdout
+	}
+	return ""
+}
+
+func (x *JobStatus) GetStderr() string {
+	if x != nil {
+		return x.Stderr
+	}
+	return ""
+}
+
+func (x *JobStatus) GetOutputFiles() []*OutputFile {
+	if x != nil {
+		return x.OutputFiles
+	}
+	return nil
+}
+
+func (x *JobStatus) GetManifestKey() string {
+	if x != nil {
+		return x.ManifestKey
+	}
+	return ""
+}
+
+func (x *JobStatus) GetCachedInputs() []string {
+	if x != nil {
+		return x.CachedInputs
+	}
+	return nil
+}
+
+func (x *JobStatus) GetOutput() *OutputFile {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *JobStatus) GetUsage() *ProcessUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *JobStatus) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *JobStatus) GetForwardResponse() *ForwardResponse {
+	if x != nil {
+		return x.ForwardResponse
+	}
+	return nil
+}
+
+// ForwardResponse: the response of the local service to a forward job (for an async job: the result response)
+type ForwardResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StatusCode    int32                  `protobuf:"varint,1,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"` // HTTP status code
+	Headers       []*Header              `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty"`                          // Response headers (Set-Cookie omitted; repeated values joined with ", ")
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardResponse) Reset() {
+	*x = ForwardResponse{}
+	mi := &file_control_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardResponse) ProtoMessage() {}
+
+func (x *ForwardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardResponse.ProtoReflect.Descriptor instead.
+func (*ForwardResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ForwardResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *ForwardResponse) GetHeaders() []*Header {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+// ProcessUsage: exit status and resource usage of a command job's process (from the OS process state).
+// CPU times and peak RSS cover the process and the children it waited for.
+type ProcessUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exited        bool                   `protobuf:"varint,1,opt,name=exited,proto3" json:"exited,omitempty"`                                // The process exited by itself (exit_code is set)
+	ExitCode      int32                  `protobuf:"varint,2,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`            // Exit code (valid if exited)
+	Signal        string                 `protobuf:"bytes,3,opt,name=signal,proto3" json:"signal,omitempty"`                                 // Signal that terminated the process (e.g. "SIGKILL"), empty if it exited
+	WallTimeMs    int64                  `protobuf:"varint,4,opt,name=wall_time_ms,json=wallTimeMs,proto3" json:"wall_time_ms,omitempty"`    // Time from start to exit
+	UserCpuMs     int64                  `protobuf:"varint,5,opt,name=user_cpu_ms,json=userCpuMs,proto3" json:"user_cpu_ms,omitempty"`       // User CPU time
+	SystemCpuMs   int64                  `protobuf:"varint,6,opt,name=system_cpu_ms,json=systemCpuMs,proto3" json:"system_cpu_ms,omitempty"` // System CPU time
+	MaxRssBytes   int64                  `protobuf:"varint,7,opt,name=max_rss_bytes,json=maxRssBytes,proto3" json:"max_rss_bytes,omitempty"` // Peak resident set size (0 if the platform does not report it)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessUsage) Reset() {
+	*x = ProcessUsage{}
+	mi := &file_control_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessUsage) ProtoMessage() {}
+
+func (x *ProcessUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessUsage.ProtoReflect.Descriptor instead.
+func (*ProcessUsage) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ProcessUsage) GetExited() bool {
+	if x != nil {
+		return x.Exited
+	}
+	return false
+}
+
+func (x *ProcessUsage) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *ProcessUsage) GetSignal() string {
+	if x != nil {
+		return x.Signal
+	}
+	return ""
+}
+
+func (x *ProcessUsage) GetWallTimeMs() int64 {
+	if x != nil {
+		return x.WallTimeMs
+	}
+	return 0
+}
+
+func (x *ProcessUsage) GetUserCpuMs() int64 {
+	if x != nil {
+		return x.UserCpuMs
+	}
+	return 0
+}
+
+func (x *ProcessUsage) GetSystemCpuMs() int64 {
+	if x != nil {
+		return x.SystemCpuMs
+	}
+	return 0
+}
+
+func (x *ProcessUsage) GetMaxRssBytes() int64 {
+	if x != nil {
+		return x.MaxRssBytes
+	}
+	return 0
+}
+
+// OutputFile: one uploaded output file (an entry of manifest.json)
+type OutputFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`                                    // OSS key under output_prefix
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`                                 // Size in bytes
+	Sha256        string                 `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`                              // Hex-encoded SHA-256 of the content
+	ContentType   string                 `protobuf:"bytes,4,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"` // Content-Type used for the upload
+	Etag          string                 `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`                                  // Optional: ETag returned by the upload (empty for multipart uploads)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutputFile) Reset() {
+	*x = OutputFile{}
+	mi := &file_control_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutputFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutputFile) ProtoMessage() {}
+
+func (x *OutputFile) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutputFile.ProtoReflect.Descriptor instead.
+func (*OutputFile) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *OutputFile) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *OutputFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *OutputFile) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *OutputFile) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *OutputFile) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+// JobProgress: Agent reports the progress of a running job (no response).
+// Commands report it with "##progress" stdout lines or by writing to {progress_file}; forward jobs
+// POST it to the agent's local progress callback. The agent sends at most one JobProgress per second
+// and job; the cloud keeps the latest one.
+type JobProgress struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
+	AgentId       string  `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	JobId         string  `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AttemptId     int32   `protobuf:"varint,3,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`
+	Percent       float64 `protobuf:"fixed64,4,opt,name=percent,proto3" json:"percent,omitempty"`                           // 0-100 (derived from the steps if the job reports only steps)
+	CurrentStep   int32   `protobuf:"varint,5,opt,name=current_step,json=currentStep,proto3" json:"current_step,omitempty"` // Optional: current step (1-based)
+	TotalSteps    int32   `protobuf:"varint,6,opt,name=total_steps,json=totalSteps,proto3" json:"total_steps,omitempty"`    // Optional: number of steps
+	Message       string  `protobuf:"bytes,7,opt,name=message,proto3" json:"message,omitempty"`                             // Optional: short description of the current step
+	MetricsJson   string  `protobuf:"bytes,8,opt,name=metrics_json,json=metricsJson,proto3" json:"metrics_json,omitempty"`  // Optional: JSON object of metrics (at most 4KB, e.g. {"loss":0.41})
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobProgress) Reset() {
+	*x = JobProgress{}
+	mi := &file_control_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobProgress) ProtoMessage() {}
+
+func (x *JobProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobProgress.ProtoReflect.Descriptor instead.
+func (*JobProgress) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *JobProgress) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *JobProgress) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *JobProgress) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *JobProgress) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *JobProgress) GetCurrentStep() int32 {
+	if x != nil {
+		return x.CurrentStep
+	}
+	return 0
+}
+
+func (x *JobProgress) GetTotalSteps() int32 {
+	if x != nil {
+		return x.TotalSteps
+	}
+	return 0
+}
+
+func (x *JobProgress) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *JobProgress) GetMetricsJson() string {
+	if x != nil {
+		return x.MetricsJson
+	}
+	return ""
+}
+
+// CancelJob: Cloud tells the agent to stop a job it ended on its own (e.g. FAILED with reason "TIMED_OUT"
+// after the job overran its timeout). The agent terminates the job's command or request; its final
+// JobStatus is ignored.
+type CancelJob struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AttemptId     int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`   // Machine-readable reason (e.g. "TIMED_OUT")
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"` // Human-readable description
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJob) Reset() {
+	*x = CancelJob{}
+	mi := &file_control_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJob) ProtoMessage() {}
+
+func (x *CancelJob) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJob.ProtoReflect.Descriptor instead.
+func (*CancelJob) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *CancelJob) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *CancelJob) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *CancelJob) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CancelJob) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// RefreshAccess: Agent asks for fresh OSS access for a job it holds.
+// Presigned URLs expire (default 15 minutes), so long-running jobs request new ones
+// right before downloading input or uploading output. The response is a RefreshAccessAck
+// with the same Envelope.request_id.
+type RefreshAccess struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
+	AgentId   string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	JobId     string `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`              // Job identifier
+	AttemptId int32  `protobuf:"varint,3,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"` // Must equal the job's current attempt
+	LeaseId   string `protobuf:"bytes,4,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`        // Lease from JobAssigned; must equal the job's current lease
+	Input     bool   `protobuf:"varint,5,opt,name=input,proto3" json:"input,omitempty"`                          // Request a fresh input_download
+	Output    bool   `protobuf:"varint,6,opt,name=output,proto3" json:"output,omitempty"`                        // Request a fresh output_upload
+	// Request presigned PUT URLs for these keys (presigned mode, multi-file outputs).
+	// Every key must be under the job's output_prefix; at most 100 keys per request.
+	OutputFiles []string `protobuf:"bytes,7,rep,name=output_files,json=outputFiles,proto3" json:"output_files,omitempty"`
+	Inputs      []string `protobuf:"bytes,8,rep,name=inputs,proto3" json:"inputs,omitempty"` // Request fresh downloads for these named inputs
+	// Presigned mode: start, continue, complete or abort a multipart upload of one key under output_prefix
+	Multipart     *MultipartUpload `protobuf:"bytes,9,opt,name=multipart,proto3" json:"multipart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshAccess) Reset() {
+	*x = RefreshAccess{}
+	mi := &file_control_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshAccess) ProtoMessage() {}
+
+func (x *RefreshAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshAccess.ProtoReflect.Descriptor instead.
+func (*RefreshAccess) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RefreshAccess) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RefreshAccess) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *RefreshAccess) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *RefreshAccess) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *RefreshAccess) GetInput() bool {
+	if x != nil {
+		return x.Input
+	}
+	return false
+}
+
+func (x *RefreshAccess) GetOutput() bool {
+	if x != nil {
+		return x.Output
+	}
+	return false
+}
+
+func (x *RefreshAccess) GetOutputFiles() []string {
+	if x != nil {
+		return x.OutputFiles
+	}
+	return nil
+}
+
+func (x *RefreshAccess) GetInputs() []string {
+	if x != nil {
+		return x.Inputs
+	}
+	return nil
+}
+
+func (x *RefreshAccess) GetMultipart() *MultipartUpload {
+	if x != nil {
+		return x.Multipart
+	}
+	return nil
+}
+
+// MultipartUpload: one step of a multipart upload driven by the agent (RefreshAccess.multipart).
+// Empty upload_id starts an upload; part_numbers requests part URLs; complete finishes it; abort discards it.
+type MultipartUpload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`                                            // Object key under the job's output_prefix
+	UploadId      string                 `protobuf:"bytes,2,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`                  // Upload to continue (empty: start a new upload)
+	ContentType   string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`         // Content-Type of the object (when starting)
+	PartNumbers   []int32                `protobuf:"varint,4,rep,packed,name=part_numbers,json=partNumbers,proto3" json:"part_numbers,omitempty"` // Presign PUT URLs for these parts (1-10000, at most 100 per request)
+	Complete      []*UploadedPart        `protobuf:"bytes,5,rep,name=complete,proto3" json:"complete,omitempty"`                                  // Complete the upload with these parts (ascending part numbers)
+	Abort         bool                   `protobuf:"varint,6,opt,name=abort,proto3" json:"abort,omitempty"`                                       // Abort the upload
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultipartUpload) Reset() {
+	*x = MultipartUpload{}
+	mi := &file_control_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultipartUpload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultipartUpload) ProtoMessage() {}
+
+func (x *MultipartUpload) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultipartUpload.ProtoReflect.Descriptor instead.
+func (*MultipartUpload) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *MultipartUpload) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MultipartUpload) GetUploadId() string {
+	if x != nil {
+		return x.UploadId
+	}
+	return ""
+}
+
+func (x *MultipartUpload) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *MultipartUpload) GetPartNumbers() []int32 {
+	if x != nil {
+		return x.PartNumbers
+	}
+	return nil
+}
+
+func (x *MultipartUpload) GetComplete() []*UploadedPart {
+	if x != nil {
+		return x.Complete
+	}
+	return nil
+}
+
+func (x *MultipartUpload) GetAbort() bool {
+	if x != nil {
+		return x.Abort
+	}
+	return false
+}
+
+// UploadedPart: a part uploaded to a presigned part URL
+type UploadedPart struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PartNumber    int32                  `protobuf:"varint,1,opt,name=part_number,json=partNumber,proto3" json:"part_number,omitempty"`
+	Etag          string                 `protobuf:"bytes,2,opt,name=etag,proto3" json:"etag,omitempty"` // ETag response header of the part upload
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-type OSSAccess_PresignedUrl struct {
-	PresignedUrl string `protobuf:"bytes,1,opt,name=presigned_url,json=presignedUrl,proto3,oneof"` // Presigned URL for direct access (GET for input, PUT for output)
+func (x *UploadedPart) Reset() {
+	*x = UploadedPart{}
+	mi := &file_control_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-type OSSAccess_Sts struct {
-	Sts *STSCreds `protobuf:"bytes,2,opt,name=sts,proto3,oneof"` // STS temporary credentials
+func (x *UploadedPart) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*OSSAccess_PresignedUrl) isOSSAccess_Auth() {}
+func (*UploadedPart) ProtoMessage() {}
 
-func (*OSSAccess_Sts) isOSSAccess_Auth() {}
+func (x *UploadedPart) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
 
-// RequestJob: Agent requests a job from cloud
-type RequestJob struct {
-	state protoimpl.MessageState `protogen:"open.v1"`
-	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
-	AgentId        string   `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	Capabilities   []string `protobuf:"bytes,2,rep,name=capabilities,proto3" json:"capabilities,omitempty"`                            // Optional: agent capabilities/tags
-	MaxConcurrency int32    `protobuf:"varint,3,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"` // Optional: max concurrent jobs (override from Register)
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+// Deprecated: Use UploadedPart.ProtoReflect.Descriptor instead.
+func (*UploadedPart) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{23}
 }
 
-func (x *RequestJob) Reset() {
-	*x = RequestJob{}
-	mi := &file_control_proto_msgTypes[9]
+func (x *UploadedPart) GetPartNumber() int32 {
+	if x != nil {
+		return x.PartNumber
+	}
+	return 0
+}
+
+func (x *UploadedPart) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+// MultipartUploadAck: result of a MultipartUpload step
+type MultipartUploadAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	UploadId      string                 `protobuf:"bytes,2,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`                                                                                     // Upload ID (new or continued)
+	PartUploads   map[int32]*OSSAccess   `protobuf:"bytes,3,rep,name=part_uploads,json=partUploads,proto3" json:"part_uploads,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Presigned PUT URL per requested part number
+	Completed     bool                   `protobuf:"varint,4,opt,name=completed,proto3" json:"completed,omitempty"`                                                                                                  // The object was assembled
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultipartUploadAck) Reset() {
+	*x = MultipartUploadAck{}
+	mi := &file_control_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RequestJob) String() string {
+func (x *MultipartUploadAck) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RequestJob) ProtoMessage() {}
+func (*MultipartUploadAck) ProtoMessage() {}
 
-func (x *RequestJob) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[9]
+func (x *MultipartUploadAck) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -946,74 +2592,71 @@ func (x *RequestJob) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RequestJob.ProtoReflect.Descriptor instead.
-func (*RequestJob) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{9}
+// Deprecated: Use MultipartUploadAck.ProtoReflect.Descriptor instead.
+func (*MultipartUploadAck) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{24}
 }
 
-func (x *RequestJob) GetAgentId() string {
+func (x *MultipartUploadAck) GetKey() string {
 	if x != nil {
-		return x.AgentId
+		return x.Key
 	}
 	return ""
 }
 
-func (x *RequestJob) GetCapabilities() []string {
+func (x *MultipartUploadAck) GetUploadId() string {
 	if x != nil {
-		return x.Capabilities
+		return x.UploadId
 	}
-	return nil
+	return ""
 }
 
-func (x *RequestJob) GetMaxConcurrency() int32 {
+func (x *MultipartUploadAck) GetPartUploads() map[int32]*OSSAccess {
 	if x != nil {
-		return x.MaxConcurrency
+		return x.PartUploads
 	}
-	return 0
+	return nil
 }
 
-// JobAssigned: Cloud assigns a job to agent
-type JobAssigned struct {
-	state       protoimpl.MessageState `protogen:"open.v1"`
-	JobId       string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`                      // UUID of the job
-	AttemptId   int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`         // Attempt number (starts at 1) - required for idempotent output paths
-	LeaseId     string                 `protobuf:"bytes,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`                // Lease identifier (reserved for future lease renewal)
-	LeaseTtlSec int32                  `protobuf:"varint,4,opt,name=lease_ttl_sec,json=leaseTtlSec,proto3" json:"lease_ttl_sec,omitempty"` // Lease TTL in seconds (reserved for future)
-	// Input download access
-	InputDownload *OSSAccess `protobuf:"bytes,5,opt,name=input_download,json=inputDownload,proto3" json:"input_download,omitempty"` // Presigned GET URL or STS for downloading input
-	InputKey      string     `protobuf:"bytes,10,opt,name=input_key,json=inputKey,proto3" json:"input_key,omitempty"`               // Input OSS key (for extracting file extension)
-	// Output upload access
-	OutputUpload *OSSAccess `protobuf:"bytes,6,opt,name=output_upload,json=outputUpload,proto3" json:"output_upload,omitempty"` // Presigned PUT URL or STS for uploading output
-	// Output path information
-	// VALIDATION RULES (server MUST enforce before assigning job):
-	// - If output_upload uses presigned_url: output_key MUST be set, and presigned_url must target that exact key.
-	// - If output_upload uses STS: output_prefix MUST be set, agent may write any key under this prefix.
-	// Server must reject job assignment if these rules are violated.
-	OutputPrefix     string              `protobuf:"bytes,7,opt,name=output_prefix,json=outputPrefix,proto3" json:"output_prefix,omitempty"`                                               // Output key prefix (e.g., "jobs/{job_id}/{attempt_id}/") - required if using STS
-	OutputKey        string              `protobuf:"bytes,8,opt,name=output_key,json=outputKey,proto3" json:"output_key,omitempty"`                                                        // Specific output key - required if using presigned_url
-	Command          string              `protobuf:"bytes,9,opt,name=command,proto3" json:"command,omitempty"`                                                                             // Command to execute (e.g., "python C:/scripts/analyze.py {input} {output}")
-	JobType          JobTypeEnum         `protobuf:"varint,11,opt,name=job_type,json=jobType,proto3,enum=control.JobTypeEnum" json:"job_type,omitempty"`                                   // Job type (default: COMMAND)
-	ForwardHttp      *ForwardHttpRequest `protobuf:"bytes,12,opt,name=forward_http,json=forwardHttp,proto3" json:"forward_http,omitempty"`                                                 // Forward HTTP request configuration
-	InputForwardMode InputForwardMode    `protobuf:"varint,13,opt,name=input_forward_mode,json=inputForwardMode,proto3,enum=control.InputForwardMode" json:"input_forward_mode,omitempty"` // Input forwarding mode for forward jobs
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+func (x *MultipartUploadAck) GetCompleted() bool {
+	if x != nil {
+		return x.Completed
+	}
+	return false
 }
 
-func (x *JobAssigned) Reset() {
-	*x = JobAssigned{}
-	mi := &file_control_proto_msgTypes[10]
+// RefreshAccessAck: Cloud returns fresh OSS access for the exact keys of the leased job
+type RefreshAccessAck struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	JobId             string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AttemptId         int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`
+	Success           bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`                                                                                                                         // False if the job, attempt or lease no longer belongs to the agent
+	Message           string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`                                                                                                                          // Error description when success is false
+	InputDownload     *OSSAccess             `protobuf:"bytes,5,opt,name=input_download,json=inputDownload,proto3" json:"input_download,omitempty"`                                                                                         // Set if input was requested and the job has input
+	OutputUpload      *OSSAccess             `protobuf:"bytes,6,opt,name=output_upload,json=outputUpload,proto3" json:"output_upload,omitempty"`                                                                                            // Set if output was requested; targets output_key only
+	OutputKey         string                 `protobuf:"bytes,7,opt,name=output_key,json=outputKey,proto3" json:"output_key,omitempty"`                                                                                                     // The output key output_upload is valid for (unchanged from JobAssigned)
+	OutputFileUploads map[string]*OSSAccess  `protobuf:"bytes,8,rep,name=output_file_uploads,json=outputFileUploads,proto3" json:"output_file_uploads,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // Presigned PUT URL per requested output_files key
+	Inputs            []*JobInput            `protobuf:"bytes,9,rep,name=inputs,proto3" json:"inputs,omitempty"`                                                                                                                            // Fresh downloads for the requested named inputs
+	Multipart         *MultipartUploadAck    `protobuf:"bytes,10,opt,name=multipart,proto3" json:"multipart,omitempty"`                                                                                                                     // Set if multipart was requested
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *RefreshAccessAck) Reset() {
+	*x = RefreshAccessAck{}
+	mi := &file_control_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *JobAssigned) String() string {
+func (x *RefreshAccessAck) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*JobAssigned) ProtoMessage() {}
+func (*RefreshAccessAck) ProtoMessage() {}
 
-func (x *JobAssigned) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[10]
+func (x *RefreshAccessAck) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1024,131 +2667,116 @@ func (x *JobAssigned) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use JobAssigned.ProtoReflect.Descriptor instead.
-func (*JobAssigned) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use RefreshAccessAck.ProtoReflect.Descriptor instead.
+func (*RefreshAccessAck) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{25}
 }
 
-func (x *JobAssigned) GetJobId() string {
+func (x *RefreshAccessAck) GetJobId() string {
 	if x != nil {
 		return x.JobId
 	}
 	return ""
 }
 
-func (x *JobAssigned) GetAttemptId() int32 {
+func (x *RefreshAccessAck) GetAttemptId() int32 {
 	if x != nil {
 		return x.AttemptId
 	}
 	return 0
 }
 
-func (x *JobAssigned) GetLeaseId() string {
+func (x *RefreshAccessAck) GetSuccess() bool {
 	if x != nil {
-		return x.LeaseId
+		return x.Success
 	}
-	return ""
+	return false
 }
 
-func (x *JobAssigned) GetLeaseTtlSec() int32 {
+func (x *RefreshAccessAck) GetMessage() string {
 	if x != nil {
-		return x.LeaseTtlSec
+		return x.Message
 	}
-	return 0
+	return ""
 }
 
-func (x *JobAssigned) GetInputDownload() *OSSAccess {
+func (x *RefreshAccessAck) GetInputDownload() *OSSAccess {
 	if x != nil {
 		return x.InputDownload
 	}
 	return nil
 }
 
-func (x *JobAssigned) GetInputKey() string {
-	if x != nil {
-		return x.InputKey
-	}
-	return ""
-}
-
-func (x *JobAssigned) GetOutputUpload() *OSSAccess {
+func (x *RefreshAccessAck) GetOutputUpload() *OSSAccess {
 	if x != nil {
 		return x.OutputUpload
 	}
 	return nil
 }
 
-func (x *JobAssigned) GetOutputPrefix() string {
-	if x != nil {
-		return x.OutputPrefix
-	}
-	return ""
-}
-
-func (x *JobAssigned) GetOutputKey() string {
+func (x *RefreshAccessAck) GetOutputKey() string {
 	if x != nil {
 		return x.OutputKey
 	}
 	return ""
 }
 
-func (x *JobAssigned) GetCommand() string {
-	if x != nil {
-		return x.Command
-	}
-	return ""
-}
-
-func (x *JobAssigned) GetJobType() JobTypeEnum {
+func (x *RefreshAccessAck) GetOutputFileUploads() map[string]*OSSAccess {
 	if x != nil {
-		return x.JobType
+		return x.OutputFileUploads
 	}
-	return JobTypeEnum_JOB_TYPE_UNKNOWN
+	return nil
 }
 
-func (x *JobAssigned) GetForwardHttp() *ForwardHttpRequest {
+func (x *RefreshAccessAck) GetInputs() []*JobInput {
 	if x != nil {
-		return x.ForwardHttp
+		return x.Inputs
 	}
 	return nil
 }
 
-func (x *JobAssigned) GetInputForwardMode() InputForwardMode {
+func (x *RefreshAccessAck) GetMultipart() *MultipartUploadAck {
 	if x != nil {
-		return x.InputForwardMode
+		return x.Multipart
 	}
-	return InputForwardMode_INPUT_FORWARD_MODE_UNSPECIFIED
+	return nil
 }
 
-// JobStatus: Agent reports job execution status
-type JobStatus struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`                  // Job identifier
-	AttemptId     int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`     // Attempt number
-	Status        JobStatusEnum          `protobuf:"varint,3,opt,name=status,proto3,enum=control.JobStatusEnum" json:"status,omitempty"` // Current status: RUNNING/SUCCEEDED/FAILED/ASSIGNED/CANCELED/LOST
-	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`                           // Optional: status message or error description
-	OutputKey     string                 `protobuf:"bytes,5,opt,name=output_key,json=outputKey,proto3" json:"output_key,omitempty"`      // Output key for consistency check (required on SUCCEEDED if output file exists)
-	Stdout        string                 `protobuf:"bytes,6,opt,name=stdout,proto3" json:"stdout,omitempty"`                             // Optional: command stdout output (truncated if too long)
-	Stderr        string                 `protobuf:"bytes,7,opt,name=stderr,proto3" json:"stderr,omitempty"`                             // Optional: command stderr output (truncated if too long, typically for FAILED status)
+// LogChunk: Agent streams command output while a job runs.
+// Chunks of one attempt are numbered from 1 (seq, shared by both streams). The agent keeps at most a
+// small window of unacknowledged chunks in flight; output produced while the window is full is buffered,
+// and the oldest buffered bytes are dropped (counted in dropped_bytes) when the buffer overflows.
+// The final chunk (eof) is sent before the terminal JobStatus.
+type LogChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// agent_id: Must equal Envelope.agent_id if present (server validates consistency)
+	AgentId       string    `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	JobId         string    `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AttemptId     int32     `protobuf:"varint,3,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`
+	Seq           int64     `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"` // Sequence number within the attempt (starts at 1)
+	Stream        LogStream `protobuf:"varint,5,opt,name=stream,proto3,enum=control.LogStream" json:"stream,omitempty"`
+	Data          []byte    `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`                                      // Raw output bytes (may be empty on the eof chunk)
+	DroppedBytes  int64     `protobuf:"varint,7,opt,name=dropped_bytes,json=droppedBytes,proto3" json:"dropped_bytes,omitempty"` // Bytes of this stream dropped by the agent right before data
+	Eof           bool      `protobuf:"varint,8,opt,name=eof,proto3" json:"eof,omitempty"`                                       // Last chunk of the attempt
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *JobStatus) Reset() {
-	*x = JobStatus{}
-	mi := &file_control_proto_msgTypes[11]
+func (x *LogChunk) Reset() {
+	*x = LogChunk{}
+	mi := &file_control_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *JobStatus) String() string {
+func (x *LogChunk) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*JobStatus) ProtoMessage() {}
+func (*LogChunk) ProtoMessage() {}
 
-func (x *JobStatus) ProtoReflect() protoreflect.Message {
-	mi := &file_control_proto_msgTypes[11]
+func (x *LogChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1159,65 +2787,141 @@ func (x *JobStatus) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use JobStatus.ProtoReflect.Descriptor instead.
-func (*JobStatus) Descriptor() ([]byte, []int) {
-	return file_control_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use LogChunk.ProtoReflect.Descriptor instead.
+func (*LogChunk) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{26}
 }
 
-func (x *JobStatus) GetJobId() string {
+func (x *LogChunk) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *LogChunk) GetJobId() string {
 	if x != nil {
 		return x.JobId
 	}
 	return ""
 }
 
-func (x *JobStatus) GetAttemptId() int32 {
+func (x *LogChunk) GetAttemptId() int32 {
 	if x != nil {
 		return x.AttemptId
 	}
 	return 0
 }
 
-func (x *JobStatus) GetStatus() JobStatusEnum {
+func (x *LogChunk) GetSeq() int64 {
 	if x != nil {
-		return x.Status
+		return x.Seq
 	}
-	return JobStatusEnum_JOB_STATUS_UNKNOWN
+	return 0
 }
 
-func (x *JobStatus) GetMessage() string {
+func (x *LogChunk) GetStream() LogStream {
 	if x != nil {
-		return x.Message
+		return x.Stream
 	}
-	return ""
+	return LogStream_LOG_STREAM_UNSPECIFIED
 }
 
-func (x *JobStatus) GetOutputKey() string {
+func (x *LogChunk) GetData() []byte {
 	if x != nil {
-		return x.OutputKey
+		return x.Data
 	}
-	return ""
+	return nil
 }
 
-func (x *JobStatus) GetStdout() string {
+func (x *LogChunk) GetDroppedBytes() int64 {
 	if x != nil {
-		return x.Stdout
+		return x.DroppedBytes
 	}
-	return ""
+	return 0
 }
 
-func (x *JobStatus) GetStderr() string {
+func (x *LogChunk) GetEof() bool {
 	if x != nil {
-		return x.Stderr
+		return x.Eof
+	}
+	return false
+}
+
+// LogChunkAck: Cloud acknowledges log chunks (cumulative)
+type LogChunkAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AttemptId     int32                  `protobuf:"varint,2,opt,name=attempt_id,json=attemptId,proto3" json:"attempt_id,omitempty"`
+	AckedSeq      int64                  `protobuf:"varint,3,opt,name=acked_seq,json=ackedSeq,proto3" json:"acked_seq,omitempty"` // Highest seq received; chunks up to it need not be kept
+	Stop          bool                   `protobuf:"varint,4,opt,name=stop,proto3" json:"stop,omitempty"`                         // The attempt no longer accepts logs (job finished or reassigned); stop sending
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogChunkAck) Reset() {
+	*x = LogChunkAck{}
+	mi := &file_control_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogChunkAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogChunkAck) ProtoMessage() {}
+
+func (x *LogChunkAck) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogChunkAck.ProtoReflect.Descriptor instead.
+func (*LogChunkAck) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *LogChunkAck) GetJobId() string {
+	if x != nil {
+		return x.JobId
 	}
 	return ""
 }
 
+func (x *LogChunkAck) GetAttemptId() int32 {
+	if x != nil {
+		return x.AttemptId
+	}
+	return 0
+}
+
+func (x *LogChunkAck) GetAckedSeq() int64 {
+	if x != nil {
+		return x.AckedSeq
+	}
+	return 0
+}
+
+func (x *LogChunkAck) GetStop() bool {
+	if x != nil {
+		return x.Stop
+	}
+	return false
+}
+
 var File_control_proto protoreflect.FileDescriptor
 
 const file_control_proto_rawDesc = "" +
 	"\n" +
-	"\rcontrol.proto\x12\acontrol\"\xf3\x03\n" +
+	"\rcontrol.proto\x12\acontrol\"\xdd\x06\n" +
 	"\bEnvelope\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1d\n" +
 	"\n" +
@@ -1232,14 +2936,29 @@ const file_control_proto_rawDesc = "" +
 	"requestJob\x129\n" +
 	"\fjob_assigned\x18\x0f \x01(\v2\x14.control.JobAssignedH\x00R\vjobAssigned\x123\n" +
 	"\n" +
-	"job_status\x18\x10 \x01(\v2\x12.control.JobStatusH\x00R\tjobStatusB\t\n" +
-	"\apayload\"\x8b\x01\n" +
+	"job_status\x18\x10 \x01(\v2\x12.control.JobStatusH\x00R\tjobStatus\x12?\n" +
+	"\x0erefresh_access\x18\x11 \x01(\v2\x16.control.RefreshAccessH\x00R\rrefreshAccess\x12I\n" +
+	"\x12refresh_access_ack\x18\x12 \x01(\v2\x19.control.RefreshAccessAckH\x00R\x10refreshAccessAck\x120\n" +
+	"\tlog_chunk\x18\x13 \x01(\v2\x11.control.LogChunkH\x00R\blogChunk\x12:\n" +
+	"\rlog_chunk_ack\x18\x14 \x01(\v2\x14.control.LogChunkAckH\x00R\vlogChunkAck\x129\n" +
+	"\fjob_progress\x18\x15 \x01(\v2\x14.control.JobProgressH\x00R\vjobProgress\x123\n" +
+	"\n" +
+	"cancel_job\x18\x16 \x01(\v2\x12.control.CancelJobH\x00R\tcancelJobB\t\n" +
+	"\apayload\"\xea\x01\n" +
 	"\bRegister\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1f\n" +
 	"\vagent_token\x18\x02 \x01(\tR\n" +
 	"agentToken\x12\x1a\n" +
 	"\bhostname\x18\x03 \x01(\tR\bhostname\x12'\n" +
-	"\x0fmax_concurrency\x18\x04 \x01(\x05R\x0emaxConcurrency\"w\n" +
+	"\x0fmax_concurrency\x18\x04 \x01(\x05R\x0emaxConcurrency\x12\x1c\n" +
+	"\ttemplates\x18\x05 \x03(\tR\ttemplates\x12?\n" +
+	"\x0fforward_targets\x18\x06 \x03(\v2\x16.control.ForwardTargetR\x0eforwardTargets\"p\n" +
+	"\rForwardTarget\x12\x16\n" +
+	"\x06scheme\x18\x01 \x01(\tR\x06scheme\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port\x12\x1f\n" +
+	"\vpath_prefix\x18\x04 \x01(\tR\n" +
+	"pathPrefix\"w\n" +
 	"\vRegisterAck\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x124\n" +
@@ -1252,13 +2971,35 @@ const file_control_proto_rawDesc = "" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\"0\n" +
 	"\x06Header\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value\"\x9e\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\xcb\x01\n" +
 	"\x12ForwardHttpRequest\x12\x10\n" +
 	"\x03url\x18\x01 \x01(\tR\x03url\x12\x16\n" +
 	"\x06method\x18\x02 \x01(\tR\x06method\x12)\n" +
 	"\aheaders\x18\x03 \x03(\v2\x0f.control.HeaderR\aheaders\x12\x12\n" +
 	"\x04body\x18\x04 \x01(\fR\x04body\x12\x1f\n" +
 	"\vtimeout_sec\x18\x05 \x01(\x05R\n" +
+	"timeoutSec\x12+\n" +
+	"\x05async\x18\x06 \x01(\v2\x15.control.ForwardAsyncR\x05async\"\xdc\x02\n" +
+	"\fForwardAsync\x12\"\n" +
+	"\rtask_id_field\x18\x01 \x01(\tR\vtaskIdField\x12\x1d\n" +
+	"\n" +
+	"status_url\x18\x02 \x01(\tR\tstatusUrl\x12*\n" +
+	"\x11poll_interval_sec\x18\x03 \x01(\x05R\x0fpollIntervalSec\x12\x1f\n" +
+	"\vstate_field\x18\x04 \x01(\tR\n" +
+	"stateField\x12)\n" +
+	"\x10succeeded_states\x18\x05 \x03(\tR\x0fsucceededStates\x12#\n" +
+	"\rfailed_states\x18\x06 \x03(\tR\ffailedStates\x12\x1d\n" +
+	"\n" +
+	"result_url\x18\a \x01(\tR\tresultUrl\x12(\n" +
+	"\x10result_url_field\x18\b \x01(\tR\x0eresultUrlField\x12#\n" +
+	"\rmessage_field\x18\t \x01(\tR\fmessageField\"\xda\x01\n" +
+	"\x12ForwardGrpcRequest\x12\x16\n" +
+	"\x06target\x18\x01 \x01(\tR\x06target\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x12!\n" +
+	"\frequest_json\x18\x03 \x01(\tR\vrequestJson\x12#\n" +
+	"\rrequest_proto\x18\x04 \x01(\fR\frequestProto\x12+\n" +
+	"\bmetadata\x18\x05 \x03(\v2\x0f.control.HeaderR\bmetadata\x12\x1f\n" +
+	"\vtimeout_sec\x18\x06 \x01(\x05R\n" +
 	"timeoutSec\"\xd9\x01\n" +
 	"\bSTSCreds\x12\"\n" +
 	"\raccess_key_id\x18\x01 \x01(\tR\vaccessKeyId\x12*\n" +
@@ -1275,7 +3016,7 @@ const file_control_proto_rawDesc = "" +
 	"RequestJob\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\"\n" +
 	"\fcapabilities\x18\x02 \x03(\tR\fcapabilities\x12'\n" +
-	"\x0fmax_concurrency\x18\x03 \x01(\x05R\x0emaxConcurrency\"\xab\x04\n" +
+	"\x0fmax_concurrency\x18\x03 \x01(\x05R\x0emaxConcurrency\"\xc2\b\n" +
 	"\vJobAssigned\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1d\n" +
 	"\n" +
@@ -1292,7 +3033,32 @@ const file_control_proto_rawDesc = "" +
 	"\acommand\x18\t \x01(\tR\acommand\x12/\n" +
 	"\bjob_type\x18\v \x01(\x0e2\x14.control.JobTypeEnumR\ajobType\x12>\n" +
 	"\fforward_http\x18\f \x01(\v2\x1b.control.ForwardHttpRequestR\vforwardHttp\x12G\n" +
-	"\x12input_forward_mode\x18\r \x01(\x0e2\x19.control.InputForwardModeR\x10inputForwardMode\"\xda\x01\n" +
+	"\x12input_forward_mode\x18\r \x01(\x0e2\x19.control.InputForwardModeR\x10inputForwardMode\x12)\n" +
+	"\x06inputs\x18\x0e \x03(\v2\x11.control.JobInputR\x06inputs\x12!\n" +
+	"\finput_bucket\x18\x0f \x01(\tR\vinputBucket\x12!\n" +
+	"\finput_sha256\x18\x10 \x01(\tR\vinputSha256\x12\x1f\n" +
+	"\vtimeout_sec\x18\x11 \x01(\x05R\n" +
+	"timeoutSec\x12\x12\n" +
+	"\x04argv\x18\x12 \x03(\tR\x04argv\x12/\n" +
+	"\x03env\x18\x13 \x03(\v2\x1d.control.JobAssigned.EnvEntryR\x03env\x12\x1f\n" +
+	"\vworking_dir\x18\x14 \x01(\tR\n" +
+	"workingDir\x12\x1a\n" +
+	"\btemplate\x18\x15 \x01(\tR\btemplate\x128\n" +
+	"\x06params\x18\x16 \x03(\v2 .control.JobAssigned.ParamsEntryR\x06params\x12>\n" +
+	"\fforward_grpc\x18\x17 \x01(\v2\x1b.control.ForwardGrpcRequestR\vforwardGrpc\x12\x14\n" +
+	"\x05shell\x18\x18 \x01(\bR\x05shell\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a9\n" +
+	"\vParamsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x90\x01\n" +
+	"\bJobInput\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12.\n" +
+	"\bdownload\x18\x03 \x01(\v2\x12.control.OSSAccessR\bdownload\x12\x16\n" +
+	"\x06bucket\x18\x04 \x01(\tR\x06bucket\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\"\x91\x04\n" +
 	"\tJobStatus\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1d\n" +
 	"\n" +
@@ -1302,7 +3068,115 @@ const file_control_proto_rawDesc = "" +
 	"\n" +
 	"output_key\x18\x05 \x01(\tR\toutputKey\x12\x16\n" +
 	"\x06stdout\x18\x06 \x01(\tR\x06stdout\x12\x16\n" +
-	"\x06stderr\x18\a \x01(\tR\x06stderr*\xb7\x01\n" +
+	"\x06stderr\x18\a \x01(\tR\x06stderr\x126\n" +
+	"\foutput_files\x18\b \x03(\v2\x13.control.OutputFileR\voutputFiles\x12!\n" +
+	"\fmanifest_key\x18\t \x01(\tR\vmanifestKey\x12#\n" +
+	"\rcached_inputs\x18\n" +
+	" \x03(\tR\fcachedInputs\x12+\n" +
+	"\x06output\x18\v \x01(\v2\x13.control.OutputFileR\x06output\x12+\n" +
+	"\x05usage\x18\f \x01(\v2\x15.control.ProcessUsageR\x05usage\x12\x16\n" +
+	"\x06reason\x18\r \x01(\tR\x06reason\x12C\n" +
+	"\x10forward_response\x18\x0e \x01(\v2\x18.control.ForwardResponseR\x0fforwardResponse\"]\n" +
+	"\x0fForwardResponse\x12\x1f\n" +
+	"\vstatus_code\x18\x01 \x01(\x05R\n" +
+	"statusCode\x12)\n" +
+	"\aheaders\x18\x02 \x03(\v2\x0f.control.HeaderR\aheaders\"\xe5\x01\n" +
+	"\fProcessUsage\x12\x16\n" +
+	"\x06exited\x18\x01 \x01(\bR\x06exited\x12\x1b\n" +
+	"\texit_code\x18\x02 \x01(\x05R\bexitCode\x12\x16\n" +
+	"\x06signal\x18\x03 \x01(\tR\x06signal\x12 \n" +
+	"\fwall_time_ms\x18\x04 \x01(\x03R\n" +
+	"wallTimeMs\x12\x1e\n" +
+	"\vuser_cpu_ms\x18\x05 \x01(\x03R\tuserCpuMs\x12\"\n" +
+	"\rsystem_cpu_ms\x18\x06 \x01(\x03R\vsystemCpuMs\x12\"\n" +
+	"\rmax_rss_bytes\x18\a \x01(\x03R\vmaxRssBytes\"\x81\x01\n" +
+	"\n" +
+	"OutputFile\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\x12!\n" +
+	"\fcontent_type\x18\x04 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\"\xf9\x01\n" +
+	"\vJobProgress\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x15\n" +
+	"\x06job_id\x18\x02 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x03 \x01(\x05R\tattemptId\x12\x18\n" +
+	"\apercent\x18\x04 \x01(\x01R\apercent\x12!\n" +
+	"\fcurrent_step\x18\x05 \x01(\x05R\vcurrentStep\x12\x1f\n" +
+	"\vtotal_steps\x18\x06 \x01(\x05R\n" +
+	"totalSteps\x12\x18\n" +
+	"\amessage\x18\a \x01(\tR\amessage\x12!\n" +
+	"\fmetrics_json\x18\b \x01(\tR\vmetricsJson\"s\n" +
+	"\tCancelJob\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x02 \x01(\x05R\tattemptId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"\x9c\x02\n" +
+	"\rRefreshAccess\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x15\n" +
+	"\x06job_id\x18\x02 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x03 \x01(\x05R\tattemptId\x12\x19\n" +
+	"\blease_id\x18\x04 \x01(\tR\aleaseId\x12\x14\n" +
+	"\x05input\x18\x05 \x01(\bR\x05input\x12\x16\n" +
+	"\x06output\x18\x06 \x01(\bR\x06output\x12!\n" +
+	"\foutput_files\x18\a \x03(\tR\voutputFiles\x12\x16\n" +
+	"\x06inputs\x18\b \x03(\tR\x06inputs\x126\n" +
+	"\tmultipart\x18\t \x01(\v2\x18.control.MultipartUploadR\tmultipart\"\xcf\x01\n" +
+	"\x0fMultipartUpload\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1b\n" +
+	"\tupload_id\x18\x02 \x01(\tR\buploadId\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12!\n" +
+	"\fpart_numbers\x18\x04 \x03(\x05R\vpartNumbers\x121\n" +
+	"\bcomplete\x18\x05 \x03(\v2\x15.control.UploadedPartR\bcomplete\x12\x14\n" +
+	"\x05abort\x18\x06 \x01(\bR\x05abort\"C\n" +
+	"\fUploadedPart\x12\x1f\n" +
+	"\vpart_number\x18\x01 \x01(\x05R\n" +
+	"partNumber\x12\x12\n" +
+	"\x04etag\x18\x02 \x01(\tR\x04etag\"\x86\x02\n" +
+	"\x12MultipartUploadAck\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1b\n" +
+	"\tupload_id\x18\x02 \x01(\tR\buploadId\x12O\n" +
+	"\fpart_uploads\x18\x03 \x03(\v2,.control.MultipartUploadAck.PartUploadsEntryR\vpartUploads\x12\x1c\n" +
+	"\tcompleted\x18\x04 \x01(\bR\tcompleted\x1aR\n" +
+	"\x10PartUploadsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.control.OSSAccessR\x05value:\x028\x01\"\xb1\x04\n" +
+	"\x10RefreshAccessAck\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x02 \x01(\x05R\tattemptId\x12\x18\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x129\n" +
+	"\x0einput_download\x18\x05 \x01(\v2\x12.control.OSSAccessR\rinputDownload\x127\n" +
+	"\routput_upload\x18\x06 \x01(\v2\x12.control.OSSAccessR\foutputUpload\x12\x1d\n" +
+	"\n" +
+	"output_key\x18\a \x01(\tR\toutputKey\x12`\n" +
+	"\x13output_file_uploads\x18\b \x03(\v20.control.RefreshAccessAck.OutputFileUploadsEntryR\x11outputFileUploads\x12)\n" +
+	"\x06inputs\x18\t \x03(\v2\x11.control.JobInputR\x06inputs\x129\n" +
+	"\tmultipart\x18\n" +
+	" \x01(\v2\x1b.control.MultipartUploadAckR\tmultipart\x1aX\n" +
+	"\x16OutputFileUploadsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12(\n" +
+	"\x05value\x18\x02 \x01(\v2\x12.control.OSSAccessR\x05value:\x028\x01\"\xe4\x01\n" +
+	"\bLogChunk\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x15\n" +
+	"\x06job_id\x18\x02 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x03 \x01(\x05R\tattemptId\x12\x10\n" +
+	"\x03seq\x18\x04 \x01(\x03R\x03seq\x12*\n" +
+	"\x06stream\x18\x05 \x01(\x0e2\x12.control.LogStreamR\x06stream\x12\x12\n" +
+	"\x04data\x18\x06 \x01(\fR\x04data\x12#\n" +
+	"\rdropped_bytes\x18\a \x01(\x03R\fdroppedBytes\x12\x10\n" +
+	"\x03eof\x18\b \x01(\bR\x03eof\"t\n" +
+	"\vLogChunkAck\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"attempt_id\x18\x02 \x01(\x05R\tattemptId\x12\x1b\n" +
+	"\tacked_seq\x18\x03 \x01(\x03R\backedSeq\x12\x12\n" +
+	"\x04stop\x18\x04 \x01(\bR\x04stop*\xb7\x01\n" +
 	"\rJobStatusEnum\x12\x16\n" +
 	"\x12JOB_STATUS_UNKNOWN\x10\x00\x12\x17\n" +
 	"\x13JOB_STATUS_ASSIGNED\x10\x01\x12\x16\n" +
@@ -1310,15 +3184,20 @@ const file_control_proto_rawDesc = "" +
 	"\x14JOB_STATUS_SUCCEEDED\x10\x03\x12\x15\n" +
 	"\x11JOB_STATUS_FAILED\x10\x04\x12\x17\n" +
 	"\x13JOB_STATUS_CANCELED\x10\x05\x12\x13\n" +
-	"\x0fJOB_STATUS_LOST\x10\x06*T\n" +
+	"\x0fJOB_STATUS_LOST\x10\x06*o\n" +
 	"\vJobTypeEnum\x12\x14\n" +
 	"\x10JOB_TYPE_UNKNOWN\x10\x00\x12\x14\n" +
 	"\x10JOB_TYPE_COMMAND\x10\x01\x12\x19\n" +
-	"\x15JOB_TYPE_FORWARD_HTTP\x10\x02*u\n" +
+	"\x15JOB_TYPE_FORWARD_HTTP\x10\x02\x12\x19\n" +
+	"\x15JOB_TYPE_FORWARD_GRPC\x10\x03*u\n" +
 	"\x10InputForwardMode\x12\"\n" +
 	"\x1eINPUT_FORWARD_MODE_UNSPECIFIED\x10\x00\x12\x1a\n" +
 	"\x16INPUT_FORWARD_MODE_URL\x10\x01\x12!\n" +
-	"\x1dINPUT_FORWARD_MODE_LOCAL_FILE\x10\x02B-Z+github.com/xiresource/proto/control;controlb\x06proto3"
+	"\x1dINPUT_FORWARD_MODE_LOCAL_FILE\x10\x02*U\n" +
+	"\tLogStream\x12\x1a\n" +
+	"\x16LOG_STREAM_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11LOG_STREAM_STDOUT\x10\x01\x12\x15\n" +
+	"\x11LOG_STREAM_STDERR\x10\x02B-Z+github.com/xiresource/proto/control;controlb\x06proto3"
 
 var (
 	file_control_proto_rawDescOnce sync.Once
@@ -1332,46 +3211,97 @@ func file_control_proto_rawDescGZIP() []byte {
 	return file_control_proto_rawDescData
 }
 
-var file_control_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_control_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 32)
 var file_control_proto_goTypes = []any{
 	(JobStatusEnum)(0),         // 0: control.JobStatusEnum
 	(JobTypeEnum)(0),           // 1: control.JobTypeEnum
 	(InputForwardMode)(0),      // 2: control.InputForwardMode
-	(*Envelope)(nil),           // 3: control.Envelope
-	(*Register)(nil),           // 4: control.Register
-	(*RegisterAck)(nil),        // 5: control.RegisterAck
-	(*Heartbeat)(nil),          // 6: control.Heartbeat
-	(*HeartbeatAck)(nil),       // 7: control.HeartbeatAck
-	(*Header)(nil),             // 8: control.Header
-	(*ForwardHttpRequest)(nil), // 9: control.ForwardHttpRequest
-	(*STSCreds)(nil),           // 10: control.STSCreds
-	(*OSSAccess)(nil),          // 11: control.OSSAccess
-	(*RequestJob)(nil),         // 12: control.RequestJob
-	(*JobAssigned)(nil),        // 13: control.JobAssigned
-	(*JobStatus)(nil),          // 14: control.JobStatus
+	(LogStream)(0),             // 3: control.LogStream
+	(*Envelope)(nil),           // 4: control.Envelope
+	(*Register)(nil),           // 5: control.Register
+	(*ForwardTarget)(nil),      // 6: control.ForwardTarget
+	(*RegisterAck)(nil),        // 7: control.RegisterAck
+	(*Heartbeat)(nil),          // 8: control.Heartbeat
+	(*HeartbeatAck)(nil),       // 9: control.HeartbeatAck
+	(*Header)(nil),             // 10: control.Header
+	(*ForwardHttpRequest)(nil), // 11: control.ForwardHttpRequest
+	(*ForwardAsync)(nil),       // 12: control.ForwardAsync
+	(*ForwardGrpcRequest)(nil), // 13: control.ForwardGrpcRequest
+	(*STSCreds)(nil),           // 14: control.STSCreds
+	(*OSSAccess)(nil),          // 15: control.OSSAccess
+	(*RequestJob)(nil),         // 16: control.RequestJob
+	(*JobAssigned)(nil),        // 17: control.JobAssigned
+	(*JobInput)(nil),           // 18: control.JobInput
+	(*JobStatus)(nil),          // 19: control.JobStatus
+	(*ForwardResponse)(nil),    // 20: control.ForwardResponse
+	(*ProcessUsage)(nil),       // 21: control.ProcessUsage
+	(*OutputFile)(nil),         // 22: control.OutputFile
+	(*JobProgress)(nil),        // 23: control.JobProgress
+	(*CancelJob)(nil),          // 24: control.CancelJob
+	(*RefreshAccess)(nil),      // 25: control.RefreshAccess
+	(*MultipartUpload)(nil),    // 26: control.MultipartUpload
+	(*UploadedPart)(nil),       // 27: control.UploadedPart
+	(*MultipartUploadAck)(nil), // 28: control.MultipartUploadAck
+	(*RefreshAccessAck)(nil),   // 29: control.RefreshAccessAck
+	(*LogChunk)(nil),           // 30: control.LogChunk
+	(*LogChunkAck)(nil),        // 31: control.LogChunkAck
+	nil,                        // 32: control.JobAssigned.EnvEntry
+	nil,                        // 33: control.JobAssigned.ParamsEntry
+	nil,                        // 34: control.MultipartUploadAck.PartUploadsEntry
+	nil,                        // 35: control.RefreshAccessAck.OutputFileUploadsEntry
 }
 var file_control_proto_depIdxs = []int32{
-	4,  // 0: control.Envelope.register:type_name -> control.Register
-	6,  // 1: control.Envelope.heartbeat:type_name -> control.Heartbeat
-	5,  // 2: control.Envelope.register_ack:type_name -> control.RegisterAck
-	7,  // 3: control.Envelope.heartbeat_ack:type_name -> control.HeartbeatAck
-	12, // 4: control.Envelope.request_job:type_name -> control.RequestJob
-	13, // 5: control.Envelope.job_assigned:type_name -> control.JobAssigned
-	14, // 6: control.Envelope.job_status:type_name -> control.JobStatus
-	8,  // 7: control.ForwardHttpRequest.headers:type_name -> control.Header
-	10, // 8: control.OSSAccess.sts:type_name -> control.STSCreds
-	11, // 9: control.JobAssigned.input_download:type_name -> control.OSSAccess
-	11, // 10: control.JobAssigned.output_upload:type_name -> control.OSSAccess
-	1,  // 11: control.JobAssigned.job_type:type_name -> control.JobTypeEnum
-	9,  // 12: control.JobAssigned.forward_http:type_name -> control.ForwardHttpRequest
-	2,  // 13: control.JobAssigned.input_forward_mode:type_name -> control.InputForwardMode
-	0,  // 14: control.JobStatus.status:type_name -> control.JobStatusEnum
-	15, // [15:15] is the sub-list for method output_type
-	15, // [15:15] is the sub-list for method input_type
-	15, // [15:15] is the sub-list for extension type_name
-	15, // [15:15] is the sub-list for extension extendee
-	0,  // [0:15] is the sub-list for field type_name
+	5,  // 0: control.Envelope.register:type_name -> control.Register
+	8,  // 1: control.Envelope.heartbeat:type_name -> control.Heartbeat
+	7,  // 2: control.Envelope.register_ack:type_name -> control.RegisterAck
+	9,  // 3: control.Envelope.heartbeat_ack:type_name -> control.HeartbeatAck
+	16, // 4: control.Envelope.request_job:type_name -> control.RequestJob
+	17, // 5: control.Envelope.job_assigned:type_name -> control.JobAssigned
+	19, // 6: control.Envelope.job_status:type_name -> control.JobStatus
+	25, // 7: control.Envelope.refresh_access:type_name -> control.RefreshAccess
+	29, // 8: control.Envelope.refresh_access_ack:type_name -> control.RefreshAccessAck
+	30, // 9: control.Envelope.log_chunk:type_name -> control.LogChunk
+	31, // 10: control.Envelope.log_chunk_ack:type_name -> control.LogChunkAck
+	23, // 11: control.Envelope.job_progress:type_name -> control.JobProgress
+	24, // 12: control.Envelope.cancel_job:type_name -> control.CancelJob
+	6,  // 13: control.Register.forward_targets:type_name -> control.ForwardTarget
+	10, // 14: control.ForwardHttpRequest.headers:type_name -> control.Header
+	12, // 15: control.ForwardHttpRequest.async:type_name -> control.ForwardAsync
+	10, // 16: control.ForwardGrpcRequest.metadata:type_name -> control.Header
+	14, // 17: control.OSSAccess.sts:type_name -> control.STSCreds
+	15, // 18: control.JobAssigned.input_download:type_name -> control.OSSAccess
+	15, // 19: control.JobAssigned.output_upload:type_name -> control.OSSAccess
+	1,  // 20: control.JobAssigned.job_type:type_name -> control.JobTypeEnum
+	11, // 21: control.JobAssigned.forward_http:type_name -> control.ForwardHttpRequest
+	2,  // 22: control.JobAssigned.input_forward_mode:type_name -> control.InputForwardMode
+	18, // 23: control.JobAssigned.inputs:type_name -> control.JobInput
+	32, // 24: control.JobAssigned.env:type_name -> control.JobAssigned.EnvEntry
+	33, // 25: control.JobAssigned.params:type_name -> control.JobAssigned.ParamsEntry
+	13, // 26: control.JobAssigned.forward_grpc:type_name -> control.ForwardGrpcRequest
+	15, // 27: control.JobInput.download:type_name -> control.OSSAccess
+	0,  // 28: control.JobStatus.status:type_name -> control.JobStatusEnum
+	22, // 29: control.JobStatus.output_files:type_name -> control.OutputFile
+	22, // 30: control.JobStatus.output:type_name -> control.OutputFile
+	21, // 31: control.JobStatus.usage:type_name -> control.ProcessUsage
+	20, // 32: control.JobStatus.forward_response:type_name -> control.ForwardResponse
+	10, // 33: control.ForwardResponse.headers:type_name -> control.Header
+	26, // 34: control.RefreshAccess.multipart:type_name -> control.MultipartUpload
+	27, // 35: control.MultipartUpload.complete:type_name -> control.UploadedPart
+	34, // 36: control.MultipartUploadAck.part_uploads:type_name -> control.MultipartUploadAck.PartUploadsEntry
+	15, // 37: control.RefreshAccessAck.input_download:type_name -> control.OSSAccess
+	15, // 38: control.RefreshAccessAck.output_upload:type_name -> control.OSSAccess
+	35, // 39: control.RefreshAccessAck.output_file_uploads:type_name -> control.RefreshAccessAck.OutputFileUploadsEntry
+	18, // 40: control.RefreshAccessAck.inputs:type_name -> control.JobInput
+	28, // 41: control.RefreshAccessAck.multipart:type_name -> control.MultipartUploadAck
+	3,  // 42: control.LogChunk.stream:type_name -> control.LogStream
+	15, // 43: control.MultipartUploadAck.PartUploadsEntry.value:type_name -> control.OSSAccess
+	15, // 44: control.RefreshAccessAck.OutputFileUploadsEntry.value:type_name -> control.OSSAccess
+	45, // [45:45] is the sub-list for method output_type
+	45, // [45:45] is the sub-list for method input_type
+	45, // [45:45] is the sub-list for extension type_name
+	45, // [45:45] is the sub-list for extension extendee
+	0,  // [0:45] is the sub-list for field type_name
 }
 
 func init() { file_control_proto_init() }
@@ -1387,8 +3317,14 @@ func file_control_proto_init() {
 		(*Envelope_RequestJob)(nil),
 		(*Envelope_JobAssigned)(nil),
 		(*Envelope_JobStatus)(nil),
-	}
-	file_control_proto_msgTypes[8].OneofWrappers = []any{
+		(*Envelope_RefreshAccess)(nil),
+		(*Envelope_RefreshAccessAck)(nil),
+		(*Envelope_LogChunk)(nil),
+		(*Envelope_LogChunkAck)(nil),
+		(*Envelope_JobProgress)(nil),
+		(*Envelope_CancelJob)(nil),
+	}
+	file_control_proto_msgTypes[11].OneofWrappers = []any{
 		(*OSSAccess_PresignedUrl)(nil),
 		(*OSSAccess_Sts)(nil),
 	}
@@ -1397,8 +3333,8 @@ func file_control_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
-			NumEnums:      3,
-			NumMessages:   12,
+			NumEnums:      4,
+			NumMessages:   32,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,89 @@
+package control
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// LoopbackHost is the ForwardTarget host matching localhost, 127.0.0.0/8 and ::1
+const LoopbackHost = "loopback"
+
+// DefaultForwardTargets permits forwarding to any service on the loopback interface
+func DefaultForwardTargets() []*ForwardTarget {
+	return []*ForwardTarget{{Host: LoopbackHost}}
+}
+
+// PermitsForward reports whether any of the targets permits a forward request to rawURL
+func PermitsForward(targets []*ForwardTarget, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, target := range targets {
+		if target.Permits(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// GRPCTargetURL is the URL a FORWARD_GRPC call to method ("package.Service/Method") on target ("host:port")
+// is checked against forward targets as: gRPC runs over HTTP/2 with the method as the request path
+func GRPCTargetURL(target, method string) string {
+	return "http://" + target + "/" + strings.TrimPrefix(method, "/")
+}
+
+// Permits reports whether the target permits a forward request to u
+func (t *ForwardTarget) Permits(u *url.URL) bool {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return false
+	}
+	if t.Scheme != "" && !strings.EqualFold(t.Scheme, scheme) {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(t.Host, LoopbackHost) {
+		if !isLoopback(host) {
+			return false
+		}
+	} else if !strings.EqualFold(strings.Trim(t.Host, "[]"), host) {
+		return false
+	}
+
+	if t.Port != 0 {
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if scheme == "https" {
+				port = "443"
+			}
+		}
+		if port != strconv.Itoa(int(t.Port)) {
+			return false
+		}
+	}
+
+	// Compare the cleaned path so "/api/../admin" does not pass as "/api"
+	prefix := strings.TrimSuffix(t.PathPrefix, "/")
+	if prefix == "" {
+		return true
+	}
+	p := path.Clean("/" + u.Path)
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
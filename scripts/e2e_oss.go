@@ -3,6 +3,10 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +16,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +28,9 @@ const (
 	serverPort = "8081" // Use different port to avoid conflicts with M0_e2e.go
 	serverURL  = "http://localhost:" + serverPort
 	wssURL     = "ws://localhost:" + serverPort + "/wss"
+
+	objstorePort = "9101" // cmd/objstore port in local mode
+	objstoreURL  = "http://localhost:" + objstorePort
 )
 
 // Environment variables for OSS e2e test
@@ -33,6 +41,9 @@ const (
 	envOSSAccessKey = "E2E_OSS_ACCESS_KEY_ID"
 	envOSSSecretKey = "E2E_OSS_ACCESS_KEY_SECRET"
 	envOSSPrefix    = "E2E_OSS_PREFIX" // Default: "e2e/test/"
+	// E2E_OSS_PROVIDER=local (or OSS_PROVIDER=local) runs offline against cmd/objstore
+	envOSSProvider = "E2E_OSS_PROVIDER"
+	envOSSLocalDir = "E2E_OSS_LOCAL_DIR" // Uses LOCAL_OSS_DIR, then a temporary directory if not set
 )
 
 // Environment variables for MySQL e2e test
@@ -70,11 +81,20 @@ func main() {
 		fmt.Println("  E2E_OSS_BUCKET (or COS_BUCKET)")
 		fmt.Println("  E2E_OSS_REGION (or COS_REGION)")
 		fmt.Println("Optional: E2E_OSS_PREFIX (default: e2e/test/)")
+		fmt.Println("Or run offline with E2E_OSS_PROVIDER=local (no cloud bucket needed)")
 		os.Exit(0) // Exit with 0 to indicate skip, not failure
 	}
 
-	fmt.Printf("✓ OSS configuration loaded (bucket: %s, region: %s, prefix: %s)\n",
-		ossConfig.Bucket, ossConfig.Region, getOSSPrefix())
+	if ossConfig.Provider == "local" {
+		fmt.Printf("✓ Local object store configuration loaded (directory: %s, bucket: %s, prefix: %s)\n",
+			ossConfig.LocalDir, ossConfig.Bucket, getOSSPrefix())
+		if ossConfig.LocalDirTemp {
+			defer os.RemoveAll(ossConfig.LocalDir)
+		}
+	} else {
+		fmt.Printf("✓ OSS configuration loaded (bucket: %s, region: %s, prefix: %s)\n",
+			ossConfig.Bucket, ossConfig.Region, getOSSPrefix())
+	}
 
 	// Check MySQL configuration
 	mysqlConfig := loadMySQLConfig()
@@ -112,15 +132,47 @@ func main() {
 	// Create OSS provider for test operations
 	// We'll use the COS SDK directly in the test since we can't easily import cloud/internal/oss
 	// This is acceptable for e2e tests
-	testProvider, err := newCOSTestProvider(ossConfig)
-	if err != nil {
-		fmt.Printf("✗ Failed to create OSS provider: %v\n", err)
-		os.Exit(1)
+	var testProvider COSTestProvider
+	if ossConfig.Provider == "local" {
+		testProvider = newLocalTestProvider(ossConfig)
+	} else {
+		testProvider, err = newCOSTestProvider(ossConfig)
+		if err != nil {
+			fmt.Printf("✗ Failed to create OSS provider: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Local mode: serve the object directory with cmd/objstore, as agents would reach it in a lab
+	if ossConfig.Provider == "local" {
+		fmt.Println("\nStarting local object store...")
+		objstoreBin, built, err := findOrBuildObjstore(projectRoot)
+		if err != nil {
+			fmt.Printf("✗ Failed to locate or build objstore: %v\n", err)
+			os.Exit(1)
+		}
+		if built {
+			defer os.Remove(objstoreBin)
+		}
+		objstoreCmd := exec.CommandContext(ctx, objstoreBin, "-addr", ":"+objstorePort)
+		objstoreCmd.Stdout = os.Stdout
+		objstoreCmd.Stderr = os.Stderr
+		objstoreCmd.Env = append(os.Environ(), ossConfig.ServerEnv()...)
+		if err := objstoreCmd.Start(); err != nil {
+			fmt.Printf("✗ Failed to start objstore: %v\n", err)
+			os.Exit(1)
+		}
+		defer terminateProcess(objstoreCmd, "objstore")
+		if !waitForURL(objstoreURL+"/health", 15*time.Second) {
+			fmt.Println("✗ Object store failed to become ready (/health != 200)")
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Object store is ready at %s\n", objstoreURL)
+	}
+
 	// Step 1: Upload input object to OSS
 	fmt.Println("\n[1/6] Uploading input object to OSS...")
 	timestamp := time.Now().UnixNano()
@@ -164,13 +216,14 @@ func main() {
 	serverCmd := exec.CommandContext(ctx, absServerBin, "-addr", ":"+serverPort, "-dev")
 	serverCmd.Stdout = os.Stdout
 	serverCmd.Stderr = os.Stderr
+	// Local mode points the server's OSS provider at the object store (no-op for COS)
+	serverCmd.Env = append(os.Environ(), ossConfig.ServerEnv()...)
 	
 	// Set MySQL environment variables for server process if configured
 	// This allows the server to use MySQL instead of SQLite
 	// Reuse mysqlConfig loaded earlier in main()
 	if mysqlConfig != nil {
 		fmt.Println("Configuring server to use MySQL database...")
-		serverCmd.Env = os.Environ()
 		serverCmd.Env = append(serverCmd.Env, "DB_TYPE=mysql")
 		serverCmd.Env = append(serverCmd.Env, fmt.Sprintf("MYSQL_HOST=%s", mysqlConfig.Host))
 		serverCmd.Env = append(serverCmd.Env, fmt.Sprintf("MYSQL_PORT=%d", mysqlConfig.Port))
@@ -346,12 +399,29 @@ func main() {
 }
 
 type OSSConfig struct {
-	SecretID   string
-	SecretKey  string
-	Bucket     string
-	Region     string
-	BaseURL    string
-	PresignTTL time.Duration
+	Provider     string // "cos" or "local"
+	SecretID     string
+	SecretKey    string // local: URL signing secret shared by server and objstore
+	Bucket       string
+	Region       string
+	BaseURL      string
+	PresignTTL   time.Duration
+	LocalDir     string // local only: object directory
+	LocalDirTemp bool   // local only: LocalDir was created by the test and is removed afterwards
+}
+
+// ServerEnv returns the environment that points the server (and objstore) at the local object store
+func (c OSSConfig) ServerEnv() []string {
+	if c.Provider != "local" {
+		return nil
+	}
+	return []string{
+		"OSS_PROVIDER=local",
+		"LOCAL_OSS_DIR=" + c.LocalDir,
+		"LOCAL_OSS_SECRET=" + c.SecretKey,
+		"LOCAL_OSS_BASE_URL=" + c.BaseURL,
+		"LOCAL_OSS_BUCKET=" + c.Bucket,
+	}
 }
 
 func loadOSSConfig() (OSSConfig, error) {
@@ -372,6 +442,14 @@ func loadOSSConfig() (OSSConfig, error) {
 		}
 	}
 
+	provider := os.Getenv(envOSSProvider)
+	if provider == "" {
+		provider = os.Getenv("OSS_PROVIDER")
+	}
+	if strings.EqualFold(provider, "local") {
+		return loadLocalOSSConfig()
+	}
+
 	// Try to load from E2E-specific env vars first, then fall back to COS_* vars
 	accessKeyID := os.Getenv(envOSSAccessKey)
 	if accessKeyID == "" {
@@ -426,6 +504,37 @@ func loadOSSConfig() (OSSConfig, error) {
 	return config, nil
 }
 
+// loadLocalOSSConfig configures an offline run against cmd/objstore
+func loadLocalOSSConfig() (OSSConfig, error) {
+	config := OSSConfig{
+		Provider:   "local",
+		SecretKey:  os.Getenv("LOCAL_OSS_SECRET"),
+		Bucket:     "local",
+		BaseURL:    objstoreURL,
+		PresignTTL: 15 * time.Minute,
+		LocalDir:   os.Getenv(envOSSLocalDir),
+	}
+	if config.LocalDir == "" {
+		config.LocalDir = os.Getenv("LOCAL_OSS_DIR")
+	}
+	if config.LocalDir == "" {
+		dir, err := os.MkdirTemp("", "e2e-oss-local-")
+		if err != nil {
+			return OSSConfig{}, fmt.Errorf("failed to create object directory: %w", err)
+		}
+		config.LocalDir = dir
+		config.LocalDirTemp = true
+	}
+	if config.SecretKey == "" {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return OSSConfig{}, fmt.Errorf("failed to generate signing secret: %w", err)
+		}
+		config.SecretKey = hex.EncodeToString(secret)
+	}
+	return config, nil
+}
+
 // COSTestProvider wraps COS SDK for e2e testing
 type COSTestProvider interface {
 	ObjectExists(ctx context.Context, key string) (bool, error)
@@ -516,6 +625,59 @@ func (p *cosTestProvider) GenerateDownloadURL(ctx context.Context, key string) (
 	return presignedURL.String(), nil
 }
 
+// localTestProvider works on the object directory directly and signs download URLs like the
+// cloud server's local provider (HMAC-SHA256 over method, bucket/key, expiry and upload constraints)
+type localTestProvider struct {
+	config OSSConfig
+}
+
+func newLocalTestProvider(config OSSConfig) COSTestProvider {
+	return &localTestProvider{config: config}
+}
+
+func (p *localTestProvider) path(key string) string {
+	return filepath.Join(p.config.LocalDir, p.config.Bucket, filepath.FromSlash(key))
+}
+
+func (p *localTestProvider) ObjectExists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(p.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check object existence: %w", err)
+	}
+	return true, nil
+}
+
+func (p *localTestProvider) PutObject(ctx context.Context, key string, data []byte) error {
+	path := p.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (p *localTestProvider) DeleteObject(ctx context.Context, key string) error {
+	if err := os.Remove(p.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+func (p *localTestProvider) GenerateDownloadURL(ctx context.Context, key string) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(p.config.PresignTTL).Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(p.config.SecretKey))
+	mac.Write([]byte(strings.Join([]string{http.MethodGet, p.config.Bucket + "/" + key, expires, "", ""}, "\n")))
+	query := url.Values{}
+	query.Set("X-Expires", expires)
+	query.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return fmt.Sprintf("%s/%s/%s?%s", p.config.BaseURL, p.config.Bucket, key, query.Encode()), nil
+}
+
 func getOSSPrefix() string {
 	prefix := os.Getenv(envOSSPrefix)
 	if prefix == "" {
@@ -528,10 +690,11 @@ func getOSSPrefix() string {
 	return prefix
 }
 
-func waitForServer(timeout time.Duration) bool {
+// waitForURL polls url until it returns 200
+func waitForURL(url string, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
-		resp, err := http.Get(serverURL + "/health")
+		resp, err := http.Get(url)
 		if err == nil {
 			resp.Body.Close()
 			if resp.StatusCode == http.StatusOK {
@@ -543,6 +706,10 @@ func waitForServer(timeout time.Duration) bool {
 	return false
 }
 
+func waitForServer(timeout time.Duration) bool {
+	return waitForURL(serverURL+"/health", timeout)
+}
+
 func waitForAgentOnline(agentID string, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
@@ -714,6 +881,30 @@ func buildBinaries(projectRoot string) (serverBin, agentBin string, err error) {
 	return serverBin, agentBin, nil
 }
 
+// findOrBuildObjstore uses bin/objstore if present, otherwise builds cloud/cmd/objstore to a temporary file
+// Returns: binary path, built (true if the caller should remove it), error
+func findOrBuildObjstore(projectRoot string) (string, bool, error) {
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	if prebuilt := filepath.Join(projectRoot, "bin", "objstore"+ext); fileExists(prebuilt) {
+		abs, err := filepath.Abs(prebuilt)
+		return abs, false, err
+	}
+
+	bin := filepath.Join(os.TempDir(), fmt.Sprintf("e2e-oss-objstore-%d%s", time.Now().UnixNano(), ext))
+	fmt.Printf("Building objstore to %s...\n", bin)
+	build := exec.Command("go", "build", "-o", bin, "./cmd/objstore")
+	build.Dir = filepath.Join(projectRoot, "cloud")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		return "", false, fmt.Errorf("failed to build objstore: %w", err)
+	}
+	return bin, true, nil
+}
+
 func cleanupBinaries(serverBin, agentBin string) {
 	if serverBin != "" {
 		os.Remove(serverBin)